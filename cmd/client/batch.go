@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ozeidan/gosearch/pkg/client"
+)
+
+// batchOptions control how the results of -batch are printed
+type batchOptions struct {
+	asJSON bool
+	format pathFormat
+	// colors returns the colorizer for the results of a query,
+	// it is nil if results aren't colored
+	colors func(query string) *colorizer
+}
+
+// readQueries returns the lines of r, without empty and repeated ones
+func readQueries(r io.Reader) ([]string, error) {
+	var queries []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		query := strings.TrimSuffix(scanner.Text(), "\r")
+		if query == "" || seen[query] {
+			continue
+		}
+		seen[query] = true
+		queries = append(queries, query)
+	}
+	return queries, scanner.Err()
+}
+
+// runBatch searches for every query read from r over a single
+// connection and prints the results grouped by query
+func runBatch(r io.Reader, options []client.Option, batch batchOptions) int {
+	queries, err := readQueries(r)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gosearch: reading the queries:", err)
+		return exitUsage
+	}
+	if len(queries) == 0 {
+		return exitNoMatches
+	}
+
+	results, err := client.SearchBatch(context.Background(), queries, options...)
+	if err != nil {
+		return printError(err)
+	}
+
+	code := exitNoMatches
+	answered := 0
+	if batch.asJSON {
+		fmt.Print("{")
+	}
+	for result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(os.Stderr, "gosearch: %s: %v\n", result.Query, result.Err)
+			code = exitQueryError
+		}
+
+		var found int
+		if batch.asJSON {
+			found = printBatchJSON(result, answered == 0, batch.format)
+		} else {
+			found = printBatchGroup(result, answered == 0, batch)
+		}
+		if found > 0 && code == exitNoMatches {
+			code = exitMatches
+		}
+		answered++
+	}
+	if batch.asJSON {
+		fmt.Println("\n}")
+	}
+
+	if answered < len(queries) {
+		fmt.Fprintf(os.Stderr, "gosearch: the connection to the server was lost "+
+			"after %d of %d queries\n", answered, len(queries))
+		return exitUnavailable
+	}
+	return code
+}
+
+// printBatchGroup prints the results of a query below a header
+// like head does and returns the number of results
+func printBatchGroup(result client.BatchResult, first bool, batch batchOptions) int {
+	if !first {
+		fmt.Println()
+	}
+	fmt.Printf("==> %s <==\n", result.Query)
+
+	var colors *colorizer
+	if batch.colors != nil {
+		colors = batch.colors(result.Query)
+	}
+	lines := make(chan string, len(result.Lines))
+	for _, line := range result.Lines {
+		lines <- line
+	}
+	close(lines)
+	printed, status := printLines(lines, batch.format, colors)
+	if status != nil {
+		return status.Results
+	}
+	return printed
+}
+
+// printBatchJSON prints the results of a query as a member of
+// a JSON object and returns the number of results
+func printBatchJSON(result client.BatchResult, first bool, format pathFormat) int {
+	paths := []string{}
+	for _, line := range result.Lines {
+		if _, ok := parseStatus(line); ok || printTiming(line) || printWarning(line) {
+			continue
+		}
+		paths = append(paths, format.format(strings.TrimRight(line, "\n")))
+	}
+
+	key, _ := json.Marshal(result.Query)
+	value, _ := json.Marshal(paths)
+	if !first {
+		fmt.Print(",")
+	}
+	fmt.Printf("\n  %s: %s", key, value)
+	return len(paths)
+}
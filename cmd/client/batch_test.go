@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadQueries(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"lines", "main.go\nREADME.md\n", []string{"main.go", "README.md"}},
+		{"no_final_newline", "main.go\nREADME.md", []string{"main.go", "README.md"}},
+		{"crlf", "main.go\r\nREADME.md\r\n", []string{"main.go", "README.md"}},
+		{"empty_lines", "\nmain.go\n\n\nREADME.md\n", []string{"main.go", "README.md"}},
+		{"repeated", "main.go\nREADME.md\nmain.go\n", []string{"main.go", "README.md"}},
+		{"spaces_kept", " my file \n", []string{" my file "}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readQueries(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
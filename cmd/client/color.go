@@ -0,0 +1,199 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// highlightColor marks the matched characters, like grep's default
+const highlightColor = "01;31"
+
+// defaultColors are used for the types LS_COLORS doesn't set
+var defaultColors = map[string]string{
+	"di": "01;34",
+	"ln": "01;36",
+	"ex": "01;32",
+}
+
+// colorizer colors the printed paths by the type of their entry,
+// like ls does, and highlights the characters matching the query
+type colorizer struct {
+	// colors maps the keys of LS_COLORS, like di or *.go, to SGR codes
+	colors          map[string]string
+	query           string
+	action          int
+	caseInsensitive bool
+}
+
+// colorsEnabled returns whether results are colored: if stdout is a
+// terminal and neither -no-color nor $NO_COLOR turn colors off
+func colorsEnabled(noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(os.Stdout)
+}
+
+// newColorizer returns a colorizer for the results of query,
+// lsColors is the value of $LS_COLORS
+func newColorizer(lsColors, query string, settings request.Settings) *colorizer {
+	c := &colorizer{
+		colors:          make(map[string]string),
+		query:           query,
+		action:          settings.Action,
+		caseInsensitive: settings.CaseInsensitive,
+	}
+	for key, color := range defaultColors {
+		c.colors[key] = color
+	}
+	for _, entry := range strings.Split(lsColors, ":") {
+		i := strings.IndexByte(entry, '=')
+		if i <= 0 {
+			continue
+		}
+		c.colors[entry[:i]] = entry[i+1:]
+	}
+	return c
+}
+
+// color returns shown, which is the displayed form of path, with
+// escape sequences coloring its name and the matched characters
+func (c *colorizer) color(path, shown string) string {
+	nameStart := strings.LastIndexByte(shown, '/') + 1
+	nameColor := c.typeColor(path)
+	matched := c.matches(shown, nameStart)
+	if nameColor == "" && len(matched) == 0 {
+		return shown
+	}
+
+	var b strings.Builder
+	current := ""
+	for i := 0; i < len(shown); i++ {
+		style := ""
+		if i >= nameStart {
+			style = nameColor
+		}
+		if matched[i] {
+			style = highlightColor
+		}
+		if style != current {
+			b.WriteString("\x1b[0m")
+			if style != "" {
+				b.WriteString("\x1b[" + style + "m")
+			}
+			current = style
+		}
+		b.WriteByte(shown[i])
+	}
+	if current != "" {
+		b.WriteString("\x1b[0m")
+	}
+	return b.String()
+}
+
+// typeColor returns the color of the entry at path
+func (c *colorizer) typeColor(path string) string {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return ""
+	}
+	mode := info.Mode()
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return c.colors["ln"]
+	case mode.IsDir():
+		return c.colors["di"]
+	case mode&0111 != 0:
+		return c.colors["ex"]
+	}
+	if ext := filepath.Ext(path); ext != "" {
+		if color, ok := c.colors["*"+ext]; ok {
+			return color
+		}
+	}
+	return c.colors["fi"]
+}
+
+// matches returns the positions in shown matching the query, where
+// the name starts at nameStart. It is nil if the query doesn't match,
+// the server may have matched in a way the client doesn't know.
+func (c *colorizer) matches(shown string, nameStart int) map[int]bool {
+	query, text := c.query, shown
+	if c.caseInsensitive {
+		query, text = strings.ToLower(query), strings.ToLower(text)
+	}
+	if query == "" || len(text) != len(shown) {
+		// lower casing changed the length of a character
+		return nil
+	}
+
+	switch c.action {
+	case request.SubStringSearch:
+		if i := strings.Index(text[nameStart:], query); i >= 0 {
+			return span(nameStart+i, len(query))
+		}
+	case request.PrefixSearch:
+		if strings.HasPrefix(text[nameStart:], query) {
+			return span(nameStart, len(query))
+		}
+	case request.FuzzySearch:
+		return subsequence(text, nameStart, len(text), query)
+	case request.PathSearch:
+		return subsequence(text, 0, len(text), strings.Replace(query, "/", "", -1))
+	case request.SegmentSearch:
+		segments := strings.Split(strings.Trim(query, "/"), "/")
+		last := len(segments) - 1
+		matched := subsequence(text, nameStart, len(text), segments[last])
+		if matched == nil {
+			return nil
+		}
+		// the parent segments match directories in order
+		from := 0
+		for _, segment := range segments[:last] {
+			if segment == "" {
+				continue
+			}
+			parents := subsequence(text, from, nameStart, segment)
+			if parents == nil {
+				return nil
+			}
+			for i := range parents {
+				matched[i] = true
+				if i >= from {
+					from = i + 1
+				}
+			}
+		}
+		return matched
+	}
+	return nil
+}
+
+// span returns the positions from start to start+n
+func span(start, n int) map[int]bool {
+	matched := make(map[int]bool, n)
+	for i := start; i < start+n; i++ {
+		matched[i] = true
+	}
+	return matched
+}
+
+// subsequence matches the characters of query in order within
+// text[from:to], taking the first match of each
+func subsequence(text string, from, to int, query string) map[int]bool {
+	matched := make(map[int]bool, len(query))
+	j := 0
+	for i := from; i < to && j < len(query); i++ {
+		if text[i] == query[j] {
+			matched[i] = true
+			j++
+		}
+	}
+	if j < len(query) {
+		return nil
+	}
+	return matched
+}
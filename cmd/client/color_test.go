@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestColorizer_Matches(t *testing.T) {
+	tests := []struct {
+		name   string
+		action int
+		query  string
+		ci     bool
+		shown  string
+		want   string
+	}{
+		{"substring", request.SubStringSearch, "port", false, "/home/report.txt", "        ^^^^    "},
+		{"substring_case", request.SubStringSearch, "REP", true, "/home/report.txt", "      ^^^       "},
+		{"prefix", request.PrefixSearch, "rep", false, "/rep/report.txt", "     ^^^       "},
+		{"fuzzy", request.FuzzySearch, "rpt", false, "/home/report.txt", "      ^ ^  ^    "},
+		{"path", request.PathSearch, "hm/rt", false, "/home/report.txt", " ^ ^  ^    ^    "},
+		{"segments", request.SegmentSearch, "hm/rt", false, "/home/report.txt", " ^ ^  ^    ^    "},
+		{"segments_no_parent", request.SegmentSearch, "usr/rt", false, "/home/report.txt", ""},
+		{"no_match", request.SubStringSearch, "xyz", false, "/home/report.txt", ""},
+		{"duplicates", request.Duplicates, "*.txt", false, "/home/report.txt", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newColorizer("", tt.query, request.Settings{Action: tt.action, CaseInsensitive: tt.ci})
+			matched := c.matches(tt.shown, strings.LastIndexByte(tt.shown, '/')+1)
+
+			got := ""
+			if matched != nil {
+				for i := range tt.shown {
+					if matched[i] {
+						got += "^"
+					} else {
+						got += " "
+					}
+				}
+			}
+			if got != tt.want {
+				t.Errorf("matches() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColorizer_Color(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the types need executable bits and symlinks")
+	}
+	dir := t.TempDir()
+	file := filepath.Join(dir, "notes.md")
+	script := filepath.Join(dir, "run.sh")
+	link := filepath.Join(dir, "link")
+	for _, err := range []error{
+		ioutil.WriteFile(file, nil, 0644),
+		ioutil.WriteFile(script, nil, 0755),
+		os.Symlink(file, link),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := newColorizer("di=34:*.md=33", "n", request.Settings{Action: request.PrefixSearch})
+	tests := []struct {
+		name  string
+		path  string
+		shown string
+		want  string
+	}{
+		{"extension", file, "~/notes.md", "~/\x1b[0m\x1b[01;31mn\x1b[0m\x1b[33motes.md\x1b[0m"},
+		{"executable", script, "run.sh", "\x1b[0m\x1b[01;32mrun.sh\x1b[0m"},
+		{"symlink", link, "link", "\x1b[0m\x1b[01;36mlink\x1b[0m"},
+		{"directory", dir, "d", "\x1b[0m\x1b[34md\x1b[0m"},
+		{"vanished", filepath.Join(dir, "gone"), "gone", "gone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.color(tt.path, tt.shown); got != tt.want {
+				t.Errorf("color() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
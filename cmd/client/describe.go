@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/pkg/client"
+)
+
+// printDescription prints what the index of the server covers and
+// whether the entries below path are indexed if it isn't empty, either
+// human-readable or as the raw JSON sent by the server
+func printDescription(path string, asJSON bool) int {
+	responses, err := client.SearchRequest(path, client.Describe)
+	if err != nil {
+		return printError(err)
+	}
+
+	line, ok := <-responses
+	if !ok {
+		fmt.Fprintln(os.Stderr, "gosearch: the server sent no description")
+		return 1
+	}
+	for range responses {
+	}
+
+	if asJSON {
+		fmt.Print(line)
+		return 0
+	}
+
+	var d request.Description
+	if err := json.Unmarshal([]byte(line), &d); err != nil {
+		fmt.Fprintln(os.Stderr, "gosearch: invalid description:", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, root := range d.Roots {
+		state := ""
+		if root.Indexing {
+			state = " (indexing)"
+		} else if root.Paused {
+			state = " (paused)"
+		}
+		fmt.Fprintf(w, "root:\t%s%s\n", root.Path, state)
+		fmt.Fprintf(w, "  indexed:\t%d files, %d directories\n",
+			root.IndexedFiles, root.IndexedDirectories)
+		fmt.Fprintf(w, "  last full index:\t%s\n", unixTime(root.LastIndex))
+		fmt.Fprintf(w, "  last reconciliation:\t%s\n", unixTime(root.LastReconciliation))
+		fmt.Fprintf(w, "  last refresh:\t%s\n", unixTime(root.LastRefresh))
+	}
+	fmt.Fprintf(w, "watcher:\t%s\n", orNone(d.Watcher))
+	if d.Policy != nil {
+		fmt.Fprintf(w, "policy:\t%s\n", queryPolicy(*d.Policy))
+	}
+	w.Flush()
+
+	fmt.Println("mounts:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, m := range d.Mounts {
+		state := "not watched"
+		switch {
+		case m.Excluded:
+			state = "excluded"
+		case m.Watched:
+			state = "watched"
+		}
+		if m.Stale && !m.Excluded {
+			state += ", stale"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\tread %s\n", m.MountPoint, m.FSType, m.Source, state,
+			unixTime(m.LastReconciled))
+	}
+	w.Flush()
+
+	fmt.Println("filters:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, f := range d.Filters {
+		line := fmt.Sprintf("  %s\t%s", f.Class, f.Pattern)
+		if f.Default {
+			line += "\t(default)"
+		}
+		fmt.Fprintln(w, line)
+	}
+	w.Flush()
+
+	if len(d.Lazy) > 0 {
+		fmt.Println("lazily indexed:")
+		w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, l := range d.Lazy {
+			fmt.Fprintf(w, "  %s\tuntil %s\n", l.Path, expiryTime(l.Expires))
+		}
+		w.Flush()
+	}
+
+	if c := d.Coverage; c != nil {
+		switch {
+		case c.Expires != 0:
+			fmt.Printf("%s: indexed lazily until %s\n", c.Path, expiryTime(c.Expires))
+		case c.Indexed:
+			fmt.Printf("%s: indexed\n", c.Path)
+		default:
+			fmt.Printf("%s: not indexed, %s\n", c.Path, c.Reason)
+		}
+	}
+	return 0
+}
+
+// queryPolicy describes the limits of the server policy
+func queryPolicy(p request.Policy) string {
+	var limits []string
+	if p.DefaultMaxResults > 0 {
+		limits = append(limits, fmt.Sprintf("%d results by default", p.DefaultMaxResults))
+	}
+	if p.MaxResults > 0 {
+		limits = append(limits, fmt.Sprintf("%d results at most", p.MaxResults))
+	}
+	if p.DenyIncludeFiltered {
+		limits = append(limits, "no -include-filtered")
+	}
+	if len(limits) == 0 {
+		return "none"
+	}
+	return strings.Join(limits, ", ")
+}
+
+// expiryTime formats a Unix time in the future
+func expiryTime(t int64) string {
+	return time.Unix(t, 0).Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/pkg/errors"
+)
+
+// confirmPreview is the number of results shown by the -confirm prompt
+const confirmPreview = 10
+
+// limits of a single -X invocation, well below the usual ARG_MAX
+const (
+	maxBatchArgs  = 5000
+	maxBatchBytes = 128 * 1024
+)
+
+// exit codes of -x and -X, the same xargs uses
+const (
+	exitCommandFailed   = 123
+	exitCommandSignaled = 125
+	exitCommandNotRun   = 127
+)
+
+// execOptions configure running a command on the results
+type execOptions struct {
+	// command contains {} where the paths are inserted,
+	// they are appended if it doesn't
+	command string
+	// batch passes as many paths as possible to each invocation
+	batch bool
+	// shell runs command with sh -c instead of splitting it into words
+	shell bool
+	// confirm asks before running anything
+	confirm bool
+	// jobs is the number of invocations running at the same time
+	jobs int
+}
+
+// execResults runs the command of options on the NUL-terminated
+// paths received on results and returns the exit code of gosearch
+func execResults(results <-chan string, options execOptions) int {
+	template, err := commandTemplate(options)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gosearch:", err)
+		return 2
+	}
+
+	// found is only read once paths is closed
+	found := 0
+	paths := make(chan string)
+	go func() {
+		defer close(paths)
+		for result := range results {
+			if _, ok := parseStatus(result); ok || printTiming(result) ||
+				printWarning(result) {
+				continue
+			}
+			found++
+			path := strings.TrimSuffix(result, "\x00")
+			// the commands run on the paths at aliases too
+			if alias, ok := request.ParseAlias(path); ok {
+				path = alias
+			} else if filtered, ok := request.ParseFiltered(path); ok {
+				path = filtered
+			} else if kept, _, ok := request.ParseLinks(path); ok {
+				path = kept
+			} else if scored, _, ok := request.ParseScore(path); ok {
+				path = scored
+			}
+			paths <- path
+		}
+	}()
+
+	if options.confirm {
+		var all []string
+		for path := range paths {
+			all = append(all, path)
+		}
+		if len(all) == 0 {
+			return exitNoMatches
+		}
+		if !confirm(options.command, all) {
+			return 0
+		}
+
+		paths = make(chan string)
+		go func() {
+			defer close(paths)
+			for _, path := range all {
+				paths <- path
+			}
+		}()
+	}
+
+	invocations := make(chan []string)
+	go func() {
+		defer close(invocations)
+		if !options.batch {
+			for path := range paths {
+				invocations <- []string{path}
+			}
+			return
+		}
+		for batch := range batches(paths) {
+			invocations <- batch
+		}
+	}()
+
+	jobs := options.jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	var mu sync.Mutex
+	code := 0
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for args := range invocations {
+				c := run(template.args(args))
+				mu.Lock()
+				if c > code {
+					code = c
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if found == 0 {
+		return exitNoMatches
+	}
+	return code
+}
+
+// template is a command line with a placeholder for the paths
+type template struct {
+	words []string
+	// inline replaces {} within words instead of only whole words
+	inline bool
+	// appended passes the paths after the words
+	appended bool
+}
+
+// commandTemplate builds the template of the command of options
+func commandTemplate(options execOptions) (template, error) {
+	if options.shell {
+		// the paths are passed as positional parameters,
+		// so the shell never parses them
+		script := options.command
+		if strings.Contains(script, "{}") {
+			script = strings.Replace(script, "{}", `"$@"`, -1)
+		} else {
+			script += ` "$@"`
+		}
+		return template{words: []string{"sh", "-c", script, "sh"}, appended: true}, nil
+	}
+
+	words, err := splitCommand(options.command)
+	if err != nil {
+		return template{}, err
+	}
+	if len(words) == 0 {
+		return template{}, errors.New("empty command")
+	}
+
+	t := template{words: words, inline: !options.batch, appended: true}
+	for _, word := range words {
+		if word == "{}" || (t.inline && strings.Contains(word, "{}")) {
+			t.appended = false
+		}
+	}
+	return t, nil
+}
+
+// args returns the command line running the template on paths
+func (t template) args(paths []string) []string {
+	var args []string
+	for _, word := range t.words {
+		switch {
+		case t.appended:
+			args = append(args, word)
+		case word == "{}":
+			args = append(args, paths...)
+		case t.inline:
+			args = append(args, strings.Replace(word, "{}", paths[0], -1))
+		default:
+			args = append(args, word)
+		}
+	}
+	if t.appended {
+		args = append(args, paths...)
+	}
+	return args
+}
+
+// splitCommand splits s into words like a shell would,
+// honoring single and double quotes and backslash escapes
+func splitCommand(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\' && quote != '\'':
+			if i+1 == len(runes) {
+				return nil, errors.New("command ends with a backslash")
+			}
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.Errorf("unterminated %c quote in command", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// batches groups paths into batches that fit on a command line
+func batches(paths <-chan string) <-chan []string {
+	out := make(chan []string)
+	go func() {
+		defer close(out)
+		var batch []string
+		size := 0
+		for path := range paths {
+			if len(batch) > 0 &&
+				(len(batch) == maxBatchArgs || size+len(path)+1 > maxBatchBytes) {
+				out <- batch
+				batch = nil
+				size = 0
+			}
+			batch = append(batch, path)
+			size += len(path) + 1
+		}
+		if len(batch) > 0 {
+			out <- batch
+		}
+	}()
+	return out
+}
+
+// run runs a command and returns the exit code it contributes to gosearch's
+func run(args []string) int {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if err == nil {
+		return 0
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		status, ok := exitErr.Sys().(syscall.WaitStatus)
+		if ok && status.Signaled() {
+			fmt.Fprintf(os.Stderr, "gosearch: %s killed by %s\n", args[0], status.Signal())
+			return exitCommandSignaled
+		}
+		return exitCommandFailed
+	}
+
+	fmt.Fprintln(os.Stderr, "gosearch:", err)
+	return exitCommandNotRun
+}
+
+// confirm shows the first results and asks whether to run command on them
+func confirm(command string, paths []string) bool {
+	for i, path := range paths {
+		if i == confirmPreview {
+			fmt.Fprintf(os.Stderr, "  ... and %d more\n", len(paths)-confirmPreview)
+			break
+		}
+		fmt.Fprintf(os.Stderr, "  %q\n", path)
+	}
+	fmt.Fprintf(os.Stderr, "run %q on %d results? [y/N] ", command, len(paths))
+
+	// stdin may be the input of a pipeline
+	in := os.Stdin
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		defer tty.Close()
+		in = tty
+	}
+
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    []string
+		wantErr bool
+	}{
+		{"plain", "rm -v", []string{"rm", "-v"}, false},
+		{"spaces", "  rm\t-v  ", []string{"rm", "-v"}, false},
+		{"single_quotes", `echo 'a  b' "c"`, []string{"echo", "a  b", "c"}, false},
+		{"escapes", `echo a\ b "\"" '\'`, []string{"echo", "a b", `"`, `\`}, false},
+		{"empty_word", `echo ''`, []string{"echo", ""}, false},
+		{"placeholder", "cp {} /tmp", []string{"cp", "{}", "/tmp"}, false},
+		{"unterminated", `echo "a`, nil, true},
+		{"trailing_backslash", `echo \`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitCommand(tt.command)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplate_Args(t *testing.T) {
+	paths := []string{"/a b", "/c\nd"}
+	tests := []struct {
+		name    string
+		options execOptions
+		paths   []string
+		want    []string
+	}{
+		{
+			"appended",
+			execOptions{command: "rm -v"},
+			paths[:1],
+			[]string{"rm", "-v", "/a b"},
+		},
+		{
+			"placeholder",
+			execOptions{command: "cp {} /tmp"},
+			paths[:1],
+			[]string{"cp", "/a b", "/tmp"},
+		},
+		{
+			"inline_placeholder",
+			execOptions{command: "convert {} {}.png"},
+			paths[:1],
+			[]string{"convert", "/a b", "/a b.png"},
+		},
+		{
+			"batch_appended",
+			execOptions{command: "rm", batch: true},
+			paths,
+			[]string{"rm", "/a b", "/c\nd"},
+		},
+		{
+			"batch_placeholder",
+			execOptions{command: "cp -t /tmp {} --", batch: true},
+			paths,
+			[]string{"cp", "-t", "/tmp", "/a b", "/c\nd", "--"},
+		},
+		{
+			"shell",
+			execOptions{command: "ls {} | wc -l", shell: true},
+			paths[:1],
+			[]string{"sh", "-c", `ls "$@" | wc -l`, "sh", "/a b"},
+		},
+		{
+			"shell_appended",
+			execOptions{command: "ls", shell: true, batch: true},
+			paths,
+			[]string{"sh", "-c", `ls "$@"`, "sh", "/a b", "/c\nd"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := commandTemplate(tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := template.args(tt.paths); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("args() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatches(t *testing.T) {
+	long := strings.Repeat("x", maxBatchBytes/2)
+	tests := []struct {
+		name  string
+		paths []string
+		want  []int
+	}{
+		{"empty", nil, nil},
+		{"single", []string{"/a", "/b"}, []int{2}},
+		{"bytes", []string{long, long, long}, []int{1, 1, 1}},
+		{"count", make([]string, maxBatchArgs+1), []int{maxBatchArgs, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths := make(chan string)
+			go func() {
+				defer close(paths)
+				for _, path := range tt.paths {
+					paths <- path
+				}
+			}()
+
+			var got []int
+			for batch := range batches(paths) {
+				got = append(got, len(batch))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batch sizes %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_ExitCodes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands need a unix shell")
+	}
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"success", []string{"true"}, 0},
+		{"failure", []string{"false"}, exitCommandFailed},
+		{"signal", []string{"sh", "-c", "kill -9 $$"}, exitCommandSignaled},
+		{"not_found", []string{"/nonexistent/command"}, exitCommandNotRun},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := run(tt.args); got != tt.want {
+				t.Errorf("run() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ozeidan/gosearch/internal/health"
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/pkg/client"
+)
+
+// printHealth prints the health of the server and returns the exit
+// code of its state, an unreachable server is critical
+func printHealth(asJSON bool) int {
+	responses, err := client.SearchRequest("", client.Health)
+	if err != nil {
+		printError(err)
+		return health.Stale.ExitCode()
+	}
+
+	line, ok := <-responses
+	for range responses {
+	}
+	var response request.HealthResponse
+	if ok {
+		err = json.Unmarshal([]byte(line), &response)
+	}
+	if !ok || err != nil {
+		fmt.Fprintln(os.Stderr, "gosearch: the server sent no health state")
+		return health.Stale.ExitCode()
+	}
+
+	if asJSON {
+		fmt.Print(line)
+	} else {
+		fmt.Println(healthLine(response))
+	}
+	return health.State(response.State).ExitCode()
+}
+
+// healthLine formats response as a single line, like monitoring
+// plugins print their state
+func healthLine(response request.HealthResponse) string {
+	if len(response.Reasons) == 0 {
+		return response.State
+	}
+	return response.State + ": " + strings.Join(response.Reasons, "; ")
+}
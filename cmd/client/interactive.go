@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/pkg/client"
+)
+
+// debounceDelay is how long the picker waits for further keystrokes
+// before sending a query
+const debounceDelay = 50 * time.Millisecond
+
+// maxPickerResults is the maximal number of results the picker shows
+const maxPickerResults = 15
+
+// exit codes of -i, the same fzf uses
+const (
+	exitNoSelection = 1
+	exitAborted     = 130
+)
+
+type keyKind int
+
+const (
+	keyRune keyKind = iota
+	keyBackspace
+	keyClear
+	keyDeleteWord
+	keyUp
+	keyDown
+	keyAccept
+	keyAbort
+	keyEOF
+)
+
+type key struct {
+	kind keyKind
+	r    rune
+}
+
+// parseKeys decodes the bytes read from a terminal in raw mode
+func parseKeys(b []byte) []key {
+	var keys []key
+	for i := 0; i < len(b); i++ {
+		switch c := b[i]; c {
+		case 3:
+			keys = append(keys, key{kind: keyAbort})
+		case 4:
+			keys = append(keys, key{kind: keyEOF})
+		case '\r', '\n':
+			keys = append(keys, key{kind: keyAccept})
+		case 127, 8:
+			keys = append(keys, key{kind: keyBackspace})
+		case 21:
+			keys = append(keys, key{kind: keyClear})
+		case 23:
+			keys = append(keys, key{kind: keyDeleteWord})
+		case 16:
+			keys = append(keys, key{kind: keyUp})
+		case 14:
+			keys = append(keys, key{kind: keyDown})
+		case 27:
+			if i+1 == len(b) {
+				keys = append(keys, key{kind: keyAbort})
+				continue
+			}
+			// CSI or SS3 sequences, only the arrows are handled
+			if i+2 < len(b) && (b[i+1] == '[' || b[i+1] == 'O') {
+				switch b[i+2] {
+				case 'A':
+					keys = append(keys, key{kind: keyUp})
+				case 'B':
+					keys = append(keys, key{kind: keyDown})
+				}
+				i += 2
+				continue
+			}
+			i++
+		default:
+			if c < 32 {
+				continue
+			}
+			r, size := utf8.DecodeRune(b[i:])
+			keys = append(keys, key{kind: keyRune, r: r})
+			i += size - 1
+		}
+	}
+	return keys
+}
+
+// picker is the state of the interactive prompt
+type picker struct {
+	query    []rune
+	results  []string
+	selected int
+	// status is shown instead of the results, e.g. errors
+	status string
+}
+
+// handle applies a keystroke, it returns whether the query changed
+// and whether the picker is done
+func (p *picker) handle(k key) (changed, done bool) {
+	switch k.kind {
+	case keyRune:
+		p.query = append(p.query, k.r)
+		return true, false
+	case keyBackspace:
+		if len(p.query) == 0 {
+			return false, false
+		}
+		p.query = p.query[:len(p.query)-1]
+		return true, false
+	case keyClear:
+		p.query = p.query[:0]
+		return true, false
+	case keyDeleteWord:
+		end := len(p.query)
+		for end > 0 && p.query[end-1] == ' ' {
+			end--
+		}
+		for end > 0 && p.query[end-1] != ' ' {
+			end--
+		}
+		p.query = p.query[:end]
+		return true, false
+	case keyUp:
+		if p.selected > 0 {
+			p.selected--
+		}
+	case keyDown:
+		if p.selected < len(p.results)-1 {
+			p.selected++
+		}
+	case keyAccept, keyAbort:
+		return false, true
+	case keyEOF:
+		return false, len(p.query) == 0
+	}
+	return false, false
+}
+
+// selection returns the selected result
+func (p *picker) selection() (string, bool) {
+	if p.selected >= len(p.results) {
+		return "", false
+	}
+	return p.results[p.selected], true
+}
+
+// render draws the prompt and the results, leaving the cursor
+// at the end of the query
+func (p *picker) render(width int) string {
+	var b strings.Builder
+	b.WriteString("\r\x1b[J> ")
+	b.WriteString(string(p.query))
+
+	lines := 0
+	if p.status != "" {
+		b.WriteString("\r\n  " + truncate(p.status, width-2))
+		lines++
+	}
+	for i, result := range p.results {
+		b.WriteString("\r\n")
+		line := truncate(result, width-2)
+		if i == p.selected {
+			b.WriteString("> \x1b[7m" + line + "\x1b[0m")
+		} else {
+			b.WriteString("  " + line)
+		}
+		lines++
+	}
+
+	if lines > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", lines)
+	}
+	fmt.Fprintf(&b, "\r\x1b[%dC", 2+len(p.query))
+	return b.String()
+}
+
+// truncate shortens s to width runes, keeping the end of the path
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if width < 2 || len(runes) <= width {
+		return s
+	}
+	return "…" + string(runes[len(runes)-width+1:])
+}
+
+type resultSet struct {
+	generation int
+	results    []string
+	err        error
+}
+
+// interactive runs the picker on the terminal, starting with query,
+// and prints the selected path to stdout. options are passed on
+// to every query.
+func interactive(query string, options []client.Option) int {
+	tty, restore, err := openRawTerminal()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gosearch: -i needs a terminal:", err)
+		return 2
+	}
+	defer tty.Close()
+	defer restore()
+
+	height, width := maxPickerResults, 80
+	if rows, cols, err := terminalSize(tty); err == nil {
+		width = cols
+		if rows-2 < height {
+			height = rows - 2
+		}
+		if height < 1 {
+			height = 1
+		}
+	}
+	options = append(options, client.ReverseSort, client.MaxResults(height))
+
+	// reserve the lines below the prompt, so the results don't scroll it away
+	fmt.Fprintf(tty, "%s\x1b[%dA", strings.Repeat("\n", height), height)
+
+	keys := make(chan []byte)
+	go func() {
+		for {
+			buf := make([]byte, 64)
+			n, err := tty.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- buf[:n]
+		}
+	}()
+
+	p := &picker{query: []rune(query)}
+	results := make(chan resultSet)
+	debounce := time.After(0)
+	generation := 0
+	cancel := func() {}
+	defer func() { cancel() }()
+
+	tty.WriteString(p.render(width))
+	for {
+		select {
+		case b, ok := <-keys:
+			if !ok {
+				tty.WriteString("\r\x1b[J")
+				return exitAborted
+			}
+			for _, k := range parseKeys(b) {
+				changed, done := p.handle(k)
+				if done {
+					tty.WriteString("\r\x1b[J")
+					if k.kind != keyAccept {
+						return exitAborted
+					}
+					selection, ok := p.selection()
+					if !ok {
+						return exitNoSelection
+					}
+					fmt.Println(selection)
+					return 0
+				}
+				if changed {
+					debounce = time.After(debounceDelay)
+				}
+			}
+		case <-debounce:
+			debounce = nil
+			cancel()
+			generation++
+			if len(p.query) == 0 {
+				cancel = func() {}
+				p.results, p.selected, p.status = nil, 0, ""
+				break
+			}
+
+			ctx, cancelSearch := context.WithCancel(context.Background())
+			cancel = cancelSearch
+			go search(ctx, generation, string(p.query), options, results)
+		case set := <-results:
+			if set.generation != generation {
+				continue
+			}
+			p.results, p.selected, p.status = set.results, 0, ""
+			if set.err != nil {
+				p.status = set.err.Error()
+				if set.err == client.ErrConnectionFailed {
+					p.status = "can't connect to the server at " + client.SocketPath
+				}
+			}
+		}
+
+		tty.WriteString(p.render(width))
+	}
+}
+
+// search sends the query and passes the complete result list on to
+// results, unless ctx is cancelled first
+func search(ctx context.Context, generation int, query string,
+	options []client.Option, results chan<- resultSet) {
+	set := resultSet{generation: generation}
+
+	responses, err := client.SearchRequestContext(ctx, query, options...)
+	set.err = err
+	if err == nil {
+		for response := range responses {
+			if _, ok := parseStatus(response); ok {
+				continue
+			}
+			// stderr is the terminal the results are drawn on
+			if _, ok := request.ParseWarning(strings.TrimSuffix(response, "\n")); ok {
+				continue
+			}
+			set.results = append(set.results, strings.TrimSuffix(response, "\n"))
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	select {
+	case results <- set:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []key
+	}{
+		{"runes", "ab", []key{{keyRune, 'a'}, {keyRune, 'b'}}},
+		{"utf8", "ä", []key{{keyRune, 'ä'}}},
+		{"arrows", "\x1b[A\x1bOB", []key{{kind: keyUp}, {kind: keyDown}}},
+		{"unknown_sequence", "\x1b[Cx", []key{{keyRune, 'x'}}},
+		{"escape", "\x1b", []key{{kind: keyAbort}}},
+		{"alt", "\x1bx", nil},
+		{"enter", "a\r", []key{{keyRune, 'a'}, {kind: keyAccept}}},
+		{"editing", "\x7f\x15\x17", []key{{kind: keyBackspace},
+			{kind: keyClear}, {kind: keyDeleteWord}}},
+		{"control", "\x03\x04", []key{{kind: keyAbort}, {kind: keyEOF}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseKeys([]byte(tt.input)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseKeys(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPicker_Handle(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		key          key
+		wantQuery    string
+		wantChanged  bool
+		wantDone     bool
+		wantSelected int
+	}{
+		{"type", "foo", key{keyRune, 'd'}, "food", true, false, 0},
+		{"backspace", "foo", key{kind: keyBackspace}, "fo", true, false, 0},
+		{"backspace_empty", "", key{kind: keyBackspace}, "", false, false, 0},
+		{"delete_word", "foo bar ", key{kind: keyDeleteWord}, "foo ", true, false, 0},
+		{"clear", "foo bar", key{kind: keyClear}, "", true, false, 0},
+		{"down", "foo", key{kind: keyDown}, "foo", false, false, 1},
+		{"eof_query", "foo", key{kind: keyEOF}, "foo", false, false, 0},
+		{"eof_empty", "", key{kind: keyEOF}, "", false, true, 0},
+		{"accept", "foo", key{kind: keyAccept}, "foo", false, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &picker{query: []rune(tt.query), results: []string{"/a", "/b"}}
+			changed, done := p.handle(tt.key)
+			if string(p.query) != tt.wantQuery || changed != tt.wantChanged ||
+				done != tt.wantDone || p.selected != tt.wantSelected {
+				t.Errorf("handle() = %v, %v with query %q, selected %d",
+					changed, done, string(p.query), p.selected)
+			}
+		})
+	}
+}
@@ -1,33 +1,281 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/request"
 	"github.com/ozeidan/gosearch/pkg/client"
 )
 
 func main() {
 	fuzzyFlag := flag.Bool("f", false, "use fuzzy searching")
 	prefixFlag := flag.Bool("p", false, "do a prefix search (faster)")
+	globFlag := flag.Bool("glob", false,
+		"match *, ? and [...] in the query like the shell does, \\ escapes them")
 	pathFlag := flag.Bool("fp", false, "fuzzy searching on file paths")
+	segmentsFlag := flag.Bool("fs", false,
+		"fuzzy searching on names, parts of the query before a / match parent directories")
+	duplicatesFlag := flag.Int("duplicates", 0,
+		"list the names shared by at least this many entries, followed by their paths, "+
+			"the query is an optional glob pattern for the names")
+	changedSinceFlag := flag.String("changed-since", "",
+		"list the entries modified after a time like \"2006-01-02 15:04\" "+
+			"or within a duration like \"1h\", the most recent last")
+	historyFlag := flag.Bool("history", false,
+		"list the recorded creations, deletions and moves of the paths matching the query, "+
+			"a glob pattern or a substring, the most recent last")
+	jumpFlag := flag.Bool("jump", false,
+		"list the directories whose name starts with the query, those named like it "+
+			"and those visited most with -visit last")
+	trashFlag := flag.Bool("trash", false,
+		"search the trash directories, which aren't indexed, by the original paths of their entries, "+
+			"a glob pattern or a substring; prints when they were deleted, where from and where they are now")
+	deletedFlag := flag.Bool("deleted", false,
+		"search the entries recently deleted from the index by name, with -f or -p like those "+
+			"find entries; prints when they were deleted and their paths, the most recent last")
+	recentFlag := flag.Duration("recent", 0,
+		"list the entries created within a duration like \"10m\", by name with a query, with -f or -p "+
+			"like those find entries; prints when they were created and their paths, the most recent first")
+	treeFlag := flag.String("tree", "",
+		"print the number of indexed entries at and below each entry of a directory, the largest first, "+
+			"and then that of the directory, like du --inodes without reading the disk")
+	linksFlag := flag.String("links", "",
+		"list the other indexed paths of a file, the hard links to it")
+	visitFlag := flag.String("visit", "",
+		"record a visit of a directory, which ranks it higher for -jump")
+	aliasesFlag := flag.Bool("aliases", false,
+		"also print the results below bind mounts and other directories reachable at more than one path "+
+			"at the other paths, marked (alias)")
+	rootFlag := flag.String("root", "",
+		"only look for duplicates, changed entries or -parents below this directory")
+	parentsFlag := flag.Bool("parents", false,
+		"print the directories holding the results instead, each once, the one with the best result last")
+	includeFilteredFlag := flag.String("include-filtered", "",
+		"also search this filtered directory by walking it, its results are marked (filtered)")
+	collapseLinksFlag := flag.Bool("collapse-links", false,
+		"print one result for the hard links to a file, the shortest path, "+
+			"followed by the number of others found")
+	allFlag := flag.Bool("all", false,
+		"list every entry, without a query; combine it with -t, -n or -nosort")
 	noSortFlag := flag.Bool("nosort", false,
 		"don't sort the result set for performance gains when fuzzy searching")
 	reverseSortFlag := flag.Bool("r", false, "reverse the sort order")
 	caseInsensitiveFlag := flag.Bool("c", false, "case-insensitive searching")
 	maxResultsFlag := flag.Int("n", 250,
 		"maximum amount of results to display, set to 0 for unlimited results")
+	flag.IntVar(maxResultsFlag, "limit", 250, "same as -n")
+	typeFlag := flag.String("t", "",
+		"only show files (f) or directories (d)")
+	classFlag := flag.String("class", "",
+		"only show the files of a class: image, video, audio, document, archive, code "+
+			"or one defined in the server's config")
+	sniffFlag := flag.Bool("sniff", false,
+		"with -class, also read files without an extension to find those of the class")
+	tagFlag := flag.String("tag", "",
+		"only show the entries with this tag, read by the server from tags_xattr; "+
+			"the query is optional")
+	refreshFlag := flag.String("refresh", "",
+		"make the server read a file or directory and everything below it again, "+
+			"e.g. after changing tags")
+	sortFlag := flag.String("sort", "",
+		"sort by \"length\" (the default), modification time (\"mtime\") "+
+			"or alphabetically in the order of LC_COLLATE (\"collate\")")
+	statsFlag := flag.Bool("stats", false,
+		"print statistics about the server and its index")
+	var breakdownFlag levelsFlag
+	flag.Var(&breakdownFlag, "breakdown",
+		"with -stats, also print the size of the index below each top-level directory, "+
+			"-breakdown=2 also below the directories in them")
+	describeFlag := flag.Bool("describe", false,
+		"print the indexed directories, the mounts below them and whether they are watched, "+
+			"and the effective filters; with a directory as argument, also whether it is indexed")
+	jsonFlag := flag.Bool("json", false, "print -stats, -describe, -health and -batch as JSON")
+	healthFlag := flag.Bool("health", false,
+		"print whether the index is complete and up to date, "+
+			"exit with 0 if it is ok, 1 on warnings and 2 if it is stale")
+	generationFlag := flag.Bool("generation", false,
+		"print the generation of the server's index, which grows with every change")
+	minScoreFlag := flag.Float64("min-score", 0,
+		"drop the fuzzy matches scoring below this, from 0 to 1, see the README for the score")
+	scoresFlag := flag.Bool("scores", false, "print the score of each fuzzy match before it")
+	unlessGenerationFlag := flag.Uint64("unless-generation", 0,
+		"only search if the index changed since this generation, exit with 5 otherwise")
+	filtersFlag := flag.Bool("filters", false,
+		"print the effective filter list of the server")
+	execFlag := flag.String("x", "",
+		"run a command for each result, {} is replaced by the path")
+	execBatchFlag := flag.String("X", "",
+		"run a command with as many results as possible, like xargs")
+	shellFlag := flag.Bool("shell", false, "run the command of -x or -X with sh -c")
+	confirmFlag := flag.Bool("confirm", false,
+		"show the results and ask before running the command of -x or -X")
+	jobsFlag := flag.Int("j", 1, "number of commands of -x or -X run in parallel")
+	interactiveFlag := flag.Bool("i", false,
+		"pick a result interactively, the query is updated on every keystroke")
+	pauseFlag := flag.Bool("pause", false,
+		"stop applying file changes to the index, e.g. during a large build")
+	resumeFlag := flag.Bool("resume", false,
+		"apply the file changes received since -pause")
+	failuresFlag := flag.Bool("failures", false,
+		"list the directories the server couldn't read, whose entries are missing from the index")
+	retryFailuresFlag := flag.Bool("retry-failures", false,
+		"make the server read the directories it couldn't read again")
+	dropFlag := flag.Bool("drop", false,
+		"let the server drop the results that aren't printed as fast as they are found, "+
+			"instead of holding up its index")
+	waitFlag := flag.Bool("wait", false,
+		"if the server is still building its index, wait until the entries searched are indexed "+
+			"instead of printing the results found so far with a warning")
+	verifyFlag := flag.Bool("verify", false,
+		"make the server check that the results still exist before sending them")
+	timingFlag := flag.Bool("timing", false,
+		"print how long the server spent searching, sorting and sending to stderr")
+	requestIDFlag := flag.String("request-id", "",
+		"name the request in the server's log and -stats, an ID is generated otherwise")
+	debugFlag := flag.Bool("debug", false,
+		"make the server write a heap profile and print its memory use")
+	versionFlag := flag.Bool("version", false,
+		"print the versions of the client and the server")
+	checkConfigFlag := flag.Bool("check-config", false,
+		"validate the server configuration and print the effective configuration")
+	persistFlag := flag.Bool("persist", false,
+		"persist filter changes made with \"filter add/remove\" across restarts of the server")
+	relativeFlag := flag.Bool("relative", false,
+		"print paths relative to the working directory, unless they are more than two levels up")
+	tildeFlag := flag.Bool("tilde", false, "print ~ instead of the home directory")
+	noColorFlag := flag.Bool("no-color", false,
+		"don't color the results, they are colored if stdout is a terminal and $NO_COLOR is unset")
+	batchFlag := flag.Bool("batch", false,
+		"read one query per line from stdin and print the results of each, "+
+			"all queries are sent over one connection")
+	socketFlag := flag.String("socket", "",
+		"path of the server's socket, defaults to $GOSEARCH_SOCKET or "+
+			request.SockAddr)
 
 	flag.Parse()
 
-	if flag.NArg() < 1 {
+	if *socketFlag != "" {
+		client.SocketPath = *socketFlag
+	}
+
+	if *versionFlag {
+		os.Exit(printVersion())
+	}
+
+	if *checkConfigFlag {
+		os.Exit(checkConfig())
+	}
+
+	if *statsFlag {
+		os.Exit(printStats(*jsonFlag, int(breakdownFlag)))
+	}
+
+	if *healthFlag {
+		os.Exit(printHealth(*jsonFlag))
+	}
+
+	if *describeFlag {
+		path := ""
+		if flag.NArg() > 0 {
+			var err error
+			if path, err = indexedPath(flag.Arg(0)); err != nil {
+				printError(err)
+				os.Exit(exitUsage)
+			}
+		}
+		os.Exit(printDescription(path, *jsonFlag))
+	}
+
+	if *pauseFlag {
+		os.Exit(printResponses(client.SearchRequest("", client.Pause)))
+	}
+
+	if *debugFlag {
+		os.Exit(printResponses(client.SearchRequest("", client.Debug)))
+	}
+
+	if *resumeFlag {
+		os.Exit(printResponses(client.SearchRequest("", client.Resume)))
+	}
+
+	if *failuresFlag {
+		os.Exit(printResponses(client.SearchRequest("", client.Failures)))
+	}
+
+	if *retryFailuresFlag {
+		os.Exit(printResponses(client.SearchRequest("", client.RetryFailures)))
+	}
+
+	if *filtersFlag {
+		os.Exit(printResponses(client.SearchRequest("", client.ListFilters)))
+	}
+
+	if *generationFlag {
+		os.Exit(printGeneration())
+	}
+
+	if *visitFlag != "" {
+		dir, err := indexedPath(*visitFlag)
+		if err != nil {
+			printError(err)
+			os.Exit(exitUsage)
+		}
+		os.Exit(printResponses(client.SearchRequest(dir, client.Visit)))
+	}
+
+	if *treeFlag != "" {
+		dir, err := indexedPath(*treeFlag)
+		if err != nil {
+			printError(err)
+			os.Exit(exitUsage)
+		}
+		options := []client.Option{client.Tree, client.MaxResults(*maxResultsFlag)}
+		if *reverseSortFlag {
+			options = append(options, client.ReverseSort)
+		}
+		results, err := client.SearchRequest(dir, options...)
+		os.Exit(printResults(results, err, pathFormat{}, nil))
+	}
+
+	if *linksFlag != "" {
+		path, err := filepath.Abs(*linksFlag)
+		if err != nil {
+			printError(err)
+			os.Exit(exitUsage)
+		}
+		results, err := client.SearchRequest(path, client.Links, client.MaxResults(*maxResultsFlag))
+		os.Exit(printResults(results, err, pathFormat{}, nil))
+	}
+
+	if *refreshFlag != "" {
+		path, err := filepath.Abs(*refreshFlag)
+		if err != nil {
+			printError(err)
+			os.Exit(exitUsage)
+		}
+		os.Exit(printResponses(client.SearchRequest(path, client.RefreshPath)))
+	}
+
+	if flag.Arg(0) == "filter" {
+		os.Exit(filterCommand(flag.Args()[1:], *persistFlag))
+	}
+
+	if flag.NArg() < 1 && !*interactiveFlag && !*batchFlag && *duplicatesFlag == 0 &&
+		*changedSinceFlag == "" && !*allFlag && *tagFlag == "" && *recentFlag == 0 {
 		flag.Usage()
-		return
+		os.Exit(exitUsage)
 	}
 
 	if *fuzzyFlag && *prefixFlag {
 		flag.Usage()
-		return
+		os.Exit(exitUsage)
 	}
 
 	query := flag.Arg(0)
@@ -42,6 +290,9 @@ func main() {
 	if *prefixFlag {
 		options = append(options, client.PrefixSearch)
 	}
+	if *allFlag {
+		options = append(options, client.ListAll)
+	}
 	if *noSortFlag {
 		options = append(options, client.NoSort)
 	}
@@ -51,19 +302,391 @@ func main() {
 	if *pathFlag {
 		options = append(options, client.PathSearch)
 	}
+	if *segmentsFlag {
+		options = append(options, client.SegmentSearch)
+	}
+	if *duplicatesFlag > 0 {
+		options = append(options, client.Duplicates(*duplicatesFlag))
+	}
+	if *changedSinceFlag != "" {
+		since, err := parseSince(*changedSinceFlag, time.Now())
+		if err != nil {
+			printError(err)
+			os.Exit(exitUsage)
+		}
+		options = append(options, client.ChangedSince(since))
+	}
+	if *historyFlag {
+		options = append(options, client.History)
+	}
+	if *jumpFlag {
+		options = append(options, client.Jump)
+	}
+	if *trashFlag {
+		options = append(options, client.Trash)
+	}
+	if *deletedFlag {
+		options = append(options, client.Deleted)
+	}
+	if *recentFlag < 0 {
+		printError(fmt.Errorf("negative duration %s", *recentFlag))
+		os.Exit(exitUsage)
+	} else if *recentFlag > 0 {
+		options = append(options, client.Recent(*recentFlag))
+	}
+	if *aliasesFlag {
+		options = append(options, client.Aliases)
+	}
+	if *rootFlag != "" {
+		root, err := indexedPath(*rootFlag)
+		if err != nil {
+			printError(err)
+			os.Exit(exitUsage)
+		}
+		options = append(options, client.Root(root))
+	}
+	if *includeFilteredFlag != "" {
+		dir, err := indexedPath(*includeFilteredFlag)
+		if err != nil {
+			printError(err)
+			os.Exit(exitUsage)
+		}
+		options = append(options, client.IncludeFiltered(dir))
+	}
+	if *collapseLinksFlag {
+		options = append(options, client.CollapseHardlinks)
+	}
+	if *parentsFlag {
+		options = append(options, client.Parents)
+	}
+	if *globFlag {
+		options = append(options, client.Wildcards)
+	}
 	if *caseInsensitiveFlag {
 		options = append(options, client.CaseInsensitive)
 	}
+	if *typeFlag != "" {
+		options = append(options, client.Type(*typeFlag))
+	}
+	if *classFlag != "" || *sniffFlag {
+		options = append(options, client.Class(*classFlag, *sniffFlag))
+	}
+	if *tagFlag != "" {
+		options = append(options, client.Tag(*tagFlag))
+	}
+	if *sortFlag == request.SortCollate {
+		options = append(options, client.Collate(collationLocale()))
+	} else if *sortFlag != "" {
+		options = append(options, client.SortBy(*sortFlag))
+	}
+	if *timingFlag {
+		options = append(options, client.Timing)
+	}
+	if *dropFlag {
+		options = append(options, client.DropBehind)
+	}
+	if *verifyFlag {
+		options = append(options, client.VerifyExists)
+	}
+	if *waitFlag {
+		options = append(options, client.WaitIndex)
+	}
+	if *unlessGenerationFlag != 0 {
+		options = append(options, client.UnlessGeneration(*unlessGenerationFlag))
+	}
+	if *minScoreFlag != 0 {
+		options = append(options, client.MinScore(*minScoreFlag))
+	}
+	if *scoresFlag {
+		options = append(options, client.Scores)
+	}
+	if *requestIDFlag != "" {
+		options = append(options, client.RequestID(*requestIDFlag))
+	}
 
-	responseChan, err := client.SearchRequest(query, options...)
+	if *batchFlag && (flag.NArg() > 0 || *interactiveFlag ||
+		*execFlag != "" || *execBatchFlag != "") {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
 
-	if err == client.ErrConnectionFailed {
-		fmt.Println(err)
-		fmt.Println("is the server running?")
-		return
+	if *interactiveFlag {
+		if !*prefixFlag && !*pathFlag && !*segmentsFlag {
+			options = append(options, client.Fuzzy)
+		}
+		os.Exit(interactive(query, options))
+	}
+
+	if *execFlag != "" && *execBatchFlag != "" {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+	if *execFlag != "" || *execBatchFlag != "" {
+		options = append(options, client.NullDelimited)
+		results, err := client.SearchRequest(query, options...)
+		if err != nil {
+			os.Exit(printError(err))
+		}
+
+		os.Exit(execResults(results, execOptions{
+			command: *execFlag + *execBatchFlag,
+			batch:   *execBatchFlag != "",
+			shell:   *shellFlag,
+			confirm: *confirmFlag,
+			jobs:    *jobsFlag,
+		}))
+	}
+
+	var format pathFormat
+	if *relativeFlag {
+		format.cwd, _ = os.Getwd()
+	}
+	if *tildeFlag {
+		format.home, _ = os.UserHomeDir()
+	}
+	var colors func(query string) *colorizer
+	// history, trash, deleted and recent lines aren't paths
+	if colorsEnabled(*noColorFlag) && !*historyFlag && !*trashFlag && !*deletedFlag &&
+		*recentFlag == 0 {
+		var req request.Request
+		for _, option := range options {
+			option(&req)
+		}
+		colors = func(query string) *colorizer {
+			return newColorizer(os.Getenv("LS_COLORS"), query, req.Settings)
+		}
+	}
+
+	if *batchFlag {
+		os.Exit(runBatch(os.Stdin, options, batchOptions{
+			asJSON: *jsonFlag,
+			format: format,
+			colors: colors,
+		}))
+	}
+
+	var queryColors *colorizer
+	if colors != nil {
+		queryColors = colors(query)
+	}
+	results, err := client.SearchRequest(query, options...)
+	os.Exit(printResults(results, err, format, queryColors))
+}
+
+// filterCommand handles "filter list", "filter add PATTERN"
+// and "filter remove PATTERN"
+func filterCommand(args []string, persist bool) int {
+	if len(args) == 1 && args[0] == "list" {
+		return printResponses(client.SearchRequest("", client.ListFilters))
 	}
 
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: gosearch [-persist] filter add|remove PATTERN")
+		fmt.Fprintln(os.Stderr, "       gosearch filter list")
+		return 2
+	}
+
+	options := []client.Option{}
+	switch args[0] {
+	case "add":
+		options = append(options, client.AddFilter)
+	case "remove":
+		options = append(options, client.RemoveFilter)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown filter command %q\n", args[0])
+		return 2
+	}
+	if persist {
+		options = append(options, client.Persist)
+	}
+
+	return printResponses(client.SearchRequest(args[1], options...))
+}
+
+func checkConfig() int {
+	err := config.CheckConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	effective, err := config.EffectiveConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Println(string(effective))
+	return 0
+}
+
+// printResponses prints the responses to a request that isn't a search
+func printResponses(responseChan <-chan string, err error) int {
+	if err != nil {
+		return printError(err)
+	}
+	printLines(responseChan, pathFormat{}, nil)
+	return exitMatches
+}
+
+// printResults prints the results of a search, shortening the paths
+// with format and coloring them unless colors is nil. It returns
+// whether anything was found as exit code.
+func printResults(responseChan <-chan string, err error, format pathFormat,
+	colors *colorizer) int {
+	if err != nil {
+		return printError(err)
+	}
+
+	printed, status := printLines(responseChan, format, colors)
+	if status != nil && status.Unchanged {
+		return exitUnchanged
+	}
+	if status != nil {
+		// the lines of duplicates aren't all results
+		printed = status.Results
+		printAsOf(*status)
+	}
+	if printed == 0 {
+		return exitNoMatches
+	}
+	return exitMatches
+}
+
+// printLines prints the response lines and returns how many it
+// printed and the status ending them, if the server sent one
+func printLines(responseChan <-chan string, format pathFormat,
+	colors *colorizer) (printed int, status *request.Status) {
 	for response := range responseChan {
-		fmt.Print(response)
+		if printTiming(response) || printWarning(response) {
+			continue
+		}
+		if s, ok := parseStatus(response); ok {
+			status = &s
+			continue
+		}
+		printed++
+		trimmed := strings.TrimRight(response, "\n\x00")
+		if path, ok := request.ParseAlias(trimmed); ok {
+			fmt.Print(format.format(path) + " (alias)" + response[len(trimmed):])
+			continue
+		}
+		if path, ok := request.ParseFiltered(trimmed); ok {
+			fmt.Print(format.format(path) + " (filtered)" + response[len(trimmed):])
+			continue
+		}
+		if path, n, ok := request.ParseLinks(trimmed); ok {
+			fmt.Printf("%s (+%d links)%s", format.format(path), n, response[len(trimmed):])
+			continue
+		}
+		if path, score, ok := request.ParseScore(trimmed); ok {
+			fmt.Printf("%.3f %s%s", score, format.format(path), response[len(trimmed):])
+			continue
+		}
+		if colors != nil && strings.HasPrefix(response, "/") {
+			path := strings.TrimRight(response, "\n")
+			fmt.Print(colors.color(path, format.format(path)) + response[len(path):])
+			continue
+		}
+		fmt.Print(format.formatLine(response))
+	}
+	return printed, status
+}
+
+// asOfTolerance is how far the index searched may lag behind before
+// the client tells, the time is sent in seconds
+const asOfTolerance = 2 * time.Second
+
+// printAsOf tells on stderr if the search ran on a snapshot of the
+// index missing recent changes
+func printAsOf(status request.Status) {
+	if status.AsOf == 0 {
+		return
+	}
+	asOf := time.Unix(status.AsOf, 0)
+	if time.Since(asOf) > asOfTolerance {
+		fmt.Fprintf(os.Stderr, "gosearch: searched the index as of %s, later changes are missing\n",
+			asOf.Format("15:04:05"))
+	}
+}
+
+// parseStatus parses response if it is the status ending a search
+func parseStatus(response string) (request.Status, bool) {
+	return request.ParseStatus(strings.TrimRight(response, "\n\x00"))
+}
+
+// printWarning prints response to stderr if it is a warning
+// sent with the results and returns whether it was
+func printWarning(response string) bool {
+	warning, ok := request.ParseWarning(strings.TrimRight(response, "\n\x00"))
+	if ok {
+		fmt.Fprintln(os.Stderr, "gosearch: warning:", warning.Message)
+	}
+	return ok
+}
+
+// printTiming prints response to stderr if it is the timing
+// of a search and returns whether it was
+func printTiming(response string) bool {
+	timing, ok := request.ParseTiming(strings.TrimRight(response, "\n\x00"))
+	if !ok {
+		return false
+	}
+
+	// queries are fast, the millisecond precision of -stats hides them
+	duration := func(s float64) time.Duration {
+		return time.Duration(s * float64(time.Second)).Round(time.Microsecond)
+	}
+	fmt.Fprintf(os.Stderr, "timing: search %s, sort %s, send %s, %d of %d matches\n",
+		duration(timing.Visit), duration(timing.Sort), duration(timing.Stream),
+		timing.Results, timing.Matches)
+	return true
+}
+
+// exit codes of the client
+const (
+	// exitMatches is returned if a search found something
+	// and by requests that aren't searches
+	exitMatches = 0
+	// exitNoMatches is returned if a search found nothing
+	exitNoMatches = 1
+	// exitUsage is returned for invalid arguments
+	exitUsage = 2
+	// exitUnavailable is returned if the server can't be reached
+	exitUnavailable = 3
+	// exitQueryError is returned if the server rejected the request
+	exitQueryError = 4
+	// exitUnchanged is returned if a search wasn't made because
+	// the index is still of the generation given
+	exitUnchanged = 5
+)
+
+// printError prints err and returns the matching exit code
+// collationLocale returns the locale strings are collated in, from the
+// environment variables in the order of precedence of POSIX
+func collationLocale() string {
+	for _, name := range []string{"LC_ALL", "LC_COLLATE", "LANG"} {
+		if locale := os.Getenv(name); locale != "" {
+			return locale
+		}
+	}
+	return ""
+}
+
+func printError(err error) int {
+	if err == client.ErrConnectionFailed {
+		fmt.Fprintf(os.Stderr, "gosearch: can't connect to the server at %s, "+
+			"is it running?\n", client.SocketPath)
+		return exitUnavailable
+	}
+	fmt.Fprintln(os.Stderr, "gosearch:", err)
+
+	var response request.ErrorResponse
+	switch {
+	case errors.Is(err, client.ErrInvalidSettings):
+		return exitUsage
+	case errors.As(err, &response), err == client.ErrUnsupported:
+		return exitQueryError
 	}
+	return exitUnavailable
 }
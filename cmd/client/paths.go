@@ -0,0 +1,79 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// indexedPath returns the absolute path of the directory at path, with
+// the symlinks leading to it resolved, since the server indexes the
+// entries below a directory at its real path only. Paths that can't
+// be resolved, like those that don't exist, are only made absolute.
+func indexedPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved, nil
+	}
+	return abs, nil
+}
+
+// maxParentSteps is the number of ".." a relative path may start with,
+// paths further away from the working directory are kept absolute
+const maxParentSteps = 2
+
+// pathFormat shortens the printed paths, the server always sends
+// absolute ones
+type pathFormat struct {
+	// cwd is the directory paths are made relative to, no paths
+	// are made relative if it is empty
+	cwd string
+	// home is replaced by ~, nothing is replaced if it is empty
+	home string
+}
+
+// format shortens path, which is absolute
+func (f pathFormat) format(path string) string {
+	if f.cwd != "" {
+		if rel, ok := relativePath(f.cwd, path); ok {
+			return rel
+		}
+	}
+	if f.home != "" && f.home != "/" {
+		if path == f.home {
+			return "~"
+		}
+		if strings.HasPrefix(path, f.home+"/") {
+			return "~" + path[len(f.home):]
+		}
+	}
+	return path
+}
+
+// relativePath returns path relative to cwd, ok is false if it would
+// take more than maxParentSteps steps up. The server sends slashes on
+// every platform, so the result has them too.
+func relativePath(cwd, path string) (rel string, ok bool) {
+	rel, err := filepath.Rel(cwd, path)
+	if err != nil {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	steps := 0
+	for rest := rel; rest == ".." || strings.HasPrefix(rest, "../"); rest = strings.TrimPrefix(rest[2:], "/") {
+		steps++
+	}
+	return rel, steps <= maxParentSteps
+}
+
+// formatLine formats the path of a response line, other responses
+// like the names sent for duplicates are left alone
+func (f pathFormat) formatLine(line string) string {
+	if !strings.HasPrefix(line, "/") {
+		return line
+	}
+	trimmed := strings.TrimRight(line, "\n")
+	return f.format(trimmed) + line[len(trimmed):]
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathFormat_Format(t *testing.T) {
+	tests := []struct {
+		name   string
+		format pathFormat
+		path   string
+		want   string
+	}{
+		{"unchanged", pathFormat{}, "/home/me/src/main.go", "/home/me/src/main.go"},
+		{"below_cwd", pathFormat{cwd: "/home/me/src"}, "/home/me/src/cmd/main.go", "cmd/main.go"},
+		{"cwd", pathFormat{cwd: "/home/me/src"}, "/home/me/src", "."},
+		{"sibling", pathFormat{cwd: "/home/me/src"}, "/home/me/docs/a.txt", "../docs/a.txt"},
+		{"two_up", pathFormat{cwd: "/home/me/src"}, "/home/other", "../../other"},
+		{"too_far", pathFormat{cwd: "/home/me/src/gosearch"}, "/etc/passwd", "/etc/passwd"},
+		{"too_far_tilde", pathFormat{cwd: "/srv/www/site/public", home: "/home/me"},
+			"/home/me/notes.txt", "~/notes.txt"},
+		{"dotted_name", pathFormat{cwd: "/home/me"}, "/home/me/..hidden", "..hidden"},
+		{"tilde", pathFormat{home: "/home/me"}, "/home/me/src/main.go", "~/src/main.go"},
+		{"home", pathFormat{home: "/home/me"}, "/home/me", "~"},
+		{"home_prefix", pathFormat{home: "/home/me"}, "/home/meg/a", "/home/meg/a"},
+		{"root_home", pathFormat{home: "/"}, "/etc/passwd", "/etc/passwd"},
+		{"relative_first", pathFormat{cwd: "/home/me/src", home: "/home/me"},
+			"/home/me/src/main.go", "main.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.format.format(tt.path); got != tt.want {
+				t.Errorf("format(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathFormat_FormatLine(t *testing.T) {
+	format := pathFormat{home: "/home/me"}
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"/home/me/a.txt\n", "~/a.txt\n"},
+		{"/home/me/a.txt", "~/a.txt"},
+		{"a.txt\n", "a.txt\n"},
+		{"added glob filter /home/me/x\n", "added glob filter /home/me/x\n"},
+	}
+	for _, tt := range tests {
+		if got := format.formatLine(tt.line); got != tt.want {
+			t.Errorf("formatLine(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestIndexedPath(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "target")
+	if err := os.MkdirAll(filepath.Join(target, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(dir, "link")); err != nil {
+		t.Skip("can't create symlinks:", err)
+	}
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"real", filepath.Join(target, "sub"), filepath.Join(target, "sub")},
+		{"symlinked", filepath.Join(dir, "link"), target},
+		{"below_symlink", filepath.Join(dir, "link", "sub"), filepath.Join(target, "sub")},
+		{"missing", filepath.Join(dir, "link", "gone"), filepath.Join(dir, "link", "gone")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := indexedPath(tt.path); err != nil || got != tt.want {
+				t.Errorf("indexedPath(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sinceLayouts are the formats accepted by -changed-since besides
+// durations, in local time unless they carry a zone
+var sinceLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseSince parses the argument of -changed-since, a duration
+// before now like "1h" or a point in time like "2024-05-01 12:00"
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < 0 {
+			return time.Time{}, errors.Errorf("negative duration %s", s)
+		}
+		return now.Add(-d), nil
+	}
+	for _, layout := range sinceLayouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("invalid time %q, expected a duration like 1h "+
+		"or a time like 2006-01-02 15:04", s)
+}
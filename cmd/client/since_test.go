@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.Local)
+	tests := []struct {
+		name    string
+		arg     string
+		want    time.Time
+		wantErr bool
+	}{
+		{"duration", "1h30m", time.Date(2024, 5, 1, 11, 0, 0, 0, time.Local), false},
+		{"date", "2024-04-30", time.Date(2024, 4, 30, 0, 0, 0, 0, time.Local), false},
+		{"minutes", "2024-04-30 08:15", time.Date(2024, 4, 30, 8, 15, 0, 0, time.Local), false},
+		{"seconds", "2024-04-30 08:15:10", time.Date(2024, 4, 30, 8, 15, 10, 0, time.Local), false},
+		{"rfc3339", "2024-04-30T08:15:00Z", time.Date(2024, 4, 30, 8, 15, 0, 0, time.UTC), false},
+		{"negative", "-1h", time.Time{}, true},
+		{"invalid", "yesterday", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSince(tt.arg, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSince() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseSince() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/pkg/client"
+)
+
+// printGeneration prints the generation of the server's index
+func printGeneration() int {
+	responses, err := client.SearchRequest("", client.Generation)
+	if err != nil {
+		return printError(err)
+	}
+
+	line, ok := <-responses
+	for range responses {
+	}
+	var response request.GenerationResponse
+	if !ok || json.Unmarshal([]byte(line), &response) != nil {
+		fmt.Fprintln(os.Stderr, "gosearch: the server sent no generation")
+		return 1
+	}
+	fmt.Println(response.Generation)
+	return 0
+}
+
+// printStats prints the statistics of the server, either
+// human-readable or as the raw JSON sent by the server
+func printStats(asJSON bool, breakdown int) int {
+	options := []client.Option{client.Stats}
+	if breakdown > 0 {
+		options = append(options, client.Breakdown(breakdown))
+	}
+	responses, err := client.SearchRequest("", options...)
+	if err != nil {
+		return printError(err)
+	}
+
+	line, ok := <-responses
+	if !ok {
+		fmt.Fprintln(os.Stderr, "gosearch: the server sent no statistics")
+		return 1
+	}
+	for range responses {
+	}
+
+	if asJSON {
+		fmt.Print(line)
+		return 0
+	}
+
+	var stats request.StatsResponse
+	if err := json.Unmarshal([]byte(line), &stats); err != nil {
+		fmt.Fprintln(os.Stderr, "gosearch: invalid statistics:", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "indexed files:\t%d\n", stats.IndexedFiles)
+	fmt.Fprintf(w, "indexed directories:\t%d\n", stats.IndexedDirectories)
+	fmt.Fprintf(w, "entries now:\t%d\n", stats.IndexedEntries)
+	fmt.Fprintf(w, "index generation:\t%d\n", stats.Generation)
+	fmt.Fprintf(w, "last full index took:\t%s\n", seconds(stats.IndexDuration))
+	fmt.Fprintf(w, "memory:\t%s allocated, %s from the OS\n",
+		mebibytes(stats.MemoryAlloc), mebibytes(stats.MemorySys))
+	if stats.ColdBuilt != 0 {
+		fmt.Fprintf(w, "cold entries:\t%d, %s in memory, %s on disk, read %s\n", stats.ColdEntries,
+			mebibytes(stats.ColdMemory), mebibytes(stats.ColdFileSize), unixTime(stats.ColdBuilt))
+	}
+	fmt.Fprintf(w, "pid:\t%d\n", stats.Pid)
+	fmt.Fprintf(w, "uptime:\t%s\n", seconds(stats.Uptime))
+	fmt.Fprintf(w, "events processed:\t%d\n", stats.EventsProcessed)
+	fmt.Fprintf(w, "event backlog:\t%d\n", stats.Backlog)
+	if stats.Paused {
+		fmt.Fprintf(w, "paused:\t%d events, %d directories pending\n",
+			stats.PausedEvents, stats.PendingDirectories)
+	}
+	if stats.FailedDirectories > 0 {
+		fmt.Fprintf(w, "failed directories:\t%d (%d not retried)\n",
+			stats.FailedDirectories, stats.SuppressedFailures)
+	}
+	if len(stats.Aliases) > 0 {
+		aliases := make([]string, 0, len(stats.Aliases))
+		for alias := range stats.Aliases {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		fmt.Fprintf(w, "aliases:\t%d\n", len(aliases))
+		for _, alias := range aliases {
+			fmt.Fprintf(w, "  %s\tindexed at %s\n", alias, stats.Aliases[alias])
+		}
+	}
+	if stats.DeletedCapacity > 0 {
+		fmt.Fprintf(w, "deleted entries kept:\t%d of %d\n", stats.DeletedEntries, stats.DeletedCapacity)
+	}
+	if stats.RecentCapacity > 0 {
+		fmt.Fprintf(w, "created entries kept:\t%d of %d, %d dropped\n",
+			stats.RecentEntries, stats.RecentCapacity, stats.RecentDropped)
+	}
+	fmt.Fprintf(w, "last reconciliation:\t%s\n", unixTime(stats.LastReconciliation))
+	fmt.Fprintf(w, "watcher:\t%s\n", orNone(stats.Watcher))
+	fmt.Fprintf(w, "watched mounts:\t%s\n", strings.Join(stats.WatchedMounts, ", "))
+	if len(stats.StaleMounts) > 0 {
+		fmt.Fprintf(w, "stale mounts:\t%d\n", len(stats.StaleMounts))
+		for _, m := range stats.StaleMounts {
+			fmt.Fprintf(w, "  %s\t%s, read %s\n", m.MountPoint, m.FSType, unixTime(m.LastReconciled))
+		}
+	}
+	fmt.Fprintf(w, "filter rejections:\t%s\n", rejections(stats.FilterRejections))
+	limits := stats.QueryLimits
+	fmt.Fprintf(w, "queries:\t%d running, %d queued, %d rejected\n",
+		limits.Running, limits.Queued, limits.Rejected)
+	fmt.Fprintf(w, "query limits:\t%s\n", queryLimits(limits.Limits))
+	if stats.QueryCacheSize > 0 {
+		fmt.Fprintf(w, "query cache:\t%d hits, %d misses, %d searches kept at most\n",
+			stats.QueryCacheHits, stats.QueryCacheMisses, stats.QueryCacheSize)
+	}
+	fmt.Fprintf(w, "recent queries:\t%d\n", len(stats.RecentQueries))
+	for _, q := range stats.RecentQueries {
+		duration := time.Duration(q.Duration * float64(time.Second)).Round(time.Microsecond)
+		fmt.Fprintf(w, "  %s\t%s %q, %d results in %s\n",
+			q.RequestID, q.Action, q.Query, q.Results, duration)
+	}
+	w.Flush()
+
+	if len(stats.Breakdown) > 0 {
+		fmt.Println()
+		printBreakdown(stats.Breakdown)
+	}
+	return 0
+}
+
+// printBreakdown prints the size of the index below the directories,
+// those below a directory indented under it
+func printBreakdown(breakdown []request.IndexBreakdown) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "files\tdirectories\tname bytes\tmemory\tshare\t\tpath")
+	var printParts func(parts []request.IndexBreakdown, indent string)
+	printParts = func(parts []request.IndexBreakdown, indent string) {
+		for _, b := range parts {
+			fmt.Fprintf(w, "%d\t%d\t%d\t%s\t%.1f%%\t\t%s%s\n", b.Files, b.Directories,
+				b.NameBytes, mebibytes(b.Memory), 100*b.Share, indent, b.Path)
+			printParts(b.Below, indent+"  ")
+		}
+	}
+	printParts(breakdown, "")
+	w.Flush()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+func seconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond).String()
+}
+
+func mebibytes(b uint64) string {
+	return fmt.Sprintf("%.1f MiB", float64(b)/(1<<20))
+}
+
+func unixTime(t int64) string {
+	if t == 0 {
+		return "never"
+	}
+	at := time.Unix(t, 0)
+	return fmt.Sprintf("%s (%s ago)", at.Format("2006-01-02 15:04:05"),
+		time.Since(at).Round(time.Second))
+}
+
+// queryLimits describes the limits that are set
+func queryLimits(l request.Limits) string {
+	var limits []string
+	if l.MaxConcurrent > 0 {
+		limits = append(limits, fmt.Sprintf("%d concurrent", l.MaxConcurrent))
+	}
+	if l.MaxConcurrentPerPeer > 0 {
+		limits = append(limits, fmt.Sprintf("%d concurrent per user", l.MaxConcurrentPerPeer))
+	}
+	if l.Rate > 0 {
+		burst := l.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		limits = append(limits, fmt.Sprintf("%g per second per user, burst %d",
+			l.Rate, burst))
+	}
+	if len(limits) == 0 {
+		return "none"
+	}
+	if l.QueueSize > 0 {
+		limits = append(limits, fmt.Sprintf("%d queued", l.QueueSize))
+	}
+	return strings.Join(limits, ", ")
+}
+
+// rejections lists the filter classes that rejected paths
+func rejections(counts map[string]uint64) string {
+	var classes []string
+	for class, count := range counts {
+		if count > 0 {
+			classes = append(classes, class)
+		}
+	}
+	if len(classes) == 0 {
+		return "none"
+	}
+
+	sort.Strings(classes)
+	for i, class := range classes {
+		classes[i] = fmt.Sprintf("%s %d", class, counts[class])
+	}
+	return strings.Join(classes, ", ")
+}
+
+// levelsFlag is a number of levels, set to 1 by the flag alone
+type levelsFlag int
+
+func (l *levelsFlag) String() string { return strconv.Itoa(int(*l)) }
+
+func (l *levelsFlag) Set(value string) error {
+	switch value {
+	case "true":
+		*l = 1
+	case "false":
+		*l = 0
+	default:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > 2 {
+			return fmt.Errorf("invalid number of levels %q, expected 1 or 2", value)
+		}
+		*l = levelsFlag(n)
+	}
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value
+func (l *levelsFlag) IsBoolFlag() bool { return true }
@@ -0,0 +1,9 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// the requests reading and setting the termios of a terminal
+const (
+	ioctlGetTermios = unix.TCGETS
+	ioctlSetTermios = unix.TCSETS
+)
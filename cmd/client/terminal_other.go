@@ -0,0 +1,27 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package main
+
+import (
+	"errors"
+	"os"
+	"runtime"
+)
+
+// errNoTerminal is returned where a terminal would be set up
+var errNoTerminal = errors.New("terminals aren't supported on " + runtime.GOOS)
+
+// isTerminal returns false, so results aren't colored
+func isTerminal(*os.File) bool {
+	return false
+}
+
+// openRawTerminal fails, -i isn't available
+func openRawTerminal() (*os.File, func(), error) {
+	return nil, nil, errNoTerminal
+}
+
+// terminalSize fails, the defaults are used
+func terminalSize(*os.File) (rows, cols int, err error) {
+	return 0, 0, errNoTerminal
+}
@@ -0,0 +1,50 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// isTerminal returns whether f is a terminal
+func isTerminal(f *os.File) bool {
+	_, err := unix.IoctlGetTermios(int(f.Fd()), ioctlGetTermios)
+	return err == nil
+}
+
+// openRawTerminal opens the controlling terminal and switches it to
+// raw mode, so keys are read as they are typed and not echoed.
+// restore switches it back.
+func openRawTerminal() (tty *os.File, restore func(), err error) {
+	tty, err = os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	fd := int(tty.Fd())
+	state, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		tty.Close()
+		return nil, nil, err
+	}
+	raw := *state
+	raw.Iflag &^= unix.ICRNL | unix.IXON
+	raw.Lflag &^= unix.ECHO | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &raw); err != nil {
+		tty.Close()
+		return nil, nil, err
+	}
+	return tty, func() { unix.IoctlSetTermios(fd, ioctlSetTermios, state) }, nil
+}
+
+// terminalSize returns the number of rows and columns of tty
+func terminalSize(tty *os.File) (rows, cols int, err error) {
+	size, err := unix.IoctlGetWinsize(int(tty.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(size.Row), int(size.Col), nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/internal/version"
+	"github.com/ozeidan/gosearch/pkg/client"
+)
+
+// printVersion prints the versions of the client and the server
+// and warns if they differ
+func printVersion() int {
+	clientInfo := version.Get()
+	fmt.Printf("client: %s, protocol %d\n", clientInfo, request.ProtocolVersion)
+
+	responses, err := client.SearchRequest("", client.Version)
+	if err == client.ErrUnsupported {
+		fmt.Println("server: unknown, it predates the version request")
+		return 1
+	} else if err != nil {
+		return printError(err)
+	}
+
+	line, ok := <-responses
+	for range responses {
+	}
+	var server request.VersionResponse
+	if ok {
+		err = json.Unmarshal([]byte(line), &server)
+	}
+	if !ok || err != nil {
+		fmt.Fprintln(os.Stderr, "gosearch: the server sent no version")
+		return 1
+	}
+
+	fmt.Printf("server: %s, protocol %d\n", server.Info, server.Protocol)
+	if server.Version != clientInfo.Version || server.Commit != clientInfo.Commit {
+		fmt.Fprintln(os.Stderr, "gosearch: warning: the client and the server "+
+			"are different builds, restart the server after updating")
+	}
+	return 0
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/database"
+)
+
+// estimate prints the projected size of the index of root and of the
+// entries directly below it, without building the index
+func estimate(root string) int {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gosearch:", err)
+		return 1
+	}
+	total, entries, err := database.EstimateIndex(root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gosearch:", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "files\tdirectories\tname bytes\tmemory\t\tpath")
+	for _, e := range append(entries, total) {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%s\t\t%s\n",
+			e.Files, e.Directories, e.NameBytes, formatBytes(e.Bytes), e.Path)
+	}
+	w.Flush()
+
+	if config.SnapshotQueries() {
+		fmt.Printf("\nsnapshot_queries keeps two copies of the index: %s\n",
+			formatBytes(2*total.Bytes))
+	}
+	return 0
+}
+
+// formatBytes formats n in MiB, or GiB if it's larger
+func formatBytes(n uint64) string {
+	if n >= 1<<30 {
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	}
+	return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+}
@@ -1,20 +1,55 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"os"
 	"os/signal"
 
 	"github.com/ozeidan/gosearch/internal/config"
 	"github.com/ozeidan/gosearch/internal/database"
-	"github.com/ozeidan/gosearch/internal/fanotify"
+	"github.com/ozeidan/gosearch/internal/grpcapi"
+	"github.com/ozeidan/gosearch/internal/health"
+	"github.com/ozeidan/gosearch/internal/httpapi"
+	"github.com/ozeidan/gosearch/internal/metrics"
+	"github.com/ozeidan/gosearch/internal/mounts"
+	"github.com/ozeidan/gosearch/internal/notify"
+	"github.com/ozeidan/gosearch/internal/pidfile"
+	"github.com/ozeidan/gosearch/internal/privileges"
+	"github.com/ozeidan/gosearch/internal/profiling"
 	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/internal/version"
+	"github.com/ozeidan/gosearch/internal/watch"
 )
 
 func main() {
+	logLevel := flag.String("log-level", "",
+		"minimal level of logged messages: debug, info, warn or error, "+
+			"overrides log_level of the config file")
+	estimateFlag := flag.Bool("estimate", false,
+		"walk the filesystem, or the directory given as argument, applying the filters "+
+			"and print how much memory the index would take, without starting the server")
+	flag.Usage = usage
+	flag.Parse()
+
 	err := config.ParseConfig()
 	if err != nil {
-		log.Println("failed to initialize configuration", err)
+		log.Fatalln("invalid configuration:", err)
+	}
+	if *logLevel != "" {
+		if err := config.SetLogLevel(*logLevel); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if *estimateFlag {
+		root := "/"
+		if flag.NArg() > 0 {
+			root = flag.Arg(0)
+		}
+		os.Exit(estimate(root))
 	}
 
 	err = config.SetupLogging()
@@ -22,16 +57,233 @@ func main() {
 		log.Println(err)
 		return
 	}
+	slog.Info("starting", "version", version.Get().String())
+
+	pid, err := pidfile.Acquire(config.StateDirectory())
+	if e, ok := err.(pidfile.AlreadyRunningError); ok {
+		fmt.Fprintln(os.Stderr, "gosearch:", e)
+		os.Exit(1)
+	} else if err != nil {
+		slog.Error("couldn't acquire pidfile", "err", err)
+		os.Exit(1)
+	}
+	defer pid.Release()
+
+	health.SetMemoryBudget(config.MemoryBudget())
+	request.SetLimits(queryLimits(config.Limits()))
+	if err := request.SetPolicy(queryPolicy(config.Policy())); err != nil {
+		slog.Error("invalid query policy", "err", err)
+		os.Exit(1)
+	}
+	responseBuffer, readerWait := config.Responses()
+	request.SetResponseBuffer(responseBuffer)
+
+	err = mounts.Refresh()
+	if err != nil {
+		slog.Error("failed to read the mount table", "err", err)
+	}
+	go mounts.Watch()
+
+	backend, pollInterval := config.Watcher()
+	watcher, err := watch.Open(watch.Options{
+		Backend:      backend,
+		Roots:        []string{"/"},
+		PollInterval: pollInterval,
+	})
+	if err != nil {
+		slog.Error("couldn't watch the filesystem", "err", err)
+		os.Exit(1)
+	}
+
+	socketPath, socketMode, socketGroup := config.Socket()
+	allowedUsers, allowedGroups, adminGroup := config.Access()
+	socketOptions := request.SocketOptions{
+		Path:          socketPath,
+		Mode:          socketMode,
+		Group:         socketGroup,
+		AllowedUsers:  allowedUsers,
+		AllowedGroups: allowedGroups,
+		AdminGroup:    adminGroup,
+	}
+	listener, err := request.Listen(socketOptions)
+	if err != nil {
+		slog.Error("couldn't listen", "err", err)
+		os.Exit(1)
+	}
+
+	grpcOptions := socketOptions
+	grpcOptions.Path = config.GRPCSocket()
+	var grpcListener net.Listener
+	if grpcOptions.Path != "" {
+		grpcListener, err = request.ListenUnix(grpcOptions)
+		if err != nil {
+			slog.Error("couldn't listen", "socket", grpcOptions.Path, "err", err)
+			os.Exit(1)
+		}
+	}
+
+	// everything needing root is set up now
+	if name := config.RunAsUser(); name != "" {
+		if err := privileges.Drop(name, config.StateDirectory()); err != nil {
+			slog.Error("couldn't drop privileges", "err", err)
+			os.Exit(1)
+		}
+	}
 
-	fileChangeChan := make(chan fanotify.FileChange, 100)
+	fileChangeChan := make(chan watch.FileChange, 100)
 	requestChan := make(chan request.Request)
-	go fanotify.Listen(fileChangeChan)
-	go database.Start(fileChangeChan, requestChan)
-	go request.ListenAndServe(requestChan)
+	go watcher.Watch(fileChangeChan)
+	journalPath, journalMaxSize, journalSync := config.Journal()
+	deletedMaxEntries, deletedMaxAge := config.Deleted()
+	recentMaxEntries, recentWindow := config.Recent()
+	lazyMaxEntries, lazyTimeout, lazyExpiry := config.LazyIndex()
+	db := database.New(database.Options{
+		SnapshotQueries: config.SnapshotQueries(),
+		ReaderWait:      readerWait,
+		MinQueryLength:  config.MinQueryLength(),
+		Priority:        config.IndexPriority(),
+		TagsXattr:       config.TagsXattr(),
+		Journal: database.JournalOptions{
+			Path:         journalPath,
+			MaxSize:      journalMaxSize,
+			SyncInterval: journalSync,
+		},
+		Deleted: database.DeletedOptions{
+			MaxEntries: deletedMaxEntries,
+			MaxAge:     deletedMaxAge,
+		},
+		Recent: database.RecentOptions{
+			MaxEntries: recentMaxEntries,
+			Window:     recentWindow,
+		},
+		Lazy: database.LazyOptions{
+			MaxEntries: lazyMaxEntries,
+			Timeout:    lazyTimeout,
+			Expiry:     lazyExpiry,
+		},
+		DeleteGrace:    config.DeleteGrace(),
+		QueryCacheSize: config.QueryCacheSize(),
+		MemoryBudget:   config.MemoryBudget(),
+		Cold: database.ColdOptions{
+			Paths:     config.ColdPaths(),
+			Directory: config.StateDirectory(),
+		},
+	})
+	go db.Start(fileChangeChan, requestChan)
+	go request.Serve(listener, requestChan, socketOptions)
+	if grpcListener != nil {
+		go grpcapi.Serve(grpcListener, requestChan, grpcOptions)
+	}
+
+	if address, token := config.HTTP(); address != "" {
+		go httpapi.ListenAndServe(requestChan, httpapi.Options{
+			Address: address,
+			Token:   token,
+		})
+	}
+
+	if address := config.MetricsAddress(); address != "" {
+		go metrics.ListenAndServe(address)
+	}
+
+	// the profiles expose internals, so they are only served on request
+	if address := config.PprofAddress(); address != "" {
+		go profiling.ListenAndServe(address)
+	}
+
+	if config.ReadyOnStart() {
+		// the status shows the progress of the initial index
+		sendNotify(notify.Ready)
+	}
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	for range c {
+	signal.Notify(c, handledSignals...)
+	for sig := range c {
+		switch sig {
+		case reopenSignal:
+			if err := config.ReopenLogs(); err != nil {
+				slog.Error("couldn't reopen the log file", "err", err)
+			}
+			reloadLimits()
+			continue
+		case statsSignal:
+			if !db.LogStats() {
+				slog.Info("statistics are about to be logged already")
+			}
+			continue
+		case reconcileSignal:
+			if db.Reconcile() {
+				slog.Info("scheduled a reconciliation of the index")
+			} else {
+				slog.Info("a reconciliation of the index is pending already")
+			}
+			continue
+		}
 		break
 	}
+	slog.Info("shutting down")
+	sendNotify(notify.Stopping)
+}
+
+// usage prints the flags and the signals the server handles
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprint(out, `
+Signals:
+  SIGHUP   reload the query limits of the config file and reopen
+           the log file
+  SIGUSR1  log the memory use, the size of the index and the
+           counters of the watcher
+  SIGUSR2  read every indexed directory again and apply what changed,
+           queries wait for it unless snapshot_queries is set
+  SIGINT, SIGTERM
+           shut down
+`)
+}
+
+// reloadLimits applies the query limits of the config file,
+// the other settings need a restart
+func reloadLimits() {
+	limits, err := config.ReloadLimits()
+	if err != nil {
+		slog.Error("couldn't reload the query limits", "err", err)
+		return
+	}
+	request.SetLimits(queryLimits(limits))
+	slog.Info("reloaded the query limits")
+}
+
+func queryLimits(limits config.QueryLimits) request.Limits {
+	return request.Limits{
+		MaxConcurrent:        limits.MaxConcurrentQueries,
+		MaxConcurrentPerPeer: limits.MaxConcurrentQueriesPerUser,
+		Rate:                 limits.QueriesPerSecondPerUser,
+		Burst:                limits.QueryBurst,
+		QueueSize:            limits.QueryQueueSize,
+	}
+}
+
+// queryPolicy converts the policy of the config and its overrides
+func queryPolicy(defaults config.QueryPolicy,
+	users map[string]config.QueryPolicy) (request.Policy, map[string]request.Policy) {
+	convert := func(p config.QueryPolicy) request.Policy {
+		return request.Policy{
+			DefaultMaxResults:   p.DefaultMaxResults,
+			MaxResults:          p.MaxResults,
+			DenyIncludeFiltered: !p.IncludeFiltered,
+		}
+	}
+	converted := make(map[string]request.Policy, len(users))
+	for user, p := range users {
+		converted[user] = convert(p)
+	}
+	return convert(defaults), converted
+}
+
+func sendNotify(states ...string) {
+	if err := notify.Send(states...); err != nil {
+		slog.Warn("couldn't notify systemd", "err", err)
+	}
 }
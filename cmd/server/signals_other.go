@@ -0,0 +1,19 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// the signals main handles besides the ones stopping the server, there
+// are no user signals, so statistics and reconciliations can't be
+// requested by signal
+var (
+	reopenSignal    os.Signal = syscall.SIGHUP
+	statsSignal     os.Signal
+	reconcileSignal os.Signal
+)
+
+var handledSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, reopenSignal}
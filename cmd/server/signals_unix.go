@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// the signals main handles besides the ones stopping the server
+var (
+	reopenSignal    os.Signal = syscall.SIGHUP
+	statsSignal     os.Signal = syscall.SIGUSR1
+	reconcileSignal os.Signal = syscall.SIGUSR2
+)
+
+var handledSignals = []os.Signal{os.Interrupt, syscall.SIGTERM,
+	reopenSignal, statsSignal, reconcileSignal}
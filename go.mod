@@ -1,9 +1,20 @@
 module github.com/ozeidan/gosearch
 
+go 1.21
+
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/karrick/godirwalk v1.9.0
 	github.com/ozeidan/fuzzy-patricia v3.0.0+incompatible
 	github.com/pkg/errors v0.8.1
-	golang.org/x/sys v0.0.0-20190502175342-a43fa875dd82
+	golang.org/x/sys v0.18.0
+	golang.org/x/text v0.14.0
+	google.golang.org/grpc v1.64.0
+	google.golang.org/protobuf v1.34.2
 	gopkg.in/ozeidan/fuzzy-patricia.v3 v3.0.0
 )
+
+require (
+	golang.org/x/net v0.22.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+)
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// defaultClasses are the file classes known without configuration,
+// by the extensions of their files
+var defaultClasses = map[string][]string{
+	"image": {"png", "jpg", "jpeg", "gif", "bmp", "webp", "tif", "tiff", "svg", "ico",
+		"heic", "heif", "avif", "cr2", "nef", "arw", "dng", "psd", "xcf"},
+	"video": {"mp4", "m4v", "mkv", "webm", "avi", "mov", "wmv", "flv", "mpg", "mpeg",
+		"3gp", "ogv"},
+	"audio": {"mp3", "flac", "ogg", "oga", "opus", "wav", "m4a", "aac", "wma", "aiff",
+		"mid", "midi"},
+	"document": {"pdf", "ps", "doc", "docx", "odt", "rtf", "txt", "md", "tex", "epub",
+		"xls", "xlsx", "ods", "csv", "ppt", "pptx", "odp"},
+	"archive": {"zip", "tar", "gz", "tgz", "bz2", "xz", "zst", "7z", "rar", "iso",
+		"deb", "rpm"},
+	"code": {"go", "c", "h", "cc", "cpp", "hpp", "rs", "py", "js", "ts", "jsx", "tsx",
+		"java", "kt", "rb", "php", "sh", "lua", "swift", "cs", "hs", "scala", "pl"},
+}
+
+// classMIMETypes are the prefixes of the MIME types content sniffing
+// recognizes the files of the default classes by. Classes defined in
+// the config are only recognized by their extensions.
+var classMIMETypes = map[string][]string{
+	"image":    {"image/"},
+	"video":    {"video/"},
+	"audio":    {"audio/", "application/ogg"},
+	"document": {"application/pdf", "application/postscript"},
+	"archive":  {"application/zip", "application/x-gzip", "application/x-rar-compressed"},
+}
+
+// mergeClasses returns the default classes with the extensions of
+// extra added, extensions are lower case without the dot
+func mergeClasses(extra map[string][]string) map[string]map[string]bool {
+	classes := make(map[string]map[string]bool)
+	add := func(class string, extensions []string) {
+		if classes[class] == nil {
+			classes[class] = make(map[string]bool)
+		}
+		for _, ext := range extensions {
+			classes[class][normalizeExtension(ext)] = true
+		}
+	}
+	for class, extensions := range defaultClasses {
+		add(class, extensions)
+	}
+	for class, extensions := range extra {
+		add(class, extensions)
+	}
+	return classes
+}
+
+func normalizeExtension(ext string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+}
+
+// validateClasses checks classes and merges them with the defaults
+func (c *Config) validateClasses() error {
+	for class, extensions := range c.Classes {
+		if class == "" || strings.ToLower(class) != class || strings.ContainsAny(class, " /") {
+			return invalidValue(class,
+				errors.Errorf("invalid class name %q, expected a lower case word", class))
+		}
+		for _, ext := range extensions {
+			if normalizeExtension(ext) == "" || strings.ContainsAny(ext, "/") {
+				return invalidValue(ext,
+					errors.Errorf("invalid extension %q of class %s", ext, class))
+			}
+		}
+	}
+	c.classExtensions = mergeClasses(c.Classes)
+	return nil
+}
+
+// Class returns the extensions of the files of class, lower case
+// without the dot, and the prefixes of the MIME types they are
+// recognized by when sniffing their content. ok is false if the
+// class is unknown.
+func Class(class string) (extensions map[string]bool, mimeTypes []string, ok bool) {
+	extensions, ok = config.classExtensions[class]
+	return extensions, classMIMETypes[class], ok
+}
+
+// Classes returns the names of the known classes, sorted
+func Classes() []string {
+	var names []string
+	for class := range config.classExtensions {
+		names = append(names, class)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,61 +1,273 @@
 package config
 
 import (
-	"encoding/json"
-	"log"
+	"io/ioutil"
+	"log/slog"
 	"os"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/BurntSushi/toml"
+	"github.com/ozeidan/gosearch/internal/mounts"
 	"github.com/pkg/errors"
 )
 
-type serverConfig struct {
-	PrefixFilters     []string `json:"prefix_filters"`
-	SubstringFilters  []string `json:"substring_filters"`
-	RegexFilters      []string `json:"regex_filters"`
-	IgnoreHiddenFiles bool     `json:"ignore_hidden_files"`
-	StdoutLogs        bool     `json:"print_logs"`
-	FileLogs          bool     `json:"file_logs"`
-	HomeOnly          bool     `json:"home_only"`
+// Config holds the configuration of the server, read from
+// /etc/gosearch/config.toml
+type Config struct {
+	PrefixFilters    []string        `json:"prefix_filters" toml:"prefix_filters"`
+	SubstringFilters []string        `json:"substring_filters" toml:"substring_filters"`
+	GlobFilters      []string        `json:"glob_filters" toml:"glob_filters"`
+	FilterRegex      []string        `json:"filter_regex" toml:"filter_regex"`
+	FilterRules      []string        `json:"filter_rules" toml:"filter_rules"`
+	NoDefaultFilters bool            `json:"no_default_filters" toml:"no_default_filters"`
+	ExcludeFSTypes   []string        `json:"exclude_fstypes" toml:"exclude_fstypes"`
+	MaxDepth         int             `json:"max_depth" toml:"max_depth"`
+	DepthOverrides   []DepthOverride `json:"depth_overrides" toml:"depth_overrides"`
+	IndexPriority    []string        `json:"index_priority" toml:"index_priority"`
+	IndexHidden      bool            `json:"index_hidden" toml:"index_hidden"`
+	HiddenAllowlist  []string        `json:"hidden_allowlist" toml:"hidden_allowlist"`
+	// RegexFilters is deprecated, use FilterRegex instead
+	RegexFilters []string `json:"regex_filters,omitempty" toml:"regex_filters,omitempty"`
+	// IgnoreHiddenFiles is deprecated, use IndexHidden instead
+	IgnoreHiddenFiles bool     `json:"ignore_hidden_files" toml:"ignore_hidden_files"`
+	SocketPath        string   `json:"socket_path" toml:"socket_path"`
+	SocketMode        string   `json:"socket_mode" toml:"socket_mode"`
+	SocketGroup       string   `json:"socket_group" toml:"socket_group"`
+	AllowedUsers      []string `json:"allowed_users" toml:"allowed_users"`
+	AllowedGroups     []string `json:"allowed_groups" toml:"allowed_groups"`
+	AdminGroup        string   `json:"admin_group" toml:"admin_group"`
+	GRPCSocket        string   `json:"grpc_socket" toml:"grpc_socket"`
+	HTTPAddress       string   `json:"http_address" toml:"http_address"`
+	HTTPToken         string   `json:"http_token" toml:"http_token"`
+	MetricsAddress    string   `json:"metrics_address" toml:"metrics_address"`
+	PprofAddress      string   `json:"pprof_address" toml:"pprof_address"`
+	HeapProfilePath   string   `json:"heap_profile_path" toml:"heap_profile_path"`
+	MemoryBudgetMB    int      `json:"memory_budget_mb" toml:"memory_budget_mb"`
+	ReadyOnStart      bool     `json:"ready_on_start" toml:"ready_on_start"`
+	StateDirectory    string   `json:"state_directory" toml:"state_directory"`
+	RunAsUser         string   `json:"run_as_user" toml:"run_as_user"`
+	LogLevel          string   `json:"log_level" toml:"log_level"`
+	LogFormat         string   `json:"log_format" toml:"log_format"`
+	SlowQuery         string   `json:"slow_query_threshold" toml:"slow_query_threshold"`
+	StdoutLogs        bool     `json:"print_logs" toml:"print_logs"`
+	FileLogs          bool     `json:"file_logs" toml:"file_logs"`
+	LogFile           string   `json:"log_file" toml:"log_file"`
+	LogMaxSizeMB      int      `json:"log_max_size_mb" toml:"log_max_size_mb"`
+	LogMaxFiles       int      `json:"log_max_files" toml:"log_max_files"`
+	Syslog            bool     `json:"syslog" toml:"syslog"`
+	HomeOnly          bool     `json:"home_only" toml:"home_only"`
+	Watcher           string   `json:"watcher" toml:"watcher"`
+	PollInterval      string   `json:"poll_interval" toml:"poll_interval"`
+	SnapshotQueries   bool     `json:"snapshot_queries" toml:"snapshot_queries"`
+	MinQueryLength    int      `json:"min_query_length" toml:"min_query_length"`
+	Journal           bool     `json:"journal" toml:"journal"`
+	JournalPath       string   `json:"journal_path" toml:"journal_path"`
+	JournalMaxSizeMB  int      `json:"journal_max_size_mb" toml:"journal_max_size_mb"`
+	JournalFsync      string   `json:"journal_fsync" toml:"journal_fsync"`
+	JournalInterval   string   `json:"journal_fsync_interval" toml:"journal_fsync_interval"`
+	// Classes adds extensions to the file classes or defines new ones
+	Classes map[string][]string `json:"classes" toml:"classes"`
+	// TagsXattr is the extended attribute holding the comma separated
+	// tags of a file, they aren't indexed if it is empty
+	TagsXattr string `json:"tags_xattr" toml:"tags_xattr"`
+	// DeletedMaxEntries and DeletedMaxAge bound the recently deleted
+	// entries kept in memory for Deleted requests
+	DeletedMaxEntries int    `json:"deleted_max_entries" toml:"deleted_max_entries"`
+	DeletedMaxAge     string `json:"deleted_max_age" toml:"deleted_max_age"`
+	// DeleteGrace is how long vanished entries stay in the index, an
+	// entry created again within it is kept
+	DeleteGrace string `json:"delete_grace" toml:"delete_grace"`
+	// RecentMaxEntries and RecentWindow bound the recently created
+	// entries kept in memory for Recent requests
+	RecentMaxEntries int    `json:"recent_max_entries" toml:"recent_max_entries"`
+	RecentWindow     string `json:"recent_window" toml:"recent_window"`
+	// LazyIndex walks the roots of queries that aren't indexed, up to
+	// LazyIndexMaxEntries entries for LazyIndexTimeout, the entries are
+	// merged into the index for LazyIndexExpiry if it isn't 0
+	LazyIndex           bool   `json:"lazy_index" toml:"lazy_index"`
+	LazyIndexMaxEntries int    `json:"lazy_index_max_entries" toml:"lazy_index_max_entries"`
+	LazyIndexTimeout    string `json:"lazy_index_timeout" toml:"lazy_index_timeout"`
+	LazyIndexExpiry     string `json:"lazy_index_expiry" toml:"lazy_index_expiry"`
+	// ColdPaths are the directories whose entries are kept on disk
+	// instead of in the index, and only searched if the index has
+	// too few results
+	ColdPaths []string `json:"cold_paths" toml:"cold_paths"`
+	// ResponseBuffer is the number of response lines sent ahead of a
+	// client, SnapshotReaderWait how long changes wait at most for the
+	// queries on the copy of the index published before
+	ResponseBuffer     int    `json:"response_buffer" toml:"response_buffer"`
+	SnapshotReaderWait string `json:"snapshot_reader_wait" toml:"snapshot_reader_wait"`
+	// VerifyExistsLimit is the number of results a query with
+	// verify_exists stats at most
+	VerifyExistsLimit int `json:"verify_exists_limit" toml:"verify_exists_limit"`
+	// QueryCacheSize is the number of searches whose results are
+	// cached until the index changes, 0 disables the cache
+	QueryCacheSize int `json:"query_cache_size" toml:"query_cache_size"`
+	// Policy limits the queries of the clients besides root
+	Policy QueryPolicy `json:"policy" toml:"policy"`
+	QueryLimits
+
+	// the settings below are parsed by validate
+
+	// lazyIndexTimeout and lazyIndexExpiry are the parsed
+	// lazy_index_timeout and lazy_index_expiry
+	lazyIndexTimeout, lazyIndexExpiry time.Duration
+	// journalFsyncInterval is the parsed journal_fsync_interval,
+	// 0 if journal_fsync is none
+	journalFsyncInterval time.Duration
+	// deletedMaxAge is the parsed deleted_max_age, recentWindow the
+	// parsed recent_window and deleteGrace the parsed delete_grace
+	deletedMaxAge time.Duration
+	recentWindow  time.Duration
+	deleteGrace   time.Duration
+	// snapshotReaderWait is the parsed snapshot_reader_wait
+	snapshotReaderWait time.Duration
+	// socketMode is the parsed socket_mode
+	socketMode os.FileMode
+	// classExtensions are the default classes merged with those of
+	// the config
+	classExtensions map[string]map[string]bool
+	// slowQueryThreshold is the parsed slow_query_threshold
+	slowQueryThreshold time.Duration
+	// pollInterval is the parsed poll_interval
+	pollInterval time.Duration
 }
 
 const AppName = "gosearch"
-const configPath = "/etc/gosearch/config" // TODO: XDG_CONFIG_DIRS?
+const configDirectory = "/etc/gosearch" // TODO: XDG_CONFIG_DIRS?
+const configPath = configDirectory + "/config.toml"
+
+// legacyConfigPath is the JSON config file read if there is no
+// TOML config file
+const legacyConfigPath = configDirectory + "/config"
+
+// runtimeConfigPath holds the glob filter changes persisted at runtime,
+// they are applied over the config file, which is left as it was written
+const runtimeConfigPath = configDirectory + "/runtime.toml"
+
+var config = defaultConfig()
 
-var config = serverConfig{
-	[]string{}, []string{}, []string{},
-	false, true, false, false,
+// defaultConfig returns the configuration used for the settings
+// missing from the config file
+func defaultConfig() Config {
+	return Config{
+		PrefixFilters:    []string{},
+		SubstringFilters: []string{},
+		GlobFilters:      []string{},
+		FilterRegex:      []string{},
+		FilterRules:      []string{},
+		ExcludeFSTypes:   []string{},
+		DepthOverrides:   []DepthOverride{},
+		IndexPriority:    []string{"/home", "/root", "/etc"},
+		IndexHidden:      true,
+		HiddenAllowlist:  []string{},
+		SocketMode:       "0777",
+		StateDirectory:   "/var/lib/" + AppName,
+		AllowedUsers:     []string{},
+		AllowedGroups:    []string{},
+		LogLevel:         "info",
+		LogFormat:        "text",
+		SlowQuery:        "1s",
+		LogMaxFiles:      5,
+		Watcher:          "auto",
+		PollInterval:     "1m",
+		MinQueryLength:   2,
+		JournalMaxSizeMB: 64,
+		JournalFsync:     "none",
+		JournalInterval:  "1s",
+		StdoutLogs:       true,
+		// a day of deletions, a few MB at most
+		DeletedMaxEntries: 10000,
+		DeletedMaxAge:     "24h",
+		// editors replace a file within a second
+		DeleteGrace: "2s",
+		// a busy build creates more than deletions, still a few MB
+		RecentMaxEntries: 50000,
+		RecentWindow:     "24h",
+		// walking a few seconds keeps queries interactive
+		LazyIndexMaxEntries: 100000,
+		LazyIndexTimeout:    "5s",
+		LazyIndexExpiry:     "0",
+		// a slow client holds up changes for a second at most
+		ResponseBuffer:     256,
+		SnapshotReaderWait: "1s",
+		// a few milliseconds on a local disk
+		VerifyExistsLimit: 1000,
+		// the completions of a shell session, a few MB at most
+		QueryCacheSize:  64,
+		Policy:          QueryPolicy{IncludeFiltered: true},
+		socketMode:      os.ModePerm,
+		classExtensions: mergeClasses(nil),
+	}
+}
+
+// filterSet holds the compiled filters. The paths are checked against
+// the published one without locking, so it is never changed, changing
+// the filters publishes a new one.
+type filterSet struct {
+	rules           []filterRule
+	globs           *globSet
+	hiddenAllowlist []globPattern
+	regexes         []*regexp.Regexp
 }
 
-var regexFilters []*regexp.Regexp
+// filters is the published filterSet, nil if there are no filters
+var filters atomic.Pointer[filterSet]
+
+// currentFilters returns the published filterSet
+func currentFilters() *filterSet {
+	if f := filters.Load(); f != nil {
+		return f
+	}
+	return &filterSet{}
+}
 
 // ParseConfig initializes the configuration of the program
 // by reading and parsing the config file
 func ParseConfig() error {
-	file, err := os.Open(configPath)
+	path, content, err := readConfigFile()
 
 	if os.IsNotExist(err) {
 		err = createConfigStub()
 		if err != nil {
 			return err
 		}
-		return nil
+		// the defaults need parsing as well
+		err = validateConfig()
 	} else if err != nil {
 		return err
+	} else {
+		if path == legacyConfigPath {
+			slog.Warn("deprecated: reading JSON config, move your settings to "+
+				configPath, "path", legacyConfigPath)
+		}
+		err = decodeConfig(path, content)
 	}
-
-	err = json.NewDecoder(file).Decode(&config)
 	if err != nil {
 		return err
 	}
 
-	parseFilters()
-	return nil
+	return applyRuntimeConfig(runtimeConfigPath)
+}
+
+// readConfigFile reads the TOML config, or the legacy JSON config
+// if the former doesn't exist
+func readConfigFile() (string, []byte, error) {
+	content, err := ioutil.ReadFile(configPath)
+	if !os.IsNotExist(err) {
+		return configPath, content, err
+	}
+
+	content, err = ioutil.ReadFile(legacyConfigPath)
+	return legacyConfigPath, content, err
 }
 
 func createConfigStub() error {
-	err := os.Mkdir("/etc/gosearch", os.ModePerm)
+	err := os.Mkdir(configDirectory, os.ModePerm)
 	if err != nil && !os.IsExist(err) {
 		return errors.Wrap(err, "can't create config directory")
 	}
@@ -63,63 +275,359 @@ func createConfigStub() error {
 	if err != nil {
 		return errors.Wrap(err, "can't create config file")
 	}
+	defer f.Close()
+
+	return toml.NewEncoder(f).Encode(&config)
+}
 
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "    ")
+// filterLock serializes the changes of the filters and guards the glob
+// filters of the configuration, which can be changed at runtime
+var filterLock sync.Mutex
 
-	err = enc.Encode(&config)
+// parseFilters compiles the filters of the configuration and
+// publishes them
+func parseFilters() error {
+	f, err := config.compileFilters()
 	if err != nil {
 		return err
 	}
-
+	publishFilters(f)
 	return nil
 }
 
-func parseFilters() {
-	for _, filterString := range config.RegexFilters {
+// publishFilters makes the paths be checked against f
+func publishFilters(f *filterSet) {
+	filterLock.Lock()
+	filters.Store(f)
+	filterLock.Unlock()
+}
+
+// compileFilters compiles the filters of c
+func (c *Config) compileFilters() (*filterSet, error) {
+	var rules []filterRule
+	for _, ruleString := range c.FilterRules {
+		rule, err := parseFilterRule(ruleString)
+		if err != nil {
+			return nil, invalidValue(ruleString, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	globs, err := compileGlobs(c.effectiveGlobFilters())
+	if err != nil {
+		return nil, err
+	}
+
+	allowlist, err := compileGlobs(c.HiddenAllowlist)
+	if err != nil {
+		return nil, err
+	}
+
+	var regexes []*regexp.Regexp
+	for _, filterString := range c.regexPatterns() {
 		r, err := regexp.Compile(filterString)
 		if err != nil {
-			log.Println("failed to parse regex filter:", err)
+			return nil, invalidValue(filterString,
+				errors.Wrapf(err, "invalid regex filter %q", filterString))
+		}
+		regexes = append(regexes, r)
+	}
+
+	return &filterSet{rules: rules, globs: newGlobSet(globs),
+		hiddenAllowlist: allowlist, regexes: regexes}, nil
+}
+
+// regexPatterns returns the regex filters, including
+// the ones set with the deprecated key
+func (c *Config) regexPatterns() []string {
+	if len(c.RegexFilters) == 0 {
+		return c.FilterRegex
+	}
+	patterns := make([]string, 0, len(c.FilterRegex)+len(c.RegexFilters))
+	patterns = append(patterns, c.FilterRegex...)
+	return append(patterns, c.RegexFilters...)
+}
+
+func compileGlobs(patterns []string) ([]globPattern, error) {
+	var globs []globPattern
+	for _, pattern := range patterns {
+		g, err := compileGlob(pattern)
+		if err != nil {
+			return nil, invalidValue(pattern, err)
+		}
+		globs = append(globs, g)
+	}
+	return globs, nil
+}
+
+func (c *Config) effectiveGlobFilters() []string {
+	if c.NoDefaultFilters {
+		return c.GlobFilters
+	}
+	filters := make([]string, 0, len(c.GlobFilters)+len(defaultGlobFilters))
+	filters = append(filters, c.GlobFilters...)
+	return append(filters, defaultGlobFilters...)
+}
+
+// Filter describes a single entry of the effective filter list
+type Filter struct {
+	// Class is the kind of filter, e.g. "prefix" or "glob"
+	Class string
+	// Pattern is the filter as written in the configuration
+	Pattern string
+	// Default is set for the compiled-in default filters
+	Default bool
+}
+
+// EffectiveFilters returns all filters in the order they are evaluated,
+// including the default filters
+func EffectiveFilters() []Filter {
+	filterLock.Lock()
+	defer filterLock.Unlock()
+
+	var effective []Filter
+	add := func(class string, patterns []string, isDefault bool) {
+		for _, pattern := range patterns {
+			effective = append(effective, Filter{class, pattern, isDefault})
+		}
+	}
+
+	add("rule", config.FilterRules, false)
+	if config.HomeOnly {
+		add("home_only", []string{"/home"}, false)
+	}
+	add("prefix", config.PrefixFilters, false)
+	add("substring", config.SubstringFilters, false)
+	add("glob", config.GlobFilters, false)
+	if !config.NoDefaultFilters {
+		add("glob", defaultGlobFilters, true)
+	}
+	add("regex", config.regexPatterns(), false)
+	if !indexHidden() {
+		add("hidden", []string{".*"}, false)
+		add("hidden_allowlist", config.HiddenAllowlist, false)
+	}
+	add("fstype", config.ExcludeFSTypes, false)
+
+	return effective
+}
+
+// HasFSTypeFilters returns whether any filesystem types are excluded
+func HasFSTypeFilters() bool {
+	return len(config.ExcludeFSTypes) > 0
+}
+
+// IsFSTypeFiltered returns whether filesystems of the given type
+// are excluded from the index
+func IsFSTypeFiltered(fsType string) bool {
+	for _, excluded := range config.ExcludeFSTypes {
+		if fsType == excluded {
+			atomic.AddUint64(&filterCounts[fsTypeFilter], 1)
+			return true
+		}
+	}
+	return false
+}
+
+// IsOnFilteredFS returns whether path resides on a filesystem
+// whose type is excluded by the configuration
+func IsOnFilteredFS(path string) bool {
+	if !HasFSTypeFilters() {
+		return false
+	}
+
+	fsType, err := mounts.FSTypeOf(path)
+	if err != nil {
+		slog.Warn("couldn't determine filesystem type", "path", path, "err", err)
+		return false
+	}
+
+	return IsFSTypeFiltered(fsType)
+}
+
+// ReadyOnStart returns whether systemd is told the server is ready
+// before the initial index completes
+func ReadyOnStart() bool {
+	return config.ReadyOnStart
+}
+
+// SnapshotQueries returns whether queries run on a copy of the index
+// while changes are applied to another one
+func SnapshotQueries() bool {
+	return config.SnapshotQueries
+}
+
+// MinQueryLength returns the number of characters substring and fuzzy
+// queries need unless they are unsorted and limited
+func MinQueryLength() int {
+	return config.MinQueryLength
+}
+
+// MemoryBudget returns the heap size in bytes above which the server
+// reports itself as degraded, 0 means unlimited
+func MemoryBudget() uint64 {
+	return uint64(config.MemoryBudgetMB) << 20
+}
+
+// StateDirectory returns the directory the server keeps its state in
+func StateDirectory() string {
+	return config.StateDirectory
+}
+
+// TagsXattr returns the extended attribute the tags of the indexed
+// entries are read from, empty if tags aren't indexed
+func TagsXattr() string {
+	return config.TagsXattr
+}
+
+// RunAsUser returns the user the server switches to after setting up
+// fanotify and its sockets, empty if it keeps running as root
+func RunAsUser() string {
+	return config.RunAsUser
+}
+
+func indexHidden() bool {
+	return config.IndexHidden && !config.IgnoreHiddenFiles
+}
+
+// hasHiddenComponent returns whether any component of path
+// starts with a dot
+func hasHiddenComponent(path string) bool {
+	for i := 0; i < len(path)-1; i++ {
+		if path[i] == '/' && path[i+1] == '.' {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *filterSet) isHiddenAllowed(path string) bool {
+	for _, g := range f.hiddenAllowlist {
+		if g.matches(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *filterSet) isHiddenAllowedBelow(path string) bool {
+	for _, g := range f.hiddenAllowlist {
+		if g.mayMatchBelow(path) {
+			return true
 		}
-		regexFilters = append(regexFilters, r)
 	}
+	return false
+}
+
+type filterClass int
+
+const (
+	ruleFilter filterClass = iota
+	homeOnlyFilter
+	prefixFilter
+	substringFilter
+	globFilter
+	regexFilter
+	hiddenFilter
+	fsTypeFilter
+	ignoreFileFilter
+	filterClassCount
+)
+
+var filterClassNames = [filterClassCount]string{
+	"rules", "home_only", "prefix", "substring",
+	"glob", "regex", "hidden", "fstype", "ignore_file",
+}
+
+var filterCounts [filterClassCount]uint64
+
+// ResetFilterCounts resets the counters of paths rejected by each
+// filter class
+func ResetFilterCounts() {
+	for i := range filterCounts {
+		atomic.StoreUint64(&filterCounts[i], 0)
+	}
+}
+
+// FilterCounts returns how many paths each filter class rejected
+// since the last call to ResetFilterCounts
+func FilterCounts() map[string]uint64 {
+	counts := make(map[string]uint64, filterClassCount)
+	for i, name := range filterClassNames {
+		counts[name] = atomic.LoadUint64(&filterCounts[i])
+	}
+	return counts
 }
 
 // IsPathFiltered determines returns whether the given path is filtered
-// by the user's configuration
+// by the user's configuration. Traversed directories are not filtered,
+// use FilterPath to tell them apart from included paths.
 func IsPathFiltered(path string) bool {
+	return FilterPath(path) == Excluded
+}
+
+// FilterPath evaluates the filter rules first, the first matching rule
+// decides. Paths not matched by any rule are checked against the
+// remaining filters.
+func FilterPath(path string) FilterDecision {
+	f := currentFilters()
+	if decision, matched := f.evaluateRules(path); matched {
+		if decision == Excluded {
+			atomic.AddUint64(&filterCounts[ruleFilter], 1)
+		}
+		return decision
+	}
+
+	class, filtered := f.match(path)
+	if filtered {
+		// hidden directories leading to allowlisted paths are walked
+		if class == hiddenFilter && f.isHiddenAllowedBelow(path) {
+			return Traversed
+		}
+		atomic.AddUint64(&filterCounts[class], 1)
+		return Excluded
+	}
+	return Included
+}
+
+// match returns the first filter class rejecting the path.
+// The cheap filters are checked first, regexes come last.
+func (f *filterSet) match(path string) (filterClass, bool) {
 	if config.HomeOnly &&
 		!strings.HasPrefix(path, "/home") &&
 		path != "/" {
-		return true
+		return homeOnlyFilter, true
 	}
 
-	for _, prefixFilter := range config.PrefixFilters {
-		if strings.HasPrefix(path, prefixFilter) {
-			return true
+	for _, prefix := range config.PrefixFilters {
+		if strings.HasPrefix(path, prefix) {
+			return prefixFilter, true
 		}
 	}
 
-	for _, substringFilter := range config.SubstringFilters {
-		if strings.Contains(path, substringFilter) {
-			return true
+	for _, substring := range config.SubstringFilters {
+		if strings.Contains(path, substring) {
+			return substringFilter, true
 		}
 	}
 
-	for _, r := range regexFilters {
+	if f.globs.matches(path) {
+		return globFilter, true
+	}
+
+	for _, r := range f.regexes {
 		if r.MatchString(path) {
-			return true
+			return regexFilter, true
 		}
 	}
 
-	if config.IgnoreHiddenFiles {
-		parts := strings.Split(path, "/")
-		for _, part := range parts {
-			if len(part) > 0 && part[0] == '.' {
-				return true
-			}
-		}
+	if !indexHidden() && hasHiddenComponent(path) && !f.isHiddenAllowed(path) {
+		return hiddenFilter, true
 	}
 
-	return false
+	if isPathIgnored(path) {
+		return ignoreFileFilter, true
+	}
+
+	return 0, false
 }
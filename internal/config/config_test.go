@@ -0,0 +1,81 @@
+package config
+
+import "testing"
+
+func TestParseFilters_InvalidRegex(t *testing.T) {
+	config.FilterRegex = []string{"^build-[0-9a-f]{8}$", "[unclosed"}
+	defer func() {
+		config.FilterRegex = []string{}
+		filters.Store(nil)
+	}()
+
+	err := parseFilters()
+	if err == nil {
+		t.Fatal("parseFilters() error = nil, want error for invalid regex")
+	}
+}
+
+func TestIsPathFiltered_Counts(t *testing.T) {
+	config.PrefixFilters = []string{"/proc"}
+	config.FilterRegex = []string{"/build-[0-9a-f]{8}$"}
+	defer func() {
+		config.PrefixFilters = []string{}
+		config.FilterRegex = []string{}
+		filters.Store(nil)
+	}()
+	if err := parseFilters(); err != nil {
+		t.Fatal(err)
+	}
+
+	ResetFilterCounts()
+	paths := []string{
+		"/proc/1/status",
+		"/proc/self",
+		"/home/user/build-0123abcd",
+		"/home/user/build-xyz",
+	}
+	for _, path := range paths {
+		IsPathFiltered(path)
+	}
+
+	counts := FilterCounts()
+	if counts["prefix"] != 2 {
+		t.Errorf("prefix rejections = %d, want 2", counts["prefix"])
+	}
+	if counts["regex"] != 1 {
+		t.Errorf("regex rejections = %d, want 1", counts["regex"])
+	}
+}
+
+func TestFilterPath_Hidden(t *testing.T) {
+	config.IndexHidden = false
+	config.HiddenAllowlist = []string{"/home/*/.config", "/home/*/.local/share/fonts"}
+	defer func() {
+		config.IndexHidden = true
+		config.HiddenAllowlist = []string{}
+		filters.Store(nil)
+	}()
+	if err := parseFilters(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want FilterDecision
+	}{
+		{"/home/me/notes.txt", Included},
+		{"/home/me/.bashrc", Excluded},
+		{"/home/me/code/.git", Excluded},
+		{"/home/me/.config", Included},
+		{"/home/me/.config/nvim/init.vim", Included},
+		{"/home/me/.local", Traversed},
+		{"/home/me/.local/share", Traversed},
+		{"/home/me/.local/share/fonts/mono.ttf", Included},
+		{"/home/me/.local/share/applications", Excluded},
+	}
+	for _, tt := range tests {
+		if got := FilterPath(tt.path); got != tt.want {
+			t.Errorf("FilterPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
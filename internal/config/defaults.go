@@ -0,0 +1,30 @@
+package config
+
+// DefaultFiltersVersion is increased whenever the set of
+// default filters changes
+const DefaultFiltersVersion = 2
+
+// defaultGlobFilters are merged with the user's glob filters unless
+// no_default_filters is set. They are written as globs so they apply
+// regardless of user names and where filesystems are mounted.
+var defaultGlobFilters = []string{
+	// pseudo and runtime filesystems
+	"/proc",
+	"/sys",
+	"/dev",
+	"/run",
+	// caches and object stores
+	".cache",
+	".git/objects",
+	"Service Worker/CacheStorage",
+	".mozilla/firefox/*/storage",
+	// container images and game libraries
+	"/var/lib/docker/overlay2",
+	"/var/lib/containers/storage/overlay",
+	"steamapps",
+	// trash directories of the homes and the mounts, searched
+	// with the Trash action
+	".local/share/Trash",
+	".Trash",
+	".Trash-*",
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDefaultFilters(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/proc/1", true},
+		{"/sys/class/net", true},
+		{"/home/u/.cache/x", true},
+		{"/home/u/code/.git/objects/ab", true},
+		{"/home/u/.config/chromium/Default/Service Worker/CacheStorage/a", true},
+		{"/home/u/.mozilla/firefox/ab.default/storage/default", true},
+		{"/var/lib/docker/overlay2/l", true},
+		{"/home/u/.local/share/Steam/steamapps/common", true},
+		{"/home/u/.local/share/Trash/files/a.txt", true},
+		{"/mnt/usb/.Trash-1000/files/a.txt", true},
+		{"/home/u/code/.git/config", false},
+		{"/home/u/process", false},
+		{"/var/lib/docker/volumes", false},
+	}
+	for _, noDefaults := range []bool{false, true} {
+		t.Run(fmt.Sprintf("no_default_filters=%v", noDefaults), func(t *testing.T) {
+			saved := config
+			defer func() {
+				config = saved
+				filters.Store(nil)
+			}()
+			content := fmt.Sprintf("no_default_filters = %v\n", noDefaults)
+			if err := decodeConfig("config.toml", []byte(content)); err != nil {
+				t.Fatalf("decodeConfig() error = %v", err)
+			}
+
+			for _, tt := range tests {
+				// nothing is filtered without the defaults
+				want := tt.want && !noDefaults
+				if got := IsPathFiltered(tt.path); got != want {
+					t.Errorf("IsPathFiltered(%q) = %v, want %v", tt.path, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEffectiveFilters_Defaults(t *testing.T) {
+	saved := config
+	defer func() {
+		config = saved
+		filters.Store(nil)
+	}()
+	content := `prefix_filters = ["/mnt/backup"]
+glob_filters = ["node_modules"]
+filter_regex = ["/build-[0-9a-f]{8}$"]
+`
+	if err := decodeConfig("config.toml", []byte(content)); err != nil {
+		t.Fatalf("decodeConfig() error = %v", err)
+	}
+
+	// the defaults come after the user's globs, before the regexes
+	want := []Filter{
+		{"prefix", "/mnt/backup", false},
+		{"glob", "node_modules", false},
+	}
+	for _, pattern := range defaultGlobFilters {
+		want = append(want, Filter{"glob", pattern, true})
+	}
+	want = append(want, Filter{"regex", "/build-[0-9a-f]{8}$", false})
+	if got := EffectiveFilters(); !reflect.DeepEqual(got, want) {
+		t.Errorf("EffectiveFilters() = %v, want %v", got, want)
+	}
+
+	config.NoDefaultFilters = true
+	want = append(want[:2], want[len(want)-1])
+	if got := EffectiveFilters(); !reflect.DeepEqual(got, want) {
+		t.Errorf("with no_default_filters EffectiveFilters() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DepthOverride limits the index depth below a single directory
+type DepthOverride struct {
+	Path     string `json:"path" toml:"path"`
+	MaxDepth int    `json:"max_depth" toml:"max_depth"`
+}
+
+// validateDepthLimits checks max_depth, depth_overrides and
+// index_priority, which shape the walk of the index
+func (c *Config) validateDepthLimits() error {
+	if c.MaxDepth < 0 {
+		return invalidValue("max_depth",
+			errors.Errorf("invalid max_depth %d", c.MaxDepth))
+	}
+
+	for _, override := range c.DepthOverrides {
+		if !strings.HasPrefix(override.Path, "/") {
+			return invalidValue(override.Path, errors.Errorf(
+				"depth override path %q is not absolute", override.Path))
+		}
+		if override.MaxDepth < 0 {
+			return invalidValue(override.Path, errors.Errorf(
+				"invalid max_depth %d for %s", override.MaxDepth, override.Path))
+		}
+	}
+
+	for i, path := range c.IndexPriority {
+		if !strings.HasPrefix(path, "/") {
+			return invalidValue(path, errors.Errorf(
+				"index_priority path %q is not absolute", path))
+		}
+		c.IndexPriority[i] = filepath.Clean(path)
+	}
+
+	return nil
+}
+
+// validateLazyIndex checks the bounds of the walks of roots that
+// aren't indexed
+func (c *Config) validateLazyIndex() error {
+	if c.LazyIndexMaxEntries < 0 {
+		return invalidValue("lazy_index_max_entries",
+			errors.Errorf("invalid lazy_index_max_entries %d", c.LazyIndexMaxEntries))
+	}
+	timeout, err := time.ParseDuration(c.LazyIndexTimeout)
+	if err != nil || timeout <= 0 {
+		return invalidValue(c.LazyIndexTimeout,
+			errors.Errorf("invalid lazy_index_timeout %q, expected a duration like \"5s\"",
+				c.LazyIndexTimeout))
+	}
+	expiry, err := time.ParseDuration(c.LazyIndexExpiry)
+	if err != nil || expiry < 0 {
+		return invalidValue(c.LazyIndexExpiry,
+			errors.Errorf("invalid lazy_index_expiry %q, expected a duration like \"10m\"",
+				c.LazyIndexExpiry))
+	}
+	c.lazyIndexTimeout, c.lazyIndexExpiry = timeout, expiry
+	return nil
+}
+
+// LazyIndex returns how many entries below the root of a query that
+// isn't indexed are walked, 0 if none are, for how long at most, and
+// for how long they are merged into the index, 0 if they aren't
+func LazyIndex() (maxEntries int, timeout, expiry time.Duration) {
+	if !config.LazyIndex {
+		return 0, 0, 0
+	}
+	return config.LazyIndexMaxEntries, config.lazyIndexTimeout, config.lazyIndexExpiry
+}
+
+// validateColdPaths checks cold_paths, the paths below others
+// are dropped, their entries are in the cold tier anyway
+func (c *Config) validateColdPaths() error {
+	paths := make([]string, 0, len(c.ColdPaths))
+	for _, path := range c.ColdPaths {
+		if !strings.HasPrefix(path, "/") {
+			return invalidValue(path, errors.Errorf(
+				"cold_paths path %q is not absolute", path))
+		}
+		path = filepath.Clean(path)
+		if path == "/" {
+			return invalidValue(path, errors.New("cold_paths can't hold the root directory"))
+		}
+		paths = append(paths, path)
+	}
+	// paths sort before those below them
+	sort.Strings(paths)
+	c.ColdPaths = c.ColdPaths[:0]
+next:
+	for _, path := range paths {
+		for _, kept := range c.ColdPaths {
+			if path == kept || strings.HasPrefix(path, kept+"/") {
+				continue next
+			}
+		}
+		c.ColdPaths = append(c.ColdPaths, path)
+	}
+	return nil
+}
+
+// ColdPaths returns the directories whose entries are kept in
+// the cold tier
+func ColdPaths() []string {
+	return config.ColdPaths
+}
+
+// IndexPriority returns the directories the initial index walks
+// before everything else, in order
+func IndexPriority() []string {
+	return config.IndexPriority
+}
+
+// RemainingDepth returns how many more levels below path may be
+// indexed. A directory with a remaining depth of 0 is indexed itself,
+// but its contents are not. limited is false if no limit applies,
+// a max_depth of 0 means unlimited.
+func RemainingDepth(path string) (remaining int, limited bool) {
+	// root is stored without its trailing slash, so the root
+	// directory of the filesystem is the empty string
+	root := ""
+	maxDepth := config.MaxDepth
+
+	// the most specific override wins
+	matched := false
+	for _, override := range config.DepthOverrides {
+		overridePath := strings.TrimSuffix(override.Path, "/")
+		if path != overridePath &&
+			!strings.HasPrefix(path, overridePath+"/") {
+			continue
+		}
+		if !matched || len(overridePath) > len(root) {
+			root = overridePath
+			maxDepth = override.MaxDepth
+			matched = true
+		}
+	}
+
+	if maxDepth == 0 {
+		return 0, false
+	}
+
+	depth := strings.Count(path[len(root):], "/")
+	return maxDepth - depth, true
+}
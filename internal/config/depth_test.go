@@ -0,0 +1,59 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRemainingDepth(t *testing.T) {
+	config.MaxDepth = 4
+	config.DepthOverrides = []DepthOverride{
+		{Path: "/home/me/mail", MaxDepth: 1},
+		{Path: "/home/me/mail/archive", MaxDepth: 0},
+		{Path: "/srv/", MaxDepth: 2},
+	}
+	defer func() {
+		config.MaxDepth = 0
+		config.DepthOverrides = []DepthOverride{}
+	}()
+
+	tests := []struct {
+		name          string
+		path          string
+		wantRemaining int
+		wantLimited   bool
+	}{
+		{"global", "/home/me", 2, true},
+		{"global_at_limit", "/usr/lib/python3/site-packages", 0, true},
+		{"global_beyond_limit", "/usr/lib/python3/site-packages/numpy", -1, true},
+		{"override_root", "/home/me/mail", 1, true},
+		{"override_at_limit", "/home/me/mail/inbox", 0, true},
+		{"override_beyond_limit", "/home/me/mail/inbox/cur", -1, true},
+		{"override_similar_name", "/home/me/mailbox/a", 0, true},
+		{"nested_override_unlimited", "/home/me/mail/archive/2019/cur/x", 0, false},
+		{"trailing_slash", "/srv/www/site", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remaining, limited := RemainingDepth(tt.path)
+			if remaining != tt.wantRemaining || limited != tt.wantLimited {
+				t.Errorf("RemainingDepth(%q) = %d, %v, want %d, %v", tt.path,
+					remaining, limited, tt.wantRemaining, tt.wantLimited)
+			}
+		})
+	}
+}
+
+func TestValidateColdPaths(t *testing.T) {
+	saved := config.ColdPaths
+	defer func() { config.ColdPaths = saved }()
+
+	config.ColdPaths = []string{"/srv/mirror/debian", "/home/me/archive/", "/srv/mirror", "/srv/mirror-old"}
+	if err := config.validateColdPaths(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/home/me/archive", "/srv/mirror", "/srv/mirror-old"}
+	if !reflect.DeepEqual(ColdPaths(), want) {
+		t.Errorf("ColdPaths() = %q, want %q", ColdPaths(), want)
+	}
+}
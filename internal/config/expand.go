@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// expandPath expands a leading ~ or ~user and environment variables
+// ($VAR or ${VAR}) in path. ~ resolves to the home directory of the
+// user the server runs as, which is /root for the system service.
+// Referencing an unset variable or an unknown user is an error.
+func expandPath(path string) (string, error) {
+	var missing []string
+	path = os.Expand(path, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", errors.Errorf("environment variable %s is not set", missing[0])
+	}
+
+	if !strings.HasPrefix(path, "~") {
+		return path, nil
+	}
+
+	name, rest := path[1:], ""
+	if idx := strings.IndexByte(name, '/'); idx != -1 {
+		name, rest = name[:idx], name[idx:]
+	}
+
+	home, err := homeDirectory(name)
+	if err != nil {
+		return "", err
+	}
+	return home + rest, nil
+}
+
+func homeDirectory(name string) (string, error) {
+	if name == "" {
+		if home := os.Getenv("HOME"); home != "" {
+			return home, nil
+		}
+		u, err := user.Current()
+		if err != nil {
+			return "", errors.Wrap(err, "can't determine home directory")
+		}
+		return u.HomeDir, nil
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", errors.Errorf("unknown user %q", name)
+	}
+	return u.HomeDir, nil
+}
+
+func expandPaths(paths []string) error {
+	for i, path := range paths {
+		expanded, err := expandPath(path)
+		if err != nil {
+			return invalidValue(path, err)
+		}
+		paths[i] = expanded
+	}
+	return nil
+}
+
+// expandConfigPaths expands all path-like settings in place.
+// Substring and regex filters are taken literally.
+func (c *Config) expandConfigPaths() error {
+	for _, paths := range [][]string{
+		c.PrefixFilters,
+		c.GlobFilters,
+		c.HiddenAllowlist,
+		c.IndexPriority,
+	} {
+		if err := expandPaths(paths); err != nil {
+			return err
+		}
+	}
+
+	for i, rule := range c.FilterRules {
+		if len(rule) < 3 {
+			// reported by parseFilterRule
+			continue
+		}
+		pattern, err := expandPath(strings.TrimSpace(rule[2:]))
+		if err != nil {
+			return invalidValue(rule, err)
+		}
+		c.FilterRules[i] = rule[:2] + pattern
+	}
+
+	for i, override := range c.DepthOverrides {
+		path, err := expandPath(override.Path)
+		if err != nil {
+			return invalidValue(override.Path, err)
+		}
+		c.DepthOverrides[i].Path = path
+	}
+
+	return nil
+}
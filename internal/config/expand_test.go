@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"os/user"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", "/home/me")
+	os.Setenv("GOSEARCH_TEST_DIR", "projects")
+	os.Unsetenv("GOSEARCH_TEST_UNSET")
+	defer os.Unsetenv("GOSEARCH_TEST_DIR")
+
+	root, err := user.Lookup("root")
+	if err != nil {
+		t.Skip("no root user:", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"literal", "/etc/nginx", "/etc/nginx", false},
+		{"tilde", "~/.cache", "/home/me/.cache", false},
+		{"tilde_only", "~", "/home/me", false},
+		{"tilde_user", "~root/.cache", root.HomeDir + "/.cache", false},
+		{"variable", "$HOME/$GOSEARCH_TEST_DIR", "/home/me/projects", false},
+		{"braced_variable", "${HOME}/${GOSEARCH_TEST_DIR}/*/target", "/home/me/projects/*/target", false},
+		{"tilde_in_middle", "/srv/~backup", "/srv/~backup", false},
+		{"unset_variable", "$GOSEARCH_TEST_UNSET/x", "", true},
+		{"unknown_user", "~gosearch-no-such-user/x", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("expandPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
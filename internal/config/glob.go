@@ -0,0 +1,294 @@
+package config
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type segmentKind uint8
+
+const (
+	// literalSegment matches a path component exactly
+	literalSegment segmentKind = iota
+	// wildcardSegment matches a single path component using path.Match
+	wildcardSegment
+	// doubleStarSegment matches zero or more path components
+	doubleStarSegment
+)
+
+type globSegment struct {
+	kind segmentKind
+	text string
+	// literal is the longest literal run of a wildcard segment,
+	// every component it matches contains it
+	literal string
+}
+
+func (s globSegment) match(part string) bool {
+	if s.kind == literalSegment {
+		return s.text == part
+	}
+	if !strings.Contains(part, s.literal) {
+		return false
+	}
+	// the pattern has been validated when it was compiled,
+	// so path.Match can't return an error here
+	ok, _ := path.Match(s.text, part)
+	return ok
+}
+
+// globPattern is a compiled glob filter. Patterns starting with a slash
+// are anchored at the root of the filesystem, all other patterns may
+// match at any depth. A pattern matches a path if it matches the path
+// itself or one of its parent directories.
+type globPattern struct {
+	anchored bool
+	segments []globSegment
+	// hint is a literal that has to be contained in every matching path,
+	// used to reject most paths with a single substring search
+	hint string
+}
+
+func compileGlob(pattern string) (globPattern, error) {
+	g := globPattern{anchored: strings.HasPrefix(pattern, "/")}
+
+	for _, part := range strings.Split(pattern, "/") {
+		if part == "" {
+			continue
+		}
+
+		switch {
+		case part == "**":
+			// consecutive double stars are redundant
+			if n := len(g.segments); n > 0 &&
+				g.segments[n-1].kind == doubleStarSegment {
+				continue
+			}
+			g.segments = append(g.segments, globSegment{kind: doubleStarSegment, text: part})
+		case strings.ContainsAny(part, `*?[\`):
+			if _, err := path.Match(part, ""); err != nil {
+				return globPattern{}, errors.Wrapf(err,
+					"invalid glob filter %q", pattern)
+			}
+			literal := longestLiteral(part)
+			g.segments = append(g.segments, globSegment{wildcardSegment, part, literal})
+			if len(literal) > len(g.hint) {
+				g.hint = literal
+			}
+		default:
+			g.segments = append(g.segments, globSegment{kind: literalSegment, text: part})
+			if len(part) > len(g.hint) {
+				g.hint = part
+			}
+		}
+	}
+
+	// an unanchored pattern matches at any depth anyway
+	if !g.anchored && len(g.segments) > 0 &&
+		g.segments[0].kind == doubleStarSegment {
+		g.segments = g.segments[1:]
+	}
+
+	if len(g.segments) == 0 {
+		return globPattern{}, errors.Errorf("empty glob filter %q", pattern)
+	}
+
+	return g, nil
+}
+
+// longestLiteral returns the longest run of part that path.Match
+// matches literally, which is empty if there is none
+func longestLiteral(part string) string {
+	var longest string
+	start := 0
+	for i := 0; i < len(part); i++ {
+		end := i
+		switch part[i] {
+		case '*', '?':
+		case '\\':
+			// the escaped character ends the run, it is skipped
+			i++
+		case '[':
+			// so is a character class, a ] right after its start
+			// or ^ is one of its characters
+			i++
+			if i < len(part) && part[i] == '^' {
+				i++
+			}
+			for first := true; i < len(part) && (first || part[i] != ']'); i++ {
+				if part[i] == '\\' {
+					i++
+				}
+				first = false
+			}
+		default:
+			continue
+		}
+		if end-start > len(longest) {
+			longest = part[start:end]
+		}
+		start = i + 1
+	}
+	if len(part)-start > len(longest) {
+		longest = part[start:]
+	}
+	return longest
+}
+
+func (g globPattern) matches(p string) bool {
+	if len(p) < 2 || p[0] != '/' {
+		return false
+	}
+
+	if g.hint != "" && !strings.Contains(p, g.hint) {
+		return false
+	}
+
+	rest := p[1:]
+	if g.anchored {
+		return matchSegments(g.segments, rest)
+	}
+
+	for {
+		if matchSegments(g.segments, rest) {
+			return true
+		}
+		idx := strings.IndexByte(rest, '/')
+		if idx == -1 {
+			return false
+		}
+		rest = rest[idx+1:]
+	}
+}
+
+// matchSegments reports whether segments match the leading components
+// of rest, which is a slash-separated path without a leading slash
+func matchSegments(segments []globSegment, rest string) bool {
+	if len(segments) == 0 {
+		return true
+	}
+	if rest == "" {
+		return false
+	}
+
+	idx := strings.IndexByte(rest, '/')
+	part, tail := rest, ""
+	if idx != -1 {
+		part, tail = rest[:idx], rest[idx+1:]
+	}
+
+	if segments[0].kind == doubleStarSegment {
+		if matchSegments(segments[1:], rest) {
+			return true
+		}
+		return matchSegments(segments, tail)
+	}
+
+	if !segments[0].match(part) {
+		return false
+	}
+
+	return matchSegments(segments[1:], tail)
+}
+
+// mayMatchBelow reports whether the pattern could match a descendant
+// of p. Unanchored patterns and double stars can match at any depth,
+// so they are treated conservatively.
+func (g globPattern) mayMatchBelow(p string) bool {
+	if !g.anchored {
+		return true
+	}
+
+	rest := strings.TrimPrefix(p, "/")
+	for _, segment := range g.segments {
+		if segment.kind == doubleStarSegment || rest == "" {
+			return true
+		}
+
+		idx := strings.IndexByte(rest, '/')
+		part := rest
+		if idx == -1 {
+			rest = ""
+		} else {
+			part, rest = rest[:idx], rest[idx+1:]
+		}
+
+		if !segment.match(part) {
+			return false
+		}
+	}
+
+	// the whole pattern matched p or one of its parents
+	return false
+}
+
+// globSet matches paths against a list of glob patterns at once.
+// Patterns ending in a literal, like most filters do, are looked up
+// by the components of the path, only the others are matched one
+// after another.
+type globSet struct {
+	// byLast holds the patterns ending in a literal by that literal
+	byLast map[string][]globPattern
+	// lengths has bit n set if a literal in byLast is n bytes long,
+	// or bit 63 if it is longer, so most components aren't looked up
+	lengths uint64
+	rest    []globPattern
+}
+
+func newGlobSet(globs []globPattern) *globSet {
+	s := &globSet{byLast: make(map[string][]globPattern)}
+	for _, g := range globs {
+		last := g.segments[len(g.segments)-1]
+		if last.kind != literalSegment {
+			s.rest = append(s.rest, g)
+			continue
+		}
+		s.byLast[last.text] = append(s.byLast[last.text], g)
+		s.lengths |= lengthBit(len(last.text))
+	}
+	return s
+}
+
+func lengthBit(n int) uint64 {
+	if n > 63 {
+		n = 63
+	}
+	return 1 << uint(n)
+}
+
+// matches reports whether any pattern of the set matches p. A pattern
+// ending in a literal can only match if a component of p is that
+// literal, as it matches p or one of its parents.
+func (s *globSet) matches(p string) bool {
+	if s == nil || len(p) < 2 || p[0] != '/' {
+		return false
+	}
+
+	if s.lengths != 0 {
+		for rest := p[1:]; rest != ""; {
+			part := rest
+			if idx := strings.IndexByte(rest, '/'); idx != -1 {
+				part, rest = rest[:idx], rest[idx+1:]
+			} else {
+				rest = ""
+			}
+			if s.lengths&lengthBit(len(part)) == 0 {
+				continue
+			}
+			for _, g := range s.byLast[part] {
+				if g.matches(p) {
+					return true
+				}
+			}
+		}
+	}
+
+	for _, g := range s.rest {
+		if g.matches(p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package config
+
+import "testing"
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		wantErr bool
+	}{
+		{"literal", "/home/user/.cache", false},
+		{"wildcard", "*/node_modules", false},
+		{"double_star", "**/__pycache__", false},
+		{"bad_pattern", "/home/[user", true},
+		{"empty", "/", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileGlob(tt.pattern); (err != nil) != tt.wantErr {
+				t.Errorf("compileGlob() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGlobPattern_Matches(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"unanchored_literal", "node_modules", "/home/user/project/node_modules", true},
+		{"unanchored_descendant", "node_modules", "/home/user/project/node_modules/pkg/index.js", true},
+		{"unanchored_partial_name", "node_modules", "/home/user/node_modules_backup", false},
+		{"wildcard_parent", "*/node_modules", "/srv/node_modules", true},
+		{"wildcard_parent_root", "*/node_modules", "/node_modules", false},
+		{"anchored_wildcard", "/home/*/.cache", "/home/user/.cache/thumbnails", true},
+		{"anchored_wrong_depth", "/home/*/.cache", "/home/user/sub/.cache", false},
+		{"anchored_not_at_root", "/home/*/.cache", "/mnt/home/user/.cache", false},
+		{"double_star_any_depth", "**/__pycache__", "/usr/lib/python3/site/__pycache__/x.pyc", true},
+		{"double_star_middle", "/home/**/target", "/home/user/code/rust/target", true},
+		{"double_star_zero", "/home/**/target", "/home/target", true},
+		{"double_star_trailing", "/var/lib/**", "/var/lib/docker", true},
+		{"double_star_trailing_self", "/var/lib/**", "/var/lib", false},
+		{"segment_wildcard", "*.swp", "/home/user/.file.swp", true},
+		{"character_class", "/tmp/build-[0-9]", "/tmp/build-7/out", true},
+		{"root", "node_modules", "/", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := compileGlob(tt.pattern)
+			if err != nil {
+				t.Fatalf("compileGlob() error = %v", err)
+			}
+			if got := g.matches(tt.path); got != tt.want {
+				t.Errorf("globPattern.matches(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLongestLiteral(t *testing.T) {
+	tests := []struct {
+		part string
+		want string
+	}{
+		{".Trash-*", ".Trash-"},
+		{"*.iso", ".iso"},
+		{"build-[0-9a-f]*", "build-"},
+		{"a\\*bc", "bc"},
+		{"[]a]x", "x"},
+		{"[^]]yz*", "yz"},
+		{"*?", ""},
+	}
+	for _, tt := range tests {
+		if got := longestLiteral(tt.part); got != tt.want {
+			t.Errorf("longestLiteral(%q) = %q, want %q", tt.part, got, tt.want)
+		}
+	}
+}
+
+func TestGlobSet_Matches(t *testing.T) {
+	patterns := append([]string{"*/node_modules", "/home/*/.cache", "**/__pycache__",
+		"*.swp", "/var/lib/**", "/tmp/build-[0-9]"}, defaultGlobFilters...)
+	globs, err := compileGlobs(patterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := newGlobSet(globs)
+	if len(set.rest) != 4 {
+		t.Errorf("%d patterns are matched one by one, want 4", len(set.rest))
+	}
+
+	paths := append([]string{"/", "/proc", "/proc/1/status", "/home/proc",
+		"/home/u/.cache/x", "/home/u/code/.git/objects/ab", "/home/u/.git/objectsx",
+		"/srv/node_modules", "/node_modules", "/home/u/.mozilla/firefox/ab.default/storage/x",
+		"/home/u/.mozilla/firefox/storage", "/mnt/usb/.Trash-1000/files/a",
+		"/mnt/usb/.Trash/a", "/home/u/.local/share/Trash", "/home/u/notes.swp",
+		"/var/lib/docker", "/var/lib", "/tmp/build-7/out", "/tmp/build-x",
+		"/home/u/.config/google-chrome/Default/Service Worker/CacheStorage/a",
+		"/home/u/steam/steamapps/common", "/home/u/documents/report.txt"}, benchmarkPaths...)
+	for _, path := range paths {
+		want := false
+		for _, g := range globs {
+			want = want || g.matches(path)
+		}
+		if got := set.matches(path); got != want {
+			t.Errorf("globSet.matches(%q) = %v, the patterns one by one %v", path, got, want)
+		}
+	}
+}
+
+var benchmarkPaths = []string{
+	"/home/user/Documents/projects/gosearch/internal/config/config.go",
+	"/usr/lib/python3.7/site-packages/numpy/core/__init__.py",
+	"/home/user/code/web/node_modules/react/index.js",
+	"/var/lib/pacman/local/linux-5.1.arch1-1/files",
+	"/home/user/.cache/mozilla/firefox/cache2/entries/0A1B2C3D",
+}
+
+func BenchmarkGlobPattern_Matches(b *testing.B) {
+	patterns := []string{"*/node_modules", "/home/*/.cache", "**/__pycache__"}
+	for _, pattern := range patterns {
+		g, err := compileGlob(pattern)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(pattern, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				g.matches(benchmarkPaths[i%len(benchmarkPaths)])
+			}
+		})
+	}
+}
+
+func BenchmarkIsPathFiltered(b *testing.B) {
+	saved := config
+	defer func() {
+		config = saved
+		filters.Store(nil)
+		setIgnoreFiles(b, nil)
+	}()
+	config.GlobFilters = []string{"*/node_modules", "/home/*/.cache", "**/__pycache__"}
+	config.FilterRules = []string{"- /home/*/Downloads/incomplete"}
+	if err := parseFilters(); err != nil {
+		b.Fatal(err)
+	}
+	// the paths are checked against the filters of a server
+	// with the defaults, a rule and a few ignore files
+	defaults := 0
+	for _, filter := range EffectiveFilters() {
+		if filter.Default {
+			defaults++
+		}
+	}
+	if defaults != len(defaultGlobFilters) {
+		b.Fatalf("%d default filters are effective, want %d", defaults, len(defaultGlobFilters))
+	}
+	setIgnoreFiles(b, map[string]string{
+		"/home/user":          "*.iso\n",
+		"/home/user/code/web": "dist\n!dist/keep\n",
+		"/var/lib":            "pacman/sync\n",
+	})
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		IsPathFiltered(benchmarkPaths[i%len(benchmarkPaths)])
+	}
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"hash/maphash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// IgnoreFileName is the name of the per-directory ignore files
+const IgnoreFileName = ".gosearchignore"
+
+// ignoreRule is a single line of an ignore file. Patterns are glob
+// patterns relative to the directory containing the ignore file,
+// a leading "!" re-includes paths excluded by an earlier rule.
+type ignoreRule struct {
+	negate  bool
+	pattern globPattern
+}
+
+type ignoreFile struct {
+	content []byte
+	rules   []ignoreRule
+}
+
+// ignoreFiles maps directories to their parsed ignore files.
+// The ignore files of a path's ancestors form a stack: rules of inner
+// files take precedence over outer ones and later rules in a file
+// take precedence over earlier ones.
+var ignoreFiles = struct {
+	sync.RWMutex
+	dirs map[string]ignoreFile
+	// loaded is the number of dirs and version changes with them,
+	// they are read without locking
+	loaded  atomic.Int64
+	version atomic.Uint64
+}{dirs: map[string]ignoreFile{}}
+
+// ignoreScope holds the ignore files applying to the entries of dir,
+// those of its ancestors and its own, the innermost first
+type ignoreScope struct {
+	dir     string
+	version uint64
+	files   []scopedIgnoreFile
+}
+
+// scopedIgnoreFile holds the rules of an ignore file, their patterns
+// are matched against the paths without the first prefix bytes
+type scopedIgnoreFile struct {
+	prefix int
+	rules  []ignoreRule
+}
+
+// ignoreScopes caches the scopes of the directories whose entries were
+// checked lately, by the hash of the directory. Walks check the entries
+// of a directory one after another, so the ignore files are looked up
+// once for all of them.
+var ignoreScopes [256]atomic.Pointer[ignoreScope]
+
+var ignoreScopeSeed = maphash.MakeSeed()
+
+// ignoreFilesChanged publishes a change of the ignore files,
+// ignoreFiles has to be locked
+func ignoreFilesChanged() {
+	ignoreFiles.loaded.Store(int64(len(ignoreFiles.dirs)))
+	ignoreFiles.version.Add(1)
+}
+
+func parseIgnoreFile(content []byte) ([]ignoreRule, error) {
+	var rules []ignoreRule
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		negate := strings.HasPrefix(line, "!")
+		pattern, err := compileGlob(strings.TrimPrefix(line, "!"))
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, ignoreRule{negate, pattern})
+	}
+
+	return rules, scanner.Err()
+}
+
+// LoadIgnoreFile reads the ignore file in dir, if there is one.
+// It returns whether the rules for dir changed since the last call.
+func LoadIgnoreFile(dir string) (bool, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, IgnoreFileName))
+	if os.IsNotExist(err) {
+		return UnloadIgnoreFiles(dir, false), nil
+	} else if err != nil {
+		return false, err
+	}
+
+	ignoreFiles.RLock()
+	old, ok := ignoreFiles.dirs[dir]
+	ignoreFiles.RUnlock()
+	if ok && bytes.Equal(old.content, content) {
+		return false, nil
+	}
+
+	rules, err := parseIgnoreFile(content)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid ignore file in %s", dir)
+	}
+
+	ignoreFiles.Lock()
+	ignoreFiles.dirs[dir] = ignoreFile{content, rules}
+	ignoreFilesChanged()
+	ignoreFiles.Unlock()
+	return true, nil
+}
+
+// UnloadIgnoreFiles forgets the ignore file of dir, and if recursive
+// is set, the ignore files of all its subdirectories.
+// It returns whether any ignore file was forgotten.
+func UnloadIgnoreFiles(dir string, recursive bool) bool {
+	if ignoreFiles.loaded.Load() == 0 {
+		return false
+	}
+	ignoreFiles.Lock()
+	defer ignoreFiles.Unlock()
+
+	_, removed := ignoreFiles.dirs[dir]
+	delete(ignoreFiles.dirs, dir)
+
+	if recursive {
+		for d := range ignoreFiles.dirs {
+			if strings.HasPrefix(d, dir+"/") {
+				delete(ignoreFiles.dirs, d)
+				removed = true
+			}
+		}
+	}
+
+	if removed {
+		ignoreFilesChanged()
+	}
+	return removed
+}
+
+// isPathIgnored evaluates the ignore files of all ancestors of path,
+// starting with the innermost one
+func isPathIgnored(path string) bool {
+	if ignoreFiles.loaded.Load() == 0 {
+		return false
+	}
+	idx := strings.LastIndexByte(path, '/')
+	if idx == -1 {
+		return false
+	}
+
+	dir := path[:idx]
+	slot := &ignoreScopes[maphash.String(ignoreScopeSeed, dir)%uint64(len(ignoreScopes))]
+	scope := slot.Load()
+	if scope == nil || scope.dir != dir || scope.version != ignoreFiles.version.Load() {
+		scope = newIgnoreScope(dir)
+		slot.Store(scope)
+	}
+
+	for _, file := range scope.files {
+		relative := path[file.prefix:]
+		for i := len(file.rules) - 1; i >= 0; i-- {
+			if file.rules[i].pattern.matches(relative) {
+				return !file.rules[i].negate
+			}
+		}
+	}
+
+	return false
+}
+
+// newIgnoreScope looks up the ignore files of dir and its ancestors,
+// dir is empty for the entries of the root
+func newIgnoreScope(dir string) *ignoreScope {
+	ignoreFiles.RLock()
+	defer ignoreFiles.RUnlock()
+
+	scope := &ignoreScope{dir: dir, version: ignoreFiles.version.Load()}
+	for d := dir; ; {
+		key := d
+		if key == "" {
+			key = "/"
+		}
+		if file, ok := ignoreFiles.dirs[key]; ok {
+			scope.files = append(scope.files, scopedIgnoreFile{len(d), file.rules})
+		}
+
+		idx := strings.LastIndexByte(d, '/')
+		if idx == -1 {
+			break
+		}
+		d = d[:idx]
+	}
+	return scope
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setIgnoreFiles(t testing.TB, files map[string]string) {
+	t.Helper()
+	ignoreFiles.Lock()
+	defer ignoreFiles.Unlock()
+	ignoreFiles.dirs = map[string]ignoreFile{}
+	for dir, content := range files {
+		rules, err := parseIgnoreFile([]byte(content))
+		if err != nil {
+			t.Fatalf("parseIgnoreFile() error = %v", err)
+		}
+		ignoreFiles.dirs[dir] = ignoreFile{[]byte(content), rules}
+	}
+	ignoreFilesChanged()
+}
+
+func TestIsPathIgnored(t *testing.T) {
+	files := map[string]string{
+		"/":                    "# comments and blank lines are skipped\n\n*.iso\n",
+		"/home/me/project":     "build\n/vendor\n!build/keep\n",
+		"/home/me/project/web": "!build\nnode_modules\n",
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"root_rule", "/srv/images/debian.iso", true},
+		{"unignored", "/home/me/project/main.go", false},
+		{"unanchored_any_depth", "/home/me/project/cmd/build/out", true},
+		{"anchored_direct_child", "/home/me/project/vendor/lib.go", true},
+		{"anchored_deeper", "/home/me/project/cmd/vendor/lib.go", false},
+		{"later_rule_wins", "/home/me/project/build/keep/notes", false},
+		{"child_adds_rules", "/home/me/project/web/node_modules/react", true},
+		{"child_negates_parent", "/home/me/project/web/build/bundle.js", false},
+		{"parent_rules_apply_to_child", "/home/me/project/web/vendor.iso", true},
+		{"outside_of_project", "/home/me/build", false},
+	}
+
+	setIgnoreFiles(t, files)
+	defer setIgnoreFiles(t, nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPathIgnored(tt.path); got != tt.want {
+				t.Errorf("isPathIgnored(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadIgnoreFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer setIgnoreFiles(t, nil)
+
+	ignorePath := filepath.Join(dir, IgnoreFileName)
+	steps := []struct {
+		name        string
+		content     string
+		remove      bool
+		wantChanged bool
+		// the scopes of the entries are cached, they
+		// change with the ignore file nevertheless
+		wantIgnored bool
+	}{
+		{"no_file", "", true, false, false},
+		{"created", "dist\n", false, true, true},
+		{"unchanged", "dist\n", false, false, true},
+		{"modified", "build\n", false, true, false},
+		{"modified_again", "build\ndist\n", false, true, true},
+		{"removed", "", true, true, false},
+	}
+	for _, step := range steps {
+		if step.remove {
+			os.Remove(ignorePath)
+		} else if err := ioutil.WriteFile(ignorePath, []byte(step.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		changed, err := LoadIgnoreFile(dir)
+		if err != nil {
+			t.Fatalf("%s: LoadIgnoreFile() error = %v", step.name, err)
+		}
+		if changed != step.wantChanged {
+			t.Errorf("%s: LoadIgnoreFile() = %v, want %v", step.name, changed, step.wantChanged)
+		}
+		if got := isPathIgnored(filepath.Join(dir, "dist")); got != step.wantIgnored {
+			t.Errorf("%s: isPathIgnored() = %v, want %v", step.name, got, step.wantIgnored)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// validateJournal checks the journal options
+func (c *Config) validateJournal() error {
+	path, err := expandPath(c.JournalPath)
+	if err != nil {
+		return invalidValue(c.JournalPath, err)
+	}
+	c.JournalPath = path
+
+	if c.JournalMaxSizeMB < 0 {
+		return invalidValue("journal_max_size_mb",
+			errors.Errorf("invalid journal_max_size_mb %d", c.JournalMaxSizeMB))
+	}
+
+	switch c.JournalFsync {
+	case "none":
+		c.journalFsyncInterval = 0
+	case "interval":
+		interval, err := time.ParseDuration(c.JournalInterval)
+		if err != nil || interval <= 0 {
+			return invalidValue(c.JournalInterval,
+				errors.Errorf("invalid journal_fsync_interval %q, expected a duration like \"1s\"",
+					c.JournalInterval))
+		}
+		c.journalFsyncInterval = interval
+	default:
+		return invalidValue(c.JournalFsync,
+			errors.Errorf("invalid journal_fsync %q, expected none or interval",
+				c.JournalFsync))
+	}
+	return nil
+}
+
+// Journal returns where the changes applied to the index are
+// recorded, empty if they aren't, the size in bytes the journal is
+// rotated at, 0 if never, and how often it is synced to disk, 0 if
+// that is left to the kernel
+func Journal() (path string, maxSize int64, fsyncInterval time.Duration) {
+	if !config.Journal {
+		return "", 0, 0
+	}
+	path = config.JournalPath
+	if path == "" {
+		path = filepath.Join(config.StateDirectory, "journal")
+	}
+	return path, int64(config.JournalMaxSizeMB) << 20, config.journalFsyncInterval
+}
+
+// validateDeleted checks the limits of the recently deleted entries
+// and the grace period of deletions
+func (c *Config) validateDeleted() error {
+	if c.DeletedMaxEntries < 0 {
+		return invalidValue("deleted_max_entries",
+			errors.Errorf("invalid deleted_max_entries %d", c.DeletedMaxEntries))
+	}
+	maxAge, err := time.ParseDuration(c.DeletedMaxAge)
+	if err != nil || maxAge < 0 {
+		return invalidValue(c.DeletedMaxAge,
+			errors.Errorf("invalid deleted_max_age %q, expected a duration like \"24h\"",
+				c.DeletedMaxAge))
+	}
+	grace, err := time.ParseDuration(c.DeleteGrace)
+	if err != nil || grace < 0 || grace > time.Minute {
+		return invalidValue(c.DeleteGrace,
+			errors.Errorf("invalid delete_grace %q, expected a duration of at most a minute like \"2s\"",
+				c.DeleteGrace))
+	}
+	c.deletedMaxAge, c.deleteGrace = maxAge, grace
+	return nil
+}
+
+// Deleted returns how many recently deleted entries are kept, 0 if
+// none are, and for how long, 0 if until they are replaced
+func Deleted() (maxEntries int, maxAge time.Duration) {
+	return config.DeletedMaxEntries, config.deletedMaxAge
+}
+
+// DeleteGrace returns how long vanished entries stay in the index
+// before they are removed, 0 if they are removed at once
+func DeleteGrace() time.Duration {
+	return config.deleteGrace
+}
+
+// validateRecent checks the limits of the recently created entries,
+// they are kept by the minute
+func (c *Config) validateRecent() error {
+	if c.RecentMaxEntries < 0 {
+		return invalidValue("recent_max_entries",
+			errors.Errorf("invalid recent_max_entries %d", c.RecentMaxEntries))
+	}
+	window, err := time.ParseDuration(c.RecentWindow)
+	if err != nil || window < time.Minute {
+		return invalidValue(c.RecentWindow,
+			errors.Errorf("invalid recent_window %q, expected a duration of at least a minute like \"24h\"",
+				c.RecentWindow))
+	}
+	c.recentWindow = window
+	return nil
+}
+
+// Recent returns how many recently created entries are kept, 0 if
+// none are, and for how long
+func Recent() (maxEntries int, window time.Duration) {
+	return config.RecentMaxEntries, config.recentWindow
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// QueryLimits restrict the queries of the clients, 0 means unlimited
+type QueryLimits struct {
+	MaxConcurrentQueries        int     `json:"max_concurrent_queries" toml:"max_concurrent_queries"`
+	MaxConcurrentQueriesPerUser int     `json:"max_concurrent_queries_per_user" toml:"max_concurrent_queries_per_user"`
+	QueriesPerSecondPerUser     float64 `json:"queries_per_second_per_user" toml:"queries_per_second_per_user"`
+	QueryBurst                  int     `json:"query_burst" toml:"query_burst"`
+	QueryQueueSize              int     `json:"query_queue_size" toml:"query_queue_size"`
+}
+
+// limitsLock guards the query limits, which are reloaded at runtime
+var limitsLock sync.Mutex
+
+// validate checks that no limit is negative
+func (l QueryLimits) validate() error {
+	limits := []struct {
+		key   string
+		value float64
+	}{
+		{"max_concurrent_queries", float64(l.MaxConcurrentQueries)},
+		{"max_concurrent_queries_per_user", float64(l.MaxConcurrentQueriesPerUser)},
+		{"queries_per_second_per_user", l.QueriesPerSecondPerUser},
+		{"query_burst", float64(l.QueryBurst)},
+		{"query_queue_size", float64(l.QueryQueueSize)},
+	}
+	for _, limit := range limits {
+		if limit.value < 0 {
+			return invalidValue(limit.key,
+				errors.Errorf("invalid %s %v", limit.key, limit.value))
+		}
+	}
+	return nil
+}
+
+// Limits returns the configured query limits
+func Limits() QueryLimits {
+	limitsLock.Lock()
+	defer limitsLock.Unlock()
+	return config.QueryLimits
+}
+
+// ReloadLimits reads the query limits from the config file again,
+// the other settings keep their values. The limits are left
+// unchanged if the file is invalid.
+func ReloadLimits() (QueryLimits, error) {
+	path, content, err := readConfigFile()
+	if err != nil {
+		return QueryLimits{}, err
+	}
+	return reloadLimits(path, content)
+}
+
+func reloadLimits(path string, content []byte) (QueryLimits, error) {
+	// the whole file is decoded and validated into the defaults like
+	// at the start, so a reload fails like a restart would
+	reloaded := defaultConfig()
+	if _, err := reloaded.decode(path, content); err != nil {
+		// the limits are reported by their key
+		if parseErr, ok := err.(*ParseError); ok && parseErr.Line == 0 {
+			if valueErr, ok := parseErr.Err.(*invalidValueError); ok {
+				parseErr.Line = lineOfSubstring(content, valueErr.value)
+			}
+		}
+		return QueryLimits{}, err
+	}
+
+	limitsLock.Lock()
+	defer limitsLock.Unlock()
+	config.QueryLimits = reloaded.QueryLimits
+	return reloaded.QueryLimits, nil
+}
@@ -0,0 +1,113 @@
+package config
+
+import "testing"
+
+func TestReloadLimits(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config.MaxDepth = 3
+	config.QueryLimits = QueryLimits{MaxConcurrentQueries: 8}
+
+	tests := []struct {
+		name     string
+		path     string
+		content  string
+		want     QueryLimits
+		wantLine int
+		wantErr  bool
+	}{
+		{
+			"toml",
+			"config.toml",
+			"max_depth = 5\nglob_filters = [\"/reloaded\"]\nqueries_per_second_per_user = 2.5\nquery_burst = 10\n",
+			QueryLimits{QueriesPerSecondPerUser: 2.5, QueryBurst: 10},
+			0,
+			false,
+		},
+		{
+			"json",
+			"config",
+			`{"max_concurrent_queries_per_user": 2, "query_queue_size": 16}`,
+			QueryLimits{MaxConcurrentQueriesPerUser: 2, QueryQueueSize: 16},
+			0,
+			false,
+		},
+		{
+			"negative",
+			"config.toml",
+			"home_only = true\nquery_queue_size = -1\n",
+			QueryLimits{},
+			2,
+			true,
+		},
+		{
+			"syntax_error",
+			"config.toml",
+			"query_burst = = 3\n",
+			QueryLimits{},
+			1,
+			true,
+		},
+		{
+			"unknown_key",
+			"config.toml",
+			"query_burst = 3\nquery_bust = 3\n",
+			QueryLimits{},
+			2,
+			true,
+		},
+		{
+			"unknown_key_json",
+			"config",
+			"{\n\"query_burst\": 3,\n\"query_bust\": 3\n}",
+			QueryLimits{},
+			3,
+			true,
+		},
+		{
+			"invalid_setting",
+			"config.toml",
+			"query_burst = 3\nwatcher = \"inotifywait\"\n",
+			QueryLimits{},
+			2,
+			true,
+		},
+		{
+			"unset_variable",
+			"config.toml",
+			"query_burst = 3\nglob_filters = [\"$GOSEARCH_UNSET/cache\"]\n",
+			QueryLimits{},
+			2,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := Limits()
+			got, err := reloadLimits(tt.path, []byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reloadLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if line := err.(*ParseError).Line; line != tt.wantLine {
+					t.Errorf("reloadLimits() error line = %d, want %d", line, tt.wantLine)
+				}
+				if Limits() != before {
+					t.Errorf("invalid reload changed the limits to %+v", Limits())
+				}
+				return
+			}
+
+			if got != tt.want || Limits() != tt.want {
+				t.Errorf("reloadLimits() = %+v, Limits() = %+v, want %+v",
+					got, Limits(), tt.want)
+			}
+			if config.MaxDepth != 3 {
+				t.Errorf("reload changed max_depth to %d", config.MaxDepth)
+			}
+			if IsPathFiltered("/reloaded/x") {
+				t.Error("reload changed the filters")
+			}
+		})
+	}
+}
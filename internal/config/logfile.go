@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// logFile is a log file that is rotated once it reaches maxSize,
+// keeping maxFiles rotated files as path.1 (the newest) to path.N
+type logFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func openLogFile(path string, maxSize int64, maxFiles int) (*logFile, error) {
+	f := &logFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *logFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "couldn't open logfile")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrap(err, "couldn't open logfile")
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Write appends p to the file, rotating it first if p doesn't fit
+func (f *logFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			fmt.Fprintln(os.Stderr, "gosearch: couldn't rotate logfile:", err)
+		}
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the rotated files by one, dropping the oldest,
+// and starts a new file, f.mu has to be held
+func (f *logFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+
+	for i := f.maxFiles - 1; i > 0; i-- {
+		err := os.Rename(f.rotatedPath(i), f.rotatedPath(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if f.maxFiles > 0 {
+		if err := os.Rename(f.path, f.rotatedPath(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+func (f *logFile) rotatedPath(i int) string {
+	return fmt.Sprintf("%s.%d", f.path, i)
+}
+
+// reopen closes the file and opens the file at its path again,
+// which may have been moved away by logrotate
+func (f *logFile) reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	return f.open()
+}
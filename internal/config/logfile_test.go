@@ -0,0 +1,85 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLogFile_Rotate(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxSize  int64
+		maxFiles int
+		writes   int
+		// want are the contents of the file and the rotated ones
+		want []string
+	}{
+		{"unlimited", 0, 2, 4, []string{"0123"}},
+		{"below_limit", 4, 2, 4, []string{"0123"}},
+		{"rotated", 2, 2, 5, []string{"4", "23", "01"}},
+		{"oldest_dropped", 2, 1, 6, []string{"45", "23"}},
+		{"nothing_kept", 2, 0, 5, []string{"4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "log")
+			f, err := openLogFile(path, tt.maxSize, tt.maxFiles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.file.Close()
+			for i := 0; i < tt.writes; i++ {
+				if _, err := f.Write([]byte{byte('0' + i)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var got []string
+			for _, p := range append([]string{path}, f.rotatedPath(1),
+				f.rotatedPath(2), f.rotatedPath(3)) {
+				content, err := os.ReadFile(p)
+				if os.IsNotExist(err) {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, string(content))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogFile_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+	f, err := openLogFile(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.file.Close()
+
+	f.Write([]byte("before\n"))
+	// what logrotate does
+	if err := os.Rename(path, path+"-old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("after\n"))
+
+	for p, want := range map[string]string{path + "-old": "before\n", path: "after\n"} {
+		content, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(p), content, want)
+		}
+	}
+}
@@ -1,22 +1,90 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
+// logLevels are the values of log_level
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// validateLogging checks log_level, log_format, slow_query_threshold
+// and the log file options
+func (c *Config) validateLogging() error {
+	if _, ok := logLevels[c.LogLevel]; !ok {
+		return invalidValue(c.LogLevel,
+			errors.Errorf("invalid log_level %q, expected debug, info, warn or error",
+				c.LogLevel))
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		return invalidValue(c.LogFormat,
+			errors.Errorf("invalid log_format %q, expected text or json", c.LogFormat))
+	}
+
+	threshold, err := time.ParseDuration(c.SlowQuery)
+	if err != nil || threshold < 0 {
+		return invalidValue(c.SlowQuery,
+			errors.Errorf("invalid slow_query_threshold %q, expected a duration like \"500ms\"",
+				c.SlowQuery))
+	}
+	c.slowQueryThreshold = threshold
+
+	path, err := expandPath(c.LogFile)
+	if err != nil {
+		return invalidValue(c.LogFile, err)
+	}
+	c.LogFile = path
+	if c.LogMaxSizeMB < 0 {
+		return invalidValue("log_max_size_mb",
+			errors.Errorf("invalid log_max_size_mb %d", c.LogMaxSizeMB))
+	}
+	if c.LogMaxFiles < 0 {
+		return invalidValue("log_max_files",
+			errors.Errorf("invalid log_max_files %d", c.LogMaxFiles))
+	}
+	return nil
+}
+
+// SlowQueryThreshold returns the duration above which queries
+// are logged, 0 disables the slow query log
+func SlowQueryThreshold() time.Duration {
+	return config.slowQueryThreshold
+}
+
+// SetLogLevel overrides log_level of the config file
+func SetLogLevel(level string) error {
+	if _, ok := logLevels[level]; !ok {
+		return errors.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+	}
+	config.LogLevel = level
+	return nil
+}
+
+// logs is the log file written by SetupLogging, nil if there is none
+var logs *logFile
+
+// SetupLogging sends the logs to the configured outputs, as key=value
+// pairs or JSON objects, dropping records below the configured level.
+// Everything logs through the default slog logger it sets.
 func SetupLogging() error {
 	var writers []io.Writer
-	if config.FileLogs {
-		file, err := setupLogFiles()
+	if config.FileLogs || config.LogFile != "" {
+		file, err := setupLogFile()
 		if err != nil {
 			return err
 		}
-
+		logs = file
 		writers = append(writers, file)
 	}
 
@@ -24,48 +92,102 @@ func SetupLogging() error {
 		writers = append(writers, os.Stdout)
 	}
 
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-	log.SetOutput(io.MultiWriter(writers...))
+	level := logLevels[config.LogLevel]
+	options := &slog.HandlerOptions{
+		Level:     level,
+		AddSource: level == slog.LevelDebug,
+	}
+	var handlers multiHandler
+	if len(writers) > 0 || !config.Syslog {
+		if config.LogFormat == "json" {
+			handlers = append(handlers, slog.NewJSONHandler(io.MultiWriter(writers...), options))
+		} else {
+			handlers = append(handlers, slog.NewTextHandler(io.MultiWriter(writers...), options))
+		}
+	}
+	if config.Syslog {
+		handler, err := newSyslogHandler(options)
+		if err != nil {
+			return err
+		}
+		handlers = append(handlers, handler)
+	}
+
+	if len(handlers) == 1 {
+		slog.SetDefault(slog.New(handlers[0]))
+	} else {
+		slog.SetDefault(slog.New(handlers))
+	}
 	return nil
 }
 
-func setupLogFiles() (*os.File, error) {
-	logDirectory := fmt.Sprintf("/var/log/%s", AppName)
-	if _, err := os.Stat(logDirectory); os.IsNotExist(err) {
-		err := os.Mkdir(logDirectory, os.ModePerm)
-		if err != nil {
-			return nil, errors.Wrap(
-				err,
-				"couldn't create logging directory",
-			)
+// ReopenLogs opens the log file again, so it can be moved away
+// by logrotate
+func ReopenLogs() error {
+	if logs == nil {
+		return nil
+	}
+	return logs.reopen()
+}
+
+// setupLogFile opens log_file, or the default log file in
+// /var/log/gosearch, which is created if it doesn't exist
+func setupLogFile() (*logFile, error) {
+	path := config.LogFile
+	if path == "" {
+		logDirectory := fmt.Sprintf("/var/log/%s", AppName)
+		if _, err := os.Stat(logDirectory); os.IsNotExist(err) {
+			err := os.Mkdir(logDirectory, os.ModePerm)
+			if err != nil {
+				return nil, errors.Wrap(
+					err,
+					"couldn't create logging directory",
+				)
+			}
 		}
+		path = fmt.Sprintf("%s/default", logDirectory)
 	}
 
-	logFilePath := fmt.Sprintf("%s/default", logDirectory)
-	file, err := os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return nil, errors.Wrap(
-			err,
-			"couldn't open logfile",
-		)
-	}
-
-	// log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-	// var output io.Writer
-	// switch {
-	// case stdoutLogs || fileLogs:
-	// 	output = io.MultiWriter(os.Stdout, file)
-	// case fileLogs:
-	// 	output = os.Stdout
-	// case stdoutLogs:
-	// 	output = file
-	// default:
-	// }
-	// if printLogs {
-	// 	log.SetOutput(io.MultiWriter(os.Stdout, file))
-	// } else {
-	// 	log.SetOutput(file)
-	// }
-
-	return file, nil
+	return openLogFile(path, int64(config.LogMaxSizeMB)<<20, config.LogMaxFiles)
+}
+
+// multiHandler hands records to several handlers
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var firstErr error
+	for _, h := range m {
+		if !h.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, r.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
 }
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"github.com/pkg/errors"
+)
+
+// QueryPolicy holds the defaults and limits applied to the queries
+// of the clients besides root, Users override them
+type QueryPolicy struct {
+	// DefaultMaxResults is the result limit of queries without one,
+	// MaxResults the largest they may set, 0 means unlimited
+	DefaultMaxResults int `json:"default_max_results" toml:"default_max_results"`
+	MaxResults        int `json:"max_results" toml:"max_results"`
+	// IncludeFiltered allows walking filtered directories for searches
+	IncludeFiltered bool         `json:"include_filtered" toml:"include_filtered"`
+	Users           []UserPolicy `json:"users" toml:"users"`
+}
+
+// UserPolicy overrides the settings of the QueryPolicy it sets for
+// a user, given by name or uid
+type UserPolicy struct {
+	User              string `json:"user" toml:"user"`
+	DefaultMaxResults *int   `json:"default_max_results" toml:"default_max_results"`
+	MaxResults        *int   `json:"max_results" toml:"max_results"`
+	IncludeFiltered   *bool  `json:"include_filtered" toml:"include_filtered"`
+}
+
+// override returns p with the settings of u
+func (p QueryPolicy) override(u UserPolicy) QueryPolicy {
+	p.Users = nil
+	if u.DefaultMaxResults != nil {
+		p.DefaultMaxResults = *u.DefaultMaxResults
+	}
+	if u.MaxResults != nil {
+		p.MaxResults = *u.MaxResults
+	}
+	if u.IncludeFiltered != nil {
+		p.IncludeFiltered = *u.IncludeFiltered
+	}
+	return p
+}
+
+// validate checks the result limits of p, which applies to who
+func (p QueryPolicy) validate(who string) error {
+	if p.DefaultMaxResults < 0 {
+		return invalidValue(who, errors.Errorf(
+			"invalid policy default_max_results %d for %s", p.DefaultMaxResults, who))
+	}
+	if p.MaxResults < 0 {
+		return invalidValue(who, errors.Errorf(
+			"invalid policy max_results %d for %s", p.MaxResults, who))
+	}
+	if p.MaxResults > 0 && p.DefaultMaxResults > p.MaxResults {
+		return invalidValue(who, errors.Errorf(
+			"policy default_max_results %d exceeds max_results %d for %s",
+			p.DefaultMaxResults, p.MaxResults, who))
+	}
+	return nil
+}
+
+// validatePolicy checks the policy section and the users it overrides
+func (c *Config) validatePolicy() error {
+	if err := c.Policy.validate("policy"); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, u := range c.Policy.Users {
+		if u.User == "" {
+			return invalidValue("users", errors.New("policy user without a name"))
+		}
+		if seen[u.User] {
+			return invalidValue(u.User, errors.Errorf("duplicate policy user %q", u.User))
+		}
+		seen[u.User] = true
+		if err := c.Policy.override(u).validate(u.User); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Policy returns the policy applied to the queries of the clients
+// besides root, and the ones of the users overriding it by name or uid
+func Policy() (defaults QueryPolicy, users map[string]QueryPolicy) {
+	defaults = config.Policy
+	defaults.Users = nil
+	users = make(map[string]QueryPolicy, len(config.Policy.Users))
+	for _, u := range config.Policy.Users {
+		users[u.User] = config.Policy.override(u)
+	}
+	return defaults, users
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	saved := config
+	defer func() {
+		config = saved
+		filters.Store(nil)
+	}()
+
+	content := `home_only = true
+
+[policy]
+default_max_results = 1000
+max_results = 10000
+
+[[policy.users]]
+user = "backup"
+max_results = 0
+
+[[policy.users]]
+user = "1001"
+include_filtered = false
+`
+	if err := decodeConfig("config.toml", []byte(content)); err != nil {
+		t.Fatalf("decodeConfig() error = %v", err)
+	}
+
+	defaults, users := Policy()
+	// include_filtered keeps its default
+	want := QueryPolicy{DefaultMaxResults: 1000, MaxResults: 10000, IncludeFiltered: true}
+	if !reflect.DeepEqual(defaults, want) {
+		t.Errorf("Policy() defaults = %+v, want %+v", defaults, want)
+	}
+	wantUsers := map[string]QueryPolicy{
+		"backup": {DefaultMaxResults: 1000, IncludeFiltered: true},
+		"1001":   {DefaultMaxResults: 1000, MaxResults: 10000},
+	}
+	if !reflect.DeepEqual(users, wantUsers) {
+		t.Errorf("Policy() users = %+v, want %+v", users, wantUsers)
+	}
+}
+
+func TestPolicy_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantLine int
+	}{
+		{"negative_max_results", "[policy]\nmax_results = -1\n", 0},
+		{"default_exceeds_max", "[policy]\ndefault_max_results = 100\nmax_results = 10\n", 0},
+		{"user_default_exceeds_max",
+			"[policy]\nmax_results = 10\n\n[[policy.users]]\nuser = 'me'\ndefault_max_results = 100\n", 5},
+		{"duplicate_user",
+			"[[policy.users]]\nuser = 'me'\n\n[[policy.users]]\nuser = 'you'\n\n[[policy.users]]\nuser = 'you'\n", 5},
+		{"unnamed_user", "[[policy.users]]\nmax_results = 10\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := config
+			defer func() {
+				config = saved
+				filters.Store(nil)
+			}()
+
+			err := decodeConfig("config.toml", []byte(tt.content))
+			parseErr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("decodeConfig() error = %v, want *ParseError", err)
+			}
+			if parseErr.Line != tt.wantLine {
+				t.Errorf("line = %d, want %d (%v)", parseErr.Line, tt.wantLine, err)
+			}
+		})
+	}
+}
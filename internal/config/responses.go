@@ -0,0 +1,50 @@
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// validateResponses checks the buffering of the responses
+func (c *Config) validateResponses() error {
+	if c.ResponseBuffer < 0 {
+		return invalidValue("response_buffer",
+			errors.Errorf("invalid response_buffer %d", c.ResponseBuffer))
+	}
+	wait, err := time.ParseDuration(c.SnapshotReaderWait)
+	if err != nil || wait < 0 {
+		return invalidValue(c.SnapshotReaderWait,
+			errors.Errorf("invalid snapshot_reader_wait %q, expected a duration like \"1s\"",
+				c.SnapshotReaderWait))
+	}
+	c.snapshotReaderWait = wait
+	if c.VerifyExistsLimit < 0 {
+		return invalidValue("verify_exists_limit",
+			errors.Errorf("invalid verify_exists_limit %d", c.VerifyExistsLimit))
+	}
+	if c.QueryCacheSize < 0 {
+		return invalidValue("query_cache_size",
+			errors.Errorf("invalid query_cache_size %d", c.QueryCacheSize))
+	}
+	return nil
+}
+
+// Responses returns the number of response lines sent ahead of a
+// client, and how long changes wait at most for the queries on the
+// copy of the index published before, 0 if until they are done
+func Responses() (buffer int, readerWait time.Duration) {
+	return config.ResponseBuffer, config.snapshotReaderWait
+}
+
+// VerifyExistsLimit returns the number of results a query verifying
+// that they exist stats at most
+func VerifyExistsLimit() int {
+	return config.VerifyExistsLimit
+}
+
+// QueryCacheSize returns the number of searches whose results are
+// cached, 0 if none are
+func QueryCacheSize() int {
+	return config.QueryCacheSize
+}
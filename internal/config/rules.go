@@ -0,0 +1,68 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FilterDecision is the result of evaluating the filters for a path
+type FilterDecision int
+
+const (
+	// Included paths are indexed
+	Included FilterDecision = iota
+	// Excluded paths and everything below them are not indexed
+	Excluded
+	// Traversed directories are not indexed themselves, but contain
+	// descendants that are included by a filter rule
+	Traversed
+)
+
+// filterRule is an entry of the ordered include/exclude rule list.
+// Rules are written like rsync filter rules, "+ pattern" includes
+// and "- pattern" excludes, the first matching rule wins.
+type filterRule struct {
+	include bool
+	pattern globPattern
+}
+
+func parseFilterRule(rule string) (filterRule, error) {
+	if len(rule) < 3 || rule[1] != ' ' || (rule[0] != '+' && rule[0] != '-') {
+		return filterRule{}, errors.Errorf(
+			"invalid filter rule %q, expected \"+ pattern\" or \"- pattern\"", rule)
+	}
+
+	pattern, err := compileGlob(strings.TrimSpace(rule[2:]))
+	if err != nil {
+		return filterRule{}, errors.Wrapf(err, "invalid filter rule %q", rule)
+	}
+
+	return filterRule{rule[0] == '+', pattern}, nil
+}
+
+// evaluateRules returns the decision of the first rule matching path.
+// matched is false if no rule matches.
+func (f *filterSet) evaluateRules(path string) (decision FilterDecision, matched bool) {
+	for i, rule := range f.rules {
+		if !rule.pattern.matches(path) {
+			continue
+		}
+
+		if rule.include {
+			return Included, true
+		}
+
+		// every descendant of path is matched by this rule as well,
+		// so only an earlier include rule can bring it back
+		for _, earlier := range f.rules[:i] {
+			if earlier.include && earlier.pattern.mayMatchBelow(path) {
+				return Traversed, true
+			}
+		}
+
+		return Excluded, true
+	}
+
+	return Included, false
+}
@@ -0,0 +1,120 @@
+package config
+
+import "testing"
+
+func setFilterRules(t *testing.T, rules []string) {
+	t.Helper()
+	config.FilterRules = rules
+	if err := parseFilters(); err != nil {
+		t.Fatalf("parseFilters() error = %v", err)
+	}
+}
+
+func resetFilterRules() {
+	config.FilterRules = []string{}
+	filters.Store(nil)
+}
+
+func TestParseFilterRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		wantErr bool
+	}{
+		{"include", "+ /home/me/work", false},
+		{"exclude", "- node_modules", false},
+		{"missing_sign", "/home/me/work", true},
+		{"missing_space", "+/etc", true},
+		{"empty_pattern", "- ", true},
+		{"invalid_glob", "- /home/[me", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseFilterRule(tt.rule); (err != nil) != tt.wantErr {
+				t.Errorf("parseFilterRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFilterPath_Rules(t *testing.T) {
+	whitelist := []string{"+ /home/me/work", "+ /etc", "- *"}
+
+	tests := []struct {
+		name  string
+		rules []string
+		path  string
+		want  FilterDecision
+	}{
+		{"whitelist_included_root", whitelist, "/etc", Included},
+		{"whitelist_included_descendant", whitelist, "/home/me/work/src/main.go", Included},
+		{"whitelist_ancestor_traversed", whitelist, "/home", Traversed},
+		{"whitelist_parent_traversed", whitelist, "/home/me", Traversed},
+		{"whitelist_sibling_excluded", whitelist, "/home/me/music", Excluded},
+		{"whitelist_other_user_excluded", whitelist, "/home/other", Excluded},
+		{"whitelist_unrelated_excluded", whitelist, "/usr/bin/go", Excluded},
+		{"whitelist_similar_name_excluded", whitelist, "/home/me/workshop", Excluded},
+		{
+			"first_match_wins_exclude",
+			[]string{"- node_modules", "+ /home/me/work", "- *"},
+			"/home/me/work/web/node_modules/react",
+			Excluded,
+		},
+		{
+			"first_match_wins_include",
+			[]string{"+ /home/me/work", "- node_modules", "- *"},
+			"/home/me/work/web/node_modules/react",
+			Included,
+		},
+		{
+			"include_after_exclude_has_no_effect",
+			[]string{"- /home", "+ /home/me/work"},
+			"/home/me",
+			Excluded,
+		},
+		{
+			"wildcard_include_traverses",
+			[]string{"+ /home/*/work", "- /home"},
+			"/home/me",
+			Traversed,
+		},
+		{
+			"unanchored_include_traverses_everything",
+			[]string{"+ *.conf", "- /etc"},
+			"/etc/nginx",
+			Traversed,
+		},
+		{
+			"double_star_include",
+			[]string{"+ /srv/**/public", "- /srv"},
+			"/srv/sites/blog/public/index.html",
+			Included,
+		},
+		{"no_matching_rule", []string{"- /tmp"}, "/home/me", Included},
+		{"root_never_filtered", whitelist, "/", Included},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFilterRules(t, tt.rules)
+			defer resetFilterRules()
+
+			if got := FilterPath(tt.path); got != tt.want {
+				t.Errorf("FilterPath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterPath_RulesPrecedeFilters(t *testing.T) {
+	setFilterRules(t, []string{"+ /home/me/.config"})
+	defer resetFilterRules()
+	config.IgnoreHiddenFiles = true
+	defer func() { config.IgnoreHiddenFiles = false }()
+
+	if got := FilterPath("/home/me/.config/nvim"); got != Included {
+		t.Errorf("FilterPath() = %v, want %v", got, Included)
+	}
+	if got := FilterPath("/home/me/.cache"); got != Excluded {
+		t.Errorf("FilterPath() = %v, want %v", got, Excluded)
+	}
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// AddGlobFilter adds a glob filter to the running configuration.
+// It returns the pattern as it was added, with ~ and environment
+// variables expanded.
+func AddGlobFilter(pattern string) (string, error) {
+	expanded, err := expandPath(pattern)
+	if err != nil {
+		return "", err
+	}
+	if _, err := compileGlob(expanded); err != nil {
+		return "", err
+	}
+
+	filterLock.Lock()
+	defer filterLock.Unlock()
+
+	for _, existing := range config.GlobFilters {
+		if existing == expanded {
+			return "", errors.Errorf("glob filter %q already exists", expanded)
+		}
+	}
+
+	patterns := make([]string, 0, len(config.GlobFilters)+1)
+	patterns = append(patterns, config.GlobFilters...)
+	if err := setGlobFilters(append(patterns, expanded)); err != nil {
+		return "", err
+	}
+	changes.add(pattern, expanded)
+	return expanded, nil
+}
+
+// RemoveGlobFilter removes a glob filter from the running configuration.
+// The default filters can't be removed, set no_default_filters instead.
+func RemoveGlobFilter(pattern string) (string, error) {
+	expanded, err := expandPath(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	filterLock.Lock()
+	defer filterLock.Unlock()
+
+	patterns := make([]string, 0, len(config.GlobFilters))
+	for _, existing := range config.GlobFilters {
+		if existing != expanded {
+			patterns = append(patterns, existing)
+		}
+	}
+
+	if len(patterns) == len(config.GlobFilters) {
+		for _, d := range defaultGlobFilters {
+			if d == expanded && !config.NoDefaultFilters {
+				return "", errors.Errorf("%q is a default filter, "+
+					"set no_default_filters to disable it", expanded)
+			}
+		}
+		return "", errors.Errorf("no glob filter %q", expanded)
+	}
+
+	if err := setGlobFilters(patterns); err != nil {
+		return "", err
+	}
+	changes.remove(pattern, expanded)
+	return expanded, nil
+}
+
+// setGlobFilters replaces the user's glob filters and publishes the
+// filters with them, filterLock has to be held
+func setGlobFilters(patterns []string) error {
+	previous := config.GlobFilters
+	config.GlobFilters = patterns
+
+	globs, err := compileGlobs(config.effectiveGlobFilters())
+	if err != nil {
+		config.GlobFilters = previous
+		return err
+	}
+	next := *currentFilters()
+	next.globs = newGlobSet(globs)
+	filters.Store(&next)
+	return nil
+}
+
+// FilterScope returns the directory below which every path matched by
+// the glob pattern lies, i.e. its leading literal components.
+// Unanchored patterns can match anywhere, their scope is the root.
+func FilterScope(pattern string) string {
+	g, err := compileGlob(pattern)
+	if err != nil || !g.anchored {
+		return "/"
+	}
+
+	parts := make([]string, 0, len(g.segments))
+	for _, s := range g.segments {
+		if s.kind != literalSegment {
+			break
+		}
+		parts = append(parts, s.text)
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// runtimeChanges are the glob filter changes made at runtime, which
+// SaveConfig persists. The patterns are kept as the clients sent them,
+// ~ and environment variables are expanded when they are applied.
+type runtimeChanges struct {
+	AddedGlobFilters   []string `toml:"added_glob_filters"`
+	RemovedGlobFilters []string `toml:"removed_glob_filters"`
+}
+
+// changes are the glob filter changes since the config file was read,
+// guarded by filterLock
+var changes runtimeChanges
+
+// add records that pattern was added, re-adding a removed filter
+// of the config file undoes the removal
+func (c *runtimeChanges) add(pattern, expanded string) {
+	if removed, ok := withoutPattern(c.RemovedGlobFilters, expanded); ok {
+		c.RemovedGlobFilters = removed
+		return
+	}
+	c.AddedGlobFilters = append(c.AddedGlobFilters, pattern)
+}
+
+// remove records that pattern was removed, removing a filter added
+// at runtime undoes the addition
+func (c *runtimeChanges) remove(pattern, expanded string) {
+	if added, ok := withoutPattern(c.AddedGlobFilters, expanded); ok {
+		c.AddedGlobFilters = added
+		return
+	}
+	c.RemovedGlobFilters = append(c.RemovedGlobFilters, pattern)
+}
+
+// withoutPattern returns patterns without the one expanding to expanded
+// and whether there was one
+func withoutPattern(patterns []string, expanded string) ([]string, bool) {
+	for i, pattern := range patterns {
+		if e, err := expandPath(pattern); err == nil && e == expanded {
+			return append(patterns[:i:i], patterns[i+1:]...), true
+		}
+	}
+	return patterns, false
+}
+
+// applyRuntimeConfig applies the glob filter changes persisted at path
+// to the configuration read from the config file
+func applyRuntimeConfig(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var persisted runtimeChanges
+	if err := decodeTOML(path, content, &persisted); err != nil {
+		return err
+	}
+
+	var applied runtimeChanges
+	for _, pattern := range persisted.RemovedGlobFilters {
+		expanded, err := expandPath(pattern)
+		if err != nil {
+			return &ParseError{path, lineOfValue(content, pattern), err}
+		}
+		// the filter can be gone from the config file since
+		if patterns, ok := withoutPattern(config.GlobFilters, expanded); ok {
+			config.GlobFilters = patterns
+			applied.remove(pattern, expanded)
+		}
+	}
+	for _, pattern := range persisted.AddedGlobFilters {
+		expanded, err := expandPath(pattern)
+		if err != nil {
+			return &ParseError{path, lineOfValue(content, pattern), err}
+		}
+		if _, ok := withoutPattern(config.GlobFilters, expanded); !ok {
+			config.GlobFilters = append(config.GlobFilters, expanded)
+			applied.add(pattern, expanded)
+		}
+	}
+
+	if err := parseFilters(); err != nil {
+		line := 0
+		if valueErr, ok := err.(*invalidValueError); ok {
+			line = lineOfValue(content, valueErr.value)
+		}
+		return &ParseError{path, line, err}
+	}
+
+	filterLock.Lock()
+	defer filterLock.Unlock()
+	changes = applied
+	return nil
+}
+
+// SaveConfig persists the glob filter changes made at runtime to
+// runtimeConfigPath. The config file, TOML or legacy JSON, isn't
+// rewritten, the changes are applied over it on the next start.
+func SaveConfig() error {
+	return saveRuntimeConfig(runtimeConfigPath)
+}
+
+func saveRuntimeConfig(path string) error {
+	filterLock.Lock()
+	defer filterLock.Unlock()
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".runtime.toml")
+	if err != nil {
+		return errors.Wrap(err, "can't create runtime config file")
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.WriteString(f, "# glob filter changes made with gosearch -persist, "+
+		"they are applied over the config file\n")
+	if err == nil {
+		err = toml.NewEncoder(f).Encode(&changes)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "can't write runtime config file")
+	}
+
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return errors.Wrap(err, "can't write runtime config file")
+	}
+	return errors.Wrap(os.Rename(f.Name(), path),
+		"can't replace runtime config file")
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAddRemoveGlobFilter(t *testing.T) {
+	defer func() {
+		config.GlobFilters = []string{}
+		changes = runtimeChanges{}
+		if err := parseFilters(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	const path = "/home/me/Videos/clip.mp4"
+	if IsPathFiltered(path) {
+		t.Fatalf("%s filtered before adding the filter", path)
+	}
+
+	if _, err := AddGlobFilter("/home/me/Videos"); err != nil {
+		t.Fatal(err)
+	}
+	if !IsPathFiltered(path) {
+		t.Errorf("%s not filtered after adding the filter", path)
+	}
+	if _, err := AddGlobFilter("/home/me/Videos"); err == nil {
+		t.Error("AddGlobFilter() error = nil, want error for duplicate")
+	}
+
+	if _, err := RemoveGlobFilter("/home/me/Videos"); err != nil {
+		t.Fatal(err)
+	}
+	if IsPathFiltered(path) {
+		t.Errorf("%s filtered after removing the filter", path)
+	}
+	if _, err := RemoveGlobFilter("/home/me/Videos"); err == nil {
+		t.Error("RemoveGlobFilter() error = nil, want error for missing filter")
+	}
+	if _, err := RemoveGlobFilter("/proc"); err == nil {
+		t.Error("RemoveGlobFilter() error = nil, want error for default filter")
+	}
+}
+
+func TestFilterScope(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"/home/me/Videos", "/home/me/Videos"},
+		{"/home/*/Videos", "/home"},
+		{"/**/node_modules", "/"},
+		{"node_modules", "/"},
+	}
+	for _, tt := range tests {
+		if got := FilterScope(tt.pattern); got != tt.want {
+			t.Errorf("FilterScope(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestSaveConfig_LegacyJSON(t *testing.T) {
+	saved := config
+	defer func() {
+		config = saved
+		changes = runtimeChanges{}
+		filters.Store(nil)
+	}()
+	t.Setenv("HOME", "/home/me")
+
+	const legacy = `{"glob_filters": ["~/Videos", "node_modules"]}`
+	if err := decodeConfig(legacyConfigPath, []byte(legacy)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddGlobFilter("~/Downloads"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RemoveGlobFilter("node_modules"); err != nil {
+		t.Fatal(err)
+	}
+	// re-adding a removed filter of the config file is no change
+	if _, err := AddGlobFilter("~/Music"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RemoveGlobFilter("/home/me/Music"); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "runtime.toml")
+	if err := saveRuntimeConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the patterns are written as they were sent, not expanded
+	for _, want := range []string{`added_glob_filters = ["~/Downloads"]`,
+		`removed_glob_filters = ["node_modules"]`} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("runtime config lacks %s:\n%s", want, content)
+		}
+	}
+
+	// a restart reads the legacy config again and applies the changes
+	config = saved
+	changes = runtimeChanges{}
+	if err := decodeConfig(legacyConfigPath, []byte(legacy)); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyRuntimeConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/home/me/Videos", "/home/me/Downloads"}
+	if !reflect.DeepEqual(config.GlobFilters, want) {
+		t.Errorf("glob filters = %q, want %q", config.GlobFilters, want)
+	}
+	if !IsPathFiltered("/home/me/Downloads/x.iso") || IsPathFiltered("/src/node_modules/x") {
+		t.Error("the persisted changes aren't applied to the filters")
+	}
+
+	// undoing the persisted addition persists the config file as it is
+	if _, err := RemoveGlobFilter("~/Downloads"); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.AddedGlobFilters) != 0 {
+		t.Errorf("added glob filters = %q, want none", changes.AddedGlobFilters)
+	}
+}
+
+func TestApplyRuntimeConfig_Invalid(t *testing.T) {
+	saved := config
+	defer func() {
+		config = saved
+		changes = runtimeChanges{}
+		filters.Store(nil)
+	}()
+
+	path := filepath.Join(t.TempDir(), "runtime.toml")
+	content := "added_glob_filters = [\"/a\"]\nindex_hidden = false\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := applyRuntimeConfig(path)
+	parseErr, ok := err.(*ParseError)
+	if !ok || parseErr.Line != 2 {
+		t.Errorf("applyRuntimeConfig() error = %v, want an unknown key on line 2", err)
+	}
+
+	if err := applyRuntimeConfig(filepath.Join(t.TempDir(), "runtime.toml")); err != nil {
+		t.Errorf("applyRuntimeConfig() of a missing file: %v", err)
+	}
+}
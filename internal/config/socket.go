@@ -0,0 +1,141 @@
+package config
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+func (c *Config) parseSocketOptions() error {
+	path, err := expandPath(c.SocketPath)
+	if err != nil {
+		return invalidValue(c.SocketPath, err)
+	}
+	c.SocketPath = path
+
+	path, err = expandPath(c.GRPCSocket)
+	if err != nil {
+		return invalidValue(c.GRPCSocket, err)
+	}
+	c.GRPCSocket = path
+
+	path, err = expandPath(c.StateDirectory)
+	if err != nil {
+		return invalidValue(c.StateDirectory, err)
+	}
+	if !filepath.IsAbs(path) {
+		return invalidValue(c.StateDirectory,
+			errors.New("state_directory has to be an absolute path"))
+	}
+	c.StateDirectory = path
+
+	mode, err := strconv.ParseUint(c.SocketMode, 8, 32)
+	if err != nil || os.FileMode(mode)&^os.ModePerm != 0 {
+		return invalidValue(c.SocketMode,
+			errors.Errorf("invalid socket mode %q", c.SocketMode))
+	}
+	c.socketMode = os.FileMode(mode)
+
+	if c.HTTPAddress != "" {
+		host, _, err := net.SplitHostPort(c.HTTPAddress)
+		if err != nil {
+			return invalidValue(c.HTTPAddress,
+				errors.Wrap(err, "invalid http_address"))
+		}
+		// HTTP clients have no credentials the access policy could
+		// check, only the token keeps them out
+		if c.HTTPToken == "" && !isLoopback(host) {
+			return invalidValue(c.HTTPAddress,
+				errors.New("an http_address that isn't a loopback address needs an http_token"))
+		}
+		if c.HTTPToken == "" && (len(c.AllowedUsers) > 0 || len(c.AllowedGroups) > 0) {
+			return invalidValue(c.HTTPAddress,
+				errors.New("the http_address needs an http_token when allowed_users or allowed_groups are set"))
+		}
+	}
+
+	if c.MetricsAddress != "" {
+		if _, _, err := net.SplitHostPort(c.MetricsAddress); err != nil {
+			return invalidValue(c.MetricsAddress,
+				errors.Wrap(err, "invalid metrics_address"))
+		}
+	}
+
+	if c.PprofAddress != "" {
+		host, _, err := net.SplitHostPort(c.PprofAddress)
+		if err != nil {
+			return invalidValue(c.PprofAddress,
+				errors.Wrap(err, "invalid pprof_address"))
+		}
+		if !isLoopback(host) {
+			return invalidValue(c.PprofAddress,
+				errors.New("pprof_address has to be a loopback address"))
+		}
+	}
+
+	path, err = expandPath(c.HeapProfilePath)
+	if err != nil {
+		return invalidValue(c.HeapProfilePath, err)
+	}
+	c.HeapProfilePath = path
+
+	return nil
+}
+
+// Socket returns the configured path, file mode and owning group
+// of the server's socket. An empty path means the default location.
+func Socket() (path string, mode os.FileMode, group string) {
+	return config.SocketPath, config.socketMode, config.SocketGroup
+}
+
+// Access returns the users and groups allowed to query the server
+// and the group allowed to change it besides root
+func Access() (allowedUsers, allowedGroups []string, adminGroup string) {
+	return config.AllowedUsers, config.AllowedGroups, config.AdminGroup
+}
+
+// GRPCSocket returns the path of the gRPC socket,
+// empty if the gRPC server is disabled
+func GRPCSocket() string {
+	return config.GRPCSocket
+}
+
+// isLoopback returns whether host only accepts connections
+// from the local machine
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// PprofAddress returns the address serving runtime profiles,
+// empty if it is disabled
+func PprofAddress() string {
+	return config.PprofAddress
+}
+
+// HeapProfilePath returns where heap profiles are written,
+// heap.pprof in the state directory by default
+func HeapProfilePath() string {
+	if config.HeapProfilePath == "" {
+		return filepath.Join(config.StateDirectory, "heap.pprof")
+	}
+	return config.HeapProfilePath
+}
+
+// MetricsAddress returns the address of the metrics listener,
+// empty if it is disabled
+func MetricsAddress() string {
+	return config.MetricsAddress
+}
+
+// HTTP returns the address of the HTTP listener, empty if it is
+// disabled, and the bearer token clients have to send
+func HTTP() (address, token string) {
+	return config.HTTPAddress, config.HTTPToken
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseSocketOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		stateDir string
+		want     os.FileMode
+		wantErr  bool
+	}{
+		{"default", "0777", "/var/lib/gosearch", 0777, false},
+		{"group", "0660", "/var/lib/gosearch", 0660, false},
+		{"without_leading_zero", "660", "/var/lib/gosearch", 0660, false},
+		{"owner_only", "0600", "/var/lib/gosearch", 0600, false},
+		{"not_octal", "0888", "/var/lib/gosearch", 0, true},
+		{"go_prefix", "0o660", "/var/lib/gosearch", 0, true},
+		{"sticky", "01777", "/var/lib/gosearch", 0, true},
+		{"empty", "", "/var/lib/gosearch", 0, true},
+		{"relative_state_directory", "0660", "var/lib/gosearch", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaultConfig()
+			c.SocketMode = tt.mode
+			c.StateDirectory = tt.stateDir
+
+			err := c.parseSocketOptions()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSocketOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && c.socketMode != tt.want {
+				t.Errorf("socket mode = %o, want %o", c.socketMode, tt.want)
+			}
+		})
+	}
+}
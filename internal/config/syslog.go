@@ -0,0 +1,80 @@
+//go:build !windows
+
+package config
+
+import (
+	"context"
+	"log/slog"
+	"log/syslog"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// syslogHandler formats records like a text handler and sends them
+// to syslog, which journald reads as well, with the priority of
+// their level
+type syslogHandler struct {
+	slog.Handler
+	out *syslogWriter
+}
+
+// syslogWriter sends what a handler writes to syslog, level is the
+// level of the record being written
+type syslogWriter struct {
+	mu     sync.Mutex
+	writer *syslog.Writer
+	level  slog.Level
+}
+
+func newSyslogHandler(options *slog.HandlerOptions) (slog.Handler, error) {
+	writer, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, AppName)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't connect to syslog")
+	}
+
+	out := &syslogWriter{writer: writer}
+	withoutTime := *options
+	// syslog adds its own timestamp
+	withoutTime.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+		if a.Key == slog.TimeKey && len(groups) == 0 {
+			return slog.Attr{}
+		}
+		return a
+	}
+	return syslogHandler{slog.NewTextHandler(out, &withoutTime), out}, nil
+}
+
+func (h syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+	h.out.level = r.Level
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return syslogHandler{h.Handler.WithAttrs(attrs), h.out}
+}
+
+func (h syslogHandler) WithGroup(name string) slog.Handler {
+	return syslogHandler{h.Handler.WithGroup(name), h.out}
+}
+
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	message := string(p)
+	var err error
+	switch {
+	case w.level >= slog.LevelError:
+		err = w.writer.Err(message)
+	case w.level >= slog.LevelWarn:
+		err = w.writer.Warning(message)
+	case w.level >= slog.LevelInfo:
+		err = w.writer.Info(message)
+	default:
+		err = w.writer.Debug(message)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
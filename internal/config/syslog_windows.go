@@ -0,0 +1,12 @@
+package config
+
+import (
+	"log/slog"
+
+	"github.com/pkg/errors"
+)
+
+// newSyslogHandler fails, there is no syslog on windows
+func newSyslogHandler(*slog.HandlerOptions) (slog.Handler, error) {
+	return nil, errors.New("syslog isn't supported on windows")
+}
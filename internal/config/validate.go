@@ -0,0 +1,297 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// ParseError describes an invalid configuration file.
+// Line is 0 if the error can't be attributed to a line.
+type ParseError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (err *ParseError) Error() string {
+	if err.Line == 0 {
+		return fmt.Sprintf("%s: %v", err.Path, err.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", err.Path, err.Line, err.Err)
+}
+
+// invalidValueError is returned by the validation functions,
+// value is used to find the offending line in the config file
+type invalidValueError struct {
+	value string
+	err   error
+}
+
+func (err *invalidValueError) Error() string {
+	return err.err.Error()
+}
+
+func invalidValue(value string, err error) error {
+	return &invalidValueError{value, err}
+}
+
+// decodeConfig strictly decodes content into the configuration,
+// validates it and publishes its filters
+func decodeConfig(path string, content []byte) error {
+	f, err := config.decode(path, content)
+	if err != nil {
+		return err
+	}
+	publishFilters(f)
+
+	if len(config.RegexFilters) > 0 {
+		slog.Warn("deprecated: regex_filters, rename it to filter_regex", "path", path)
+	}
+	return nil
+}
+
+// decode strictly decodes content into c and validates it. Files
+// without the .toml extension are decoded as legacy JSON configs.
+func (c *Config) decode(path string, content []byte) (*filterSet, error) {
+	var err error
+	if strings.HasSuffix(path, ".toml") {
+		err = decodeTOML(path, content, c)
+	} else {
+		err = decodeJSON(path, content, c)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := c.validate()
+	if err != nil {
+		line := 0
+		if valueErr, ok := err.(*invalidValueError); ok {
+			line = lineOfValue(content, valueErr.value)
+		}
+		return nil, &ParseError{path, line, err}
+	}
+	return f, nil
+}
+
+// decodeTOML strictly decodes content into v, keys v has no field
+// for are an error
+func decodeTOML(path string, content []byte, v interface{}) error {
+	md, err := toml.Decode(string(content), v)
+	if err != nil {
+		line := 0
+		switch tomlErr := err.(type) {
+		case toml.ParseError:
+			line = tomlErr.Position.Line
+		case *toml.ParseError:
+			line = tomlErr.Position.Line
+		}
+		return &ParseError{path, line, err}
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		key := undecoded[0]
+		return &ParseError{
+			path,
+			lineOfSubstring(content, key[len(key)-1]),
+			errors.Errorf("unknown key %q", key.String()),
+		}
+	}
+
+	return nil
+}
+
+// decodeJSON strictly decodes content into v like decodeTOML
+func decodeJSON(path string, content []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err != nil {
+		return &ParseError{path, decodeErrorLine(content, err), err}
+	}
+
+	return nil
+}
+
+// validateConfig validates the configuration and publishes its filters
+func validateConfig() error {
+	f, err := config.validate()
+	if err != nil {
+		return err
+	}
+	publishFilters(f)
+	return nil
+}
+
+// validate checks c, expands its paths and parses its settings.
+// It returns the compiled filters of c, they aren't published.
+func (c *Config) validate() (*filterSet, error) {
+	err := c.expandConfigPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fsType := range c.ExcludeFSTypes {
+		if strings.TrimSpace(fsType) == "" {
+			return nil, invalidValue(fsType, errors.New("empty filesystem type"))
+		}
+	}
+
+	err = c.validateDepthLimits()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.validateLazyIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.validateColdPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.parseSocketOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.validateLogging()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.MemoryBudgetMB < 0 {
+		return nil, invalidValue("memory_budget_mb",
+			errors.Errorf("invalid memory_budget_mb %d", c.MemoryBudgetMB))
+	}
+
+	if c.MinQueryLength < 0 {
+		return nil, invalidValue("min_query_length",
+			errors.Errorf("invalid min_query_length %d", c.MinQueryLength))
+	}
+
+	err = c.validateWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.validateJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.validateDeleted()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.validateRecent()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.validatePolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.validateResponses()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.validateClasses()
+	if err != nil {
+		return nil, err
+	}
+
+	if name := c.TagsXattr; name != "" && !strings.Contains(strings.Trim(name, "."), ".") {
+		return nil, invalidValue(name,
+			errors.Errorf("invalid tags_xattr %q, expected a name with a namespace like \"user.tags\"", name))
+	}
+
+	err = c.QueryLimits.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.compileFilters()
+}
+
+func decodeErrorLine(content []byte, err error) int {
+	switch err := err.(type) {
+	case *json.SyntaxError:
+		return lineOfOffset(content, err.Offset)
+	case *json.UnmarshalTypeError:
+		return lineOfOffset(content, err.Offset)
+	}
+
+	// unknown fields are reported without an offset
+	const unknownField = "json: unknown field "
+	if msg := err.Error(); strings.HasPrefix(msg, unknownField) {
+		return lineOfSubstring(content, msg[len(unknownField):])
+	}
+
+	return 0
+}
+
+func lineOfOffset(content []byte, offset int64) int {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	return bytes.Count(content[:offset], []byte("\n")) + 1
+}
+
+func lineOfSubstring(content []byte, substring string) int {
+	idx := bytes.Index(content, []byte(substring))
+	if idx == -1 {
+		return 0
+	}
+	return lineOfOffset(content, int64(idx))
+}
+
+func lineOfValue(content []byte, value string) int {
+	quoted, err := json.Marshal(value)
+	if err != nil {
+		return 0
+	}
+	if line := lineOfSubstring(content, string(quoted)); line != 0 {
+		return line
+	}
+	// TOML literal strings
+	return lineOfSubstring(content, "'"+value+"'")
+}
+
+// CheckConfig loads and validates the config file and the filter
+// changes persisted at runtime without creating the config file or
+// any other side effects on the system
+func CheckConfig() error {
+	path, content, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+
+	if err := decodeConfig(path, content); err != nil {
+		return err
+	}
+	return applyRuntimeConfig(runtimeConfigPath)
+}
+
+// EffectiveConfig returns the loaded configuration merged with
+// the default filters as indented JSON
+func EffectiveConfig() ([]byte, error) {
+	effective := config
+	effective.GlobFilters = config.effectiveGlobFilters()
+	effective.NoDefaultFilters = true
+
+	return json.MarshalIndent(&effective, "", "    ")
+}
@@ -0,0 +1,257 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantLine int
+	}{
+		{
+			"unknown_key",
+			"{\n    \"prefix_filters\": [],\n    \"prefix_filter\": [\"/proc\"]\n}",
+			3,
+		},
+		{
+			"syntax_error",
+			"{\n    \"prefix_filters\": [\"/proc\",]\n}",
+			2,
+		},
+		{
+			"wrong_type",
+			"{\n    \"home_only\": true,\n    \"max_depth\": \"3\"\n}",
+			3,
+		},
+		{
+			"invalid_glob",
+			"{\n    \"glob_filters\": [\n        \"node_modules\",\n        \"/home/[me\"\n    ]\n}",
+			4,
+		},
+		{
+			"invalid_regex",
+			"{\n    \"filter_regex\": [\"(unclosed\"]\n}",
+			2,
+		},
+		{
+			"invalid_deprecated_regex",
+			"{\n    \"filter_regex\": [],\n    \"regex_filters\": [\"(unclosed\"]\n}",
+			3,
+		},
+		{
+			"invalid_rule",
+			"{\n\n    \"filter_rules\": [\"/etc\"]\n}",
+			3,
+		},
+		{
+			"public_http_address",
+			"{\n    \"http_address\": \"0.0.0.0:7700\"\n}",
+			2,
+		},
+		{
+			"http_address_allowed_users",
+			"{\n    \"allowed_users\": [\"root\"],\n    \"http_address\": \"127.0.0.1:7700\"\n}",
+			3,
+		},
+		{
+			"invalid_log_level",
+			"{\n    \"print_logs\": true,\n    \"log_level\": \"verbose\"\n}",
+			3,
+		},
+		{
+			"invalid_log_format",
+			"{\n    \"log_format\": \"xml\"\n}",
+			2,
+		},
+		{
+			"invalid_slow_query_threshold",
+			"{\n    \"slow_query_threshold\": \"1 second\"\n}",
+			2,
+		},
+		{
+			"negative_log_max_files",
+			"{\n    \"log_max_size_mb\": 10,\n    \"log_max_files\": -1\n}",
+			3,
+		},
+		{
+			"public_pprof_address",
+			"{\n    \"pprof_address\": \"0.0.0.0:6060\"\n}",
+			2,
+		},
+		{
+			"negative_memory_budget",
+			"{\n    \"print_logs\": true,\n    \"memory_budget_mb\": -1\n}",
+			3,
+		},
+		{
+			"negative_min_query_length",
+			"{\n    \"min_query_length\": -1\n}",
+			2,
+		},
+		{
+			"unknown_watcher",
+			"{\n    \"print_logs\": true,\n    \"watcher\": \"kqueue\"\n}",
+			3,
+		},
+		{
+			"short_poll_interval",
+			"{\n    \"poll_interval\": \"10ms\"\n}",
+			2,
+		},
+		{
+			"unknown_journal_fsync",
+			"{\n    \"journal\": true,\n    \"journal_fsync\": \"always\"\n}",
+			3,
+		},
+		{
+			"invalid_journal_fsync_interval",
+			"{\n    \"journal_fsync\": \"interval\",\n    \"journal_fsync_interval\": \"0s\"\n}",
+			3,
+		},
+		{
+			"negative_query_rate",
+			"{\n    \"queries_per_second_per_user\": -1\n}",
+			2,
+		},
+		{
+			"negative_depth",
+			"{\n    \"depth_overrides\": [\n        {\"path\": \"/home/me/mail\", \"max_depth\": -1}\n    ]\n}",
+			3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := config
+			defer func() {
+				config = saved
+				filters.Store(nil)
+			}()
+
+			err := decodeConfig("config", []byte(tt.content))
+			parseErr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("decodeConfig() error = %v, want *ParseError", err)
+			}
+			if parseErr.Line != tt.wantLine {
+				t.Errorf("decodeConfig() error line = %d, want %d (%v)",
+					parseErr.Line, tt.wantLine, err)
+			}
+		})
+	}
+}
+
+func TestDecodeConfig_TOML(t *testing.T) {
+	saved := config
+	defer func() {
+		config = saved
+		filters.Store(nil)
+	}()
+
+	content := `glob_filters = ["node_modules", '/home/*/.cache']
+filter_rules = ["+ /home/me/work", "- *"]
+max_depth = 12
+max_concurrent_queries = 4
+
+[[depth_overrides]]
+path = "/home/me/mail"
+max_depth = 3
+
+[classes]
+image = ["jxl"]
+book = [".Mobi", "azw3"]
+`
+	if err := decodeConfig("config.toml", []byte(content)); err != nil {
+		t.Fatalf("decodeConfig() error = %v", err)
+	}
+
+	if len(config.GlobFilters) != 2 || config.MaxDepth != 12 ||
+		config.MaxConcurrentQueries != 4 {
+		t.Errorf("decodeConfig() config = %+v", config)
+	}
+	want := DepthOverride{"/home/me/mail", 3}
+	if len(config.DepthOverrides) != 1 || config.DepthOverrides[0] != want {
+		t.Errorf("decodeConfig() depth overrides = %v, want [%v]",
+			config.DepthOverrides, want)
+	}
+	// configured extensions are added to the default ones
+	if image, _, _ := Class("image"); !image["jxl"] || !image["png"] {
+		t.Errorf("image class = %v, want jxl and png", image)
+	}
+	if book, _, ok := Class("book"); !ok || !book["mobi"] || !book["azw3"] {
+		t.Errorf("book class = %v, want mobi and azw3", book)
+	}
+}
+
+func TestDecodeConfig_DeprecatedRegexFilters(t *testing.T) {
+	saved := config
+	defer func() {
+		config = saved
+		filters.Store(nil)
+	}()
+
+	// regex_filters is still applied, after filter_regex
+	content := `filter_regex = ['/build-[0-9a-f]{8}$']
+regex_filters = ['/tmp-[0-9]+$']
+`
+	if err := decodeConfig("config.toml", []byte(content)); err != nil {
+		t.Fatalf("decodeConfig() error = %v", err)
+	}
+
+	for _, path := range []string{"/home/me/build-0123abcd", "/home/me/tmp-42"} {
+		if !IsPathFiltered(path) {
+			t.Errorf("%s isn't filtered", path)
+		}
+	}
+	var regexes []string
+	for _, filter := range EffectiveFilters() {
+		if filter.Class == "regex" {
+			regexes = append(regexes, filter.Pattern)
+		}
+	}
+	if want := []string{"/build-[0-9a-f]{8}$", "/tmp-[0-9]+$"}; !reflect.DeepEqual(regexes, want) {
+		t.Errorf("regex filters = %q, want %q", regexes, want)
+	}
+}
+
+func TestDecodeConfig_TOMLErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantLine int
+	}{
+		{"unknown_key", "home_only = true\nprefix_filter = [\"/proc\"]\n", 2},
+		{"syntax_error", "home_only = true\nmax_depth = = 3\n", 2},
+		{"invalid_glob", "glob_filters = [\n    'node_modules',\n    '/home/[me',\n]\n", 3},
+		{"invalid_regex", "home_only = true\nfilter_regex = ['^build-[0-9a-f]{8}$', '(unclosed']\n", 2},
+		{"invalid_extension", "[classes]\nimage = [\n    'jxl',\n    'x/y',\n]\n", 4},
+		{"invalid_tags_xattr", "home_only = true\ntags_xattr = 'tags'\n", 2},
+		{"invalid_deleted_max_age", "home_only = true\ndeleted_max_age = 'a day'\n", 2},
+		{"long_delete_grace", "home_only = true\ndelete_grace = '1h'\n", 2},
+		{"short_recent_window", "home_only = true\nrecent_window = '10s'\n", 2},
+		{"relative_cold_path", "home_only = true\ncold_paths = ['srv/mirror']\n", 2},
+		{"invalid_lazy_index_timeout", "lazy_index = true\nlazy_index_timeout = 'soon'\n", 2},
+		{"invalid_snapshot_reader_wait", "response_buffer = 0\nsnapshot_reader_wait = '-1s'\n", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := config
+			defer func() {
+				config = saved
+				filters.Store(nil)
+			}()
+
+			err := decodeConfig("config.toml", []byte(tt.content))
+			parseErr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("decodeConfig() error = %v, want *ParseError", err)
+			}
+			if parseErr.Line != tt.wantLine {
+				t.Errorf("decodeConfig() error line = %d, want %d (%v)",
+					parseErr.Line, tt.wantLine, err)
+			}
+		})
+	}
+}
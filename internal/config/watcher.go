@@ -0,0 +1,33 @@
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// validateWatcher checks watcher and poll_interval
+func (c *Config) validateWatcher() error {
+	switch c.Watcher {
+	case "auto", "fanotify", "inotify", "polling":
+	default:
+		return invalidValue(c.Watcher,
+			errors.Errorf("invalid watcher %q, expected auto, fanotify, inotify or polling",
+				c.Watcher))
+	}
+
+	interval, err := time.ParseDuration(c.PollInterval)
+	if err != nil || interval < time.Second {
+		return invalidValue(c.PollInterval,
+			errors.Errorf("invalid poll_interval %q, expected a duration of at least \"1s\"",
+				c.PollInterval))
+	}
+	c.pollInterval = interval
+	return nil
+}
+
+// Watcher returns the backend watching the filesystem
+// and the interval of the polling backend
+func Watcher() (string, time.Duration) {
+	return config.Watcher, config.pollInterval
+}
@@ -0,0 +1,240 @@
+package database
+
+import (
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/mounts"
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// Directories reachable at more than one path, like the sources of
+// bind mounts, are indexed at the first path they are found at, the
+// canonical one. The others are aliases: they are searchable, but the
+// entries below them are only indexed below the canonical directory.
+
+// aliasTable maps the aliases to their canonical directories. It is
+// changed by the goroutine of Start and read by queries, which may
+// run on snapshots, so it has its own lock.
+type aliasTable struct {
+	sync.RWMutex
+	canonical map[string]string
+}
+
+// add records that the directory at alias is the one at canonical
+func (t *aliasTable) add(alias, canonical string) {
+	t.Lock()
+	defer t.Unlock()
+	if t.canonical == nil {
+		t.canonical = make(map[string]string)
+	}
+	t.canonical[alias] = canonical
+}
+
+// reset forgets all aliases
+func (t *aliasTable) reset() {
+	t.Lock()
+	t.canonical = nil
+	t.Unlock()
+}
+
+// resolve returns the path of the entry at path below the canonical
+// directory, ok is false if path isn't an alias or below one
+func (t *aliasTable) resolve(path string) (resolved string, ok bool) {
+	t.RLock()
+	defer t.RUnlock()
+	for alias, canonical := range t.canonical {
+		if rest, ok := below(path, alias); ok {
+			return canonical + rest, true
+		}
+	}
+	return "", false
+}
+
+// canonicalRoot returns the path the entries below the request root
+// are indexed at, root itself unless it is at or below an alias, so
+// a search below an alias finds them
+func (db *Indexer) canonicalRoot(root string) string {
+	if resolved, ok := db.aliases.resolve(filepath.Clean(root)); ok {
+		return resolved
+	}
+	return root
+}
+
+// isAlias returns whether the directory at path is an alias
+func (t *aliasTable) isAlias(path string) bool {
+	t.RLock()
+	defer t.RUnlock()
+	_, ok := t.canonical[path]
+	return ok
+}
+
+// remove forgets the aliases at or below path, and those of the
+// canonical directories at or below it. It returns the latter.
+func (t *aliasTable) remove(path string) (orphaned []string) {
+	t.Lock()
+	defer t.Unlock()
+	for alias, canonical := range t.canonical {
+		if _, ok := below(alias, path); ok {
+			delete(t.canonical, alias)
+		} else if _, ok := below(canonical, path); ok {
+			delete(t.canonical, alias)
+			orphaned = append(orphaned, alias)
+		}
+	}
+	sort.Strings(orphaned)
+	return orphaned
+}
+
+// list returns a copy of the aliases and their canonical directories
+func (t *aliasTable) list() map[string]string {
+	t.RLock()
+	defer t.RUnlock()
+	if len(t.canonical) == 0 {
+		return nil
+	}
+	aliases := make(map[string]string, len(t.canonical))
+	for alias, canonical := range t.canonical {
+		aliases[alias] = canonical
+	}
+	return aliases
+}
+
+// expand returns the sorted results, each followed by its paths
+// below the aliases, marked by request.AliasLine
+func (t *aliasTable) expand(results resulter) resulter {
+	t.RLock()
+	defer t.RUnlock()
+	if len(t.canonical) == 0 {
+		return results
+	}
+	aliases := make([]string, 0, len(t.canonical))
+	for alias := range t.canonical {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	expanded := make(withAliases, 0, results.Len())
+	for i := 0; i < results.Len(); i++ {
+		path := results.Result(i)
+		expanded = append(expanded, path)
+		for _, alias := range aliases {
+			if rest, ok := below(path, t.canonical[alias]); ok {
+				expanded = append(expanded, request.AliasLine(alias+rest))
+			}
+		}
+	}
+	return expanded
+}
+
+// withAliases are results expanded by aliasTable.expand,
+// they are sorted already
+type withAliases []string
+
+func (w withAliases) Len() int           { return len(w) }
+func (w withAliases) Swap(i, j int)      { w[i], w[j] = w[j], w[i] }
+func (w withAliases) Less(i, j int) bool { return false }
+func (w withAliases) Result(index int) string {
+	return w[index]
+}
+
+// below returns the rest of path after dir, ok is false if path
+// isn't dir or below it
+func below(path, dir string) (rest string, ok bool) {
+	if path == dir {
+		return "", true
+	}
+	if dir == "/" {
+		return path, strings.HasPrefix(path, "/")
+	}
+	if strings.HasPrefix(path, dir+"/") {
+		return path[len(dir):], true
+	}
+	return "", false
+}
+
+// canonicalDirectory is called before the entries of the directory
+// at path are walked, dev is the device number of its parent, 0 if
+// it isn't known. It returns the device number of the directory and,
+// if it is an alias, the path of the canonical directory.
+func (db *Indexer) canonicalDirectory(path string, dev uint64) (uint64, string) {
+	// directories can only be reached at another path
+	// through a mount
+	mountPoint := mounts.IsMountPoint(path)
+	if mountPoint {
+		if source, ok := mounts.BindSource(path); ok && db.canBeCanonical(source, path) {
+			db.addAlias(path, source)
+			return dev, source
+		}
+	} else if dev != 0 && !db.fs.Shared(dev) {
+		return dev, ""
+	}
+
+	id, err := db.fs.Identify(path)
+	if err != nil {
+		// reading the directory fails too
+		return dev, ""
+	}
+	if !db.fs.Shared(id.dev) {
+		return id.dev, ""
+	}
+	// the directory seen before may have been removed since
+	if seen, ok := db.directoryIDs[id]; ok && seen != path && db.canBeCanonical(seen, path) {
+		_, indexErr := db.tree.GetChildren(seen)
+		if seenID, err := db.fs.Identify(seen); indexErr == nil && err == nil && seenID == id {
+			db.addAlias(path, seen)
+			return id.dev, seen
+		}
+	}
+	db.directoryIDs[id] = path
+	return id.dev, ""
+}
+
+// canBeCanonical returns whether the entries of the alias at path
+// are indexed below the directory at canonical, which may not have
+// been walked yet
+func (db *Indexer) canBeCanonical(canonical, path string) bool {
+	if _, ok := below(canonical, db.root); !ok {
+		return false
+	}
+	if _, ok := below(canonical, path); ok {
+		return false
+	}
+	return !config.IsPathFiltered(canonical)
+}
+
+func (db *Indexer) addAlias(path, canonical string) {
+	slog.Info("directory is reachable at another path, indexing its entries there only",
+		"path", path, "canonical", canonical)
+	db.aliases.add(path, canonical)
+}
+
+// checkAlias indexes the entries of the alias at path, if it isn't
+// the canonical directory anymore, e.g. because it was unmounted
+func (db *Indexer) checkAlias(path string) {
+	canonical, _ := db.aliases.resolve(path)
+	id, err := db.fs.Identify(path)
+	canonicalID, canonicalErr := db.fs.Identify(canonical)
+	if err == nil && canonicalErr == nil && id == canonicalID {
+		return
+	}
+	slog.Info("directory isn't reachable at another path anymore, indexing its entries",
+		"path", path, "canonical", canonical)
+	db.aliases.remove(path)
+	db.refreshDirectory(path)
+}
+
+// removeAliases forgets the aliases at or below the removed path,
+// the entries of those whose canonical directory was removed are
+// indexed below them instead
+func (db *Indexer) removeAliases(path string) {
+	for _, alias := range db.aliases.remove(path) {
+		slog.Info("canonical directory was removed, indexing the entries of its alias",
+			"path", alias, "canonical", path)
+		db.refreshDirectory(alias)
+	}
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestIndexWalk_Aliases(t *testing.T) {
+	tests := []struct {
+		name        string
+		binds       map[string]string
+		wantAliases map[string]string
+		want        []string
+	}{
+		{
+			name:        "bind_mount",
+			binds:       map[string]string{"/r/mnt": "/r/data"},
+			wantAliases: map[string]string{"/r/mnt": "/r/data"},
+			want: []string{"/r/", "/r/data/", "/r/data/a.txt", "/r/data/sub/", "/r/data/sub/b.txt",
+				"/r/mnt/"},
+		},
+		{
+			// the first path a directory is found at is canonical
+			name:        "bound_before_source",
+			binds:       map[string]string{"/r/data/sub/nested": "/r/mnt"},
+			wantAliases: map[string]string{"/r/mnt": "/r/data/sub/nested"},
+			want: []string{"/r/", "/r/data/", "/r/data/a.txt", "/r/data/sub/", "/r/data/sub/b.txt",
+				"/r/data/sub/nested/", "/r/data/sub/nested/c.txt", "/r/mnt/"},
+		},
+		{
+			// walking it below itself would never end
+			name:        "bound_below_itself",
+			binds:       map[string]string{"/r/data/sub/loop": "/r/data"},
+			wantAliases: map[string]string{"/r/data/sub/loop": "/r/data"},
+			want: []string{"/r/", "/r/data/", "/r/data/a.txt", "/r/data/sub/", "/r/data/sub/b.txt",
+				"/r/data/sub/loop/", "/r/mnt/", "/r/mnt/c.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newFakeFS("/r/data/a.txt", "/r/data/sub/b.txt", "/r/mnt/c.txt")
+			for target, source := range tt.binds {
+				// the bind mount hides the directory's own entries
+				if target == "/r/mnt" {
+					fs.remove(target)
+				}
+				fs.bind(target, source)
+			}
+			db := newFakeIndexer(fs, Options{})
+			if got := indexedPaths(t, db); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("indexed %q, want %q", got, tt.want)
+			}
+			if got := db.aliases.list(); !reflect.DeepEqual(got, tt.wantAliases) {
+				t.Errorf("aliases = %v, want %v", got, tt.wantAliases)
+			}
+		})
+	}
+}
+
+func TestAliases_Changes(t *testing.T) {
+	fs := newFakeFS("/r/data/a.txt")
+	fs.bind("/r/mnt", "/r/data")
+	db := newFakeIndexer(fs, Options{})
+
+	// changes seen at the alias are applied at the canonical path
+	fs.add("/r/data/b.txt")
+	db.refreshDirectory("/r/mnt")
+	want := []string{"/r/", "/r/data/", "/r/data/a.txt", "/r/data/b.txt", "/r/mnt/"}
+	if got := indexedPaths(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("after refreshing the alias: indexed %q, want %q", got, want)
+	}
+
+	lines := runRequest(db, request.Request{Query: "b.txt",
+		Settings: request.Settings{Action: request.SubStringSearch, Aliases: true}})
+	want = []string{"/r/data/b.txt", request.AliasLine("/r/mnt/b.txt")}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("results = %q, want %q", lines, want)
+	}
+
+	// the entries of an unmounted alias are its own
+	delete(fs.binds, "/r/mnt")
+	fs.add("/r/mnt/c.txt")
+	db.reconcile()
+	finishRescans(db)
+	want = []string{"/r/", "/r/data/", "/r/data/a.txt", "/r/data/b.txt", "/r/mnt/", "/r/mnt/c.txt"}
+	if got := indexedPaths(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("after unmounting: indexed %q, want %q", got, want)
+	}
+	if aliases := db.aliases.list(); len(aliases) != 0 {
+		t.Errorf("aliases = %v, want none", aliases)
+	}
+}
+
+func TestAliases_CanonicalRemoved(t *testing.T) {
+	fs := newFakeFS("/r/data/a.txt")
+	fs.bind("/r/mnt", "/r/data")
+	db := newFakeIndexer(fs, Options{})
+
+	// the bind mount keeps the directory alive
+	fs.add("/r/mnt/a.txt")
+	fs.binds = map[string]string{}
+	fs.remove("/r/data")
+	db.refreshDirectory("/r")
+	want := []string{"/r/", "/r/mnt/", "/r/mnt/a.txt"}
+	if got := indexedPaths(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("indexed %q, want %q", got, want)
+	}
+}
+
+func TestAliases_Root(t *testing.T) {
+	fs := newFakeFS("/r/data/a.txt", "/r/data/sub/b.txt")
+	fs.bind("/r/mnt", "/r/data")
+	db := newFakeIndexer(fs, Options{})
+
+	tests := []struct {
+		name     string
+		settings request.Settings
+		want     []string
+	}{
+		// a root below an alias is searched at the canonical path
+		{"alias", request.Settings{Parents: true, Root: "/r/mnt/sub"}, []string{"/r/data/sub"}},
+		{"canonical", request.Settings{Parents: true, Root: "/r/data/sub"}, []string{"/r/data/sub"}},
+		{"aliases", request.Settings{Parents: true, Root: "/r/mnt", Aliases: true},
+			[]string{"/r/data/sub", request.AliasLine("/r/mnt/sub"), "/r/data", request.AliasLine("/r/mnt")}},
+	}
+	for _, tt := range tests {
+		lines := runRequest(db, request.Request{Query: "txt", Settings: tt.settings})
+		if !reflect.DeepEqual(lines, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, lines, tt.want)
+		}
+	}
+}
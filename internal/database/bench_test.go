@@ -0,0 +1,251 @@
+package database
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/pkg/client"
+)
+
+// Run with e.g.
+//
+//	go test ./internal/database -run '^$' -bench . -index-sizes 100000,1000000
+//
+// The index is synthetic, neither root nor a real filesystem is needed.
+
+func BenchmarkQuery(b *testing.B) {
+	queries := []struct {
+		name   string
+		action int
+		query  string
+	}{
+		{"prefix", request.PrefixSearch, "re"},
+		{"substring", request.SubStringSearch, "port"},
+		{"substring_short", request.SubStringSearch, "po"},
+		{"fuzzy", request.FuzzySearch, "cnfg"},
+		{"path", request.PathSearch, "srcmain"},
+	}
+
+	for _, size := range benchmarkSizes(b) {
+		db := newSyntheticIndexer(size)
+		for _, q := range queries {
+			b.Run(fmt.Sprintf("%s/%s", sizeName(size), q.name), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					runQuery(db, q.action, q.query, 250)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkJump measures Jump requests answered directly and over the
+// socket, like a shell integration sends them on every cd
+func BenchmarkJump(b *testing.B) {
+	queries := []struct {
+		name  string
+		query string
+	}{
+		{"exact", "src"},
+		{"prefix", "conf"},
+	}
+
+	for _, size := range benchmarkSizes(b) {
+		db := newSyntheticIndexer(size)
+		for _, q := range queries {
+			b.Run(fmt.Sprintf("%s/%s", sizeName(size), q.name), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					runQuery(db, request.Jump, q.query, 10)
+				}
+			})
+		}
+
+		// queries run on the goroutine of the request, like
+		// they do with snapshots
+		requests := make(chan request.Request)
+		go func() {
+			for req := range requests {
+				go db.handleRequest(req)
+			}
+		}()
+		client.SocketPath = filepath.Join(b.TempDir(), "gosearch.sock")
+		l, err := request.ListenUnix(request.SocketOptions{Path: client.SocketPath})
+		if err != nil {
+			b.Fatal(err)
+		}
+		go request.Serve(l, requests, request.SocketOptions{})
+
+		for _, q := range queries {
+			b.Run(fmt.Sprintf("%s/%s_socket", sizeName(size), q.name), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					results, err := client.SearchRequest(q.query, client.Jump,
+						client.CaseInsensitive, client.MaxResults(10))
+					if err != nil {
+						b.Fatal(err)
+					}
+					for range results {
+					}
+				}
+			})
+		}
+		l.Close()
+		close(requests)
+	}
+}
+
+// newEntries returns n files that aren't in the synthetic index,
+// spread over its directories
+func newEntries(n int, directories []string) []syntheticEntry {
+	entries := make([]syntheticEntry, n)
+	for i := range entries {
+		name := fmt.Sprintf("new%d.txt", i)
+		entries[i] = syntheticEntry{
+			path: filepath.Join(directories[i%len(directories)], name),
+			name: name,
+		}
+	}
+	return entries
+}
+
+func BenchmarkIndexTrieAdd(b *testing.B) {
+	for _, size := range benchmarkSizes(b) {
+		db := newSyntheticIndexer(size)
+		directories := syntheticDirectories(size)
+		b.Run(sizeName(size), func(b *testing.B) {
+			entries := newEntries(b.N, directories)
+			files := make([]indexedFile, b.N)
+			for i, entry := range entries {
+				files[i] = indexedFile{db.tree.Add(entry.path), false}
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i, entry := range entries {
+				db.indexTrieAdd(entry.name, files[i])
+			}
+			b.StopTimer()
+
+			for _, entry := range entries {
+				db.removeFromIndex(filepath.Dir(entry.path), entry.name)
+			}
+		})
+	}
+}
+
+func BenchmarkIndexTrieDelete(b *testing.B) {
+	for _, size := range benchmarkSizes(b) {
+		db := newSyntheticIndexer(size)
+		directories := syntheticDirectories(size)
+		b.Run(sizeName(size), func(b *testing.B) {
+			entries := newEntries(b.N, directories)
+			for _, entry := range entries {
+				db.addEntry(entry.path, entry.name, false)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for _, entry := range entries {
+				db.indexTrieDelete(entry.name, filepath.Dir(entry.path))
+			}
+			b.StopTimer()
+
+			for _, entry := range entries {
+				db.tree.DeleteAt(entry.path)
+			}
+		})
+	}
+}
+
+// BenchmarkIndexTrieDelete_SameName deletes entries with a name that
+// 50k directories hold, like index.js in a tree of node_modules
+func BenchmarkIndexTrieDelete_SameName(b *testing.B) {
+	const directories = 50000
+	db := New(Options{Root: "/synthetic"})
+	paths := make([]string, directories)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("/synthetic/%d/index.js", i)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for _, path := range paths {
+			db.addEntry(path, "index.js", false)
+		}
+		b.StartTimer()
+		for _, path := range paths {
+			db.indexTrieDelete("index.js", filepath.Dir(path))
+		}
+	}
+}
+
+func BenchmarkDiffDirectory(b *testing.B) {
+	for _, children := range []int{10, 1000, 10000} {
+		b.Run(fmt.Sprint(children), func(b *testing.B) {
+			db := newSyntheticIndexer(children)
+
+			// one file was created and one deleted since the last refresh,
+			// all entries are direct children of the same directory
+			var names []string
+			for _, entry := range syntheticEntries(children) {
+				if filepath.Dir(entry.path) == "/synthetic" {
+					names = append(names, entry.name)
+				}
+			}
+			names[0] = "created.txt"
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				created, deleted := db.diffDirectory("/synthetic", names)
+				if len(created) != 1 || len(deleted) != 1 {
+					b.Fatalf("diff found %d created and %d deleted names",
+						len(created), len(deleted))
+				}
+			}
+		})
+	}
+}
+
+// walkSize is the number of files and directories created on disk
+// for BenchmarkInitialWalk, it doesn't follow -index-sizes to keep
+// the setup short
+const walkSize = 50000
+
+func BenchmarkInitialWalk(b *testing.B) {
+	root := b.TempDir()
+	for _, entry := range syntheticEntries(walkSize) {
+		path := filepath.Join(root, entry.path)
+		var err error
+		if entry.isDir {
+			err = os.MkdirAll(path, 0755)
+		} else if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			err = ioutil.WriteFile(path, nil, 0644)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	db := New(Options{Root: root})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		db.resetIndex()
+		runtime.GC()
+		b.StartTimer()
+
+		files, directories := db.addToIndexRecursively(root)
+		if files+directories < walkSize {
+			b.Fatalf("indexed %d paths, want at least %d", files+directories, walkSize)
+		}
+	}
+}
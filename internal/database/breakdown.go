@@ -0,0 +1,94 @@
+package database
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/pkg/tree"
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+// breakdownPart counts the entries at and below an entry of the
+// index, below counts those of the entries directly below it
+type breakdownPart struct {
+	Estimate
+	below map[*tree.Node]*breakdownPart
+}
+
+// breakdown returns the part of the index below each entry of the
+// root, down to levels of directories, the largest first. Memory is
+// estimated like EstimateIndex does, from the counts and names of the
+// searchable entries.
+func (db *Indexer) breakdown(levels int) []request.IndexBreakdown {
+	root, err := db.tree.Lookup(db.root)
+	if err != nil || levels <= 0 {
+		return nil
+	}
+	var total Estimate
+	parts := make(map[*tree.Node]*breakdownPart)
+	db.trie.Visit(func(prefix trie.Prefix, item trie.Item) error {
+		entriesOf(item).forEach(func(file indexedFile) bool {
+			// the entries directly below the root and below them
+			// the entry or its ancestor is at
+			var first, second *tree.Node
+			for node := file.pathNode; node != nil && node != root; node = node.Parent() {
+				if node.Parent() == root {
+					first = node
+					break
+				}
+				second = node
+			}
+			if first == nil {
+				return true
+			}
+			name := string(prefix)
+			total.count(name, file.isDir)
+			part := parts[first]
+			if part == nil {
+				part = &breakdownPart{Estimate: Estimate{Path: filepath.Join(db.root, first.Name())}}
+				parts[first] = part
+			}
+			part.count(name, file.isDir)
+			if levels < 2 || second == nil {
+				return true
+			}
+			if part.below == nil {
+				part.below = make(map[*tree.Node]*breakdownPart)
+			}
+			below := part.below[second]
+			if below == nil {
+				below = &breakdownPart{Estimate: Estimate{Path: filepath.Join(part.Path, second.Name())}}
+				part.below[second] = below
+			}
+			below.count(name, file.isDir)
+			return true
+		})
+		return nil
+	})
+	return breakdownOf(parts, total.Bytes)
+}
+
+// breakdownOf returns the parts, the largest first
+func breakdownOf(parts map[*tree.Node]*breakdownPart, total uint64) []request.IndexBreakdown {
+	breakdown := make([]request.IndexBreakdown, 0, len(parts))
+	for _, part := range parts {
+		b := request.IndexBreakdown{Path: part.Path, Files: part.Files,
+			Directories: part.Directories, NameBytes: part.NameBytes, Memory: part.Bytes,
+			Below: breakdownOf(part.below, total)}
+		if total > 0 {
+			b.Share = float64(part.Bytes) / float64(total)
+		}
+		if len(b.Below) == 0 {
+			b.Below = nil
+		}
+		breakdown = append(breakdown, b)
+	}
+	sort.Slice(breakdown, func(i, j int) bool {
+		if breakdown[i].Memory == breakdown[j].Memory {
+			return breakdown[i].Path < breakdown[j].Path
+		}
+		return breakdown[i].Memory > breakdown[j].Memory
+	})
+	return breakdown
+}
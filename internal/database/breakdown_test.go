@@ -0,0 +1,64 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestBreakdown(t *testing.T) {
+	fs := newFakeFS("/r/a/x/one", "/r/a/x/two", "/r/a/y/three", "/r/b/four", "/r/top")
+	db := newFakeIndexer(fs, Options{})
+
+	// summary drops the estimates, which follow from the counts
+	type summary struct {
+		path                        string
+		files, directories, nameLen uint64
+		below                       []summary
+	}
+	var summarize func(parts []request.IndexBreakdown) []summary
+	summarize = func(parts []request.IndexBreakdown) []summary {
+		var s []summary
+		for _, p := range parts {
+			s = append(s, summary{p.Path, p.Files, p.Directories, p.NameBytes, summarize(p.Below)})
+		}
+		return s
+	}
+
+	tests := []struct {
+		name   string
+		levels int
+		want   []summary
+	}{
+		{"none", 0, nil},
+		{"top", 1, []summary{
+			{"/r/a", 3, 3, 14, nil},
+			{"/r/b", 1, 1, 5, nil},
+			{"/r/top", 1, 0, 3, nil},
+		}},
+		{"second", 2, []summary{
+			{"/r/a", 3, 3, 14, []summary{
+				{"/r/a/x", 2, 1, 7, nil},
+				{"/r/a/y", 1, 1, 6, nil},
+			}},
+			{"/r/b", 1, 1, 5, []summary{
+				{"/r/b/four", 1, 0, 4, nil},
+			}},
+			{"/r/top", 1, 0, 3, nil},
+		}},
+	}
+	for _, tt := range tests {
+		breakdown := db.breakdown(tt.levels)
+		if got := summarize(breakdown); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+		var share float64
+		for _, p := range breakdown {
+			share += p.Share
+		}
+		if len(breakdown) > 0 && (share < 0.999 || share > 1.001) {
+			t.Errorf("%s: shares add up to %f", tt.name, share)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// queryCache holds the sorted results of the last searches, so the
+// same search made again, like by a shell completion, isn't run again.
+// The results are kept with the generation of the index they were
+// found in and only used for a copy of the same generation.
+type queryCache struct {
+	sync.Mutex
+	size int
+	// order holds the entries, the most recently used first
+	order   *list.List
+	entries map[string]*list.Element
+	hits    uint64
+	misses  uint64
+}
+
+// cachedQuery is an entry of a queryCache
+type cachedQuery struct {
+	key        string
+	generation uint64
+	// results are sorted, they aren't changed once cached
+	results resulter
+}
+
+func newQueryCache(size int) *queryCache {
+	return &queryCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// queryCacheKey returns the key of the results of req in a queryCache,
+// ok is false if they can't be cached. The settings applied to the
+// sorted results, like MaxResults, aren't part of it.
+func queryCacheKey(req request.Request) (key string, ok bool) {
+	s := req.Settings
+	switch s.Action {
+	case request.SubStringSearch, request.PrefixSearch, request.FuzzySearch,
+		request.PathSearch, request.SegmentSearch:
+	default:
+		return "", false
+	}
+	// those depend on the disk, not only the index
+	if s.SortBy == request.SortMtime || s.Sniff || s.IncludeFiltered != "" {
+		return "", false
+	}
+	s.MaxResults, s.Timing, s.NullDelimited, s.Backpressure = 0, false, false, ""
+	s.VerifyExists, s.CollapseHardlinks, s.Parents, s.Aliases = false, false, false, false
+	s.WaitIndex, s.UnlessGeneration, s.Scores = false, 0, false
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return "", false
+	}
+	return req.Query + "\x00" + string(encoded), true
+}
+
+// get returns the results cached for key in the index of generation
+func (c *queryCache) get(key string, generation uint64) (resulter, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.Lock()
+	defer c.Unlock()
+	element, ok := c.entries[key]
+	if !ok || element.Value.(*cachedQuery).generation != generation {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(element)
+	return element.Value.(*cachedQuery).results, true
+}
+
+// add caches the sorted results for key, the least recently used
+// entry is dropped if the cache is full
+func (c *queryCache) add(key string, generation uint64, results resulter) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	if element, ok := c.entries[key]; ok {
+		cached := element.Value.(*cachedQuery)
+		if cached.generation > generation {
+			// found in an older copy of the index
+			return
+		}
+		cached.generation, cached.results = generation, results
+		c.order.MoveToFront(element)
+		return
+	}
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedQuery).key)
+	}
+	c.entries[key] = c.order.PushFront(&cachedQuery{key, generation, results})
+}
+
+// stats returns the size of the cache and its hits and misses
+func (c *queryCache) stats() (size int, hits, misses uint64) {
+	if c == nil {
+		return 0, 0, 0
+	}
+	c.Lock()
+	defer c.Unlock()
+	return c.size, c.hits, c.misses
+}
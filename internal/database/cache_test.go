@@ -0,0 +1,81 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestQueryCache(t *testing.T) {
+	fs := newFakeFS("/r/a/report.txt", "/r/a/report-2019.txt", "/r/b/report.md")
+	db := newFakeIndexer(fs, Options{})
+	db.cache = newQueryCache(2)
+
+	tests := []struct {
+		name      string
+		req       request.Request
+		change    string
+		want      []string
+		hit, miss uint64
+	}{
+		{"first", request.Request{Query: "report"},
+			"", []string{"/r/a/report-2019.txt", "/r/a/report.txt", "/r/b/report.md"}, 0, 1},
+		{"again", request.Request{Query: "report"},
+			"", []string{"/r/a/report-2019.txt", "/r/a/report.txt", "/r/b/report.md"}, 1, 1},
+		// the limit is applied to the cached results
+		{"max_results", request.Request{Query: "report", Settings: request.Settings{MaxResults: 1}},
+			"", []string{"/r/b/report.md"}, 2, 1},
+		{"parents", request.Request{Query: "report", Settings: request.Settings{Parents: true}},
+			"", []string{"/r/a", "/r/b"}, 3, 1},
+		{"other_action", request.Request{Query: "report", Settings: request.Settings{Action: request.PrefixSearch}},
+			"", []string{"/r/a/report-2019.txt", "/r/a/report.txt", "/r/b/report.md"}, 3, 2},
+		// any change of the index drops the cached results
+		{"changed", request.Request{Query: "report"},
+			"/r/c/report", []string{"/r/a/report-2019.txt", "/r/a/report.txt", "/r/b/report.md", "/r/c/report"}, 3, 3},
+		{"mtime", request.Request{Query: "report", Settings: request.Settings{SortBy: request.SortMtime, MaxResults: 1}},
+			"", []string{"/r/c/report"}, 3, 3},
+	}
+	for _, tt := range tests {
+		if tt.change != "" {
+			fs.add(tt.change)
+			db.refreshDirectory("/r")
+		}
+		got := runRequest(db, tt.req)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if _, hits, misses := db.cache.stats(); hits != tt.hit || misses != tt.miss {
+			t.Errorf("%s: %d hits, %d misses, want %d, %d", tt.name, hits, misses, tt.hit, tt.miss)
+		}
+	}
+}
+
+func TestQueryCache_Evict(t *testing.T) {
+	c := newQueryCache(2)
+	c.add("a", 1, sortedResults{"/a"})
+	c.add("b", 1, sortedResults{"/b"})
+	c.get("a", 1)
+	c.add("c", 1, sortedResults{"/c"})
+	for _, tt := range []struct {
+		key  string
+		want bool
+	}{{"a", true}, {"b", false}, {"c", true}} {
+		if _, ok := c.get(tt.key, 1); ok != tt.want {
+			t.Errorf("get(%q) = %v, want %v", tt.key, ok, tt.want)
+		}
+	}
+	if _, ok := c.get("a", 2); ok {
+		t.Error("got the results of another generation")
+	}
+}
+
+func TestQueryCache_Disabled(t *testing.T) {
+	db := newFakeIndexer(newFakeFS("/r/a/report.txt"), Options{})
+	for i := 0; i < 2; i++ {
+		runRequest(db, request.Request{Query: "report"})
+	}
+	if size, hits, misses := db.cache.stats(); size != 0 || hits != 0 || misses != 0 {
+		t.Errorf("stats() = %d, %d, %d without a cache", size, hits, misses)
+	}
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+// changedSince returns the entries below the root of req that were
+// modified after its Since time, and the number of entries that
+// couldn't be stat'ed. The index doesn't keep modification times,
+// so every entry below the root is stat'ed.
+func (ix *index) changedSince(req request.Request, filter *entryFilter) (results byMtime, unreadable int) {
+	results = byMtime{}
+	since := req.Settings.Since * 1e9
+	root := strings.TrimSuffix(req.Settings.Root, "/") + "/"
+
+	ix.trie.Visit(func(prefix trie.Prefix, item trie.Item) error {
+		if isCancelled(req) {
+			return errCancelled
+		}
+		entriesOf(item).forEach(func(file indexedFile) bool {
+			if !filter.matches(file, 0) {
+				return true
+			}
+			path := file.pathNode.GetPath()
+			if root != "/" && !strings.HasPrefix(path, root) {
+				return true
+			}
+			info, err := lstat(path)
+			if err != nil {
+				if !os.IsNotExist(err) {
+					unreadable++
+				}
+				// vanished since it was indexed
+				return true
+			}
+			if mtime := info.ModTime().UnixNano(); mtime > since {
+				results = append(results, mtimeResult{path, mtime})
+			}
+			return true
+		})
+		return nil
+	})
+	return results, unreadable
+}
+
+// unreadableWarning returns the warning sent if entries
+// couldn't be stat'ed
+func unreadableWarning(unreadable int) request.Warning {
+	return request.Warning{Code: request.WarnUnreadable,
+		Message: fmt.Sprintf("couldn't stat %d entries", unreadable)}
+}
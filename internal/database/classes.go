@@ -0,0 +1,144 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/pkg/tree"
+)
+
+// maxSniffedFiles is the number of files without an extension a query
+// may read to find those of a class, none are read if there are more
+const maxSniffedFiles = 100
+
+// sniffSize is the part of a file read to find its type, the most
+// http.DetectContentType looks at
+const sniffSize = 512
+
+// entryFilter restricts the entries found by a query to a type, a file
+// class and a tag. Files without an extension are collected while
+// visiting the index and read afterwards if Sniff is set.
+type entryFilter struct {
+	typeFilter string
+	tag        string
+	// tagged are the entries with the tag, set once the index
+	// the query runs on is known
+	tagged map[*tree.Node]bool
+	// extensions are those of the class, nil without a class
+	extensions map[string]bool
+	// mimeTypes are the prefixes of the MIME types of the class
+	mimeTypes []string
+	sniff     bool
+	// unsniffed are the files to read, up to one more than
+	// maxSniffedFiles
+	unsniffed []sniffCandidate
+}
+
+// sniffCandidate is a file without an extension, skipped is its
+// score for fuzzy searches
+type sniffCandidate struct {
+	file    indexedFile
+	skipped int
+}
+
+// newEntryFilter returns the filter of the settings of a query,
+// an ErrorResponse if its class is unknown
+func newEntryFilter(settings request.Settings) (*entryFilter, *request.ErrorResponse) {
+	f := &entryFilter{typeFilter: settings.TypeFilter, tag: settings.Tag}
+	if settings.Class == "" {
+		return f, nil
+	}
+	extensions, mimeTypes, ok := config.Class(settings.Class)
+	if !ok {
+		return nil, &request.ErrorResponse{Code: request.ErrInvalidRequest,
+			Message: fmt.Sprintf("unknown class %q, expected one of %s",
+				settings.Class, strings.Join(config.Classes(), ", "))}
+	}
+	f.extensions = extensions
+	f.mimeTypes = mimeTypes
+	f.sniff = settings.Sniff && len(mimeTypes) > 0
+	return f, nil
+}
+
+// matches returns whether file passes the filter. Files without an
+// extension are collected for sniff instead.
+func (f *entryFilter) matches(file indexedFile, skipped int) bool {
+	if !file.matchesType(f.typeFilter) {
+		return false
+	}
+	if f.tag != "" && !f.tagged[file.pathNode] {
+		return false
+	}
+	if f.extensions == nil {
+		return true
+	}
+	if file.isDir {
+		return false
+	}
+	name := file.pathNode.Name()
+	i := strings.LastIndexByte(name, '.')
+	if i <= 0 {
+		if f.sniff && len(f.unsniffed) <= maxSniffedFiles {
+			f.unsniffed = append(f.unsniffed, sniffCandidate{file, skipped})
+		}
+		return false
+	}
+	return f.extensions[strings.ToLower(name[i+1:])]
+}
+
+// addSniffed reads the files collected by matches and appends those
+// of the class to results. notSniffed is set if there were too many
+// to read any.
+func (f *entryFilter) addSniffed(results resulter, req request.Request) (_ resulter, notSniffed bool) {
+	if len(f.unsniffed) > maxSniffedFiles {
+		return results, true
+	}
+	for _, c := range f.unsniffed {
+		if isCancelled(req) {
+			break
+		}
+		path := c.file.pathNode.GetPath()
+		if !f.sniffMatches(path) {
+			continue
+		}
+		switch r := results.(type) {
+		case byLength:
+			results = append(r, path)
+		case bySkipped:
+			results = append(r, sortResult{path, c.skipped})
+		}
+	}
+	return results, false
+}
+
+// sniffMatches returns whether the content of the file at path has
+// one of the MIME types of the class
+func (f *entryFilter) sniffMatches(path string) bool {
+	file, err := openFile(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	buf := make([]byte, sniffSize)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return false
+	}
+	mimeType := http.DetectContentType(buf[:n])
+	for _, prefix := range f.mimeTypes {
+		if strings.HasPrefix(mimeType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func notSniffedWarning() request.Warning {
+	return request.Warning{Code: request.WarnNotSniffed,
+		Message: fmt.Sprintf("found more than %d files without an extension, "+
+			"none were read to find those of the class", maxSniffedFiles)}
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestClassFilter(t *testing.T) {
+	root := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	files := map[string][]byte{
+		"photo.JPG": nil,
+		"photo.txt": nil,
+		"scan":      png,
+		"script":    []byte("#!/bin/sh\necho photo\n"),
+		".photo":    png,
+		"photos/":   nil,
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		var err error
+		if name[len(name)-1] == '/' {
+			err = os.Mkdir(path, 0755)
+		} else {
+			err = ioutil.WriteFile(path, content, 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	db := New(Options{Root: root})
+	db.addToIndexRecursively(root)
+
+	tests := []struct {
+		name     string
+		query    string
+		settings request.Settings
+		want     []string
+	}{
+		{"extension", "photo", request.Settings{Class: "image"}, []string{"photo.JPG"}},
+		{"document", "photo", request.Settings{Class: "document"}, []string{"photo.txt"}},
+		// hidden files without an extension are sniffed too
+		{"sniffed", "", request.Settings{Class: "image", Sniff: true, ListAll: true},
+			[]string{".photo", "photo.JPG", "scan"}},
+		{"fuzzy_sniffed", "scn", request.Settings{Action: request.FuzzySearch,
+			Class: "image", Sniff: true}, []string{"scan"}},
+		{"not_sniffed", "sc", request.Settings{Class: "image"}, nil},
+		{"unknown", "photo", request.Settings{Class: "spreadsheet"},
+			[]string{request.ErrorResponse{Code: request.ErrInvalidRequest}.Line(1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := runRequest(db, request.Request{Version: 1, Query: tt.query,
+				Settings: tt.settings})
+			var got []string
+			for _, line := range lines {
+				if e, ok := request.ParseError(line); ok {
+					got = append(got, request.ErrorResponse{Code: e.Code}.Line(1))
+					continue
+				}
+				got = append(got, filepath.Base(line))
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("class %s = %q, want %q", tt.settings.Class, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassFilter_TooManyToSniff(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i <= maxSniffedFiles; i++ {
+		path := filepath.Join(root, fmt.Sprintf("scan%d", i))
+		if err := ioutil.WriteFile(path, []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db := New(Options{Root: root})
+	db.addToIndexRecursively(root)
+
+	lines := runRequest(db, request.Request{Version: 1, Query: "scan",
+		Features: []string{request.FeatureWarnings},
+		Settings: request.Settings{Class: "image", Sniff: true}})
+	if len(lines) != 1 {
+		t.Fatalf("got %q, want a single warning", lines)
+	}
+	if w, ok := request.ParseWarning(lines[0]); !ok || w.Code != request.WarnNotSniffed {
+		t.Errorf("got %q, want a %s warning", lines[0], request.WarnNotSniffed)
+	}
+}
@@ -0,0 +1,446 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/pkg/tree"
+	"github.com/pkg/errors"
+)
+
+// ColdOptions configure the cold tier, which keeps the entries below
+// rarely searched directories on disk instead of in the index
+type ColdOptions struct {
+	// Paths are the directories whose entries are kept in the cold
+	// tier, the directories themselves stay in the index
+	Paths []string
+	// Directory is where the cold tier is stored
+	Directory string
+}
+
+// coldBlockEntries is the number of entries in a block of the cold
+// tier, the unit it is read in
+const coldBlockEntries = 256
+
+// coldBloomBits is the size of the bloom filter of the trigrams of
+// the names in a block, about 10 trigrams per name set 2 bits each,
+// which keeps the false positives of 3 trigrams at about 1%
+const coldBloomBits = 8192
+
+// coldEntry is an entry of the cold tier
+type coldEntry struct {
+	path  string
+	isDir bool
+}
+
+// coldBlock locates a block of the cold file and summarizes it
+type coldBlock struct {
+	// first is the path of its first entry, the blocks are sorted
+	// by them like the entries, which makes them a sparse index
+	first   string
+	offset  int64
+	size    int
+	entries int
+	// bloom holds the trigrams of the lowercased names
+	bloom [coldBloomBits / 64]uint64
+}
+
+// add sets the bits of trigram
+func (b *coldBlock) add(trigram uint32) {
+	for _, bit := range coldBloomHashes(trigram) {
+		b.bloom[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// mayContain returns false if none of the names of the block
+// contains trigram
+func (b *coldBlock) mayContain(trigram uint32) bool {
+	for _, bit := range coldBloomHashes(trigram) {
+		if b.bloom[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func coldBloomHashes(trigram uint32) [2]uint32 {
+	return [2]uint32{(trigram * 0x9e3779b1) >> 19 % coldBloomBits,
+		(trigram * 0x85ebca77) >> 19 % coldBloomBits}
+}
+
+// coldFile is a cold tier written to disk: the entries sorted by path,
+// each a type byte followed by the path and a NUL, in blocks of
+// coldBlockEntries. Only the blocks are kept in memory.
+type coldFile struct {
+	path    string
+	blocks  []coldBlock
+	entries uint64
+	size    int64
+	built   time.Time
+}
+
+// memory returns the number of bytes the blocks take in memory
+func (f *coldFile) memory() uint64 {
+	var size uint64
+	for _, b := range f.blocks {
+		size += uint64(len(b.first)) + uint64(len(b.bloom))*8 + 48
+	}
+	return size
+}
+
+// writeColdFile writes the sorted entries to a new file at path
+func writeColdFile(path string, entries []coldEntry, built time.Time) (*coldFile, error) {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't create the cold tier")
+	}
+	defer out.Close()
+
+	f := &coldFile{path: path, entries: uint64(len(entries)), built: built}
+	w := bufio.NewWriter(out)
+	for i, entry := range entries {
+		if i%coldBlockEntries == 0 {
+			f.blocks = append(f.blocks, coldBlock{first: entry.path, offset: f.size})
+		}
+		b := &f.blocks[len(f.blocks)-1]
+		kind := byte('f')
+		if entry.isDir {
+			kind = 'd'
+		}
+		w.WriteByte(kind)
+		w.WriteString(entry.path)
+		w.WriteByte(0)
+		size := len(entry.path) + 2
+		b.size += size
+		b.entries++
+		f.size += int64(size)
+		forEachTrigram(filepath.Base(entry.path), b.add)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, errors.Wrap(err, "couldn't write the cold tier")
+	}
+	return f, errors.Wrap(out.Close(), "couldn't write the cold tier")
+}
+
+// read returns the entries of the blocks from first up to last
+func (f *coldFile) read(in *os.File, first, last int) ([]coldEntry, error) {
+	if first >= last {
+		return nil, nil
+	}
+	offset := f.blocks[first].offset
+	end := f.blocks[last-1].offset + int64(f.blocks[last-1].size)
+	buf := make([]byte, end-offset)
+	if _, err := in.ReadAt(buf, offset); err != nil {
+		return nil, errors.Wrap(err, "couldn't read the cold tier")
+	}
+	entries := make([]coldEntry, 0, (last-first)*coldBlockEntries)
+	for len(buf) > 0 {
+		i := bytes.IndexByte(buf, 0)
+		if i < 1 {
+			return nil, errors.New("the cold tier is corrupt")
+		}
+		entries = append(entries, coldEntry{path: string(buf[1:i]), isDir: buf[0] == 'd'})
+		buf = buf[i+1:]
+	}
+	return entries, nil
+}
+
+// candidates returns the blocks holding names that may contain query,
+// all of them if it is too short for the trigrams or isn't valid UTF-8
+func (f *coldFile) candidates(query string) []int {
+	blocks := make([]int, 0, len(f.blocks))
+	trigrams := []uint32{}
+	if len(query) >= minTrigramQuery && utf8.ValidString(query) {
+		forEachTrigram(query, func(trigram uint32) { trigrams = append(trigrams, trigram) })
+	}
+next:
+	for i := range f.blocks {
+		for _, trigram := range trigrams {
+			if !f.blocks[i].mayContain(trigram) {
+				continue next
+			}
+		}
+		blocks = append(blocks, i)
+	}
+	return blocks
+}
+
+// below returns the range of blocks holding the entries below root
+func (f *coldFile) below(root string) (first, last int) {
+	prefix := strings.TrimSuffix(root, "/") + "/"
+	// the block before the first one starting after the prefix
+	// may hold the first entry below it
+	first = sort.Search(len(f.blocks), func(i int) bool { return f.blocks[i].first >= prefix })
+	if first > 0 {
+		first--
+	}
+	last = sort.Search(len(f.blocks), func(i int) bool {
+		return f.blocks[i].first > prefix && !strings.HasPrefix(f.blocks[i].first, prefix)
+	})
+	return first, last
+}
+
+// coldTier holds the current cold file. It is replaced by the
+// goroutine of Start and read by queries running on snapshots.
+type coldTier struct {
+	options ColdOptions
+
+	sync.Mutex
+	current    *coldFile
+	generation int
+}
+
+// isRoot returns whether path is a directory whose entries are
+// kept in the cold tier
+func (c *coldTier) isRoot(path string) bool {
+	for _, p := range c.options.Paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// covers returns whether the entries below path are in the cold tier
+func (c *coldTier) covers(path string) bool {
+	for _, p := range c.options.Paths {
+		if _, ok := below(path, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// open returns the current cold file, opened for reading, nil if
+// there is none. It is opened while holding the lock, so it isn't
+// removed before.
+func (c *coldTier) open() (*coldFile, *os.File, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.current == nil {
+		return nil, nil, nil
+	}
+	in, err := os.Open(c.current.path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "couldn't open the cold tier")
+	}
+	return c.current, in, nil
+}
+
+// replace makes f the current cold file and removes the previous one,
+// queries reading it keep their open file
+func (c *coldTier) replace(f *coldFile) {
+	c.Lock()
+	previous := c.current
+	c.current = f
+	c.Unlock()
+	if previous != nil {
+		os.Remove(previous.path)
+	}
+}
+
+// stats returns the number of entries in the cold tier, the bytes its
+// blocks take in memory, the size of its file and when it was read
+func (c *coldTier) stats() (entries, memory, size uint64, built time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	if c.current == nil {
+		return 0, 0, 0, time.Time{}
+	}
+	f := c.current
+	return f.entries, f.memory(), uint64(f.size), f.built
+}
+
+// coldAction collects the entries of a walk for the cold tier
+type coldAction struct {
+	entries *[]coldEntry
+}
+
+func (a coldAction) add(_ *tree.Node, path, _ string, isDir bool) *tree.Node {
+	*a.entries = append(*a.entries, coldEntry{path: path, isDir: isDir})
+	return nil
+}
+
+func (a coldAction) traverse(_ *tree.Node, _, _ string) *tree.Node { return nil }
+
+func (a coldAction) enter(_ *tree.Node, _ string, _ int) *tree.Node { return nil }
+
+// buildCold walks the cold paths and replaces the cold tier with their
+// entries. The walk applies the filters and depth limits like that of
+// the index, the entries are sorted in memory before they are written.
+func (db *Indexer) buildCold() {
+	if len(db.cold.options.Paths) == 0 {
+		return
+	}
+	start := time.Now()
+	var entries []coldEntry
+	for _, root := range db.cold.options.Paths {
+		if _, ok := below(root, db.root); !ok {
+			continue
+		}
+		w := indexWalk{fs: db.fs, action: coldAction{&entries}}
+		w.visitChildren(nil, root)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].path < entries[j].path })
+
+	db.cold.generation++
+	path := filepath.Join(db.cold.options.Directory, fmt.Sprintf("cold.%d", db.cold.generation))
+	f, err := writeColdFile(path, entries, start)
+	if err != nil {
+		slog.Error("couldn't build the cold tier", "err", err)
+		os.Remove(path)
+		return
+	}
+	db.cold.replace(f)
+	// those of earlier runs are left if the server was stopped
+	stale, _ := filepath.Glob(filepath.Join(db.cold.options.Directory, "cold.*"))
+	for _, p := range stale {
+		if p != path {
+			os.Remove(p)
+		}
+	}
+	slog.Info("built the cold tier", "entries", f.entries, "blocks", len(f.blocks),
+		"size", f.size, "duration", time.Since(start))
+}
+
+// coldBlockIndex returns an index of the entries of blocks
+func (db *Indexer) coldBlockIndex(entries []coldEntry) *index {
+	tmp := &Indexer{root: "/", fs: db.fs}
+	tmp.resetIndex()
+	for _, entry := range entries {
+		tmp.addEntry(entry.path, filepath.Base(entry.path), entry.isDir)
+	}
+	return tmp.currentIndex()
+}
+
+// coldRootIndex returns an index of the entries of the cold tier
+// below root, for requests with a root in a cold path, with a warning
+// to send with the results
+func (db *Indexer) coldRootIndex(root string) (*index, *request.Warning, *request.ErrorResponse) {
+	f, in, err := db.cold.open()
+	if err == nil && f == nil {
+		err = errors.New("it isn't read yet")
+	}
+	if err != nil {
+		return nil, nil, &request.ErrorResponse{Code: request.ErrNotIndexed,
+			Message: fmt.Sprintf("%s is in the cold tier: %v", root, err)}
+	}
+	defer in.Close()
+
+	first, last := f.below(root)
+	entries, err := f.read(in, first, last)
+	if err != nil {
+		return nil, nil, &request.ErrorResponse{Code: request.ErrNotIndexed,
+			Message: fmt.Sprintf("%s is in the cold tier: %v", root, err)}
+	}
+	kept := entries[:0]
+	for _, entry := range entries {
+		if _, ok := below(entry.path, root); ok && entry.path != root {
+			kept = append(kept, entry)
+		}
+	}
+	ix := db.coldBlockIndex(kept)
+	// the directories leading to root are in the tree
+	// of the temporary index, unless root is empty
+	ix.tree.Add(root)
+	return ix, coldWarning(len(kept), f.built), nil
+}
+
+// coldWarning is sent with the results of the cold tier
+func coldWarning(entries int, built time.Time) *request.Warning {
+	return &request.Warning{Code: request.WarnCold,
+		Message: fmt.Sprintf("%d entries are from the cold tier, read at %s, "+
+			"it misses the changes since", entries, built.Format(time.RFC3339))}
+}
+
+// consultsCold returns whether the cold tier is searched for req,
+// which found hot results in the index
+func (db *Indexer) consultsCold(req request.Request, hot int) bool {
+	if len(db.cold.options.Paths) == 0 {
+		return false
+	}
+	switch req.Settings.Action {
+	case request.SubStringSearch, request.PrefixSearch, request.FuzzySearch,
+		request.PathSearch, request.SegmentSearch:
+	default:
+		return false
+	}
+	return req.Settings.MaxResults == 0 || hot < req.Settings.MaxResults
+}
+
+// searchCold searches the blocks of the cold tier that may hold
+// matches of req, one at a time, and adds the matches to results
+func (db *Indexer) searchCold(results resulter, req request.Request, filter *entryFilter) (resulter, *request.Warning, error) {
+	f, in, err := db.cold.open()
+	if err != nil || f == nil {
+		return results, nil, err
+	}
+	defer in.Close()
+
+	// the names matching substring and prefix searches contain the
+	// query, those of the others don't
+	query := ""
+	if usesWildcards(req) {
+		query = parseWildcards(req).longest
+	} else if req.Settings.Action == request.SubStringSearch || req.Settings.Action == request.PrefixSearch {
+		query = req.Query
+	}
+	before := results.Len()
+	seen := make(map[string]bool)
+	for _, i := range f.candidates(query) {
+		if isCancelled(req) {
+			return results, nil, nil
+		}
+		entries, err := f.read(in, i, i+1)
+		if err != nil {
+			return results, nil, err
+		}
+		found, _ := db.search(db.coldBlockIndex(entries), req, filter)
+		results = db.mergeCold(results, found, seen)
+	}
+	if results.Len() == before {
+		return results, nil, nil
+	}
+	return results, coldWarning(results.Len()-before, f.built), nil
+}
+
+// mergeCold adds the results found in a block of the cold tier to
+// results. Only those below cold paths are, the directories leading to
+// them are in the index. The tree of a block has the directories
+// leading to its entries, seen drops those found in several blocks.
+func (db *Indexer) mergeCold(results, found resulter, seen map[string]bool) resulter {
+	keep := func(path string) bool {
+		if seen[path] || !db.cold.covers(path) || db.cold.isRoot(path) {
+			return false
+		}
+		seen[path] = true
+		return true
+	}
+	switch r := results.(type) {
+	case byLength:
+		for _, path := range found.(byLength) {
+			if keep(path) {
+				r = append(r, path)
+			}
+		}
+		return r
+	case bySkipped:
+		for _, s := range found.(bySkipped) {
+			if keep(s.result) {
+				r = append(r, s)
+			}
+		}
+		return r
+	}
+	return results
+}
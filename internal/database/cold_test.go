@@ -0,0 +1,143 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestColdFile(t *testing.T) {
+	// three blocks, the entries below /c/m span the first two
+	var entries []coldEntry
+	for i := 0; i < 2*coldBlockEntries+10; i++ {
+		entries = append(entries, coldEntry{path: fmt.Sprintf("/c/m/%04d", i)})
+	}
+	entries = append(entries, coldEntry{path: "/c/m-x"}, coldEntry{path: "/c/mail.txt"},
+		coldEntry{path: "/c/n/report.pdf"})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].path < entries[j].path })
+
+	f, err := writeColdFile(filepath.Join(t.TempDir(), "cold"), entries, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := os.Open(f.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if len(f.blocks) != 3 {
+		t.Fatalf("%d blocks, want 3", len(f.blocks))
+	}
+
+	tests := []struct {
+		root string
+		want int
+	}{
+		{"/c/m", 2*coldBlockEntries + 10},
+		{"/c/n", 1},
+		{"/c/o", 0},
+	}
+	for _, tt := range tests {
+		first, last := f.below(tt.root)
+		read, err := f.read(in, first, last)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := 0
+		for _, entry := range read {
+			if _, ok := below(entry.path, tt.root); ok {
+				got++
+			}
+		}
+		if got != tt.want {
+			t.Errorf("below(%q) holds %d entries below it, want %d", tt.root, got, tt.want)
+		}
+	}
+
+	if got := f.candidates("REPORT"); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("candidates(REPORT) = %v, want [2]", got)
+	}
+	if got := f.candidates("re"); len(got) != 3 {
+		t.Errorf("candidates(re) = %v, want all blocks", got)
+	}
+}
+
+func TestQueryIndex_Cold(t *testing.T) {
+	fs := newFakeFS("/r/docs/report.pdf", "/r/archive/2019/report.pdf",
+		"/r/archive/2019/notes.txt", "/r/archive/report/")
+	db := newFakeIndexer(fs, Options{Cold: ColdOptions{Paths: []string{"/r/archive"},
+		Directory: t.TempDir()}})
+	// changes below cold paths are picked up with the cold tier
+	fs.add("/r/archive/2019/report.txt")
+	db.refreshDirectory("/r/archive/2019")
+
+	if paths := indexedPaths(t, db); !reflect.DeepEqual(paths,
+		[]string{"/r/", "/r/archive/", "/r/docs/", "/r/docs/report.pdf"}) {
+		t.Errorf("the index holds %q", paths)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		settings request.Settings
+		want     []string
+	}{
+		{"substring", "report", request.Settings{Action: request.SubStringSearch}, []string{
+			"/r/archive/2019/report.pdf", "/r/docs/report.pdf", "/r/archive/report",
+			request.WarnCold}},
+		{"enough_hot", "report", request.Settings{Action: request.SubStringSearch, MaxResults: 1},
+			[]string{"/r/docs/report.pdf"}},
+		{"too_few_hot", "report", request.Settings{Action: request.SubStringSearch, MaxResults: 2},
+			[]string{"/r/docs/report.pdf", "/r/archive/report", request.WarnCold}},
+		{"prefix", "notes", request.Settings{Action: request.PrefixSearch},
+			[]string{"/r/archive/2019/notes.txt", request.WarnCold}},
+		{"fuzzy", "ntstxt", request.Settings{Action: request.FuzzySearch},
+			[]string{"/r/archive/2019/notes.txt", request.WarnCold}},
+		// the directories leading to the cold entries aren't sent again
+		{"path", "arch2019", request.Settings{Action: request.PathSearch}, []string{
+			"/r/archive/2019/report.pdf", "/r/archive/2019/notes.txt", "/r/archive/2019",
+			request.WarnCold}},
+		{"hot_only", "docs", request.Settings{Action: request.SubStringSearch},
+			[]string{"/r/docs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := runRequest(db, request.Request{Version: 1, Query: tt.query,
+				Features: []string{request.FeatureWarnings}, Settings: tt.settings})
+			var got []string
+			for _, line := range lines {
+				if w, ok := request.ParseWarning(line); ok {
+					line = w.Code
+				}
+				got = append(got, line)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	stats := db.currentStats()
+	if stats.ColdEntries != 4 || stats.ColdMemory == 0 || stats.ColdBuilt == 0 {
+		t.Errorf("stats show %d cold entries, %d bytes in memory, built at %d",
+			stats.ColdEntries, stats.ColdMemory, stats.ColdBuilt)
+	}
+
+	// the new entry is found once the cold tier is read again
+	db.reconcile()
+	finishRescans(db)
+	lines := runRequest(db, request.Request{Version: 1, Query: "report.txt",
+		Settings: request.Settings{Action: request.SubStringSearch}})
+	if !reflect.DeepEqual(lines, []string{"/r/archive/2019/report.txt"}) {
+		t.Errorf("after reconciling got %q", lines)
+	}
+	if files, _ := filepath.Glob(filepath.Join(db.cold.options.Directory, "cold.*")); len(files) != 1 {
+		t.Errorf("the cold tier left %q", files)
+	}
+}
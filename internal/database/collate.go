@@ -0,0 +1,87 @@
+package database
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// collator is a collate.Collator, which can't be used concurrently
+type collator struct {
+	sync.Mutex
+	c *collate.Collator
+}
+
+// collators are the collators built so far by language tag
+var collators struct {
+	sync.Mutex
+	byTag map[language.Tag]*collator
+}
+
+// parseLocale returns the language tag of a BCP 47 tag or a POSIX
+// locale like "de_DE.UTF-8@euro", "C" and "POSIX" are the root
+func parseLocale(locale string) (language.Tag, error) {
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	switch locale {
+	case "", "C", "POSIX":
+		return language.Und, nil
+	}
+	return language.Parse(strings.Replace(locale, "_", "-", -1))
+}
+
+// collatorFor returns the collator of locale, building it on first use
+func collatorFor(locale string) (*collator, *request.ErrorResponse) {
+	tag, err := parseLocale(locale)
+	if err != nil {
+		return nil, &request.ErrorResponse{Code: request.ErrInvalidRequest,
+			Message: "invalid locale " + locale + ": " + err.Error()}
+	}
+
+	collators.Lock()
+	defer collators.Unlock()
+	if c, ok := collators.byTag[tag]; ok {
+		return c, nil
+	}
+	if collators.byTag == nil {
+		collators.byTag = make(map[language.Tag]*collator)
+	}
+	c := &collator{c: collate.New(tag)}
+	collators.byTag[tag] = c
+	return c, nil
+}
+
+type collationResult struct {
+	result string
+	key    []byte
+}
+
+// byCollation sorts the results that come first in collation order
+// first, like shorter paths are sorted first by byLength
+type byCollation []collationResult
+
+func (c byCollation) Len() int           { return len(c) }
+func (c byCollation) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byCollation) Less(i, j int) bool { return bytes.Compare(c[i].key, c[j].key) < 0 }
+func (c byCollation) Result(index int) string {
+	return c[index].result
+}
+
+// withCollationKeys computes the collation keys of the results, once
+// each, as comparing strings with the collator is far slower
+func withCollationKeys(results resulter, c *collator) byCollation {
+	c.Lock()
+	defer c.Unlock()
+	var buf collate.Buffer
+	keyed := make(byCollation, results.Len())
+	for i := range keyed {
+		keyed[i].result = results.Result(i)
+		keyed[i].key = c.c.KeyFromString(&buf, keyed[i].result)
+	}
+	return keyed
+}
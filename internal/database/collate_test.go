@@ -0,0 +1,52 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestQueryIndex_Collate(t *testing.T) {
+	db := newFakeIndexer(newFakeFS("/r/Zebra.md", "/r/Ärger.md", "/r/Arger.md", "/r/apfel.md"), Options{})
+
+	// like the shortest paths otherwise, the first come last
+	tests := []struct {
+		name     string
+		settings request.Settings
+		want     []string
+	}{
+		{"root", request.Settings{},
+			[]string{"/r/Zebra.md", "/r/Ärger.md", "/r/Arger.md", "/r/apfel.md"}},
+		{"german", request.Settings{Locale: "de_DE.UTF-8"},
+			[]string{"/r/Zebra.md", "/r/Ärger.md", "/r/Arger.md", "/r/apfel.md"}},
+		// Ä is a letter of its own after Z in Swedish
+		{"swedish", request.Settings{Locale: "sv-SE"},
+			[]string{"/r/Ärger.md", "/r/Zebra.md", "/r/Arger.md", "/r/apfel.md"}},
+		{"posix", request.Settings{Locale: "C"},
+			[]string{"/r/Zebra.md", "/r/Ärger.md", "/r/Arger.md", "/r/apfel.md"}},
+		{"reversed", request.Settings{Locale: "de", ReverseSort: true},
+			[]string{"/r/apfel.md", "/r/Arger.md", "/r/Ärger.md", "/r/Zebra.md"}},
+		{"limited", request.Settings{Locale: "de", MaxResults: 2},
+			[]string{"/r/Arger.md", "/r/apfel.md"}},
+		{"invalid_locale", request.Settings{Locale: "not a locale"},
+			[]string{request.ErrInvalidRequest}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.settings.Action = request.SubStringSearch
+			tt.settings.SortBy = request.SortCollate
+			lines := runRequest(db, request.Request{Version: 1, Query: ".md", Settings: tt.settings})
+			var got []string
+			for _, line := range lines {
+				if e, ok := request.ParseError(line); ok {
+					line = e.Code
+				}
+				got = append(got, line)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("results = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
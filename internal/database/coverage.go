@@ -0,0 +1,148 @@
+package database
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/mounts"
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// the reasons the entries below a directory aren't indexed
+const (
+	reasonOutsideRoot = "outside the indexed directory"
+	reasonFiltered    = "filtered"
+	reasonFSType      = "on a filesystem of an excluded type"
+	reasonDepth       = "beyond the depth limit"
+)
+
+// lazyRoot is a directory whose entries were merged into the index by
+// a lazy walk
+type lazyRoot struct {
+	expires time.Time
+	// top is the topmost directory added to the tree for it, which
+	// is removed with everything below it once it expires, empty if
+	// the directory was in the tree and only its entries are removed
+	top string
+}
+
+// coverage describes which directories have their entries indexed:
+// those below the root, minus the filtered ones, those on filesystems
+// of excluded types and those beyond the depth limits, plus the ones
+// merged by lazy walks until they expire. The filters and limits are
+// looked up when checking, so changes of them apply at once.
+type coverage struct {
+	root string
+
+	// lazy is changed by the goroutine of Start
+	// and read by queries running on snapshots
+	sync.Mutex
+	lazy map[string]lazyRoot
+}
+
+// check returns why the entries below the directory at dir aren't
+// indexed, empty if they are. expires is set if they were merged by a
+// lazy walk.
+func (c *coverage) check(dir string, now time.Time) (reason string, expires time.Time) {
+	dir = filepath.Clean(dir)
+	if r, ok := c.lazyRootOf(dir, now); ok {
+		return "", r.expires
+	}
+	// the walk of the index stops at the first filtered directory,
+	// filters apply outside of the root as well
+	for path := dir; ; path = filepath.Dir(path) {
+		if config.FilterPath(path) == config.Excluded {
+			return reasonFiltered, time.Time{}
+		}
+		if path == c.root || path == "/" {
+			break
+		}
+	}
+	if _, ok := below(dir, c.root); !ok {
+		return reasonOutsideRoot + " " + c.root, time.Time{}
+	}
+
+	// the filesystem of dir is the one mounted last at the
+	// longest mount point leading to it
+	var mountPoint, fsType string
+	for _, m := range mounts.All() {
+		if _, ok := below(dir, m.MountPoint); ok && len(m.MountPoint) >= len(mountPoint) {
+			mountPoint, fsType = m.MountPoint, m.FSType
+		}
+	}
+	if _, ok := below(mountPoint, c.root); ok && config.HasFSTypeFilters() &&
+		config.IsFSTypeFiltered(fsType) {
+		return reasonFSType, time.Time{}
+	}
+
+	if remaining, limited := config.RemainingDepth(dir); limited && remaining <= 0 {
+		return reasonDepth, time.Time{}
+	}
+	return "", time.Time{}
+}
+
+// lazyRootOf returns the unexpired lazy root dir is at or below
+func (c *coverage) lazyRootOf(dir string, now time.Time) (lazyRoot, bool) {
+	c.Lock()
+	defer c.Unlock()
+	for path, r := range c.lazy {
+		if _, ok := below(dir, path); ok && now.Before(r.expires) {
+			return r, true
+		}
+	}
+	return lazyRoot{}, false
+}
+
+// addLazy records that the entries below path were merged
+func (c *coverage) addLazy(path string, r lazyRoot) {
+	c.Lock()
+	defer c.Unlock()
+	if c.lazy == nil {
+		c.lazy = make(map[string]lazyRoot)
+	}
+	c.lazy[path] = r
+}
+
+// removeLazy forgets the lazy roots at or below path that expired
+// before now, or all of them if now is zero, and returns them
+func (c *coverage) removeLazy(path string, now time.Time) map[string]lazyRoot {
+	c.Lock()
+	defer c.Unlock()
+	removed := make(map[string]lazyRoot)
+	for p, r := range c.lazy {
+		if _, ok := below(p, path); ok && (now.IsZero() || !now.Before(r.expires)) {
+			removed[p] = r
+			delete(c.lazy, p)
+		}
+	}
+	return removed
+}
+
+// expired returns whether a lazy root expired before now
+func (c *coverage) expired(now time.Time) bool {
+	c.Lock()
+	defer c.Unlock()
+	for _, r := range c.lazy {
+		if !now.Before(r.expires) {
+			return true
+		}
+	}
+	return false
+}
+
+// lazyDescriptions returns the unexpired lazy roots, sorted by path
+func (c *coverage) lazyDescriptions(now time.Time) []request.LazyDescription {
+	c.Lock()
+	defer c.Unlock()
+	var lazy []request.LazyDescription
+	for path, r := range c.lazy {
+		if now.Before(r.expires) {
+			lazy = append(lazy, request.LazyDescription{Path: path, Expires: r.expires.Unix()})
+		}
+	}
+	sort.Slice(lazy, func(i, j int) bool { return lazy[i].Path < lazy[j].Path })
+	return lazy
+}
@@ -0,0 +1,272 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// RecentOptions bound the recently created entries kept in memory
+// for Recent requests
+type RecentOptions struct {
+	// MaxEntries is the number of entries kept, the oldest minutes
+	// are dropped first, none are kept if it is 0
+	MaxEntries int
+	// Window is how long entries are kept
+	Window time.Duration
+}
+
+// recentBucketWidth is the time span of the entries in a bucket,
+// how precisely the oldest entries expire
+const recentBucketWidth = time.Minute
+
+// recentEntry is a created entry
+type recentEntry struct {
+	path    string
+	isDir   bool
+	created time.Time
+}
+
+// line returns the entry as sent to clients
+func (e recentEntry) line() string {
+	return e.created.Format(time.RFC3339) + "\t" + e.path
+}
+
+// recentBucket holds the entries created within recentBucketWidth
+// of start, in the order they were created
+type recentBucket struct {
+	start   time.Time
+	entries []recentEntry
+}
+
+// recentEntries holds the recently created entries in a ring of
+// buckets, one for each minute of Window. A bucket is emptied when
+// its slot is reused, or when the entries of the later ones don't fit
+// otherwise, so forgetting entries never visits those of more than a
+// bucket and the memory doesn't grow with the rate of changes.
+// Like tombstones, they are added by the goroutine of Start and read
+// by queries running on snapshots.
+type recentEntries struct {
+	options RecentOptions
+
+	sync.Mutex
+	buckets []recentBucket
+	// count is the number of entries in buckets, dropped the number
+	// of those that didn't fit in the bucket of their minute
+	count   int
+	dropped int
+	// since is when the oldest entry that was forgotten early was
+	// created, the entries before it are incomplete
+	since time.Time
+}
+
+// slot returns the bucket the entries created at t go in, emptying
+// it if it holds older ones
+func (r *recentEntries) slot(t time.Time) *recentBucket {
+	if r.buckets == nil {
+		n := int((r.options.Window + recentBucketWidth - 1) / recentBucketWidth)
+		if n < 1 {
+			n = 1
+		}
+		r.buckets = make([]recentBucket, n)
+	}
+	start := t.Truncate(recentBucketWidth)
+	b := &r.buckets[int(start.Unix()/int64(recentBucketWidth/time.Second))%len(r.buckets)]
+	if !b.start.Equal(start) {
+		r.count -= len(b.entries)
+		b.start, b.entries = start, b.entries[:0]
+	}
+	return b
+}
+
+// evictOldest empties the oldest bucket holding entries other than
+// current, it returns false if there is none
+func (r *recentEntries) evictOldest(current *recentBucket) bool {
+	var oldest *recentBucket
+	for i := range r.buckets {
+		b := &r.buckets[i]
+		if b != current && len(b.entries) > 0 && (oldest == nil || b.start.Before(oldest.start)) {
+			oldest = b
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	r.count -= len(oldest.entries)
+	if end := oldest.start.Add(recentBucketWidth); end.After(r.since) {
+		r.since = end
+	}
+	// the memory of a bucket that grew in a burst isn't kept
+	oldest.entries = nil
+	return true
+}
+
+// add records that the entry at path was created at now, forgetting
+// the oldest minutes if there are MaxEntries
+func (r *recentEntries) add(path string, isDir bool, now time.Time) {
+	r.Lock()
+	defer r.Unlock()
+	b := r.slot(now)
+	for r.count >= r.options.MaxEntries {
+		if !r.evictOldest(b) {
+			r.dropped++
+			if end := now.Truncate(recentBucketWidth).Add(recentBucketWidth); end.After(r.since) {
+				r.since = end
+			}
+			return
+		}
+	}
+	b.entries = append(b.entries, recentEntry{path: path, isDir: isDir, created: now})
+	r.count++
+}
+
+// list returns the entries created within the last within of now,
+// the newest first and each path once, and whether entries of that
+// time were forgotten or are older than Window
+func (r *recentEntries) list(now time.Time, within time.Duration) (list []recentEntry, incomplete bool) {
+	r.Lock()
+	defer r.Unlock()
+	after := now.Add(-within)
+	oldest := now.Add(-r.options.Window)
+	for _, b := range r.buckets {
+		if b.start.Add(recentBucketWidth).Before(after) || b.start.Add(recentBucketWidth).Before(oldest) {
+			continue
+		}
+		// the last added of entries created at the same time first
+		for i := len(b.entries) - 1; i >= 0; i-- {
+			if entry := b.entries[i]; !entry.created.Before(after) && !entry.created.Before(oldest) {
+				list = append(list, entry)
+			}
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].created.After(list[j].created) })
+
+	seen := make(map[string]bool, len(list))
+	unique := list[:0]
+	for _, entry := range list {
+		if !seen[entry.path] {
+			seen[entry.path] = true
+			unique = append(unique, entry)
+		}
+	}
+	return unique, after.Before(oldest) || after.Before(r.since)
+}
+
+// removeFiltered drops the entries whose paths are filtered now
+func (r *recentEntries) removeFiltered() {
+	r.Lock()
+	defer r.Unlock()
+	for i := range r.buckets {
+		b := &r.buckets[i]
+		kept := b.entries[:0]
+		for _, entry := range b.entries {
+			if config.FilterPath(entry.path) == config.Included {
+				kept = append(kept, entry)
+			}
+		}
+		r.count -= len(b.entries) - len(kept)
+		b.entries = kept
+	}
+}
+
+// occupancy returns the number of entries kept, the number that can
+// be kept and how many were dropped because a minute held them all
+func (r *recentEntries) occupancy() (entries, capacity, dropped int) {
+	r.Lock()
+	defer r.Unlock()
+	return r.count, r.options.MaxEntries, r.dropped
+}
+
+// recordCreated records the creation of the searchable entry at
+// path, filtered entries and replayed creations aren't recorded
+func (db *Indexer) recordCreated(path string, isDir bool, now time.Time) {
+	if db.recent.options.MaxEntries == 0 || db.snapshots.replaying {
+		return
+	}
+	if config.FilterPath(path) != config.Included {
+		return
+	}
+	db.recent.add(path, isDir, now)
+}
+
+// sendRecent sends the entries created within Settings.Within seconds
+// that are still indexed and whose names match the query like the
+// search action Settings.Match finds them, newest first unless
+// ReverseSort is set. The newest ones are kept if there are more than
+// MaxResults. An empty query matches every entry.
+func (db *Indexer) sendRecent(req request.Request) {
+	defer close(req.ResponseChannel)
+	defer queryDuration.With(actionLabel(req.Settings.Action)).ObserveSince(time.Now())
+
+	e := db.rejectQuery(req)
+	if e == nil && db.recent.options.MaxEntries == 0 {
+		e = &request.ErrorResponse{Code: request.ErrInvalidRequest,
+			Message: "recent entries aren't kept, set recent_max_entries in the config"}
+	}
+	if e != nil {
+		select {
+		case req.ResponseChannel <- e.Line(req.Version):
+		case <-req.Done:
+		}
+		return
+	}
+
+	ix, asOf := db.acquireIndex()
+	defer ix.release()
+
+	start := time.Now()
+	settings := req.Settings
+	within := time.Duration(settings.Within) * time.Second
+	list, incomplete := db.recent.list(start, within)
+	names := make([]string, len(list))
+	for i, entry := range list {
+		names[i] = filepath.Base(entry.path)
+	}
+	matched := matchNames(names, req.Query, settings)
+
+	var results []recentEntry
+	for i, entry := range list {
+		if !matched[i] || !(indexedFile{isDir: entry.isDir}).matchesType(settings.TypeFilter) {
+			continue
+		}
+		// entries deleted or moved away since aren't sent
+		if _, err := ix.tree.Lookup(entry.path); err != nil {
+			continue
+		}
+		results = append(results, entry)
+	}
+	matches := len(results)
+	if max := settings.MaxResults; max > 0 && len(results) > max {
+		results = results[:max]
+	}
+
+	for i := range results {
+		entry := results[i]
+		if settings.ReverseSort {
+			entry = results[len(results)-1-i]
+		}
+		select {
+		case req.ResponseChannel <- entry.line():
+		case <-req.Done:
+			return
+		}
+	}
+	duration := time.Since(start)
+	req.Logger().Debug("sent recent entries", "matches", matches, "duration", duration)
+	db.recordQuery(req, duration, len(results))
+	if incomplete {
+		sendWarning(req, recentIncompleteWarning(db.recent.options.Window))
+	}
+	sendStatus(req, matches, len(results), ix, asOf)
+}
+
+func recentIncompleteWarning(window time.Duration) request.Warning {
+	return request.Warning{Code: request.WarnRecentIncomplete,
+		Message: fmt.Sprintf("entries created more than %s ago or in bursts "+
+			"beyond recent_max_entries aren't kept, some may be missing", window)}
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestRecentEntries(t *testing.T) {
+	now := time.Unix(100000*60, 0)
+	// each entry is created the number of minutes before now
+	type created struct {
+		path    string
+		minutes int
+	}
+	tests := []struct {
+		name           string
+		options        RecentOptions
+		added          []created
+		within         time.Duration
+		want           []string
+		wantIncomplete bool
+		wantDropped    int
+	}{
+		{"newest_first", RecentOptions{MaxEntries: 10, Window: time.Hour},
+			[]created{{"/a", 5}, {"/b", 3}, {"/c", 0}}, 10 * time.Minute,
+			[]string{"/c", "/b", "/a"}, false, 0},
+		{"within", RecentOptions{MaxEntries: 10, Window: time.Hour},
+			[]created{{"/a", 5}, {"/b", 3}, {"/c", 0}}, 4 * time.Minute,
+			[]string{"/c", "/b"}, false, 0},
+		{"created_again", RecentOptions{MaxEntries: 10, Window: time.Hour},
+			[]created{{"/a", 5}, {"/b", 3}, {"/a", 1}}, 10 * time.Minute,
+			[]string{"/a", "/b"}, false, 0},
+		// the slot of the first entry is reused an hour later
+		{"expired", RecentOptions{MaxEntries: 10, Window: time.Hour},
+			[]created{{"/a", 60}, {"/b", 3}, {"/c", 0}}, 2 * time.Hour,
+			[]string{"/c", "/b"}, true, 0},
+		{"oldest_minute_evicted", RecentOptions{MaxEntries: 2, Window: time.Hour},
+			[]created{{"/a", 5}, {"/b", 3}, {"/c", 0}}, 4 * time.Minute,
+			[]string{"/c", "/b"}, false, 0},
+		{"evicted_within", RecentOptions{MaxEntries: 2, Window: time.Hour},
+			[]created{{"/a", 5}, {"/b", 3}, {"/c", 0}}, 10 * time.Minute,
+			[]string{"/c", "/b"}, true, 0},
+		{"burst_dropped", RecentOptions{MaxEntries: 2, Window: time.Hour},
+			[]created{{"/a", 0}, {"/b", 0}, {"/c", 0}}, 10 * time.Minute,
+			[]string{"/b", "/a"}, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := recentEntries{options: tt.options}
+			for i, c := range tt.added {
+				// entries of the same minute are a second apart
+				at := now.Add(-time.Duration(c.minutes)*time.Minute + time.Duration(i)*time.Second)
+				r.add(c.path, false, at)
+			}
+			list, incomplete := r.list(now.Add(time.Duration(len(tt.added))*time.Second), tt.within)
+			var got []string
+			for _, entry := range list {
+				got = append(got, entry.path)
+			}
+			if !reflect.DeepEqual(got, tt.want) || incomplete != tt.wantIncomplete {
+				t.Errorf("list() = %q, %v, want %q, %v", got, incomplete, tt.want, tt.wantIncomplete)
+			}
+			if entries, _, dropped := r.occupancy(); entries > tt.options.MaxEntries ||
+				dropped != tt.wantDropped {
+				t.Errorf("occupancy() = %d, %d dropped, want at most %d, %d dropped",
+					entries, dropped, tt.options.MaxEntries, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestRecent(t *testing.T) {
+	fs := newFakeFS("/r/docs/old.pdf", "/r/src/main.go")
+	db := newFakeIndexer(fs, Options{Recent: RecentOptions{MaxEntries: 10, Window: time.Hour}})
+
+	fs.add("/r/docs/notes/todo.md")
+	db.refreshDirectory("/r/docs")
+	fs.add("/r/docs/report.pdf")
+	db.refreshDirectory("/r/docs")
+	fs.add("/r/src/report.go")
+	fs.add("/r/src/gone.go")
+	db.refreshDirectory("/r/src")
+	// deleted entries aren't sent, filtered ones aren't kept
+	fs.remove("/r/src/gone.go")
+	db.refreshDirectory("/r/src")
+	addFilter(t, "/r/cache")
+	fs.add("/r/cache/report.tmp")
+	db.refreshDirectory("/r")
+
+	tests := []struct {
+		name     string
+		query    string
+		settings request.Settings
+		want     []string
+	}{
+		{"all", "", request.Settings{},
+			[]string{"/r/src/report.go", "/r/docs/report.pdf", "/r/docs/notes"}},
+		{"substring", "report", request.Settings{},
+			[]string{"/r/src/report.go", "/r/docs/report.pdf"}},
+		{"prefix", "rep", request.Settings{Match: request.PrefixSearch},
+			[]string{"/r/src/report.go", "/r/docs/report.pdf"}},
+		{"fuzzy", "rprtpdf", request.Settings{Match: request.FuzzySearch}, []string{"/r/docs/report.pdf"}},
+		{"directories", "", request.Settings{TypeFilter: request.TypeDirectory}, []string{"/r/docs/notes"}},
+		{"most_recent", "report", request.Settings{MaxResults: 1}, []string{"/r/src/report.go"}},
+		{"reversed", "report", request.Settings{ReverseSort: true},
+			[]string{"/r/docs/report.pdf", "/r/src/report.go"}},
+		{"deleted", "gone", request.Settings{}, nil},
+		{"filtered", "tmp", request.Settings{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.settings.Action = request.Recent
+			tt.settings.Within = 60
+			lines := runRequest(db, request.Request{Version: 1, Query: tt.query,
+				Settings: tt.settings})
+			var got []string
+			for _, line := range lines {
+				// the time is the first column
+				got = append(got, line[strings.IndexByte(line, '\t')+1:])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("recent = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	db = New(Options{Root: "/r"})
+	db.fs = fs
+	got := runRequest(db, request.Request{Settings: request.Settings{Action: request.Recent, Within: 60}})
+	if len(got) != 1 || !strings.Contains(got[0], "recent_max_entries") {
+		t.Errorf("recent without entries kept = %q, want an error", got)
+	}
+}
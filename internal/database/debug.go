@@ -0,0 +1,51 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"runtime/pprof"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// sendDebug writes a heap profile and sends the memory use of the server
+func (db *Indexer) sendDebug(req request.Request) {
+	defer close(req.ResponseChannel)
+
+	lines := []string{}
+	for _, stat := range db.memUsage() {
+		lines = append(lines, fmt.Sprintf("%s\t%d", stat.name, stat.value))
+	}
+
+	path := config.HeapProfilePath()
+	if err := writeHeapProfile(path); err != nil {
+		req.Logger().Error("couldn't write heap profile", "path", path, "err", err)
+		lines = append(lines, "error: couldn't write heap profile: "+err.Error())
+	} else {
+		req.Logger().Info("wrote heap profile", "path", path)
+		lines = append(lines, "heap profile written to "+path)
+	}
+
+	for _, line := range lines {
+		select {
+		case req.ResponseChannel <- line:
+		case <-req.Done:
+			return
+		}
+	}
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	// memUsage ran a garbage collection, so the profile is up to date
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
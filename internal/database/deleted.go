@@ -0,0 +1,208 @@
+package database
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/request"
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+// DeletedOptions bound the recently deleted entries kept in memory
+// for Deleted requests
+type DeletedOptions struct {
+	// MaxEntries is the number of entries kept, the oldest are
+	// replaced, none are kept if it is 0
+	MaxEntries int
+	// MaxAge is how long entries are kept, 0 means until they
+	// are replaced
+	MaxAge time.Duration
+}
+
+// tombstone is a deleted entry
+type tombstone struct {
+	path    string
+	isDir   bool
+	deleted time.Time
+}
+
+// line returns the entry as sent to clients
+func (t tombstone) line() string {
+	return t.deleted.Format(time.RFC3339) + "\t" + t.path
+}
+
+// tombstones holds the recently deleted entries in a ring. They are
+// added by the goroutine of Start and read by queries running on
+// snapshots, so they aren't part of the copies of the index.
+type tombstones struct {
+	options DeletedOptions
+
+	sync.Mutex
+	entries []tombstone
+	// next is the index of the oldest entry once entries is full
+	next int
+}
+
+// add records that the entry at path was deleted at now,
+// replacing the oldest entry if the ring is full
+func (t *tombstones) add(path string, isDir bool, now time.Time) {
+	t.Lock()
+	defer t.Unlock()
+	entry := tombstone{path: path, isDir: isDir, deleted: now}
+	if len(t.entries) < t.options.MaxEntries {
+		t.entries = append(t.entries, entry)
+		return
+	}
+	t.entries[t.next] = entry
+	t.next = (t.next + 1) % len(t.entries)
+}
+
+// list returns the entries deleted within MaxAge of now,
+// the oldest first
+func (t *tombstones) list(now time.Time) []tombstone {
+	t.Lock()
+	defer t.Unlock()
+	list := make([]tombstone, 0, len(t.entries))
+	for _, part := range [][]tombstone{t.entries[t.next:], t.entries[:t.next]} {
+		for _, entry := range part {
+			if t.options.MaxAge == 0 || now.Sub(entry.deleted) <= t.options.MaxAge {
+				list = append(list, entry)
+			}
+		}
+	}
+	return list
+}
+
+// removeFiltered drops the entries whose paths are filtered now
+func (t *tombstones) removeFiltered() {
+	t.Lock()
+	defer t.Unlock()
+	kept := make([]tombstone, 0, len(t.entries))
+	for _, part := range [][]tombstone{t.entries[t.next:], t.entries[:t.next]} {
+		for _, entry := range part {
+			if config.FilterPath(entry.path) == config.Included {
+				kept = append(kept, entry)
+			}
+		}
+	}
+	t.entries, t.next = kept, 0
+}
+
+// occupancy returns the number of entries deleted within MaxAge
+// of now and the number that can be kept
+func (t *tombstones) occupancy(now time.Time) (entries, capacity int) {
+	return len(t.list(now)), t.options.MaxEntries
+}
+
+// bury records the deletion of the searchable entry at path, filtered
+// entries, replayed deletions and those of a reindex aren't recorded
+func (db *Indexer) bury(path string, isDir bool, now time.Time) {
+	if db.deleted.options.MaxEntries == 0 || db.snapshots.replaying || db.rebuilding {
+		return
+	}
+	if config.FilterPath(path) != config.Included {
+		return
+	}
+	db.deleted.add(path, isDir, now)
+}
+
+// sendDeleted sends the recently deleted entries whose names match
+// the query like the search action Settings.Match finds them in the
+// index. The most recently deleted ones are kept if there are more
+// than MaxResults, they are sent oldest first unless ReverseSort is set.
+func (db *Indexer) sendDeleted(req request.Request) {
+	defer close(req.ResponseChannel)
+	defer queryDuration.With(actionLabel(req.Settings.Action)).ObserveSince(time.Now())
+
+	e := db.rejectQuery(req)
+	if e == nil && db.deleted.options.MaxEntries == 0 {
+		e = &request.ErrorResponse{Code: request.ErrInvalidRequest,
+			Message: "deleted entries aren't kept, set deleted_max_entries in the config"}
+	}
+	if e != nil {
+		select {
+		case req.ResponseChannel <- e.Line(req.Version):
+		case <-req.Done:
+		}
+		return
+	}
+
+	start := time.Now()
+	list := db.deleted.list(start)
+	names := make([]string, len(list))
+	for i, entry := range list {
+		names[i] = filepath.Base(entry.path)
+	}
+	settings := req.Settings
+	matched := matchNames(names, req.Query, settings)
+
+	var results []tombstone
+	for i, entry := range list {
+		if matched[i] && (indexedFile{isDir: entry.isDir}).matchesType(settings.TypeFilter) {
+			results = append(results, entry)
+		}
+	}
+	matches := len(results)
+	if max := settings.MaxResults; max > 0 && len(results) > max {
+		results = results[len(results)-max:]
+	}
+
+	for i := range results {
+		entry := results[i]
+		if settings.ReverseSort {
+			entry = results[len(results)-1-i]
+		}
+		select {
+		case req.ResponseChannel <- entry.line():
+		case <-req.Done:
+			return
+		}
+	}
+	duration := time.Since(start)
+	req.Logger().Debug("sent deleted entries", "matches", matches, "duration", duration)
+	db.recordQuery(req, duration, len(results))
+	sendStatus(req, matches, len(results), nil, time.Time{})
+}
+
+// matchNames returns which of names match query like the search
+// action settings.Match finds them in the index, all of them if
+// query is empty
+func matchNames(names []string, query string, settings request.Settings) []bool {
+	matched := make([]bool, len(names))
+	if query == "" {
+		for i := range matched {
+			matched[i] = true
+		}
+		return matched
+	}
+
+	// the names are matched like those of the index, by
+	// a trie of their own mapping them to their indices
+	t := trie.NewTrie()
+	for i, name := range names {
+		key := trie.Prefix(name)
+		if item := t.Get(key); item != nil {
+			t.Set(key, append(item.([]int), i))
+		} else {
+			t.Insert(key, []int{i})
+		}
+	}
+	visit := func(_ trie.Prefix, item trie.Item) error {
+		for _, i := range item.([]int) {
+			matched[i] = true
+		}
+		return nil
+	}
+	switch key := trie.Prefix(query); settings.Match {
+	case request.PrefixSearch:
+		t.VisitSubtree(key, visit)
+	case request.FuzzySearch:
+		t.VisitFuzzy(key, settings.CaseInsensitive,
+			func(name trie.Prefix, item trie.Item, _ int) error { return visit(name, item) })
+	default:
+		t.VisitSubstring(key, settings.CaseInsensitive, visit)
+	}
+	return matched
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestTombstones(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tests := []struct {
+		name    string
+		options DeletedOptions
+		added   []string
+		want    []string
+	}{
+		{"below_capacity", DeletedOptions{MaxEntries: 3}, []string{"/a", "/b"}, []string{"/a", "/b"}},
+		{"oldest_replaced", DeletedOptions{MaxEntries: 3},
+			[]string{"/a", "/b", "/c", "/d", "/e"}, []string{"/c", "/d", "/e"}},
+		// the entries are added a second apart, the last one now
+		{"too_old", DeletedOptions{MaxEntries: 3, MaxAge: time.Second},
+			[]string{"/a", "/b", "/c"}, []string{"/b", "/c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := tombstones{options: tt.options}
+			for i, path := range tt.added {
+				ts.add(path, false, now.Add(time.Duration(i-len(tt.added)+1)*time.Second))
+			}
+			var got []string
+			for _, entry := range ts.list(now) {
+				got = append(got, entry.path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("list() = %q, want %q", got, tt.want)
+			}
+			if entries, capacity := ts.occupancy(now); entries != len(tt.want) ||
+				capacity != tt.options.MaxEntries {
+				t.Errorf("occupancy() = %d, %d, want %d, %d", entries, capacity,
+					len(tt.want), tt.options.MaxEntries)
+			}
+		})
+	}
+}
+
+func TestDeleted(t *testing.T) {
+	fs := newFakeFS("/r/docs/report.pdf", "/r/docs/report.odt", "/r/docs/notes/todo.md",
+		"/r/cache/report.tmp", "/r/src/main.go")
+	db := newFakeIndexer(fs, Options{Deleted: DeletedOptions{MaxEntries: 10}})
+
+	fs.remove("/r/docs/report.pdf")
+	fs.remove("/r/docs/notes")
+	fs.remove("/r/cache/report.tmp")
+	db.refreshDirectory("/r/docs")
+	db.refreshDirectory("/r/cache")
+	// entries deleted after a filter matched them aren't kept
+	addFilter(t, "/r/src")
+	fs.remove("/r/src")
+	db.refreshDirectory("/r")
+
+	tests := []struct {
+		name     string
+		query    string
+		settings request.Settings
+		want     []string
+	}{
+		{"substring", "report", request.Settings{},
+			[]string{"/r/docs/report.pdf", "/r/cache/report.tmp"}},
+		{"prefix", "rep", request.Settings{Match: request.PrefixSearch},
+			[]string{"/r/docs/report.pdf", "/r/cache/report.tmp"}},
+		{"prefix_mismatch", "port", request.Settings{Match: request.PrefixSearch}, nil},
+		{"fuzzy", "rprtpdf", request.Settings{Match: request.FuzzySearch}, []string{"/r/docs/report.pdf"}},
+		{"below_deleted_directory", "todo", request.Settings{}, []string{"/r/docs/notes/todo.md"}},
+		{"directories", "", request.Settings{ListAll: true, TypeFilter: request.TypeDirectory},
+			[]string{"/r/docs/notes"}},
+		{"most_recent", "report", request.Settings{MaxResults: 1}, []string{"/r/cache/report.tmp"}},
+		{"filtered", "main", request.Settings{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.settings.Action = request.Deleted
+			lines := runRequest(db, request.Request{Version: 1, Query: tt.query,
+				Settings: tt.settings})
+			var got []string
+			for _, line := range lines {
+				// the time is the first column
+				got = append(got, line[strings.IndexByte(line, '\t')+1:])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("deleted = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	addFilter(t, "*.tmp")
+	db.deleted.removeFiltered()
+	got := runRequest(db, request.Request{Query: "report",
+		Settings: request.Settings{Action: request.Deleted}})
+	if len(got) != 1 || !strings.HasSuffix(got[0], "\t/r/docs/report.pdf") {
+		t.Errorf("deleted after adding a filter = %q, want only /r/docs/report.pdf", got)
+	}
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/internal/watch"
+)
+
+// describe returns what the index covers, and whether the entries
+// below path are indexed if it isn't empty
+func (db *Indexer) describe(path string) request.Description {
+	root := request.RootDescription{
+		Path:               db.root,
+		Indexing:           db.indexing,
+		Paused:             db.paused,
+		LastIndex:          unixTime(db.lastIndex),
+		LastReconciliation: unixTime(db.lastReconcile),
+		LastRefresh:        unixTime(db.lastReconciliation),
+		IndexedFiles:       db.lastIndexStats.IndexedFiles,
+		IndexedDirectories: db.lastIndexStats.IndexedDirectories,
+	}
+	d := request.Description{
+		Roots:   []request.RootDescription{root},
+		Watcher: watch.Backend(),
+	}
+
+	_, states := db.mountStates()
+	for _, s := range states {
+		d.Mounts = append(d.Mounts, s.description())
+	}
+
+	for _, f := range config.EffectiveFilters() {
+		d.Filters = append(d.Filters, request.FilterDescription{
+			Class:   f.Class,
+			Pattern: f.Pattern,
+			Default: f.Default,
+		})
+	}
+
+	now := time.Now()
+	d.Lazy = db.coverage.lazyDescriptions(now)
+	if path != "" {
+		reason, expires := db.coverage.check(path, now)
+		d.Coverage = &request.CoverageDescription{Path: path, Indexed: reason == "",
+			Reason: reason, Expires: unixTime(expires)}
+	}
+	return d
+}
+
+// unixTime returns t as Unix time, 0 if it is zero
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func (db *Indexer) sendDescription(req request.Request) {
+	defer close(req.ResponseChannel)
+
+	d := db.describe(req.Query)
+	if p, restricted := request.PeerPolicy(req.Peer); restricted {
+		d.Policy = &p
+	}
+	encoded, err := json.Marshal(d)
+	if err != nil {
+		req.Logger().Error("failed to encode description", "err", err)
+		return
+	}
+
+	select {
+	case req.ResponseChannel <- string(encoded):
+	case <-req.Done:
+	}
+}
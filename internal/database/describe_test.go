@@ -0,0 +1,43 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestDescribe(t *testing.T) {
+	addFilter(t, "*.bak")
+	db := newFakeIndexer(newFakeFS("/r/docs/a.md", "/r/docs/a.md.bak", "/r/src/"), Options{})
+
+	lines := runRequest(db, request.Request{Settings: request.Settings{Action: request.Describe}})
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1", len(lines))
+	}
+	var d request.Description
+	if err := json.Unmarshal([]byte(lines[0]), &d); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.Roots) != 1 {
+		t.Fatalf("roots = %+v, want one", d.Roots)
+	}
+	root := d.Roots[0]
+	if root.Path != "/r" || root.Indexing || root.LastIndex == 0 || root.LastReconciliation != 0 {
+		t.Errorf("root = %+v, want /r indexed once", root)
+	}
+	// the backup is filtered
+	if root.IndexedFiles != 1 || root.IndexedDirectories != 3 {
+		t.Errorf("indexed %d files and %d directories, want 1 and 3",
+			root.IndexedFiles, root.IndexedDirectories)
+	}
+
+	found := false
+	for _, f := range d.Filters {
+		found = found || (f == request.FilterDescription{Class: "glob", Pattern: "*.bak"})
+	}
+	if !found {
+		t.Errorf("filters = %+v, want the glob filter *.bak", d.Filters)
+	}
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/ozeidan/gosearch/pkg/tree"
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+// directoryNames holds the indexed directories by their lowercased
+// name, so Jump requests find them by a prefix of their name without
+// visiting the far more numerous files
+type directoryNames struct {
+	trie *trie.Trie
+}
+
+// directoryList is the item stored in the trie of directoryNames
+type directoryList struct {
+	nodes []*tree.Node
+}
+
+func newDirectoryNames() *directoryNames {
+	return &directoryNames{trie: trie.NewTrie()}
+}
+
+func (d *directoryNames) add(name string, node *tree.Node) {
+	key := trie.Prefix(strings.ToLower(name))
+	if item := d.trie.Get(key); item != nil {
+		list := item.(*directoryList)
+		list.nodes = append(list.nodes, node)
+		return
+	}
+	d.trie.Insert(key, &directoryList{nodes: []*tree.Node{node}})
+}
+
+func (d *directoryNames) remove(name string, node *tree.Node) {
+	key := trie.Prefix(strings.ToLower(name))
+	item := d.trie.Get(key)
+	if item == nil {
+		return
+	}
+	list := item.(*directoryList)
+	for i, n := range list.nodes {
+		if n == node {
+			last := len(list.nodes) - 1
+			list.nodes[i] = list.nodes[last]
+			list.nodes[last] = nil
+			list.nodes = list.nodes[:last]
+			break
+		}
+	}
+	if len(list.nodes) == 0 {
+		d.trie.Delete(key)
+	}
+}
+
+// visitPrefix calls visit with the directories whose lowercased name
+// starts with prefix, which has to be lowercase, until it returns false
+func (d *directoryNames) visitPrefix(prefix string, visit func(node *tree.Node) bool) {
+	d.trie.VisitSubtree(trie.Prefix(prefix), func(_ trie.Prefix, item trie.Item) error {
+		for _, node := range item.(*directoryList).nodes {
+			if !visit(node) {
+				return errCancelled
+			}
+		}
+		return nil
+	})
+}
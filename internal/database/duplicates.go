@@ -0,0 +1,151 @@
+package database
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+// duplicate is a name shared by several entries
+type duplicate struct {
+	name  string
+	paths []string
+}
+
+// byCount sorts duplicates by their number of paths, names with the
+// same number in reverse, so sort.Reverse lists the most common names
+// first and names with the same count in order
+type byCount []duplicate
+
+func (d byCount) Len() int      { return len(d) }
+func (d byCount) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d byCount) Less(i, j int) bool {
+	if len(d[i].paths) == len(d[j].paths) {
+		return d[i].name > d[j].name
+	}
+	return len(d[i].paths) < len(d[j].paths)
+}
+
+// findDuplicates sends the names shared by at least MinCount entries,
+// each followed by its paths. The trie already groups the entries by
+// name, so this visits every name once.
+func (db *Indexer) findDuplicates(req request.Request) {
+	defer close(req.ResponseChannel)
+	defer queryDuration.With(actionLabel(req.Settings.Action)).ObserveSince(time.Now())
+
+	pattern := req.Query
+	if req.Settings.CaseInsensitive {
+		pattern = strings.ToLower(pattern)
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		e := request.ErrorResponse{Code: request.ErrInvalidRequest,
+			Message: "invalid pattern " + req.Query}
+		select {
+		case req.ResponseChannel <- e.Line(req.Version):
+		case <-req.Done:
+		}
+		return
+	}
+
+	acquired, asOf := db.acquireIndex()
+	defer acquired.release()
+	ix, walked, e := db.rootIndex(acquired, req)
+	if e != nil {
+		select {
+		case req.ResponseChannel <- e.Line(req.Version):
+		case <-req.Done:
+		}
+		return
+	}
+	start := time.Now()
+	duplicates := ix.duplicates(req, pattern)
+	if isCancelled(req) {
+		return
+	}
+
+	if !req.Settings.NoSort {
+		if req.Settings.ReverseSort {
+			sort.Sort(duplicates)
+		} else {
+			sort.Sort(sort.Reverse(duplicates))
+		}
+	}
+
+	matches := len(duplicates)
+	if max := req.Settings.MaxResults; max > 0 && max < len(duplicates) {
+		duplicates = duplicates[:max]
+	}
+	for _, d := range duplicates {
+		for _, line := range append([]string{d.name}, d.paths...) {
+			select {
+			case req.ResponseChannel <- line:
+			case <-req.Done:
+				return
+			}
+		}
+	}
+	duration := time.Since(start)
+	req.Logger().Debug("found duplicates", "names", matches, "duration", duration)
+	db.recordQuery(req, duration, len(duplicates))
+	if walked != nil {
+		sendWarning(req, *walked)
+	}
+	sendStatus(req, matches, len(duplicates), acquired, asOf)
+}
+
+// duplicates returns the names matching pattern that are shared by
+// enough entries below the root of req
+func (ix *index) duplicates(req request.Request, pattern string) byCount {
+	minCount := req.Settings.MinCount
+	if minCount == 0 {
+		minCount = request.DefaultMinCount
+	}
+	root := strings.TrimSuffix(req.Settings.Root, "/") + "/"
+
+	var duplicates byCount
+	ix.trie.Visit(func(prefix trie.Prefix, item trie.Item) error {
+		if isCancelled(req) {
+			return errCancelled
+		}
+		list := entriesOf(item)
+		if list.len() < minCount {
+			return nil
+		}
+		name := string(prefix)
+		if pattern != "" && !matchesPattern(pattern, name, req.Settings.CaseInsensitive) {
+			return nil
+		}
+
+		var paths []string
+		list.forEach(func(file indexedFile) bool {
+			if !file.matchesType(req.Settings.TypeFilter) {
+				return true
+			}
+			path := file.pathNode.GetPath()
+			if root == "/" || strings.HasPrefix(path, root) {
+				paths = append(paths, path)
+			}
+			return true
+		})
+		if len(paths) >= minCount {
+			sort.Strings(paths)
+			duplicates = append(duplicates, duplicate{name, paths})
+		}
+		return nil
+	})
+	return duplicates
+}
+
+// matchesPattern returns whether name matches the glob pattern,
+// which is lower case if caseInsensitive is set
+func matchesPattern(pattern, name string, caseInsensitive bool) bool {
+	if caseInsensitive {
+		name = strings.ToLower(name)
+	}
+	matched, _ := filepath.Match(pattern, name)
+	return matched
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"path/filepath"
+
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+// entryIndexThreshold is the number of entries above which a list
+// indexes them by the paths of their parents. Names like index.js
+// have tens of thousands of entries, finding one to remove would
+// build the paths of all of them.
+const entryIndexThreshold = 64
+
+// entryList holds the entries with the same name, it is the only
+// type of item stored in the trie
+type entryList struct {
+	entries []indexedFile
+	// first backs entries while there is a single entry, which is
+	// the case for most names, so they take a single allocation
+	first [1]indexedFile
+	// byParent maps the paths of the parents of the entries to their
+	// positions, it is only kept above entryIndexThreshold entries
+	byParent map[string]int
+}
+
+func newEntryList(file indexedFile) *entryList {
+	list := &entryList{first: [1]indexedFile{file}}
+	list.entries = list.first[:]
+	return list
+}
+
+// entriesOf returns the entries of an item of the trie
+func entriesOf(item trie.Item) *entryList {
+	return item.(*entryList)
+}
+
+// len returns the number of entries
+func (l *entryList) len() int {
+	return len(l.entries)
+}
+
+// add adds an entry
+func (l *entryList) add(file indexedFile) {
+	l.entries = append(l.entries, file)
+	switch {
+	case l.byParent != nil:
+		l.indexEntry(len(l.entries) - 1)
+	case len(l.entries) > entryIndexThreshold:
+		l.byParent = make(map[string]int, len(l.entries))
+		for i := range l.entries {
+			l.indexEntry(i)
+		}
+	}
+}
+
+// indexEntry adds the entry at position i to byParent. The first of
+// entries with the same path, which shouldn't exist, is kept.
+func (l *entryList) indexEntry(i int) {
+	parent := parentPath(l.entries[i])
+	if _, ok := l.byParent[parent]; !ok {
+		l.byParent[parent] = i
+	}
+}
+
+// parentPath returns the path of the directory holding file
+func parentPath(file indexedFile) string {
+	return filepath.Dir(file.pathNode.GetPath())
+}
+
+// removeByPath removes the entry at path, it returns the entry
+// and whether there was one
+func (l *entryList) removeByPath(path string) (removed indexedFile, ok bool) {
+	i := -1
+	if l.byParent != nil {
+		if j, indexed := l.byParent[filepath.Dir(path)]; indexed &&
+			l.entries[j].pathNode.GetPath() == path {
+			i = j
+		}
+	} else {
+		for j, file := range l.entries {
+			if file.pathNode.GetPath() == path {
+				i = j
+				break
+			}
+		}
+	}
+	if i < 0 {
+		return indexedFile{}, false
+	}
+
+	removed = l.entries[i]
+	last := len(l.entries) - 1
+	l.entries[i] = l.entries[last]
+	l.entries[last] = indexedFile{}
+	l.entries = l.entries[:last]
+	if l.byParent == nil {
+		return removed, true
+	}
+	delete(l.byParent, filepath.Dir(path))
+	if i < last {
+		l.byParent[parentPath(l.entries[i])] = i
+	}
+	// dropping the index at half the threshold keeps lists
+	// around it from rebuilding it over and over
+	if len(l.entries) <= entryIndexThreshold/2 {
+		l.byParent = nil
+	}
+	return removed, true
+}
+
+// forEach calls fn with each entry until it returns false
+func (l *entryList) forEach(fn func(file indexedFile) bool) {
+	for _, file := range l.entries {
+		if !fn(file) {
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ozeidan/gosearch/pkg/tree"
+)
+
+func TestEntryList_RemoveByPath(t *testing.T) {
+	// lists above the threshold look entries up by their parents
+	var many []string
+	for i := 0; i <= entryIndexThreshold; i++ {
+		many = append(many, fmt.Sprintf("/%d/x", i))
+	}
+	last := len(many) - 1
+
+	tests := []struct {
+		name    string
+		paths   []string
+		remove  string
+		wantOK  bool
+		wantAll []string
+	}{
+		{"only", []string{"/a/x"}, "/a/x", true, nil},
+		{"first", []string{"/a/x", "/b/x", "/c/x"}, "/a/x", true, []string{"/c/x", "/b/x"}},
+		{"last", []string{"/a/x", "/b/x"}, "/b/x", true, []string{"/a/x"}},
+		{"missing", []string{"/a/x", "/b/x"}, "/c/x", false, []string{"/a/x", "/b/x"}},
+		{"indexed_first", many, many[0], true, append([]string{many[last]}, many[1:last]...)},
+		{"indexed_last", many, many[last], true, many[:last]},
+		{"indexed_missing", many, "/0/y", false, many},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := tree.New()
+			var list *entryList
+			for _, path := range tt.paths {
+				file := indexedFile{pathNode: root.Add(path)}
+				if list == nil {
+					list = newEntryList(file)
+				} else {
+					list.add(file)
+				}
+			}
+
+			removed, ok := list.removeByPath(tt.remove)
+			if ok != tt.wantOK || (ok && removed.pathNode.GetPath() != tt.remove) {
+				t.Errorf("removeByPath(%s) = %v, %v, want %v", tt.remove, removed, ok, tt.wantOK)
+			}
+			var got []string
+			list.forEach(func(file indexedFile) bool {
+				got = append(got, file.pathNode.GetPath())
+				return true
+			})
+			if !reflect.DeepEqual(got, tt.wantAll) || list.len() != len(tt.wantAll) {
+				t.Errorf("entries after removing = %q, want %q", got, tt.wantAll)
+			}
+		})
+	}
+}
+
+func TestEntryList_Index(t *testing.T) {
+	root := tree.New()
+	list := newEntryList(indexedFile{pathNode: root.Add("/0/x")})
+	for i := 1; i <= entryIndexThreshold; i++ {
+		list.add(indexedFile{pathNode: root.Add(fmt.Sprintf("/%d/x", i))})
+	}
+	if list.byParent == nil {
+		t.Fatalf("no index with %d entries", list.len())
+	}
+
+	// removing entries in any order keeps the positions right
+	for i := entryIndexThreshold; i >= 0; i -= 3 {
+		path := fmt.Sprintf("/%d/x", i)
+		if _, ok := list.removeByPath(path); !ok {
+			t.Fatalf("removeByPath(%s) found nothing", path)
+		}
+	}
+	if list.byParent == nil {
+		t.Fatalf("index dropped with %d entries", list.len())
+	}
+	for parent, i := range list.byParent {
+		if got := parentPath(list.entries[i]); got != parent {
+			t.Errorf("byParent[%s] = %d, holding an entry in %s", parent, i, got)
+		}
+	}
+	for i := 0; i <= entryIndexThreshold; i++ {
+		if (entryIndexThreshold-i)%3 == 0 {
+			continue
+		}
+		path := fmt.Sprintf("/%d/x", i)
+		if _, ok := list.removeByPath(path); !ok {
+			t.Errorf("removeByPath(%s) found nothing", path)
+		}
+	}
+	if list.len() != 0 || list.byParent != nil {
+		t.Errorf("%d entries left, index %v, want none", list.len(), list.byParent)
+	}
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ozeidan/gosearch/pkg/tree"
+	"github.com/pkg/errors"
+)
+
+// The heap memory an index takes per entry and per byte of the entry
+// names, measured by indexing synthetic entries. Names shorter than
+// those of most filesystems lead to a lower estimate, many entries
+// sharing a name to a higher one.
+const (
+	estimatedEntryBytes    = 180
+	estimatedNameByteBytes = 10
+)
+
+// Estimate is the projected size of the index of a directory
+type Estimate struct {
+	Path        string
+	Files       uint64
+	Directories uint64
+	// NameBytes is the length of all entry names
+	NameBytes uint64
+	// Bytes is the projected heap memory the index takes
+	Bytes uint64
+}
+
+func (e *Estimate) count(name string, isDir bool) {
+	if isDir {
+		e.Directories++
+	} else {
+		e.Files++
+	}
+	e.NameBytes += uint64(len(name))
+	e.Bytes = (e.Files+e.Directories)*estimatedEntryBytes +
+		e.NameBytes*estimatedNameByteBytes
+}
+
+// EstimateIndex walks the directory at root like the initial index,
+// applying the filters, without building the index. It returns the
+// projected size of the index and of each entry directly below root,
+// the largest first.
+func EstimateIndex(root string) (total Estimate, entries []Estimate, err error) {
+	root = filepath.Clean(root)
+	fs := newOSFS()
+	isDir, err := fs.Lstat(root)
+	if err != nil {
+		return Estimate{}, nil, errors.Wrap(err, "can't estimate the index")
+	}
+
+	action := &estimateAction{
+		total:   Estimate{Path: root},
+		entries: make(map[string]*Estimate),
+		prefix:  strings.TrimSuffix(root, "/") + "/",
+	}
+	w := indexWalk{fs: fs, action: action}
+	w.visit(nil, root, filepath.Base(root), isDir)
+
+	for _, e := range action.entries {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Bytes == entries[j].Bytes {
+			return entries[i].Path < entries[j].Path
+		}
+		return entries[i].Bytes > entries[j].Bytes
+	})
+	return action.total, entries, nil
+}
+
+// estimateAction counts the entries of a walk instead of adding them
+// to the index, by the entry directly below the root they are in
+type estimateAction struct {
+	total   Estimate
+	entries map[string]*Estimate
+	// prefix is the root with a trailing slash
+	prefix string
+}
+
+func (a *estimateAction) add(parent *tree.Node, path, name string, isDir bool) *tree.Node {
+	a.total.count(name, isDir)
+	if path == a.total.Path {
+		return nil
+	}
+	top := path
+	if i := strings.IndexByte(path[len(a.prefix):], '/'); i != -1 {
+		top = path[:len(a.prefix)+i]
+	}
+	e := a.entries[top]
+	if e == nil {
+		e = &Estimate{Path: top}
+		a.entries[top] = e
+	}
+	e.count(name, isDir)
+	return nil
+}
+
+func (a *estimateAction) traverse(parent *tree.Node, path, name string) *tree.Node {
+	return nil
+}
+
+func (a *estimateAction) enter(node *tree.Node, path string, entries int) *tree.Node {
+	return nil
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEstimateIndex(t *testing.T) {
+	root := t.TempDir()
+	for _, path := range []string{"src/main.go", "src/lib/util.go", "docs/a.md",
+		"node_modules/x/index.js", "README"} {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addFilter(t, "node_modules")
+
+	total, entries, err := EstimateIndex(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	estimate := func(path string, files, directories, nameBytes uint64) Estimate {
+		return Estimate{Path: path, Files: files, Directories: directories,
+			NameBytes: nameBytes,
+			Bytes: (files+directories)*estimatedEntryBytes +
+				nameBytes*estimatedNameByteBytes}
+	}
+	want := []Estimate{
+		estimate(filepath.Join(root, "src"), 2, 2, 20),
+		estimate(filepath.Join(root, "docs"), 1, 1, 8),
+		estimate(filepath.Join(root, "README"), 1, 0, 6),
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("EstimateIndex() entries = %+v, want %+v", entries, want)
+	}
+	wantTotal := estimate(root, 4, 4, 34+uint64(len(filepath.Base(root))))
+	if total != wantTotal {
+		t.Errorf("EstimateIndex() total = %+v, want %+v", total, wantTotal)
+	}
+	if _, _, err := EstimateIndex(filepath.Join(root, "missing")); err == nil {
+		t.Error("EstimateIndex() of a missing directory succeeded")
+	}
+}
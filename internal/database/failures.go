@@ -0,0 +1,137 @@
+package database
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// failureRetryInterval is how often the directories that couldn't
+// be read are read again
+const failureRetryInterval = 5 * time.Minute
+
+// maxDeniedAttempts is how often a directory is read while permission
+// is denied, afterwards it is only read again on request or once the
+// filters changed
+const maxDeniedAttempts = 3
+
+// failure is a directory that couldn't be read, so the entries
+// below it are missing from the index
+type failure struct {
+	err      error
+	attempts int
+	// suppressed is set once permission was denied too often
+	suppressed bool
+}
+
+// directoryRead records whether the directory at path could be read
+func (db *Indexer) directoryRead(path string, err error) {
+	if err == nil {
+		if len(db.failures) > 0 {
+			delete(db.failures, path)
+		}
+		return
+	}
+	if os.IsNotExist(err) {
+		// the directory is gone, which its parent reports
+		delete(db.failures, path)
+		slog.Warn("couldn't read directory", "path", path, "err", err)
+		return
+	}
+
+	f := db.failures[path]
+	if f == nil {
+		f = &failure{}
+		db.failures[path] = f
+		slog.Warn("couldn't read directory, retrying later", "path", path, "err", err)
+	} else {
+		slog.Debug("couldn't read directory again", "path", path, "err", err,
+			"attempts", f.attempts+1)
+	}
+	f.err = err
+	f.attempts++
+	if os.IsPermission(err) && f.attempts >= maxDeniedAttempts && !f.suppressed {
+		f.suppressed = true
+		slog.Warn("permission denied repeatedly, not retrying until the filters change",
+			"path", path, "attempts", f.attempts)
+	}
+}
+
+// failedPaths returns the paths of the failures in order
+func (db *Indexer) failedPaths() []string {
+	paths := make([]string, 0, len(db.failures))
+	for path := range db.failures {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// retryFailures reads the directories that couldn't be read again,
+// the suppressed ones only if all is set. It returns the number of
+// directories read.
+func (db *Indexer) retryFailures(all bool) int {
+	retried := 0
+	for _, path := range db.failedPaths() {
+		f := db.failures[path]
+		if f == nil || (f.suppressed && !all) {
+			// retrying a directory above it succeeded
+			continue
+		}
+		if _, err := db.tree.GetChildren(path); err != nil || config.IsPathFiltered(path) {
+			// not indexed anymore
+			delete(db.failures, path)
+			continue
+		}
+		retried++
+		db.refreshDirectory(path)
+	}
+	return retried
+}
+
+// unsuppressFailures lets the directories permission was denied to
+// be retried, after the filters changed
+func (db *Indexer) unsuppressFailures() {
+	for _, f := range db.failures {
+		f.suppressed = false
+		f.attempts = 0
+	}
+}
+
+// sendFailures sends the directories that couldn't be read with
+// their last error, one per line
+func (db *Indexer) sendFailures(req request.Request) {
+	defer close(req.ResponseChannel)
+
+	for _, path := range db.failedPaths() {
+		f := db.failures[path]
+		line := fmt.Sprintf("%s\t%v (%d attempts", path, f.err, f.attempts)
+		if f.suppressed {
+			line += ", not retried"
+		}
+		line += ")"
+		select {
+		case req.ResponseChannel <- line:
+		case <-req.Done:
+			return
+		}
+	}
+}
+
+// retryFailuresNow reads all directories that couldn't be read again
+func (db *Indexer) retryFailuresNow(req request.Request) {
+	defer close(req.ResponseChannel)
+
+	retried := db.retryFailures(true)
+	reply := fmt.Sprintf("retried %d directories, %d still fail", retried, len(db.failures))
+	req.Logger().Info(reply)
+	select {
+	case req.ResponseChannel <- reply:
+	case <-req.Done:
+	}
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestRetryFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		// retries is the number of periodic retries while reading
+		// fails, then reading succeeds and it's retried once more
+		retries int
+		// all retries the suppressed failures too
+		all            bool
+		wantSuppressed bool
+		wantIndexed    bool
+	}{
+		{"transient", syscall.EIO, 4, false, false, true},
+		{"denied_once", syscall.EACCES, 1, false, false, true},
+		{"denied_suppressed", syscall.EACCES, 2, false, true, false},
+		{"denied_retried_on_request", syscall.EACCES, 2, true, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newFakeFS("/r/docs/a.md", "/r/private/secret.txt")
+			fs.readErrs["/r/private"] = tt.err
+			db := newFakeIndexer(fs, Options{})
+			for i := 0; i < tt.retries; i++ {
+				db.retryFailures(false)
+			}
+			f := db.failures["/r/private"]
+			if f == nil {
+				t.Fatal("the failure wasn't recorded")
+			}
+			if f.attempts != tt.retries+1 || f.suppressed != tt.wantSuppressed {
+				t.Errorf("attempts, suppressed = %d, %v, want %d, %v",
+					f.attempts, f.suppressed, tt.retries+1, tt.wantSuppressed)
+			}
+
+			delete(fs.readErrs, "/r/private")
+			db.retryFailures(tt.all)
+			indexed := false
+			for _, path := range indexedPaths(t, db) {
+				indexed = indexed || path == "/r/private/secret.txt"
+			}
+			if indexed != tt.wantIndexed {
+				t.Errorf("indexed = %v, want %v", indexed, tt.wantIndexed)
+			}
+			if _, failed := db.failures["/r/private"]; failed == tt.wantIndexed {
+				t.Errorf("still failed = %v, want %v", failed, !tt.wantIndexed)
+			}
+		})
+	}
+}
+
+func TestRetryFailures_Removed(t *testing.T) {
+	fs := newFakeFS("/r/private/secret.txt", "/r/tmp/cache/")
+	fs.readErrs["/r/private"] = syscall.EIO
+	fs.readErrs["/r/tmp/cache"] = syscall.EIO
+	db := newFakeIndexer(fs, Options{})
+
+	// the failures of directories that were deleted or
+	// filtered are forgotten without reading them
+	fs.remove("/r/private")
+	db.refreshDirectory("/r")
+	addFilter(t, "/r/tmp")
+	db.removeFilteredEntries("/r")
+	if retried := db.retryFailures(true); retried != 0 || len(db.failures) != 0 {
+		t.Errorf("retried %d, failures = %v, want none", retried, db.failures)
+	}
+}
+
+func TestFailuresRequest(t *testing.T) {
+	fs := newFakeFS("/r/a/", "/r/b/", "/r/c/")
+	fs.readErrs["/r/a"] = syscall.EIO
+	fs.readErrs["/r/b"] = syscall.EACCES
+	db := newFakeIndexer(fs, Options{})
+	db.retryFailures(false)
+	db.retryFailures(false)
+
+	got := runRequest(db, request.Request{Settings: request.Settings{Action: request.Failures}})
+	want := []string{
+		"/r/a\topen /r/a: input/output error (3 attempts)",
+		"/r/b\topen /r/b: permission denied (3 attempts, not retried)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("failures = %q, want %q", got, want)
+	}
+
+	delete(fs.readErrs, "/r/b")
+	got = runRequest(db, request.Request{Settings: request.Settings{Action: request.RetryFailures}})
+	if want := "retried 2 directories, 1 still fail"; len(got) != 1 || got[0] != want {
+		t.Errorf("retry = %q, want %q", got, want)
+	}
+
+	stats := db.currentStats()
+	if stats.FailedDirectories != 1 || stats.SuppressedFailures != 0 {
+		t.Errorf("stats failed, suppressed = %d, %d, want 1, 0",
+			stats.FailedDirectories, stats.SuppressedFailures)
+	}
+	if !strings.Contains(runRequest(db, request.Request{
+		Settings: request.Settings{Action: request.Failures}})[0], "/r/a\t") {
+		t.Error("the remaining failure isn't listed")
+	}
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// filteredIndex walks the filtered directory of
+// Settings.IncludeFiltered into a temporary index, within the bounds of
+// the lazy walks, with a warning to send with the results
+func (db *Indexer) filteredIndex(req request.Request) (*index, *request.Warning, *request.ErrorResponse) {
+	root := filepath.Clean(req.Settings.IncludeFiltered)
+	if db.lazy.MaxEntries == 0 {
+		return nil, nil, &request.ErrorResponse{Code: request.ErrInvalidRequest,
+			Message: "walking filtered directories needs lazy_index"}
+	}
+	if reason, _ := db.coverage.check(root, time.Now()); reason != reasonFiltered {
+		return nil, nil, &request.ErrorResponse{Code: request.ErrInvalidRequest,
+			Message: root + " isn't filtered"}
+	}
+
+	walked, entries, complete, err := db.walkLazily(root, req, true)
+	if err != nil {
+		return nil, nil, &request.ErrorResponse{Code: request.ErrNotIndexed,
+			Message: fmt.Sprintf("%s is filtered and couldn't be walked: %v", root, err)}
+	}
+	req.Logger().Debug("walked filtered directory", "root", root,
+		"entries", entries, "complete", complete)
+	w := &request.Warning{Code: request.WarnWalked,
+		Message: fmt.Sprintf("%s is filtered, walked its %d entries", root, entries)}
+	if !complete {
+		w = &request.Warning{Code: request.WarnWalkIncomplete,
+			Message: fmt.Sprintf("%s is filtered, stopped walking it after %d entries", root, entries)}
+	}
+	return walked, w, nil
+}
+
+// mergeFiltered adds the results found in the walk of the filtered
+// directory root to the results from the index. Those of the walk
+// are of the same type, the directories leading to root are dropped.
+func mergeFiltered(results, walked resulter, root string) resulter {
+	root = filepath.Clean(root)
+	switch r := results.(type) {
+	case byLength:
+		for _, path := range walked.(byLength) {
+			if _, ok := below(path, root); ok {
+				r = append(r, path)
+			}
+		}
+		return r
+	case bySkipped:
+		for _, s := range walked.(bySkipped) {
+			if _, ok := below(s.result, root); ok {
+				r = append(r, s)
+			}
+		}
+		return r
+	}
+	return results
+}
+
+// markFiltered marks the sorted results below the filtered
+// directory root as FilteredLine
+func markFiltered(results resulter, root string) resulter {
+	root = filepath.Clean(root)
+	marked := make(sortedResults, results.Len())
+	for i := range marked {
+		marked[i] = results.Result(i)
+		if _, ok := below(marked[i], root); ok {
+			marked[i] = request.FilteredLine(marked[i])
+		}
+	}
+	return marked
+}
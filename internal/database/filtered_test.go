@@ -0,0 +1,76 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestQueryIndex_IncludeFiltered(t *testing.T) {
+	addFilter(t, "node_modules")
+	fs := newFakeFS("/r/app/pad.js", "/r/app/node_modules/left-pad/pad.js",
+		"/r/app/node_modules/left-pad/node_modules/pad.js", "/r/lib/node_modules/pad.js")
+	bounded := LazyOptions{MaxEntries: 100, Timeout: time.Minute}
+
+	tests := []struct {
+		name     string
+		lazy     LazyOptions
+		action   int
+		filtered string
+		want     []string
+	}{
+		{"prefix", bounded, request.PrefixSearch, "/r/app/node_modules", []string{
+			"/r/app/pad.js",
+			// the filters don't apply below the directory
+			request.FilteredLine("/r/app/node_modules/left-pad/node_modules/pad.js"),
+			request.FilteredLine("/r/app/node_modules/left-pad/pad.js"),
+			request.WarnWalked}},
+		// the directories leading to it aren't sent again
+		{"path", bounded, request.PathSearch, "/r/app/node_modules", []string{
+			"/r/app/pad.js",
+			request.FilteredLine("/r/app/node_modules/left-pad"),
+			request.FilteredLine("/r/app/node_modules/left-pad/node_modules"),
+			request.FilteredLine("/r/app/node_modules/left-pad/node_modules/pad.js"),
+			request.FilteredLine("/r/app/node_modules/left-pad/pad.js"),
+			request.WarnWalked}},
+		{"incomplete", LazyOptions{MaxEntries: 2, Timeout: time.Minute}, request.PrefixSearch,
+			"/r/app/node_modules", []string{"/r/app/pad.js", request.WarnWalkIncomplete}},
+		{"disabled", LazyOptions{}, request.PrefixSearch, "/r/app/node_modules",
+			[]string{request.ErrInvalidRequest}},
+		{"not_filtered", bounded, request.PrefixSearch, "/r/app",
+			[]string{request.ErrInvalidRequest}},
+		{"missing", bounded, request.PrefixSearch, "/r/node_modules",
+			[]string{request.ErrNotIndexed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeIndexer(fs, Options{Lazy: tt.lazy})
+			query := "pad.js"
+			if tt.action == request.PathSearch {
+				query = "pad"
+			}
+
+			lines := runRequest(db, request.Request{Version: 1, Query: query,
+				Features: []string{request.FeatureWarnings},
+				Settings: request.Settings{Action: tt.action, NoSort: true,
+					IncludeFiltered: tt.filtered}})
+			var got []string
+			for _, line := range lines {
+				if e, ok := request.ParseError(line); ok {
+					line = e.Code
+				} else if w, ok := request.ParseWarning(line); ok {
+					line = w.Code
+				}
+				got = append(got, line)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if paths := indexedPaths(t, db); len(paths) != 4 {
+				t.Errorf("the index holds %q after the search", paths)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"github.com/karrick/godirwalk"
+	"github.com/ozeidan/gosearch/internal/mounts"
+)
+
+// fileSystem is what the Indexer reads the entries it indexes from,
+// tests replace it with an in-memory one
+type fileSystem interface {
+	// ReadDirents returns the entries of the directory at path,
+	// refreshes read directories with it
+	ReadDirents(path string) ([]dirEntry, error)
+	// ReadEntries appends the entries of the directory at path to
+	// entries, the walk of a full index reads directories with it
+	ReadEntries(path string, entries []dirEntry) ([]dirEntry, error)
+	// Lstat returns whether the entry at path is a directory,
+	// symlinks aren't followed
+	Lstat(path string) (isDir bool, err error)
+	// Identify returns the device and inode number of the entry
+	// at path, symlinks aren't followed
+	Identify(path string) (fileID, error)
+	// Links returns the device and inode number of the entry at path
+	// and its number of hard links, 1 for directories, symlinks
+	// aren't followed
+	Links(path string) (id fileID, links uint64, err error)
+	// Shared returns whether the filesystem with the device number
+	// dev can be reached at more than one path
+	Shared(dev uint64) bool
+	// Xattr returns the value of the extended attribute name of the
+	// entry at path, empty if it isn't set, symlinks aren't followed
+	Xattr(path, name string) (string, error)
+}
+
+// dirEntry is a file or directory read from a fileSystem
+type dirEntry struct {
+	name  string
+	isDir bool
+}
+
+// fileID tells entries apart, one reachable at more than one path
+// has the same fileID at all of them
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// osFS reads the entries from disk, it is only used by the goroutine
+// of Start
+type osFS struct {
+	// scratchBuffer is used for reading directories
+	scratchBuffer []byte
+}
+
+func newOSFS() *osFS {
+	return &osFS{scratchBuffer: make([]byte, godirwalk.DefaultScratchBufferSize)}
+}
+
+func (fs *osFS) ReadDirents(path string) ([]dirEntry, error) {
+	return readEntries(path, fs.scratchBuffer, nil)
+}
+
+func (fs *osFS) ReadEntries(path string, entries []dirEntry) ([]dirEntry, error) {
+	return readEntries(path, fs.scratchBuffer, entries)
+}
+
+func (fs *osFS) Shared(dev uint64) bool {
+	return mounts.IsShared(dev)
+}
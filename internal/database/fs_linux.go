@@ -0,0 +1,134 @@
+package database
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// longPathChunk is the length of the parts paths the kernel rejects
+// are opened in, it takes paths shorter than PATH_MAX. The rest stays
+// short enough to be reached through /proc/self/fd.
+const longPathChunk = unix.PathMax - 64
+
+// shortPath calls f with a path the kernel accepts for the entry at
+// path. Longer paths, which directory trees created with relative
+// paths can have, are opened a part at a time and the entry is reached
+// through the descriptor of the directory holding the last part.
+func shortPath(path string, f func(short string) error) error {
+	if len(path) < unix.PathMax {
+		return f(path)
+	}
+	dirfd, rest := unix.AT_FDCWD, path
+	defer func() {
+		if dirfd != unix.AT_FDCWD {
+			unix.Close(dirfd)
+		}
+	}()
+	for len(rest) > longPathChunk {
+		i := strings.LastIndexByte(rest[:longPathChunk], '/')
+		if i <= 0 {
+			return &os.PathError{Op: "open", Path: path, Err: unix.ENAMETOOLONG}
+		}
+		fd, err := unix.Openat(dirfd, rest[:i], unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return &os.PathError{Op: "open", Path: path, Err: err}
+		}
+		if dirfd != unix.AT_FDCWD {
+			unix.Close(dirfd)
+		}
+		dirfd, rest = fd, rest[i+1:]
+	}
+	err := f("/proc/self/fd/" + strconv.Itoa(dirfd) + "/" + rest)
+	if pathErr, ok := err.(*os.PathError); ok {
+		pathErr.Path = path
+	}
+	return err
+}
+
+// lstat is os.Lstat for paths of any length
+func lstat(path string) (info os.FileInfo, err error) {
+	err = shortPath(path, func(short string) error {
+		info, err = os.Lstat(short)
+		return err
+	})
+	return info, err
+}
+
+// openFile is os.Open for paths of any length
+func openFile(path string) (file *os.File, err error) {
+	err = shortPath(path, func(short string) error {
+		file, err = os.Open(short)
+		return err
+	})
+	return file, err
+}
+
+// lstatRaw is syscall.Lstat for paths of any length
+func lstatRaw(path string, info *syscall.Stat_t) error {
+	return shortPath(path, func(short string) error {
+		return syscall.Lstat(short, info)
+	})
+}
+
+func (fs *osFS) Lstat(path string) (bool, error) {
+	var info syscall.Stat_t
+	if err := lstatRaw(path, &info); err != nil {
+		return false, err
+	}
+	return info.Mode&syscall.S_IFMT == syscall.S_IFDIR, nil
+}
+
+func (fs *osFS) Identify(path string) (fileID, error) {
+	var info syscall.Stat_t
+	if err := lstatRaw(path, &info); err != nil {
+		return fileID{}, err
+	}
+	return fileID{dev: uint64(info.Dev), ino: info.Ino}, nil
+}
+
+func (fs *osFS) Links(path string) (fileID, uint64, error) {
+	var info syscall.Stat_t
+	if err := lstatRaw(path, &info); err != nil {
+		return fileID{}, 0, err
+	}
+	links := uint64(info.Nlink)
+	if info.Mode&syscall.S_IFMT == syscall.S_IFDIR {
+		// counts the entries of subdirectories linking to it
+		links = 1
+	}
+	return fileID{dev: uint64(info.Dev), ino: info.Ino}, links, nil
+}
+
+func (fs *osFS) Xattr(path, name string) (value string, err error) {
+	err = shortPath(path, func(short string) error {
+		value, err = xattr(short, name)
+		return err
+	})
+	return value, err
+}
+
+func xattr(path, name string) (string, error) {
+	buf := make([]byte, 256)
+	for {
+		n, err := unix.Lgetxattr(path, name, buf)
+		switch err {
+		case nil:
+			return string(buf[:n]), nil
+		case unix.ENODATA, unix.ENOTSUP:
+			return "", nil
+		case unix.ERANGE:
+			// the value doesn't fit, ask for its size
+			size, err := unix.Lgetxattr(path, name, nil)
+			if err != nil {
+				return "", err
+			}
+			buf = make([]byte, size+1)
+		default:
+			return "", err
+		}
+	}
+}
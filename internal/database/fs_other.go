@@ -0,0 +1,42 @@
+//go:build !linux
+
+package database
+
+import "os"
+
+// lstat is os.Lstat, the paths are only limited on linux
+func lstat(path string) (os.FileInfo, error) {
+	return os.Lstat(path)
+}
+
+// openFile is os.Open, the paths are only limited on linux
+func openFile(path string) (*os.File, error) {
+	return os.Open(path)
+}
+
+func (fs *osFS) Lstat(path string) (bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, err
+	}
+	return info.IsDir(), nil
+}
+
+// Identify only checks that path exists, device and inode numbers
+// aren't known, so no directory is taken for an alias of another
+func (fs *osFS) Identify(path string) (fileID, error) {
+	_, err := os.Lstat(path)
+	return fileID{}, err
+}
+
+// Links only checks that path exists, hard links aren't told apart
+// without inode numbers
+func (fs *osFS) Links(path string) (fileID, uint64, error) {
+	_, err := os.Lstat(path)
+	return fileID{}, 1, err
+}
+
+// Xattr returns no value, tags are only read on linux
+func (fs *osFS) Xattr(path, name string) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// fakeFS is an in-memory fileSystem
+type fakeFS struct {
+	// dirs maps the directories to their entries,
+	// which map the names to whether they are directories
+	dirs map[string]map[string]bool
+	// readErrs are returned for reading the directories at the paths,
+	// statErrs for stat'ing the paths
+	readErrs map[string]error
+	statErrs map[string]error
+	// binds map the paths directories are bind mounted at
+	// to their sources
+	binds map[string]string
+	// xattrs are the values of the extended attribute
+	// read by Xattr, by path
+	xattrs map[string]string
+	// hardlinks map the paths of files to the path
+	// of the file they are a hard link to
+	hardlinks map[string]string
+}
+
+// newFakeFS returns a fakeFS holding paths, whose names end with
+// a slash for directories
+func newFakeFS(paths ...string) *fakeFS {
+	fs := &fakeFS{
+		dirs:      map[string]map[string]bool{"/": {}},
+		readErrs:  make(map[string]error),
+		statErrs:  make(map[string]error),
+		binds:     make(map[string]string),
+		xattrs:    make(map[string]string),
+		hardlinks: make(map[string]string),
+	}
+	for _, path := range paths {
+		fs.add(path)
+	}
+	return fs
+}
+
+// add creates the file or directory at path and its parents
+func (fs *fakeFS) add(path string) {
+	clean := filepath.Clean(path)
+	isDir := strings.HasSuffix(path, "/")
+	if isDir && fs.dirs[clean] == nil {
+		fs.dirs[clean] = make(map[string]bool)
+	}
+	for p := clean; p != "/"; p = filepath.Dir(p) {
+		parent := filepath.Dir(p)
+		if fs.dirs[parent] == nil {
+			fs.dirs[parent] = make(map[string]bool)
+		}
+		fs.dirs[parent][filepath.Base(p)] = p != clean || isDir
+	}
+}
+
+// remove deletes the entry at path with everything below it
+func (fs *fakeFS) remove(path string) {
+	delete(fs.binds, path)
+	delete(fs.dirs[filepath.Dir(path)], filepath.Base(path))
+	for dir := range fs.dirs {
+		if dir == path || strings.HasPrefix(dir, path+"/") {
+			delete(fs.dirs, dir)
+		}
+	}
+}
+
+// bind makes the directory at source reachable at target too
+func (fs *fakeFS) bind(target, source string) {
+	fs.add(target + "/")
+	fs.binds[target] = source
+}
+
+// resolve returns the path of the entry at path below
+// the sources of the binds
+func (fs *fakeFS) resolve(path string) string {
+	for target, source := range fs.binds {
+		if path == target || strings.HasPrefix(path, target+"/") {
+			return fs.resolve(source + path[len(target):])
+		}
+	}
+	return path
+}
+
+func (fs *fakeFS) ReadDirents(path string) ([]dirEntry, error) {
+	return fs.ReadEntries(path, nil)
+}
+
+func (fs *fakeFS) ReadEntries(path string, entries []dirEntry) ([]dirEntry, error) {
+	if err := fs.readErrs[path]; err != nil {
+		return entries, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	names, ok := fs.dirs[fs.resolve(path)]
+	if !ok {
+		err := syscall.ENOENT
+		if _, exists := fs.dirs[filepath.Dir(path)][filepath.Base(path)]; exists {
+			err = syscall.ENOTDIR
+		}
+		return entries, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		entries = append(entries, dirEntry{name, names[name]})
+	}
+	return entries, nil
+}
+
+func (fs *fakeFS) Lstat(path string) (bool, error) {
+	if err := fs.statErrs[path]; err != nil {
+		return false, &os.PathError{Op: "lstat", Path: path, Err: err}
+	}
+	if path == "/" {
+		return true, nil
+	}
+	isDir, ok := fs.dirs[fs.resolve(filepath.Dir(path))][filepath.Base(path)]
+	if !ok {
+		return false, &os.PathError{Op: "lstat", Path: path, Err: syscall.ENOENT}
+	}
+	return isDir, nil
+}
+
+// Identify numbers the entries by their paths below the sources
+// of the binds
+func (fs *fakeFS) Identify(path string) (fileID, error) {
+	if _, err := fs.Lstat(path); err != nil {
+		return fileID{}, err
+	}
+	h := fnv.New64a()
+	h.Write([]byte(fs.resolve(path)))
+	return fileID{dev: 1, ino: h.Sum64()}, nil
+}
+
+// link creates the file at path as a hard link to the one at target
+func (fs *fakeFS) link(path, target string) {
+	fs.add(path)
+	fs.hardlinks[path] = target
+}
+
+// Links identifies hard links by the file they link to
+func (fs *fakeFS) Links(path string) (fileID, uint64, error) {
+	target, ok := fs.hardlinks[path]
+	if !ok {
+		target = path
+	}
+	if _, err := fs.Lstat(path); err != nil {
+		return fileID{}, 0, err
+	}
+	links := uint64(1)
+	for p, t := range fs.hardlinks {
+		if _, err := fs.Lstat(p); t == target && err == nil {
+			links++
+		}
+	}
+	id, err := fs.Identify(target)
+	return id, links, err
+}
+
+func (fs *fakeFS) Shared(dev uint64) bool {
+	return len(fs.binds) > 0
+}
+
+func (fs *fakeFS) Xattr(path, name string) (string, error) {
+	if _, err := fs.Lstat(path); err != nil {
+		return "", err
+	}
+	return fs.xattrs[path], nil
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+// fuzzParents are the directories the entries of FuzzIndexTrie
+// are added to, so the same name ends up in several lists
+var fuzzParents = []string{"/r", "/r/a", "/r/b", "/r/a/c"}
+
+// FuzzIndexTrie decodes ops into additions and removals of entries
+// and checks the trie, the tree and the trigram index after each.
+// Every op is a byte followed by the name: bit 0 removes the entry,
+// bits 1-2 select the parent and bits 3-4 the length of the name.
+func FuzzIndexTrie(f *testing.F) {
+	f.Add([]byte("\x10abc\x11abc"))
+	f.Add([]byte("\x00x\x02x\x04x\x01x\x03x\x05x"))
+	f.Add([]byte("\x10\xff\xfe\xfd\x12\xff\xfe\xfd\x11\xff\xfe\xfd"))
+	f.Add([]byte("\x08..\x10...\x00/\x00\x00\x03c"))
+	f.Add([]byte("\x08ab\x0aab\x09ab\x0bab\x08ab"))
+
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		db := New(Options{Root: "/r"})
+		for _, parent := range fuzzParents {
+			db.tree.Add(parent)
+		}
+		indexed := make(map[string]bool)
+
+		for i := 0; i < len(ops); {
+			op := ops[i]
+			n := int(op>>3&3) + 1
+			if i+1+n > len(ops) {
+				break
+			}
+			name := string(ops[i+1 : i+1+n])
+			i += 1 + n
+			parent := fuzzParents[op>>1&3]
+			path := filepath.Join(parent, name)
+			if name == "." || name == ".." || strings.ContainsAny(name, "/\x00") ||
+				isFuzzParent(path) {
+				continue
+			}
+
+			if op&1 == 1 {
+				db.removeEntry(parent, name)
+				delete(indexed, path)
+			} else if !indexed[path] {
+				db.addEntry(path, name, false)
+				indexed[path] = true
+			}
+			checkIndex(t, db, indexed)
+		}
+	})
+}
+
+func isFuzzParent(path string) bool {
+	for _, parent := range fuzzParents {
+		if path == parent {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIndex fails t unless the trie, the tree and the trigram
+// index of db hold exactly the paths in indexed
+func checkIndex(t *testing.T, db *Indexer, indexed map[string]bool) {
+	t.Helper()
+	names := make(map[string]bool)
+	for path := range indexed {
+		names[filepath.Base(path)] = true
+	}
+
+	entries := 0
+	keys := 0
+	db.trie.Visit(func(prefix trie.Prefix, item trie.Item) error {
+		keys++
+		files := entriesOf(item).entries
+		if len(files) == 0 {
+			t.Fatalf("the trie holds an empty list for %q", prefix)
+		}
+		for _, file := range files {
+			path := file.pathNode.GetPath()
+			if !indexed[path] || filepath.Base(path) != string(prefix) {
+				t.Fatalf("the trie holds %q below %q", path, prefix)
+			}
+			entries++
+		}
+		return nil
+	})
+	if entries != len(indexed) || keys != len(names) {
+		t.Fatalf("the trie holds %d entries with %d names, want %d with %d",
+			entries, keys, len(indexed), len(names))
+	}
+
+	for path := range indexed {
+		item := db.trie.Get(trie.Prefix(filepath.Base(path)))
+		found := false
+		for _, file := range entriesOf(item).entries {
+			found = found || file.pathNode.GetPath() == path
+		}
+		if !found {
+			t.Fatalf("%q isn't retrievable by its name", path)
+		}
+	}
+
+	if got, want := db.tree.Count(), len(fuzzParents)+len(indexed); got != want {
+		t.Fatalf("the tree has %d nodes, want %d", got, want)
+	}
+	if len(db.trigrams.ids) != len(names) {
+		t.Fatalf("the trigram index has %d names, want %d", len(db.trigrams.ids), len(names))
+	}
+	for name := range names {
+		if _, ok := db.trigrams.ids[name]; !ok {
+			t.Fatalf("the trigram index misses %q", name)
+		}
+	}
+}
+
+// fuzzNames are added to the synthetic index of FuzzQuery, they
+// change in length when lowercased or aren't valid UTF-8
+var fuzzNames = []string{"\xff", "\xffab", "a\xc3", "é.txt", "\xa9ab",
+	"İstanbul", "ȺB", "ſrc", "ümlaut.md", "xéab.txt", "a b", "Ünïcode/", "Ünïcode/ÜBER.go"}
+
+// newFuzzIndexer returns the index queried by FuzzQuery and the
+// paths in its tree, mapped to whether they are in the trie
+func newFuzzIndexer() (*Indexer, map[string]bool) {
+	const size = 500
+	db := newSyntheticIndexer(size)
+	paths := map[string]bool{"/": false, "/synthetic": false}
+	for _, entry := range syntheticEntries(size) {
+		paths[entry.path] = true
+	}
+	for _, name := range fuzzNames {
+		path := filepath.Join("/synthetic", name)
+		db.addEntry(path, filepath.Base(path), strings.HasSuffix(name, "/"))
+		paths[path] = true
+	}
+	return db, paths
+}
+
+// fuzzActions are the actions FuzzQuery runs every query with
+var fuzzActions = []int{request.PrefixSearch, request.SubStringSearch,
+	request.FuzzySearch, request.PathSearch, request.SegmentSearch,
+	request.Duplicates, request.ChangedSince}
+
+// FuzzQuery runs queries with every action on a fixed index. They
+// mustn't panic and only find indexed paths, a case sensitive
+// substring search finds exactly the names containing the query.
+func FuzzQuery(f *testing.F) {
+	for _, query := range []string{"", "/", "//", "a", "src", "\xff", "\xffab",
+		"\xa9ab", "İ", "ȺB", "ſ", "ÜBER", "ünï/über", "[", "*.go",
+		strings.Repeat("a", 300)} {
+		f.Add(query)
+	}
+	db, paths := newFuzzIndexer()
+
+	f.Fuzz(func(t *testing.T, query string) {
+		for _, action := range fuzzActions {
+			for _, caseInsensitive := range []bool{false, true} {
+				settings := request.Settings{
+					Action:          action,
+					CaseInsensitive: caseInsensitive,
+					NoSort:          true,
+				}
+				if action == request.ChangedSince {
+					settings.Since = 1
+				}
+				results := runRequest(db, request.Request{Version: 1, Query: query, Settings: settings})
+
+				if len(results) == 1 {
+					if e, ok := request.ParseError(results[0]); ok {
+						// the empty query and invalid patterns are rejected
+						if query != "" && action != request.Duplicates {
+							t.Fatalf("action %d rejected %q: %s", action, query, e.Message)
+						}
+						continue
+					}
+				}
+				for _, result := range results {
+					if action == request.Duplicates && !strings.HasPrefix(result, "/") {
+						// the names precede their paths
+						continue
+					}
+					if _, ok := paths[result]; !ok {
+						t.Fatalf("action %d (case insensitive %v) found %q, "+
+							"which isn't indexed", action, caseInsensitive, result)
+					}
+				}
+
+				if action == request.SubStringSearch && !caseInsensitive {
+					var want int
+					for path, inTrie := range paths {
+						if inTrie && strings.Contains(filepath.Base(path), query) {
+							want++
+						}
+					}
+					if len(results) != want {
+						t.Fatalf("substring search for %q found %d paths, want %d",
+							query, len(results), want)
+					}
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// generationOf returns the generation db answers a Generation request with
+func generationOf(t *testing.T, db *Indexer) uint64 {
+	t.Helper()
+	lines := runRequest(db, request.Request{Settings: request.Settings{Action: request.Generation}})
+	var response request.GenerationResponse
+	if len(lines) != 1 || json.Unmarshal([]byte(lines[0]), &response) != nil {
+		t.Fatalf("got %q, want a GenerationResponse", lines)
+	}
+	return response.Generation
+}
+
+func TestGeneration(t *testing.T) {
+	fs := newFakeFS("/r/a/notes.txt")
+	db := newFakeIndexer(fs, Options{})
+	before := generationOf(t, db)
+	if before < uint64(db.startTime.UnixMicro()) {
+		t.Errorf("generation %d is before the start", before)
+	}
+
+	search := func(unless uint64) []string {
+		lines := runRequest(db, request.Request{Version: 1, Query: "notes",
+			Features: []string{request.FeatureStatus},
+			Settings: request.Settings{UnlessGeneration: unless}})
+		for i, line := range lines {
+			if s, ok := request.ParseStatus(line); ok {
+				if s.Generation != generationOf(t, db) {
+					t.Errorf("status of generation %d, the index is of %d", s.Generation, generationOf(t, db))
+				}
+				lines[i] = "unchanged"
+				if !s.Unchanged {
+					lines[i] = "status"
+				}
+			}
+		}
+		return lines
+	}
+	if got, want := search(before), []string{"unchanged"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("search of the same generation: got %q, want %q", got, want)
+	}
+	if got, want := search(0), []string{"/r/a/notes.txt", "status"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("search: got %q, want %q", got, want)
+	}
+
+	fs.add("/r/b/notes.txt")
+	db.refreshDirectory("/r")
+	after := generationOf(t, db)
+	if after <= before {
+		t.Errorf("generation %d after a change, %d before", after, before)
+	}
+	want := []string{"/r/a/notes.txt", "/r/b/notes.txt", "status"}
+	if got := search(before); !reflect.DeepEqual(got, want) {
+		t.Errorf("search of an earlier generation: got %q, want %q", got, want)
+	}
+}
+
+func TestGeneration_Snapshots(t *testing.T) {
+	fs := newFakeFS("/r/a/notes.txt")
+	db := newFakeIndexer(fs, Options{})
+	db.enableSnapshots()
+	published := db.publishedGeneration()
+
+	db.beginWrite()
+	fs.add("/r/b/notes.txt")
+	db.refreshDirectory("/r")
+	// queries still run on the published copy
+	if got := db.publishedGeneration(); got != published {
+		t.Errorf("generation %d before publishing, want %d", got, published)
+	}
+	db.publish()
+	if got := db.publishedGeneration(); got <= published {
+		t.Errorf("generation %d after publishing, %d before", got, published)
+	}
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"log/slog"
+	"path/filepath"
+	"time"
+)
+
+// graceSlotWidth is the interval of a slot of the timer wheel of the
+// pending deletions, and how often it is advanced
+const graceSlotWidth = 250 * time.Millisecond
+
+// pendingDeletes holds the entries that vanished less than the grace
+// period ago. They stay in the index until it ends, so editors saving by
+// moving the old file away and writing a new one don't remove it. Only
+// the goroutine of Start uses it.
+type pendingDeletes struct {
+	grace time.Duration
+	// due are the ends of the grace periods by path, slots a timer
+	// wheel holding the paths by the slot of their end. A path that
+	// isn't due anymore, or is due later, is skipped in the slot.
+	due   map[string]time.Time
+	slots [][]string
+	// next is the start of the first slot that hasn't expired
+	next time.Time
+}
+
+// slot returns the slot of the wheel holding t
+func (p *pendingDeletes) slot(t time.Time) int {
+	return int(t.UnixNano()/int64(graceSlotWidth)) % len(p.slots)
+}
+
+// add starts the grace period of path, unless it is pending already
+func (p *pendingDeletes) add(path string, now time.Time) {
+	if _, ok := p.due[path]; ok {
+		return
+	}
+	if p.slots == nil {
+		// the wheel covers the grace period, the paths are
+		// due within a turn once it is advanced regularly
+		p.slots = make([][]string, int(p.grace/graceSlotWidth)+2)
+		p.due = make(map[string]time.Time)
+	}
+	if len(p.due) == 0 {
+		// the slots only hold paths that aren't pending anymore
+		for i := range p.slots {
+			p.slots[i] = p.slots[i][:0]
+		}
+		p.next = now.Truncate(graceSlotWidth)
+	}
+	due := now.Add(p.grace)
+	p.due[path] = due
+	i := p.slot(due)
+	p.slots[i] = append(p.slots[i], path)
+}
+
+// cancel ends the grace period of path, it returns false
+// if it wasn't pending
+func (p *pendingDeletes) cancel(path string) bool {
+	if _, ok := p.due[path]; !ok {
+		return false
+	}
+	delete(p.due, path)
+	return true
+}
+
+// expire returns the paths whose grace period ended by now,
+// they aren't pending anymore
+func (p *pendingDeletes) expire(now time.Time) []string {
+	var expired []string
+	for len(p.due) > 0 && !p.next.After(now) {
+		i := p.slot(p.next)
+		kept := p.slots[i][:0]
+		for _, path := range p.slots[i] {
+			due, ok := p.due[path]
+			switch {
+			case !ok || p.slot(due) != i:
+				// cancelled, or pending again in another slot
+			case due.After(now):
+				// due in a later turn of the wheel, or later
+				// in the slot of now
+				kept = append(kept, path)
+			default:
+				delete(p.due, path)
+				expired = append(expired, path)
+			}
+		}
+		p.slots[i] = kept
+		if p.next.Add(graceSlotWidth).After(now) {
+			// the slot of now is visited again
+			break
+		}
+		p.next = p.next.Add(graceSlotWidth)
+	}
+	return expired
+}
+
+// deferDeletes starts the grace period of the entries names of the
+// directory at path and returns those to remove now, none unless
+// there is no grace period
+func (db *Indexer) deferDeletes(path string, names []string, now time.Time) []string {
+	if db.pending.grace == 0 {
+		return names
+	}
+	for _, name := range names {
+		db.pending.add(filepath.Join(path, name), now)
+	}
+	return nil
+}
+
+// keepPending cancels the deletion of the entries names of the
+// directory at path that are pending, they were created again. Their
+// tags are read again, the entry in the index is kept.
+func (db *Indexer) keepPending(path string, names []string) {
+	if len(db.pending.due) == 0 {
+		return
+	}
+	for _, name := range names {
+		pathName := filepath.Join(path, name)
+		if !db.pending.cancel(pathName) {
+			continue
+		}
+		slog.Debug("entry created again within the grace period", "path", pathName)
+		if node, err := db.tree.Lookup(pathName); err == nil {
+			db.readTags(node, pathName)
+		}
+	}
+}
+
+// commitDeletes removes the entries whose grace period ended by now
+// from the index, unless their directory holds them again
+func (db *Indexer) commitDeletes(now time.Time) {
+	byDir := make(map[string][]string)
+	for _, pathName := range db.pending.expire(now) {
+		dir := filepath.Dir(pathName)
+		byDir[dir] = append(byDir[dir], filepath.Base(pathName))
+	}
+	for dir, names := range byDir {
+		// names are compared exactly, on case insensitive
+		// filesystems one differing in case doesn't keep it
+		present := make(map[string]bool)
+		if entries, err := db.fs.ReadDirents(dir); err == nil {
+			for _, entry := range entries {
+				present[entry.name] = true
+			}
+		}
+		var deleted []string
+		for _, name := range names {
+			if _, err := db.tree.Lookup(filepath.Join(dir, name)); err != nil || present[name] {
+				// removed with its directory, or not deleted
+				continue
+			}
+			deleted = append(deleted, name)
+		}
+		if len(deleted) == 0 {
+			continue
+		}
+		slog.Debug("removing deleted files from index", "dir", dir, "names", deleted)
+		db.checkRemovedCount(dir, deleted)
+		for _, name := range deleted {
+			db.removeFromIndex(dir, name)
+		}
+		db.journalChanges(dir, nil, deleted)
+	}
+}
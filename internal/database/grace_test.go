@@ -0,0 +1,101 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestPendingDeletes(t *testing.T) {
+	start := time.Unix(1000, 0)
+	p := pendingDeletes{grace: 2 * time.Second}
+	p.add("/a", start)
+	p.add("/b", start.Add(100*time.Millisecond))
+	p.add("/c", start.Add(time.Second))
+	// pending already, the grace period isn't extended
+	p.add("/a", start.Add(time.Second))
+	if !p.cancel("/b") || p.cancel("/d") {
+		t.Error("cancel() doesn't return whether the path was pending")
+	}
+
+	tests := []struct {
+		after time.Duration
+		want  []string
+	}{
+		{time.Second, nil},
+		{2 * time.Second, []string{"/a"}},
+		{2500 * time.Millisecond, nil},
+		{3 * time.Second, []string{"/c"}},
+		{time.Minute, nil},
+	}
+	for _, tt := range tests {
+		if got := p.expire(start.Add(tt.after)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expire(+%s) = %q, want %q", tt.after, got, tt.want)
+		}
+	}
+
+	// added again after it expired
+	p.add("/a", start.Add(time.Hour))
+	if got := p.expire(start.Add(time.Hour + 2*time.Second)); !reflect.DeepEqual(got, []string{"/a"}) {
+		t.Errorf("expire() after adding again = %q, want [/a]", got)
+	}
+}
+
+func TestDeleteGrace(t *testing.T) {
+	tests := []struct {
+		name string
+		// change is applied to the filesystem between the
+		// refreshes of /r/docs
+		change     func(fs *fakeFS)
+		want       []string
+		wantTags   []string
+		wantBuried []string
+	}{
+		{"rename_over", func(fs *fakeFS) {
+			fs.add("/r/docs/report.txt")
+			fs.xattrs["/r/docs/report.txt"] = "work"
+		}, []string{"/r/docs/report.txt"}, []string{"/r/docs/report.txt"}, nil},
+		{"deleted", func(fs *fakeFS) {}, nil, nil, []string{"/r/docs/report.txt"}},
+		// a name differing in case is another entry
+		{"different_case", func(fs *fakeFS) { fs.add("/r/docs/Report.txt") },
+			[]string{"/r/docs/Report.txt"}, nil, []string{"/r/docs/report.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newFakeFS("/r/docs/report.txt")
+			db := newFakeIndexer(fs, Options{DeleteGrace: 2 * time.Second, TagsXattr: "user.tags",
+				Deleted: DeletedOptions{MaxEntries: 10}})
+
+			fs.remove("/r/docs/report.txt")
+			db.refreshDirectory("/r/docs")
+			// still found within the grace period
+			if got := runRequest(db, request.Request{Query: "report"}); len(got) != 1 {
+				t.Errorf("found %q within the grace period, want the entry", got)
+			}
+			tt.change(fs)
+			db.refreshDirectory("/r/docs")
+			db.commitDeletes(time.Now().Add(3 * time.Second))
+
+			if got := runRequest(db, request.Request{Query: "eport",
+				Settings: request.Settings{TypeFilter: request.TypeFile}}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("found %q, want %q", got, tt.want)
+			}
+			if got := runRequest(db, request.Request{Query: "report",
+				Settings: request.Settings{Tag: "work"}}); !reflect.DeepEqual(got, tt.wantTags) {
+				t.Errorf("found tagged %q, want %q", got, tt.wantTags)
+			}
+			var buried []string
+			for _, line := range runRequest(db, request.Request{Version: 1, Query: "report",
+				Settings: request.Settings{Action: request.Deleted}}) {
+				_, path, _ := strings.Cut(line, "\t")
+				buried = append(buried, path)
+			}
+			if !reflect.DeepEqual(buried, tt.wantBuried) {
+				t.Errorf("deleted %q, want %q", buried, tt.wantBuried)
+			}
+		})
+	}
+}
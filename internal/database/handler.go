@@ -0,0 +1,226 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/mounts"
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func (db *Indexer) handleRequest(req request.Request) {
+	switch req.Settings.Action {
+	case request.Stats:
+		db.sendStats(req)
+	case request.ListFilters:
+		db.sendFilters(req)
+	case request.AddFilter, request.RemoveFilter:
+		db.changeFilter(req)
+	case request.IndexRefresh:
+		db.reindex(req)
+	case request.RefreshPath:
+		db.refreshPath(req)
+	case request.Pause:
+		db.pause(req)
+	case request.Resume:
+		db.resume(req)
+	case request.Debug:
+		db.sendDebug(req)
+	case request.Failures:
+		db.sendFailures(req)
+	case request.RetryFailures:
+		db.retryFailuresNow(req)
+	case request.Describe:
+		db.sendDescription(req)
+	case request.Visit:
+		db.recordVisit(req)
+	case request.Generation:
+		db.sendGeneration(req)
+	default:
+		if !request.IsQuery(req.Settings.Action) {
+			// Health and Version are answered by request.Dispatch
+			sendError(req, request.ErrorResponse{
+				Code:    request.ErrUnknownAction,
+				Message: fmt.Sprintf("unknown action %d", req.Settings.Action),
+			})
+			return
+		}
+		if err := req.Settings.Validate(); err != nil {
+			sendError(req, request.ErrorResponse{
+				Code:    request.ErrInvalidRequest,
+				Message: err.Error(),
+			})
+			return
+		}
+		if req.Settings.Root != "" {
+			req.Settings.Root = db.canonicalRoot(req.Settings.Root)
+		}
+		switch req.Settings.Action {
+		case request.Duplicates:
+			db.findDuplicates(req)
+		case request.History:
+			db.sendHistory(req)
+		case request.Trash:
+			db.sendTrash(req)
+		case request.Deleted:
+			db.sendDeleted(req)
+		case request.Tree:
+			db.sendTree(req)
+		case request.Recent:
+			db.sendRecent(req)
+		case request.Links:
+			db.sendLinks(req)
+		default:
+			db.queryIndex(req)
+		}
+	}
+}
+
+// changesIndex returns whether handling a request with action
+// changes the index
+func changesIndex(action int) bool {
+	switch action {
+	case request.AddFilter, request.RemoveFilter, request.IndexRefresh,
+		request.RefreshPath, request.Resume, request.RetryFailures:
+		return true
+	}
+	return false
+}
+
+func sendError(req request.Request, e request.ErrorResponse) {
+	defer close(req.ResponseChannel)
+	writeError(req, e)
+}
+
+// writeError sends e like sendError, but leaves closing the
+// channel to the caller
+func writeError(req request.Request, e request.ErrorResponse) {
+	select {
+	case req.ResponseChannel <- e.Line(req.Version):
+	case <-req.Done:
+	}
+}
+
+func (db *Indexer) sendFilters(req request.Request) {
+	defer close(req.ResponseChannel)
+
+	for _, filter := range config.EffectiveFilters() {
+		line := fmt.Sprintf("%s\t%s", filter.Class, filter.Pattern)
+		if filter.Default {
+			line += fmt.Sprintf("\t(default v%d)", config.DefaultFiltersVersion)
+		}
+
+		select {
+		case req.ResponseChannel <- line:
+		case <-req.Done:
+			return
+		}
+	}
+}
+
+// changeFilter adds or removes a glob filter and brings the index
+// in line with the new filters
+func (db *Indexer) changeFilter(req request.Request) {
+	add := req.Settings.Action == request.AddFilter
+
+	var pattern string
+	var err error
+	if add {
+		pattern, err = config.AddGlobFilter(req.Query)
+	} else {
+		pattern, err = config.RemoveGlobFilter(req.Query)
+	}
+
+	if err != nil {
+		sendError(req, request.ErrorResponse{
+			Code:    request.ErrInvalidRequest,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	var reply string
+	switch {
+	case add:
+		reply = "added glob filter " + pattern
+	default:
+		reply = "removed glob filter " + pattern
+	}
+	if req.Settings.Persist {
+		if err := config.SaveConfig(); err != nil {
+			reply += ", not persisted: " + err.Error()
+		}
+	}
+
+	select {
+	case req.ResponseChannel <- reply:
+	case <-req.Done:
+	}
+	close(req.ResponseChannel)
+
+	req.Logger().Info(reply)
+	// filters can hide the directories permission was denied to
+	db.unsuppressFailures()
+	scope := config.FilterScope(pattern)
+	parent := filepath.Dir(scope)
+	if add {
+		db.removeFilteredEntries(parent)
+		db.deleted.removeFiltered()
+		db.recent.removeFiltered()
+		return
+	}
+
+	if parent != "/" && config.IsPathFiltered(parent) {
+		return
+	}
+	// the directories are read again between the requests,
+	// paths matched by wildcards can be anywhere below the scope
+	db.queueRescan(rescan{path: parent, refresh: true})
+	if scope != pattern {
+		db.queueRescan(rescan{path: scope, descend: true})
+	}
+}
+
+// refreshPath rescans a directory and everything below it
+func (db *Indexer) refreshPath(req request.Request) {
+	path := filepath.Clean(req.Query)
+	if !filepath.IsAbs(path) {
+		sendError(req, request.ErrorResponse{
+			Code:    request.ErrInvalidRequest,
+			Message: "not an absolute path: " + req.Query,
+		})
+		return
+	}
+	if _, err := db.fs.Lstat(path); os.IsNotExist(err) {
+		sendError(req, request.ErrorResponse{
+			Code:    request.ErrNotFound,
+			Message: path + " doesn't exist",
+		})
+		// refreshing the parent removes the path from the index,
+		// if it was indexed
+		path = filepath.Dir(path)
+		if path != "/" && config.IsPathFiltered(path) {
+			return
+		}
+		db.refreshDirectory(path)
+		return
+	}
+
+	select {
+	case req.ResponseChannel <- "refreshing " + path:
+	case <-req.Done:
+	}
+	close(req.ResponseChannel)
+
+	if path != "/" && config.IsPathFiltered(path) {
+		return
+	}
+	start, table := time.Now(), mounts.All()
+	db.refreshDirectory(path)
+	db.reconcileSubdirectories(path)
+	db.refreshTags(path)
+	db.reconciliations.record(path, table, start)
+}
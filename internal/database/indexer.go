@@ -2,110 +2,613 @@ package database
 
 import (
 	"errors"
-	"log"
+	"log/slog"
+	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/karrick/godirwalk"
 	"github.com/ozeidan/gosearch/internal/config"
-	"github.com/ozeidan/gosearch/internal/fanotify"
+	"github.com/ozeidan/gosearch/internal/health"
+	"github.com/ozeidan/gosearch/internal/metrics"
+	"github.com/ozeidan/gosearch/internal/mounts"
+	"github.com/ozeidan/gosearch/internal/notify"
 	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/internal/watch"
 	"github.com/ozeidan/gosearch/pkg/tree"
 	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
 )
 
-// Start starts the indexing and listens for file changes and requests
+// Options configure an Indexer
+type Options struct {
+	// Root is the directory indexed with everything below it,
+	// "/" if empty
+	Root string
+	// SnapshotQueries runs queries concurrently with changes
+	// on snapshots of the index
+	SnapshotQueries bool
+	// ReaderWait is how long changes wait at most for the queries on
+	// the copy published before, which may be held up by slow clients,
+	// before copying the published one instead. 0 waits for them.
+	ReaderWait time.Duration
+	// MinQueryLength is the number of characters substring and fuzzy
+	// searches need unless they are unsorted and limited, 0 means
+	// any query but the empty one is answered
+	MinQueryLength int
+	// Journal records the changes applied to the index
+	Journal JournalOptions
+	// Deleted keeps the recently deleted entries
+	Deleted DeletedOptions
+	// Recent keeps the recently created entries
+	Recent RecentOptions
+	// Priority are the directories a full index walks before
+	// everything else, in order
+	Priority []string
+	// TagsXattr is the extended attribute the tags of the entries
+	// are read from, tags aren't indexed if it is empty
+	TagsXattr string
+	// Lazy bounds the walks of request roots that aren't indexed
+	Lazy LazyOptions
+	// Cold keeps the entries below some directories on disk
+	Cold ColdOptions
+	// DeleteGrace is how long vanished entries stay in the index,
+	// they are kept if they are created again within it
+	DeleteGrace time.Duration
+	// QueryCacheSize is the number of searches whose results are
+	// cached until the index changes, 0 disables the cache
+	QueryCacheSize int
+	// MemoryBudget is the heap size in bytes a reindex may grow the
+	// server to by building the new index next to the old one, it is
+	// rebuilt in place if they don't fit both, 0 means unlimited
+	MemoryBudget uint64
+}
+
+// Indexer holds the index of the files below a directory and keeps it
+// up to date. Once started, it is only used by the goroutine of Start
+// or Run and the queries running on snapshots. Indexers are independent
+// of each other, but share the filters of the config package.
+type Indexer struct {
+	root            string
+	snapshotQueries bool
+	minQueryLength  int
+	priority        []string
+	tagsXattr       string
+	memoryBudget    uint64
+	// daemon is set by Start, the Indexer reports to systemd,
+	// the health checks and the metrics then
+	daemon bool
+
+	// trie, tree, trigrams, directories and tags are the copy of the
+	// index changes are applied to, snapshots holds the published one
+	trie        *trie.Trie
+	tree        *tree.Node
+	trigrams    *trigramIndex
+	directories *directoryNames
+	tags        *tagIndex
+	snapshots   snapshotState
+	// generation changes with every change of the index, cache holds
+	// the results of the searches, nil if it's disabled
+	generation atomic.Uint64
+	cache      *queryCache
+
+	// changes is the channel file changes are received on
+	changes <-chan watch.FileChange
+	// statsSignal and reconcileSignal hold a pending
+	// LogStats and Reconcile
+	statsSignal     chan struct{}
+	reconcileSignal chan struct{}
+	// fs is what the entries are read from
+	fs fileSystem
+
+	// indexing is set during a full index
+	indexing bool
+	// ready is set once the initial index completed
+	ready        bool
+	lastProgress time.Time
+	// partial answers the requests received during the initial index
+	// and a reindex, requests is the channel they are received on
+	partial  partialIndex
+	requests <-chan request.Request
+	// rebuilding is set during a reindex, serving is the old index the
+	// searches run on meanwhile if the new one is built aside
+	rebuilding bool
+	serving    *index
+
+	// paused is set while file changes are recorded instead of applied
+	paused bool
+	// pausedEvents counts the changes received while paused
+	pausedEvents uint64
+	// pendingDirectories are the directories that reported changes
+	// while paused, they are refreshed on resume
+	pendingDirectories map[string]bool
+
+	// lastIndexStats holds the statistics gathered during the last
+	// full index
+	lastIndexStats     request.StatsResponse
+	startTime          time.Time
+	eventsProcessed    uint64
+	lastReconciliation time.Time
+	recentQueries      recentQueries
+	// lastIndex and lastReconcile are when the last full index and
+	// the last reconciliation of every directory finished
+	lastIndex     time.Time
+	lastReconcile time.Time
+	// reconciling is set while a reconciliation
+	// works through the rescan queue
+	reconciling bool
+	// journal records the applied changes, nil if it's disabled
+	journal *journal
+	// failures are the directories that couldn't be read
+	// by their paths
+	failures map[string]*failure
+	// aliases are the directories whose entries are indexed at
+	// another path, directoryIDs the paths of the directories on
+	// filesystems mounted more than once
+	aliases      aliasTable
+	directoryIDs map[fileID]string
+	// visits rank the results of Jump requests
+	visits visitLog
+	// deleted are the recently deleted entries, recent the
+	// recently created ones
+	deleted tombstones
+	recent  recentEntries
+	// reconciliations are when the entries on the mounted
+	// filesystems were last read completely
+	reconciliations reconciliations
+	// coverage is what the index covers, lazy bounds the walks of
+	// what it doesn't, lazySignal holds the roots to merge
+	coverage   coverage
+	lazy       LazyOptions
+	lazySignal chan string
+	// cold holds the entries below the cold paths
+	cold coldTier
+	// pending are the vanished entries within the grace period
+	pending pendingDeletes
+	// vanishedSignal holds the directories of results that
+	// vanished, they are read again
+	vanishedSignal chan string
+	// rescans are the directories to read again
+	// between the changes and requests
+	rescans rescanQueue
+}
+
+// New returns an Indexer with an empty index, which is built by Start
+// or Run
+func New(options Options) *Indexer {
+	root := options.Root
+	if root == "" {
+		root = "/"
+	}
+	db := &Indexer{
+		root:               root,
+		snapshotQueries:    options.SnapshotQueries,
+		minQueryLength:     options.MinQueryLength,
+		priority:           options.Priority,
+		tagsXattr:          options.TagsXattr,
+		memoryBudget:       options.MemoryBudget,
+		fs:                 newOSFS(),
+		statsSignal:        make(chan struct{}, 1),
+		reconcileSignal:    make(chan struct{}, 1),
+		pendingDirectories: make(map[string]bool),
+		failures:           make(map[string]*failure),
+		directoryIDs:       make(map[fileID]string),
+		startTime:          time.Now(),
+	}
+	db.deleted.options = options.Deleted
+	db.recent.options = options.Recent
+	db.snapshots.readerWait = options.ReaderWait
+	db.coverage.root = root
+	db.lazy = options.Lazy
+	db.cold.options = options.Cold
+	db.pending.grace = options.DeleteGrace
+	// a restarted server doesn't repeat the generations sent before
+	db.generation.Store(uint64(db.startTime.UnixMicro()))
+	if options.QueryCacheSize > 0 {
+		db.cache = newQueryCache(options.QueryCacheSize)
+	}
+	db.lazySignal = make(chan string, 16)
+	db.vanishedSignal = make(chan string, 64)
+	if options.Journal.Path != "" {
+		j, err := openJournal(options.Journal)
+		if err != nil {
+			slog.Error("couldn't open journal, changes aren't recorded", "err", err)
+		} else {
+			db.journal = j
+		}
+	}
+	db.resetIndex()
+	return db
+}
+
+// Start builds the index, then applies the file changes and answers the
+// requests. It reports to systemd, the health checks and the metrics,
+// so only the server's Indexer is started with it.
 // changeSender is used to get file change messages from the caller
 // requestSender is used to get request messages from the caller
-func Start(changeSender <-chan fanotify.FileChange,
+func (db *Indexer) Start(changeSender <-chan watch.FileChange,
+	requestSender <-chan request.Request) {
+	db.daemon = true
+	metrics.NewGaugeFunc("change_queue_depth", "File changes waiting to be applied",
+		func() float64 { return float64(len(changeSender)) })
+	health.SetSources(func() int { return len(changeSender) },
+		func() bool { return len(watch.Watched()) > 0 })
+	db.serve(changeSender, requestSender)
+}
+
+// Run is like Start, but doesn't report to anything outside of the
+// Indexer, so the index can be embedded in other programs. It returns
+// once requestSender is closed.
+func (db *Indexer) Run(changeSender <-chan watch.FileChange,
+	requestSender <-chan request.Request) {
+	db.serve(changeSender, requestSender)
+}
+
+// serve builds the index and handles changes and requests
+// until requestSender is closed
+func (db *Indexer) serve(changeSender <-chan watch.FileChange,
 	requestSender <-chan request.Request) {
-	initialIndex()
+	db.changes = changeSender
+	db.requests = requestSender
+	db.partial.requests = requestSender
+	db.initialIndex()
+	if db.snapshotQueries {
+		db.enableSnapshots()
+		defer db.disableSnapshots()
+	}
+	db.ready = true
+	defer db.journal.close()
+	journalSync := db.journal.syncTicker()
+	retry := time.NewTicker(failureRetryInterval)
+	defer retry.Stop()
+	var lazyExpiry <-chan time.Time
+	if db.lazy.Expiry > 0 {
+		ticker := time.NewTicker(lazyExpiryInterval)
+		defer ticker.Stop()
+		lazyExpiry = ticker.C
+	}
+	var graceExpiry <-chan time.Time
+	if db.pending.grace > 0 {
+		ticker := time.NewTicker(graceSlotWidth)
+		defer ticker.Stop()
+		graceExpiry = ticker.C
+	}
 
+	// a wedged loop stops pinging, so systemd restarts the server
+	var watchdog <-chan time.Time
+	if db.daemon {
+		sendNotify(notify.Ready)
+		if interval, ok := notify.WatchdogInterval(); ok {
+			watchdog = time.NewTicker(interval / 2).C
+		}
+	}
+
+	if !db.answerHeld() {
+		return
+	}
 	for {
 		select {
+		case <-watchdog:
+			sendNotify(notify.Watchdog)
+		case <-journalSync:
+			db.journal.sync()
+		case <-retry.C:
+			if len(db.failures) == 0 || db.paused {
+				continue
+			}
+			db.beginWrite()
+			db.retryFailures(false)
+			db.publish()
+		case <-db.statsSignal:
+			db.logStats()
+		case <-db.reconcileSignal:
+			db.reconcile()
+		case root := <-db.lazySignal:
+			db.beginWrite()
+			db.mergeLazy(root)
+			db.publish()
+		case now := <-lazyExpiry:
+			if !db.coverage.expired(now) {
+				continue
+			}
+			db.beginWrite()
+			db.expireLazy("/", now)
+			db.publish()
+		case now := <-graceExpiry:
+			if len(db.pending.due) == 0 || db.paused {
+				continue
+			}
+			db.beginWrite()
+			db.commitDeletes(now)
+			db.publish()
+		case <-db.rescanSignal():
+			db.beginWrite()
+			db.rescanSome()
+			db.publish()
+		case dir := <-db.vanishedSignal:
+			if db.paused {
+				db.recordChange(dir)
+				continue
+			}
+			db.beginWrite()
+			db.refreshDirectory(dir)
+			db.publish()
 		case change := <-changeSender:
-			refreshDirectory(change.FolderPath)
-		case req := <-requestSender:
-			queryIndex(req)
+			db.eventsProcessed++
+			if db.paused {
+				db.recordChange(change.FolderPath)
+				continue
+			}
+			db.beginWrite()
+			db.refreshDirectory(change.FolderPath)
+			db.publish()
+		case req, ok := <-requestSender:
+			if !ok {
+				return
+			}
+			db.dispatchRequest(req)
 		}
 	}
 }
 
-var errFilter = errors.New("directory filtered")
-
-var indexTrie *trie.Trie
-var fileTree *tree.Node
+// dispatchRequest handles a request received by the goroutine of Start
+func (db *Indexer) dispatchRequest(req request.Request) {
+	if db.snapshots.enabled && request.IsQuery(req.Settings.Action) {
+		// queries run on the published copy
+		go db.handleRequest(req)
+		return
+	}
+	if changesIndex(req.Settings.Action) {
+		db.beginWrite()
+	}
+	db.handleRequest(req)
+	db.publish()
+}
 
 type indexedFile struct {
 	pathNode *tree.Node
+	isDir    bool
+}
+
+// matchesType returns whether the file passes the type filter
+// of a request
+func (f indexedFile) matchesType(typeFilter string) bool {
+	switch typeFilter {
+	case request.TypeFile:
+		return !f.isDir
+	case request.TypeDirectory:
+		return f.isDir
+	}
+	return true
+}
+
+// resetIndex replaces the index with an empty one
+func (db *Indexer) resetIndex() {
+	db.trie = trie.NewTrie()
+	db.tree = tree.New()
+	db.trigrams = newTrigramIndex()
+	db.directories = newDirectoryNames()
+	db.tags = newTagIndex()
+	db.coverage.removeLazy("/", time.Time{})
+	if db.daemon {
+		trieKeys.Set(0)
+	}
+	db.indexRebuilt()
 }
 
-func initialIndex() {
-	indexTrie = trie.NewTrie()
-	fileTree = tree.New()
+func (db *Indexer) initialIndex() {
+	db.resetIndex()
+	db.failures = make(map[string]*failure)
+	db.aliases.reset()
+	db.directoryIDs = make(map[fileID]string)
 
-	log.Println("starting to create initial index")
+	slog.Info("starting to create initial index")
 
+	config.ResetFilterCounts()
 	start := time.Now()
-	dirname := "/"
-	files, directories := addToIndexRecursively(dirname)
+	// filesystems mounted during the walk may have been missed
+	table := mounts.All()
+	dirname := db.root
+	db.setIndexing(true)
+	files, directories := db.addToIndexRecursively(dirname)
+	db.setIndexing(false)
+	db.indexed(files, directories, start, table)
+	slog.Info("finished creating initial index", "files", files,
+		"directories", directories, "duration", time.Since(start))
+	db.buildCold()
+	db.PrintMemUsage()
+}
+
+// indexed records a full index of files and directories, started
+// at start with the mount table
+func (db *Indexer) indexed(files, directories uint64, start time.Time, table []mounts.Mount) {
 	end := time.Now()
+	db.lastIndex = end
+	db.reconciliations.record(db.root, table, start)
 
-	log.Println("finished creating initial index")
-	log.Printf("indexed %d files and %d directories in %f seconds",
-		files, directories, end.Sub(start).Seconds())
-	PrintMemUsage()
+	db.lastIndexStats = request.StatsResponse{
+		IndexedFiles:       files,
+		IndexedDirectories: directories,
+		IndexDuration:      end.Sub(start).Seconds(),
+		FilterRejections:   config.FilterCounts(),
+	}
+	if db.daemon {
+		indexedFilesGauge.Set(int64(files))
+		indexedDirectoriesGauge.Set(int64(directories))
+		sendNotify(notify.Status("indexed %d files and %d directories", files, directories))
+	}
 }
 
-func refreshDirectory(path string) {
-	log.Println("refreshing directory", path)
-	newDirents, err := godirwalk.ReadDirents(path, nil)
-	if err != nil {
-		log.Println("warning: couldn't read directory", path, err)
+// setIndexing records whether a full index is running
+func (db *Indexer) setIndexing(indexing bool) {
+	db.indexing = indexing
+	if db.daemon {
+		health.SetIndexing(indexing)
 	}
+}
 
-	newNames := make([]string, 0, len(newDirents))
-	nameDirents := make(map[string]godirwalk.Dirent, len(newNames))
-	for _, dirent := range newDirents {
-		name := dirent.Name()
-		if config.IsPathFiltered(filepath.Join(path, name)) {
-			// log.Println("ignoring filtered file", name)
-			continue
+func (db *Indexer) refreshDirectory(path string) {
+	// the entries below aliases are indexed at the canonical path
+	if resolved, ok := db.aliases.resolve(path); ok {
+		path = resolved
+	}
+	if config.IsOnFilteredFS(path) {
+		return
+	}
+	// the entries below cold paths are read again with the tier
+	if db.cold.covers(path) {
+		return
+	}
+
+	// the contents of directories at the depth limit aren't indexed
+	if remaining, limited := config.RemainingDepth(path); limited && remaining <= 0 {
+		return
+	}
+
+	// a directory missing from the index is added with everything
+	// below it by refreshing its parent, the events of its entries can
+	// come first. Indexing them alone would leave it out of the trie
+	// while the tree holds it, so the parent wouldn't add it anymore.
+	if _, err := db.tree.Lookup(path); err != nil && path != db.root {
+		if _, ok := below(path, db.root); ok {
+			slog.Debug("refreshing the parent of a directory that isn't indexed", "path", path)
+			db.refreshDirectory(filepath.Dir(path))
+			return
 		}
-		newNames = append(newNames, name)
-		nameDirents[dirent.Name()] = *dirent
 	}
 
-	oldNames, err := fileTree.GetChildren(path)
+	defer refreshDuration.ObserveSince(time.Now())
+
+	ignoreRulesChanged, err := config.LoadIgnoreFile(path)
 	if err != nil {
-		log.Println("couldn't get children of path", path, err)
+		slog.Warn("couldn't load ignore file", "dir", path, "err", err)
 	}
 
-	createdNames, deletedNames := sliceDifference(newNames, oldNames)
+	slog.Debug("refreshing directory", "path", path)
+	db.lastReconciliation = time.Now()
+	if db.daemon {
+		health.Refreshed()
+	}
+	newEntries, err := db.fs.ReadDirents(path)
+	db.directoryRead(path, err)
+
+	newNames := make([]string, 0, len(newEntries))
+	for _, entry := range newEntries {
+		decision := config.FilterPath(filepath.Join(path, entry.name))
+		if decision == config.Excluded ||
+			(decision == config.Traversed && !entry.isDir) {
+			continue
+		}
+		newNames = append(newNames, entry.name)
+	}
+
+	createdNames, deletedNames := db.diffDirectory(path, newNames)
+	db.keepPending(path, newNames)
+	deletedNames = db.deferDeletes(path, deletedNames, time.Now())
+	db.checkRemovedCount(path, deletedNames)
 	if len(createdNames) > 0 {
-		log.Printf("indexing new files %v\n", createdNames)
+		slog.Debug("indexing new files", "dir", path, "names", createdNames)
 	}
 	if len(deletedNames) > 0 {
-		log.Printf("removing deleted files %v from index", deletedNames)
+		slog.Debug("removing deleted files from index", "dir", path, "names", deletedNames)
 	}
 
+	now := time.Now()
 	for _, name := range createdNames {
-		dirent := nameDirents[name]
 		pathName := filepath.Join(path, name)
 		if config.IsPathFiltered(pathName) {
 			continue
 		}
-		addToIndex(path, name, dirent)
+		if added, isDir := db.addToIndex(path, name); added {
+			db.recordCreated(pathName, isDir, now)
+		}
 	}
 
 	for _, name := range deletedNames {
-		pathName := filepath.Join(path, name)
-		deleteFromIndex(path, name)
-		fileTree.DeleteAt(pathName)
+		db.removeFromIndex(path, name)
+	}
+	db.journalChanges(path, createdNames, deletedNames)
+
+	if ignoreRulesChanged {
+		slog.Info("ignore file changed, reconciling", "dir", path)
+		db.reconcileSubdirectories(path)
+	}
+}
+
+// checkRemovedCount logs an error if removing the entries names of the
+// directory at path would remove more entries than it has below it,
+// which means the counters of the tree are off
+func (db *Indexer) checkRemovedCount(path string, names []string) {
+	node, err := db.tree.Lookup(path)
+	if err != nil || len(names) == 0 {
+		return
+	}
+	var removed int
+	for _, name := range names {
+		if child, err := db.tree.Lookup(filepath.Join(path, name)); err == nil {
+			removed += 1 + child.Count()
+		}
+	}
+	if removed > node.Count() {
+		slog.Error("refresh removes more entries than the directory has below it", "dir", path,
+			"removed", removed, "entries", node.Count())
 	}
 }
 
+// reconcileSubdirectories refreshes all directories below path,
+// so changed ignore rules are applied to the whole subtree
+func (db *Indexer) reconcileSubdirectories(path string) {
+	for _, subdirectory := range db.subdirectories(path) {
+		db.refreshDirectory(subdirectory)
+		db.reconcileSubdirectories(subdirectory)
+	}
+}
+
+// subdirectories returns the directories in the directory at path
+// which are reconciled, it checks the aliases among them instead
+func (db *Indexer) subdirectories(path string) []string {
+	entries, err := db.fs.ReadDirents(path)
+	if err != nil {
+		slog.Warn("couldn't read directory", "path", path, "err", err)
+		return nil
+	}
+
+	var subdirectories []string
+	for _, entry := range entries {
+		if !entry.isDir {
+			continue
+		}
+
+		pathName := filepath.Join(path, entry.name)
+		if config.IsPathFiltered(pathName) {
+			continue
+		}
+		if db.aliases.isAlias(pathName) {
+			db.checkAlias(pathName)
+			continue
+		}
+		if db.cold.covers(pathName) {
+			continue
+		}
+		subdirectories = append(subdirectories, pathName)
+	}
+	return subdirectories
+}
+
+// diffDirectory compares the names found in the directory at path
+// with the indexed ones
+func (db *Indexer) diffDirectory(path string, newNames []string) (created, deleted []string) {
+	oldNames, err := db.tree.GetChildren(path)
+	if err != nil {
+		slog.Debug("directory wasn't indexed before", "path", path, "err", err)
+	}
+
+	return sliceDifference(newNames, oldNames)
+}
+
 func sliceDifference(sliceA, sliceB []string) ([]string, []string) {
 	mapA := sliceToSet(sliceA)
 	mapB := sliceToSet(sliceB)
@@ -138,108 +641,501 @@ func setToSlice(set map[string]bool) []string {
 	return createSlice
 }
 
-func addToIndex(path, name string, dirent godirwalk.Dirent) {
+// addToIndex adds the entry name found in the directory at path by a
+// refresh. It is stat'ed first, temporary files are often deleted
+// before they are added and the type of a dirent may be outdated.
+func (db *Indexer) addToIndex(path, name string) (added, isDir bool) {
+	files, directories := db.addToIndexRecursively(filepath.Join(path, name))
+	return files+directories > 0, directories > 0
+}
+
+// addEntry makes the file or directory at pathname searchable,
+// name is its last element
+func (db *Indexer) addEntry(pathname, name string, isDir bool) {
+	newNode := db.tree.Add(pathname)
+	db.indexTrieAdd(name, indexedFile{newNode, isDir})
+	db.recordIndexChange(indexChange{changeAdd, pathname, name, isDir, nil})
+	db.readTags(newNode, pathname)
+}
+
+// deleteFromIndex removes the entry at path/name and all entries
+// below it from the trie, keeping them as recently deleted
+func (db *Indexer) deleteFromIndex(path, name string) {
 	pathName := filepath.Join(path, name)
 
-	if dirent.IsDir() {
-		addToIndexRecursively(pathName)
-	} else {
-		newNode := fileTree.Add(pathName)
-		indexTrieAdd(name, indexedFile{newNode})
+	now := time.Now()
+	err := db.tree.Walk(pathName, 0, func(walked string, isLeaf bool) error {
+		if file, ok := db.indexTrieDelete(filepath.Base(walked), filepath.Dir(walked)); ok {
+			db.bury(walked, file.isDir, now)
+		}
+		return nil
+	})
+	if err != nil {
+		// the entry isn't in the tree, but may still be in the trie
+		if file, ok := db.indexTrieDelete(name, path); ok {
+			db.bury(pathName, file.isDir, now)
+		}
 	}
 }
 
-func deleteFromIndex(path, name string) {
+// removeFromIndex removes a file or directory and everything below it
+// from the index
+func (db *Indexer) removeFromIndex(path, name string) {
 	pathName := filepath.Join(path, name)
+	db.removeEntry(path, name)
+	config.UnloadIgnoreFiles(pathName, true)
+	db.removeAliases(pathName)
+}
+
+// removeEntry removes a file or directory and everything below it
+// from the trie and the tree
+func (db *Indexer) removeEntry(path, name string) {
+	pathName := filepath.Join(path, name)
+	db.deleteFromIndex(path, name)
+	db.tree.DeleteAt(pathName)
+	db.recordIndexChange(indexChange{changeRemove, pathName, name, false, nil})
+}
 
-	indexTrieDelete(name, path)
-	children, err := fileTree.GetChildren(pathName)
+// removeFilteredEntries removes all indexed paths below path
+// that are filtered by the current configuration
+func (db *Indexer) removeFilteredEntries(path string) {
+	children, err := db.tree.GetChildren(path)
 	if err != nil {
-		// fmt.Println("warning:", err)
 		return
 	}
 
-	for _, child := range children {
-		deleteFromIndex(pathName, child)
+	for _, name := range children {
+		pathName := filepath.Join(path, name)
+		if config.IsPathFiltered(pathName) {
+			db.removeFromIndex(path, name)
+			continue
+		}
+		db.removeFilteredEntries(pathName)
 	}
 }
 
-func addToIndexRecursively(path string) (uint64, uint64) {
-	var directoryCount uint64
-	var fileCount uint64
-	godirwalk.Walk(path, &godirwalk.Options{
-		Callback: func(osPathname string, de *godirwalk.Dirent) error {
-			if config.IsPathFiltered(osPathname) {
-				return errFilter
-			}
+// addToIndexRecursively adds the file or directory at path and
+// everything below it to the index, it returns the number of files
+// and directories added
+func (db *Indexer) addToIndexRecursively(path string) (uint64, uint64) {
+	isDir, err := db.fs.Lstat(path)
+	if vanished(err) {
+		slog.Debug("entry vanished before it was indexed", "path", path, "err", err)
+		return 0, 0
+	} else if err != nil {
+		slog.Warn("couldn't index path", "path", path, "err", err)
+		return 0, 0
+	}
 
-			if de.IsDir() {
-				directoryCount++
-			} else {
-				fileCount++
-			}
+	w := indexWalk{fs: db.fs, action: indexAction{db}, read: db.directoryRead,
+		canonical: db.canonicalDirectory, cold: db.cold.isRoot}
+	if db.indexing {
+		w.progress = db.reportProgress
+		w.root = path
+		if len(db.priority) > 0 {
+			w.priority = db.priority
+			w.prioritized = db.priorityIndexed
+		}
+		if db.partial.requests != nil {
+			w.progress = db.indexProgress
+			w.entering = db.partial.entering
+			w.walked = db.walkedTopLevel
+		}
+	}
+	w.visit(nil, path, filepath.Base(path), isDir)
+	return w.files, w.directories
+}
+
+// walkAction is what an indexWalk does with the entries it visits.
+// The nodes it returns are handed back as the parents of the entries
+// below them, actions that don't build a tree return nil.
+type walkAction interface {
+	// add adds a searchable entry
+	add(parent *tree.Node, path, name string, isDir bool) *tree.Node
+	// traverse adds a directory that is walked, but not searchable
+	traverse(parent *tree.Node, path, name string) *tree.Node
+	// enter is called before the entries of the directory at path
+	// are visited, it returns the parent passed to them
+	enter(node *tree.Node, path string, entries int) *tree.Node
+}
+
+// indexWalk walks a directory depth first, applying the filters.
+// Unlike godirwalk.Walk it knows the tree node of the parent of each
+// entry and the number of entries in each directory, so adding an
+// entry doesn't look up or copy its path and the children of a node
+// are allocated at once.
+type indexWalk struct {
+	fs     fileSystem
+	action walkAction
+	// progress is called with the number of entries added so far,
+	// if it is set
+	progress func(added uint64)
+	// read is called with the result of reading each directory,
+	// if it is set
+	read func(path string, err error)
+	// canonical is called for each directory before its entries
+	// are walked, if it is set, with the device number of the
+	// directory being walked. It returns the device number of the
+	// directory and, for aliases, the canonical path, the entries
+	// of aliases aren't walked.
+	canonical func(path string, dev uint64) (uint64, string)
+	dev       uint64
+	// cold returns whether the entries of the directory at path
+	// are kept in the cold tier, if it is set, they aren't walked
+	cold func(path string) bool
+	// unlimited ignores the depth limits, unfiltered the path filters
+	unlimited  bool
+	unfiltered bool
+	// stop is called before each entry if it is set,
+	// the walk ends once it returns true
+	stop func() bool
+	// priority are the directories walked first, in order, and
+	// prioritized is called once the entries of root leading to
+	// them are walked
+	root        string
+	priority    []string
+	prioritized func()
+	// entering is called with the paths of the entries of root before
+	// they are visited, walked with each of them once it was visited,
+	// if they are set
+	entering    func(paths []string)
+	walked      func(path string)
+	files       uint64
+	directories uint64
+	entries     []dirEntry
+}
+
+// visit adds the entry at path, name is its last element. parent is
+// its node in the tree, nil if it isn't known.
+func (w *indexWalk) visit(parent *tree.Node, path, name string, isDir bool) {
+	if w.stop != nil && w.stop() {
+		return
+	}
+	filter := config.Included
+	if !w.unfiltered {
+		filter = config.FilterPath(path)
+	}
+	switch filter {
+	case config.Excluded:
+		return
+	case config.Traversed:
+		if !isDir {
+			return
+		}
+		w.visitChildren(w.action.traverse(parent, path, name), path)
+		return
+	}
+
+	// filesystems can only change at mount points
+	if isDir && mounts.IsMountPoint(path) && config.IsOnFilteredFS(path) {
+		return
+	}
+
+	remaining, limited := config.RemainingDepth(path)
+	limited = limited && !w.unlimited
+	if limited && remaining < 0 {
+		return
+	}
+
+	// directories at the depth limit are searchable, their contents
+	// are not, and the entries of aliases are indexed elsewhere
+	descend := isDir && !(limited && remaining == 0)
+	descend = descend && (w.cold == nil || !w.cold(path))
+	parentDev, dev := w.dev, w.dev
+	if descend && w.canonical != nil {
+		var canonical string
+		dev, canonical = w.canonical(path, parentDev)
+		descend = canonical == ""
+	}
+
+	// directories are read before they are added, so one deleted
+	// since it was listed isn't added at all
+	start := len(w.entries)
+	readErr := error(nil)
+	if descend {
+		readErr = w.readChildren(path)
+		if vanished(readErr) {
+			w.entries = w.entries[:start]
+			slog.Debug("directory vanished before it was indexed", "path", path, "err", readErr)
+			return
+		}
+	}
+
+	if isDir {
+		w.directories++
+	} else {
+		w.files++
+	}
+	if w.progress != nil {
+		w.progress(w.files + w.directories)
+	}
+
+	node := w.action.add(parent, path, name, isDir)
+	if !descend || readErr != nil {
+		w.entries = w.entries[:start]
+		return
+	}
+	w.dev = dev
+	w.walkChildren(node, path, start)
+	w.dev = parentDev
+	w.entries = w.entries[:start]
+}
+
+// vanished returns whether err means the entry was deleted, or
+// replaced by one that isn't a directory
+func vanished(err error) bool {
+	return os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR)
+}
+
+// readChildren appends the entries of the directory at path to the
+// entries of the walk
+func (w *indexWalk) readChildren(path string) error {
+	var err error
+	w.entries, err = w.fs.ReadEntries(path, w.entries)
+	if w.read != nil {
+		w.read(path, err)
+	}
+	if err != nil && !vanished(err) {
+		slog.Warn("couldn't index path", "path", path, "err", err)
+	}
+	return err
+}
+
+// visitChildren loads the ignore file of the directory at path
+// and visits its entries
+func (w *indexWalk) visitChildren(node *tree.Node, path string) {
+	// the entries of the directories being walked are a stack,
+	// so the slice is only grown for the deepest directory
+	start := len(w.entries)
+	defer func() { w.entries = w.entries[:start] }()
+	if err := w.readChildren(path); err != nil {
+		if vanished(err) {
+			slog.Debug("directory vanished before it was indexed", "path", path, "err", err)
+		}
+		return
+	}
+	w.walkChildren(node, path, start)
+}
 
-			newNode := fileTree.Add(string(osPathname))
-			newFile := indexedFile{newNode}
-			indexTrieAdd(string(de.Name()), newFile)
+// walkChildren loads the ignore file of the directory at path and
+// visits its entries, those of the walk from start on
+func (w *indexWalk) walkChildren(node *tree.Node, path string, start int) {
+	end := len(w.entries)
+
+	// most directories have no ignore file, looking for it
+	// in the entries saves opening it
+	hasIgnoreFile := false
+	for _, entry := range w.entries[start:end] {
+		hasIgnoreFile = hasIgnoreFile || entry.name == config.IgnoreFileName
+	}
+	if hasIgnoreFile {
+		loadIgnoreFile(path)
+	} else {
+		config.UnloadIgnoreFiles(path, false)
+	}
 
-			return nil
-		},
-		Unsorted: true,
-		ErrorCallback: func(_ string, err error) godirwalk.ErrorAction {
-			if err == errFilter {
-				return godirwalk.SkipNode
+	prefix := path + "/"
+	if path == "/" {
+		prefix = path
+	}
+	if w.leadsToPriority(prefix) {
+		entries := w.entries[start:end]
+		sort.SliceStable(entries, func(i, j int) bool {
+			return w.priorityRank(prefix+entries[i].name) <
+				w.priorityRank(prefix+entries[j].name)
+		})
+	}
+	node = w.action.enter(node, path, end-start)
+	if path == w.root && w.entering != nil {
+		paths := make([]string, 0, end-start)
+		for _, entry := range w.entries[start:end] {
+			paths = append(paths, prefix+entry.name)
+		}
+		w.entering(paths)
+	}
+	// the entries of the root leading to priority directories come
+	// first, once they are walked the priority directories are done
+	walkedPriority := false
+	for i := start; i < end; i++ {
+		// visiting appends to the entries, which can move them
+		entry := w.entries[i]
+		if path == w.root && w.prioritized != nil {
+			if w.priorityRank(prefix+entry.name) < len(w.priority) {
+				walkedPriority = true
+			} else if walkedPriority {
+				w.donePrioritizing()
 			}
-			// fmt.Println(err)
-			return godirwalk.SkipNode
-		},
-	})
+		}
+		w.visit(node, prefix+entry.name, entry.name, entry.isDir)
+		if path == w.root && w.walked != nil {
+			w.walked(prefix + entry.name)
+		}
+	}
+	if walkedPriority && w.prioritized != nil {
+		w.donePrioritizing()
+	}
+}
+
+// leadsToPriority returns whether a priority directory
+// starts with prefix
+func (w *indexWalk) leadsToPriority(prefix string) bool {
+	for _, p := range w.priority {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
 
-	return fileCount, directoryCount
+// priorityRank returns the position of the first priority directory
+// that is path or below it, len(w.priority) if there is none
+func (w *indexWalk) priorityRank(path string) int {
+	for i, p := range w.priority {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			return i
+		}
+	}
+	return len(w.priority)
+}
+
+// donePrioritizing calls prioritized once
+func (w *indexWalk) donePrioritizing() {
+	w.prioritized()
+	w.prioritized = nil
 }
 
-func indexTrieAdd(name string, index indexedFile) {
+// indexAction adds the entries of a walk to the index
+type indexAction struct {
+	db *Indexer
+}
+
+func (a indexAction) add(parent *tree.Node, path, name string, isDir bool) *tree.Node {
+	node := a.addNode(parent, path, name)
+	a.db.indexTrieAdd(name, indexedFile{node, isDir})
+	a.db.recordIndexChange(indexChange{changeAdd, path, name, isDir, nil})
+	a.db.readTags(node, path)
+	return node
+}
+
+// traverse keeps the directory in the tree so refreshes can
+// diff against it, but doesn't make it searchable
+func (a indexAction) traverse(parent *tree.Node, path, name string) *tree.Node {
+	node := a.addNode(parent, path, name)
+	a.db.recordIndexChange(indexChange{changeTraverse, path, name, true, nil})
+	return node
+}
+
+func (a indexAction) enter(node *tree.Node, path string, entries int) *tree.Node {
+	if path == "/" {
+		// Add puts an empty name below the root for "/",
+		// the entries of "/" are children of the root itself
+		node = a.db.tree
+	}
+	node.Grow(entries)
+	return node
+}
+
+// addNode adds the entry at path to the tree. Nothing below the
+// path the walk started at is in the tree yet, so entries with a
+// known parent are added without looking for an existing node.
+func (a indexAction) addNode(parent *tree.Node, path, name string) *tree.Node {
+	if parent == nil {
+		return a.db.tree.Add(path)
+	}
+	return parent.AddChild(name)
+}
+
+func loadIgnoreFile(dir string) {
+	if _, err := config.LoadIgnoreFile(dir); err != nil {
+		slog.Warn("couldn't load ignore file", "dir", dir, "err", err)
+	}
+}
+
+func (db *Indexer) indexTrieAdd(name string, index indexedFile) {
 	prefix := trie.Prefix(name)
-	if item := indexTrie.Get(prefix); item != nil {
-		fileList := item.([]indexedFile)
-		fileList = append(fileList, index)
-		indexTrie.Set(prefix, fileList)
+	if item := db.trie.Get(prefix); item != nil {
+		entriesOf(item).add(index)
 	} else {
-		indexTrie.Insert(prefix, []indexedFile{index})
+		db.trie.Insert(prefix, newEntryList(index))
+		if db.daemon && !db.snapshots.replaying {
+			trieKeys.Add(1)
+		}
+		db.trigrams.add(name)
+	}
+	if index.isDir {
+		db.directories.add(name, index.pathNode)
 	}
 }
 
-func indexTrieDelete(name, path string) {
+// indexTrieDelete removes the entry at path/name from the trie,
+// it returns the entry if it was there
+func (db *Indexer) indexTrieDelete(name, path string) (removed indexedFile, ok bool) {
 	prefix := trie.Prefix(name)
-	filePath := filepath.Join(path, name)
-	if item := indexTrie.Get(prefix); item != nil {
-		fileList := item.([]indexedFile)
-		for i := 0; i < len(fileList); i++ {
-			index := fileList[i]
-			existingPath := index.pathNode.GetPath()
-
-			if existingPath != filePath {
-				continue
-			}
+	item := db.trie.Get(prefix)
+	if item == nil {
+		return indexedFile{}, false
+	}
+	list := entriesOf(item)
+	removed, ok = list.removeByPath(filepath.Join(path, name))
+	if !ok {
+		// directories that are only traversed aren't in the trie,
+		// anything else left behind is a stale result
+		slog.Debug("entry to remove isn't in the index", "path", filepath.Join(path, name))
+		return indexedFile{}, false
+	}
+	if removed.isDir {
+		db.directories.remove(name, removed.pathNode)
+	}
+	db.tags.remove(removed.pathNode)
 
-			fileList[i] = fileList[len(fileList)-1]
-			fileList = fileList[:len(fileList)-1]
-			break
+	// names without entries are dropped, so every key of the
+	// trie is a name of an indexed entry
+	if list.len() == 0 {
+		db.trie.Delete(prefix)
+		if db.daemon && !db.snapshots.replaying {
+			trieKeys.Add(-1)
 		}
-		indexTrie.Set(prefix, fileList)
+		db.trigrams.remove(name)
+	}
+	return removed, true
+}
+
+func (db *Indexer) PrintMemUsage() {
+	var args []interface{}
+	for _, stat := range db.memUsage() {
+		args = append(args, stat.name, stat.value)
 	}
+	slog.Info("memory statistics", args...)
+}
+
+type memStat struct {
+	name  string
+	value uint64
 }
 
-func PrintMemUsage() {
+// memUsage returns the memory use of the server and the size of the index
+func (db *Indexer) memUsage() []memStat {
 	runtime.GC()
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
 
-	log.Println("Memory Statistics:")
-	log.Printf("\tAlloc = %v MiB", bToMb(m.Alloc))
-	log.Printf("\tTotalAlloc = %v MiB", bToMb(m.TotalAlloc))
-	log.Printf("\tSys = %v MiB", bToMb(m.Sys))
+	var trieKeys, trieEntries uint64
+	db.trie.Visit(func(prefix trie.Prefix, item trie.Item) error {
+		trieKeys++
+		trieEntries += uint64(entriesOf(item).len())
+		return nil
+	})
+
+	return []memStat{
+		{"alloc_mib", bToMb(m.Alloc)},
+		{"total_alloc_mib", bToMb(m.TotalAlloc)},
+		{"sys_mib", bToMb(m.Sys)},
+		{"trie_keys", trieKeys},
+		{"trie_entries", trieEntries},
+		{"tree_nodes", uint64(db.tree.Count())},
+	}
 }
+
 func bToMb(b uint64) uint64 {
 	return b / 1024 / 1024
 }
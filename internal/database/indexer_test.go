@@ -0,0 +1,608 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/internal/watch"
+	"github.com/ozeidan/gosearch/pkg/tree"
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+func TestAddToIndexRecursively(t *testing.T) {
+	root := t.TempDir()
+	var want []string
+	for _, entry := range syntheticEntries(300) {
+		path := filepath.Join(root, entry.path)
+		var err error
+		if entry.isDir {
+			err = os.MkdirAll(path, 0755)
+		} else if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			err = ioutil.WriteFile(path, nil, 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, path)
+	}
+	ignoreFile := filepath.Join(root, "synthetic", config.IgnoreFileName)
+	if err := ioutil.WriteFile(ignoreFile, []byte("*.so\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer config.UnloadIgnoreFiles(root, true)
+	want = append(want, root, filepath.Join(root, "synthetic"), ignoreFile)
+
+	db := New(Options{Root: root})
+	files, directories := db.addToIndexRecursively(root)
+
+	// the ignore file is loaded before the entries next to it are walked
+	kept := want[:0]
+	for _, path := range want {
+		if !config.IsPathFiltered(path) {
+			kept = append(kept, path)
+		}
+	}
+	if len(kept) == len(want) {
+		t.Fatal("the ignore file didn't exclude anything")
+	}
+	want = kept
+	sort.Strings(want)
+	if int(files+directories) != len(want) {
+		t.Errorf("indexed %d files and %d directories, want %d paths",
+			files, directories, len(want))
+	}
+
+	var got []string
+	db.trie.Visit(func(prefix trie.Prefix, item trie.Item) error {
+		for _, file := range entriesOf(item).entries {
+			got = append(got, file.pathNode.GetPath())
+		}
+		return nil
+	})
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("indexed paths differ from the created ones:\n%v\nwant\n%v", got, want)
+	}
+
+	// path searches skip subtrees whose names lack the query's characters
+	for _, path := range want[len(want)-10:] {
+		found := false
+		query := strings.ReplaceAll(path, "/", "")
+		for _, result := range runQuery(db, request.PathSearch, query, 0) {
+			found = found || result == path
+		}
+		if !found {
+			t.Errorf("path search for %s didn't find it", path)
+		}
+	}
+}
+
+// runIndexer runs an Indexer over a new directory holding paths,
+// whose names end with a slash for directories. It returns the
+// directory and the channels the Indexer serves.
+func runIndexer(t *testing.T, snapshots bool, paths ...string) (
+	string, chan<- watch.FileChange, chan<- request.Request) {
+	root := t.TempDir()
+	for _, entry := range paths {
+		path := filepath.Join(root, entry)
+		var err error
+		if strings.HasSuffix(entry, "/") {
+			err = os.MkdirAll(path, 0755)
+		} else if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			err = ioutil.WriteFile(path, nil, 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes := make(chan watch.FileChange)
+	requests := make(chan request.Request)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		New(Options{Root: root, SnapshotQueries: snapshots}).Run(changes, requests)
+	}()
+	t.Cleanup(func() {
+		close(requests)
+		<-done
+	})
+	return root, changes, requests
+}
+
+// ask sends a request to an Indexer and returns its responses,
+// searches wait until the initial index is complete
+func ask(requests chan<- request.Request, action int, query string) []string {
+	req := request.Request{
+		Query:           query,
+		Settings:        request.Settings{Action: action, WaitIndex: request.IsQuery(action)},
+		ResponseChannel: make(chan string),
+		Done:            make(chan struct{}),
+	}
+	requests <- req
+
+	var lines []string
+	for line := range req.ResponseChannel {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestIndexer_Isolation(t *testing.T) {
+	for _, snapshots := range []bool{false, true} {
+		snapshots := snapshots
+		t.Run(fmt.Sprintf("snapshots_%v", snapshots), func(t *testing.T) {
+			t.Parallel()
+
+			rootA, changesA, requestsA := runIndexer(t, snapshots,
+				"shared.txt", "only_a.txt", "dir/nested_a.txt")
+			rootB, _, requestsB := runIndexer(t, snapshots,
+				"shared.txt", "only_b.txt", "b1/", "b2/")
+
+			// each Indexer only finds the entries below its own root
+			for _, tt := range []struct {
+				requests chan<- request.Request
+				query    string
+				want     []string
+			}{
+				{requestsA, "shared", []string{filepath.Join(rootA, "shared.txt")}},
+				{requestsB, "shared", []string{filepath.Join(rootB, "shared.txt")}},
+				{requestsA, "only_b", nil},
+				{requestsB, "nested", nil},
+			} {
+				if got := ask(tt.requests, request.SubStringSearch, tt.query); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("searching for %s got %q, want %q", tt.query, got, tt.want)
+				}
+			}
+
+			// changes and pausing are applied to a single Indexer
+			if err := ioutil.WriteFile(filepath.Join(rootA, "added.txt"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			changesA <- watch.FileChange{FolderPath: rootA, ChangeType: watch.Creation}
+			ask(requestsA, request.Pause, "")
+			if got := ask(requestsA, request.PrefixSearch, "added"); len(got) != 1 {
+				t.Errorf("the changed Indexer found %q", got)
+			}
+			if got := ask(requestsB, request.PrefixSearch, "added"); got != nil {
+				t.Errorf("the other Indexer found %q", got)
+			}
+
+			var statsA, statsB request.StatsResponse
+			for _, s := range []struct {
+				requests chan<- request.Request
+				stats    *request.StatsResponse
+			}{{requestsA, &statsA}, {requestsB, &statsB}} {
+				lines := ask(s.requests, request.Stats, "")
+				if len(lines) != 1 {
+					t.Fatalf("got %q for stats", lines)
+				}
+				if err := json.Unmarshal([]byte(lines[0]), s.stats); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if statsA.IndexedFiles != 3 || statsA.IndexedDirectories != 2 ||
+				statsA.EventsProcessed != 1 || !statsA.Paused {
+				t.Errorf("stats of the changed Indexer %+v", statsA)
+			}
+			if statsB.IndexedFiles != 2 || statsB.IndexedDirectories != 3 ||
+				statsB.EventsProcessed != 0 || statsB.Paused {
+				t.Errorf("stats of the other Indexer %+v", statsB)
+			}
+		})
+	}
+}
+
+// newFakeIndexer returns an Indexer with options that indexed fs,
+// the root defaults to /r
+func newFakeIndexer(fs *fakeFS, options Options) *Indexer {
+	if options.Root == "" {
+		options.Root = "/r"
+	}
+	db := New(options)
+	db.fs = fs
+	db.initialIndex()
+	return db
+}
+
+// indexedPaths returns the searchable paths of db, with a slash after
+// the directories. It fails if the tree holds other paths below /r.
+func indexedPaths(t *testing.T, db *Indexer) []string {
+	t.Helper()
+	var paths, nodes []string
+	db.trie.Visit(func(prefix trie.Prefix, item trie.Item) error {
+		for _, file := range entriesOf(item).entries {
+			path := file.pathNode.GetPath()
+			nodes = append(nodes, path)
+			if file.isDir {
+				path += "/"
+			}
+			paths = append(paths, path)
+		}
+		return nil
+	})
+
+	var treeNodes []string
+	db.tree.Clone(func(node, clone *tree.Node) {
+		if path := node.GetPath(); path == "/r" || strings.HasPrefix(path, "/r/") {
+			treeNodes = append(treeNodes, path)
+		}
+	})
+	sort.Strings(nodes)
+	sort.Strings(treeNodes)
+	if !reflect.DeepEqual(nodes, treeNodes) {
+		t.Errorf("the trie holds %q, the tree %q", nodes, treeNodes)
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+// addFilter adds a glob filter until the test ends
+func addFilter(t *testing.T, pattern string) {
+	t.Helper()
+	if _, err := config.AddGlobFilter(pattern); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { config.RemoveGlobFilter(pattern) })
+}
+
+func TestInitialIndex_FakeFS(t *testing.T) {
+	tests := []struct {
+		name     string
+		paths    []string
+		readErrs map[string]error
+		filter   string
+		want     []string
+	}{
+		{
+			"tree",
+			[]string{"/r/a.txt", "/r/src/main.go", "/r/src/empty/", "/other/b.txt"},
+			nil, "",
+			[]string{"/r/", "/r/a.txt", "/r/src/", "/r/src/empty/", "/r/src/main.go"},
+		},
+		{
+			"missing_root",
+			[]string{"/other/b.txt"},
+			nil, "",
+			nil,
+		},
+		{
+			"root_is_a_file",
+			[]string{"/r"},
+			nil, "",
+			[]string{"/r"},
+		},
+		{
+			"unreadable_directory",
+			[]string{"/r/a.txt", "/r/private/secret.txt", "/r/private/inner/"},
+			map[string]error{"/r/private": syscall.EACCES}, "",
+			[]string{"/r/", "/r/a.txt", "/r/private/"},
+		},
+		{
+			// the directory was listed, but deleted before it was read
+			"vanished_directory",
+			[]string{"/r/a.txt", "/r/gone/b.txt"},
+			map[string]error{"/r/gone": syscall.ENOENT}, "",
+			[]string{"/r/", "/r/a.txt"},
+		},
+		{
+			"filtered_files",
+			[]string{"/r/a.txt", "/r/debug.log", "/r/logs/old.log", "/r/logs/keep.txt"},
+			nil, "**/*.log",
+			[]string{"/r/", "/r/a.txt", "/r/logs/", "/r/logs/keep.txt"},
+		},
+		{
+			"filtered_directory",
+			[]string{"/r/a.txt", "/r/build/out/bin", "/r/src/build.go"},
+			nil, "/r/build",
+			[]string{"/r/", "/r/a.txt", "/r/src/", "/r/src/build.go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.filter != "" {
+				addFilter(t, tt.filter)
+			}
+			fs := newFakeFS(tt.paths...)
+			for path, err := range tt.readErrs {
+				fs.readErrs[path] = err
+			}
+
+			db := newFakeIndexer(fs, Options{})
+			if got := indexedPaths(t, db); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("indexed %q, want %q", got, tt.want)
+			}
+			stats := db.currentStats()
+			if int(stats.IndexedFiles+stats.IndexedDirectories) != len(tt.want) {
+				t.Errorf("counted %d files and %d directories, want %d paths",
+					stats.IndexedFiles, stats.IndexedDirectories, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestRefreshDirectory_FakeFS(t *testing.T) {
+	initial := []string{
+		"/r/a.txt",
+		"/r/docs/readme.md",
+		"/r/docs/old.md",
+		"/r/deep/1/2/3/4/leaf.txt",
+		"/r/deep/1/2/other.txt",
+		"/r/deep/1/sibling/",
+	}
+	tests := []struct {
+		name string
+		// change is applied to the filesystem before refreshing
+		change func(fs *fakeFS)
+		filter string
+		// refresh is the directory refreshed, everything below it
+		// is reconciled as well if recursive is set
+		refresh   string
+		recursive bool
+		// added and removed are the paths expected to be added to
+		// and removed from the initial index
+		added, removed []string
+	}{
+		{
+			name:    "unchanged",
+			change:  func(fs *fakeFS) {},
+			refresh: "/r/docs",
+		},
+		{
+			name:    "created_file",
+			change:  func(fs *fakeFS) { fs.add("/r/docs/new.md") },
+			refresh: "/r/docs",
+			added:   []string{"/r/docs/new.md"},
+		},
+		{
+			name:    "deleted_file",
+			change:  func(fs *fakeFS) { fs.remove("/r/docs/old.md") },
+			refresh: "/r/docs",
+			removed: []string{"/r/docs/old.md"},
+		},
+		{
+			name: "created_and_deleted",
+			change: func(fs *fakeFS) {
+				fs.remove("/r/docs/old.md")
+				fs.add("/r/docs/renamed.md")
+			},
+			refresh: "/r/docs",
+			added:   []string{"/r/docs/renamed.md"},
+			removed: []string{"/r/docs/old.md"},
+		},
+		{
+			name:    "created_directory",
+			change:  func(fs *fakeFS) { fs.add("/r/docs/img/png/logo.png") },
+			refresh: "/r/docs",
+			added:   []string{"/r/docs/img/", "/r/docs/img/png/", "/r/docs/img/png/logo.png"},
+		},
+		{
+			// the events of its entries came before the one of the
+			// directory, its parent adds it
+			name:    "directory_refreshed_before_its_parent",
+			change:  func(fs *fakeFS) { fs.add("/r/docs/img/png/logo.png") },
+			refresh: "/r/docs/img/png",
+			added:   []string{"/r/docs/img/", "/r/docs/img/png/", "/r/docs/img/png/logo.png"},
+		},
+		{
+			name:    "filtered_directory_refreshed",
+			change:  func(fs *fakeFS) { fs.add("/r/cache/blob") },
+			filter:  "/r/cache",
+			refresh: "/r/cache",
+		},
+		{
+			name:    "deep_deletion",
+			change:  func(fs *fakeFS) { fs.remove("/r/deep") },
+			refresh: "/r",
+			removed: []string{"/r/deep/", "/r/deep/1/", "/r/deep/1/2/", "/r/deep/1/2/3/",
+				"/r/deep/1/2/3/4/", "/r/deep/1/2/3/4/leaf.txt", "/r/deep/1/2/other.txt",
+				"/r/deep/1/sibling/"},
+		},
+		{
+			name:    "deletion_below_an_unchanged_directory",
+			change:  func(fs *fakeFS) { fs.remove("/r/deep/1/2/3") },
+			refresh: "/r",
+		},
+		{
+			name:      "reconciled_deletion",
+			change:    func(fs *fakeFS) { fs.remove("/r/deep/1/2/3") },
+			refresh:   "/r",
+			recursive: true,
+			removed:   []string{"/r/deep/1/2/3/", "/r/deep/1/2/3/4/", "/r/deep/1/2/3/4/leaf.txt"},
+		},
+		{
+			name:    "file_changed",
+			change:  func(fs *fakeFS) { fs.add("/r/a.txt") },
+			refresh: "/r",
+		},
+		{
+			name: "filtered_file",
+			change: func(fs *fakeFS) {
+				fs.add("/r/docs/build.log")
+				fs.add("/r/docs/notes.md")
+			},
+			filter:  "**/*.log",
+			refresh: "/r/docs",
+			added:   []string{"/r/docs/notes.md"},
+		},
+		{
+			name:    "filtered_directory",
+			change:  func(fs *fakeFS) { fs.add("/r/cache/blob") },
+			filter:  "/r/cache",
+			refresh: "/r",
+		},
+		{
+			// the directory was deleted before it was read
+			name:    "vanished_directory",
+			change:  func(fs *fakeFS) { fs.remove("/r/docs") },
+			refresh: "/r/docs",
+			removed: []string{"/r/docs/old.md", "/r/docs/readme.md"},
+		},
+		{
+			// the directory was deleted between reading its
+			// parent and reading it
+			name: "vanished_before_walking",
+			change: func(fs *fakeFS) {
+				fs.add("/r/docs/tmp/file")
+				fs.readErrs["/r/docs/tmp"] = syscall.ENOENT
+			},
+			refresh: "/r/docs",
+		},
+		{
+			// a directory below it was deleted while walking it
+			name: "vanished_while_walking",
+			change: func(fs *fakeFS) {
+				fs.add("/r/docs/img/png/logo.png")
+				fs.readErrs["/r/docs/img/png"] = syscall.ENOENT
+			},
+			refresh: "/r/docs",
+			added:   []string{"/r/docs/img/"},
+		},
+		{
+			// the directory was replaced by a file before it was read
+			name: "replaced_before_walking",
+			change: func(fs *fakeFS) {
+				fs.add("/r/docs/tmp/")
+				fs.readErrs["/r/docs/tmp"] = syscall.ENOTDIR
+			},
+			refresh: "/r/docs",
+		},
+		{
+			// a temporary file deleted before it was stat'ed
+			name: "vanished_file",
+			change: func(fs *fakeFS) {
+				fs.add("/r/docs/.new.md.swp")
+				fs.statErrs["/r/docs/.new.md.swp"] = syscall.ENOENT
+			},
+			refresh: "/r/docs",
+		},
+
+		{
+			// the entry was deleted between reading its parent
+			// and stat'ing it
+			name: "vanished_before_stat",
+			change: func(fs *fakeFS) {
+				fs.add("/r/docs/tmp/")
+				fs.statErrs["/r/docs/tmp"] = syscall.ENOENT
+			},
+			refresh: "/r/docs",
+		},
+		{
+			name: "unreadable_new_directory",
+			change: func(fs *fakeFS) {
+				fs.add("/r/private/secret.txt")
+				fs.readErrs["/r/private"] = syscall.EACCES
+			},
+			refresh: "/r",
+			added:   []string{"/r/private/"},
+		},
+		{
+			name:    "missing_directory",
+			change:  func(fs *fakeFS) {},
+			refresh: "/r/nowhere",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newFakeFS(initial...)
+			db := newFakeIndexer(fs, Options{})
+			before := indexedPaths(t, db)
+
+			if tt.filter != "" {
+				addFilter(t, tt.filter)
+			}
+			tt.change(fs)
+			db.refreshDirectory(tt.refresh)
+			if tt.recursive {
+				db.reconcileSubdirectories(tt.refresh)
+			}
+
+			added, removed := sliceDifference(indexedPaths(t, db), before)
+			sort.Strings(added)
+			sort.Strings(removed)
+			if strings.Join(added, "\n") != strings.Join(tt.added, "\n") {
+				t.Errorf("added %q, want %q", added, tt.added)
+			}
+			if strings.Join(removed, "\n") != strings.Join(tt.removed, "\n") {
+				t.Errorf("removed %q, want %q", removed, tt.removed)
+			}
+		})
+	}
+}
+
+// recordAction records the paths a walk adds
+type recordAction struct {
+	paths []string
+}
+
+func (a *recordAction) add(parent *tree.Node, path, name string, isDir bool) *tree.Node {
+	a.paths = append(a.paths, path)
+	return nil
+}
+
+func (a *recordAction) traverse(parent *tree.Node, path, name string) *tree.Node {
+	return nil
+}
+
+func (a *recordAction) enter(node *tree.Node, path string, entries int) *tree.Node {
+	return nil
+}
+
+func TestIndexWalk_Priority(t *testing.T) {
+	fs := newFakeFS("/r/a", "/r/etc/x", "/r/home/me/docs/y", "/r/home/you", "/r/z")
+	tests := []struct {
+		name     string
+		priority []string
+		want     []string
+		// wantPrioritized is the number of paths added when the
+		// priority directories were done, -1 if they never were
+		wantPrioritized int
+	}{
+		{
+			"none", nil,
+			[]string{"/r", "/r/a", "/r/etc", "/r/etc/x", "/r/home", "/r/home/me",
+				"/r/home/me/docs", "/r/home/me/docs/y", "/r/home/you", "/r/z"},
+			-1,
+		},
+		{
+			"ordered", []string{"/r/home", "/r/etc"},
+			[]string{"/r", "/r/home", "/r/home/me", "/r/home/me/docs", "/r/home/me/docs/y",
+				"/r/home/you", "/r/etc", "/r/etc/x", "/r/a", "/r/z"},
+			8,
+		},
+		{
+			"nested", []string{"/r/home/me/docs", "/r/z", "/r/missing"},
+			[]string{"/r", "/r/home", "/r/home/me", "/r/home/me/docs", "/r/home/me/docs/y",
+				"/r/home/you", "/r/z", "/r/a", "/r/etc", "/r/etc/x"},
+			7,
+		},
+		{"missing", []string{"/r/missing"}, nil, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := &recordAction{}
+			prioritized := -1
+			w := indexWalk{fs: fs, action: action, root: "/r", priority: tt.priority,
+				prioritized: func() { prioritized = len(action.paths) }}
+			w.visit(nil, "/r", "r", true)
+
+			if tt.want != nil && !reflect.DeepEqual(action.paths, tt.want) {
+				t.Errorf("walked %q, want %q", action.paths, tt.want)
+			}
+			if prioritized != tt.wantPrioritized {
+				t.Errorf("prioritized after %d paths, want %d", prioritized, tt.wantPrioritized)
+			}
+		})
+	}
+}
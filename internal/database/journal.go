@@ -0,0 +1,377 @@
+package database
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/pkg/errors"
+)
+
+// JournalOptions configure the journal of the changes applied
+// to the index
+type JournalOptions struct {
+	// Path is the file the changes are appended to as JSON lines,
+	// nothing is recorded if it is empty
+	Path string
+	// MaxSize is the size in bytes at which the journal is moved to
+	// Path.1, replacing the previous one, 0 means it grows forever
+	MaxSize int64
+	// SyncInterval is how often the journal is synced to disk,
+	// 0 leaves it to the kernel
+	SyncInterval time.Duration
+}
+
+// maxJournalLine is the length of the longest journal record read,
+// the paths in it have no bound
+const maxJournalLine = 64 << 20
+
+// Actions of journal records
+const (
+	journalCreate = "create"
+	journalDelete = "delete"
+	journalMove   = "move"
+)
+
+// journalRecord is a line of the journal
+type journalRecord struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Path   string    `json:"path"`
+	// From is the previous path of a moved entry
+	From string `json:"from,omitempty"`
+}
+
+// line returns the record as sent to clients
+func (r journalRecord) line() string {
+	line := r.Time.Format(time.RFC3339) + "\t" + r.Action + "\t" + r.Path
+	if r.From != "" {
+		line += "\t" + r.From
+	}
+	return line
+}
+
+// journal appends the changes applied to the index to a file. It is
+// written by the goroutine of Start and read by History requests,
+// which may run on snapshots, so the file is guarded by mu.
+type journal struct {
+	options JournalOptions
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	// dirty is set if records were written since the last sync
+	dirty bool
+}
+
+func openJournal(options JournalOptions) (*journal, error) {
+	j := &journal{options: options}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// open opens the journal file for appending
+func (j *journal) open() error {
+	f, err := os.OpenFile(j.options.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrap(err, "can't open journal")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "can't open journal")
+	}
+	j.file = f
+	j.size = info.Size()
+	return nil
+}
+
+// rotatedPath is where the journal is moved once it reached MaxSize
+func (j *journal) rotatedPath() string {
+	return j.options.Path + ".1"
+}
+
+// append writes records to the journal, rotating it if they don't
+// fit anymore. The index was changed already, so failures are logged.
+func (j *journal) append(records []journalRecord) {
+	if j == nil || len(records) == 0 {
+		return
+	}
+	var data []byte
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			slog.Warn("couldn't encode journal record", "path", r.Path, "err", err)
+			continue
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return
+	}
+	if max := j.options.MaxSize; max > 0 && j.size > 0 && j.size+int64(len(data)) > max {
+		if err := j.rotate(); err != nil {
+			slog.Warn("couldn't rotate journal", "path", j.options.Path, "err", err)
+			if j.file == nil {
+				return
+			}
+		}
+	}
+	n, err := j.file.Write(data)
+	j.size += int64(n)
+	j.dirty = true
+	if err != nil {
+		slog.Warn("couldn't write journal", "path", j.options.Path, "err", err)
+	}
+}
+
+// rotate moves the journal to rotatedPath and starts a new one,
+// j.mu has to be held
+func (j *journal) rotate() error {
+	if err := j.file.Close(); err != nil {
+		slog.Warn("couldn't close journal", "path", j.options.Path, "err", err)
+	}
+	j.file = nil
+	j.dirty = false
+	renameErr := os.Rename(j.options.Path, j.rotatedPath())
+	// keep appending to the old file if it couldn't be moved
+	if err := j.open(); err != nil {
+		return err
+	}
+	return renameErr
+}
+
+// syncTicker returns the channel the journal is synced on,
+// nil if it isn't synced periodically
+func (j *journal) syncTicker() <-chan time.Time {
+	if j == nil || j.options.SyncInterval <= 0 {
+		return nil
+	}
+	return time.NewTicker(j.options.SyncInterval).C
+}
+
+// sync flushes the records written since the last sync to disk
+func (j *journal) sync() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil || !j.dirty {
+		return
+	}
+	if err := j.file.Sync(); err != nil {
+		slog.Warn("couldn't sync journal", "path", j.options.Path, "err", err)
+	}
+	j.dirty = false
+}
+
+// close syncs and closes the journal
+func (j *journal) close() {
+	if j == nil {
+		return
+	}
+	j.sync()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+}
+
+// scan calls visit with the records of the rotated and the current
+// journal, oldest first, until it returns false
+func (j *journal) scan(visit func(journalRecord) bool) error {
+	// the files are opened together, so a rotation can't skip
+	// records, and the current one is read up to the records
+	// written so far
+	j.mu.Lock()
+	rotated, err := os.Open(j.rotatedPath())
+	if err != nil && !os.IsNotExist(err) {
+		j.mu.Unlock()
+		return errors.Wrap(err, "can't read journal")
+	}
+	current, currentErr := os.Open(j.options.Path)
+	size := j.size
+	j.mu.Unlock()
+
+	var readers []io.Reader
+	if rotated != nil {
+		defer rotated.Close()
+		readers = append(readers, rotated)
+	}
+	if currentErr != nil {
+		return errors.Wrap(currentErr, "can't read journal")
+	}
+	defer current.Close()
+	readers = append(readers, io.LimitReader(current, size))
+
+	for _, r := range readers {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, maxJournalLine)
+		for scanner.Scan() {
+			var record journalRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				// a line cut short by a crash
+				continue
+			}
+			if !visit(record) {
+				return nil
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return errors.Wrap(err, "can't read journal")
+		}
+	}
+	return nil
+}
+
+// journalChanges records the entries created and deleted in the
+// directory at path. Entries below them aren't recorded on their own,
+// and a single entry replaced by another one is taken for a rename.
+func (db *Indexer) journalChanges(path string, created, deleted []string) {
+	if db.journal == nil {
+		return
+	}
+	created = journaledNames(path, created)
+	deleted = journaledNames(path, deleted)
+
+	now := time.Now()
+	var records []journalRecord
+	if len(created) == 1 && len(deleted) == 1 {
+		records = append(records, journalRecord{Time: now, Action: journalMove,
+			Path: filepath.Join(path, created[0]), From: filepath.Join(path, deleted[0])})
+		created, deleted = nil, nil
+	}
+	for _, name := range deleted {
+		records = append(records, journalRecord{Time: now, Action: journalDelete,
+			Path: filepath.Join(path, name)})
+	}
+	for _, name := range created {
+		records = append(records, journalRecord{Time: now, Action: journalCreate,
+			Path: filepath.Join(path, name)})
+	}
+	db.journal.append(records)
+}
+
+// journaledNames returns the names in the directory at path that
+// are searchable, filtered ones are kept out of the journal
+func journaledNames(path string, names []string) []string {
+	var journaled []string
+	for _, name := range names {
+		if config.FilterPath(filepath.Join(path, name)) == config.Included {
+			journaled = append(journaled, name)
+		}
+	}
+	return journaled
+}
+
+// sendHistory sends the journal records of the paths matching the
+// query. The most recent ones are kept if there are more than
+// MaxResults, they are sent oldest first unless ReverseSort is set.
+func (db *Indexer) sendHistory(req request.Request) {
+	defer close(req.ResponseChannel)
+	defer queryDuration.With(actionLabel(req.Settings.Action)).ObserveSince(time.Now())
+
+	e := db.rejectQuery(req)
+	if e == nil && db.journal == nil {
+		e = &request.ErrorResponse{Code: request.ErrInvalidRequest,
+			Message: "the journal is disabled, set journal in the config"}
+	}
+	pattern := req.Query
+	if req.Settings.CaseInsensitive {
+		pattern = strings.ToLower(pattern)
+	}
+	if _, err := filepath.Match(pattern, ""); e == nil && err != nil {
+		e = &request.ErrorResponse{Code: request.ErrInvalidRequest,
+			Message: "invalid pattern " + req.Query}
+	}
+	if e != nil {
+		select {
+		case req.ResponseChannel <- e.Line(req.Version):
+		case <-req.Done:
+		}
+		return
+	}
+
+	start := time.Now()
+	max := req.Settings.MaxResults
+	matches := 0
+	var records []journalRecord
+	err := db.journal.scan(func(r journalRecord) bool {
+		if !historyMatches(pattern, r, req.Settings.CaseInsensitive) {
+			return true
+		}
+		matches++
+		records = append(records, r)
+		// drop the oldest records once there are plenty
+		if max > 0 && len(records) >= 2*max {
+			records = append(records[:0], records[len(records)-max:]...)
+		}
+		return !isCancelled(req)
+	})
+	if err != nil {
+		req.Logger().Warn("couldn't read journal", "err", err)
+		e := request.ErrorResponse{Code: request.ErrInternal, Message: err.Error()}
+		select {
+		case req.ResponseChannel <- e.Line(req.Version):
+		case <-req.Done:
+		}
+		return
+	}
+	if max > 0 && len(records) > max {
+		records = records[len(records)-max:]
+	}
+
+	for i := range records {
+		r := records[i]
+		if req.Settings.ReverseSort {
+			r = records[len(records)-1-i]
+		}
+		select {
+		case req.ResponseChannel <- r.line():
+		case <-req.Done:
+			return
+		}
+	}
+	duration := time.Since(start)
+	req.Logger().Debug("sent history", "matches", matches, "duration", duration)
+	db.recordQuery(req, duration, len(records))
+	sendStatus(req, matches, len(records), nil, time.Time{})
+}
+
+// historyMatches returns whether the path of r, or its previous one,
+// matches pattern
+func historyMatches(pattern string, r journalRecord, caseInsensitive bool) bool {
+	return pathMatches(pattern, r.Path, caseInsensitive) ||
+		(r.From != "" && pathMatches(pattern, r.From, caseInsensitive))
+}
+
+// pathMatches returns whether path matches pattern, which has to be
+// lowercase if caseInsensitive is set. Patterns with wildcards are
+// globs matching the whole path or its last element, other ones
+// substrings.
+func pathMatches(pattern, path string, caseInsensitive bool) bool {
+	if caseInsensitive {
+		path = strings.ToLower(path)
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		return strings.Contains(path, pattern)
+	}
+	if ok, _ := filepath.Match(pattern, path); ok {
+		return true
+	}
+	ok, _ := filepath.Match(pattern, filepath.Base(path))
+	return ok
+}
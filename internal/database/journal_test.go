@@ -0,0 +1,125 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestJournal_Rotate(t *testing.T) {
+	record := func(i int) journalRecord {
+		return journalRecord{Time: time.Unix(0, 0).UTC(), Action: journalCreate,
+			Path: fmt.Sprintf("/r/f%02d", i)}
+	}
+	line, _ := json.Marshal(record(0))
+	lineSize := int64(len(line) + 1)
+
+	tests := []struct {
+		name    string
+		appends int
+		maxSize int64
+		want    []int
+		rotated bool
+	}{
+		{"unlimited", 5, 0, []int{0, 1, 2, 3, 4}, false},
+		{"below_limit", 3, 3 * lineSize, []int{0, 1, 2}, false},
+		{"rotated_once", 5, 3 * lineSize, []int{0, 1, 2, 3, 4}, true},
+		// only the last rotated journal is kept
+		{"rotated_twice", 7, 3 * lineSize, []int{3, 4, 5, 6}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal")
+			j, err := openJournal(JournalOptions{Path: path, MaxSize: tt.maxSize})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer j.close()
+			for i := 0; i < tt.appends; i++ {
+				j.append([]journalRecord{record(i)})
+			}
+
+			var got []journalRecord
+			if err := j.scan(func(r journalRecord) bool {
+				got = append(got, r)
+				return true
+			}); err != nil {
+				t.Fatal(err)
+			}
+			var want []journalRecord
+			for _, i := range tt.want {
+				want = append(want, record(i))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("scan() = %v, want %v", got, want)
+			}
+			if _, err := os.Stat(path + ".1"); (err == nil) != tt.rotated {
+				t.Errorf("rotated journal exists = %v, want %v", err == nil, tt.rotated)
+			}
+		})
+	}
+}
+
+func TestHistory(t *testing.T) {
+	addFilter(t, "*.tmp")
+	fs := newFakeFS("/r/docs/a.md", "/r/docs/b.md", "/r/docs/c.md")
+	db := newFakeIndexer(fs, Options{})
+	j, err := openJournal(JournalOptions{Path: filepath.Join(t.TempDir(), "journal")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.close()
+	db.journal = j
+
+	fs.remove("/r/docs/a.md")
+	fs.add("/r/docs/build.tmp")
+	db.refreshDirectory("/r/docs")
+	fs.remove("/r/docs/b.md")
+	fs.add("/r/docs/b2.md")
+	db.refreshDirectory("/r/docs")
+	fs.add("/r/src/")
+	db.refreshDirectory("/r")
+
+	tests := []struct {
+		name     string
+		query    string
+		settings request.Settings
+		want     []string
+	}{
+		{"substring", "docs", request.Settings{},
+			[]string{"delete\t/r/docs/a.md", "move\t/r/docs/b2.md\t/r/docs/b.md"}},
+		{"previous_path", "b.md", request.Settings{}, []string{"move\t/r/docs/b2.md\t/r/docs/b.md"}},
+		{"glob", "*.md", request.Settings{MaxResults: 1}, []string{"move\t/r/docs/b2.md\t/r/docs/b.md"}},
+		{"reversed", "", request.Settings{ListAll: true, ReverseSort: true},
+			[]string{"create\t/r/src", "move\t/r/docs/b2.md\t/r/docs/b.md", "delete\t/r/docs/a.md"}},
+		{"filtered", "tmp", request.Settings{}, nil},
+		{"empty", "", request.Settings{},
+			[]string{request.ErrorResponse{Code: request.ErrQueryTooShort}.Line(1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.settings.Action = request.History
+			lines := runRequest(db, request.Request{Version: 1, Query: tt.query,
+				Settings: tt.settings})
+			var got []string
+			for _, line := range lines {
+				if e, ok := request.ParseError(line); ok {
+					got = append(got, request.ErrorResponse{Code: e.Code}.Line(1))
+					continue
+				}
+				// the time is the first column
+				got = append(got, line[strings.IndexByte(line, '\t')+1:])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("history = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
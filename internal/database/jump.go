@@ -0,0 +1,204 @@
+package database
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/pkg/tree"
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+// maxVisitedDirectories is the number of directories whose visits
+// are kept per peer, the lowest ranked one is forgotten beyond it
+const maxVisitedDirectories = 1000
+
+// visit counts how often a directory was changed into
+type visit struct {
+	count int
+	last  time.Time
+}
+
+// frecency ranks directories visited often and recently first, the
+// visits of the last hour count the most
+func (v visit) frecency(now time.Time) float64 {
+	count := float64(v.count)
+	switch age := now.Sub(v.last); {
+	case age < time.Hour:
+		return count * 4
+	case age < 24*time.Hour:
+		return count * 2
+	case age < 7*24*time.Hour:
+		return count / 2
+	}
+	return count / 4
+}
+
+// visitLog holds the visits of each peer. It is written by the
+// goroutine of Start and read by Jump requests, which may run on
+// snapshots, and isn't persisted.
+type visitLog struct {
+	sync.Mutex
+	peers map[string]*peerVisits
+}
+
+// peerVisits are the visits of a peer by path
+type peerVisits struct {
+	paths map[string]*visit
+	// names counts the visited paths by their last element, so paths
+	// are only built for directories named like a visited one
+	names map[string]int
+}
+
+func (l *visitLog) add(peer, path string, now time.Time) {
+	l.Lock()
+	defer l.Unlock()
+	if l.peers == nil {
+		l.peers = make(map[string]*peerVisits)
+	}
+	visits := l.peers[peer]
+	if visits == nil {
+		visits = &peerVisits{paths: make(map[string]*visit), names: make(map[string]int)}
+		l.peers[peer] = visits
+	}
+	if v := visits.paths[path]; v != nil {
+		v.count++
+		v.last = now
+		return
+	}
+	if len(visits.paths) >= maxVisitedDirectories {
+		var lowest string
+		var score float64
+		for p, v := range visits.paths {
+			if s := v.frecency(now); lowest == "" || s < score {
+				lowest, score = p, s
+			}
+		}
+		visits.remove(lowest)
+	}
+	visits.paths[path] = &visit{count: 1, last: now}
+	visits.names[filepath.Base(path)]++
+}
+
+func (v *peerVisits) remove(path string) {
+	delete(v.paths, path)
+	name := filepath.Base(path)
+	if v.names[name]--; v.names[name] <= 0 {
+		delete(v.names, name)
+	}
+}
+
+// score returns the frecency of the directory at node, path is
+// a buffer for its path
+func (v *peerVisits) score(node *tree.Node, path []byte, now time.Time) (float64, []byte) {
+	if v == nil || v.names[node.Name()] == 0 {
+		return 0, path
+	}
+	path = node.AppendPath(path[:0])
+	if visit := v.paths[string(path)]; visit != nil {
+		return visit.frecency(now), path
+	}
+	return 0, path
+}
+
+type jumpResult struct {
+	node   *tree.Node
+	length int
+	exact  bool
+	score  float64
+	// order is the position in the index, it breaks the
+	// remaining ties
+	order int
+}
+
+// byFrecency sorts directories named like the query first, then those
+// visited more, then shorter paths, like byLength
+type byFrecency []jumpResult
+
+func (f byFrecency) Len() int      { return len(f) }
+func (f byFrecency) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+func (f byFrecency) Less(i, j int) bool {
+	switch {
+	case f[i].exact != f[j].exact:
+		return f[i].exact
+	case f[i].score != f[j].score:
+		return f[i].score > f[j].score
+	case f[i].length != f[j].length:
+		return f[i].length < f[j].length
+	}
+	return f[i].order < f[j].order
+}
+func (f byFrecency) Result(index int) string {
+	return f[index].node.GetPath()
+}
+
+// jump finds the directories whose name starts with the query, scored
+// by the visits of the peer. Paths are only built for the results
+// sent, there are thousands of candidates for short queries.
+func (db *Indexer) jump(ix *index, req request.Request) byFrecency {
+	query := req.Query
+	caseInsensitive := req.Settings.CaseInsensitive
+	now := time.Now()
+
+	db.visits.Lock()
+	defer db.visits.Unlock()
+	visits := db.visits.peers[req.Peer]
+
+	var results byFrecency
+	var path []byte
+	ix.directories.visitPrefix(strings.ToLower(query), func(node *tree.Node) bool {
+		name := node.Name()
+		if !caseInsensitive && !strings.HasPrefix(name, query) {
+			return true
+		}
+		result := jumpResult{node: node, length: node.PathLen(), order: len(results)}
+		if caseInsensitive {
+			result.exact = strings.EqualFold(name, query)
+		} else {
+			result.exact = name == query
+		}
+		result.score, path = visits.score(node, path, now)
+		results = append(results, result)
+		return len(results)%1024 != 0 || !isCancelled(req)
+	})
+	return results
+}
+
+// recordVisit counts a visit of the peer to the directory given as
+// query, it has to be indexed
+func (db *Indexer) recordVisit(req request.Request) {
+	path := filepath.Clean(req.Query)
+	if !filepath.IsAbs(path) {
+		sendError(req, request.ErrorResponse{
+			Code:    request.ErrInvalidRequest,
+			Message: "not an absolute path: " + req.Query,
+		})
+		return
+	}
+	if !db.isIndexedDirectory(path) {
+		sendError(req, request.ErrorResponse{
+			Code:    request.ErrNotFound,
+			Message: path + " isn't an indexed directory",
+		})
+		return
+	}
+	db.visits.add(req.Peer, path, time.Now())
+	close(req.ResponseChannel)
+}
+
+// isIndexedDirectory returns whether there is a directory at path
+// in the index
+func (db *Indexer) isIndexedDirectory(path string) bool {
+	item := db.trie.Get(trie.Prefix(filepath.Base(path)))
+	if item == nil {
+		return false
+	}
+	found := false
+	entriesOf(item).forEach(func(file indexedFile) bool {
+		found = file.isDir && file.pathNode.GetPath() == path
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestJump(t *testing.T) {
+	fs := newFakeFS("/r/src/", "/r/a/src/", "/r/a/srcs/", "/r/bb/Src/", "/r/c/src.go")
+	db := newFakeIndexer(fs, Options{})
+
+	for _, visit := range []string{"/r/a/src", "/r/a/src/", "/r/a/srcs"} {
+		lines := runRequest(db, request.Request{Query: visit, Peer: "uid:1",
+			Settings: request.Settings{Action: request.Visit}})
+		if len(lines) != 0 {
+			t.Fatalf("visit %s = %q, want no response", visit, lines)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		peer     string
+		settings request.Settings
+		// want is sent best last, like the results of other searches
+		want []string
+	}{
+		{"exact_first", "src", "", request.Settings{},
+			[]string{"/r/a/srcs", "/r/a/src", "/r/src"}},
+		{"limited", "src", "", request.Settings{MaxResults: 1}, []string{"/r/src"}},
+		{"visited", "src", "uid:1", request.Settings{},
+			[]string{"/r/a/srcs", "/r/src", "/r/a/src"}},
+		{"visited_by_other_peer", "src", "uid:2", request.Settings{MaxResults: 1},
+			[]string{"/r/src"}},
+		{"visited_prefix", "sr", "uid:1", request.Settings{MaxResults: 2},
+			[]string{"/r/a/srcs", "/r/a/src"}},
+		{"case_insensitive", "src", "", request.Settings{CaseInsensitive: true},
+			[]string{"/r/a/srcs", "/r/bb/Src", "/r/a/src", "/r/src"}},
+		{"no_match", "x", "", request.Settings{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.settings.Action = request.Jump
+			got := runRequest(db, request.Request{Query: tt.query, Peer: tt.peer,
+				Settings: tt.settings})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("jump %q = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	// removed directories are dropped from the directory names
+	fs.remove("/r/src")
+	db.refreshDirectory("/r")
+	got := runRequest(db, request.Request{Query: "src",
+		Settings: request.Settings{Action: request.Jump, MaxResults: 1}})
+	if want := []string{"/r/a/src"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("jump after removal = %q, want %q", got, want)
+	}
+}
+
+func TestVisit_Invalid(t *testing.T) {
+	db := newFakeIndexer(newFakeFS("/r/src/main.go"), Options{})
+
+	tests := []struct {
+		name  string
+		query string
+		code  string
+	}{
+		{"relative", "src", request.ErrInvalidRequest},
+		{"file", "/r/src/main.go", request.ErrNotFound},
+		{"missing", "/r/doc", request.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := runRequest(db, request.Request{Version: 1, Query: tt.query,
+				Settings: request.Settings{Action: request.Visit}})
+			if len(lines) != 1 {
+				t.Fatalf("got %q, want an error", lines)
+			}
+			if e, ok := request.ParseError(lines[0]); !ok || e.Code != tt.code {
+				t.Errorf("got %q, want a %s error", lines[0], tt.code)
+			}
+		})
+	}
+}
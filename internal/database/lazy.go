@@ -0,0 +1,189 @@
+package database
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/pkg/errors"
+)
+
+// lazyExpiryInterval is how often the entries merged by lazy walks
+// are checked for expiry
+const lazyExpiryInterval = time.Minute
+
+// LazyOptions bound the walks of the roots of requests that aren't
+// indexed, which are rejected if MaxEntries is 0
+type LazyOptions struct {
+	// MaxEntries is the number of entries a walk adds at most
+	MaxEntries int
+	// Timeout is how long a walk takes at most
+	Timeout time.Duration
+	// Expiry is how long the walked entries are merged into the
+	// index, they are only used for the request if it is 0
+	Expiry time.Duration
+}
+
+// lazilyWalked returns whether the entries below directories that
+// aren't indexed for reason are walked for requests. Filters and
+// excluded filesystem types are deliberate, they still apply.
+func lazilyWalked(reason string) bool {
+	return reason != "" && reason != reasonFiltered && reason != reasonFSType
+}
+
+// rootIndex returns the index to answer req from, with a warning to
+// send with the results. That is ix unless the root of req isn't
+// indexed, it is then walked into a temporary index if lazy walks are
+// enabled, and merged into the index later if they are kept. Roots in
+// cold paths are answered from the cold tier.
+func (db *Indexer) rootIndex(ix *index, req request.Request) (*index, *request.Warning, *request.ErrorResponse) {
+	if req.Settings.Root == "" {
+		return ix, nil, nil
+	}
+	root := filepath.Clean(req.Settings.Root)
+	if db.cold.covers(root) {
+		return db.coldRootIndex(root)
+	}
+	reason, expires := db.coverage.check(root, time.Now())
+	_, err := ix.tree.GetChildren(root)
+	switch {
+	case reason == "" && err == nil:
+		return ix, nil, nil
+	case reason == "" && expires.IsZero():
+		return nil, nil, &request.ErrorResponse{Code: request.ErrNotIndexed,
+			Message: root + " isn't indexed"}
+	case db.lazy.MaxEntries == 0 || (reason != "" && !lazilyWalked(reason)):
+		return nil, nil, &request.ErrorResponse{Code: request.ErrNotIndexed,
+			Message: root + " isn't indexed, it is " + reason}
+	}
+	// the entries below root weren't indexed, or they were merged by
+	// a lazy walk, but the copy holding them isn't published yet
+
+	walked, entries, complete, err := db.walkLazily(root, req, false)
+	if err != nil {
+		return nil, nil, &request.ErrorResponse{Code: request.ErrNotIndexed,
+			Message: fmt.Sprintf("%s isn't indexed and couldn't be walked: %v", root, err)}
+	}
+	req.Logger().Debug("walked root that isn't indexed", "root", root, "reason", reason,
+		"entries", entries, "complete", complete)
+	w := &request.Warning{Code: request.WarnWalked,
+		Message: fmt.Sprintf("%s isn't indexed, walked its %d entries", root, entries)}
+	if !complete {
+		w = &request.Warning{Code: request.WarnWalkIncomplete,
+			Message: fmt.Sprintf("%s isn't indexed, stopped walking it after %d entries", root, entries)}
+	}
+	if complete && db.lazy.Expiry > 0 {
+		// the goroutine of Start walks it again, it is
+		// the only one changing the index
+		select {
+		case db.lazySignal <- root:
+		default:
+		}
+	}
+	return walked, w, nil
+}
+
+// walkLazily walks the entries below root into a temporary index,
+// ignoring the depth limits, and the filters if unfiltered is set,
+// until the bounds of the lazy walks or the cancellation of req stop
+// it. complete is false if they did.
+func (db *Indexer) walkLazily(root string, req request.Request, unfiltered bool) (walked *index, entries uint64, complete bool, err error) {
+	isDir, err := db.fs.Lstat(root)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if !isDir {
+		return nil, 0, false, errors.Errorf("%s isn't a directory", root)
+	}
+
+	tmp := &Indexer{root: root, fs: db.fs, tagsXattr: db.tagsXattr}
+	tmp.resetIndex()
+	deadline := time.Now().Add(db.lazy.Timeout)
+	w := indexWalk{fs: db.fs, action: indexAction{tmp}, unlimited: true, unfiltered: unfiltered}
+	complete = true
+	w.stop = func() bool {
+		if complete && (w.files+w.directories >= uint64(db.lazy.MaxEntries) ||
+			time.Now().After(deadline) || isCancelled(req)) {
+			complete = false
+		}
+		return !complete
+	}
+	w.visitChildren(tmp.tree.Add(root), root)
+	return tmp.currentIndex(), w.files + w.directories, complete, nil
+}
+
+// mergeLazy adds the entries below root to the index until the lazy
+// walks expire, unless it is covered by now
+func (db *Indexer) mergeLazy(root string) {
+	now := time.Now()
+	if reason, _ := db.coverage.check(root, now); !lazilyWalked(reason) {
+		return
+	}
+	// the entries of lazy roots below it are walked again
+	db.expireLazy("/", now)
+	db.expireLazy(root, time.Time{})
+
+	// the directories that aren't in the tree yet are
+	// removed again on expiry
+	var top string
+	for dir := root; ; dir = filepath.Dir(dir) {
+		if _, err := db.tree.GetChildren(dir); err == nil {
+			break
+		}
+		top = dir
+		if dir == "/" {
+			break
+		}
+	}
+	if children, _ := db.tree.GetChildren(root); len(children) > 0 {
+		// entries below it were indexed in the meantime
+		return
+	}
+	node := db.tree.Add(root)
+	if top != "" {
+		db.recordIndexChange(indexChange{changeTraverse, root, filepath.Base(root), true, nil})
+	}
+
+	deadline := now.Add(db.lazy.Timeout)
+	w := indexWalk{fs: db.fs, action: indexAction{db}, unlimited: true}
+	w.stop = func() bool {
+		return w.files+w.directories >= uint64(db.lazy.MaxEntries) || time.Now().After(deadline)
+	}
+	w.visitChildren(node, root)
+	db.coverage.addLazy(root, lazyRoot{expires: now.Add(db.lazy.Expiry), top: top})
+	slog.Info("merged lazily walked directory", "path", root,
+		"entries", w.files+w.directories, "expiry", db.lazy.Expiry)
+}
+
+// expireLazy removes the entries merged by lazy walks of the
+// directories at or below path that expired before now, or of
+// all of them if now is zero
+func (db *Indexer) expireLazy(path string, now time.Time) {
+	for root, r := range db.coverage.removeLazy(path, now) {
+		slog.Debug("lazily walked directory expired", "path", root)
+		if r.top != "" {
+			db.dropEntry(r.top)
+			continue
+		}
+		children, _ := db.tree.GetChildren(root)
+		for _, name := range children {
+			db.dropEntry(filepath.Join(root, name))
+		}
+	}
+}
+
+// dropEntry removes the entry at path and everything below it from
+// the index. Unlike removeEntry it doesn't keep them for Deleted
+// requests, they weren't deleted.
+func (db *Indexer) dropEntry(path string) {
+	db.tree.Walk(path, 0, func(walked string, isLeaf bool) error {
+		db.indexTrieDelete(filepath.Base(walked), filepath.Dir(walked))
+		return nil
+	})
+	db.tree.DeleteAt(path)
+	config.UnloadIgnoreFiles(path, true)
+	db.recordIndexChange(indexChange{changeRemove, path, filepath.Base(path), false, nil})
+}
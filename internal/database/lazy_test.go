@@ -0,0 +1,140 @@
+package database
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestCoverage(t *testing.T) {
+	addFilter(t, "*.bak")
+	now := time.Unix(1000, 0)
+	c := coverage{root: "/r"}
+	c.addLazy("/other/a", lazyRoot{expires: now.Add(time.Minute)})
+	c.addLazy("/other/old", lazyRoot{expires: now})
+
+	tests := []struct {
+		name        string
+		dir         string
+		want        string
+		wantExpires bool
+	}{
+		{"root", "/r", "", false},
+		{"below_root", "/r/docs/", "", false},
+		{"outside_root", "/other", reasonOutsideRoot + " /r", false},
+		{"filtered", "/r/x.bak", reasonFiltered, false},
+		{"below_filtered", "/r/x.bak/docs", reasonFiltered, false},
+		{"lazy", "/other/a/b", "", true},
+		{"lazy_expired", "/other/old", reasonOutsideRoot + " /r", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, expires := c.check(tt.dir, now)
+			if got != tt.want || expires.IsZero() == tt.wantExpires {
+				t.Errorf("check(%s) = %q, %v, want %q, expiry %v", tt.dir, got, expires,
+					tt.want, tt.wantExpires)
+			}
+		})
+	}
+}
+
+// lazyDuplicates returns the lines sent for the duplicate names below
+// root, with the codes of warnings and errors
+func lazyDuplicates(db *Indexer, root string) []string {
+	lines := runRequest(db, request.Request{Version: 1,
+		Features: []string{request.FeatureWarnings},
+		Settings: request.Settings{Action: request.Duplicates, MinCount: 2, Root: root}})
+	var got []string
+	for _, line := range lines {
+		if e, ok := request.ParseError(line); ok {
+			line = e.Code
+		} else if w, ok := request.ParseWarning(line); ok {
+			line = w.Code
+		}
+		got = append(got, line)
+	}
+	return got
+}
+
+func TestLazyIndex(t *testing.T) {
+	addFilter(t, "cache")
+	fs := newFakeFS("/r/a/notes.md", "/other/x/notes.md", "/other/y/notes.md",
+		"/other/y/z/todo.md", "/other/cache/notes.md")
+	newIndexer := func(lazy LazyOptions) *Indexer {
+		return newFakeIndexer(fs, Options{Lazy: lazy})
+	}
+	walked := []string{"notes.md", "/other/x/notes.md", "/other/y/notes.md", request.WarnWalked}
+
+	tests := []struct {
+		name string
+		lazy LazyOptions
+		root string
+		want []string
+	}{
+		{"disabled", LazyOptions{}, "/other", []string{request.ErrNotIndexed}},
+		// the filters apply to the walk
+		{"walked", LazyOptions{MaxEntries: 100, Timeout: time.Minute}, "/other", walked},
+		{"filtered", LazyOptions{MaxEntries: 100, Timeout: time.Minute}, "/other/cache",
+			[]string{request.ErrNotIndexed}},
+		{"missing", LazyOptions{MaxEntries: 100, Timeout: time.Minute}, "/missing",
+			[]string{request.ErrNotIndexed}},
+		{"incomplete", LazyOptions{MaxEntries: 2, Timeout: time.Minute}, "/other",
+			[]string{request.WarnWalkIncomplete}},
+		{"indexed", LazyOptions{MaxEntries: 100, Timeout: time.Minute}, "/r", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newIndexer(tt.lazy)
+			if got := lazyDuplicates(db, tt.root); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("duplicates below %s = %q, want %q", tt.root, got, tt.want)
+			}
+			if _, err := db.tree.GetChildren("/other"); err == nil {
+				t.Error("the walk changed the index")
+			}
+		})
+	}
+
+	db := newIndexer(LazyOptions{MaxEntries: 100, Timeout: time.Minute, Expiry: time.Hour})
+	db.enableSnapshots()
+	if got := lazyDuplicates(db, "/other"); !reflect.DeepEqual(got, walked) {
+		t.Fatalf("duplicates before merging = %q, want %q", got, walked)
+	}
+	root := <-db.lazySignal
+	db.beginWrite()
+	db.mergeLazy(root)
+	db.publish()
+
+	want := walked[:len(walked)-1]
+	if got := lazyDuplicates(db, "/other"); !reflect.DeepEqual(got, want) {
+		t.Errorf("duplicates after merging = %q, want %q", got, want)
+	}
+	if got := runQuery(db, request.PrefixSearch, "todo", 0); !reflect.DeepEqual(got, []string{"/other/y/z/todo.md"}) {
+		t.Errorf("search after merging = %q, want the merged entry", got)
+	}
+	lines := runRequest(db, request.Request{Query: "/other/y",
+		Settings: request.Settings{Action: request.Describe}})
+	var d request.Description
+	if err := json.Unmarshal([]byte(lines[0]), &d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Lazy) != 1 || d.Lazy[0].Path != "/other" || d.Coverage == nil ||
+		!d.Coverage.Indexed || d.Coverage.Expires == 0 {
+		t.Errorf("description lazy = %+v, coverage = %+v, want /other merged", d.Lazy, d.Coverage)
+	}
+
+	db.beginWrite()
+	db.expireLazy("/", time.Now().Add(2*time.Hour))
+	db.publish()
+	if got := runQuery(db, request.PrefixSearch, "todo", 0); len(got) != 0 {
+		t.Errorf("search after expiry = %q, want nothing", got)
+	}
+	if _, err := db.tree.GetChildren("/other"); err == nil {
+		t.Error("/other is still in the tree after expiry")
+	}
+	if got := db.deleted.list(time.Now()); len(got) != 0 {
+		t.Errorf("expired entries kept as deleted: %v", got)
+	}
+}
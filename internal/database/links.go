@@ -0,0 +1,163 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/mounts"
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// collapseHardlinks drops the results that are hard links to a file
+// found at a shorter path too, keeping the order of the others. The
+// inodes aren't indexed, the results are stat'ed. suppressed maps the
+// results kept to the number of their links that were dropped.
+func (db *Indexer) collapseHardlinks(results resulter) (_ resulter, suppressed map[string]int) {
+	n := results.Len()
+	// the result kept for each file, and the index of the results
+	// of the files with more than one link
+	kept := make(map[fileID]string)
+	ids := make(map[int]fileID)
+	for i := 0; i < n; i++ {
+		path := results.Result(i)
+		id, links, err := db.fs.Links(path)
+		if err != nil || links < 2 {
+			continue
+		}
+		ids[i] = id
+		if k, ok := kept[id]; !ok || len(path) < len(k) || (len(path) == len(k) && path < k) {
+			kept[id] = path
+		}
+	}
+	if len(ids) == len(kept) {
+		return results, nil
+	}
+
+	suppressed = make(map[string]int)
+	left := make(sortedResults, 0, n)
+	for i := 0; i < n; i++ {
+		path := results.Result(i)
+		if id, ok := ids[i]; ok && kept[id] != path {
+			suppressed[kept[id]]++
+			continue
+		}
+		left = append(left, path)
+	}
+	return left, suppressed
+}
+
+// markLinks marks the sorted results whose hard links were dropped
+// as LinksLine
+func markLinks(results resulter, suppressed map[string]int) resulter {
+	marked := make(sortedResults, results.Len())
+	for i := range marked {
+		marked[i] = results.Result(i)
+		if n := suppressed[marked[i]]; n > 0 {
+			marked[i] = request.LinksLine(marked[i], n)
+		}
+	}
+	return marked
+}
+
+var errFoundLinks = errors.New("found all links")
+
+// linkTarget returns the device and inode number of the file at path
+// and its number of hard links, or the ErrorResponse rejecting it
+func (db *Indexer) linkTarget(path string) (fileID, uint64, *request.ErrorResponse) {
+	if !filepath.IsAbs(path) {
+		return fileID{}, 0, &request.ErrorResponse{Code: request.ErrInvalidRequest,
+			Message: "links need the absolute path of a file"}
+	}
+	isDir, err := db.fs.Lstat(path)
+	if err != nil {
+		return fileID{}, 0, &request.ErrorResponse{Code: request.ErrInvalidRequest,
+			Message: fmt.Sprintf("couldn't stat %s: %v", path, err)}
+	}
+	if isDir {
+		return fileID{}, 0, &request.ErrorResponse{Code: request.ErrInvalidRequest,
+			Message: path + " is a directory, it has no hard links"}
+	}
+	id, links, err := db.fs.Links(path)
+	if err != nil {
+		return fileID{}, 0, &request.ErrorResponse{Code: request.ErrInvalidRequest,
+			Message: fmt.Sprintf("couldn't stat %s: %v", path, err)}
+	}
+	return id, links, nil
+}
+
+// sendLinks sends the other indexed paths of the file given as query,
+// the hard links to its inode, sorted by path. The index doesn't hold
+// inodes, so the indexed entries on its filesystem are stat'ed until
+// all links were found.
+func (db *Indexer) sendLinks(req request.Request) {
+	defer close(req.ResponseChannel)
+	defer queryDuration.With(actionLabel(req.Settings.Action)).ObserveSince(time.Now())
+
+	start := time.Now()
+	path := filepath.Clean(req.Query)
+	id, links, e := db.linkTarget(path)
+	if e != nil {
+		select {
+		case req.ResponseChannel <- e.Line(req.Version):
+		case <-req.Done:
+		}
+		return
+	}
+
+	ix, asOf := db.acquireIndex()
+	defer ix.release()
+	var found []string
+	if links > 1 {
+		// links can't cross filesystems, the walk starts at the
+		// mount point of the file if it is indexed
+		root := db.root
+		for _, m := range mounts.All() {
+			if _, ok := below(m.MountPoint, db.root); ok && m.Dev == id.dev {
+				root = m.MountPoint
+				break
+			}
+		}
+		ix.tree.Walk(root, 0, func(walked string, isLeaf bool) error {
+			if isCancelled(req) {
+				return errCancelled
+			}
+			if !isLeaf || walked == path {
+				return nil
+			}
+			if other, _, err := db.fs.Links(walked); err == nil && other == id {
+				found = append(found, walked)
+				if uint64(len(found)) == links-1 {
+					return errFoundLinks
+				}
+			}
+			return nil
+		})
+	}
+	if isCancelled(req) {
+		return
+	}
+	sort.Strings(found)
+	matches := len(found)
+	if max := req.Settings.MaxResults; max > 0 && len(found) > max {
+		found = found[:max]
+	}
+	for _, p := range found {
+		select {
+		case req.ResponseChannel <- p:
+		case <-req.Done:
+			return
+		}
+	}
+	duration := time.Since(start)
+	req.Logger().Debug("sent links", "path", path, "links", links, "found", matches,
+		"duration", duration)
+	db.recordQuery(req, duration, len(found))
+	if missing := int(links) - 1 - matches; missing > 0 {
+		sendWarning(req, request.Warning{Code: request.WarnLinksMissing,
+			Message: fmt.Sprintf("%d of the %d links to %s aren't indexed", missing, links, path)})
+	}
+	sendStatus(req, matches, len(found), ix, asOf)
+}
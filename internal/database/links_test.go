@@ -0,0 +1,91 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func newLinksIndexer() (*Indexer, *fakeFS) {
+	fs := newFakeFS("/r/photos/a.jpg", "/r/photos/b.jpg", "/r/other/c.jpg")
+	fs.link("/r/backup/2019/a.jpg", "/r/photos/a.jpg")
+	fs.link("/r/b/a.jpg", "/r/photos/a.jpg")
+	fs.link("/r/backup/b.jpg", "/r/photos/b.jpg")
+	return newFakeIndexer(fs, Options{}), fs
+}
+
+func TestCollapseHardlinks(t *testing.T) {
+	db, _ := newLinksIndexer()
+	tests := []struct {
+		name     string
+		query    string
+		settings request.Settings
+		want     []string
+	}{
+		{"all_links", "jpg", request.Settings{}, []string{"/r/backup/2019/a.jpg",
+			"/r/photos/a.jpg", "/r/backup/b.jpg", "/r/photos/b.jpg", "/r/other/c.jpg", "/r/b/a.jpg"}},
+		// the shortest path is kept, the first in order of equal ones
+		{"collapsed", "jpg", request.Settings{CollapseHardlinks: true}, []string{
+			request.LinksLine("/r/backup/b.jpg", 1), "/r/other/c.jpg",
+			request.LinksLine("/r/b/a.jpg", 2)}},
+		// the links that aren't results aren't counted
+		{"other_links_not_found", "photosa", request.Settings{Action: request.PathSearch,
+			CollapseHardlinks: true}, []string{"/r/photos/a.jpg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runRequest(db, request.Request{Query: tt.query, Settings: tt.settings})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinks(t *testing.T) {
+	db, fs := newLinksIndexer()
+	// not indexed, it is missing from the links found
+	fs.link("/x/a.jpg", "/r/photos/a.jpg")
+	tests := []struct {
+		name     string
+		path     string
+		max      int
+		want     []string
+		wantCode string
+	}{
+		{"links", "/r/photos/a.jpg", 0,
+			[]string{"/r/b/a.jpg", "/r/backup/2019/a.jpg", request.WarnLinksMissing}, ""},
+		{"max_results", "/r/backup/2019/a.jpg", 1,
+			[]string{"/r/b/a.jpg", request.WarnLinksMissing}, ""},
+		{"no_links", "/r/other/c.jpg", 0, nil, ""},
+		{"relative", "photos/a.jpg", 0, nil, request.ErrInvalidRequest},
+		{"directory", "/r/photos", 0, nil, request.ErrInvalidRequest},
+		{"missing", "/r/photos/d.jpg", 0, nil, request.ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := runRequest(db, request.Request{Version: 1, Query: tt.path,
+				Features: []string{request.FeatureWarnings},
+				Settings: request.Settings{Action: request.Links, MaxResults: tt.max}})
+			var got []string
+			var code string
+			for _, line := range lines {
+				if e, ok := request.ParseError(line); ok {
+					code = e.Code
+					continue
+				}
+				if w, ok := request.ParseWarning(line); ok {
+					line = w.Code
+				}
+				got = append(got, line)
+			}
+			if code != tt.wantCode {
+				t.Errorf("error %q, want %q", code, tt.wantCode)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+//go:build linux
+
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"golang.org/x/sys/unix"
+)
+
+// mkdirDeep creates a tree of depth directories named name below dir
+// and a file named leaf in the deepest one, using paths relative to the
+// directories created, and returns the path of the file
+func mkdirDeep(t *testing.T, dir, name string, depth int, leaf string) string {
+	t.Helper()
+	fd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := dir
+	for i := 0; i < depth; i++ {
+		if err := unix.Mkdirat(fd, name, 0700); err != nil {
+			t.Fatal(err)
+		}
+		next, err := unix.Openat(fd, name, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		unix.Close(fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fd, path = next, path+"/"+name
+	}
+	defer unix.Close(fd)
+	file, err := unix.Openat(fd, leaf, unix.O_WRONLY|unix.O_CREAT|unix.O_CLOEXEC, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unix.Close(file)
+	return path + "/" + leaf
+}
+
+func TestLongPaths(t *testing.T) {
+	dir := t.TempDir()
+	leaf := mkdirDeep(t, dir, strings.Repeat("d", 200), 30, "deep-leaf.txt")
+	if len(leaf) < 6000 {
+		t.Fatalf("the path of the leaf has %d bytes", len(leaf))
+	}
+	if _, err := os.Lstat(leaf); err == nil {
+		t.Skip("the kernel takes paths longer than PATH_MAX")
+	}
+
+	db := New(Options{Root: dir})
+	db.initialIndex()
+	if isDir, err := db.fs.Lstat(leaf); err != nil || isDir {
+		t.Errorf("Lstat() = %v, %v", isDir, err)
+	}
+
+	tests := []struct {
+		name     string
+		settings request.Settings
+	}{
+		{"by_name", request.Settings{}},
+		{"by_mtime", request.Settings{SortBy: request.SortMtime}},
+		{"files", request.Settings{TypeFilter: request.TypeFile}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runRequest(db, request.Request{Version: 1, Query: "deep-leaf",
+				Features: []string{request.FeatureWarnings}, Settings: tt.settings})
+			if !reflect.DeepEqual(got, []string{leaf}) {
+				t.Errorf("got %d lines, want the leaf: %.200q", len(got), got)
+			}
+		})
+	}
+
+	top := filepath.Join(dir, strings.Repeat("d", 200))
+	if err := os.RemoveAll(top); err != nil {
+		t.Fatal(err)
+	}
+	db.refreshDirectory(dir)
+	if got := runRequest(db, request.Request{Query: "deep-leaf"}); len(got) != 0 {
+		t.Errorf("found %.200q after deleting it", got)
+	}
+	if got := runRequest(db, request.Request{Query: "ddd"}); len(got) != 0 {
+		t.Errorf("found %d directories after deleting them", len(got))
+	}
+}
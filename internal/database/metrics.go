@@ -0,0 +1,67 @@
+package database
+
+import (
+	"runtime"
+
+	"github.com/ozeidan/gosearch/internal/metrics"
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+var (
+	indexedFilesGauge = metrics.NewGauge("indexed_files",
+		"Files found by the last full index")
+	indexedDirectoriesGauge = metrics.NewGauge("indexed_directories",
+		"Directories found by the last full index")
+	trieKeys = metrics.NewGauge("trie_keys",
+		"Distinct file names in the search trie")
+	refreshDuration = metrics.NewHistogram("refresh_duration_seconds",
+		"Time taken to refresh a directory after a change", metrics.DurationBuckets)
+	queryDuration = metrics.NewHistogramVec("query_duration_seconds",
+		"Time taken to answer a query", metrics.DurationBuckets,
+		"action", "substring", "prefix", "fuzzy", "path", "segments", "duplicates",
+		"changed_since", "history", "jump", "trash", "deleted", "tree", "recent", "links", "other")
+)
+
+func init() {
+	metrics.NewGaugeFunc("index_memory_bytes", "Heap memory in use, mostly by the index",
+		func() float64 {
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			return float64(m.HeapAlloc)
+		})
+}
+
+// actionLabel returns the label of a search action in queryDuration
+func actionLabel(action int) string {
+	switch action {
+	case request.SubStringSearch:
+		return "substring"
+	case request.PrefixSearch:
+		return "prefix"
+	case request.FuzzySearch:
+		return "fuzzy"
+	case request.PathSearch:
+		return "path"
+	case request.SegmentSearch:
+		return "segments"
+	case request.Duplicates:
+		return "duplicates"
+	case request.ChangedSince:
+		return "changed_since"
+	case request.History:
+		return "history"
+	case request.Jump:
+		return "jump"
+	case request.Trash:
+		return "trash"
+	case request.Deleted:
+		return "deleted"
+	case request.Tree:
+		return "tree"
+	case request.Recent:
+		return "recent"
+	case request.Links:
+		return "links"
+	}
+	return "other"
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/health"
+	"github.com/ozeidan/gosearch/internal/notify"
+)
+
+// progressInterval is how often the progress of a full index
+// is reported to systemd
+const progressInterval = time.Second
+
+// reportProgress updates the status of the service during a full index.
+// The walk pings the watchdog itself, since the main loop is blocked.
+func (db *Indexer) reportProgress(indexed uint64) {
+	if !db.daemon || time.Since(db.lastProgress) < progressInterval {
+		return
+	}
+	db.lastProgress = time.Now()
+
+	states := []string{notify.Status("indexing, %d paths so far", indexed), notify.Watchdog}
+	if !db.ready {
+		// the initial index can take longer than the start timeout
+		states = append(states, notify.ExtendTimeout(10*progressInterval))
+	}
+	sendNotify(states...)
+}
+
+func sendNotify(states ...string) {
+	if err := notify.Send(states...); err != nil {
+		slog.Warn("couldn't notify systemd", "err", err)
+	}
+}
+
+// priorityIndexed reports that a full index is done with the
+// priority directories, the rest may take much longer
+func (db *Indexer) priorityIndexed() {
+	slog.Info("indexed the priority directories", "paths", db.priority)
+	if !db.daemon {
+		return
+	}
+	health.SetPrioritized()
+	if !db.ready {
+		sendNotify(notify.Ready,
+			notify.Status("indexed the priority directories, indexing the rest"))
+	}
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"path/filepath"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// parentsOf returns the directories holding the sorted results, each
+// once, at the position of the best result in it. Unless ReverseSort
+// or NoSort is set, the best results are sorted last. Only results
+// below Root, if it is set, are counted.
+func parentsOf(results resulter, settings request.Settings) resulter {
+	root := ""
+	if settings.Root != "" {
+		root = filepath.Clean(settings.Root)
+	}
+	bestLast := !settings.ReverseSort && !settings.NoSort
+	n := results.Len()
+	seen := make(map[string]bool)
+	parents := make(sortedResults, 0)
+	for i := 0; i < n; i++ {
+		path := results.Result(i)
+		if bestLast {
+			path = results.Result(n - 1 - i)
+		}
+		if rest, ok := below(path, root); root != "" && (!ok || rest == "") {
+			continue
+		}
+		dir := filepath.Dir(path)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		parents = append(parents, dir)
+	}
+	if bestLast {
+		for i, j := 0, len(parents)-1; i < j; i, j = i+1, j-1 {
+			parents[i], parents[j] = parents[j], parents[i]
+		}
+	}
+	return parents
+}
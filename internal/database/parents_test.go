@@ -0,0 +1,36 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestQueryIndex_Parents(t *testing.T) {
+	db := newFakeIndexer(newFakeFS("/r/a/report.txt", "/r/a/report-2019.txt",
+		"/r/b/c/report.md", "/r/b/notes.txt", "/r/report/"), Options{})
+	tests := []struct {
+		name     string
+		settings request.Settings
+		want     []string
+	}{
+		// the directory with the shortest result is the best one
+		{"parents", request.Settings{}, []string{"/r/b/c", "/r/a", "/r"}},
+		{"reverse", request.Settings{ReverseSort: true}, []string{"/r", "/r/a", "/r/b/c"}},
+		{"max_results", request.Settings{MaxResults: 2}, []string{"/r/a", "/r"}},
+		{"files", request.Settings{TypeFilter: request.TypeFile}, []string{"/r/b/c", "/r/a"}},
+		{"root", request.Settings{Root: "/r/b"}, []string{"/r/b/c"}},
+		{"root_parent", request.Settings{Root: "/r/a"}, []string{"/r/a"}},
+		{"fuzzy", request.Settings{Action: request.FuzzySearch}, []string{"/r/b/c", "/r/a", "/r"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.settings.Parents = true
+			got := runRequest(db, request.Request{Query: "report", Settings: tt.settings})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// partialPollEntries is how many entries the initial index adds
+// between looking for requests
+const partialPollEntries = 4096
+
+// partialWarningPaths is how many of the directories not indexed yet
+// a WarnPartialIndex names
+const partialWarningPaths = 5
+
+// partialIndex answers the searches received during the initial index
+// from the walk, on the entries indexed so far. It tracks which entries
+// of the root were walked, the index is complete below those.
+type partialIndex struct {
+	// requests is the channel requests are received on, nil once
+	// the initial index completed
+	requests <-chan request.Request
+	// pending are the entries of the root that weren't walked yet,
+	// entered is set once they are known
+	pending []string
+	entered bool
+	// held are the requests answered once the entries they need are
+	// indexed, searches with WaitIndex and everything but searches
+	held []request.Request
+	// closed is set if requests was closed during the walk
+	closed bool
+}
+
+// entering records the entries of the root before they are walked
+func (p *partialIndex) entering(paths []string) {
+	p.pending = paths
+	p.entered = true
+}
+
+// missing returns the entries of the root at or below root, or leading
+// to it, that weren't walked yet
+func (p *partialIndex) missing(root string) []string {
+	var missing []string
+	for _, path := range p.pending {
+		_, isBelow := below(path, root)
+		_, leads := below(root, path)
+		if isBelow || leads {
+			missing = append(missing, path)
+		}
+	}
+	return missing
+}
+
+// covers returns whether the entries below root are all indexed
+func (p *partialIndex) covers(root string) bool {
+	return p.entered && len(p.missing(root)) == 0
+}
+
+// readsIndex returns whether a search with action reads the
+// index, the others are answered from what the server records
+func readsIndex(action int) bool {
+	switch action {
+	case request.History, request.Trash, request.Deleted:
+		return false
+	}
+	return request.IsQuery(action)
+}
+
+// indexProgress is the progress of a full index answering the
+// requests received during it
+func (db *Indexer) indexProgress(added uint64) {
+	db.reportProgress(added)
+	if added%partialPollEntries == 0 {
+		db.pollRequests()
+	}
+}
+
+// walkedTopLevel records that the entry of the root at path was walked,
+// the searches waiting for it are answered
+func (db *Indexer) walkedTopLevel(path string) {
+	p := &db.partial
+	for i, pending := range p.pending {
+		if pending == path {
+			p.pending = append(p.pending[:i], p.pending[i+1:]...)
+			break
+		}
+	}
+	held := p.held[:0]
+	for _, req := range p.held {
+		if request.IsQuery(req.Settings.Action) && p.covers(db.partialRoot(req)) {
+			req.Logger().Debug("answering search held for the index", "indexed", path)
+			db.handleRequest(req)
+			continue
+		}
+		held = append(held, req)
+	}
+	p.held = held
+	db.pollRequests()
+}
+
+// pollRequests answers the searches received during the initial index
+// and holds the other requests, without waiting for any
+func (db *Indexer) pollRequests() {
+	p := &db.partial
+	for !p.closed {
+		select {
+		case req, ok := <-p.requests:
+			if !ok {
+				p.closed = true
+				return
+			}
+			db.answerPartial(req)
+		default:
+			return
+		}
+	}
+}
+
+// partialRoot returns the directory whose entries req needs
+func (db *Indexer) partialRoot(req request.Request) string {
+	if req.Settings.Root != "" {
+		return req.Settings.Root
+	}
+	return db.root
+}
+
+// answerPartial answers a request received during the initial index,
+// searches on the entries indexed so far with a warning naming the
+// others. During a reindex searches run on the complete old index.
+func (db *Indexer) answerPartial(req request.Request) {
+	p := &db.partial
+	if !request.IsQuery(req.Settings.Action) {
+		p.held = append(p.held, req)
+		return
+	}
+	if db.rebuilding {
+		db.dispatchRequest(req)
+		return
+	}
+	root := db.partialRoot(req)
+	if readsIndex(req.Settings.Action) && !p.covers(root) {
+		if req.Settings.WaitIndex {
+			p.held = append(p.held, req)
+			return
+		}
+		sendWarning(req, db.partialWarning(root))
+	}
+	db.handleRequest(req)
+}
+
+// partialWarning names the directories below root that
+// aren't indexed yet
+func (db *Indexer) partialWarning(root string) request.Warning {
+	if !db.partial.entered {
+		return request.Warning{Code: request.WarnPartialIndex,
+			Message: "the index is being built, the results are incomplete"}
+	}
+	missing := db.partial.missing(root)
+	message := strings.Join(missing, ", ")
+	if len(missing) > partialWarningPaths {
+		message = fmt.Sprintf("%s and %d more", strings.Join(missing[:partialWarningPaths], ", "),
+			len(missing)-partialWarningPaths)
+	}
+	return request.Warning{Code: request.WarnPartialIndex,
+		Message: "the index is being built, not indexed yet: " + message}
+}
+
+// answerHeld ends answering requests from the walk of the initial
+// index and handles the requests held during it, in order. It returns
+// false if no more requests are received.
+func (db *Indexer) answerHeld() bool {
+	p := &db.partial
+	held, closed := p.held, p.closed
+	*p = partialIndex{}
+	for _, req := range held {
+		db.dispatchRequest(req)
+	}
+	return !closed
+}
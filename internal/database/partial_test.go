@@ -0,0 +1,85 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestPartialIndex(t *testing.T) {
+	fs := newFakeFS("/r/a/notes.txt", "/r/b/notes.txt", "/r/c/d/")
+	db := New(Options{Root: "/r"})
+	db.fs = fs
+
+	tests := []struct {
+		name     string
+		settings request.Settings
+		want     []string
+	}{
+		// received before the walk, answered once /r/a is indexed
+		{"partial", request.Settings{}, []string{
+			request.WarnPartialIndex + ": the index is being built, not indexed yet: /r/b, /r/c",
+			"/r/a/notes.txt"}},
+		{"wait", request.Settings{WaitIndex: true}, []string{"/r/a/notes.txt", "/r/b/notes.txt"}},
+	}
+	requests := make(chan request.Request, len(tests))
+	responses := make([]chan []string, len(tests))
+	for i, tt := range tests {
+		req := request.Request{Version: 1, Query: "notes",
+			Features: []string{request.FeatureWarnings}, Settings: tt.settings,
+			ResponseChannel: make(chan string), Done: make(chan struct{})}
+		responses[i] = make(chan []string, 1)
+		go func(lines chan<- []string) {
+			var got []string
+			for line := range req.ResponseChannel {
+				if w, ok := request.ParseWarning(line); ok {
+					line = w.Code + ": " + w.Message
+				}
+				got = append(got, line)
+			}
+			lines <- got
+		}(responses[i])
+		requests <- req
+	}
+	close(requests)
+	db.Run(nil, requests)
+
+	for i, tt := range tests {
+		got := <-responses[i]
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if db.partial.requests != nil || len(db.partial.held) != 0 {
+		t.Error("requests are still answered from the walk")
+	}
+}
+
+func TestPartialIndex_Covers(t *testing.T) {
+	var p partialIndex
+	if p.covers("/r/a") {
+		t.Error("covers() before the entries of the root are known")
+	}
+	p.entering([]string{"/r/b", "/r/c"})
+	tests := []struct {
+		root string
+		want bool
+	}{
+		{"/r/a", true},
+		{"/r/a/x", true},
+		{"/r/b", false},
+		{"/r/b/x", false},
+		{"/r/bb", true},
+		{"/r", false},
+	}
+	for _, tt := range tests {
+		if got := p.covers(tt.root); got != tt.want {
+			t.Errorf("covers(%q) = %v, want %v", tt.root, got, tt.want)
+		}
+	}
+	if got := strings.Join(p.missing("/r"), " "); got != "/r/b /r/c" {
+		t.Errorf("missing(/r) = %q", got)
+	}
+}
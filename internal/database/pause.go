@@ -0,0 +1,71 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ozeidan/gosearch/internal/health"
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// recordChange remembers the directory of a change received while paused
+func (db *Indexer) recordChange(path string) {
+	db.pausedEvents++
+	db.pendingDirectories[path] = true
+}
+
+func (db *Indexer) pause(req request.Request) {
+	reply := "paused"
+	if db.paused {
+		reply = "already paused"
+	} else {
+		db.paused = true
+		if db.daemon {
+			health.SetPaused(true)
+		}
+		db.pausedEvents = 0
+		req.Logger().Info("pausing the application of file changes")
+	}
+
+	select {
+	case req.ResponseChannel <- reply:
+	case <-req.Done:
+	}
+	close(req.ResponseChannel)
+}
+
+func (db *Indexer) resume(req request.Request) {
+	if !db.paused {
+		select {
+		case req.ResponseChannel <- "not paused":
+		case <-req.Done:
+		}
+		close(req.ResponseChannel)
+		return
+	}
+
+	directories := make([]string, 0, len(db.pendingDirectories))
+	for path := range db.pendingDirectories {
+		directories = append(directories, path)
+	}
+	db.paused = false
+	if db.daemon {
+		health.SetPaused(false)
+	}
+	db.pendingDirectories = make(map[string]bool)
+
+	select {
+	case req.ResponseChannel <- fmt.Sprintf("resuming, refreshing %d directories",
+		len(directories)):
+	case <-req.Done:
+	}
+	close(req.ResponseChannel)
+
+	req.Logger().Info("resuming", "events", db.pausedEvents,
+		"directories", len(directories))
+	// parents first, their refresh may already index new subdirectories
+	sort.Strings(directories)
+	for _, path := range directories {
+		db.refreshDirectory(path)
+	}
+}
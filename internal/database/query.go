@@ -1,10 +1,16 @@
 package database
 
 import (
-	"log"
+	"container/heap"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
 	"time"
+	"unicode/utf8"
 
+	"github.com/ozeidan/gosearch/internal/config"
 	"github.com/ozeidan/gosearch/internal/request"
 	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
 )
@@ -42,32 +48,307 @@ func (l byLength) Result(index int) string {
 	return l[index]
 }
 
-func queryIndex(req request.Request) {
+type mtimeResult struct {
+	result string
+	mtime  int64
+}
+
+// byMtime sorts recently modified files first, like shorter paths
+// are sorted first by byLength, and those as old by length
+type byMtime []mtimeResult
+
+func (m byMtime) Len() int      { return len(m) }
+func (m byMtime) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m byMtime) Less(i, j int) bool {
+	if m[i].mtime != m[j].mtime {
+		return m[i].mtime > m[j].mtime
+	}
+	return len(m[i].result) < len(m[j].result)
+}
+func (m byMtime) Result(index int) string {
+	return m[index].result
+}
+
+// recentHeap holds the most recently modified results found so far,
+// the oldest of them on top
+type recentHeap struct{ byMtime }
+
+func (h recentHeap) Less(i, j int) bool  { return h.byMtime.Less(j, i) }
+func (h *recentHeap) Push(x interface{}) { h.byMtime = append(h.byMtime, x.(mtimeResult)) }
+func (h *recentHeap) Pop() interface{} {
+	last := h.byMtime[len(h.byMtime)-1]
+	h.byMtime = h.byMtime[:len(h.byMtime)-1]
+	return last
+}
+
+// withMtimes looks up the modification times of the results, files
+// that vanished or couldn't be stat'ed are sorted as the oldest.
+// unreadable is the number of the latter. With keep above 0 only the
+// keep most recently modified results are kept. It stops once req is
+// cancelled.
+func withMtimes(results resulter, keep int, req request.Request) (recent byMtime, unreadable int) {
+	if keep <= 0 || keep > results.Len() {
+		keep = results.Len()
+	}
+	h := &recentHeap{make(byMtime, 0, keep)}
+	for i := 0; i < results.Len() && !isCancelled(req); i++ {
+		r := mtimeResult{result: results.Result(i)}
+		info, err := lstat(r.result)
+		if err == nil {
+			r.mtime = info.ModTime().UnixNano()
+		} else if !os.IsNotExist(err) {
+			unreadable++
+		}
+		if h.Len() < keep {
+			heap.Push(h, r)
+		} else if (byMtime{r, h.byMtime[0]}).Less(0, 1) {
+			h.byMtime[0] = r
+			heap.Fix(h, 0)
+		}
+	}
+	return h.byMtime, unreadable
+}
+
+// mtimeKeep returns how many of the most recently modified results a
+// search sorted by mtime sends, 0 if all of them are needed because
+// later steps drop or merge results
+func mtimeKeep(settings request.Settings) int {
+	if settings.VerifyExists || settings.CollapseHardlinks || settings.Parents || settings.Aliases {
+		return 0
+	}
+	return settings.MaxResults
+}
+
+func (db *Indexer) queryIndex(req request.Request) {
 	defer close(req.ResponseChannel)
-	log.Printf("req = %+v\n", req)
-	log.Printf("string(req.Query) = %+v\n", string(req.Query))
+	defer queryDuration.With(actionLabel(req.Settings.Action)).ObserveSince(time.Now())
+	log := req.Logger()
+	log.Debug("query", "query", req.Query, "action", req.Settings.Action,
+		"max_results", req.Settings.MaxResults)
+	if e := db.rejectQuery(req); e != nil {
+		writeError(req, *e)
+		return
+	}
+	filter, e := newEntryFilter(req.Settings)
+	if e != nil {
+		writeError(req, *e)
+		return
+	}
+	var coll *collator
+	if req.Settings.SortBy == request.SortCollate {
+		if coll, e = collatorFor(req.Settings.Locale); e != nil {
+			writeError(req, *e)
+			return
+		}
+	}
+	acquired, asOf := db.acquireIndex()
+	defer acquired.release()
+	ix, walked, e := db.rootIndex(acquired, req)
+	if e != nil {
+		writeError(req, *e)
+		return
+	}
+	if g := req.Settings.UnlessGeneration; g != 0 && ix == acquired && ix.generation == g {
+		sendUnchanged(req, ix, asOf)
+		return
+	}
+	start := time.Now()
+	key, cacheable := queryCacheKey(req)
+	// the results of lazy walks and of the cold tier aren't cached
+	cacheable = cacheable && db.cache != nil && ix == acquired && len(db.cold.options.Paths) == 0
+	var results resulter
+	var unreadable int
+	var dropped int
+	var notSniffed, cached, merged bool
+	var filtered, cold *request.Warning
+	if cacheable {
+		results, cached = db.cache.get(key, ix.generation)
+	}
+	visited, sorted := start, start
+	if !cached {
+		results, unreadable = db.search(ix, req, filter)
+		if req.Settings.IncludeFiltered != "" {
+			fx, w, e := db.filteredIndex(req)
+			if e != nil {
+				writeError(req, *e)
+				return
+			}
+			found, _ := db.search(fx, req, filter)
+			results = mergeFiltered(results, found, req.Settings.IncludeFiltered)
+			filtered, merged = w, true
+		}
+		if db.consultsCold(req, results.Len()) {
+			var err error
+			if results, cold, err = db.searchCold(results, req, filter); err != nil {
+				log.Warn("couldn't search the cold tier", "err", err)
+			}
+			merged = merged || cold != nil
+		}
+		if merged {
+			results = uniqueResults(results)
+		}
+		results, notSniffed = filter.addSniffed(results, req)
+		visited = time.Now()
+
+		if isCancelled(req) {
+			log.Debug("query cancelled", "query", req.Query)
+			return
+		}
+
+		if req.Settings.SortBy == request.SortMtime {
+			var n int
+			all := results.Len()
+			results, n = withMtimes(results, mtimeKeep(req.Settings), req)
+			unreadable += n
+			// the dropped results still count as matches
+			dropped = all - results.Len()
+			if isCancelled(req) {
+				log.Debug("query cancelled", "query", req.Query)
+				return
+			}
+		}
+		if coll != nil {
+			results = withCollationKeys(results, coll)
+		}
+
+		if !req.Settings.NoSort {
+			if req.Settings.ReverseSort {
+				sort.Sort(results)
+			} else {
+				sort.Sort(sort.Reverse(results))
+			}
+		}
+		sorted = time.Now()
+		if cacheable {
+			db.cache.add(key, ix.generation, results)
+		}
+	}
+
+	var scores map[string]float64
+	if req.Settings.Scores {
+		scores = scoresOf(results)
+	}
+	var vanished []string
+	var unverified bool
+	if req.Settings.VerifyExists {
+		results, vanished, unverified = db.verifyExisting(results, req.Settings,
+			config.VerifyExistsLimit())
+		db.refreshVanished(vanished)
+	}
+	if req.Settings.CollapseHardlinks {
+		var suppressed map[string]int
+		if results, suppressed = db.collapseHardlinks(results); len(suppressed) > 0 {
+			results = markLinks(results, suppressed)
+		}
+	}
+	if req.Settings.Parents {
+		results = parentsOf(results, req.Settings)
+	}
+
+	matches := results.Len() + dropped
+	if req.Settings.Aliases {
+		results = db.aliases.expand(results)
+	}
+	if req.Settings.IncludeFiltered != "" {
+		results = markFiltered(results, req.Settings.IncludeFiltered)
+	}
+	if scores != nil {
+		results = markScores(results, scores)
+	}
+	sent := sendResults(results, req)
+	if isCancelled(req) {
+		return
+	}
+	streamed := time.Now()
+
+	phases := queryPhases{
+		visit:   visited.Sub(start),
+		sort:    sorted.Sub(visited),
+		stream:  streamed.Sub(sorted),
+		matches: matches,
+		results: sent,
+	}
+	logSlowQuery(req, phases)
+	db.recordQuery(req, phases.total(), sent)
+
+	if unreadable > 0 {
+		sendWarning(req, unreadableWarning(unreadable))
+	}
+	if notSniffed {
+		sendWarning(req, notSniffedWarning())
+	}
+	if walked != nil {
+		sendWarning(req, *walked)
+	}
+	if filtered != nil {
+		sendWarning(req, *filtered)
+	}
+	if cold != nil {
+		sendWarning(req, *cold)
+	}
+	if len(vanished) > 0 {
+		sendWarning(req, vanishedWarning(len(vanished)))
+	}
+	if unverified {
+		sendWarning(req, notVerifiedWarning(config.VerifyExistsLimit()))
+	}
+	if req.Wants(request.FeatureWarnings) {
+		index, _ := db.mountStates()
+		first, last := resultRange(results, req.Settings)
+		for _, s := range index.staleMounts(results, first, last) {
+			sendWarning(req, s.warning(time.Now()))
+		}
+	}
+	if req.Settings.Timing {
+		select {
+		case req.ResponseChannel <- phases.timing().Line():
+		case <-req.Done:
+		}
+	}
+	sendStatus(req, matches, sent, acquired, asOf)
+}
+
+// search returns the entries of ix matching the query of req,
+// unreadable counts the entries that couldn't be stat'ed
+func (db *Indexer) search(ix *index, req request.Request, filter *entryFilter) (results resulter, unreadable int) {
 	prefix := trie.Prefix(req.Query)
+	if filter.tag != "" {
+		filter.tagged = ix.tags.entries[filter.tag]
+	}
 
-	var results resulter
+	if req.Query == "" && filter.tag != "" && req.Settings.Action != request.ChangedSince {
+		// only the tagged entries can match, far fewer than
+		// the entries with any name
+		return ix.taggedEntries(req, filter), 0
+	}
+	if usesWildcards(req) {
+		return ix.wildcardSearch(req, filter), 0
+	}
 
-	start := logStart("query")
 	switch req.Settings.Action {
 	case request.PrefixSearch:
 		tempResults := byLength{}
-		indexTrie.VisitSubtree(prefix, func(prefix trie.Prefix, item trie.Item) error {
-			list := item.([]indexedFile)
-			for _, file := range list {
-				tempResults = append(tempResults,
-					file.pathNode.GetPath())
+		ix.trie.VisitSubtree(prefix, func(prefix trie.Prefix, item trie.Item) error {
+			if isCancelled(req) {
+				return errCancelled
 			}
+			entriesOf(item).forEach(func(file indexedFile) bool {
+				if filter.matches(file, 0) {
+					tempResults = append(tempResults, file.pathNode.GetPath())
+				}
+				return true
+			})
 			return nil
 		})
 
 		results = byLength(tempResults)
 	case request.PathSearch:
 		tempResults := []sortResult{}
-		fileTree.VisitFuzzy([]byte(prefix), req.Settings.CaseInsensitive,
+		ix.tree.VisitFuzzy([]byte(prefix), req.Settings.CaseInsensitive,
 			func(prefix trie.Prefix, item trie.Item, skipped int) error {
+				if isCancelled(req) {
+					return errCancelled
+				}
 				tempResults = append(tempResults,
 					sortResult{string(prefix), skipped})
 				return nil
@@ -76,74 +357,249 @@ func queryIndex(req request.Request) {
 		results = bySkipped(tempResults)
 	case request.SubStringSearch:
 		tempResults := byLength{}
-		indexTrie.VisitSubstring(prefix, req.Settings.CaseInsensitive,
-			func(prefix trie.Prefix, item trie.Item) error {
-				list := item.([]indexedFile)
-				for _, file := range list {
-					tempResults = append(tempResults,
-						file.pathNode.GetPath())
+		visitor := func(prefix trie.Prefix, item trie.Item) error {
+			if isCancelled(req) {
+				return errCancelled
+			}
+			entriesOf(item).forEach(func(file indexedFile) bool {
+				if filter.matches(file, 0) {
+					tempResults = append(tempResults, file.pathNode.GetPath())
 				}
-				return nil
+				return true
 			})
+			return nil
+		}
+		if !ix.visitTrigramCandidates(req.Query, req.Settings.CaseInsensitive, visitor) {
+			ix.visitContaining(req.Query, req.Settings.CaseInsensitive, visitor)
+		}
 
 		results = byLength(tempResults)
 	case request.FuzzySearch:
 		tempResults := []sortResult{}
-		indexTrie.VisitFuzzy(prefix, req.Settings.CaseInsensitive,
+		minScore := req.Settings.MinScore
+		ix.trie.VisitFuzzy(prefix, req.Settings.CaseInsensitive,
 			func(prefix trie.Prefix, item trie.Item, skipped int) error {
-				list := item.([]indexedFile)
-				for _, file := range list {
-					tempResults = append(tempResults,
-						sortResult{file.pathNode.GetPath(), skipped})
+				if isCancelled(req) {
+					return errCancelled
+				}
+				// poor matches aren't collected, so they aren't sorted
+				if minScore > 0 && request.FuzzyScore(skipped, len(prefix)) < minScore {
+					return nil
 				}
+				entriesOf(item).forEach(func(file indexedFile) bool {
+					if filter.matches(file, skipped) {
+						tempResults = append(tempResults,
+							sortResult{file.pathNode.GetPath(), skipped})
+					}
+					return true
+				})
 				return nil
 			})
 
 		results = bySkipped(tempResults)
+	case request.SegmentSearch:
+		results = ix.segmentSearch(req, filter)
+	case request.ChangedSince:
+		results, unreadable = ix.changedSince(req, filter)
+	case request.Jump:
+		results = db.jump(ix, req)
 	}
-	logStop(start)
+	return results, unreadable
+}
 
-	if !req.Settings.NoSort {
-		start = logStart("sort")
-		if req.Settings.ReverseSort {
-			sort.Sort(results)
-		} else {
-			sort.Sort(sort.Reverse(results))
-		}
-		logStop(start)
+// sendStatus ends the results of a search with a Status line,
+// if the client wants one. ix is the index searched and asOf when it
+// was current, nil and zero for searches not reading the index.
+func sendStatus(req request.Request, matches, sent int, ix *index, asOf time.Time) {
+	if !req.Wants(request.FeatureStatus) {
+		return
 	}
+	status := request.Status{Matches: matches, Results: sent, Truncated: sent < matches,
+		RequestID: req.RequestID, AsOf: unixTime(asOf)}
+	if ix != nil {
+		status.Generation = ix.generation
+	}
+	if req.Settings.Action == request.FuzzySearch && (req.Settings.MinScore != 0 || req.Settings.Scores) {
+		status.ScoreVersion = request.ScoreVersion
+	}
+	select {
+	case req.ResponseChannel <- status.Line():
+	case <-req.Done:
+	}
+}
 
-	sendResults(results, req)
+// sendUnchanged answers a search whose client still has the results
+// found in the generation of ix
+func sendUnchanged(req request.Request, ix *index, asOf time.Time) {
+	status := request.Status{RequestID: req.RequestID, AsOf: unixTime(asOf),
+		Generation: ix.generation, Unchanged: true}
+	select {
+	case req.ResponseChannel <- status.Line():
+	case <-req.Done:
+	}
 }
 
-func sendResults(results resulter, req request.Request) {
-	maxResults := req.Settings.MaxResults
-	if maxResults == 0 || maxResults > results.Len() {
-		maxResults = results.Len()
+// sendWarning sends w after the results of a search,
+// if the client wants warnings
+func sendWarning(req request.Request, w request.Warning) {
+	if !req.Wants(request.FeatureWarnings) {
+		return
+	}
+	select {
+	case req.ResponseChannel <- w.Line():
+	case <-req.Done:
 	}
+}
+
+// queryPhases are the durations of the phases of a query
+type queryPhases struct {
+	visit, sort, stream time.Duration
+	matches, results    int
+}
 
-	var startIndex int
+func (p queryPhases) total() time.Duration {
+	return p.visit + p.sort + p.stream
+}
 
-	if req.Settings.ReverseSort {
-		startIndex = 0
-	} else {
-		startIndex = results.Len() - maxResults
+// timing returns the phases as sent to clients
+func (p queryPhases) timing() request.Timing {
+	return request.Timing{
+		Visit:   p.visit.Seconds(),
+		Sort:    p.sort.Seconds(),
+		Stream:  p.stream.Seconds(),
+		Matches: p.matches,
+		Results: p.results,
 	}
+}
+
+// logSlowQuery logs queries that took longer than the
+// slow_query_threshold, with the phase the time was spent in
+func logSlowQuery(req request.Request, phases queryPhases) {
+	threshold := config.SlowQueryThreshold()
+	if threshold == 0 || phases.total() < threshold {
+		req.Logger().Debug("query done", "duration", phases.total())
+		return
+	}
+
+	req.Logger().Warn("slow query", "query", req.Query,
+		"action", actionLabel(req.Settings.Action),
+		"matches", phases.matches, "results", phases.results,
+		"duration", phases.total(), "visit", phases.visit,
+		"sort", phases.sort, "stream", phases.stream)
+}
 
-	for i := startIndex; i < startIndex+maxResults; i++ {
+// rejectQuery returns why req isn't answered, nil if it is. Empty
+// queries match every entry, short ones most of them, and sorting
+// them would hold up the index for a long time.
+func (db *Indexer) rejectQuery(req request.Request) *request.ErrorResponse {
+	settings := req.Settings
+	if settings.Tag != "" && db.tagsXattr == "" {
+		return &request.ErrorResponse{Code: request.ErrInvalidRequest,
+			Message: "tags aren't indexed, set tags_xattr in the config"}
+	}
+	query := req.Query
+	if usesWildcards(req) {
+		if _, err := filepath.Match(req.Query, ""); err != nil {
+			return &request.ErrorResponse{Code: request.ErrInvalidRequest,
+				Message: "invalid pattern " + req.Query}
+		}
+		// the names matching a pattern contain its literal text
+		query = parseWildcards(req).longest
+	}
+	if settings.Action == request.ChangedSince {
+		// doesn't have a query
+		return nil
+	}
+	if settings.Action == request.Recent && req.Query == "" {
+		// lists the few entries kept
+		return nil
+	}
+
+	if req.Query == "" {
+		if settings.ListAll || settings.Tag != "" {
+			return nil
+		}
+		return &request.ErrorResponse{Code: request.ErrQueryTooShort,
+			Message: "the query is empty, set list_all to list every entry"}
+	}
+
+	switch settings.Action {
+	case request.SubStringSearch, request.FuzzySearch,
+		request.PathSearch, request.SegmentSearch:
+	default:
+		return nil
+	}
+	if utf8.RuneCountInString(query) >= db.minQueryLength ||
+		(settings.NoSort && settings.MaxResults > 0) {
+		return nil
+	}
+	return &request.ErrorResponse{Code: request.ErrQueryTooShort,
+		Message: fmt.Sprintf("queries shorter than %d characters have to be "+
+			"unsorted and limited, set no_sort and max_results", db.minQueryLength)}
+}
+
+var errCancelled = errors.New("query cancelled")
+
+// isCancelled returns whether the client gave up on req
+func isCancelled(req request.Request) bool {
+	select {
+	case <-req.Done:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendResults sends the results allowed by the settings of req
+// and returns how many were sent
+func sendResults(results resulter, req request.Request) int {
+	startIndex, endIndex := resultRange(results, req.Settings)
+	for i := startIndex; i < endIndex; i++ {
 		select {
 		case req.ResponseChannel <- results.Result(i):
 		case <-req.Done:
-			return
+			return i - startIndex
 		}
 	}
+	return endIndex - startIndex
 }
 
-func logStart(action string) time.Time {
-	log.Println("starting to", action)
-	return time.Now()
+// uniqueResults drops the results at paths found before, which results
+// merged from several sources may have, so each entry is sent once
+func uniqueResults(results resulter) resulter {
+	seen := make(map[string]bool, results.Len())
+	switch r := results.(type) {
+	case byLength:
+		unique := r[:0]
+		for _, path := range r {
+			if !seen[path] {
+				seen[path] = true
+				unique = append(unique, path)
+			}
+		}
+		return unique
+	case bySkipped:
+		unique := r[:0]
+		for _, s := range r {
+			if !seen[s.result] {
+				seen[s.result] = true
+				unique = append(unique, s)
+			}
+		}
+		return unique
+	}
+	return results
 }
 
-func logStop(start time.Time) {
-	log.Println("done in", time.Now().Sub(start))
+// resultRange returns the indices of the sorted results that are sent,
+// the last MaxResults ones unless ReverseSort is set
+func resultRange(results resulter, settings request.Settings) (start, end int) {
+	maxResults := settings.MaxResults
+	if maxResults == 0 || maxResults > results.Len() {
+		maxResults = results.Len()
+	}
+	if settings.ReverseSort {
+		return 0, maxResults
+	}
+	return results.Len() - maxResults, results.Len()
 }
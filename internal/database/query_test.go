@@ -0,0 +1,611 @@
+package database
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestQueryIndex_Timing(t *testing.T) {
+	db := newSyntheticIndexer(2000)
+
+	tests := []struct {
+		name       string
+		settings   request.Settings
+		wantTiming bool
+	}{
+		{"without_timing", request.Settings{Action: request.PrefixSearch, MaxResults: 5}, false},
+		{"limited", request.Settings{Action: request.PrefixSearch, MaxResults: 5, Timing: true}, true},
+		{"fuzzy", request.Settings{Action: request.FuzzySearch, Timing: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := request.Request{
+				Query:           "s",
+				Settings:        tt.settings,
+				ResponseChannel: make(chan string),
+				Done:            make(chan struct{}),
+			}
+			go db.queryIndex(req)
+
+			var lines []string
+			for line := range req.ResponseChannel {
+				lines = append(lines, line)
+			}
+			if len(lines) == 0 {
+				t.Fatal("no results")
+			}
+
+			timing, ok := request.ParseTiming(lines[len(lines)-1])
+			if ok != tt.wantTiming {
+				t.Fatalf("last line %q, want timing %v", lines[len(lines)-1], tt.wantTiming)
+			}
+			if !ok {
+				return
+			}
+			if results := len(lines) - 1; timing.Results != results ||
+				timing.Matches < results {
+				t.Errorf("timing %+v for %d results", timing, results)
+			}
+			if timing.Visit <= 0 {
+				t.Errorf("timing %+v, want the time spent visiting the index", timing)
+			}
+		})
+	}
+}
+
+func TestQueryIndex_Status(t *testing.T) {
+	db := newSyntheticIndexer(2000)
+
+	status := []string{request.FeatureStatus}
+	tests := []struct {
+		name       string
+		query      string
+		version    int
+		features   []string
+		settings   request.Settings
+		wantStatus *request.Status
+	}{
+		{"unversioned", "s", 0, status, request.Settings{Action: request.PrefixSearch, MaxResults: 5}, nil},
+		{"not_wanted", "s", 1, nil, request.Settings{Action: request.PrefixSearch, MaxResults: 5}, nil},
+		{"no_matches", "zzzz", 1, status, request.Settings{Action: request.PrefixSearch},
+			&request.Status{}},
+		{"truncated", "s", 1, status, request.Settings{Action: request.PrefixSearch, MaxResults: 5},
+			&request.Status{Results: 5, Truncated: true}},
+		{"truncated_by_mtime", "s", 1, status, request.Settings{Action: request.PrefixSearch,
+			SortBy: request.SortMtime, MaxResults: 5}, &request.Status{Results: 5, Truncated: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := request.Request{
+				Version:         tt.version,
+				Features:        tt.features,
+				Query:           tt.query,
+				Settings:        tt.settings,
+				ResponseChannel: make(chan string),
+				Done:            make(chan struct{}),
+			}
+			go db.queryIndex(req)
+
+			var lines []string
+			for line := range req.ResponseChannel {
+				lines = append(lines, line)
+			}
+			var last string
+			if len(lines) > 0 {
+				last = lines[len(lines)-1]
+			}
+
+			got, ok := request.ParseStatus(last)
+			if tt.wantStatus == nil {
+				if ok {
+					t.Errorf("got status %+v, want none", got)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("last line %q, want a status", last)
+			}
+			if got.Results != tt.wantStatus.Results || got.Truncated != tt.wantStatus.Truncated ||
+				got.Results != len(lines)-1 || got.Matches < got.Results {
+				t.Errorf("status %+v for %d results, want %+v", got, len(lines)-1, *tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestQueryIndex_Rejected(t *testing.T) {
+	db := newSyntheticIndexer(500)
+	db.minQueryLength = 3
+
+	tests := []struct {
+		name         string
+		query        string
+		settings     request.Settings
+		wantRejected bool
+	}{
+		{"empty", "", request.Settings{Action: request.PrefixSearch}, true},
+		{"empty_list_all", "", request.Settings{Action: request.PrefixSearch, ListAll: true}, false},
+		{"empty_path_list_all", "", request.Settings{Action: request.PathSearch, ListAll: true}, false},
+		{"short", "sr", request.Settings{Action: request.SubStringSearch}, true},
+		{"short_fuzzy", "sr", request.Settings{Action: request.FuzzySearch}, true},
+		{"short_segments", "s/r", request.Settings{Action: request.SegmentSearch}, false},
+		{"short_unsorted", "sr", request.Settings{Action: request.SubStringSearch, NoSort: true}, true},
+		{"short_unsorted_limited", "sr", request.Settings{Action: request.FuzzySearch,
+			NoSort: true, MaxResults: 10}, false},
+		{"short_prefix", "s", request.Settings{Action: request.PrefixSearch}, false},
+		// characters, not bytes, are counted
+		{"short_multibyte", "ée", request.Settings{Action: request.SubStringSearch}, true},
+		{"long_enough", "src", request.Settings{Action: request.SubStringSearch}, false},
+		{"changed_since", "", request.Settings{Action: request.ChangedSince, Since: 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := runRequest(db, request.Request{Version: 1, Query: tt.query, Settings: tt.settings})
+			rejected := false
+			if len(lines) == 1 {
+				var e request.ErrorResponse
+				e, rejected = request.ParseError(lines[0])
+				if rejected && e.Code != request.ErrQueryTooShort {
+					t.Errorf("got error %+v, want %s", e, request.ErrQueryTooShort)
+				}
+			}
+			if rejected != tt.wantRejected {
+				t.Errorf("got %d lines, want rejected %v", len(lines), tt.wantRejected)
+			}
+		})
+	}
+}
+
+func TestHandleRequest_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		settings request.Settings
+		wantCode string
+	}{
+		{"unknown_action", "src", request.Settings{Action: 99}, request.ErrUnknownAction},
+		{"health", "", request.Settings{Action: request.Health}, request.ErrUnknownAction},
+		{"invalid_settings", "src", request.Settings{Action: request.SubStringSearch,
+			MaxResults: -1}, request.ErrInvalidRequest},
+		{"duplicates_root", "", request.Settings{Action: request.Duplicates,
+			Root: "/r/missing"}, request.ErrNotIndexed},
+		{"changed_since_root", "", request.Settings{Action: request.ChangedSince,
+			Since: 1, Root: "/other"}, request.ErrNotIndexed},
+		{"refresh_relative", "r/src", request.Settings{Action: request.RefreshPath},
+			request.ErrInvalidRequest},
+		{"refresh_missing", "/r/missing", request.Settings{Action: request.RefreshPath},
+			request.ErrNotFound},
+		{"add_invalid_filter", "[", request.Settings{Action: request.AddFilter},
+			request.ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeIndexer(newFakeFS("/r/a.txt", "/r/src/main.go", "/other/b.txt"), Options{})
+			lines := runRequest(db, request.Request{Version: 1, Query: tt.query, Settings: tt.settings})
+			if len(lines) != 1 {
+				t.Fatalf("got %q, want a single error", lines)
+			}
+			if e, ok := request.ParseError(lines[0]); !ok || e.Code != tt.wantCode {
+				t.Errorf("got %q, want error %s", lines[0], tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRefreshPath_Missing(t *testing.T) {
+	fs := newFakeFS("/r/a.txt", "/r/src/main.go")
+	db := newFakeIndexer(fs, Options{})
+	fs.remove("/r/src")
+
+	lines := runRequest(db, request.Request{Query: "/r/src",
+		Settings: request.Settings{Action: request.RefreshPath}})
+	if want := []string{"error: /r/src doesn't exist"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("got %q, want %q", lines, want)
+	}
+	// the vanished directory is removed nonetheless
+	if got, want := indexedPaths(t, db), []string{"/r/", "/r/a.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("indexed %q, want %q", got, want)
+	}
+}
+
+func TestListFilters(t *testing.T) {
+	addFilter(t, "node_modules")
+	db := newFakeIndexer(newFakeFS("/r/a.txt"), Options{})
+
+	lines := runRequest(db, request.Request{Settings: request.Settings{Action: request.ListFilters}})
+	// the user's globs come first, the defaults are marked
+	// with the version of the set
+	want := []string{"glob\tnode_modules"}
+	for _, filter := range config.EffectiveFilters() {
+		if filter.Default {
+			want = append(want, fmt.Sprintf("glob\t%s\t(default v%d)",
+				filter.Pattern, config.DefaultFiltersVersion))
+		}
+	}
+	if len(want) == 1 {
+		t.Fatal("no default filters are effective")
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("got %q, want %q", lines, want)
+	}
+}
+
+func TestQueryIndex_UnreadableWarning(t *testing.T) {
+	db := New(Options{})
+	root := t.TempDir()
+	path := filepath.Join(root, "a.txt")
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	db.addEntry(path, "a.txt", false)
+	// was a directory when it was indexed, stat'ing below it fails
+	// with ENOTDIR instead of ENOENT
+	db.addEntry(filepath.Join(path, "b.txt"), "b.txt", false)
+
+	tests := []struct {
+		name     string
+		features []string
+		want     []string
+	}{
+		{"warnings", []string{request.FeatureWarnings},
+			[]string{root + "/a.txt", request.Warning{Code: request.WarnUnreadable,
+				Message: "couldn't stat 1 entries"}.Line()}},
+		{"no_warnings", nil, []string{root + "/a.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := runRequest(db, request.Request{Version: 1, Features: tt.features,
+				Settings: request.Settings{Action: request.ChangedSince, Since: 1}})
+			if !reflect.DeepEqual(lines, tt.want) {
+				t.Errorf("got %q, want %q", lines, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryIndex_SegmentSearch(t *testing.T) {
+	db := New(Options{})
+	for _, path := range []string{
+		"/home/user/src/myproject/main.go",
+		"/home/user/src/other/main.go",
+		"/home/user/projects/tool/cmd/main.go",
+		"/home/user/Documents/main.txt",
+	} {
+		db.addEntry(path, filepath.Base(path), false)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			"name_only",
+			"main.go",
+			[]string{
+				"/home/user/projects/tool/cmd/main.go",
+				"/home/user/src/myproject/main.go",
+				"/home/user/src/other/main.go",
+			},
+		},
+		{
+			"parent",
+			"proj/main",
+			// the best match comes last
+			[]string{
+				"/home/user/projects/tool/cmd/main.go",
+				"/home/user/src/myproject/main.go",
+			},
+		},
+		{
+			"parents_in_order",
+			"src/proj/main",
+			[]string{"/home/user/src/myproject/main.go"},
+		},
+		{
+			"empty_segments",
+			"/Docs//main",
+			[]string{"/home/user/Documents/main.txt"},
+		},
+		{"no_parent_matches", "lib/main", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runQuery(db, request.SegmentSearch, tt.query, 0)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("results %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	db := New(Options{})
+	for _, entry := range []struct {
+		path  string
+		isDir bool
+	}{
+		{"/home/user/Downloads/report.pdf", false},
+		{"/home/user/Downloads/report(1).pdf", false},
+		{"/home/user/Documents/report.pdf", false},
+		{"/home/user/backup/report.pdf", false},
+		{"/home/user/Documents/notes.txt", false},
+		{"/home/user/backup/notes.txt", false},
+		{"/home/user/src/README.md", false},
+		{"/home/user/backup/src/README.md", false},
+		{"/home/user/backup/src", true},
+		{"/home/user/src", true},
+		{"/etc/notes.txt", false},
+	} {
+		db.addEntry(entry.path, filepath.Base(entry.path), entry.isDir)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		settings request.Settings
+		want     []string
+	}{
+		{
+			"most_common_first",
+			"",
+			request.Settings{},
+			[]string{
+				"notes.txt", "/etc/notes.txt", "/home/user/Documents/notes.txt", "/home/user/backup/notes.txt",
+				"report.pdf", "/home/user/Documents/report.pdf", "/home/user/Downloads/report.pdf", "/home/user/backup/report.pdf",
+				"README.md", "/home/user/backup/src/README.md", "/home/user/src/README.md",
+				"src", "/home/user/backup/src", "/home/user/src",
+			},
+		},
+		{
+			"min_count",
+			"",
+			request.Settings{MinCount: 3, ReverseSort: true},
+			[]string{
+				"report.pdf", "/home/user/Documents/report.pdf", "/home/user/Downloads/report.pdf", "/home/user/backup/report.pdf",
+				"notes.txt", "/etc/notes.txt", "/home/user/Documents/notes.txt", "/home/user/backup/notes.txt",
+			},
+		},
+		{
+			"pattern",
+			"*.PDF",
+			request.Settings{CaseInsensitive: true},
+			[]string{"report.pdf", "/home/user/Documents/report.pdf", "/home/user/Downloads/report.pdf", "/home/user/backup/report.pdf"},
+		},
+		{
+			"root",
+			"",
+			request.Settings{Root: "/home/user/", TypeFilter: request.TypeFile, MaxResults: 2},
+			[]string{
+				"report.pdf", "/home/user/Documents/report.pdf", "/home/user/Downloads/report.pdf", "/home/user/backup/report.pdf",
+				"README.md", "/home/user/backup/src/README.md", "/home/user/src/README.md",
+			},
+		},
+		{"none", "*.go", request.Settings{}, nil},
+		{
+			"invalid_pattern",
+			"[",
+			request.Settings{},
+			[]string{request.ErrorResponse{Code: request.ErrInvalidRequest, Message: "invalid pattern ["}.Line(1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.settings.Action = request.Duplicates
+			req := request.Request{
+				Version:         1,
+				Query:           tt.query,
+				Settings:        tt.settings,
+				ResponseChannel: make(chan string),
+				Done:            make(chan struct{}),
+			}
+			go db.handleRequest(req)
+
+			var got []string
+			for line := range req.ResponseChannel {
+				got = append(got, line)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryIndex_ChangedSince(t *testing.T) {
+	db := New(Options{})
+	root := t.TempDir()
+	now := time.Now()
+	entries := []struct {
+		path  string
+		isDir bool
+		age   time.Duration
+	}{
+		{"old.txt", false, 48 * time.Hour},
+		{"recent.txt", false, time.Hour},
+		{"newest.txt", false, time.Minute},
+		{"dir", true, 2 * time.Hour},
+		{"dir/inside.txt", false, 3 * time.Hour},
+	}
+	for _, entry := range entries {
+		path := filepath.Join(root, entry.path)
+		var err error
+		if entry.isDir {
+			err = os.Mkdir(path, 0755)
+		} else {
+			err = ioutil.WriteFile(path, nil, 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.addEntry(path, filepath.Base(path), entry.isDir)
+	}
+	// creating the entries changed the directory
+	for _, entry := range entries {
+		path := filepath.Join(root, entry.path)
+		if err := os.Chtimes(path, now, now.Add(-entry.age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.addEntry(filepath.Join(root, "vanished.txt"), "vanished.txt", false)
+
+	tests := []struct {
+		name     string
+		settings request.Settings
+		want     []string
+	}{
+		{"day", request.Settings{Since: now.Add(-24 * time.Hour).Unix()},
+			[]string{"dir/inside.txt", "dir", "recent.txt", "newest.txt"}},
+		{"files", request.Settings{Since: now.Add(-24 * time.Hour).Unix(), TypeFilter: request.TypeFile},
+			[]string{"dir/inside.txt", "recent.txt", "newest.txt"}},
+		{"root", request.Settings{Since: now.Add(-24 * time.Hour).Unix(), Root: filepath.Join(root, "dir")},
+			[]string{"dir/inside.txt"}},
+		{"limited", request.Settings{Since: now.Add(-24 * time.Hour).Unix(), MaxResults: 2},
+			[]string{"recent.txt", "newest.txt"}},
+		{"recent_first", request.Settings{Since: now.Add(-90 * time.Minute).Unix(), ReverseSort: true},
+			[]string{"newest.txt", "recent.txt"}},
+		{"nothing", request.Settings{Since: now.Add(time.Hour).Unix()}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.settings.Action = request.ChangedSince
+			req := request.Request{
+				Settings:        tt.settings,
+				ResponseChannel: make(chan string),
+				Done:            make(chan struct{}),
+			}
+			go db.handleRequest(req)
+
+			var got []string
+			for line := range req.ResponseChannel {
+				got = append(got, strings.TrimPrefix(line, root+"/"))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestQueryIndex_RepeatedMatches checks that names containing the
+// query more than once, or overlapping with itself, are sent once
+func TestQueryIndex_RepeatedMatches(t *testing.T) {
+	db := New(Options{})
+	for _, path := range []string{
+		"/t/testtesttest",
+		"/t/tetestest",
+		"/t/aaaa",
+		"/t/testtesttest.d/testtest",
+	} {
+		db.addEntry(path, filepath.Base(path), false)
+	}
+
+	tests := []struct {
+		name   string
+		action int
+		query  string
+		want   int
+	}{
+		// the trigram index answers queries of 3 characters and
+		// more, shorter ones are matched against every name
+		{"substring", request.SubStringSearch, "test", 3},
+		{"overlapping", request.SubStringSearch, "testest", 1},
+		{"short", request.SubStringSearch, "aa", 1},
+		{"case_insensitive", request.SubStringSearch, "TEST", 3},
+		{"prefix", request.PrefixSearch, "test", 2},
+		{"fuzzy", request.FuzzySearch, "tt", 3},
+		{"path", request.PathSearch, "testtest", 3},
+		{"segment", request.SegmentSearch, "test/test", 1},
+	}
+	for _, tt := range tests {
+		for _, noSort := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/no_sort=%v", tt.name, noSort), func(t *testing.T) {
+				got := runRequest(db, request.Request{Query: tt.query,
+					Settings: request.Settings{Action: tt.action, NoSort: noSort,
+						CaseInsensitive: tt.name == "case_insensitive"}})
+				seen := make(map[string]bool)
+				for _, path := range got {
+					if seen[path] {
+						t.Errorf("%s is sent more than once in %q", path, got)
+					}
+					seen[path] = true
+				}
+				if len(got) != tt.want {
+					t.Errorf("results %q, want %d", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestUniqueResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		results resulter
+		want    resulter
+	}{
+		{"by_length", byLength{"/a/b", "/a", "/a/b", "/c"}, byLength{"/a/b", "/a", "/c"}},
+		{"by_skipped", bySkipped{{"/a", 1}, {"/b", 0}, {"/a", 1}}, bySkipped{{"/a", 1}, {"/b", 0}}},
+		{"unique", byLength{"/a", "/b"}, byLength{"/a", "/b"}},
+	}
+	for _, tt := range tests {
+		if got := uniqueResults(tt.results); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWithMtimes(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+	var results byLength
+	for i, name := range []string{"old", "newest", "older", "recent"} {
+		path := filepath.Join(root, name)
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		age := []time.Duration{3 * time.Hour, time.Minute, 4 * time.Hour, time.Hour}[i]
+		if err := os.Chtimes(path, now, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, path)
+	}
+	results = append(results, filepath.Join(root, "vanished"))
+
+	cancelled := make(chan struct{})
+	close(cancelled)
+	tests := []struct {
+		name string
+		keep int
+		done chan struct{}
+		want []string
+	}{
+		{"all", 0, nil, []string{"newest", "recent", "old", "older", "vanished"}},
+		{"most_recent", 2, nil, []string{"newest", "recent"}},
+		{"more_than_found", 10, nil, []string{"newest", "recent", "old", "older", "vanished"}},
+		{"cancelled", 2, cancelled, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recent, unreadable := withMtimes(results, tt.keep, request.Request{Done: tt.done})
+			sort.Sort(recent)
+			var got []string
+			for _, r := range recent {
+				got = append(got, filepath.Base(r.result))
+			}
+			if !reflect.DeepEqual(got, tt.want) || unreadable != 0 {
+				t.Errorf("got %q with %d unreadable, want %q", got, unreadable, tt.want)
+			}
+		})
+	}
+}
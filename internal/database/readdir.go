@@ -0,0 +1,66 @@
+//go:build linux
+
+package database
+
+import (
+	"bytes"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// direntNameOffset is where the name starts in a linux_dirent64
+const direntNameOffset = int(unsafe.Offsetof(unix.Dirent{}.Name))
+
+// readEntries appends the entries of the directory at path to entries,
+// using buf for reading. Unlike godirwalk.ReadDirents it allocates
+// nothing but the names, the initial index reads every directory.
+func readEntries(path string, buf []byte, entries []dirEntry) ([]dirEntry, error) {
+	var fd int
+	err := shortPath(path, func(short string) (err error) {
+		fd, err = unix.Open(short, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		return err
+	})
+	if _, ok := err.(*os.PathError); ok {
+		return entries, err
+	} else if err != nil {
+		return entries, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer unix.Close(fd)
+
+	for {
+		n, err := unix.Getdents(fd, buf)
+		if err == unix.EINTR {
+			continue
+		} else if err != nil {
+			return entries, &os.PathError{Op: "getdents", Path: path, Err: err}
+		}
+		if n <= 0 {
+			return entries, nil
+		}
+
+		for offset := 0; offset < n; {
+			dirent := (*unix.Dirent)(unsafe.Pointer(&buf[offset]))
+			name := buf[offset+direntNameOffset : offset+int(dirent.Reclen)]
+			offset += int(dirent.Reclen)
+			if i := bytes.IndexByte(name, 0); i >= 0 {
+				name = name[:i]
+			}
+			if string(name) == "." || string(name) == ".." {
+				continue
+			}
+
+			entry := dirEntry{name: string(name), isDir: dirent.Type == unix.DT_DIR}
+			if dirent.Type == unix.DT_UNKNOWN {
+				// some filesystems don't report the type
+				var st unix.Stat_t
+				if err := unix.Fstatat(fd, entry.name, &st, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+					continue
+				}
+				entry.isDir = st.Mode&unix.S_IFMT == unix.S_IFDIR
+			}
+			entries = append(entries, entry)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package database
+
+import "os"
+
+// readEntries appends the entries of the directory at path to entries,
+// buf is only used by the getdents version of linux
+func readEntries(path string, buf []byte, entries []dirEntry) ([]dirEntry, error) {
+	dirents, err := os.ReadDir(path)
+	if err != nil {
+		return entries, err
+	}
+	for _, dirent := range dirents {
+		entries = append(entries, dirEntry{name: dirent.Name(), isDir: dirent.IsDir()})
+	}
+	return entries, nil
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// recentQueryCount is the number of completed queries
+// kept for the statistics
+const recentQueryCount = 20
+
+// recentQueries holds the last completed queries, queries running
+// on snapshots add to it concurrently
+type recentQueries struct {
+	sync.Mutex
+	records []request.QueryRecord
+	// next is the index of the oldest record once records is full
+	next int
+}
+
+// add records a completed query, replacing the oldest one
+func (r *recentQueries) add(record request.QueryRecord) {
+	r.Lock()
+	defer r.Unlock()
+	if len(r.records) < recentQueryCount {
+		r.records = append(r.records, record)
+		return
+	}
+	r.records[r.next] = record
+	r.next = (r.next + 1) % recentQueryCount
+}
+
+// list returns the recorded queries, the oldest first
+func (r *recentQueries) list() []request.QueryRecord {
+	r.Lock()
+	defer r.Unlock()
+	list := make([]request.QueryRecord, 0, len(r.records))
+	list = append(list, r.records[r.next:]...)
+	return append(list, r.records[:r.next]...)
+}
+
+// recordQuery adds a completed query to the recent ones
+func (db *Indexer) recordQuery(req request.Request, duration time.Duration, results int) {
+	db.recentQueries.add(request.QueryRecord{
+		RequestID: req.RequestID,
+		Query:     req.Query,
+		Action:    actionLabel(req.Settings.Action),
+		Duration:  duration.Seconds(),
+		Results:   results,
+	})
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestRecentQueries(t *testing.T) {
+	tests := []struct {
+		name  string
+		added int
+		want  []string
+	}{
+		{"empty", 0, []string{}},
+		{"partial", 3, []string{"0", "1", "2"}},
+		{"full", recentQueryCount, nil},
+		// the oldest are replaced
+		{"wrapped", recentQueryCount + 5, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.want
+			if want == nil {
+				for i := tt.added - recentQueryCount; i < tt.added; i++ {
+					want = append(want, strconv.Itoa(i))
+				}
+			}
+
+			var recent recentQueries
+			for i := 0; i < tt.added; i++ {
+				recent.add(request.QueryRecord{RequestID: strconv.Itoa(i)})
+			}
+			got := []string{}
+			for _, record := range recent.list() {
+				got = append(got, record.RequestID)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestQueryIndex_RequestID(t *testing.T) {
+	db := newSyntheticIndexer(500)
+	lines := runRequest(db, request.Request{
+		Version:   1,
+		Features:  []string{request.FeatureStatus},
+		RequestID: "build-42",
+		Query:     "src",
+		Settings:  request.Settings{Action: request.PrefixSearch, MaxResults: 3},
+	})
+	runRequest(db, request.Request{RequestID: "dup-1", Query: "*.go",
+		Settings: request.Settings{Action: request.Duplicates}})
+
+	status, ok := request.ParseStatus(lines[len(lines)-1])
+	if !ok || status.RequestID != "build-42" {
+		t.Errorf("last line %q, want a status with the request ID", lines[len(lines)-1])
+	}
+
+	recent := db.currentStats().RecentQueries
+	if len(recent) != 2 {
+		t.Fatalf("got %d recent queries, want 2", len(recent))
+	}
+	if got := recent[0]; got.RequestID != "build-42" || got.Query != "src" ||
+		got.Action != "prefix" || got.Results != status.Results {
+		t.Errorf("got %+v for the search", got)
+	}
+	if got := recent[1]; got.RequestID != "dup-1" || got.Action != "duplicates" {
+		t.Errorf("got %+v for the duplicates", got)
+	}
+}
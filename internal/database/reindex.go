@@ -0,0 +1,133 @@
+package database
+
+import (
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/mounts"
+	"github.com/ozeidan/gosearch/internal/request"
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+// reindex rebuilds the whole index. The searches received meanwhile
+// are answered from the old index until the new one replaces it, or,
+// if the memory budget doesn't leave room for both, between rebuilding
+// the entries of the root one at a time. The other requests are
+// handled once the index is rebuilt.
+func (db *Indexer) reindex(req request.Request) {
+	select {
+	case req.ResponseChannel <- "reindexing":
+	case <-req.Done:
+	}
+	close(req.ResponseChannel)
+
+	db.rebuilding = true
+	db.partial.requests = db.requests
+	if db.snapshots.enabled || db.fitsAside() {
+		db.rebuildAside()
+	} else {
+		db.rebuildInPlace()
+	}
+	db.rebuilding = false
+	// the held requests see the new index
+	db.publish()
+	db.answerHeld()
+}
+
+// fitsAside returns whether a new index can be built next to the old
+// one without the heap outgrowing the memory budget
+func (db *Indexer) fitsAside() bool {
+	if db.memoryBudget == 0 {
+		return true
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	size := db.estimate().Bytes
+	if m.HeapAlloc+size <= db.memoryBudget {
+		return true
+	}
+	slog.Info("no room for a copy of the index within the memory budget, rebuilding it in place",
+		"heap_mb", m.HeapAlloc>>20, "index_mb", size>>20, "budget_mb", db.memoryBudget>>20)
+	return false
+}
+
+// estimate counts the searchable entries of the index
+func (db *Indexer) estimate() Estimate {
+	e := Estimate{Path: db.root}
+	db.trie.Visit(func(prefix trie.Prefix, item trie.Item) error {
+		entriesOf(item).forEach(func(file indexedFile) bool {
+			e.count(string(prefix), file.isDir)
+			return true
+		})
+		return nil
+	})
+	return e
+}
+
+// rebuildAside builds a new index while the searches run on the old
+// one, which replaces it once it is complete. With snapshots the
+// searches run on the published copy anyway.
+func (db *Indexer) rebuildAside() {
+	if !db.snapshots.enabled {
+		db.serving = db.currentIndex()
+		defer func() { db.serving = nil }()
+	}
+	db.initialIndex()
+}
+
+// rebuildInPlace rebuilds the index one entry of the root at a time,
+// removing it with everything below it and walking it again. Searches
+// are only answered in between, so they find the entries below each
+// either as they were or rebuilt, never a part of both.
+func (db *Indexer) rebuildInPlace() {
+	entries, err := db.fs.ReadDirents(db.root)
+	if err != nil {
+		slog.Warn("couldn't read the indexed directory", "path", db.root, "err", err)
+		db.initialIndex()
+		return
+	}
+	db.failures = make(map[string]*failure)
+	db.aliases.reset()
+	db.directoryIDs = make(map[fileID]string)
+
+	slog.Info("starting to rebuild the index in place")
+
+	config.ResetFilterCounts()
+	start := time.Now()
+	table := mounts.All()
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		present[entry.name] = true
+	}
+	children, _ := db.tree.GetChildren(db.root)
+	for _, name := range children {
+		if !present[name] {
+			db.removeEntry(db.root, name)
+		}
+	}
+	if present[config.IgnoreFileName] {
+		loadIgnoreFile(db.root)
+	} else {
+		config.UnloadIgnoreFiles(db.root, false)
+	}
+
+	// the root itself is kept
+	files, directories := uint64(0), uint64(1)
+	for _, entry := range entries {
+		path := filepath.Join(db.root, entry.name)
+		if _, err := db.tree.Lookup(path); err == nil {
+			db.removeEntry(db.root, entry.name)
+		}
+		f, d := db.addToIndexRecursively(path)
+		files, directories = files+f, directories+d
+		db.pollRequests()
+	}
+	db.indexed(files, directories, start, table)
+	slog.Info("finished rebuilding the index in place", "files", files,
+		"directories", directories, "duration", time.Since(start))
+	db.buildCold()
+	db.PrintMemUsage()
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestReindex(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget uint64
+		// during are the results of a search received during the
+		// reindex, after /r/a was walked again
+		during []string
+	}{
+		{"aside", 0, []string{"/r/a/notes.txt", "/r/bb/notes"}},
+		// no room for a copy, /r/a is rebuilt but /r/bb isn't yet
+		{"in_place", 1, []string{"/r/bb/notes"}},
+	}
+	for _, tt := range tests {
+		fs := newFakeFS("/r/a/notes.txt", "/r/bb/notes", "/r/c/")
+		db := newFakeIndexer(fs, Options{MemoryBudget: tt.budget,
+			Deleted: DeletedOptions{MaxEntries: 10}})
+		fs.remove("/r/a/notes.txt")
+		fs.add("/r/bb/notes.md")
+
+		requests := make(chan request.Request, 1)
+		db.requests = requests
+		search := request.Request{Query: "notes",
+			ResponseChannel: make(chan string), Done: make(chan struct{})}
+		during := make(chan []string, 1)
+		go func() {
+			var got []string
+			for line := range search.ResponseChannel {
+				got = append(got, line)
+			}
+			during <- got
+		}()
+		requests <- search
+		db.handleRequest(request.Request{Settings: request.Settings{Action: request.IndexRefresh},
+			ResponseChannel: make(chan string, 1), Done: make(chan struct{})})
+
+		if got := <-during; !reflect.DeepEqual(got, tt.during) {
+			t.Errorf("%s: during the reindex got %q, want %q", tt.name, got, tt.during)
+		}
+		want := []string{"/r/bb/notes.md", "/r/bb/notes"}
+		if got := runRequest(db, request.Request{Query: "notes"}); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: after the reindex got %q, want %q", tt.name, got, want)
+		}
+		if got, want := indexedPaths(t, db), []string{"/r/", "/r/a/", "/r/bb/", "/r/bb/notes",
+			"/r/bb/notes.md", "/r/c/"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: indexed %q, want %q", tt.name, got, want)
+		}
+		if db.serving != nil || db.partial.requests != nil || len(db.deleted.entries) != 0 {
+			t.Errorf("%s: the reindex left its state behind", tt.name)
+		}
+	}
+}
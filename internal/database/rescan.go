@@ -0,0 +1,87 @@
+package database
+
+import "time"
+
+// rescanSlice is how long the goroutine of Start reads directories of
+// the rescan queue before it turns to the changes and requests again
+const rescanSlice = 20 * time.Millisecond
+
+// rescanReady is closed, it is selected on while rescans are pending
+var rescanReady = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// rescan is a directory to read again. refresh applies what changed
+// in the directory itself, descend what changed in the directories
+// below it.
+type rescan struct {
+	path    string
+	refresh bool
+	descend bool
+}
+
+// rescanQueue holds the directories to read again which can be too
+// many to read at once, like all of them for a removed filter. The
+// goroutine of Start works through them between the changes and the
+// requests. Only it uses the queue.
+type rescanQueue struct {
+	// pending is used as a stack, so the directories below one are
+	// read before its siblings like the recursive walks do
+	pending []rescan
+	// done are called once the queue is empty
+	done []func()
+}
+
+// queueRescan adds r to the rescan queue
+func (db *Indexer) queueRescan(r rescan) {
+	db.rescans.pending = append(db.rescans.pending, r)
+}
+
+// afterRescans makes the goroutine of Start call f once the rescan
+// queue is worked through
+func (db *Indexer) afterRescans(f func()) {
+	db.rescans.done = append(db.rescans.done, f)
+}
+
+// rescanSignal returns a ready channel while the rescan queue
+// is worked through, nil otherwise
+func (db *Indexer) rescanSignal() <-chan struct{} {
+	if len(db.rescans.pending) == 0 || db.paused {
+		return nil
+	}
+	return rescanReady
+}
+
+// rescanSome reads the directories of the rescan queue until it is
+// empty or rescanSlice passed, the functions waiting for it to be
+// empty are called then
+func (db *Indexer) rescanSome() {
+	start := time.Now()
+	for len(db.rescans.pending) > 0 && time.Since(start) < rescanSlice {
+		last := len(db.rescans.pending) - 1
+		r := db.rescans.pending[last]
+		db.rescans.pending = db.rescans.pending[:last]
+
+		if r.refresh {
+			db.refreshDirectory(r.path)
+		}
+		if !r.descend {
+			continue
+		}
+		subdirectories := db.subdirectories(r.path)
+		for i := len(subdirectories) - 1; i >= 0; i-- {
+			db.queueRescan(rescan{path: subdirectories[i], refresh: true, descend: true})
+		}
+	}
+	if len(db.rescans.pending) > 0 {
+		return
+	}
+
+	done := db.rescans.done
+	db.rescans.done = nil
+	for _, f := range done {
+		f()
+	}
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// finishRescans works through the rescan queue like the
+// goroutine of Start does
+func finishRescans(db *Indexer) {
+	for len(db.rescans.pending) > 0 {
+		db.rescanSome()
+	}
+}
+
+func TestChangeFilter_RemoveQueuesRescan(t *testing.T) {
+	addFilter(t, "cache")
+	fs := newFakeFS("/r/a/kept.txt", "/r/a/cache/x.txt", "/r/b/c/cache/y.txt")
+	db := newFakeIndexer(fs, Options{})
+	before := []string{"/r/", "/r/a/", "/r/a/kept.txt", "/r/b/", "/r/b/c/"}
+	if got := indexedPaths(t, db); !reflect.DeepEqual(got, before) {
+		t.Fatalf("indexed %q, want %q", got, before)
+	}
+
+	// the unanchored filter can match anywhere, the request doesn't
+	// wait for every directory to be read again
+	lines := runRequest(db, request.Request{Query: "cache",
+		Settings: request.Settings{Action: request.RemoveFilter}})
+	if !reflect.DeepEqual(lines, []string{"removed glob filter cache"}) {
+		t.Fatalf("got %q", lines)
+	}
+	if len(db.rescans.pending) == 0 {
+		t.Fatal("no rescans are queued")
+	}
+	if got := indexedPaths(t, db); !reflect.DeepEqual(got, before) {
+		t.Errorf("before the rescans: indexed %q, want %q", got, before)
+	}
+
+	finishRescans(db)
+	want := []string{"/r/", "/r/a/", "/r/a/cache/", "/r/a/cache/x.txt", "/r/a/kept.txt",
+		"/r/b/", "/r/b/c/", "/r/b/c/cache/", "/r/b/c/cache/y.txt"}
+	if got := indexedPaths(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("after the rescans: indexed %q, want %q", got, want)
+	}
+}
+
+func TestRescanSome_Paused(t *testing.T) {
+	db := newFakeIndexer(newFakeFS("/r/a.txt"), Options{})
+	db.queueRescan(rescan{path: "/r", refresh: true, descend: true})
+	if db.rescanSignal() == nil {
+		t.Error("pending rescans aren't signaled")
+	}
+
+	// rescans wait for the resume like the changes do
+	db.paused = true
+	if db.rescanSignal() != nil {
+		t.Error("rescans are signaled while paused")
+	}
+	db.paused = false
+	finishRescans(db)
+	if db.rescanSignal() != nil {
+		t.Error("rescans are signaled after the queue was worked through")
+	}
+}
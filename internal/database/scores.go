@@ -0,0 +1,34 @@
+package database
+
+import (
+	"path/filepath"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// scoresOf returns the request.FuzzyScore of the results of a fuzzy
+// search by path, before later steps drop what they skipped
+func scoresOf(results resulter) map[string]float64 {
+	r, ok := results.(bySkipped)
+	if !ok {
+		return nil
+	}
+	scores := make(map[string]float64, len(r))
+	for _, s := range r {
+		scores[s.result] = request.FuzzyScore(s.skipped, len(filepath.Base(s.result)))
+	}
+	return scores
+}
+
+// markScores marks the sorted results with their scores
+// as request.ScoreLine
+func markScores(results resulter, scores map[string]float64) resulter {
+	marked := make(sortedResults, results.Len())
+	for i := range marked {
+		marked[i] = results.Result(i)
+		if score, ok := scores[marked[i]]; ok {
+			marked[i] = request.ScoreLine(marked[i], score)
+		}
+	}
+	return marked
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestQueryIndex_Scores(t *testing.T) {
+	db := newFakeIndexer(newFakeFS("/r/ntx", "/r/a/ntax", "/r/notes.txt"), Options{})
+	tests := []struct {
+		name     string
+		settings request.Settings
+		want     []string
+	}{
+		{"all", request.Settings{Action: request.FuzzySearch},
+			[]string{"/r/notes.txt", "/r/a/ntax", "/r/ntx"}},
+		{"min_score", request.Settings{Action: request.FuzzySearch, MinScore: 0.5},
+			[]string{"/r/a/ntax", "/r/ntx"}},
+		{"min_score_exact", request.Settings{Action: request.FuzzySearch, MinScore: 1},
+			[]string{"/r/ntx"}},
+		{"scores", request.Settings{Action: request.FuzzySearch, Scores: true},
+			[]string{"/r/notes.txt\tscore=0.444", "/r/a/ntax\tscore=0.750", "/r/ntx\tscore=1.000"}},
+		{"scores_limited", request.Settings{Action: request.FuzzySearch, Scores: true, MinScore: 0.5, MaxResults: 1},
+			[]string{"/r/ntx\tscore=1.000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runRequest(db, request.Request{Query: "ntx", Settings: tt.settings})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryIndex_ScoreVersion(t *testing.T) {
+	db := newFakeIndexer(newFakeFS("/r/ntx"), Options{})
+	for _, settings := range []request.Settings{
+		{Action: request.FuzzySearch},
+		{Action: request.FuzzySearch, Scores: true},
+	} {
+		lines := runRequest(db, request.Request{Version: 1, Query: "ntx",
+			Features: []string{request.FeatureStatus}, Settings: settings})
+		var status request.Status
+		for _, line := range lines {
+			if s, ok := request.ParseStatus(line); ok {
+				status = s
+			}
+		}
+		want := 0
+		if settings.Scores {
+			want = request.ScoreVersion
+		}
+		if status.ScoreVersion != want {
+			t.Errorf("scores=%v: score version %d, want %d", settings.Scores, status.ScoreVersion, want)
+		}
+	}
+}
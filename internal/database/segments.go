@@ -0,0 +1,52 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+// segmentSearch fuzzy matches the last segment of the query against
+// the names in the trie, like FuzzySearch, and the segments before it
+// against the parent directories of the matches. Matches whose parents
+// don't match are dropped, the others are scored by the characters
+// skipped in all segments.
+func (ix *index) segmentSearch(req request.Request, filter *entryFilter) bySkipped {
+	results := bySkipped{}
+	segments := splitSegments(req.Query)
+	if len(segments) == 0 {
+		return results
+	}
+	name, parents := segments[len(segments)-1], segments[:len(segments)-1]
+
+	ix.trie.VisitFuzzy(trie.Prefix(name), req.Settings.CaseInsensitive,
+		func(prefix trie.Prefix, item trie.Item, skipped int) error {
+			if isCancelled(req) {
+				return errCancelled
+			}
+			entriesOf(item).forEach(func(file indexedFile) bool {
+				parentsSkipped, ok := file.pathNode.MatchAncestors(parents,
+					req.Settings.CaseInsensitive)
+				if ok && filter.matches(file, skipped+parentsSkipped) {
+					results = append(results, sortResult{file.pathNode.GetPath(),
+						skipped + parentsSkipped})
+				}
+				return true
+			})
+			return nil
+		})
+
+	return results
+}
+
+// splitSegments splits query at slashes, dropping empty segments
+func splitSegments(query string) []string {
+	var segments []string
+	for _, segment := range strings.Split(query, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/mounts"
+	"github.com/ozeidan/gosearch/internal/watch"
+)
+
+// LogStats makes the goroutine of Start log the memory use, the size
+// of the index and the counters of the watcher. It returns false if
+// that is pending already, the request is dropped then.
+func (db *Indexer) LogStats() bool {
+	return signal(db.statsSignal)
+}
+
+// Reconcile makes the goroutine of Start read every indexed directory
+// again and apply what changed, which repairs the index after lost
+// events. The changes and requests are handled in between. It returns
+// false if a reconciliation is pending already, the request is dropped
+// then, like it is while one is in progress.
+func (db *Indexer) Reconcile() bool {
+	return signal(db.reconcileSignal)
+}
+
+// signal sends to a channel with a buffer of one,
+// unless it is full
+func signal(c chan<- struct{}) bool {
+	select {
+	case c <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// logStats logs what PrintMemUsage does and the counters
+// of the watcher
+func (db *Indexer) logStats() {
+	var args []interface{}
+	for _, stat := range db.memUsage() {
+		args = append(args, stat.name, stat.value)
+	}
+	args = append(args, "trigram_names", len(db.trigrams.ids),
+		"trigrams", len(db.trigrams.postings))
+
+	received, dropped := watch.EventCounts()
+	args = append(args, "watcher", watch.Backend(),
+		"events_created", received["create"], "events_deleted", received["delete"],
+		"events_other", received["other"], "events_dropped", dropped,
+		"events_processed", db.eventsProcessed, "backlog", len(db.changes),
+		"paused", db.paused, "paused_events", db.pausedEvents,
+		"rescans", len(db.rescans.pending))
+	slog.Info("statistics", args...)
+}
+
+// reconcile compares every directory below the root with the index.
+// The directories are read through the rescan queue, the reconciliation
+// finishes once it is worked through.
+func (db *Indexer) reconcile() {
+	if db.reconciling {
+		slog.Info("the index is being reconciled already")
+		return
+	}
+	slog.Info("reconciling the index", "root", db.root)
+	db.reconciling = true
+	start := time.Now()
+	table := mounts.All()
+	db.queueRescan(rescan{path: db.root, refresh: true, descend: true})
+	db.afterRescans(func() {
+		db.reconciling = false
+		db.buildCold()
+		db.lastReconcile = time.Now()
+		db.reconciliations.record(db.root, table, start)
+		slog.Info("reconciled the index", "duration", time.Since(start))
+	})
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/internal/watch"
+)
+
+func TestIndexer_Signals_Pending(t *testing.T) {
+	// nothing handles the signals of an Indexer that isn't started
+	db := New(Options{})
+	for _, send := range []struct {
+		name   string
+		signal func() bool
+	}{
+		{"stats", db.LogStats},
+		{"reconcile", db.Reconcile},
+	} {
+		if !send.signal() {
+			t.Errorf("the first %s signal was dropped", send.name)
+		}
+		if send.signal() {
+			t.Errorf("the second %s signal wasn't dropped", send.name)
+		}
+	}
+}
+
+func TestIndexer_Reconcile(t *testing.T) {
+	root := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "kept.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	db := New(Options{Root: root})
+	requests := make(chan request.Request)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		db.Run(make(chan watch.FileChange), requests)
+	}()
+	defer func() {
+		close(requests)
+		<-done
+	}()
+
+	// the index is built once the first request is answered,
+	// the files below are changed without telling the Indexer
+	ask(requests, request.Stats, "")
+	added := filepath.Join(root, "dir", "missed.txt")
+	if err := ioutil.WriteFile(added, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "kept.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	db.LogStats()
+	db.Reconcile()
+	want := []string{added}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := ask(requests, request.SubStringSearch, ".txt")
+		if reflect.DeepEqual(got, want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("found %q after reconciling, want %q", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIndexer_Reconcile_Incremental(t *testing.T) {
+	fs := newFakeFS("/r/a/kept.txt")
+	db := newFakeIndexer(fs, Options{})
+	fs.add("/r/a/b/missed.txt")
+
+	// the directories are only queued, the goroutine of Start
+	// handles changes and requests in between
+	db.reconcile()
+	db.reconcile()
+	if len(db.rescans.pending) != 1 || !db.reconciling {
+		t.Fatalf("%d rescans are queued, reconciling is %v", len(db.rescans.pending), db.reconciling)
+	}
+	if !db.lastReconcile.IsZero() {
+		t.Error("the reconciliation finished before the rescans")
+	}
+
+	finishRescans(db)
+	want := []string{"/r/", "/r/a/", "/r/a/b/", "/r/a/b/missed.txt", "/r/a/kept.txt"}
+	if got := indexedPaths(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("indexed %q, want %q", got, want)
+	}
+	if db.reconciling || db.lastReconcile.IsZero() {
+		t.Errorf("after the rescans reconciling is %v, last reconciliation at %v",
+			db.reconciling, db.lastReconcile)
+	}
+}
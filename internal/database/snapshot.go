@@ -0,0 +1,337 @@
+package database
+
+import (
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ozeidan/gosearch/pkg/tree"
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+// With snapshot_queries the index is kept twice. Queries run in their
+// own goroutines on the published copy and never wait for changes,
+// while the goroutine of Start applies changes to the other copy and
+// records them. Publishing swaps the copies. Before the next change,
+// the recorded changes are replayed on the copy published before,
+// once the queries that started on it are done. A rebuilt index is
+// cloned instead of replaying every entry.
+//
+// Without snapshot_queries, queries run on the goroutine of Start
+// and there is a single copy.
+
+// index is one copy of the index
+type index struct {
+	trie        *trie.Trie
+	tree        *tree.Node
+	trigrams    *trigramIndex
+	directories *directoryNames
+	tags        *tagIndex
+	// generation changes whenever the index does, results found in
+	// the copy are cached with it
+	generation uint64
+	// readers are the queries running on the copy
+	readers sync.WaitGroup
+}
+
+// changeKind is the kind of a recorded change
+type changeKind int
+
+const (
+	// an entry made searchable
+	changeAdd changeKind = iota
+	// a directory added to the tree only, it is walked but filtered
+	changeTraverse
+	// an entry removed with everything below it
+	changeRemove
+	// the tags of an entry read again
+	changeTags
+)
+
+// indexChange is a change of the index, recorded to be replayed
+// on the other copy
+type indexChange struct {
+	kind  changeKind
+	path  string
+	name  string
+	isDir bool
+	tags  []string
+}
+
+// snapshotState holds the copies of an Indexer with snapshot_queries
+type snapshotState struct {
+	sync.Mutex
+	enabled bool
+	// published is the copy new queries run on
+	published *index
+	// changingSince is when the first change missing from the
+	// published copy was made, zero if it is current
+	changingSince time.Time
+
+	// the fields below are only used by the goroutine of Start
+
+	// shared is set while the trie, tree and trigrams of the Indexer are the
+	// published copy, they have to be replaced before changing them
+	shared bool
+	// stale is the copy published before, it lacks the changes in log
+	stale *index
+	log   []indexChange
+	// rebuilt is set when the index was replaced since it was last
+	// published, the stale copy is cloned instead of replaying the log
+	rebuilt bool
+	// replaying is set while the log is replayed, so it isn't
+	// recorded again
+	replaying bool
+	// readerWait bounds the wait for the queries on the stale copy
+	readerWait time.Duration
+}
+
+// currentIndex returns the copy the goroutine of Start works on
+func (db *Indexer) currentIndex() *index {
+	return &index{trie: db.trie, tree: db.tree, trigrams: db.trigrams,
+		directories: db.directories, tags: db.tags, generation: db.generation.Load()}
+}
+
+// useIndex makes ix the copy the goroutine of Start works on
+func (db *Indexer) useIndex(ix *index) {
+	db.trie, db.tree, db.trigrams = ix.trie, ix.tree, ix.trigrams
+	db.directories, db.tags = ix.directories, ix.tags
+}
+
+// enableSnapshots publishes the index, queries can run
+// concurrently from now on
+func (db *Indexer) enableSnapshots() {
+	db.snapshots.Lock()
+	db.snapshots.enabled = true
+	db.snapshots.published = db.currentIndex()
+	db.snapshots.Unlock()
+	db.snapshots.shared = true
+	slog.Info("queries run on snapshots of the index")
+}
+
+// disableSnapshots drops the published copy, queries run
+// on the goroutine of Start again
+func (db *Indexer) disableSnapshots() {
+	db.snapshots.Lock()
+	db.snapshots.enabled = false
+	db.snapshots.published = nil
+	db.snapshots.changingSince = time.Time{}
+	db.snapshots.Unlock()
+	db.snapshots.shared = false
+	db.snapshots.stale = nil
+	db.snapshots.log = nil
+	db.snapshots.rebuilt = false
+}
+
+// snapshotsEnabled returns whether queries can run concurrently
+func (db *Indexer) snapshotsEnabled() bool {
+	db.snapshots.Lock()
+	defer db.snapshots.Unlock()
+	return db.snapshots.enabled
+}
+
+// acquireIndex returns the copy a query runs on and the time up to
+// which it has every change, it has to be released when the query
+// is done
+func (db *Indexer) acquireIndex() (*index, time.Time) {
+	db.snapshots.Lock()
+	defer db.snapshots.Unlock()
+	ix, asOf := db.snapshots.published, time.Now()
+	if db.serving != nil {
+		ix = db.serving
+	} else if !db.snapshots.enabled {
+		ix = db.currentIndex()
+	} else if !db.snapshots.changingSince.IsZero() {
+		asOf = db.snapshots.changingSince
+	}
+	ix.readers.Add(1)
+	return ix, asOf
+}
+
+// publishedGeneration returns the generation of the copy new
+// queries run on
+func (db *Indexer) publishedGeneration() uint64 {
+	db.snapshots.Lock()
+	defer db.snapshots.Unlock()
+	if db.snapshots.enabled {
+		return db.snapshots.published.generation
+	}
+	if db.serving != nil {
+		return db.serving.generation
+	}
+	return db.generation.Load()
+}
+
+func (ix *index) release() {
+	ix.readers.Done()
+}
+
+// recordIndexChange records a change made to the index, without
+// snapshots it only invalidates the cached results
+func (db *Indexer) recordIndexChange(change indexChange) {
+	db.generation.Add(1)
+	if !db.snapshots.enabled || db.snapshots.replaying || db.snapshots.rebuilt {
+		return
+	}
+	db.snapshots.log = append(db.snapshots.log, change)
+}
+
+// indexRebuilt records that the index was replaced by a new one
+func (db *Indexer) indexRebuilt() {
+	db.generation.Add(1)
+	if db.snapshots.enabled {
+		db.snapshots.rebuilt = true
+		db.snapshots.shared = false
+		db.snapshots.log = nil
+	}
+}
+
+// beginWrite makes sure the copy the goroutine of Start works on isn't
+// published, it has to be called before changing the index
+func (db *Indexer) beginWrite() {
+	if !db.snapshots.enabled {
+		return
+	}
+	db.snapshots.Lock()
+	if db.snapshots.changingSince.IsZero() {
+		db.snapshots.changingSince = time.Now()
+	}
+	db.snapshots.Unlock()
+	if !db.snapshots.shared {
+		return
+	}
+	defer func() { db.snapshots.shared = false }()
+
+	stale := db.snapshots.stale
+	db.snapshots.stale = nil
+	if stale == nil {
+		db.useIndex(cloneIndex(db.currentIndex()))
+		return
+	}
+
+	start := time.Now()
+	if !waitReaders(stale, db.snapshots.readerWait) {
+		// the queries keep the stale copy to themselves,
+		// it is dropped once they are done
+		slog.Debug("queries on the stale index are still running, copying the published one",
+			"waited", time.Since(start))
+		db.useIndex(cloneIndex(db.currentIndex()))
+		db.snapshots.log = nil
+		return
+	}
+	waited := time.Since(start)
+
+	db.useIndex(stale)
+	db.snapshots.replaying = true
+	for _, change := range db.snapshots.log {
+		db.replayChange(change)
+	}
+	db.snapshots.replaying = false
+	slog.Debug("caught up with the published index", "changes", len(db.snapshots.log),
+		"waited", waited, "duration", time.Since(start))
+	db.snapshots.log = nil
+}
+
+// waitReaders waits for the queries on ix for up to timeout, or until
+// they are done if it is 0, and returns whether they are
+func waitReaders(ix *index, timeout time.Duration) bool {
+	if timeout == 0 {
+		ix.readers.Wait()
+		return true
+	}
+	done := make(chan struct{})
+	go func() {
+		ix.readers.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// publish lets new queries run on the copy the goroutine of Start
+// works on, it has to be called after changing the index
+func (db *Indexer) publish() {
+	if !db.snapshots.enabled {
+		return
+	}
+	if db.snapshots.shared || len(db.snapshots.log) == 0 && !db.snapshots.rebuilt {
+		// nothing changed, the copies are still the same
+		db.snapshots.Lock()
+		db.snapshots.changingSince = time.Time{}
+		db.snapshots.Unlock()
+		return
+	}
+
+	db.snapshots.Lock()
+	previous := db.snapshots.published
+	db.snapshots.published = db.currentIndex()
+	db.snapshots.changingSince = time.Time{}
+	db.snapshots.Unlock()
+
+	if db.snapshots.rebuilt {
+		// the previous copy is dropped once its queries are done
+		db.snapshots.stale = nil
+		db.snapshots.rebuilt = false
+	} else {
+		db.snapshots.stale = previous
+	}
+	db.snapshots.shared = true
+}
+
+func (db *Indexer) replayChange(change indexChange) {
+	switch change.kind {
+	case changeAdd:
+		db.addEntry(change.path, change.name, change.isDir)
+	case changeTraverse:
+		db.tree.Add(change.path)
+	case changeRemove:
+		db.removeEntry(filepath.Dir(change.path), change.name)
+	case changeTags:
+		db.tags.set(db.tree.Add(change.path), change.tags)
+	}
+}
+
+// cloneIndex returns a copy of ix that can be changed independently
+func cloneIndex(ix *index) *index {
+	start := time.Now()
+	clones := make(map[*tree.Node]*tree.Node)
+	clone := &index{
+		trie:        trie.NewTrie(),
+		trigrams:    newTrigramIndex(),
+		directories: newDirectoryNames(),
+	}
+	clone.tree = ix.tree.Clone(func(node, c *tree.Node) { clones[node] = c })
+
+	ix.trie.Visit(func(prefix trie.Prefix, item trie.Item) error {
+		var list *entryList
+		entriesOf(item).forEach(func(file indexedFile) bool {
+			file.pathNode = clones[file.pathNode]
+			if list == nil {
+				list = newEntryList(file)
+			} else {
+				list.add(file)
+			}
+			if file.isDir {
+				clone.directories.add(string(prefix), file.pathNode)
+			}
+			return true
+		})
+		if list != nil {
+			// Visit reuses prefix for the next key
+			clone.trie.Insert(append(trie.Prefix(nil), prefix...), list)
+			clone.trigrams.add(string(prefix))
+		}
+		return nil
+	})
+	clone.tags = ix.tags.clone(clones)
+
+	slog.Info("copied the index", "nodes", len(clones), "duration", time.Since(start))
+	return clone
+}
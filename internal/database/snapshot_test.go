@@ -0,0 +1,248 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/pkg/tree"
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+// newSnapshotIndexer returns an Indexer with snapshots enabled
+// on the synthetic index of size entries
+func newSnapshotIndexer(size int) *Indexer {
+	db := newSyntheticIndexer(size)
+	db.enableSnapshots()
+	return db
+}
+
+// indexContents lists the searchable entries and the tree of ix
+func indexContents(ix *index) []string {
+	var contents []string
+	ix.trie.Visit(func(prefix trie.Prefix, item trie.Item) error {
+		for _, file := range entriesOf(item).entries {
+			contents = append(contents, fmt.Sprintf("entry %s %s %v",
+				prefix, file.pathNode.GetPath(), file.isDir))
+		}
+		return nil
+	})
+	ix.tree.Clone(func(node, clone *tree.Node) {
+		contents = append(contents, "node "+node.GetPath())
+	})
+	sort.Strings(contents)
+	return contents
+}
+
+func TestSnapshots_Replay(t *testing.T) {
+	db := newSnapshotIndexer(2000)
+	directories := syntheticDirectories(2000)
+
+	steps := []struct {
+		name   string
+		change func()
+	}{
+		{"add_files", func() {
+			for _, entry := range newEntries(50, directories) {
+				db.addEntry(entry.path, entry.name, false)
+			}
+		}},
+		{"remove_directory", func() {
+			dir := directories[len(directories)-1]
+			db.removeFromIndex(filepath.Dir(dir), filepath.Base(dir))
+		}},
+		{"remove_files", func() {
+			for _, entry := range newEntries(50, directories)[:20] {
+				db.removeFromIndex(filepath.Dir(entry.path), entry.name)
+			}
+		}},
+		{"traverse", func() {
+			db.tree.Add("/synthetic/.hidden")
+			db.recordIndexChange(indexChange{changeTraverse, "/synthetic/.hidden", ".hidden", true, nil})
+		}},
+		{"rebuild", func() {
+			db.resetIndex()
+			for _, entry := range syntheticEntries(500) {
+				db.addEntry(entry.path, entry.name, entry.isDir)
+			}
+		}},
+		{"after_rebuild", func() {
+			db.addEntry("/synthetic/after_rebuild.txt", "after_rebuild.txt", false)
+		}},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			db.beginWrite()
+			if db.snapshots.published.trie == db.trie {
+				t.Fatal("changing the published copy")
+			}
+			step.change()
+			db.publish()
+
+			published := indexContents(db.snapshots.published)
+			// the next write replays the changes on the other copy
+			// or clones the published one
+			db.beginWrite()
+			if db.snapshots.published.trie == db.trie {
+				t.Fatal("writing to the published copy")
+			}
+			if got := indexContents(db.currentIndex()); !reflect.DeepEqual(got, published) {
+				t.Errorf("the copies differ after %s: %d and %d lines",
+					step.name, len(got), len(published))
+			}
+			db.publish()
+		})
+	}
+}
+
+func TestSnapshots_ConcurrentQueries(t *testing.T) {
+	db := newSnapshotIndexer(2000)
+
+	// entries are added and removed in batches, so every consistent
+	// snapshot has a multiple of batch matches
+	const batch = 10
+	const batches = 30
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	errs := make(chan string, 100)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				results := runQuery(db, request.PrefixSearch, "zzsnap", 0)
+				if len(results)%batch != 0 {
+					select {
+					case errs <- fmt.Sprintf("query saw %d entries", len(results)):
+					default:
+					}
+				}
+
+				// walking the tree of a snapshot is safe as well
+				walked := 0
+				ix, _ := db.acquireIndex()
+				ix.tree.Walk("/synthetic", 1, func(path string, isLeaf bool) error {
+					if strings.HasPrefix(path, "/synthetic/zzsnap") {
+						walked++
+					}
+					return nil
+				})
+				ix.release()
+				if walked%batch != 0 {
+					select {
+					case errs <- fmt.Sprintf("walk saw %d entries", walked):
+					default:
+					}
+				}
+			}
+		}()
+	}
+
+	path := func(i, j int) string {
+		return fmt.Sprintf("/synthetic/zzsnap%d_%d", i, j)
+	}
+	for i := 0; i < batches; i++ {
+		db.beginWrite()
+		for j := 0; j < batch; j++ {
+			db.addEntry(path(i, j), filepath.Base(path(i, j)), false)
+		}
+		db.publish()
+	}
+	for i := 0; i < batches; i += 2 {
+		db.beginWrite()
+		for j := 0; j < batch; j++ {
+			db.removeFromIndex("/synthetic", filepath.Base(path(i, j)))
+		}
+		db.publish()
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if got := runQuery(db, request.PrefixSearch, "zzsnap", 0); len(got) != batch*batches/2 {
+		t.Errorf("found %d entries, want %d", len(got), batch*batches/2)
+	}
+}
+
+func TestSnapshots_SlowReader(t *testing.T) {
+	db := newSnapshotIndexer(200)
+	const wait = 20 * time.Millisecond
+	db.snapshots.readerWait = wait
+	add := func(name string) time.Duration {
+		start := time.Now()
+		db.beginWrite()
+		waited := time.Since(start)
+		db.addEntry("/synthetic/"+name, name, false)
+		db.publish()
+		return waited
+	}
+
+	add("zzslow1")
+	// a query sending to a client that doesn't read holds on to
+	// the published copy, which is the stale one after the next change
+	held, _ := db.acquireIndex()
+	add("zzslow2")
+	if waited := add("zzslow3"); waited < wait || waited > wait+time.Second {
+		t.Errorf("change waited %v for the slow query, want about %v", waited, wait)
+	}
+
+	if got := runQuery(db, request.PrefixSearch, "zzslow", 0); len(got) != 3 {
+		t.Errorf("found %q, want all three entries", got)
+	}
+	if got := held.trie.Get(trie.Prefix("zzslow2")); got != nil {
+		t.Error("the copy of the slow query was changed")
+	}
+	held.release()
+
+	published := indexContents(db.snapshots.published)
+	db.beginWrite()
+	if got := indexContents(db.currentIndex()); !reflect.DeepEqual(got, published) {
+		t.Errorf("the copies differ after copying: %d and %d lines", len(got), len(published))
+	}
+	db.publish()
+}
+
+func TestSnapshots_AsOf(t *testing.T) {
+	db := newSnapshotIndexer(200)
+	acquire := func() time.Time {
+		ix, asOf := db.acquireIndex()
+		ix.release()
+		return asOf
+	}
+
+	if asOf := acquire(); time.Since(asOf) > time.Second {
+		t.Errorf("got %v for a current copy, want about now", asOf)
+	}
+	db.beginWrite()
+	changed := time.Now()
+	db.addEntry("/synthetic/zzasof", "zzasof", false)
+	time.Sleep(10 * time.Millisecond)
+	if asOf := acquire(); asOf.After(changed) {
+		t.Errorf("got %v while a change is unpublished, want before %v", asOf, changed)
+	}
+	db.publish()
+	if asOf := acquire(); asOf.Before(changed) {
+		t.Errorf("got %v after publishing, want after %v", asOf, changed)
+	}
+
+	// a write changing nothing leaves the copy current
+	db.beginWrite()
+	db.publish()
+	if asOf := acquire(); time.Since(asOf) > time.Second {
+		t.Errorf("got %v after an empty write, want about now", asOf)
+	}
+}
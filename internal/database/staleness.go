@@ -0,0 +1,173 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/mounts"
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/internal/watch"
+)
+
+// mountKey tells a filesystem apart from one mounted at the same
+// mount point later
+type mountKey struct {
+	mountPoint string
+	dev        uint64
+}
+
+// reconciliations are when the entries on the mounted filesystems were
+// last read completely, by a full index, a reconciliation or a refresh
+// of a directory above them. Searches read them concurrently.
+type reconciliations struct {
+	sync.Mutex
+	at map[mountKey]time.Time
+}
+
+// record records that the entries below path were read completely,
+// starting at start. Mounts that aren't in table anymore are dropped.
+func (r *reconciliations) record(path string, table []mounts.Mount, start time.Time) {
+	r.Lock()
+	defer r.Unlock()
+	at := make(map[mountKey]time.Time, len(table))
+	for _, m := range table {
+		key := mountKey{m.MountPoint, m.Dev}
+		if _, ok := below(m.MountPoint, path); ok {
+			at[key] = start
+		} else if t, ok := r.at[key]; ok {
+			at[key] = t
+		}
+	}
+	r.at = at
+}
+
+// last returns when the entries on m were last read completely, zero
+// if they weren't since it was mounted
+func (r *reconciliations) last(m mounts.Mount) time.Time {
+	r.Lock()
+	defer r.Unlock()
+	return r.at[mountKey{m.MountPoint, m.Dev}]
+}
+
+// mountState is how fresh the indexed entries on a mounted filesystem are
+type mountState struct {
+	mount mounts.Mount
+	// watched is set if all changes of the filesystem are seen
+	watched bool
+	// reconciled is when its entries were last read completely,
+	// zero if they weren't since it was mounted
+	reconciled time.Time
+}
+
+// stale returns whether the entries may be outdated or missing
+func (s mountState) stale() bool {
+	return !s.watched || s.reconciled.IsZero()
+}
+
+// warning returns the warning sent with results on a stale mount
+func (s mountState) warning(now time.Time) request.Warning {
+	w := request.Warning{Code: request.WarnStaleMount}
+	if s.reconciled.IsZero() {
+		w.Message = fmt.Sprintf("%s (%s) wasn't read since it was mounted, its entries may be missing",
+			s.mount.MountPoint, s.mount.FSType)
+	} else {
+		w.Message = fmt.Sprintf("changes on %s (%s) aren't watched, its entries were read %s ago",
+			s.mount.MountPoint, s.mount.FSType, now.Sub(s.reconciled).Round(time.Second))
+	}
+	return w
+}
+
+// description returns the state as sent for Describe and Stats
+func (s mountState) description() request.MountDescription {
+	return request.MountDescription{
+		MountPoint:     s.mount.MountPoint,
+		FSType:         s.mount.FSType,
+		Source:         s.mount.Source,
+		Excluded:       config.IsFSTypeFiltered(s.mount.FSType),
+		Watched:        s.watched,
+		LastReconciled: unixTime(s.reconciled),
+		Stale:          s.stale(),
+	}
+}
+
+// mountIndex maps the mount points to the states of the filesystems
+// visible at them
+type mountIndex map[string]mountState
+
+// mountStates returns the states of the filesystems mounted below the
+// root. Later mounts hide earlier ones at the same mount point.
+func (db *Indexer) mountStates() (mountIndex, []mountState) {
+	index := make(mountIndex)
+	var states []mountState
+	for _, m := range mounts.All() {
+		if _, ok := below(m.MountPoint, db.root); !ok {
+			continue
+		}
+		s := mountState{
+			mount:      m,
+			watched:    watch.Covers(m.Dev, m.MountPoint) && watch.Reliable(m.FSType),
+			reconciled: db.reconciliations.last(m),
+		}
+		if _, ok := index[m.MountPoint]; ok {
+			for i := range states {
+				if states[i].mount.MountPoint == m.MountPoint {
+					states[i] = s
+				}
+			}
+		} else {
+			states = append(states, s)
+		}
+		index[m.MountPoint] = s
+	}
+	return index, states
+}
+
+// lookup returns the state of the filesystem path is on, which is
+// mounted at the longest mount point path is at or below
+func (m mountIndex) lookup(path string) (mountState, bool) {
+	for {
+		if s, ok := m[path]; ok {
+			return s, true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return mountState{}, false
+		}
+		path = parent
+	}
+}
+
+// staleMounts returns the stale mounts the results from start to end
+// are on, by mount point
+func (m mountIndex) staleMounts(results resulter, start, end int) []mountState {
+	anyStale := false
+	for _, s := range m {
+		anyStale = anyStale || s.stale()
+	}
+	if !anyStale {
+		return nil
+	}
+
+	found := make(map[string]mountState)
+	for i := start; i < end; i++ {
+		path := results.Result(i)
+		if !filepath.IsAbs(path) {
+			continue
+		}
+		if s, ok := m.lookup(path); ok && s.stale() {
+			found[s.mount.MountPoint] = s
+		}
+	}
+	stale := make([]mountState, 0, len(found))
+	for _, s := range found {
+		stale = append(stale, s)
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		return stale[i].mount.MountPoint < stale[j].mount.MountPoint
+	})
+	return stale
+}
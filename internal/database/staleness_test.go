@@ -0,0 +1,107 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/mounts"
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestReconciliations_Record(t *testing.T) {
+	root := mounts.Mount{Dev: 1, MountPoint: "/"}
+	home := mounts.Mount{Dev: 2, MountPoint: "/home"}
+	nfs := mounts.Mount{Dev: 3, MountPoint: "/mnt/nfs"}
+	remounted := mounts.Mount{Dev: 4, MountPoint: "/mnt/nfs"}
+	indexed, refreshed := time.Unix(100, 0), time.Unix(200, 0)
+
+	var r reconciliations
+	r.record("/", []mounts.Mount{root, home, nfs}, indexed)
+	r.record("/home", []mounts.Mount{root, home, remounted}, refreshed)
+
+	tests := []struct {
+		name  string
+		mount mounts.Mount
+		want  time.Time
+	}{
+		{"indexed", root, indexed},
+		{"refreshed", home, refreshed},
+		{"unmounted", nfs, time.Time{}},
+		// mounted after the full index
+		{"remounted", remounted, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.last(tt.mount); !got.Equal(tt.want) {
+				t.Errorf("last(%s) = %v, want %v", tt.mount.MountPoint, got, tt.want)
+			}
+		})
+	}
+}
+
+// resultList is a resulter of unsorted paths
+type resultList []string
+
+func (l resultList) Len() int                { return len(l) }
+func (l resultList) Swap(i, j int)           { l[i], l[j] = l[j], l[i] }
+func (l resultList) Less(i, j int) bool      { return l[i] < l[j] }
+func (l resultList) Result(index int) string { return l[index] }
+
+func TestMountIndex_StaleMounts(t *testing.T) {
+	now := time.Unix(10000, 0)
+	state := func(mountPoint, fsType string, watched bool, reconciled int64) mountState {
+		s := mountState{mount: mounts.Mount{MountPoint: mountPoint, FSType: fsType},
+			watched: watched}
+		if reconciled > 0 {
+			s.reconciled = time.Unix(reconciled, 0)
+		}
+		return s
+	}
+	index := mountIndex{
+		"/":                state("/", "ext4", true, 1000),
+		"/mnt/nfs":         state("/mnt/nfs", "nfs4", false, 1000),
+		"/mnt/nfs/scratch": state("/mnt/nfs/scratch", "tmpfs", true, 1000),
+		"/media/usb":       state("/media/usb", "vfat", true, 0),
+	}
+
+	tests := []struct {
+		name    string
+		results resultList
+		want    []string
+	}{
+		{"fresh", resultList{"/home/a", "/mnt/nfsx/b"}, nil},
+		{"unwatched", resultList{"/home/a", "/mnt/nfs/b"},
+			[]string{"changes on /mnt/nfs (nfs4) aren't watched, its entries were read 2h30m0s ago"}},
+		// the longest mount point wins
+		{"nested", resultList{"/mnt/nfs/scratch/c"}, nil},
+		{"mount_point", resultList{"/mnt/nfs"},
+			[]string{"changes on /mnt/nfs (nfs4) aren't watched, its entries were read 2h30m0s ago"}},
+		{"not_read", resultList{"/media/usb/d", "/media/usb/e", "/mnt/nfs/f"},
+			[]string{"/media/usb (vfat) wasn't read since it was mounted, its entries may be missing",
+				"changes on /mnt/nfs (nfs4) aren't watched, its entries were read 2h30m0s ago"}},
+		{"alias", resultList{"/media/usb/d\talias"},
+			[]string{"/media/usb (vfat) wasn't read since it was mounted, its entries may be missing"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, s := range index.staleMounts(tt.results, 0, len(tt.results)) {
+				w := s.warning(now)
+				if w.Code != request.WarnStaleMount {
+					t.Errorf("warning code %q, want %q", w.Code, request.WarnStaleMount)
+				}
+				got = append(got, w.Message)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("warnings = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// only the results sent count
+	results := resultList{"/mnt/nfs/a", "/home/b"}
+	if stale := index.staleMounts(results, 1, 2); len(stale) != 0 {
+		t.Errorf("stale mounts of unsent results: %+v", stale)
+	}
+}
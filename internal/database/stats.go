@@ -0,0 +1,88 @@
+package database
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/watch"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func (db *Indexer) currentStats() request.StatsResponse {
+	stats := db.lastIndexStats
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	stats.MemoryAlloc = m.Alloc
+	stats.MemorySys = m.Sys
+
+	stats.Uptime = time.Since(db.startTime).Seconds()
+	stats.Pid = os.Getpid()
+	stats.EventsProcessed = db.eventsProcessed
+	stats.Backlog = len(db.changes)
+	if !db.lastReconciliation.IsZero() {
+		stats.LastReconciliation = db.lastReconciliation.Unix()
+	}
+	stats.Watcher = watch.Backend()
+	stats.WatchedMounts = watch.Watched()
+	stats.Paused = db.paused
+	stats.PausedEvents = db.pausedEvents
+	stats.PendingDirectories = len(db.pendingDirectories)
+	stats.FailedDirectories = len(db.failures)
+	for _, f := range db.failures {
+		if f.suppressed {
+			stats.SuppressedFailures++
+		}
+	}
+	stats.QueryLimits = request.CurrentLimits()
+	stats.RecentQueries = db.recentQueries.list()
+	stats.Aliases = db.aliases.list()
+	stats.DeletedEntries, stats.DeletedCapacity = db.deleted.occupancy(time.Now())
+	stats.RecentEntries, stats.RecentCapacity, stats.RecentDropped = db.recent.occupancy()
+	var built time.Time
+	stats.ColdEntries, stats.ColdMemory, stats.ColdFileSize, built = db.cold.stats()
+	stats.ColdBuilt = unixTime(built)
+	stats.QueryCacheSize, stats.QueryCacheHits, stats.QueryCacheMisses = db.cache.stats()
+	stats.Generation = db.publishedGeneration()
+	_, states := db.mountStates()
+	for _, s := range states {
+		if d := s.description(); d.Stale && !d.Excluded {
+			stats.StaleMounts = append(stats.StaleMounts, d)
+		}
+	}
+	if root, err := db.tree.Lookup(db.root); err == nil {
+		stats.IndexedEntries = root.Count()
+	}
+
+	return stats
+}
+
+func (db *Indexer) sendStats(req request.Request) {
+	defer close(req.ResponseChannel)
+
+	stats := db.currentStats()
+	stats.Breakdown = db.breakdown(req.Settings.Breakdown)
+	statsBytes, err := json.Marshal(stats)
+	if err != nil {
+		req.Logger().Error("failed to encode stats", "err", err)
+		return
+	}
+
+	select {
+	case req.ResponseChannel <- string(statsBytes):
+	case <-req.Done:
+	}
+}
+
+func (db *Indexer) sendGeneration(req request.Request) {
+	defer close(req.ResponseChannel)
+
+	encoded, _ := json.Marshal(request.GenerationResponse{Generation: db.publishedGeneration()})
+	select {
+	case req.ResponseChannel <- string(encoded):
+	case <-req.Done:
+	}
+}
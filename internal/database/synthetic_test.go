@@ -0,0 +1,190 @@
+package database
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+var indexSizes = flag.String("index-sizes", "100000",
+	"comma separated sizes of the synthetic index used by the benchmarks, "+
+		"e.g. 100000,1000000,5000000")
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	// queries and refreshes log, which would dominate the benchmarks
+	slog.SetDefault(slog.New(slog.NewTextHandler(ioutil.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// words make up the generated names, so they share prefixes
+// and substrings like real file names do
+var words = strings.Fields(`
+	src lib bin include share doc man cache config local test tests build
+	dist vendor node modules pkg internal cmd api client server util utils
+	core main index app assets static images icons fonts styles scripts
+	readme license changelog makefile setup install update report backup
+	photo video music notes draft final old new tmp temp data log logs
+	user users home project projects work personal archive download`)
+
+var extensions = []string{"", ".go", ".c", ".h", ".txt", ".md", ".json",
+	".png", ".jpg", ".so", ".py", ".js", ".html", ".conf", ".log"}
+
+// syntheticEntry is a generated file or directory
+type syntheticEntry struct {
+	path  string
+	name  string
+	isDir bool
+}
+
+// syntheticEntries generates a tree of size files and directories
+// below /synthetic. The tree is the same for every call with the
+// same size.
+func syntheticEntries(size int) []syntheticEntry {
+	rng := rand.New(rand.NewSource(int64(size)))
+	directories := []string{"/synthetic"}
+	seen := make(map[string]bool, size)
+	entries := make([]syntheticEntry, 0, size)
+
+	for len(entries) < size {
+		parent := directories[rng.Intn(len(directories))]
+		isDir := rng.Intn(10) == 0
+
+		name := words[rng.Intn(len(words))]
+		if rng.Intn(2) == 0 {
+			name += "_" + words[rng.Intn(len(words))]
+		}
+		if !isDir {
+			name += strconv.Itoa(rng.Intn(100)) + extensions[rng.Intn(len(extensions))]
+		}
+
+		path := filepath.Join(parent, name)
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		entries = append(entries, syntheticEntry{path, name, isDir})
+		if isDir {
+			directories = append(directories, path)
+		}
+	}
+	return entries
+}
+
+// newSyntheticIndexer returns an Indexer holding the synthetic
+// index of size entries
+func newSyntheticIndexer(size int) *Indexer {
+	db := New(Options{Root: "/synthetic"})
+	db.tree.Add("/synthetic")
+	for _, entry := range syntheticEntries(size) {
+		db.addEntry(entry.path, entry.name, entry.isDir)
+	}
+	return db
+}
+
+// syntheticDirectories returns the directories of the synthetic
+// index of size entries
+func syntheticDirectories(size int) []string {
+	directories := []string{"/synthetic"}
+	for _, entry := range syntheticEntries(size) {
+		if entry.isDir {
+			directories = append(directories, entry.path)
+		}
+	}
+	return directories
+}
+
+// benchmarkSizes returns the sizes given by -index-sizes
+func benchmarkSizes(b *testing.B) []int {
+	var sizes []int
+	for _, field := range strings.Split(*indexSizes, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || size < 1 {
+			b.Fatalf("invalid -index-sizes %q", *indexSizes)
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes
+}
+
+// sizeName formats size like 100k or 5M
+func sizeName(size int) string {
+	switch {
+	case size >= 1000000 && size%1000000 == 0:
+		return fmt.Sprintf("%dM", size/1000000)
+	case size >= 1000 && size%1000 == 0:
+		return fmt.Sprintf("%dk", size/1000)
+	}
+	return strconv.Itoa(size)
+}
+
+// runQuery runs a query on the index of db and returns its results
+func runQuery(db *Indexer, action int, query string, maxResults int) []string {
+	req := request.Request{
+		Query:           query,
+		Settings:        request.Settings{Action: action, MaxResults: maxResults},
+		ResponseChannel: make(chan string),
+		Done:            make(chan struct{}),
+	}
+	go db.queryIndex(req)
+
+	var results []string
+	for result := range req.ResponseChannel {
+		results = append(results, result)
+	}
+	return results
+}
+
+// runRequest sends req to the handler of db and returns its responses
+func runRequest(db *Indexer, req request.Request) []string {
+	req.ResponseChannel = make(chan string)
+	req.Done = make(chan struct{})
+	// requests like RefreshPath go on changing the index after
+	// closing the channel, the caller may look at it afterwards
+	handled := make(chan struct{})
+	go func() {
+		defer close(handled)
+		db.handleRequest(req)
+	}()
+
+	var responses []string
+	for response := range req.ResponseChannel {
+		responses = append(responses, response)
+	}
+	<-handled
+	return responses
+}
+
+func TestSyntheticIndex(t *testing.T) {
+	const size = 2000
+	entries := syntheticEntries(size)
+	if len(entries) != size {
+		t.Fatalf("generated %d entries, want %d", len(entries), size)
+	}
+
+	db := newSyntheticIndexer(size)
+	if got := db.tree.Count(); got != size+1 {
+		t.Errorf("tree has %d nodes, want %d", got, size+1)
+	}
+
+	for _, entry := range entries[:20] {
+		results := runQuery(db, request.PrefixSearch, entry.name, 0)
+		found := false
+		for _, result := range results {
+			found = found || result == entry.path
+		}
+		if !found {
+			t.Errorf("prefix search for %q didn't find %s", entry.name, entry.path)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/pkg/tree"
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+// tagIndex holds the tags read from the extended attribute tags_xattr.
+// Only tagged entries are in it, so the rest of the index doesn't grow.
+type tagIndex struct {
+	// entries are the tagged entries by tag
+	entries map[string]map[*tree.Node]bool
+	// tags are the tags of the tagged entries
+	tags map[*tree.Node][]string
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{
+		entries: make(map[string]map[*tree.Node]bool),
+		tags:    make(map[*tree.Node][]string),
+	}
+}
+
+// set replaces the tags of the entry node
+func (t *tagIndex) set(node *tree.Node, tags []string) {
+	t.remove(node)
+	if len(tags) == 0 {
+		return
+	}
+	t.tags[node] = tags
+	for _, tag := range tags {
+		nodes := t.entries[tag]
+		if nodes == nil {
+			nodes = make(map[*tree.Node]bool)
+			t.entries[tag] = nodes
+		}
+		nodes[node] = true
+	}
+}
+
+// remove drops the tags of the entry node
+func (t *tagIndex) remove(node *tree.Node) {
+	tags, ok := t.tags[node]
+	if !ok {
+		return
+	}
+	delete(t.tags, node)
+	for _, tag := range tags {
+		nodes := t.entries[tag]
+		delete(nodes, node)
+		if len(nodes) == 0 {
+			delete(t.entries, tag)
+		}
+	}
+}
+
+// clone returns a copy of t with the nodes mapped through clones
+func (t *tagIndex) clone(clones map[*tree.Node]*tree.Node) *tagIndex {
+	c := newTagIndex()
+	for node, tags := range t.tags {
+		c.set(clones[node], tags)
+	}
+	return c
+}
+
+// parseTags splits the value of the tags attribute at the commas,
+// dropping empty and repeated tags
+func parseTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || contains(tags, tag) {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// readTags reads the tags of the entry node at path if tags are
+// indexed. Replayed entries get their tags from the recorded change.
+func (db *Indexer) readTags(node *tree.Node, path string) {
+	if db.tagsXattr == "" || db.snapshots.replaying {
+		return
+	}
+	value, err := db.fs.Xattr(path, db.tagsXattr)
+	if err != nil {
+		slog.Debug("couldn't read tags", "path", path, "err", err)
+		return
+	}
+	tags := parseTags(value)
+	if _, tagged := db.tags.tags[node]; len(tags) == 0 && !tagged {
+		return
+	}
+	db.tags.set(node, tags)
+	db.recordIndexChange(indexChange{kind: changeTags, path: path, tags: tags})
+}
+
+// refreshTags reads the tags of the indexed entries at path and below
+// it again. Setting an extended attribute doesn't create or delete
+// anything, so the tags are only updated by refreshes.
+func (db *Indexer) refreshTags(path string) {
+	if db.tagsXattr == "" {
+		return
+	}
+	db.tree.Walk(path, 0, func(walked string, isLeaf bool) error {
+		if walked == "/" || config.FilterPath(walked) != config.Included {
+			return nil
+		}
+		db.readTags(db.tree.Add(walked), walked)
+		return nil
+	})
+}
+
+// taggedEntries returns the entries with the tag of filter that pass
+// it, for searches with an empty query
+func (ix *index) taggedEntries(req request.Request, filter *entryFilter) byLength {
+	var results byLength
+	for node := range filter.tagged {
+		if isCancelled(req) {
+			break
+		}
+		// the trie knows whether the entry is a directory
+		item := ix.trie.Get(trie.Prefix(node.Name()))
+		if item == nil {
+			continue
+		}
+		entriesOf(item).forEach(func(file indexedFile) bool {
+			if file.pathNode != node {
+				return true
+			}
+			if filter.matches(file, 0) {
+				results = append(results, node.GetPath())
+			}
+			return false
+		})
+	}
+	return results
+}
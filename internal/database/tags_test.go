@@ -0,0 +1,110 @@
+package database
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// newTaggedIndexer returns an Indexer reading the tags of the entries
+// of fs from user.tags
+func newTaggedIndexer(fs *fakeFS) *Indexer {
+	return newFakeIndexer(fs, Options{TagsXattr: "user.tags"})
+}
+
+// tagQuery returns the sorted results of a query, or the codes
+// of the errors
+func tagQuery(db *Indexer, query string, settings request.Settings) []string {
+	lines := runRequest(db, request.Request{Version: 1, Query: query, Settings: settings})
+	var got []string
+	for _, line := range lines {
+		if e, ok := request.ParseError(line); ok {
+			got = append(got, e.Code)
+			continue
+		}
+		got = append(got, line)
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestTags(t *testing.T) {
+	fs := newFakeFS("/r/docs/invoice.pdf", "/r/docs/invoice.odt", "/r/docs/notes.md",
+		"/r/taxes/")
+	fs.xattrs["/r/docs/invoice.pdf"] = "work, tax"
+	fs.xattrs["/r/docs/notes.md"] = "work"
+	fs.xattrs["/r/taxes"] = "tax,,tax"
+	db := newTaggedIndexer(fs)
+
+	tests := []struct {
+		name     string
+		query    string
+		settings request.Settings
+		want     []string
+	}{
+		{"with_query", "invoice", request.Settings{Tag: "work"},
+			[]string{"/r/docs/invoice.pdf"}},
+		{"without_query", "", request.Settings{Tag: "tax"},
+			[]string{"/r/docs/invoice.pdf", "/r/taxes"}},
+		{"type", "", request.Settings{Tag: "tax", TypeFilter: request.TypeDirectory},
+			[]string{"/r/taxes"}},
+		{"fuzzy", "nts", request.Settings{Action: request.FuzzySearch, Tag: "work"},
+			[]string{"/r/docs/notes.md"}},
+		{"class", "", request.Settings{Tag: "work", Class: "document"},
+			[]string{"/r/docs/invoice.pdf", "/r/docs/notes.md"}},
+		{"unknown_tag", "", request.Settings{Tag: "home"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tagQuery(db, tt.query, tt.settings); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tag %s = %q, want %q", tt.settings.Tag, got, tt.want)
+			}
+		})
+	}
+
+	untagged := newFakeIndexer(fs, Options{})
+	got := tagQuery(untagged, "", request.Settings{Tag: "tax"})
+	if want := []string{request.ErrInvalidRequest}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tag without tags_xattr = %q, want %q", got, want)
+	}
+	if len(untagged.tags.tags) != 0 {
+		t.Errorf("%d entries tagged without tags_xattr", len(untagged.tags.tags))
+	}
+}
+
+func TestTags_Refresh(t *testing.T) {
+	fs := newFakeFS("/r/docs/a.md", "/r/docs/b.md", "/r/other/c.md")
+	fs.xattrs["/r/docs/a.md"] = "work"
+	fs.xattrs["/r/other/c.md"] = "work"
+	db := newTaggedIndexer(fs)
+	db.enableSnapshots()
+
+	db.beginWrite()
+	fs.xattrs["/r/docs/a.md"] = ""
+	fs.xattrs["/r/docs/b.md"] = "work"
+	fs.xattrs["/r/other/c.md"] = ""
+	db.refreshTags("/r/docs")
+	db.publish()
+
+	// only the refreshed directory is read again
+	want := []string{"/r/docs/b.md", "/r/other/c.md"}
+	if got := tagQuery(db, "", request.Settings{Tag: "work"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("after refresh = %q, want %q", got, want)
+	}
+
+	db.beginWrite()
+	db.removeFromIndex("/r/other", "c.md")
+	db.publish()
+	// the changes were replayed on this copy
+	db.beginWrite()
+	if got := len(db.tags.tags); got != 1 {
+		t.Errorf("%d tagged entries after replaying, want 1", got)
+	}
+	db.publish()
+	want = []string{"/r/docs/b.md"}
+	if got := tagQuery(db, "", request.Settings{Tag: "work"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("after removal = %q, want %q", got, want)
+	}
+}
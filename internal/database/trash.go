@@ -0,0 +1,267 @@
+package database
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/mounts"
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/pkg/tree"
+	"github.com/pkg/errors"
+)
+
+// trashInfoSuffix ends the names of the files in the info directory
+// of a trash, which describe the entry of the same name in files
+const trashInfoSuffix = ".trashinfo"
+
+// trashDateLayout is the format of DeletionDate, in local time
+const trashDateLayout = "2006-01-02T15:04:05"
+
+// trashDirectory is a trash following the freedesktop.org trash spec,
+// with the trashed entries in files and their trashinfo files in info
+type trashDirectory struct {
+	path string
+	// topdir is the mount point relative original paths start at,
+	// empty for the trash of a home, whose paths are absolute
+	topdir string
+}
+
+// trashedEntry is an entry in a trash or below a trashed directory
+type trashedEntry struct {
+	// path is where the entry is in the trash
+	path string
+	// original is where it was before it was trashed
+	original string
+	deleted  time.Time
+}
+
+// line returns the entry as sent to clients
+func (e trashedEntry) line() string {
+	return e.deleted.Format(time.RFC3339) + "\t" + e.original + "\t" + e.path
+}
+
+// parseTrashInfo reads the original path and the deletion date from
+// a trashinfo file of a trash whose relative paths start at topdir
+func parseTrashInfo(r io.Reader, topdir string) (original string, deleted time.Time, err error) {
+	scanner := bufio.NewScanner(r)
+	inGroup := false
+	var path, date string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			inGroup = line == "[Trash Info]"
+			continue
+		}
+		if !inGroup {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "Path":
+			path = strings.TrimSpace(value)
+		case "DeletionDate":
+			date = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", time.Time{}, err
+	}
+	if path == "" {
+		return "", time.Time{}, errors.New("no Path in [Trash Info]")
+	}
+
+	original, err = url.PathUnescape(path)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "invalid Path")
+	}
+	if !filepath.IsAbs(original) {
+		if topdir == "" {
+			return "", time.Time{}, errors.Errorf("relative Path %q in the trash of a home", original)
+		}
+		original = filepath.Join(topdir, original)
+	}
+	original = filepath.Clean(original)
+
+	deleted, err = time.ParseInLocation(trashDateLayout, date, time.Local)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "invalid DeletionDate")
+	}
+	return original, deleted, nil
+}
+
+// trashDirectories returns the trashes below root: those of the homes
+// whose ~/.local/share is indexed, and those at the top of the mounts
+func (ix *index) trashDirectories(root string) []trashDirectory {
+	var trashes []trashDirectory
+	var homes []*tree.Node
+	ix.directories.visitPrefix("share", func(node *tree.Node) bool {
+		if node.Name() == "share" {
+			homes = append(homes, node)
+		}
+		return true
+	})
+	for _, node := range homes {
+		if path := node.GetPath(); strings.HasSuffix(path, "/.local/share") {
+			trashes = append(trashes, trashDirectory{path: path + "/Trash"})
+		}
+	}
+
+	prefix := strings.TrimSuffix(root, "/") + "/"
+	for _, m := range mounts.All() {
+		topdir := m.MountPoint
+		if topdir != root && !strings.HasPrefix(topdir, prefix) {
+			continue
+		}
+		// $topdir/.Trash/$uid is shared, $topdir/.Trash-$uid is not
+		shared, _ := filepath.Glob(filepath.Join(topdir, ".Trash", "*"))
+		own, _ := filepath.Glob(filepath.Join(topdir, ".Trash-*"))
+		for _, path := range append(shared, own...) {
+			trashes = append(trashes, trashDirectory{path: path, topdir: topdir})
+		}
+	}
+
+	sort.Slice(trashes, func(i, j int) bool { return trashes[i].path < trashes[j].path })
+	unique := trashes[:0]
+	for _, t := range trashes {
+		if len(unique) == 0 || t.path != unique[len(unique)-1].path {
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+// visitTrash calls visit with the entries of the trash t and
+// everything below its trashed directories until it returns false.
+// Entries without a readable trashinfo file are skipped.
+func visitTrash(t trashDirectory, visit func(trashedEntry) bool) error {
+	// symlinks could point anywhere, trashes are real directories
+	info, err := os.Lstat(t.path)
+	if os.IsNotExist(err) || (err == nil && !info.IsDir()) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	files := filepath.Join(t.path, "files")
+	entries, err := os.ReadDir(files)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		f, err := os.Open(filepath.Join(t.path, "info", entry.Name()+trashInfoSuffix))
+		if err != nil {
+			continue
+		}
+		original, deleted, err := parseTrashInfo(f, t.topdir)
+		f.Close()
+		if err != nil {
+			continue
+		}
+
+		trashed := filepath.Join(files, entry.Name())
+		err = filepath.WalkDir(trashed, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// unreadable trashed directories are skipped
+				return nil
+			}
+			e := trashedEntry{path: path, original: original + path[len(trashed):],
+				deleted: deleted}
+			if !visit(e) {
+				return errCancelled
+			}
+			return nil
+		})
+		if err == errCancelled {
+			return nil
+		}
+	}
+	return nil
+}
+
+// sendTrash sends the trashed entries whose original path matches the
+// query. The most recently deleted ones are kept if there are more
+// than MaxResults, they are sent oldest first unless ReverseSort is set.
+func (db *Indexer) sendTrash(req request.Request) {
+	defer close(req.ResponseChannel)
+	defer queryDuration.With(actionLabel(req.Settings.Action)).ObserveSince(time.Now())
+
+	e := db.rejectQuery(req)
+	pattern := req.Query
+	if req.Settings.CaseInsensitive {
+		pattern = strings.ToLower(pattern)
+	}
+	if _, err := filepath.Match(pattern, ""); e == nil && err != nil {
+		e = &request.ErrorResponse{Code: request.ErrInvalidRequest,
+			Message: "invalid pattern " + req.Query}
+	}
+	if e != nil {
+		select {
+		case req.ResponseChannel <- e.Line(req.Version):
+		case <-req.Done:
+		}
+		return
+	}
+
+	start := time.Now()
+	ix, _ := db.acquireIndex()
+	trashes := ix.trashDirectories(db.root)
+	ix.release()
+
+	var entries []trashedEntry
+	for _, t := range trashes {
+		err := visitTrash(t, func(e trashedEntry) bool {
+			if pathMatches(pattern, e.original, req.Settings.CaseInsensitive) {
+				entries = append(entries, e)
+			}
+			return !isCancelled(req)
+		})
+		if err != nil {
+			req.Logger().Debug("couldn't read trash", "path", t.path, "err", err)
+		}
+		if isCancelled(req) {
+			return
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].deleted.Equal(entries[j].deleted) {
+			return entries[i].original < entries[j].original
+		}
+		return entries[i].deleted.Before(entries[j].deleted)
+	})
+	matches := len(entries)
+	if max := req.Settings.MaxResults; max > 0 && len(entries) > max {
+		entries = entries[len(entries)-max:]
+	}
+
+	for i := range entries {
+		e := entries[i]
+		if req.Settings.ReverseSort {
+			e = entries[len(entries)-1-i]
+		}
+		select {
+		case req.ResponseChannel <- e.line():
+		case <-req.Done:
+			return
+		}
+	}
+	duration := time.Since(start)
+	req.Logger().Debug("sent trash", "trashes", len(trashes), "matches", matches,
+		"duration", duration)
+	db.recordQuery(req, duration, len(entries))
+	sendStatus(req, matches, len(entries), nil, time.Time{})
+}
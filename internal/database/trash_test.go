@@ -0,0 +1,128 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestParseTrashInfo(t *testing.T) {
+	deleted := time.Date(2024, 5, 1, 12, 30, 0, 0, time.Local)
+	tests := []struct {
+		name     string
+		content  string
+		topdir   string
+		want     string
+		wantDate time.Time
+		wantErr  bool
+	}{
+		{"absolute", "[Trash Info]\nPath=/home/u/report.pdf\nDeletionDate=2024-05-01T12:30:00\n",
+			"", "/home/u/report.pdf", deleted, false},
+		// reserved characters are percent-encoded like in URLs
+		{"escaped", "[Trash Info]\nPath=/home/u/tax%20return%252024.pdf\nDeletionDate=2024-05-01T12:30:00\n",
+			"", "/home/u/tax return%2024.pdf", deleted, false},
+		{"utf8", "[Trash Info]\nPath=/home/u/%C3%BCber.txt\nDeletionDate=2024-05-01T12:30:00\n",
+			"", "/home/u/über.txt", deleted, false},
+		// the trashes of mounts may store paths relative to their top
+		{"relative", "[Trash Info]\nPath=docs/a.txt\nDeletionDate=2024-05-01T12:30:00\n",
+			"/mnt/usb", "/mnt/usb/docs/a.txt", deleted, false},
+		{"relative_in_home", "[Trash Info]\nPath=docs/a.txt\nDeletionDate=2024-05-01T12:30:00\n",
+			"", "", time.Time{}, true},
+		{"comments_and_order", "# written by hand\n[Trash Info]\nDeletionDate=2024-05-01T12:30:00\nPath=/a\n",
+			"", "/a", deleted, false},
+		// only the keys of the [Trash Info] group count
+		{"other_group", "[Other]\nPath=/b\n[Trash Info]\nPath=/a\nDeletionDate=2024-05-01T12:30:00\n",
+			"", "/a", deleted, false},
+		{"no_group", "Path=/a\nDeletionDate=2024-05-01T12:30:00\n", "", "", time.Time{}, true},
+		{"no_path", "[Trash Info]\nDeletionDate=2024-05-01T12:30:00\n", "", "", time.Time{}, true},
+		{"invalid_escape", "[Trash Info]\nPath=/a%zz\nDeletionDate=2024-05-01T12:30:00\n",
+			"", "", time.Time{}, true},
+		{"invalid_date", "[Trash Info]\nPath=/a\nDeletionDate=yesterday\n", "", "", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotDate, err := parseTrashInfo(strings.NewReader(tt.content), tt.topdir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTrashInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || !gotDate.Equal(tt.wantDate) {
+				t.Errorf("parseTrashInfo() = %q, %v, want %q, %v", got, gotDate, tt.want, tt.wantDate)
+			}
+		})
+	}
+}
+
+func TestTrash(t *testing.T) {
+	root := t.TempDir()
+	trash := filepath.Join(root, "home/u/.local/share/Trash")
+	info := func(path, date string) string {
+		return "[Trash Info]\nPath=" + path + "\nDeletionDate=" + date + "\n"
+	}
+	files := map[string]string{
+		"files/report.pdf":          "",
+		"info/report.pdf.trashinfo": info("/home/u/docs/report.pdf", "2024-05-01T12:00:00"),
+		// a second file trashed under the same name
+		"files/report.2.pdf":          "",
+		"info/report.2.pdf.trashinfo": info("/home/u/report.pdf", "2024-05-02T12:00:00"),
+		"files/project/notes.md":      "",
+		"info/project.trashinfo":      info("/home/u/src/project", "2024-05-03T12:00:00"),
+		// without a trashinfo file the original path is unknown
+		"files/orphan.pdf": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(trash, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db := New(Options{Root: root})
+	db.addToIndexRecursively(root)
+
+	line := func(date, original, name string) string {
+		deleted, _ := time.ParseInLocation(trashDateLayout, date, time.Local)
+		return trashedEntry{path: filepath.Join(trash, "files", name),
+			original: original, deleted: deleted}.line()
+	}
+	tests := []struct {
+		name     string
+		query    string
+		settings request.Settings
+		want     []string
+	}{
+		{"original_name", "report", request.Settings{}, []string{
+			line("2024-05-01T12:00:00", "/home/u/docs/report.pdf", "report.pdf"),
+			line("2024-05-02T12:00:00", "/home/u/report.pdf", "report.2.pdf"),
+		}},
+		{"below_trashed_directory", "*.md", request.Settings{}, []string{
+			line("2024-05-03T12:00:00", "/home/u/src/project/notes.md", "project/notes.md"),
+		}},
+		{"most_recent", "", request.Settings{ListAll: true, MaxResults: 1, ReverseSort: true}, []string{
+			line("2024-05-03T12:00:00", "/home/u/src/project/notes.md", "project/notes.md"),
+		}},
+		{"case_insensitive", "DOCS/REPORT", request.Settings{CaseInsensitive: true}, []string{
+			line("2024-05-01T12:00:00", "/home/u/docs/report.pdf", "report.pdf"),
+		}},
+		// the names in the trash aren't searched
+		{"trash_name", "report.2", request.Settings{}, nil},
+		{"orphan", "orphan", request.Settings{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.settings.Action = request.Trash
+			got := runRequest(db, request.Request{Version: 1, Query: tt.query,
+				Settings: tt.settings})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("trash = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/pkg/tree"
+)
+
+// subtree is an entry of the index with the number of entries at and
+// below it
+type subtree struct {
+	path    string
+	entries int
+}
+
+// line returns the subtree as sent to clients
+func (s subtree) line() string {
+	return strconv.Itoa(s.entries) + "\t" + s.path
+}
+
+// subtreeOf returns the subtree of node at path
+func subtreeOf(node *tree.Node, path string) subtree {
+	return subtree{path: path, entries: 1 + node.Count()}
+}
+
+// sendTree sends the subtrees of the entries of the directory given as
+// query, the largest first, and then the subtree of the directory. The
+// counts are kept by the tree, nothing is read from disk.
+func (db *Indexer) sendTree(req request.Request) {
+	defer close(req.ResponseChannel)
+	defer queryDuration.With(actionLabel(req.Settings.Action)).ObserveSince(time.Now())
+
+	ix, asOf := db.acquireIndex()
+	defer ix.release()
+
+	start := time.Now()
+	path := db.root
+	if req.Query != "" {
+		path = filepath.Clean(req.Query)
+	}
+	var node *tree.Node
+	e := &request.ErrorResponse{Code: request.ErrNotIndexed, Message: path + " isn't indexed"}
+	if reason, _ := db.coverage.check(path, start); reason != "" {
+		e.Message += ", it is " + reason
+	} else if found, err := ix.tree.Lookup(path); err == nil {
+		node, e = found, nil
+	}
+	if e != nil {
+		select {
+		case req.ResponseChannel <- e.Line(req.Version):
+		case <-req.Done:
+		}
+		return
+	}
+
+	subtrees := make([]subtree, 0, node.NumChildren())
+	node.VisitChildren(func(child *tree.Node) {
+		subtrees = append(subtrees, subtreeOf(child, filepath.Join(path, child.Name())))
+	})
+	sort.Slice(subtrees, func(i, j int) bool {
+		a, b := subtrees[i], subtrees[j]
+		if req.Settings.ReverseSort {
+			a, b = b, a
+		}
+		if a.entries != b.entries {
+			return a.entries > b.entries
+		}
+		return a.path < b.path
+	})
+	matches := len(subtrees)
+	if max := req.Settings.MaxResults; max > 0 && len(subtrees) > max {
+		subtrees = subtrees[:max]
+	}
+
+	for _, s := range append(subtrees, subtreeOf(node, path)) {
+		select {
+		case req.ResponseChannel <- s.line():
+		case <-req.Done:
+			return
+		}
+	}
+	duration := time.Since(start)
+	req.Logger().Debug("sent tree", "path", path, "entries", node.Count(), "duration", duration)
+	db.recordQuery(req, duration, len(subtrees))
+	sendStatus(req, matches, len(subtrees), ix, asOf)
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestTree(t *testing.T) {
+	addFilter(t, "cache")
+	fs := newFakeFS("/r/docs/a.md", "/r/docs/b.md", "/r/docs/notes/todo.md",
+		"/r/src/main.go", "/r/README", "/r/cache/x", "/r/empty/")
+	db := newFakeIndexer(fs, Options{})
+
+	tests := []struct {
+		name     string
+		query    string
+		settings request.Settings
+		want     []string
+	}{
+		{"root", "", request.Settings{},
+			[]string{"5\t/r/docs", "2\t/r/src", "1\t/r/README", "1\t/r/empty", "10\t/r"}},
+		{"directory", "/r/docs/", request.Settings{},
+			[]string{"2\t/r/docs/notes", "1\t/r/docs/a.md", "1\t/r/docs/b.md", "5\t/r/docs"}},
+		{"limited", "/r", request.Settings{MaxResults: 1}, []string{"5\t/r/docs", "10\t/r"}},
+		{"reversed", "/r/docs", request.Settings{ReverseSort: true},
+			[]string{"1\t/r/docs/b.md", "1\t/r/docs/a.md", "2\t/r/docs/notes", "5\t/r/docs"}},
+		{"empty", "/r/empty", request.Settings{}, []string{"1\t/r/empty"}},
+		{"filtered", "/r/cache", request.Settings{}, []string{request.ErrNotIndexed}},
+		{"missing", "/r/missing", request.Settings{}, []string{request.ErrNotIndexed}},
+		{"outside_root", "/other", request.Settings{}, []string{request.ErrNotIndexed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.settings.Action = request.Tree
+			lines := runRequest(db, request.Request{Version: 1, Query: tt.query, Settings: tt.settings})
+			var got []string
+			for _, line := range lines {
+				if e, ok := request.ParseError(line); ok {
+					line = e.Code
+				}
+				got = append(got, line)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tree of %q = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	// the counts follow the changes of the index
+	fs.remove("/r/docs/notes")
+	db.refreshDirectory("/r/docs")
+	lines := runRequest(db, request.Request{Query: "/r", Settings: request.Settings{Action: request.Tree}})
+	if want := []string{"3\t/r/docs", "2\t/r/src", "1\t/r/README", "1\t/r/empty", "8\t/r"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("tree after removing /r/docs/notes = %q, want %q", lines, want)
+	}
+	if got := db.currentStats().IndexedEntries; got != 7 {
+		t.Errorf("stats count %d entries, want 7", got)
+	}
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+// minTrigramQuery is the shortest query answered from the trigram
+// index, shorter queries walk the whole trie
+const minTrigramQuery = 3
+
+// trigramIndex maps the trigrams of the lowercased names in the trie
+// to the names containing them. Names are numbered in the order they
+// are added, so the posting lists stay sorted by appending.
+type trigramIndex struct {
+	ids   map[string]uint32
+	names []string
+	// postings are the sorted ids of the names containing a trigram
+	postings map[uint32][]uint32
+	// deleted is the number of ids no longer in use, their
+	// names are empty
+	deleted int
+}
+
+func newTrigramIndex() *trigramIndex {
+	return &trigramIndex{
+		ids:      make(map[string]uint32),
+		postings: make(map[uint32][]uint32),
+	}
+}
+
+// forEachTrigram calls f for the distinct trigrams of s
+func forEachTrigram(s string, f func(trigram uint32)) {
+	s = strings.ToLower(s)
+	// names are short, so a linear search for duplicates
+	// beats allocating a set
+	var buf [64]uint32
+	seen := buf[:0]
+next:
+	for i := 0; i+3 <= len(s); i++ {
+		trigram := uint32(s[i])<<16 | uint32(s[i+1])<<8 | uint32(s[i+2])
+		for _, t := range seen {
+			if t == trigram {
+				continue next
+			}
+		}
+		seen = append(seen, trigram)
+		f(trigram)
+	}
+}
+
+// add makes name a candidate for the queries it contains
+func (t *trigramIndex) add(name string) {
+	if _, ok := t.ids[name]; ok {
+		return
+	}
+	id := uint32(len(t.names))
+	t.ids[name] = id
+	t.names = append(t.names, name)
+	forEachTrigram(name, func(trigram uint32) {
+		t.postings[trigram] = append(t.postings[trigram], id)
+	})
+}
+
+// remove drops name. Its id stays in the posting lists until the
+// index is compacted, removing it from long lists would be slow.
+func (t *trigramIndex) remove(name string) {
+	id, ok := t.ids[name]
+	if !ok {
+		return
+	}
+	delete(t.ids, name)
+	t.names[id] = ""
+	t.deleted++
+
+	if t.deleted > 1024 && t.deleted > len(t.names)/2 {
+		t.compact()
+	}
+}
+
+// compact renumbers the names, so the deleted ones are forgotten
+func (t *trigramIndex) compact() {
+	names := t.names
+	*t = *newTrigramIndex()
+	for _, name := range names {
+		if name != "" {
+			t.add(name)
+		}
+	}
+}
+
+// candidates returns the names containing all trigrams of query,
+// a superset of the names containing query. ok is false if query
+// is too short to be looked up or isn't valid UTF-8. Lowercasing
+// replaces a partial character of such a query, so its trigrams
+// aren't those of the names containing it.
+func (t *trigramIndex) candidates(query string) (names []string, ok bool) {
+	if len(query) < minTrigramQuery || !utf8.ValidString(query) {
+		return nil, false
+	}
+
+	var lists [][]uint32
+	missing := false
+	forEachTrigram(query, func(trigram uint32) {
+		list, found := t.postings[trigram]
+		missing = missing || !found
+		lists = append(lists, list)
+	})
+	if missing {
+		return nil, true
+	}
+
+	// intersecting starts with the shortest list, so the intermediate
+	// results stay small
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	ids := lists[0]
+	for _, list := range lists[1:] {
+		ids = intersect(ids, list)
+		if len(ids) == 0 {
+			return nil, true
+		}
+	}
+
+	names = make([]string, 0, len(ids))
+	for _, id := range ids {
+		if name := t.names[id]; name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, true
+}
+
+// visitTrigramCandidates calls visitor for the names in the trie
+// containing query. It returns false if query is too short for
+// the trigram index.
+func (ix *index) visitTrigramCandidates(query string, caseInsensitive bool,
+	visitor trie.VisitorFunc) bool {
+	names, ok := ix.trigrams.candidates(query)
+	if !ok {
+		return false
+	}
+
+	if caseInsensitive {
+		query = strings.ToLower(query)
+	}
+	for _, name := range names {
+		matched := name
+		if caseInsensitive {
+			matched = strings.ToLower(name)
+		}
+		if !strings.Contains(matched, query) {
+			continue
+		}
+
+		prefix := trie.Prefix(name)
+		item := ix.trie.Get(prefix)
+		if item == nil {
+			// the trigram index is out of step with the trie, which
+			// is a bug, but a search must not take the server down
+			slog.Warn("trigram index lists a name missing from the trie", "name", name)
+			continue
+		}
+		if err := visitor(prefix, item); err != nil {
+			break
+		}
+	}
+	return true
+}
+
+// visitContaining calls visitor for the names in the trie containing
+// query, like visitTrigramCandidates does without the trigram index.
+// The substring walk of the trie visits the names below a match more
+// than once, so all names are filtered instead.
+func (ix *index) visitContaining(query string, caseInsensitive bool,
+	visitor trie.VisitorFunc) {
+	if caseInsensitive {
+		query = strings.ToLower(query)
+	}
+	ix.trie.Visit(func(prefix trie.Prefix, item trie.Item) error {
+		name := string(prefix)
+		if caseInsensitive {
+			name = strings.ToLower(name)
+		}
+		if !strings.Contains(name, query) {
+			return nil
+		}
+		return visitor(prefix, item)
+	})
+}
+
+// intersect returns the ids in both sorted lists
+func intersect(a, b []uint32) []uint32 {
+	result := make([]uint32, 0, len(a))
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
@@ -0,0 +1,219 @@
+package database
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+func TestTrigramIndex_Candidates(t *testing.T) {
+	index := newTrigramIndex()
+	for _, name := range []string{"report.txt", "Reports", "export.go", "main.go", "aaaa", "abc-bcd"} {
+		index.add(name)
+	}
+	index.remove("export.go")
+
+	tests := []struct {
+		name   string
+		query  string
+		want   []string
+		wantOk bool
+	}{
+		{"short", "re", nil, false},
+		{"shared_trigrams", "port", []string{"report.txt", "Reports"}, true},
+		{"case_insensitive", "REP", []string{"report.txt", "Reports"}, true},
+		{"removed", "xpo", nil, true},
+		{"unknown_trigram", "zzz", nil, true},
+		// a superset, the order of the trigrams isn't checked
+		{"reordered", "abcd", []string{"abc-bcd"}, true},
+		{"repeated_trigram", "aaaa", []string{"aaaa"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := index.candidates(tt.query)
+			if len(got) == 0 && len(tt.want) == 0 {
+				got = tt.want
+			}
+			if ok != tt.wantOk || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("candidates(%q) = %v, %v, want %v, %v",
+					tt.query, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestTrigramIndex_Compact(t *testing.T) {
+	index := newTrigramIndex()
+	const size = 3000
+	for i := 0; i < size; i++ {
+		index.add(fmt.Sprintf("file%d.txt", i))
+	}
+	for i := 0; i < size; i++ {
+		if i%3 != 0 {
+			index.remove(fmt.Sprintf("file%d.txt", i))
+		}
+	}
+
+	if len(index.names) >= size {
+		t.Errorf("index has %d names after removing two thirds, want it compacted",
+			len(index.names))
+	}
+	got, _ := index.candidates("file299")
+	sort.Strings(got)
+	want := []string{"file2991.txt", "file2994.txt", "file2997.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("candidates after compacting = %v, want %v", got, want)
+	}
+}
+
+func TestSubStringSearch_Trigrams(t *testing.T) {
+	db := newSyntheticIndexer(5000)
+
+	for _, query := range []string{"port", "Port", "ain.g", "src", "zzzz", "e.t"} {
+		for _, caseInsensitive := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/%v", query, caseInsensitive), func(t *testing.T) {
+				var want []string
+				db.currentIndex().visitContaining(query, caseInsensitive,
+					func(prefix trie.Prefix, item trie.Item) error {
+						for _, file := range entriesOf(item).entries {
+							want = append(want, file.pathNode.GetPath())
+						}
+						return nil
+					})
+
+				req := request.Request{
+					Query: query,
+					Settings: request.Settings{Action: request.SubStringSearch,
+						CaseInsensitive: caseInsensitive},
+					ResponseChannel: make(chan string),
+					Done:            make(chan struct{}),
+				}
+				go db.queryIndex(req)
+				var got []string
+				for result := range req.ResponseChannel {
+					got = append(got, result)
+				}
+
+				sort.Strings(got)
+				sort.Strings(want)
+				if strings.Join(got, "\n") != strings.Join(want, "\n") {
+					t.Errorf("found %d results, the trie walk found %d", len(got), len(want))
+				}
+			})
+		}
+	}
+}
+
+func TestVisitTrigramCandidates_Missing(t *testing.T) {
+	ix := &index{trie: trie.NewTrie(), trigrams: newTrigramIndex()}
+	ix.trigrams.add("report.txt")
+	ix.trigrams.add("reports")
+	ix.trie.Insert(trie.Prefix("reports"), newEntryList(indexedFile{}))
+
+	var visited []string
+	ix.visitTrigramCandidates("report", false, func(prefix trie.Prefix, item trie.Item) error {
+		visited = append(visited, string(prefix))
+		return nil
+	})
+	if want := []string{"reports"}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("visited %q, want %q", visited, want)
+	}
+}
+
+// trigramsInStep fails if the names in the trigram index
+// of ix aren't the keys of its trie
+func trigramsInStep(t *testing.T, ix *index) {
+	t.Helper()
+	keys := make(map[string]bool)
+	ix.trie.Visit(func(prefix trie.Prefix, item trie.Item) error {
+		keys[string(prefix)] = true
+		if _, ok := ix.trigrams.ids[string(prefix)]; !ok {
+			t.Errorf("%q is missing from the trigram index", prefix)
+		}
+		return nil
+	})
+	for name := range ix.trigrams.ids {
+		if !keys[name] {
+			t.Errorf("the trigram index lists %q, the trie doesn't", name)
+		}
+	}
+}
+
+func TestTrigramIndex_InStep(t *testing.T) {
+	// names shared by directories and prefixes of each other
+	names := []string{"rep", "report", "report.txt", "Report.TXT", "reports", "x"}
+	fs := newFakeFS("/r/a/b/", "/r/c/")
+	db := newFakeIndexer(fs, Options{})
+	db.enableSnapshots()
+	r := rand.New(rand.NewSource(1))
+
+	for step := 0; step < 3000; step++ {
+		var dirs []string
+		for dir := range fs.dirs {
+			if dir == "/r" || strings.HasPrefix(dir, "/r/") {
+				dirs = append(dirs, dir)
+			}
+		}
+		sort.Strings(dirs)
+		dir := dirs[r.Intn(len(dirs))]
+		path := filepath.Join(dir, names[r.Intn(len(names))])
+
+		db.beginWrite()
+		switch n := r.Intn(100); {
+		case n < 40:
+			fs.add(path)
+			db.refreshDirectory(dir)
+		case n < 55:
+			fs.add(path + "/")
+			db.refreshDirectory(dir)
+		case n < 95:
+			if dir != "/r" {
+				path = dir
+			}
+			fs.remove(path)
+			db.refreshDirectory(filepath.Dir(path))
+		case n < 98:
+			db.reconcile()
+			finishRescans(db)
+		default:
+			db.resetIndex()
+			db.initialIndex()
+		}
+		db.publish()
+
+		trigramsInStep(t, db.currentIndex())
+		trigramsInStep(t, db.snapshots.published)
+		if t.Failed() {
+			t.Fatalf("out of step after step %d", step)
+		}
+	}
+}
+
+func BenchmarkTrigramIndex(b *testing.B) {
+	for _, size := range benchmarkSizes(b) {
+		entries := syntheticEntries(size)
+		b.Run(sizeName(size), func(b *testing.B) {
+			var before, after runtime.MemStats
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				index := newTrigramIndex()
+				for _, entry := range entries {
+					index.add(entry.name)
+				}
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				runtime.KeepAlive(index)
+			}
+			b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/(1<<20), "MiB")
+		})
+	}
+}
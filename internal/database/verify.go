@@ -0,0 +1,97 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// sortedResults are results changed after sorting them,
+// like by verifyExisting
+type sortedResults []string
+
+func (r sortedResults) Len() int           { return len(r) }
+func (r sortedResults) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r sortedResults) Less(i, j int) bool { return false }
+func (r sortedResults) Result(index int) string {
+	return r[index]
+}
+
+// verifyExisting stats the sorted results in the order they are sent
+// until MaxResults of them exist, and drops the ones that vanished.
+// It stats limit results at most, unverified is set if it stopped
+// there with results left to send.
+func (db *Indexer) verifyExisting(results resulter, settings request.Settings,
+	limit int) (_ resulter, vanished []string, unverified bool) {
+	n := results.Len()
+	want := settings.MaxResults
+	if want == 0 || want > n {
+		want = n
+	}
+	exists := make([]bool, n)
+	for i := range exists {
+		exists[i] = true
+	}
+
+	found := 0
+	for k := 0; k < n && found < want; k++ {
+		i := n - 1 - k
+		if settings.ReverseSort {
+			i = k
+		}
+		if k == limit {
+			unverified = true
+			break
+		}
+		path := results.Result(i)
+		if _, err := db.fs.Lstat(path); os.IsNotExist(err) {
+			exists[i] = false
+			vanished = append(vanished, path)
+			continue
+		}
+		found++
+	}
+	if len(vanished) == 0 {
+		return results, nil, unverified
+	}
+
+	left := make(sortedResults, 0, n-len(vanished))
+	for i := 0; i < n; i++ {
+		if exists[i] {
+			left = append(left, results.Result(i))
+		}
+	}
+	return left, vanished, unverified
+}
+
+// refreshVanished has the goroutine of Start read the directories
+// of the vanished results again, so the index catches up with the
+// changes it missed
+func (db *Indexer) refreshVanished(vanished []string) {
+	directories := make(map[string]bool)
+	for _, path := range vanished {
+		dir := filepath.Dir(path)
+		if directories[dir] {
+			continue
+		}
+		directories[dir] = true
+		select {
+		case db.vanishedSignal <- dir:
+		default:
+			// the directories are read once the
+			// events that were missed arrive
+		}
+	}
+}
+
+func vanishedWarning(vanished int) request.Warning {
+	return request.Warning{Code: request.WarnVanished,
+		Message: fmt.Sprintf("%d results vanished since they were indexed", vanished)}
+}
+
+func notVerifiedWarning(limit int) request.Warning {
+	return request.Warning{Code: request.WarnNotVerified,
+		Message: fmt.Sprintf("stopped verifying the results after %d, the rest may have vanished", limit)}
+}
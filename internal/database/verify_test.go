@@ -0,0 +1,89 @@
+package database
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestVerifyExisting(t *testing.T) {
+	results := resultList{"/r/a", "/r/b", "/r/c", "/r/d"}
+	tests := []struct {
+		name           string
+		paths          []string
+		settings       request.Settings
+		limit          int
+		want           []string
+		wantVanished   []string
+		wantUnverified bool
+	}{
+		{"all_exist", []string{"/r/a", "/r/b", "/r/c", "/r/d"}, request.Settings{}, 10,
+			[]string{"/r/a", "/r/b", "/r/c", "/r/d"}, nil, false},
+		// stat'ed in the order they are sent, the last first
+		{"vanished", []string{"/r/a", "/r/c"}, request.Settings{}, 10,
+			[]string{"/r/a", "/r/c"}, []string{"/r/d", "/r/b"}, false},
+		{"result_limit", []string{"/r/a", "/r/c"}, request.Settings{MaxResults: 1}, 10,
+			[]string{"/r/a", "/r/b", "/r/c"}, []string{"/r/d"}, false},
+		{"reverse", []string{"/r/a", "/r/c"}, request.Settings{MaxResults: 1, ReverseSort: true}, 10,
+			[]string{"/r/a", "/r/b", "/r/c", "/r/d"}, nil, false},
+		{"stat_limit", []string{"/r/a", "/r/c"}, request.Settings{}, 1,
+			[]string{"/r/a", "/r/b", "/r/c"}, []string{"/r/d"}, true},
+		{"disabled", []string{"/r/a"}, request.Settings{}, 0,
+			[]string{"/r/a", "/r/b", "/r/c", "/r/d"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := New(Options{Root: "/r"})
+			db.fs = newFakeFS(tt.paths...)
+			verified, vanished, unverified := db.verifyExisting(results, tt.settings, tt.limit)
+
+			var got []string
+			for i := 0; i < verified.Len(); i++ {
+				got = append(got, verified.Result(i))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(vanished, tt.wantVanished) {
+				t.Errorf("got vanished %q, want %q", vanished, tt.wantVanished)
+			}
+			if unverified != tt.wantUnverified {
+				t.Errorf("got unverified %v, want %v", unverified, tt.wantUnverified)
+			}
+		})
+	}
+}
+
+func TestQueryIndex_VerifyExists(t *testing.T) {
+	fs := newFakeFS("/r/docs/report.md", "/r/docs/report.txt", "/r/old/report.pdf")
+	db := newFakeIndexer(fs, Options{})
+	fs.remove("/r/docs/report.txt")
+	fs.remove("/r/old/report.pdf")
+
+	lines := runRequest(db, request.Request{Version: 1, Query: "report",
+		Features: []string{request.FeatureWarnings},
+		Settings: request.Settings{Action: request.PrefixSearch, VerifyExists: true}})
+	if len(lines) != 2 || lines[0] != "/r/docs/report.md" {
+		t.Fatalf("got %q, want the existing result and a warning", lines)
+	}
+	if w, ok := request.ParseWarning(lines[1]); !ok || w.Code != request.WarnVanished {
+		t.Errorf("got %q, want a %s warning", lines[1], request.WarnVanished)
+	}
+
+	var refreshed []string
+	for len(db.vanishedSignal) > 0 {
+		dir := <-db.vanishedSignal
+		refreshed = append(refreshed, dir)
+		db.refreshDirectory(dir)
+	}
+	sort.Strings(refreshed)
+	if want := []string{"/r/docs", "/r/old"}; !reflect.DeepEqual(refreshed, want) {
+		t.Errorf("got directories %q to refresh, want %q", refreshed, want)
+	}
+	if got := runQuery(db, request.PrefixSearch, "report", 0); !reflect.DeepEqual(got,
+		[]string{"/r/docs/report.md"}) {
+		t.Errorf("got %q after refreshing, want the existing result only", got)
+	}
+}
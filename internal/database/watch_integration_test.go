@@ -0,0 +1,232 @@
+//go:build integration
+
+package database
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/internal/watch"
+	"golang.org/x/sys/unix"
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+// Run as root, e.g. in a privileged container, with
+//
+//	go test -tags integration ./internal/database -run Watcher
+//
+// The watcher marks a tmpfs mounted for the test, so the events of
+// the rest of the system don't interfere.
+
+// convergence is how long the index may take to catch up
+// with a storm of changes
+const convergence = 10 * time.Second
+
+// mountTmpfs mounts a tmpfs for the test, it skips the test
+// if that isn't possible
+func mountTmpfs(t *testing.T) string {
+	if os.Geteuid() != 0 {
+		t.Skip("mounting a tmpfs and fanotify need root")
+	}
+	dir := t.TempDir()
+	if err := unix.Mount("tmpfs", dir, "tmpfs", 0, "size=256m"); err != nil {
+		t.Skip("couldn't mount a tmpfs:", err)
+	}
+	t.Cleanup(func() { unix.Unmount(dir, unix.MNT_DETACH) })
+	return dir
+}
+
+// diskPaths returns the paths below root
+func diskPaths(t *testing.T, root string) []string {
+	var paths []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if path != root {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// indexPaths returns the indexed paths below root and whether they
+// could be read yet. There is no Check action listing them, and
+// ChangedSince stats every entry, which hides the stale ones, so the
+// copy of the index published for the queries is read like a query
+// reads it.
+func indexPaths(db *Indexer, root string) ([]string, bool) {
+	if !db.snapshotsEnabled() {
+		// still building the index
+		return nil, false
+	}
+	ix, _ := db.acquireIndex()
+	defer ix.release()
+
+	var paths []string
+	ix.trie.Visit(func(prefix trie.Prefix, item trie.Item) error {
+		for _, file := range entriesOf(item).entries {
+			if path := file.pathNode.GetPath(); strings.HasPrefix(path, root+"/") {
+				paths = append(paths, path)
+			}
+		}
+		return nil
+	})
+	sort.Strings(paths)
+	return paths, true
+}
+
+// awaitConvergence fails the test if the index doesn't match
+// the filesystem below root in time
+func awaitConvergence(t *testing.T, db *Indexer, root string) {
+	t.Helper()
+	deadline := time.Now().Add(convergence)
+	for {
+		want := diskPaths(t, root)
+		got, ok := indexPaths(db, root)
+		added, removed := sliceDifference(want, got)
+		if ok && len(added) == 0 && len(removed) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			sort.Strings(added)
+			sort.Strings(removed)
+			t.Fatalf("the index didn't converge within %s, %d paths are missing: %s\n"+
+				"%d paths are stale: %s", convergence, len(added), sample(added),
+				len(removed), sample(removed))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// sample returns the first paths of a long list
+func sample(paths []string) string {
+	if len(paths) > 10 {
+		return strings.Join(paths[:10], ", ") + ", ..."
+	}
+	return strings.Join(paths, ", ")
+}
+
+func TestWatcher_Fanotify(t *testing.T) {
+	root := mountTmpfs(t)
+	w, err := watch.Open(watch.Options{Backend: watch.Fanotify, Roots: []string{root}})
+	if err != nil {
+		t.Skip("fanotify isn't available:", err)
+	}
+
+	// the watcher can't be stopped, it blocks once the
+	// Indexer stops reading
+	changes := make(chan watch.FileChange, 100)
+	go w.Watch(changes)
+	requests := make(chan request.Request)
+	done := make(chan struct{})
+	// the index is read on the published copy while changes are applied
+	db := New(Options{Root: root, SnapshotQueries: true})
+	go func() {
+		defer close(done)
+		db.Run(changes, requests)
+	}()
+	defer func() {
+		close(requests)
+		<-done
+	}()
+
+	rng := rand.New(rand.NewSource(1))
+	path := func(parts ...string) string {
+		return filepath.Join(append([]string{root}, parts...)...)
+	}
+	create := func(path string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	storms := []struct {
+		name  string
+		storm func()
+	}{
+		{"create", func() {
+			for i := 0; i < 2000; i++ {
+				create(path(fmt.Sprintf("dir%d", i%20), fmt.Sprintf("file%d", i)))
+			}
+		}},
+		{"mkdir_p", func() {
+			for i := 0; i < 200; i++ {
+				deep := path(fmt.Sprintf("deep%d", i%10), "a", "b", "c", "d", "e", "f", fmt.Sprint(i))
+				if err := os.MkdirAll(deep, 0755); err != nil {
+					t.Fatal(err)
+				}
+				create(filepath.Join(deep, "leaf"))
+			}
+		}},
+		{"rename", func() {
+			for i := 0; i < 10; i++ {
+				if err := os.Rename(path(fmt.Sprintf("dir%d", i)), path(fmt.Sprintf("moved%d", i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 500; i++ {
+				dir := path(fmt.Sprintf("dir%d", 10+i%10))
+				old := filepath.Join(dir, fmt.Sprintf("file%d", 10+i%10+20*(i/10)))
+				if err := os.Rename(old, old+".renamed"); err != nil && !os.IsNotExist(err) {
+					t.Fatal(err)
+				}
+			}
+		}},
+		{"delete", func() {
+			for i := 0; i < 10; i += 2 {
+				if err := os.RemoveAll(path(fmt.Sprintf("deep%d", i))); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.RemoveAll(path(fmt.Sprintf("moved%d", i), "file"+fmt.Sprint(i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.RemoveAll(path("deep1", "a", "b", "c")); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"mixed", func() {
+			for i := 0; i < 3000; i++ {
+				dir := path(fmt.Sprintf("mixed%d", rng.Intn(5)), fmt.Sprintf("sub%d", rng.Intn(5)))
+				name := filepath.Join(dir, fmt.Sprintf("f%d", rng.Intn(50)))
+				switch rng.Intn(4) {
+				case 0, 1:
+					create(name)
+				case 2:
+					os.Remove(name)
+				case 3:
+					if rng.Intn(10) == 0 {
+						os.RemoveAll(dir)
+					} else {
+						os.Rename(name, filepath.Join(dir, fmt.Sprintf("f%d", rng.Intn(50))))
+					}
+				}
+			}
+		}},
+	}
+	for _, s := range storms {
+		t.Run(s.name, func(t *testing.T) {
+			s.storm()
+			awaitConvergence(t, db, root)
+		})
+	}
+}
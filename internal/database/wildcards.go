@@ -0,0 +1,116 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	trie "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
+)
+
+// wildcardQuery is the query of a search with Settings.Wildcards
+type wildcardQuery struct {
+	// pattern is what the names have to match, lower case if
+	// the search is case-insensitive
+	pattern string
+	// leading is the literal text before the first wildcard, longest
+	// the longest literal text between wildcards, without escapes
+	leading, longest string
+}
+
+// usesWildcards returns whether the query of req is matched as a
+// pattern, a query without wildcards or escapes is matched as usual
+func usesWildcards(req request.Request) bool {
+	return req.Settings.Wildcards && strings.ContainsAny(req.Query, `*?[\`)
+}
+
+// parseWildcards splits the query of req at its wildcards. Substring
+// searches match the names containing a match of the query, prefix
+// searches the names starting with one.
+func parseWildcards(req request.Request) wildcardQuery {
+	query := req.Query
+	var runs []string
+	var run strings.Builder
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; c {
+		case '\\':
+			if i++; i < len(query) {
+				run.WriteByte(query[i])
+			}
+		case '*', '?', '[':
+			runs = append(runs, run.String())
+			run.Reset()
+			if c == '[' {
+				i = endOfClass(query, i)
+			}
+		default:
+			run.WriteByte(c)
+		}
+	}
+	runs = append(runs, run.String())
+
+	w := wildcardQuery{pattern: query + "*", leading: runs[0]}
+	if req.Settings.Action == request.SubStringSearch {
+		w.pattern = "*" + w.pattern
+	}
+	if req.Settings.CaseInsensitive {
+		w.pattern = strings.ToLower(w.pattern)
+	}
+	for _, run := range runs {
+		if len(run) > len(w.longest) {
+			w.longest = run
+		}
+	}
+	return w
+}
+
+// endOfClass returns the index of the ] ending the character class
+// starting at query[start], like filepath.Match finds it
+func endOfClass(query string, start int) int {
+	i := start + 1
+	if i < len(query) && query[i] == '^' {
+		i++
+	}
+	for first := true; i < len(query); i, first = i+1, false {
+		switch query[i] {
+		case ']':
+			if !first {
+				return i
+			}
+		case '\\':
+			i++
+		}
+	}
+	return len(query)
+}
+
+// wildcardSearch returns the entries of ix whose names match the
+// query of req as a pattern. Only the names starting with the leading
+// literal text or containing the longest one are matched against it.
+func (ix *index) wildcardSearch(req request.Request, filter *entryFilter) resulter {
+	w := parseWildcards(req)
+	caseInsensitive := req.Settings.CaseInsensitive
+	results := byLength{}
+	visitor := func(prefix trie.Prefix, item trie.Item) error {
+		if isCancelled(req) {
+			return errCancelled
+		}
+		if !matchesPattern(w.pattern, string(prefix), caseInsensitive) {
+			return nil
+		}
+		entriesOf(item).forEach(func(file indexedFile) bool {
+			if filter.matches(file, 0) {
+				results = append(results, file.pathNode.GetPath())
+			}
+			return true
+		})
+		return nil
+	}
+	switch {
+	case req.Settings.Action == request.PrefixSearch && !caseInsensitive && w.leading != "":
+		ix.trie.VisitSubtree(trie.Prefix(w.leading), visitor)
+	case ix.visitTrigramCandidates(w.longest, caseInsensitive, visitor):
+	default:
+		ix.visitContaining(w.longest, caseInsensitive, visitor)
+	}
+	return results
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+func TestParseWildcards(t *testing.T) {
+	tests := []struct {
+		query            string
+		action           int
+		pattern          string
+		leading, longest string
+	}{
+		{"report*2019", request.SubStringSearch, "*report*2019*", "report", "report"},
+		{"a?bcd", request.PrefixSearch, "a?bcd*", "a", "bcd"},
+		{"[]x]yz", request.PrefixSearch, "[]x]yz*", "", "yz"},
+		{"[^ab]c", request.SubStringSearch, "*[^ab]c*", "", "c"},
+		{`a\*bc*`, request.SubStringSearch, `*a\*bc**`, "a*bc", "a*bc"},
+	}
+	for _, tt := range tests {
+		w := parseWildcards(request.Request{Query: tt.query,
+			Settings: request.Settings{Action: tt.action, Wildcards: true}})
+		want := wildcardQuery{tt.pattern, tt.leading, tt.longest}
+		if w != want {
+			t.Errorf("parseWildcards(%q) = %+v, want %+v", tt.query, w, want)
+		}
+	}
+}
+
+func TestQueryIndex_Wildcards(t *testing.T) {
+	db := newFakeIndexer(newFakeFS("/r/IMG_0012.jpg", "/r/IMG_1012.jpeg", "/r/img_0013.tiff",
+		"/r/notes[1].txt", "/r/notes1.txt"), Options{})
+	tests := []struct {
+		name     string
+		query    string
+		settings request.Settings
+		want     []string
+	}{
+		{"question_mark", "IMG_?012", request.Settings{}, []string{"/r/IMG_1012.jpeg", "/r/IMG_0012.jpg"}},
+		{"class", "IMG_[0]01", request.Settings{}, []string{"/r/IMG_0012.jpg"}},
+		{"star", "0*.tiff", request.Settings{}, []string{"/r/img_0013.tiff"}},
+		{"case_insensitive", "img_00?[23]", request.Settings{CaseInsensitive: true},
+			[]string{"/r/img_0013.tiff", "/r/IMG_0012.jpg"}},
+		{"prefix", "IMG_?0", request.Settings{Action: request.PrefixSearch},
+			[]string{"/r/IMG_1012.jpeg", "/r/IMG_0012.jpg"}},
+		// a prefix search matches at the start of the names only
+		{"prefix_anchored", "?012", request.Settings{Action: request.PrefixSearch}, nil},
+		{"escaped", `notes\[1]`, request.Settings{}, []string{"/r/notes[1].txt"}},
+		// without wildcards, brackets match themselves
+		{"literal", "notes[1]", request.Settings{Wildcards: false}, []string{"/r/notes[1].txt"}},
+		{"invalid", "notes[1", request.Settings{}, []string{"error: invalid pattern notes[1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.settings.Wildcards = tt.name != "literal"
+			got := runRequest(db, request.Request{Query: tt.query, Settings: tt.settings})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
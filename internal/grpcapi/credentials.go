@@ -0,0 +1,47 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"google.golang.org/grpc/credentials"
+)
+
+// peerCredentials are transport credentials reading the credentials
+// of the peer of a unix domain socket. They don't secure the connection.
+type peerCredentials struct{}
+
+type authInfo struct {
+	credentials.CommonAuthInfo
+	cred *request.Credentials
+}
+
+func (authInfo) AuthType() string {
+	return "peercred"
+}
+
+func (peerCredentials) ServerHandshake(c net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	cred, err := request.PeerCredentials(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, authInfo{cred: cred}, nil
+}
+
+func (peerCredentials) ClientHandshake(_ context.Context, _ string,
+	c net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c, authInfo{}, nil
+}
+
+func (peerCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "peercred"}
+}
+
+func (c peerCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (peerCredentials) OverrideServerName(string) error {
+	return nil
+}
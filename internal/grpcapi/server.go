@@ -0,0 +1,213 @@
+// Package grpcapi serves the gRPC API defined in pkg/api
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"os"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/pkg/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var actions = map[api.Action]int{
+	api.Action_SUBSTRING: request.SubStringSearch,
+	api.Action_PREFIX:    request.PrefixSearch,
+	api.Action_FUZZY:     request.FuzzySearch,
+	api.Action_PATH:      request.PathSearch,
+}
+
+// ListenAndServe serves the gRPC API on the unix domain socket
+// at options.Path, passing requests on to requestReceiver
+func ListenAndServe(requestReceiver chan<- request.Request, options request.SocketOptions) {
+	l, err := request.ListenUnix(options)
+	if err != nil {
+		slog.Error("couldn't listen", "socket", options.Path, "err", err)
+		os.Exit(1)
+	}
+
+	Serve(l, requestReceiver, options)
+}
+
+// Serve serves the gRPC API on l, which was created by request.ListenUnix
+func Serve(l net.Listener, requestReceiver chan<- request.Request, options request.SocketOptions) {
+	policy, err := request.NewAccessPolicy(options)
+	if err != nil {
+		slog.Error("invalid access policy", "err", err)
+		os.Exit(1)
+	}
+
+	err = NewServer(requestReceiver, policy).Serve(l)
+	slog.Error("gRPC server failed", "err", err)
+	os.Exit(1)
+}
+
+// NewServer returns a gRPC server handling the Gosearch service.
+// Connections have to come from unix domain sockets, the credentials
+// of the peer are checked against policy.
+func NewServer(requestReceiver chan<- request.Request, policy *request.AccessPolicy) *grpc.Server {
+	s := grpc.NewServer(grpc.Creds(peerCredentials{}))
+	api.RegisterGosearchServer(s, &server{
+		requestReceiver: requestReceiver,
+		policy:          policy,
+	})
+	return s
+}
+
+type server struct {
+	api.UnimplementedGosearchServer
+	requestReceiver chan<- request.Request
+	policy          *request.AccessPolicy
+}
+
+// authorize returns the key of the peer for the query limits
+// if it may use action
+func (s *server) authorize(ctx context.Context, action int) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if ok {
+		if info, ok := p.AuthInfo.(authInfo); ok &&
+			s.policy.Authorize(info.cred, action) {
+			return request.PeerKey(info.cred), nil
+		}
+	}
+	return "", status.Error(codes.PermissionDenied, "permission denied")
+}
+
+// dispatch passes req on to the database, the deadline of ctx
+// cancels the request
+func (s *server) dispatch(ctx context.Context, req request.Request, write func(string) error) error {
+	key, err := s.authorize(ctx, req.Settings.Action)
+	if err != nil {
+		return err
+	}
+	req.Peer = key
+
+	if request.IsQuery(req.Settings.Action) {
+		release, err := request.AcquireQuery(ctx, key)
+		if e, ok := err.(request.ErrorResponse); ok {
+			return status.Error(codes.ResourceExhausted, e.Message)
+		} else if err != nil {
+			return status.FromContextError(err).Err()
+		}
+		defer release()
+	}
+
+	// versioned requests get errors as ErrorResponse lines
+	req.Version = request.ProtocolVersion
+	err = request.Dispatch(ctx, s.requestReceiver, req, func(line string) error {
+		if e, ok := request.ParseError(line); ok {
+			return status.Error(errorCode(e.Code), e.Message)
+		}
+		return write(line)
+	})
+	if err != nil && err == ctx.Err() {
+		return status.FromContextError(err).Err()
+	}
+	return err
+}
+
+func (s *server) Search(in *api.SearchRequest, stream api.Gosearch_SearchServer) error {
+	action, ok := actions[in.Action]
+	if !ok {
+		return status.Errorf(codes.InvalidArgument, "unknown action %v", in.Action)
+	}
+
+	req := request.Request{Query: in.Query}
+	req.Settings = request.Settings{
+		Action:          action,
+		MaxResults:      int(in.MaxResults),
+		NoSort:          in.NoSort,
+		ReverseSort:     in.ReverseSort,
+		CaseInsensitive: in.CaseInsensitive,
+		// only the matches of fuzzy searches have scores
+		Scores: action == request.FuzzySearch,
+	}
+
+	return s.dispatch(stream.Context(), req, func(line string) error {
+		result := &api.SearchResult{Path: line}
+		if path, score, ok := request.ParseScore(line); ok {
+			result.Path, result.Score = path, score
+		}
+		if in.WithMetadata {
+			result.Metadata = metadata(result.Path)
+		}
+		return stream.Send(result)
+	})
+}
+
+// metadata returns the metadata of path, or nil if the file is gone
+func metadata(path string) *api.Metadata {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil
+	}
+	return &api.Metadata{
+		IsDir: info.IsDir(),
+		Size:  info.Size(),
+		Mtime: info.ModTime().Unix(),
+		Mode:  uint32(info.Mode()),
+	}
+}
+
+func (s *server) Stats(ctx context.Context, in *api.StatsRequest) (*api.StatsResponse, error) {
+	req := request.Request{}
+	req.Settings.Action = request.Stats
+
+	var stats request.StatsResponse
+	err := s.dispatch(ctx, req, func(line string) error {
+		return json.Unmarshal([]byte(line), &stats)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.StatsResponse{
+		IndexedFiles:       stats.IndexedFiles,
+		IndexedDirectories: stats.IndexedDirectories,
+		IndexDuration:      stats.IndexDuration,
+		FilterRejections:   stats.FilterRejections,
+	}, nil
+}
+
+func (s *server) Reindex(ctx context.Context, in *api.ReindexRequest) (*api.ReindexResponse, error) {
+	req := request.Request{}
+	req.Settings.Action = request.IndexRefresh
+
+	err := s.dispatch(ctx, req, func(string) error { return nil })
+	if err != nil {
+		return nil, err
+	}
+	return &api.ReindexResponse{}, nil
+}
+
+func (s *server) Refresh(ctx context.Context, in *api.RefreshRequest) (*api.RefreshResponse, error) {
+	req := request.Request{Query: in.Path}
+	req.Settings.Action = request.RefreshPath
+
+	err := s.dispatch(ctx, req, func(string) error { return nil })
+	if err != nil {
+		return nil, err
+	}
+	return &api.RefreshResponse{}, nil
+}
+
+// errorCode returns the gRPC code of an ErrorResponse code
+func errorCode(code string) codes.Code {
+	switch code {
+	case request.ErrPermissionDenied, request.ErrPolicy:
+		return codes.PermissionDenied
+	case request.ErrBusy:
+		return codes.ResourceExhausted
+	case request.ErrNotIndexed, request.ErrNotFound:
+		return codes.NotFound
+	case request.ErrInternal:
+		return codes.Internal
+	}
+	return codes.InvalidArgument
+}
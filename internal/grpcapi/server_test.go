@@ -0,0 +1,175 @@
+package grpcapi
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/pkg/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// startServer serves the API on a temporary socket and returns a client
+func startServer(t *testing.T, requests chan request.Request) api.GosearchClient {
+	dir, err := ioutil.TempDir("", "gosearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "grpc.sock")
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := request.NewAccessPolicy(request.SocketOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(requests, policy)
+	go s.Serve(l)
+
+	conn, err := grpc.Dial("unix://"+socket, grpc.WithTransportCredentials(peerCredentials{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+		s.Stop()
+		os.RemoveAll(dir)
+	})
+	return api.NewGosearchClient(conn)
+}
+
+func TestSearch(t *testing.T) {
+	requests := make(chan request.Request)
+	client := startServer(t, requests)
+
+	go func() {
+		req := <-requests
+		if req.Query != "foo" || req.Settings.Action != request.FuzzySearch ||
+			req.Settings.MaxResults != 2 || !req.Settings.Scores {
+			t.Errorf("got request %+v", req)
+		}
+		req.ResponseChannel <- request.ScoreLine("/", 0.5)
+		req.ResponseChannel <- request.ScoreLine("/a/f_oo", 0.75)
+		close(req.ResponseChannel)
+	}()
+
+	stream, err := client.Search(context.Background(), &api.SearchRequest{
+		Query:        "foo",
+		Action:       api.Action_FUZZY,
+		MaxResults:   2,
+		WithMetadata: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var results []*api.SearchResult
+	for {
+		result, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if results[0].Path != "/" || results[0].Score != 0.5 ||
+		results[0].Metadata == nil || !results[0].Metadata.IsDir {
+		t.Errorf("first result = %v", results[0])
+	}
+	if results[1].Path != "/a/f_oo" || results[1].Score != 0.75 ||
+		results[1].Metadata != nil {
+		t.Errorf("second result = %v", results[1])
+	}
+}
+
+func TestSearch_Deadline(t *testing.T) {
+	requests := make(chan request.Request)
+	client := startServer(t, requests)
+
+	cancelled := make(chan struct{})
+	go func() {
+		req := <-requests
+		// a slow query, it has to notice the deadline
+		<-req.Done
+		close(req.ResponseChannel)
+		close(cancelled)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stream, err := client.Search(ctx, &api.SearchRequest{Query: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Recv() error = %v, want DeadlineExceeded", err)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("the query wasn't cancelled")
+	}
+}
+
+func TestSearch_Rejected(t *testing.T) {
+	requests := make(chan request.Request)
+	client := startServer(t, requests)
+
+	go func() {
+		req := <-requests
+		e := request.ErrorResponse{Code: request.ErrNotIndexed, Message: "/srv isn't indexed"}
+		select {
+		case req.ResponseChannel <- e.Line(req.Version):
+		case <-req.Done:
+		}
+		close(req.ResponseChannel)
+	}()
+
+	stream, err := client.Search(context.Background(), &api.SearchRequest{Query: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	if status.Code(err) != codes.NotFound || status.Convert(err).Message() != "/srv isn't indexed" {
+		t.Errorf("Recv() error = %v, want NotFound", err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	requests := make(chan request.Request)
+	client := startServer(t, requests)
+
+	go func() {
+		req := <-requests
+		req.ResponseChannel <- `{"indexed_files":3,"indexed_directories":2,` +
+			`"index_duration":1.5,"filter_rejections":{"glob":4}}`
+		close(req.ResponseChannel)
+	}()
+
+	stats, err := client.Stats(context.Background(), &api.StatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.IndexedFiles != 3 || stats.IndexedDirectories != 2 ||
+		stats.FilterRejections["glob"] != 4 {
+		t.Errorf("Stats() = %v", stats)
+	}
+}
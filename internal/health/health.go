@@ -0,0 +1,222 @@
+// Package health tracks the conditions that make the index
+// incomplete or outdated and rates them
+package health
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// State rates the health of the server
+type State string
+
+// States in ascending severity
+const (
+	OK       State = "ok"
+	Indexing State = "indexing"
+	Degraded State = "degraded"
+	Stale    State = "stale"
+)
+
+var severities = map[State]int{OK: 0, Indexing: 1, Degraded: 2, Stale: 3}
+
+// ExitCode maps the state to the exit codes of monitoring plugins:
+// 0 is ok, 1 a warning and 2 critical
+func (s State) ExitCode() int {
+	switch s {
+	case OK:
+		return 0
+	case Indexing, Degraded:
+		return 1
+	}
+	return 2
+}
+
+// Snapshot holds the conditions the state is derived from
+type Snapshot struct {
+	Now time.Time
+	// Indexing is set during a full index
+	Indexing bool
+	// Prioritized is set once a full index is done with the
+	// directories indexed first
+	Prioritized bool
+	// Watching is set if filesystem events are received
+	Watching bool
+	// Paused is set while events aren't applied to the index
+	Paused bool
+	// LastOverflow is when the event queue last overflowed
+	LastOverflow time.Time
+	// LastRefresh is when the index was last brought up to date
+	LastRefresh time.Time
+	// Backlog is the number of events waiting to be applied
+	Backlog int
+	// HeapBytes is the heap memory in use
+	HeapBytes uint64
+}
+
+// Limits are the thresholds of Evaluate
+type Limits struct {
+	// OverflowWindow is how long an overflow degrades the health
+	OverflowWindow time.Duration
+	// RefreshOverdue is how long events may wait to be applied
+	RefreshOverdue time.Duration
+	// MemoryBudget is the heap size the server may use, 0 means unlimited
+	MemoryBudget uint64
+}
+
+// DefaultLimits are the limits used unless configured otherwise
+var DefaultLimits = Limits{
+	OverflowWindow: 10 * time.Minute,
+	RefreshOverdue: 5 * time.Minute,
+}
+
+// Evaluate returns the state for the conditions of s and the reasons
+// for it, the state is the most severe one of all reasons
+func Evaluate(s Snapshot, limits Limits) (State, []string) {
+	state := OK
+	reasons := []string{}
+	report := func(reasonState State, format string, a ...interface{}) {
+		if severities[reasonState] > severities[state] {
+			state = reasonState
+		}
+		reasons = append(reasons, fmt.Sprintf(format, a...))
+	}
+
+	if s.Indexing && s.Prioritized {
+		report(Indexing, "full index running, priority directories done")
+	} else if s.Indexing {
+		report(Indexing, "full index running")
+	}
+	if !s.Watching && !s.Indexing {
+		report(Degraded, "filesystem events aren't watched")
+	}
+	if !s.LastOverflow.IsZero() && s.Now.Sub(s.LastOverflow) < limits.OverflowWindow {
+		report(Degraded, "event queue overflowed %s ago",
+			s.Now.Sub(s.LastOverflow).Round(time.Second))
+	}
+	if limits.MemoryBudget > 0 && s.HeapBytes > limits.MemoryBudget {
+		report(Degraded, "using %d MiB of memory, budget is %d MiB",
+			s.HeapBytes>>20, limits.MemoryBudget>>20)
+	}
+	if s.Paused {
+		report(Stale, "applying events is paused")
+	} else if !s.Indexing && s.Backlog > 0 &&
+		s.Now.Sub(s.LastRefresh) > limits.RefreshOverdue {
+		report(Stale, "%d events waiting, last refresh %s ago", s.Backlog,
+			s.Now.Sub(s.LastRefresh).Round(time.Second))
+	}
+
+	sort.Strings(reasons)
+	return state, reasons
+}
+
+// the conditions of the running server, updated by the indexer and
+// the watcher. Updates are atomic, they happen on hot paths.
+var (
+	indexing     int32
+	prioritized  int32
+	paused       int32
+	lastOverflow int64
+	lastRefresh  int64
+)
+
+var sources struct {
+	sync.Mutex
+	backlog  func() int
+	watching func() bool
+	limits   Limits
+}
+
+func init() {
+	sources.limits = DefaultLimits
+}
+
+// SetIndexing marks the start and the end of a full index
+func SetIndexing(running bool) {
+	atomic.StoreInt32(&prioritized, 0)
+	atomic.StoreInt32(&indexing, boolToInt(running))
+	if !running {
+		Refreshed()
+	}
+}
+
+// SetPrioritized records that the running full index is done with
+// the directories indexed first
+func SetPrioritized() {
+	atomic.StoreInt32(&prioritized, 1)
+}
+
+// SetPaused marks pausing and resuming
+func SetPaused(p bool) {
+	atomic.StoreInt32(&paused, boolToInt(p))
+}
+
+// Overflowed records an overflow of the event queue
+func Overflowed() {
+	atomic.StoreInt64(&lastOverflow, time.Now().UnixNano())
+}
+
+// Refreshed records that the index was brought up to date
+func Refreshed() {
+	atomic.StoreInt64(&lastRefresh, time.Now().UnixNano())
+}
+
+// SetSources sets the functions returning the number of events
+// waiting to be applied and whether events are watched
+func SetSources(backlog func() int, watching func() bool) {
+	sources.Lock()
+	defer sources.Unlock()
+	sources.backlog = backlog
+	sources.watching = watching
+}
+
+// SetMemoryBudget sets the heap size the server may use
+func SetMemoryBudget(bytes uint64) {
+	sources.Lock()
+	defer sources.Unlock()
+	sources.limits.MemoryBudget = bytes
+}
+
+// Check evaluates the current conditions of the server
+func Check() (State, []string) {
+	s := Snapshot{
+		Now:         time.Now(),
+		Indexing:    atomic.LoadInt32(&indexing) == 1,
+		Prioritized: atomic.LoadInt32(&prioritized) == 1,
+		Paused:      atomic.LoadInt32(&paused) == 1,
+	}
+	if t := atomic.LoadInt64(&lastOverflow); t != 0 {
+		s.LastOverflow = time.Unix(0, t)
+	}
+	if t := atomic.LoadInt64(&lastRefresh); t != 0 {
+		s.LastRefresh = time.Unix(0, t)
+	}
+
+	sources.Lock()
+	limits := sources.limits
+	if sources.backlog != nil {
+		s.Backlog = sources.backlog()
+	}
+	// the server is still starting up without sources
+	s.Watching = sources.watching == nil || sources.watching()
+	sources.Unlock()
+
+	if limits.MemoryBudget > 0 {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		s.HeapBytes = m.HeapAlloc
+	}
+
+	return Evaluate(s, limits)
+}
+
+func boolToInt(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,145 @@
+package health
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	limits := Limits{
+		OverflowWindow: 10 * time.Minute,
+		RefreshOverdue: 5 * time.Minute,
+		MemoryBudget:   100 << 20,
+	}
+	healthy := Snapshot{Now: now, Watching: true, LastRefresh: now.Add(-time.Hour)}
+
+	tests := []struct {
+		name        string
+		modify      func(s *Snapshot)
+		want        State
+		wantReasons []string
+	}{
+		{"ok", func(s *Snapshot) {}, OK, []string{}},
+		{
+			"indexing",
+			func(s *Snapshot) { s.Indexing, s.Watching, s.Backlog = true, false, 1000 },
+			Indexing,
+			[]string{"full index running"},
+		},
+		{
+			"indexing_prioritized",
+			func(s *Snapshot) { s.Indexing, s.Prioritized = true, true },
+			Indexing,
+			[]string{"full index running, priority directories done"},
+		},
+		{
+			"not_watching",
+			func(s *Snapshot) { s.Watching = false },
+			Degraded,
+			[]string{"filesystem events aren't watched"},
+		},
+		{
+			"recent_overflow",
+			func(s *Snapshot) { s.LastOverflow = now.Add(-3 * time.Minute) },
+			Degraded,
+			[]string{"event queue overflowed 3m0s ago"},
+		},
+		{
+			"old_overflow",
+			func(s *Snapshot) { s.LastOverflow = now.Add(-time.Hour) },
+			OK,
+			[]string{},
+		},
+		{
+			"memory_budget",
+			func(s *Snapshot) { s.HeapBytes = 150 << 20 },
+			Degraded,
+			[]string{"using 150 MiB of memory, budget is 100 MiB"},
+		},
+		{
+			"backlog_recent_refresh",
+			func(s *Snapshot) { s.Backlog, s.LastRefresh = 20, now.Add(-time.Minute) },
+			OK,
+			[]string{},
+		},
+		{
+			"refresh_overdue",
+			func(s *Snapshot) { s.Backlog = 20 },
+			Stale,
+			[]string{"20 events waiting, last refresh 1h0m0s ago"},
+		},
+		{
+			"paused",
+			func(s *Snapshot) { s.Paused = true },
+			Stale,
+			[]string{"applying events is paused"},
+		},
+		{
+			"most_severe_wins",
+			func(s *Snapshot) {
+				s.Indexing = true
+				s.LastOverflow = now.Add(-time.Minute)
+				s.Paused = true
+			},
+			Stale,
+			[]string{"applying events is paused", "event queue overflowed 1m0s ago",
+				"full index running"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := healthy
+			tt.modify(&s)
+			got, reasons := Evaluate(s, limits)
+			if got != tt.want || !reflect.DeepEqual(reasons, tt.wantReasons) {
+				t.Errorf("Evaluate() = %s, %q, want %s, %q",
+					got, reasons, tt.want, tt.wantReasons)
+			}
+		})
+	}
+}
+
+func TestState_ExitCode(t *testing.T) {
+	tests := []struct {
+		state State
+		want  int
+	}{
+		{OK, 0},
+		{Indexing, 1},
+		{Degraded, 1},
+		{Stale, 2},
+		{State("unknown"), 2},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.state), func(t *testing.T) {
+			if got := tt.state.ExitCode(); got != tt.want {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	backlog := 0
+	SetSources(func() int { return backlog }, func() bool { return true })
+	defer SetSources(nil, nil)
+
+	SetIndexing(true)
+	if state, _ := Check(); state != Indexing {
+		t.Errorf("Check() during index = %s, want %s", state, Indexing)
+	}
+
+	SetIndexing(false)
+	backlog = 5
+	if state, reasons := Check(); state != OK {
+		t.Errorf("Check() after index = %s %q, want %s", state, reasons, OK)
+	}
+
+	SetPaused(true)
+	defer SetPaused(false)
+	if state, _ := Check(); state != Stale {
+		t.Errorf("Check() while paused = %s, want %s", state, Stale)
+	}
+}
@@ -0,0 +1,317 @@
+// Package httpapi serves queries over HTTP, for browser extensions
+// and other machines on the network
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// Options configures the HTTP listener
+type Options struct {
+	// Address is the host:port to listen on
+	Address string
+	// Token is the bearer token clients have to send, no
+	// authentication is done if it is empty. The configuration only
+	// allows that on a loopback address.
+	Token string
+}
+
+var actions = map[string]int{
+	"":          request.SubStringSearch,
+	"substring": request.SubStringSearch,
+	"prefix":    request.PrefixSearch,
+	"fuzzy":     request.FuzzySearch,
+	"path":      request.PathSearch,
+	"segments":  request.SegmentSearch,
+}
+
+// ListenAndServe serves HTTP requests, passing them on
+// to requestReceiver like request.ListenAndServe
+func ListenAndServe(requestReceiver chan<- request.Request, options Options) {
+	if options.Token == "" {
+		slog.Warn("the HTTP listener has no token configured, "+
+			"every local user can query the index", "address", options.Address)
+	}
+
+	err := http.ListenAndServe(options.Address, NewHandler(requestReceiver, options))
+	slog.Error("HTTP server failed", "address", options.Address, "err", err)
+	os.Exit(1)
+}
+
+// NewHandler returns the handler of the HTTP API
+func NewHandler(requestReceiver chan<- request.Request, options Options) http.Handler {
+	s := server{requestReceiver, options}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search", s.search)
+	mux.HandleFunc("/stats", s.stats)
+	mux.HandleFunc("/reindex", s.reindex)
+
+	return s.sameMachine(s.authenticate(mux))
+}
+
+type server struct {
+	requestReceiver chan<- request.Request
+	options         Options
+}
+
+// sameMachine rejects the requests a web page can make a browser send
+// to a loopback listener: those from other origins and, against DNS
+// rebinding, those for other host names. Browser extensions have
+// origins of their own schemes and may send requests.
+func (s server) sameMachine(next http.Handler) http.Handler {
+	host, _, err := net.SplitHostPort(s.options.Address)
+	if err != nil || !isLoopback(host) {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if !isLoopback(hostname(r.Host)) || !allowedOrigin(origin) {
+			slog.Warn("denied HTTP request from another site", "remote", r.RemoteAddr,
+				"host", r.Host, "origin", origin)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedOrigin returns whether a request with the Origin header
+// origin may reach a loopback listener
+func allowedOrigin(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return isLoopback(u.Hostname())
+	case "":
+		// "null", sent by sandboxed pages and local files
+		return false
+	}
+	return true
+}
+
+// hostname returns the host of a Host header, without the port
+func hostname(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return strings.Trim(hostport, "[]")
+}
+
+// isLoopback returns whether host names the local machine
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.options.Token != "" {
+			expected := []byte("Bearer " + s.options.Token)
+			got := []byte(r.Header.Get("Authorization"))
+			if subtle.ConstantTimeCompare(got, expected) != 1 {
+				slog.Warn("denied HTTP request", "remote", r.RemoteAddr)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s server) search(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	action, ok := actions[query.Get("action")]
+	if !ok {
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+
+	// versioned requests get errors as ErrorResponse lines,
+	// nothing else is sent without features
+	req := request.Request{Version: request.ProtocolVersion, Query: query.Get("q"),
+		RequestID: r.Header.Get("X-Request-Id")}
+	if e := req.AssignID(); e != nil {
+		http.Error(w, e.Message, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("X-Request-Id", req.RequestID)
+	req.Settings.Action = action
+	req.Settings.CaseInsensitive = query.Get("case_insensitive") == "true"
+	req.Settings.ReverseSort = query.Get("reverse") == "true"
+	req.Settings.NoSort = query.Get("nosort") == "true"
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		req.Settings.MaxResults = n
+	}
+	req.Settings.Scores = query.Get("scores") == "true"
+	if minScore := query.Get("min_score"); minScore != "" {
+		f, err := strconv.ParseFloat(minScore, 64)
+		if err != nil {
+			http.Error(w, "invalid min_score", http.StatusBadRequest)
+			return
+		}
+		req.Settings.MinScore = f
+	}
+
+	req.Peer = remoteKey(r)
+	release, err := request.AcquireQuery(r.Context(), req.Peer)
+	if e, ok := err.(request.ErrorResponse); ok {
+		http.Error(w, e.Message, http.StatusTooManyRequests)
+		return
+	} else if err != nil {
+		return
+	}
+	defer release()
+
+	asArray := query.Get("format") == "array"
+	if asArray {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+
+	// results are written as they arrive, net/http sends them
+	// chunked once its buffer fills up
+	out := bufio.NewWriter(w)
+	encoder := json.NewEncoder(out)
+	first := true
+	if asArray {
+		out.WriteString("[")
+	}
+
+	var rejected *request.ErrorResponse
+	s.do(r.Context(), req, func(line string) error {
+		if e, ok := request.ParseError(line); ok {
+			// sent instead of the results, before anything was flushed
+			rejected = &e
+			return nil
+		}
+		if asArray {
+			if !first {
+				out.WriteString(",")
+			}
+			first = false
+		}
+		result := struct {
+			Path  string   `json:"path"`
+			Score *float64 `json:"score,omitempty"`
+		}{Path: line}
+		if path, score, ok := request.ParseScore(line); ok {
+			result.Path, result.Score = path, &score
+		}
+		return encoder.Encode(result)
+	})
+	if rejected != nil {
+		http.Error(w, rejected.Message, errorStatus(rejected.Code))
+		return
+	}
+
+	if asArray {
+		out.WriteString("]\n")
+	}
+	out.Flush()
+}
+
+// errorStatus returns the HTTP status of an ErrorResponse code
+func errorStatus(code string) int {
+	switch code {
+	case request.ErrPermissionDenied, request.ErrPolicy:
+		return http.StatusForbidden
+	case request.ErrBusy:
+		return http.StatusTooManyRequests
+	case request.ErrNotIndexed, request.ErrNotFound:
+		return http.StatusNotFound
+	case request.ErrInternal:
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+func (s server) stats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req := request.Request{}
+	req.Settings.Action = request.Stats
+
+	w.Header().Set("Content-Type", "application/json")
+	s.do(r.Context(), req, func(line string) error {
+		_, err := w.Write([]byte(line + "\n"))
+		return err
+	})
+}
+
+func (s server) reindex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// the access policy keeps reindexing to root and the admin group,
+	// without a token anyone on the machine could send it
+	if s.options.Token == "" {
+		slog.Warn("denied HTTP reindex without a token", "remote", r.RemoteAddr)
+		http.Error(w, "reindexing needs an http_token", http.StatusForbidden)
+		return
+	}
+
+	req := request.Request{}
+	req.Settings.Action = request.IndexRefresh
+
+	w.WriteHeader(http.StatusAccepted)
+	s.do(r.Context(), req, func(line string) error {
+		_, err := w.Write([]byte(line + "\n"))
+		return err
+	})
+}
+
+// remoteKey returns the key of the client for the query limits,
+// clients are told apart by their address
+func remoteKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "http:" + host
+}
+
+// do passes req on to the database, see request.Dispatch
+func (s server) do(ctx context.Context, req request.Request, write func(string) error) {
+	err := request.Dispatch(ctx, s.requestReceiver, req, write)
+	if err != nil && err != ctx.Err() {
+		slog.Warn("failed to write HTTP response", "err", err)
+	}
+}
@@ -0,0 +1,196 @@
+package httpapi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// fakeDatabase answers every request with the given lines
+func fakeDatabase(lines ...string) chan request.Request {
+	requests := make(chan request.Request)
+	go func() {
+		for req := range requests {
+			for _, line := range lines {
+				select {
+				case req.ResponseChannel <- line:
+				case <-req.Done:
+				}
+			}
+			close(req.ResponseChannel)
+		}
+	}()
+	return requests
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		token      string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			"json_lines",
+			"GET", "/search?q=foo&action=fuzzy&limit=2", "secret",
+			http.StatusOK,
+			"{\"path\":\"/a/foo\"}\n{\"path\":\"/b/foo\"}\n",
+		},
+		{
+			"json_array",
+			"GET", "/search?q=foo&format=array", "secret",
+			http.StatusOK,
+			"[{\"path\":\"/a/foo\"}\n,{\"path\":\"/b/foo\"}\n]\n",
+		},
+		{
+			"unknown_action",
+			"GET", "/search?q=foo&action=magic", "secret",
+			http.StatusBadRequest,
+			"unknown action\n",
+		},
+		{
+			"invalid_min_score",
+			"GET", "/search?q=foo&action=fuzzy&min_score=half", "secret",
+			http.StatusBadRequest,
+			"invalid min_score\n",
+		},
+		{
+			"wrong_token",
+			"GET", "/search?q=foo", "guess",
+			http.StatusUnauthorized,
+			"unauthorized\n",
+		},
+		{
+			"reindex_get",
+			"GET", "/reindex", "secret",
+			http.StatusMethodNotAllowed,
+			"method not allowed\n",
+		},
+	}
+
+	handler := NewHandler(fakeDatabase("/a/foo", "/b/foo"), Options{Token: "secret"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.url, nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			body, _ := ioutil.ReadAll(w.Body)
+			if w.Code != tt.wantStatus || string(body) != tt.wantBody {
+				t.Errorf("got %d %q, want %d %q",
+					w.Code, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandler_SameMachine(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		host       string
+		origin     string
+		wantStatus int
+	}{
+		{"local", "GET", "/stats", "127.0.0.1:7700", "", http.StatusOK},
+		{"localhost", "GET", "/stats", "localhost:7700", "http://localhost:3000", http.StatusOK},
+		{"extension", "GET", "/stats", "127.0.0.1:7700", "moz-extension://1234", http.StatusOK},
+		{"web_page", "POST", "/reindex", "127.0.0.1:7700", "https://example.com", http.StatusForbidden},
+		{"sandboxed_page", "GET", "/stats", "127.0.0.1:7700", "null", http.StatusForbidden},
+		{"rebound_host", "GET", "/stats", "attacker.example:7700", "", http.StatusForbidden},
+		{"reindex_without_token", "POST", "/reindex", "127.0.0.1:7700", "", http.StatusForbidden},
+	}
+	handler := NewHandler(fakeDatabase("{}"), Options{Address: "127.0.0.1:7700"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.url, nil)
+			r.Host = tt.host
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("got %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandler_Rejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       string
+		wantStatus int
+	}{
+		{"query_too_short", request.ErrQueryTooShort, http.StatusBadRequest},
+		{"busy", request.ErrBusy, http.StatusTooManyRequests},
+		{"not_indexed", request.ErrNotIndexed, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := request.ErrorResponse{Code: tt.code, Message: "rejected"}
+			handler := NewHandler(fakeDatabase(e.Line(request.ProtocolVersion)), Options{})
+			r := httptest.NewRequest("GET", "/search?q=f&format=array", nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			body, _ := ioutil.ReadAll(w.Body)
+			if w.Code != tt.wantStatus || string(body) != "rejected\n" {
+				t.Errorf("got %d %q, want %d %q", w.Code, body, tt.wantStatus, "rejected\n")
+			}
+		})
+	}
+}
+
+func TestHandler_Settings(t *testing.T) {
+	requests := make(chan request.Request, 1)
+	handler := NewHandler(requests, Options{})
+
+	go func() {
+		req := <-requests
+		close(req.ResponseChannel)
+		requests <- req
+	}()
+
+	r := httptest.NewRequest("GET",
+		"/search?q=foo&action=prefix&limit=100&case_insensitive=true", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	req := <-requests
+	if req.Query != "foo" || req.Settings.Action != request.PrefixSearch ||
+		req.Settings.MaxResults != 100 || !req.Settings.CaseInsensitive {
+		t.Errorf("got request %+v", req)
+	}
+}
+
+func TestHandler_Scores(t *testing.T) {
+	requests := make(chan request.Request, 1)
+	handler := NewHandler(requests, Options{})
+	go func() {
+		req := <-requests
+		req.ResponseChannel <- request.ScoreLine("/a/foo", 0.75)
+		close(req.ResponseChannel)
+		requests <- req
+	}()
+
+	r := httptest.NewRequest("GET", "/search?q=foo&action=fuzzy&min_score=0.5&scores=true", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	req := <-requests
+	if req.Settings.MinScore != 0.5 || !req.Settings.Scores {
+		t.Errorf("got request %+v", req)
+	}
+	body, _ := ioutil.ReadAll(w.Body)
+	if want := "{\"path\":\"/a/foo\",\"score\":0.75}\n"; string(body) != want {
+		t.Errorf("got %q, want %q", body, want)
+	}
+}
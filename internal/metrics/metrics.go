@@ -0,0 +1,288 @@
+// Package metrics collects counters, gauges and histograms of the
+// server and serves them in the Prometheus text format. Updating
+// a metric is a single atomic operation, so it's cheap enough for
+// the hot paths of the indexer.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// namespace prefixes the names of all metrics
+const namespace = "gosearch_"
+
+type metric interface {
+	write(w io.Writer, name string)
+}
+
+var registry = struct {
+	sync.Mutex
+	metrics map[string]metric
+	help    map[string]string
+	types   map[string]string
+}{
+	metrics: make(map[string]metric),
+	help:    make(map[string]string),
+	types:   make(map[string]string),
+}
+
+func register(name, metricType, help string, m metric) {
+	registry.Lock()
+	defer registry.Unlock()
+	name = namespace + name
+	if _, ok := registry.metrics[name]; ok {
+		panic("metric registered twice: " + name)
+	}
+	registry.metrics[name] = m
+	registry.help[name] = help
+	registry.types[name] = metricType
+}
+
+// Counter is a value that only increases
+type Counter struct {
+	value uint64
+}
+
+// NewCounter registers a counter
+func NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	register(name, "counter", help, c)
+	return c
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+// Add increments the counter by n
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.value, n)
+}
+
+// Value returns the current value of the counter
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+func (c *Counter) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %d\n", name, atomic.LoadUint64(&c.value))
+}
+
+// CounterVec is a set of counters told apart by the value of a label.
+// The label values have to be known in advance.
+type CounterVec struct {
+	label    string
+	counters map[string]*Counter
+}
+
+// NewCounterVec registers a counter for each of values
+func NewCounterVec(name, help, label string, values ...string) *CounterVec {
+	v := &CounterVec{label: label, counters: make(map[string]*Counter, len(values))}
+	for _, value := range values {
+		v.counters[value] = &Counter{}
+	}
+	register(name, "counter", help, v)
+	return v
+}
+
+// With returns the counter of the label value, which has
+// to be one of the values the vector was created with
+func (v *CounterVec) With(value string) *Counter {
+	return v.counters[value]
+}
+
+func (v *CounterVec) write(w io.Writer, name string) {
+	for _, value := range sortedKeys(v.counters) {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, v.label, value,
+			atomic.LoadUint64(&v.counters[value].value))
+	}
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	value int64
+}
+
+// NewGauge registers a gauge
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{}
+	register(name, "gauge", help, g)
+	return g
+}
+
+// Set sets the gauge to n
+func (g *Gauge) Set(n int64) {
+	atomic.StoreInt64(&g.value, n)
+}
+
+// Add adds n to the gauge, n may be negative
+func (g *Gauge) Add(n int64) {
+	atomic.AddInt64(&g.value, n)
+}
+
+func (g *Gauge) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %d\n", name, atomic.LoadInt64(&g.value))
+}
+
+// gaugeFunc is a gauge whose value is computed on every scrape
+type gaugeFunc func() float64
+
+// NewGaugeFunc registers a gauge whose value is returned by f.
+// f is called from the goroutine serving the metrics.
+func NewGaugeFunc(name, help string, f func() float64) {
+	register(name, "gauge", help, gaugeFunc(f))
+}
+
+func (f gaugeFunc) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(f()))
+}
+
+// Histogram counts observations in buckets
+type Histogram struct {
+	// bounds are the upper bounds of the buckets, in ascending order
+	bounds []float64
+	// counts holds a counter per bucket, the last one counts
+	// the observations above all bounds
+	counts []uint64
+	count  uint64
+	// sumBits holds the bits of the float64 sum
+	sumBits uint64
+}
+
+// DurationBuckets are the bucket bounds used for durations in seconds,
+// from a tenth of a millisecond to ten seconds
+var DurationBuckets = []float64{
+	.0001, .0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 10,
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+// NewHistogram registers a histogram with the given bucket bounds
+func NewHistogram(name, help string, bounds []float64) *Histogram {
+	h := newHistogram(bounds)
+	register(name, "histogram", help, h)
+	return h
+}
+
+// Observe adds an observation
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	for {
+		old := atomic.LoadUint64(&h.sumBits)
+		sum := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&h.sumBits, old, sum) {
+			return
+		}
+	}
+}
+
+// ObserveSince adds the time passed since start in seconds
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (h *Histogram) write(w io.Writer, name string) {
+	h.writeLabeled(w, name, "")
+}
+
+// writeLabeled writes the histogram, labels are prepended
+// to the le label of the buckets
+func (h *Histogram) writeLabeled(w io.Writer, name, labels string) {
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		fmt.Fprintf(w, "%s_bucket{%sle=%q} %d\n", name, labels, formatFloat(bound), cumulative)
+	}
+	cumulative += atomic.LoadUint64(&h.counts[len(h.bounds)])
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, cumulative)
+
+	sum := math.Float64frombits(atomic.LoadUint64(&h.sumBits))
+	if labels != "" {
+		labels = "{" + labels[:len(labels)-1] + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, atomic.LoadUint64(&h.count))
+}
+
+// HistogramVec is a set of histograms told apart by the value
+// of a label. The label values have to be known in advance.
+type HistogramVec struct {
+	label      string
+	histograms map[string]*Histogram
+}
+
+// NewHistogramVec registers a histogram for each of values
+func NewHistogramVec(name, help string, bounds []float64,
+	label string, values ...string) *HistogramVec {
+	v := &HistogramVec{label: label, histograms: make(map[string]*Histogram, len(values))}
+	for _, value := range values {
+		v.histograms[value] = newHistogram(bounds)
+	}
+	register(name, "histogram", help, v)
+	return v
+}
+
+// With returns the histogram of the label value, which has
+// to be one of the values the vector was created with
+func (v *HistogramVec) With(value string) *Histogram {
+	return v.histograms[value]
+}
+
+func (v *HistogramVec) write(w io.Writer, name string) {
+	keys := make([]string, 0, len(v.histograms))
+	for key := range v.histograms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, value := range keys {
+		labels := fmt.Sprintf("%s=%q,", v.label, value)
+		v.histograms[value].writeLabeled(w, name, labels)
+	}
+}
+
+// WriteText writes all registered metrics in the Prometheus
+// text exposition format
+func WriteText(w io.Writer) {
+	registry.Lock()
+	names := make([]string, 0, len(registry.metrics))
+	for name := range registry.metrics {
+		names = append(names, name)
+	}
+	registry.Unlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		registry.Lock()
+		m, help, metricType := registry.metrics[name], registry.help[name], registry.types[name]
+		registry.Unlock()
+
+		fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+		m.write(w, name)
+	}
+}
+
+func sortedKeys(counters map[string]*Counter) []string {
+	keys := make([]string, 0, len(counters))
+	for key := range counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
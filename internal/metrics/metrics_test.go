@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	registry.metrics = make(map[string]metric)
+	registry.help = make(map[string]string)
+	registry.types = make(map[string]string)
+
+	counter := NewCounter("events_total", "Events received")
+	counter.Inc()
+	counter.Add(2)
+
+	vec := NewCounterVec("typed_total", "Events by type", "type", "create", "delete")
+	vec.With("delete").Inc()
+
+	gauge := NewGauge("queue", "Queued events")
+	gauge.Set(5)
+	gauge.Add(-2)
+
+	NewGaugeFunc("memory_bytes", "Memory in use", func() float64 { return 1.5 })
+
+	histogram := NewHistogram("duration_seconds", "Durations", []float64{0.5, 1})
+	histogram.Observe(0.25)
+	histogram.Observe(0.5)
+	histogram.Observe(3)
+
+	histograms := NewHistogramVec("query_seconds", "Query durations", []float64{1},
+		"action", "fuzzy", "prefix")
+	histograms.With("fuzzy").Observe(0.5)
+
+	var b bytes.Buffer
+	WriteText(&b)
+
+	want := strings.Join([]string{
+		"# HELP gosearch_duration_seconds Durations",
+		"# TYPE gosearch_duration_seconds histogram",
+		`gosearch_duration_seconds_bucket{le="0.5"} 2`,
+		`gosearch_duration_seconds_bucket{le="1"} 2`,
+		`gosearch_duration_seconds_bucket{le="+Inf"} 3`,
+		"gosearch_duration_seconds_sum 3.75",
+		"gosearch_duration_seconds_count 3",
+		"# HELP gosearch_events_total Events received",
+		"# TYPE gosearch_events_total counter",
+		"gosearch_events_total 3",
+		"# HELP gosearch_memory_bytes Memory in use",
+		"# TYPE gosearch_memory_bytes gauge",
+		"gosearch_memory_bytes 1.5",
+		"# HELP gosearch_query_seconds Query durations",
+		"# TYPE gosearch_query_seconds histogram",
+		`gosearch_query_seconds_bucket{action="fuzzy",le="1"} 1`,
+		`gosearch_query_seconds_bucket{action="fuzzy",le="+Inf"} 1`,
+		`gosearch_query_seconds_sum{action="fuzzy"} 0.5`,
+		`gosearch_query_seconds_count{action="fuzzy"} 1`,
+		`gosearch_query_seconds_bucket{action="prefix",le="1"} 0`,
+		`gosearch_query_seconds_bucket{action="prefix",le="+Inf"} 0`,
+		`gosearch_query_seconds_sum{action="prefix"} 0`,
+		`gosearch_query_seconds_count{action="prefix"} 0`,
+		"# HELP gosearch_queue Queued events",
+		"# TYPE gosearch_queue gauge",
+		"gosearch_queue 3",
+		"# HELP gosearch_typed_total Events by type",
+		"# TYPE gosearch_typed_total counter",
+		`gosearch_typed_total{type="create"} 0`,
+		`gosearch_typed_total{type="delete"} 1`,
+	}, "\n") + "\n"
+	if got := b.String(); got != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", got, want)
+	}
+}
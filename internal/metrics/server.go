@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// Handler serves the registered metrics
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WriteText(w)
+	})
+}
+
+// ListenAndServe serves the metrics at /metrics on address
+func ListenAndServe(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+
+	err := http.ListenAndServe(address, mux)
+	slog.Error("metrics server failed", "address", address, "err", err)
+	os.Exit(1)
+}
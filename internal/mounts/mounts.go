@@ -0,0 +1,122 @@
+package mounts
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Mount describes a single entry of the mount table
+type Mount struct {
+	// Dev is the device number of the mounted filesystem,
+	// as reported by stat in st_dev
+	Dev uint64
+	// Root is the directory of the filesystem mounted at MountPoint,
+	// "/" unless a subdirectory is bind mounted
+	Root string
+	// MountPoint is the path the filesystem is mounted at
+	MountPoint string
+	// FSType is the filesystem type, e.g. ext4 or fuse.sshfs
+	FSType string
+	// Source is the mounted device or remote location
+	Source string
+}
+
+type table struct {
+	sync.RWMutex
+	byDev       map[uint64]Mount
+	mountPoints map[string]Mount
+	// mounts are all entries in the order they were mounted
+	mounts []Mount
+}
+
+var mountTable = table{
+	byDev:       map[uint64]Mount{},
+	mountPoints: map[string]Mount{},
+}
+
+func setMounts(mounts []Mount) {
+	byDev := make(map[uint64]Mount, len(mounts))
+	mountPoints := make(map[string]Mount, len(mounts))
+	for _, m := range mounts {
+		// later entries are mounted on top of earlier ones
+		byDev[m.Dev] = m
+		mountPoints[m.MountPoint] = m
+	}
+
+	mountTable.Lock()
+	mountTable.byDev = byDev
+	mountTable.mountPoints = mountPoints
+	mountTable.mounts = mounts
+	mountTable.Unlock()
+}
+
+// IsMountPoint returns whether a filesystem is mounted at path
+func IsMountPoint(path string) bool {
+	mountTable.RLock()
+	_, ok := mountTable.mountPoints[path]
+	mountTable.RUnlock()
+	return ok
+}
+
+// All returns the entries of the mount table in the order
+// they were mounted
+func All() []Mount {
+	mountTable.RLock()
+	defer mountTable.RUnlock()
+	return append([]Mount(nil), mountTable.mounts...)
+}
+
+// IsShared returns whether the filesystem with the device number dev
+// is mounted more than once, so its directories can be reached at
+// more than one path
+func IsShared(dev uint64) bool {
+	mountTable.RLock()
+	defer mountTable.RUnlock()
+	count := 0
+	for _, m := range mountTable.mounts {
+		if m.Dev == dev {
+			count++
+		}
+	}
+	return count > 1
+}
+
+// BindSource returns the path the directory mounted at mountPoint is
+// reachable at through a mount of the same filesystem made before it,
+// ok is false if there is none. Bind mounts are mounted after their
+// source, so the source path is returned for them.
+func BindSource(mountPoint string) (source string, ok bool) {
+	mountTable.RLock()
+	defer mountTable.RUnlock()
+	m, ok := mountTable.mountPoints[mountPoint]
+	if !ok {
+		return "", false
+	}
+	for _, earlier := range mountTable.mounts {
+		if earlier.MountPoint == m.MountPoint {
+			break
+		}
+		if earlier.Dev != m.Dev {
+			continue
+		}
+		rel, ok := relativeRoot(earlier.Root, m.Root)
+		if !ok {
+			continue
+		}
+		return filepath.Join(earlier.MountPoint, rel), true
+	}
+	return "", false
+}
+
+// relativeRoot returns root relative to the directory base of the
+// same filesystem, ok is false if it isn't below base
+func relativeRoot(base, root string) (rel string, ok bool) {
+	if base == "/" || base == root {
+		return root, true
+	}
+	if strings.HasPrefix(root, base+"/") {
+		return root[len(base):], true
+	}
+	return "", false
+}
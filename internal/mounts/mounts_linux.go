@@ -0,0 +1,169 @@
+package mounts
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const mountInfoPath = "/proc/self/mountinfo"
+
+// Refresh rereads the mount table of the system
+func Refresh() error {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		return errors.Wrap(err, "can't open mountinfo")
+	}
+	defer f.Close()
+
+	mounts, err := parseMountInfo(f)
+	if err != nil {
+		return err
+	}
+
+	setMounts(mounts)
+	return nil
+}
+
+// Watch rereads the mount table whenever filesystems are mounted
+// or unmounted. It blocks, so it should be run in its own goroutine.
+func Watch() {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		slog.Error("can't watch mount table", "err", err)
+		return
+	}
+	defer f.Close()
+
+	// the file has to be read once before changes are signaled
+	if _, err := io.Copy(ioutil.Discard, f); err != nil {
+		slog.Error("can't read mountinfo", "err", err)
+		return
+	}
+
+	fds := []unix.PollFd{{Fd: int32(f.Fd()), Events: unix.POLLPRI}}
+	for {
+		_, err := unix.Poll(fds, -1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			slog.Error("polling the mount table failed", "err", err)
+			return
+		}
+
+		// the kernel signals changes with POLLERR|POLLPRI
+		if fds[0].Revents&(unix.POLLPRI|unix.POLLERR) == 0 {
+			continue
+		}
+
+		slog.Info("mount table changed")
+		if err := Refresh(); err != nil {
+			slog.Error("failed to refresh the mount table", "err", err)
+		}
+
+		// rewinding is required to rearm the notification
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			slog.Error("can't rewind mountinfo", "err", err)
+			return
+		}
+		if _, err := io.Copy(ioutil.Discard, f); err != nil {
+			slog.Error("can't read mountinfo", "err", err)
+			return
+		}
+	}
+}
+
+// FSTypeOf returns the type of the filesystem path resides on
+func FSTypeOf(path string) (string, error) {
+	var stat unix.Stat_t
+	if err := unix.Lstat(path, &stat); err != nil {
+		return "", err
+	}
+
+	mountTable.RLock()
+	m, ok := mountTable.byDev[uint64(stat.Dev)]
+	mountTable.RUnlock()
+
+	if !ok {
+		return "", errors.Errorf("no mount found for %s", path)
+	}
+	return m.FSType, nil
+}
+
+// parseMountInfo parses the format of /proc/<pid>/mountinfo,
+// described in proc(5)
+func parseMountInfo(r io.Reader) ([]Mount, error) {
+	var mounts []Mount
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		separator := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				separator = i
+				break
+			}
+		}
+		if len(fields) < 5 || separator == -1 || separator+2 >= len(fields) {
+			return nil, errors.Errorf("malformed mountinfo line %q", line)
+		}
+
+		devParts := strings.SplitN(fields[2], ":", 2)
+		if len(devParts) != 2 {
+			return nil, errors.Errorf("malformed device number in %q", line)
+		}
+		major, err := strconv.ParseUint(devParts[0], 10, 32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed device number in %q", line)
+		}
+		minor, err := strconv.ParseUint(devParts[1], 10, 32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed device number in %q", line)
+		}
+
+		mounts = append(mounts, Mount{
+			Dev:        unix.Mkdev(uint32(major), uint32(minor)),
+			Root:       unescape(fields[3]),
+			MountPoint: unescape(fields[4]),
+			FSType:     fields[separator+1],
+			Source:     unescape(fields[separator+2]),
+		})
+	}
+
+	return mounts, scanner.Err()
+}
+
+// unescape decodes the octal escapes (e.g. \040 for a space)
+// used in mountinfo
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				builder.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		builder.WriteByte(s[i])
+	}
+	return builder.String()
+}
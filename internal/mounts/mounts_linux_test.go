@@ -0,0 +1,93 @@
+package mounts
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+const testMountInfo = `22 1 259:2 / / rw,relatime shared:1 - ext4 /dev/nvme0n1p2 rw
+23 22 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:5 - proc proc rw
+45 22 0:40 / /mnt/my\040share rw,relatime shared:30 - fuse.sshfs me@host:/data rw,user_id=0
+46 22 0:41 / /tmp rw,nosuid,nodev - tmpfs tmpfs rw
+`
+
+func TestParseMountInfo(t *testing.T) {
+	got, err := parseMountInfo(strings.NewReader(testMountInfo))
+	if err != nil {
+		t.Fatalf("parseMountInfo() error = %v", err)
+	}
+
+	want := []Mount{
+		{unix.Mkdev(259, 2), "/", "/", "ext4", "/dev/nvme0n1p2"},
+		{unix.Mkdev(0, 21), "/", "/proc", "proc", "proc"},
+		{unix.Mkdev(0, 40), "/", "/mnt/my share", "fuse.sshfs", "me@host:/data"},
+		{unix.Mkdev(0, 41), "/", "/tmp", "tmpfs", "tmpfs"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMountInfo() = %v, want %v", got, want)
+	}
+}
+
+func TestParseMountInfo_Malformed(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"missing_separator", "22 1 259:2 / / rw,relatime shared:1 ext4 /dev/sda rw"},
+		{"bad_device", "22 1 259 / / rw - ext4 /dev/sda rw"},
+		{"truncated", "22 1 259:2 /"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseMountInfo(strings.NewReader(tt.line)); err == nil {
+				t.Error("parseMountInfo() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestBindSource(t *testing.T) {
+	const mountInfo = `22 1 259:2 / / rw - ext4 /dev/nvme0n1p2 rw
+30 22 259:3 / /data rw - ext4 /dev/nvme0n1p3 rw
+31 22 259:2 /srv/www /var/www rw - ext4 /dev/nvme0n1p2 rw
+32 22 259:3 /projects/gosearch /home/me/src rw - ext4 /dev/nvme0n1p3 rw
+33 22 259:3 /projects /mnt/projects rw - ext4 /dev/nvme0n1p3 rw
+34 22 0:41 / /tmp rw - tmpfs tmpfs rw
+`
+	parsed, err := parseMountInfo(strings.NewReader(mountInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setMounts(parsed)
+	defer setMounts(nil)
+
+	tests := []struct {
+		mountPoint string
+		want       string
+		wantOk     bool
+	}{
+		{"/", "", false},
+		{"/data", "", false},
+		{"/var/www", "/srv/www", true},
+		{"/home/me/src", "/data/projects/gosearch", true},
+		// the source is the first mount of the filesystem
+		{"/mnt/projects", "/data/projects", true},
+		{"/tmp", "", false},
+		{"/home", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mountPoint, func(t *testing.T) {
+			got, ok := BindSource(tt.mountPoint)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("BindSource() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+
+	if !IsShared(unix.Mkdev(259, 3)) || IsShared(unix.Mkdev(0, 41)) {
+		t.Error("IsShared() doesn't count the mounts of the filesystem")
+	}
+}
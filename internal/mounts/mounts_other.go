@@ -0,0 +1,25 @@
+//go:build !linux
+
+package mounts
+
+import (
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// errUnsupported is returned where the mount table of linux is needed
+var errUnsupported = errors.Errorf("the mount table isn't read on %s", runtime.GOOS)
+
+// Refresh fails, the mount table stays empty
+func Refresh() error {
+	return errUnsupported
+}
+
+// Watch returns right away, there are no changes to watch
+func Watch() {}
+
+// FSTypeOf fails, filesystem types aren't known
+func FSTypeOf(string) (string, error) {
+	return "", errUnsupported
+}
@@ -0,0 +1,70 @@
+// Package notify implements the sd_notify(3) protocol, so systemd
+// knows when the server is ready and whether it is still alive
+package notify
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// States understood by the service manager
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Status returns the state setting the status line of the service
+func Status(format string, a ...interface{}) string {
+	return "STATUS=" + fmt.Sprintf(format, a...)
+}
+
+// ExtendTimeout returns the state asking for d more time
+// to start up or shut down
+func ExtendTimeout(d time.Duration) string {
+	return "EXTEND_TIMEOUT_USEC=" + strconv.FormatInt(int64(d/time.Microsecond), 10)
+}
+
+// Send sends states to the service manager. Nothing is sent if the
+// server wasn't started by a service manager listening for them.
+func Send(states ...string) error {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil
+	}
+	// abstract sockets are passed with a leading @
+	if strings.HasPrefix(path, "@") {
+		path = "\x00" + path[1:]
+	}
+
+	c, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return errors.Wrap(err, "couldn't connect to the notify socket")
+	}
+	defer c.Close()
+
+	_, err = c.Write([]byte(strings.Join(states, "\n")))
+	return errors.Wrap(err, "couldn't notify the service manager")
+}
+
+// WatchdogInterval returns the interval the service manager expects
+// watchdog pings in, false if the watchdog is disabled
+func WatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" &&
+		pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+
+	return time.Duration(usec) * time.Microsecond, true
+}
@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "notify.sock")
+	l, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	os.Setenv("NOTIFY_SOCKET", path)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	if err := Send(Ready, Status("indexed %d files", 3)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 256)
+	n, err := l.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "READY=1\nSTATUS=indexed 3 files"
+	if got := string(buf[:n]); got != want {
+		t.Errorf("received %q, want %q", got, want)
+	}
+}
+
+func TestSend_NoSocket(t *testing.T) {
+	os.Unsetenv("NOTIFY_SOCKET")
+	if err := Send(Ready); err != nil {
+		t.Errorf("Send() error = %v, want nil without NOTIFY_SOCKET", err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name   string
+		usec   string
+		pid    string
+		want   time.Duration
+		wantOk bool
+	}{
+		{"disabled", "", "", 0, false},
+		{"enabled", "30000000", "", 30 * time.Second, true},
+		{"own_pid", "1000", strconv.Itoa(os.Getpid()), time.Millisecond, true},
+		{"other_pid", "1000", "1", 0, false},
+		{"invalid", "soon", "", 0, false},
+	}
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("WATCHDOG_USEC", tt.usec)
+			os.Setenv("WATCHDOG_PID", tt.pid)
+			got, ok := WatchdogInterval()
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("WatchdogInterval() = %v, %v, want %v, %v",
+					got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
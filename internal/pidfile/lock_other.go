@@ -0,0 +1,16 @@
+//go:build !unix
+
+package pidfile
+
+import (
+	"os"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// tryLock fails, the lock is released by the kernel on exit only
+// with the flock of unix
+func tryLock(*os.File) (bool, error) {
+	return false, errors.Errorf("locking the pidfile isn't supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,80 @@
+// Package pidfile makes sure only one server runs at a time
+package pidfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Name is the name of the pidfile in the state directory
+const Name = "gosearch.pid"
+
+// AlreadyRunningError is returned if another process holds the pidfile
+type AlreadyRunningError struct {
+	// Pid of the other process, 0 if it couldn't be read
+	Pid int
+}
+
+func (e AlreadyRunningError) Error() string {
+	if e.Pid == 0 {
+		return "already running"
+	}
+	return fmt.Sprintf("already running (pid %d)", e.Pid)
+}
+
+// Pidfile is a locked pidfile, the lock is held until the
+// process exits or Release is called
+type Pidfile struct {
+	file *os.File
+}
+
+// Acquire creates and locks the pidfile in dir and writes the pid
+// of the process to it. The lock is released by the kernel when the
+// process exits, so pidfiles of crashed servers are taken over.
+func Acquire(dir string) (*Pidfile, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "couldn't create state directory")
+	}
+
+	path := filepath.Join(dir, Name)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't open pidfile")
+	}
+
+	locked, err := tryLock(f)
+	if err == nil && !locked {
+		defer f.Close()
+		content, _ := ioutil.ReadAll(f)
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(content)))
+		return nil, AlreadyRunningError{pid}
+	} else if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "couldn't lock pidfile")
+	}
+
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "couldn't write pidfile")
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "couldn't write pidfile")
+	}
+
+	return &Pidfile{f}, nil
+}
+
+// Release removes the pidfile and releases the lock
+func (p *Pidfile) Release() error {
+	// removing first, so no other process locks the file we remove
+	err := os.Remove(p.file.Name())
+	p.file.Close()
+	return err
+}
@@ -0,0 +1,72 @@
+package pidfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestAcquire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pidfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stateDir := filepath.Join(dir, "state")
+
+	p, err := Acquire(stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(stateDir, Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strconv.Itoa(os.Getpid()) + "\n"; string(content) != want {
+		t.Errorf("pidfile contains %q, want %q", content, want)
+	}
+
+	// flock locks belong to the open file, so a second open
+	// conflicts even within the same process
+	_, err = Acquire(stateDir)
+	if e, ok := err.(AlreadyRunningError); !ok || e.Pid != os.Getpid() {
+		t.Errorf("second Acquire() error = %v, want AlreadyRunningError", err)
+	}
+
+	if err := p.Release(); err != nil {
+		t.Fatal(err)
+	}
+	p, err = Acquire(stateDir)
+	if err != nil {
+		t.Fatalf("Acquire() after Release() error = %v", err)
+	}
+	p.Release()
+}
+
+func TestAcquire_StalePidfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pidfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a crashed server leaves its pidfile behind, but not its lock
+	path := filepath.Join(dir, Name)
+	if err := ioutil.WriteFile(path, []byte("123456789\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Acquire(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	content, _ := ioutil.ReadFile(path)
+	if want := strconv.Itoa(os.Getpid()) + "\n"; string(content) != want {
+		t.Errorf("pidfile contains %q, want %q", content, want)
+	}
+}
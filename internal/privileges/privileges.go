@@ -0,0 +1,48 @@
+// Package privileges switches the server to an unprivileged user
+// once the resources only root may acquire are set up
+package privileges
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// groupIDs returns the primary and supplementary groups of u
+func groupIDs(u *user.User) ([]int, error) {
+	ids, err := u.GroupIds()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't look up groups")
+	}
+	ids = append([]string{u.Gid}, ids...)
+
+	groups := make([]int, 0, len(ids))
+	for _, id := range ids {
+		gid, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid gid")
+		}
+		groups = append(groups, gid)
+	}
+	return groups, nil
+}
+
+// writable returns whether a directory with mode, owner and group
+// may be written and searched by uid and groups
+func writable(mode os.FileMode, owner, group, uid int, groups []int) bool {
+	const writeSearch = 03
+	if uid == 0 {
+		return true
+	}
+	if uid == owner {
+		return (mode>>6)&writeSearch == writeSearch
+	}
+	for _, gid := range groups {
+		if gid == group {
+			return (mode>>3)&writeSearch == writeSearch
+		}
+	}
+	return mode&writeSearch == writeSearch
+}
@@ -0,0 +1,114 @@
+package privileges
+
+import (
+	"log/slog"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Drop switches all threads of the process to the user name and its
+// groups. CAP_DAC_READ_SEARCH is kept as an ambient capability, so the
+// whole filesystem can still be indexed and fanotify's file handles
+// opened. stateDirectory has to be writable by the user, it is checked
+// before anything is changed.
+//
+// The switch relies on syscall.AllThreadsSyscall, which isn't
+// available in builds using cgo.
+func Drop(name, stateDirectory string) error {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return errors.Wrap(err, "invalid user")
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return errors.Wrap(err, "invalid uid")
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return errors.Wrap(err, "invalid gid")
+	}
+	groups, err := groupIDs(u)
+	if err != nil {
+		return err
+	}
+
+	if err := checkAccess(stateDirectory, uid, groups); err != nil {
+		return errors.Wrapf(err, "user %s can't use the state directory", name)
+	}
+
+	// capabilities are cleared by setuid unless they are kept
+	_, _, errno := syscall.AllThreadsSyscall(unix.SYS_PRCTL,
+		unix.PR_SET_KEEPCAPS, 1, 0)
+	if errno == unix.ENOTSUP {
+		return errors.New("dropping privileges isn't supported by builds using cgo")
+	} else if errno != 0 {
+		return errors.Wrap(errno, "couldn't keep capabilities")
+	}
+
+	if err := syscall.Setgroups(groups); err != nil {
+		return errors.Wrap(err, "couldn't set groups")
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return errors.Wrap(err, "couldn't set gid")
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return errors.Wrap(err, "couldn't set uid")
+	}
+
+	if err := keepDACReadSearch(); err != nil {
+		return err
+	}
+
+	slog.Info("dropped privileges", "user", name, "uid", uid, "gid", gid)
+	return nil
+}
+
+// keepDACReadSearch makes CAP_DAC_READ_SEARCH the only capability,
+// it has to be inheritable to be raised as an ambient capability
+func keepDACReadSearch() error {
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	mask := uint32(1) << unix.CAP_DAC_READ_SEARCH
+	data[0].Effective = mask
+	data[0].Permitted = mask
+	data[0].Inheritable = mask
+
+	_, _, errno := syscall.AllThreadsSyscall(unix.SYS_CAPSET,
+		uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0)
+	if errno != 0 {
+		return errors.Wrap(errno, "couldn't set capabilities")
+	}
+
+	_, _, errno = syscall.AllThreadsSyscall(unix.SYS_PRCTL, unix.PR_CAP_AMBIENT,
+		unix.PR_CAP_AMBIENT_RAISE, unix.CAP_DAC_READ_SEARCH)
+	if errno != 0 {
+		return errors.Wrap(errno, "couldn't raise ambient capability")
+	}
+	return nil
+}
+
+// checkAccess returns an error unless the user with uid and groups
+// may create and remove files in dir. CAP_DAC_READ_SEARCH doesn't
+// grant writing, so the permission bits have to.
+func checkAccess(dir string, uid int, groups []int) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errors.Errorf("couldn't read the owner of %s", dir)
+	}
+
+	if !writable(info.Mode(), int(stat.Uid), int(stat.Gid), uid, groups) {
+		return errors.Errorf("%s isn't writable, it is owned by uid %d and gid %d "+
+			"with mode %s", dir, stat.Uid, stat.Gid, info.Mode().Perm())
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package privileges
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDrop_UnwritableStateDirectory(t *testing.T) {
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("no user nobody:", err)
+	}
+	if current, err := user.Current(); err == nil && current.Uid == nobody.Uid {
+		t.Skip("running as nobody")
+	}
+
+	dir, err := ioutil.TempDir("", "privileges")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// the check fails before the process changes anything
+	err = Drop("nobody", dir)
+	if err == nil || !strings.Contains(err.Error(), "can't use the state directory") {
+		t.Fatalf("Drop() error = %v, want the state directory to be rejected", err)
+	}
+	if strconv.Itoa(os.Geteuid()) == nobody.Uid {
+		t.Error("Drop() changed the uid")
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package privileges
+
+import (
+	"os/user"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// Drop fails after checking the user, the capabilities kept by the
+// switch only exist on linux
+func Drop(name, stateDirectory string) error {
+	if _, err := user.Lookup(name); err != nil {
+		return errors.Wrap(err, "invalid user")
+	}
+	return errors.Errorf("dropping privileges isn't supported on %s", runtime.GOOS)
+}
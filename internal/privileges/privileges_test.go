@@ -0,0 +1,41 @@
+package privileges
+
+import (
+	"os"
+	"testing"
+)
+
+func TestWritable(t *testing.T) {
+	const owner, group, other = 100, 200, 300
+	tests := []struct {
+		name   string
+		mode   os.FileMode
+		uid    int
+		groups []int
+		want   bool
+	}{
+		{"owner", 0700, owner, []int{other}, true},
+		{"owner_read_only", 0500, owner, []int{group}, false},
+		{"owner_ignores_group_bits", 0570, owner, []int{group}, false},
+		{"group", 0770, other, []int{other, group}, true},
+		{"group_read_only", 0750, other, []int{group}, false},
+		{"other", 0707, other, []int{other}, true},
+		{"other_no_search", 0776, other, []int{other}, false},
+		{"state_directory_of_systemd", 0755, other, []int{other}, false},
+		{"root", 0700, 0, []int{0}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := writable(tt.mode, owner, group, tt.uid, tt.groups)
+			if got != tt.want {
+				t.Errorf("writable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDrop_UnknownUser(t *testing.T) {
+	if err := Drop("gosearch-nonexistent-user", os.TempDir()); err == nil {
+		t.Error("Drop() succeeded for an unknown user")
+	}
+}
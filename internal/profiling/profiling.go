@@ -0,0 +1,31 @@
+// Package profiling serves the runtime profiles of net/http/pprof
+package profiling
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"os"
+)
+
+// Handler serves the pprof index and profiles below /debug/pprof/.
+// The handlers are registered on their own mux, importing
+// net/http/pprof only registers them on http.DefaultServeMux.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// ListenAndServe serves the profiles on address, which should
+// only be reachable from the local machine
+func ListenAndServe(address string) {
+	slog.Info("serving runtime profiles", "address", address)
+	err := http.ListenAndServe(address, Handler())
+	slog.Error("profiling server failed", "address", address, "err", err)
+	os.Exit(1)
+}
@@ -0,0 +1,113 @@
+// Package protocol frames the responses sent over the socket for
+// clients that agreed on framing in the handshake. A frame is the
+// length of its payload as a big-endian uint32, a type byte and the
+// payload, so lines may contain newlines and NULs, and records that
+// aren't results can be told apart from them without parsing.
+package protocol
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// HeaderSize is the size of the length and the type preceding the
+// payload of a frame
+const HeaderSize = 5
+
+// MaxPayload is the largest payload a frame may carry
+const MaxPayload = 16 << 20
+
+// Frame types, readers skip the frames of types they don't know
+const (
+	// TypeLine is a response line, without a terminator
+	TypeLine byte = 1
+	// TypeMeta is a line describing the response rather than being
+	// part of it, like the hello, an error, a warning or the status
+	TypeMeta byte = 2
+	// TypeBatch is a response line to a request of a batch, the
+	// payload starts with the ID of the request as a big-endian
+	// uint32. A frame without a line ends the responses to it.
+	TypeBatch byte = 3
+)
+
+// batchIDSize is the size of the ID starting the payload of TypeBatch
+const batchIDSize = 4
+
+// ErrFrameTooLarge is returned for payloads larger than MaxPayload
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// Frame is a decoded frame
+type Frame struct {
+	Type    byte
+	Payload []byte
+}
+
+// AppendFrame appends the frame of payload to dst
+func AppendFrame(dst []byte, typ byte, payload string) ([]byte, error) {
+	if len(payload) > MaxPayload {
+		return dst, errors.Wrapf(ErrFrameTooLarge, "payload of %d bytes", len(payload))
+	}
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(payload)))
+	dst = append(dst, typ)
+	return append(dst, payload...), nil
+}
+
+// AppendBatchFrame appends the TypeBatch frame of a response line to
+// the request id of a batch to dst, an empty line ends its responses
+func AppendBatchFrame(dst []byte, id uint32, line string) ([]byte, error) {
+	if len(line) > MaxPayload-batchIDSize {
+		return dst, errors.Wrapf(ErrFrameTooLarge, "batched line of %d bytes", len(line))
+	}
+	dst = binary.BigEndian.AppendUint32(dst, uint32(batchIDSize+len(line)))
+	dst = append(dst, TypeBatch)
+	dst = binary.BigEndian.AppendUint32(dst, id)
+	return append(dst, line...), nil
+}
+
+// ParseBatch splits the payload of a TypeBatch frame into the ID of
+// the request and the line, ok is false if it is too short
+func ParseBatch(payload []byte) (id uint32, line []byte, ok bool) {
+	if len(payload) < batchIDSize {
+		return 0, nil, false
+	}
+	return binary.BigEndian.Uint32(payload), payload[batchIDSize:], true
+}
+
+// Reader decodes the frames read from an io.Reader
+type Reader struct {
+	r       io.Reader
+	header  [HeaderSize]byte
+	payload []byte
+}
+
+// NewReader returns a Reader decoding the frames read from r, which
+// should be buffered
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Next returns the next frame, its payload is only valid until the
+// next call. It returns io.EOF if the input ends between frames and
+// io.ErrUnexpectedEOF if it ends within one.
+func (r *Reader) Next() (Frame, error) {
+	if _, err := io.ReadFull(r.r, r.header[:]); err != nil {
+		return Frame{}, err
+	}
+	n := binary.BigEndian.Uint32(r.header[:4])
+	if n > MaxPayload {
+		return Frame{}, errors.Wrapf(ErrFrameTooLarge, "payload of %d bytes", n)
+	}
+	if cap(r.payload) < int(n) {
+		r.payload = make([]byte, n)
+	}
+	r.payload = r.payload[:n]
+	if _, err := io.ReadFull(r.r, r.payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Frame{}, err
+	}
+	return Frame{Type: r.header[4], Payload: r.payload}, nil
+}
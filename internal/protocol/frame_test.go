@@ -0,0 +1,162 @@
+package protocol
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/pkg/errors"
+)
+
+// frames are the frames of the round-trip tests, with every type,
+// empty and binary payloads and the largest one allowed
+var frames = []Frame{
+	{TypeLine, []byte("/home/user/notes.md")},
+	{TypeLine, []byte("/tmp/with\nnewline\x00and NUL")},
+	{TypeLine, []byte{}},
+	{TypeMeta, []byte(`!status {"matches":1,"results":1,"truncated":false}`)},
+	{42, []byte("unknown type")},
+	{TypeLine, bytes.Repeat([]byte("x"), MaxPayload)},
+}
+
+// encode returns the stream of fs
+func encode(t *testing.T, fs []Frame) []byte {
+	t.Helper()
+	var stream []byte
+	for _, f := range fs {
+		var err error
+		if stream, err = AppendFrame(stream, f.Type, string(f.Payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return stream
+}
+
+// decodeAll returns the frames read from r until an error
+func decodeAll(r io.Reader) ([]Frame, error) {
+	reader := NewReader(r)
+	var fs []Frame
+	for {
+		f, err := reader.Next()
+		if err != nil {
+			return fs, err
+		}
+		f.Payload = append([]byte{}, f.Payload...)
+		fs = append(fs, f)
+	}
+}
+
+func equalFrames(a, b []Frame) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Type != b[i].Type || !bytes.Equal(a[i].Payload, b[i].Payload) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReader_RoundTrip(t *testing.T) {
+	stream := encode(t, frames)
+	tests := []struct {
+		name string
+		r    io.Reader
+	}{
+		{"whole", bytes.NewReader(stream)},
+		// every frame arrives in pieces, like from a socket
+		{"one_byte_reads", iotest.OneByteReader(bytes.NewReader(stream))},
+		{"half_reads", iotest.HalfReader(bytes.NewReader(stream))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeAll(tt.r)
+			if err != io.EOF {
+				t.Errorf("error after the last frame = %v, want io.EOF", err)
+			}
+			if !equalFrames(got, frames) {
+				t.Errorf("decoded %d frames differing from the %d encoded", len(got), len(frames))
+			}
+		})
+	}
+}
+
+func TestReader_TornWrites(t *testing.T) {
+	// the largest frame is left out, cutting it everywhere takes long
+	fs := frames[:len(frames)-1]
+	stream := encode(t, fs)
+	boundaries := map[int]int{0: 0}
+	end := 0
+	for i, f := range fs {
+		end += HeaderSize + len(f.Payload)
+		boundaries[end] = i + 1
+	}
+
+	for cut := 0; cut < len(stream); cut++ {
+		got, err := decodeAll(bytes.NewReader(stream[:cut]))
+		complete, atBoundary := boundaries[cut]
+		switch {
+		case atBoundary && err != io.EOF:
+			t.Errorf("stream cut at frame boundary %d: error = %v, want io.EOF", cut, err)
+		case !atBoundary && err != io.ErrUnexpectedEOF:
+			t.Errorf("stream cut within a frame at %d: error = %v, want io.ErrUnexpectedEOF", cut, err)
+		}
+		if atBoundary && !equalFrames(got, fs[:complete]) {
+			t.Errorf("stream cut at %d: decoded %d frames, want %d", cut, len(got), complete)
+		}
+	}
+}
+
+func TestFrame_TooLarge(t *testing.T) {
+	payload := strings.Repeat("x", MaxPayload+1)
+	if dst, err := AppendFrame([]byte("kept"), TypeLine, payload); errors.Cause(err) != ErrFrameTooLarge ||
+		string(dst) != "kept" {
+		t.Errorf("AppendFrame() = %d bytes, %v, want the input and ErrFrameTooLarge", len(dst), err)
+	}
+	if _, err := AppendBatchFrame(nil, 1, payload[batchIDSize:]); errors.Cause(err) != ErrFrameTooLarge {
+		t.Errorf("AppendBatchFrame() error = %v, want ErrFrameTooLarge", err)
+	}
+
+	// the payload isn't read, a corrupt length can't exhaust the memory
+	header := []byte{0xff, 0xff, 0xff, 0xff, TypeLine}
+	if _, err := NewReader(bytes.NewReader(header)).Next(); errors.Cause(err) != ErrFrameTooLarge {
+		t.Errorf("Next() error = %v, want ErrFrameTooLarge", err)
+	}
+}
+
+func TestBatchFrame(t *testing.T) {
+	tests := []struct {
+		name string
+		id   uint32
+		line string
+	}{
+		{"line", 7, "/home/user/notes.md"},
+		{"end", 12, ""},
+		{"largest_id", 1<<32 - 1, "/x"},
+		{"largest_line", 3, strings.Repeat("x", MaxPayload-batchIDSize)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := AppendBatchFrame(nil, tt.id, tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := NewReader(bytes.NewReader(stream)).Next()
+			if err != nil || f.Type != TypeBatch {
+				t.Fatalf("Next() = type %d, %v, want a batch frame", f.Type, err)
+			}
+			id, line, ok := ParseBatch(f.Payload)
+			if !ok || id != tt.id || string(line) != tt.line {
+				t.Errorf("ParseBatch() = %d, %d bytes, %v, want %d, %d bytes", id, len(line), ok,
+					tt.id, len(tt.line))
+			}
+		})
+	}
+
+	if _, _, ok := ParseBatch([]byte{0, 1}); ok {
+		t.Error("ParseBatch() accepted a payload without an ID")
+	}
+}
@@ -0,0 +1,160 @@
+package request
+
+import (
+	"log/slog"
+	"net"
+	"os/user"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Credentials identify the process on the other end of a unix domain
+// socket, like the ucred of SO_PEERCRED
+type Credentials struct {
+	Pid uint32
+	Uid uint32
+	Gid uint32
+}
+
+// AccessPolicy decides which peers may use which actions.
+// User and group IDs are kept as strings, like os/user returns them.
+type AccessPolicy struct {
+	// queryUIDs and queryGIDs may send queries, everyone may
+	// if both are empty
+	queryUIDs map[string]bool
+	queryGIDs map[string]bool
+	// adminGID may use the administrative actions besides root
+	adminGID string
+}
+
+// NewAccessPolicy resolves the users and groups of options
+func NewAccessPolicy(options SocketOptions) (*AccessPolicy, error) {
+	policy := &AccessPolicy{
+		queryUIDs: make(map[string]bool),
+		queryGIDs: make(map[string]bool),
+	}
+
+	for _, name := range options.AllowedUsers {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid allowed user")
+		}
+		policy.queryUIDs[u.Uid] = true
+	}
+
+	for _, name := range options.AllowedGroups {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid allowed group")
+		}
+		policy.queryGIDs[g.Gid] = true
+	}
+
+	if options.AdminGroup != "" {
+		g, err := user.LookupGroup(options.AdminGroup)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid admin group")
+		}
+		policy.adminGID = g.Gid
+	}
+
+	return policy, nil
+}
+
+// isAdminAction returns whether action changes the state of the server
+func isAdminAction(action int) bool {
+	switch action {
+	case IndexRefresh, RefreshPath, AddFilter, RemoveFilter, Pause, Resume, Debug,
+		RetryFailures:
+		return true
+	}
+	return false
+}
+
+// Authorize returns whether the peer with the given credentials
+// may use action and logs the decision
+func (p *AccessPolicy) Authorize(cred *Credentials, action int) bool {
+	uid := strconv.Itoa(int(cred.Uid))
+	groups := func() []string { return peerGroups(cred) }
+	if !p.allows(uid, groups, action) {
+		slog.Warn("denied request", "action", action, "uid", uid)
+		return false
+	}
+
+	slog.Debug("allowed request", "action", action, "uid", uid)
+	return true
+}
+
+// allows returns whether the peer with the given uid may use action.
+// groups is only called if group membership matters.
+func (p *AccessPolicy) allows(uid string, groups func() []string, action int) bool {
+	if uid == "0" {
+		return true
+	}
+
+	if isAdminAction(action) {
+		return p.adminGID != "" && contains(groups(), p.adminGID)
+	}
+
+	if len(p.queryUIDs) == 0 && len(p.queryGIDs) == 0 {
+		return true
+	}
+	if p.queryUIDs[uid] {
+		return true
+	}
+	for _, gid := range groups() {
+		if p.queryGIDs[gid] {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, entry := range list {
+		if entry == s {
+			return true
+		}
+	}
+	return false
+}
+
+// PeerCredentials returns the credentials of the process
+// on the other end of the socket
+func PeerCredentials(c net.Conn) (*Credentials, error) {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return nil, errors.New("not a unix domain socket")
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *Credentials
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = socketCredentials(fd)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cred, credErr
+}
+
+// peerGroups returns the primary and supplementary groups of the peer
+func peerGroups(cred *Credentials) []string {
+	groups := []string{strconv.Itoa(int(cred.Gid))}
+
+	u, err := user.LookupId(strconv.Itoa(int(cred.Uid)))
+	if err != nil {
+		return groups
+	}
+	supplementary, err := u.GroupIds()
+	if err != nil {
+		return groups
+	}
+	return append(groups, supplementary...)
+}
@@ -0,0 +1,26 @@
+package request
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// socketCredentials reads SO_PEERCRED of the socket fd
+func socketCredentials(fd uintptr) (*Credentials, error) {
+	cred, err := unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	if err != nil {
+		return nil, err
+	}
+	return &Credentials{Pid: uint32(cred.Pid), Uid: cred.Uid, Gid: cred.Gid}, nil
+}
+
+// fileGid returns the group owning the file of info
+func fileGid(info os.FileInfo) (int, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(stat.Gid), true
+}
@@ -0,0 +1,46 @@
+package request
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestPeerCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("unix", filepath.Join(dir, "sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		c, err := net.Dial("unix", l.Addr().String())
+		if err == nil {
+			defer c.Close()
+			c.Read(make([]byte, 1))
+		}
+	}()
+
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	cred, err := PeerCredentials(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid := strconv.Itoa(int(cred.Uid)); uid != strconv.Itoa(os.Getuid()) {
+		t.Errorf("peer uid = %s, want %d", uid, os.Getuid())
+	}
+}
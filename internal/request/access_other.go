@@ -0,0 +1,21 @@
+//go:build !linux
+
+package request
+
+import (
+	"os"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// socketCredentials fails, peers are only identified on linux, so
+// the server denies every request that needs authorization
+func socketCredentials(uintptr) (*Credentials, error) {
+	return nil, errors.Errorf("peer credentials aren't supported on %s", runtime.GOOS)
+}
+
+// fileGid fails, the owners of the sockets are only checked on linux
+func fileGid(os.FileInfo) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,54 @@
+package request
+
+import (
+	"testing"
+)
+
+func TestAccessPolicy_Allows(t *testing.T) {
+	open := &AccessPolicy{queryUIDs: map[string]bool{}, queryGIDs: map[string]bool{}}
+	restricted := &AccessPolicy{
+		queryUIDs: map[string]bool{"1000": true},
+		queryGIDs: map[string]bool{"100": true},
+		adminGID:  "10",
+	}
+
+	tests := []struct {
+		name   string
+		policy *AccessPolicy
+		uid    string
+		groups []string
+		action int
+		want   bool
+	}{
+		{"open_query", open, "1001", nil, SubStringSearch, true},
+		{"open_admin", open, "1001", nil, AddFilter, false},
+		{"root_admin", open, "0", nil, IndexRefresh, true},
+		{"allowed_user", restricted, "1000", nil, FuzzySearch, true},
+		{"allowed_group", restricted, "1001", []string{"1001", "100"}, Stats, true},
+		{"denied_query", restricted, "1002", []string{"1002"}, PrefixSearch, false},
+		{"admin_group", restricted, "1002", []string{"1002", "10"}, RemoveFilter, true},
+		{"allowed_user_admin", restricted, "1000", []string{"1000"}, AddFilter, false},
+		{"root_restricted", restricted, "0", nil, SubStringSearch, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := func() []string { return tt.groups }
+			if got := tt.policy.allows(tt.uid, groups, tt.action); got != tt.want {
+				t.Errorf("allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorResponse_Line(t *testing.T) {
+	e := ErrorResponse{Code: ErrPermissionDenied, Message: "permission denied"}
+
+	if got := e.Line(0); got != "error: permission denied" {
+		t.Errorf("line(0) = %q", got)
+	}
+
+	parsed, ok := ParseError(e.Line(ProtocolVersion))
+	if !ok || parsed != e {
+		t.Errorf("ParseError() = %+v, %v, want %+v", parsed, ok, e)
+	}
+}
@@ -0,0 +1,79 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+)
+
+// serveBatch answers the requests following the Batch request on c
+// one after another, until the client closes the connection for
+// writing. decoder is the one the Batch request was read with, framed
+// is set if the client agreed on FeatureFraming.
+func serveBatch(c net.Conn, decoder *json.Decoder, requestReceiver chan<- Request,
+	policy *AccessPolicy, batch Request, framed bool) {
+	out := newBatchWriter(c)
+	defer out.Flush()
+	write := func(id int, line string) error {
+		encode := batchEncoder(batch, framed, id)
+		return out.Append(func(dst []byte) ([]byte, error) { return encode(dst, line) })
+	}
+
+	for {
+		var req Request
+		if err := decoder.Decode(&req); err == io.EOF {
+			return
+		} else if err != nil {
+			batch.Logger().Warn("failed to decode batched request", "err", err)
+			return
+		}
+		// the batch decides how the responses are sent
+		req.Version = batch.Version
+		req.Features = batch.Features
+		req.Settings.NullDelimited = batch.Settings.NullDelimited
+
+		err := serveBatched(c, requestReceiver, policy, req, func(line string) error {
+			return write(req.ID, line)
+		})
+		if err == nil {
+			err = write(req.ID, "")
+		}
+		if err != nil {
+			out.Discard()
+			batch.Logger().Warn("failed to write to unix domain socket", "err", err)
+			return
+		}
+	}
+}
+
+// serveBatched answers a request of a batch, rejected requests
+// are answered with an ErrorResponse
+func serveBatched(c net.Conn, requestReceiver chan<- Request, policy *AccessPolicy,
+	req Request, write func(string) error) error {
+	if e := req.AssignID(); e != nil {
+		return write(e.Line(req.Version))
+	}
+	req.Peer = peerKey(c)
+	if !IsQuery(req.Settings.Action) {
+		e := ErrorResponse{Code: ErrInvalidRequest, Message: "only searches can be batched"}
+		return write(e.Line(req.Version))
+	}
+	if policy != nil {
+		if e := authorize(c, policy, req); e != nil {
+			return write(e.Line(req.Version))
+		}
+	}
+
+	// a client hanging up is noticed by the failing writes
+	ctx := context.Background()
+	release, err := AcquireQuery(ctx, req.Peer)
+	if e, ok := err.(ErrorResponse); ok {
+		return write(e.Line(req.Version))
+	} else if err != nil {
+		return err
+	}
+	defer release()
+
+	return Dispatch(ctx, requestReceiver, req, write)
+}
@@ -0,0 +1,149 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ozeidan/gosearch/internal/protocol"
+)
+
+// runBatch serves a batch with the given features and returns what
+// the client read
+func runBatch(t *testing.T, features []string) []byte {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "gosearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("unix", filepath.Join(dir, "sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	requests := make(chan Request)
+	defer close(requests)
+	go serveListener(l, requests, nil)
+	go func() {
+		for req := range requests {
+			for i := 0; i < len(req.Query); i++ {
+				req.ResponseChannel <- "/" + req.Query
+			}
+			close(req.ResponseChannel)
+		}
+	}()
+
+	c, err := net.Dial("unix", filepath.Join(dir, "sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	encoder := json.NewEncoder(c)
+	batch := Request{Version: ProtocolVersion, Features: features,
+		Settings: Settings{Action: Batch}}
+	for _, req := range []Request{
+		batch,
+		{ID: 1, Query: "ab"},
+		{ID: 2, Query: "c", Settings: Settings{Action: Stats}},
+		{ID: 7, Query: "d", Settings: Settings{Action: FuzzySearch}},
+	} {
+		if err := encoder.Encode(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.(*net.UnixConn).CloseWrite()
+
+	got, err := ioutil.ReadAll(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+// rejected is the error of the Stats request of runBatch
+var rejected = ErrorResponse{Code: ErrInvalidRequest, Message: "only searches can be batched"}
+
+func TestServe_Batch(t *testing.T) {
+	got := runBatch(t, []string{FeatureBatch})
+	want := []string{
+		Hello{ProtocolVersion, []string{FeatureBatch}}.String(),
+		BatchResponse{1, "/ab"}.String(),
+		BatchResponse{1, "/ab"}.String(),
+		BatchResponse{1, ""}.String(),
+		BatchResponse{2, rejected.Line(ProtocolVersion)}.String(),
+		BatchResponse{2, ""}.String(),
+		BatchResponse{7, "/d"}.String(),
+		BatchResponse{7, ""}.String(),
+	}
+	if string(got) != strings.Join(want, "\n")+"\n" {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestServe_BatchFramed(t *testing.T) {
+	features := []string{FeatureBatch, FeatureFraming}
+	reader := bufio.NewReader(bytes.NewReader(runBatch(t, features)))
+	hello, _ := reader.ReadString('\n')
+	if want := (Hello{ProtocolVersion, features}).String() + "\n"; hello != want {
+		t.Errorf("hello = %q, want %q", hello, want)
+	}
+
+	var got []BatchResponse
+	frames := protocol.NewReader(reader)
+	for {
+		f, err := frames.Next()
+		if err == io.EOF {
+			break
+		}
+		id, line, ok := protocol.ParseBatch(f.Payload)
+		if err != nil || f.Type != protocol.TypeBatch || !ok {
+			t.Fatalf("Next() = type %d, %v, want a batch frame", f.Type, err)
+		}
+		got = append(got, BatchResponse{int(id), string(line)})
+	}
+	want := []BatchResponse{
+		{1, "/ab"}, {1, "/ab"}, {1, ""},
+		{2, rejected.Line(ProtocolVersion)}, {2, ""},
+		{7, "/d"}, {7, ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParseBatchResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		want   BatchResponse
+		wantOK bool
+	}{
+		{"result", "!batch 3 /foo bar", BatchResponse{3, "/foo bar"}, true},
+		{"end", "!batch 12", BatchResponse{12, ""}, true},
+		{"invalid_id", "!batch x /foo", BatchResponse{}, false},
+		{"not_batched", "/foo", BatchResponse{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseBatchResponse(tt.line)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("got %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+			if ok {
+				if line := got.String(); line != tt.line {
+					t.Errorf("encoded as %q", line)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package request
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// endlessDatabase handles requests one after another like the real
+// database, streaming results until the client gives up
+func endlessDatabase(requests <-chan Request) {
+	for req := range requests {
+	stream:
+		for {
+			select {
+			case req.ResponseChannel <- "/result":
+			case <-req.Done:
+				break stream
+			}
+		}
+		close(req.ResponseChannel)
+	}
+}
+
+func TestServe_CancelOnHangup(t *testing.T) {
+	// every hangup is logged
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dir, err := ioutil.TempDir("", "gosearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("unix", filepath.Join(dir, "sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := make(chan Request)
+	defer close(requests)
+	go endlessDatabase(requests)
+	go serveListener(l, requests, nil)
+	defer l.Close()
+
+	baseline := runtime.NumGoroutine()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := net.Dial("unix", l.Addr().String())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer c.Close()
+
+			if err := json.NewEncoder(c).Encode(Request{Query: "result"}); err != nil {
+				t.Error(err)
+				return
+			}
+			reader := bufio.NewReader(c)
+			for j := 0; j < 3; j++ {
+				if _, err := reader.ReadString('\n'); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines left, baseline %d\n%s",
+				runtime.NumGoroutine(), baseline, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
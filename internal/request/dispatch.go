@@ -0,0 +1,165 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ozeidan/gosearch/internal/health"
+	"github.com/ozeidan/gosearch/internal/metrics"
+	"github.com/ozeidan/gosearch/internal/version"
+)
+
+var requestsInFlight = metrics.NewGauge("queries_in_flight",
+	"Requests passed on to the database that aren't answered yet")
+
+// DefaultResponseBuffer is the number of response lines the database
+// sends ahead of the client unless SetResponseBuffer changes it
+const DefaultResponseBuffer = 256
+
+// responseBuffer is the capacity of the response channels
+var responseBuffer atomic.Int64
+
+func init() {
+	responseBuffer.Store(DefaultResponseBuffer)
+}
+
+// SetResponseBuffer sets the number of response lines the database
+// sends ahead of a client before it waits, or drops them with
+// BackpressureDrop. It applies to the requests dispatched later.
+func SetResponseBuffer(lines int) {
+	responseBuffer.Store(int64(lines))
+}
+
+// Dispatch passes req on to requestReceiver and calls write for every
+// response line. The database stops early if ctx is done or write
+// fails, the error is returned then. An ID is assigned to req if it
+// has none. If write doesn't keep up, the database waits for it once
+// the response buffer is full, or the results it sends are dropped
+// with BackpressureDrop.
+func Dispatch(ctx context.Context, requestReceiver chan<- Request,
+	req Request, write func(string) error) error {
+	if e := req.AssignID(); e != nil {
+		return write(e.Line(req.Version))
+	}
+
+	// the database doesn't answer during the initial index,
+	// which is exactly when the health matters
+	switch req.Settings.Action {
+	case Health:
+		return write(healthResponse())
+	case Version:
+		return write(versionResponse())
+	}
+
+	if IsQuery(req.Settings.Action) {
+		if e := applyPolicy(&req); e != nil {
+			return write(e.Line(req.Version))
+		}
+	}
+
+	buffer := int(responseBuffer.Load())
+	req.ResponseChannel = make(chan string, buffer)
+	req.Done = make(chan struct{})
+
+	requestsInFlight.Add(1)
+	defer requestsInFlight.Add(-1)
+
+	select {
+	case requestReceiver <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	defer func() {
+		close(req.Done)
+		// the database closes the channel once it noticed
+		for range req.ResponseChannel {
+		}
+	}()
+
+	lines := (<-chan string)(req.ResponseChannel)
+	if req.Settings.Backpressure == BackpressureDrop {
+		lines = dropBehind(req, buffer)
+	}
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return nil
+			}
+			if err := write(line); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// dropBehind receives the responses to req without ever waiting for
+// the client, and returns the channel they are passed on with. Results
+// that don't fit into its buffer of size lines are dropped, the other
+// lines are kept until the database is done and passed on then. The
+// Status line counts the dropped results as not sent.
+func dropBehind(req Request, size int) <-chan string {
+	passed := make(chan string, size)
+	go func() {
+		defer close(passed)
+		var held []string
+		var status *Status
+		dropped := 0
+		for line := range req.ResponseChannel {
+			if s, ok := ParseStatus(line); ok {
+				status = &s
+				continue
+			}
+			select {
+			case passed <- line:
+				continue
+			default:
+			}
+			if isMeta(line) {
+				held = append(held, line)
+			} else {
+				dropped++
+			}
+		}
+
+		if dropped > 0 && req.Wants(FeatureWarnings) {
+			held = append(held, Warning{Code: WarnDropped,
+				Message: fmt.Sprintf("dropped %d results the client didn't keep up with", dropped)}.Line())
+		}
+		if status != nil {
+			status.Results -= dropped
+			status.Truncated = status.Truncated || dropped > 0
+			held = append(held, status.Line())
+		}
+		for _, line := range held {
+			select {
+			case passed <- line:
+			case <-req.Done:
+				return
+			}
+		}
+	}()
+	return passed
+}
+
+// healthResponse encodes the current health as a response line
+func healthResponse() string {
+	state, reasons := health.Check()
+	encoded, _ := json.Marshal(HealthResponse{State: string(state), Reasons: reasons})
+	return string(encoded)
+}
+
+// versionResponse encodes the build of the daemon as a response line
+func versionResponse() string {
+	encoded, _ := json.Marshal(VersionResponse{
+		Info:     version.Get(),
+		Protocol: ProtocolVersion,
+		Features: SupportedFeatures,
+	})
+	return string(encoded)
+}
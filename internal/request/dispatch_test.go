@@ -0,0 +1,177 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDispatch_HealthWithoutDatabase(t *testing.T) {
+	// nobody receives, like during the initial index
+	blocked := make(chan Request)
+
+	var lines []string
+	err := Dispatch(context.Background(), blocked, Request{Settings: Settings{Action: Health}},
+		func(line string) error {
+			lines = append(lines, line)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1", len(lines))
+	}
+
+	var response HealthResponse
+	if err := json.Unmarshal([]byte(lines[0]), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.State == "" || response.Reasons == nil {
+		t.Errorf("got %+v, want a state and reasons", response)
+	}
+}
+
+func TestDispatch_VersionWithoutDatabase(t *testing.T) {
+	var line string
+	err := Dispatch(context.Background(), make(chan Request),
+		Request{Settings: Settings{Action: Version}},
+		func(l string) error {
+			line = l
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var response VersionResponse
+	if err := json.Unmarshal([]byte(line), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Protocol != ProtocolVersion || response.GoVersion == "" ||
+		len(response.Features) != len(SupportedFeatures) {
+		t.Errorf("got %+v", response)
+	}
+}
+
+func TestRequest_AssignID(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        string
+		wantValid bool
+	}{
+		{"generated", "", true},
+		{"client", "build-42.step_3", true},
+		{"longest", strings.Repeat("a", maxRequestIDLength), true},
+		{"too_long", strings.Repeat("a", maxRequestIDLength+1), false},
+		{"space", "build 42", false},
+		{"newline", "42\nforged log line", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := Request{RequestID: tt.id}
+			e := req.AssignID()
+			if (e == nil) != tt.wantValid {
+				t.Fatalf("AssignID() = %v, want valid %v", e, tt.wantValid)
+			}
+			if e == nil && (req.RequestID == "" || (tt.id != "" && req.RequestID != tt.id)) {
+				t.Errorf("got ID %q for %q", req.RequestID, tt.id)
+			}
+		})
+	}
+}
+
+func TestDispatch_AssignsID(t *testing.T) {
+	requests := make(chan Request, 1)
+	go func() {
+		req := <-requests
+		req.ResponseChannel <- req.RequestID
+		close(req.ResponseChannel)
+	}()
+
+	var id string
+	err := Dispatch(context.Background(), requests, Request{Query: "foo"},
+		func(line string) error {
+			id = line
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(id) != 16 {
+		t.Errorf("got ID %q, want 16 hex digits", id)
+	}
+}
+
+func TestDispatch_Backpressure(t *testing.T) {
+	SetResponseBuffer(4)
+	defer SetResponseBuffer(DefaultResponseBuffer)
+	const results = 200
+
+	tests := []struct {
+		name         string
+		backpressure string
+		// wantBlocked is whether the database waits for the client
+		wantBlocked bool
+	}{
+		{"block", BackpressureBlock, true},
+		{"default", "", true},
+		{"drop", BackpressureDrop, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make(chan Request, 1)
+			sent := make(chan time.Duration, 1)
+			go func() {
+				req := <-requests
+				start := time.Now()
+				defer close(req.ResponseChannel)
+				for i := 0; i < results; i++ {
+					select {
+					case req.ResponseChannel <- "/result":
+					case <-req.Done:
+						return
+					}
+				}
+				req.ResponseChannel <- Status{Matches: results, Results: results}.Line()
+				sent <- time.Since(start)
+			}()
+
+			var written int
+			var status Status
+			var warning Warning
+			req := Request{Version: ProtocolVersion, Features: []string{FeatureWarnings},
+				Settings: Settings{Backpressure: tt.backpressure}}
+			err := Dispatch(context.Background(), requests, req, func(line string) error {
+				if s, ok := ParseStatus(line); ok {
+					status = s
+				} else if w, ok := ParseWarning(line); ok {
+					warning = w
+				} else {
+					written++
+					time.Sleep(time.Millisecond)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the client takes at least results milliseconds
+			if blocked := <-sent > results*time.Millisecond/2; blocked != tt.wantBlocked {
+				t.Errorf("database blocked = %v, want %v", blocked, tt.wantBlocked)
+			}
+			if status.Results != written || status.Truncated != (written < results) {
+				t.Errorf("status = %+v after %d results", status, written)
+			}
+			if tt.wantBlocked && written != results {
+				t.Errorf("%d results written, want %d", written, results)
+			}
+			if !tt.wantBlocked && (written == results || warning.Code != WarnDropped) {
+				t.Errorf("%d results written with warning %+v, want some dropped", written, warning)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package request
+
+import (
+	"strings"
+
+	"github.com/ozeidan/gosearch/internal/protocol"
+)
+
+// metaPrefixes start the lines describing a response rather than
+// being part of it
+var metaPrefixes = []string{helloPrefix, errorPrefix, warningPrefix,
+	timingPrefix, statusPrefix, batchPrefix}
+
+// isMeta returns whether line describes a response
+func isMeta(line string) bool {
+	for _, prefix := range metaPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeFunc appends an encoded response line to dst
+type encodeFunc func(dst []byte, line string) ([]byte, error)
+
+// lineEncoder returns how the response lines to req following the
+// Hello are encoded: as frames if the client agreed on FeatureFraming,
+// followed by the delimiter of its settings otherwise
+func lineEncoder(req Request, framed bool) encodeFunc {
+	if framed {
+		return func(dst []byte, line string) ([]byte, error) {
+			typ := protocol.TypeLine
+			if isMeta(line) {
+				typ = protocol.TypeMeta
+			}
+			return protocol.AppendFrame(dst, typ, line)
+		}
+	}
+	delimiter := req.Settings.Delimiter()
+	return func(dst []byte, line string) ([]byte, error) {
+		return append(append(dst, line...), delimiter), nil
+	}
+}
+
+// batchEncoder is like lineEncoder for the response lines to the
+// request id of the batch, an empty line ends its responses
+func batchEncoder(batch Request, framed bool, id int) encodeFunc {
+	if framed {
+		return func(dst []byte, line string) ([]byte, error) {
+			return protocol.AppendBatchFrame(dst, uint32(id), line)
+		}
+	}
+	encode := lineEncoder(batch, false)
+	return func(dst []byte, line string) ([]byte, error) {
+		return encode(dst, BatchResponse{id, line}.String())
+	}
+}
@@ -0,0 +1,220 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limits restrict the queries clients may run, 0 means unlimited.
+// Only searches count, the other actions are cheap or reserved
+// to administrators.
+type Limits struct {
+	// MaxConcurrent is the number of queries running at a time
+	MaxConcurrent int `json:"max_concurrent"`
+	// MaxConcurrentPerPeer is the number of queries
+	// a single peer may run at a time
+	MaxConcurrentPerPeer int `json:"max_concurrent_per_peer"`
+	// Rate is the number of queries per second a peer may send,
+	// Burst the number it may send at once
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+	// QueueSize is the number of queries waiting for a slot,
+	// queries beyond it are rejected
+	QueueSize int `json:"queue_size"`
+}
+
+// LimitStats describe the current use of the limits
+type LimitStats struct {
+	Limits
+	// Running is the number of queries running
+	Running int `json:"running"`
+	// Queued is the number of queries waiting for a slot
+	Queued int `json:"queued"`
+	// Rejected is the number of queries rejected since the start
+	Rejected uint64 `json:"rejected"`
+}
+
+// maxBuckets is the number of token buckets kept before
+// full ones are dropped
+const maxBuckets = 1024
+
+// bucket holds the tokens of a peer, one is used per query
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter enforces the Limits
+type limiter struct {
+	mu      sync.Mutex
+	limits  Limits
+	running int
+	perPeer map[string]int
+	queued  int
+	buckets map[string]*bucket
+	// released is closed and replaced whenever a slot frees up
+	released chan struct{}
+	rejected uint64
+	now      func() time.Time
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		perPeer:  make(map[string]int),
+		buckets:  make(map[string]*bucket),
+		released: make(chan struct{}),
+		now:      time.Now,
+	}
+}
+
+// queryLimiter limits the queries of all listeners
+var queryLimiter = newLimiter()
+
+// SetLimits replaces the limits, running queries aren't affected
+func SetLimits(limits Limits) {
+	queryLimiter.setLimits(limits)
+}
+
+// CurrentLimits returns the limits and their use
+func CurrentLimits() LimitStats {
+	return queryLimiter.stats()
+}
+
+// AcquireQuery waits until peer may run a query and returns the
+// function releasing its slot. Queries over the rate or beyond the
+// queue are rejected with an ErrorResponse, ctx.Err() is returned if
+// ctx is done while waiting. Peers are told apart by an arbitrary key,
+// like their uid.
+func AcquireQuery(ctx context.Context, peer string) (release func(), err error) {
+	return queryLimiter.acquire(ctx, peer)
+}
+
+// IsQuery returns whether action is a search, which AcquireQuery limits
+func IsQuery(action int) bool {
+	switch action {
+	case SubStringSearch, PrefixSearch, FuzzySearch, PathSearch, SegmentSearch,
+		Duplicates, ChangedSince, History, Jump, Trash, Deleted, Tree, Recent, Links:
+		return true
+	}
+	return false
+}
+
+func (l *limiter) setLimits(limits Limits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+	l.buckets = make(map[string]*bucket)
+	// raised limits may let waiting queries run
+	l.wake()
+}
+
+func (l *limiter) stats() LimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return LimitStats{l.limits, l.running, l.queued, l.rejected}
+}
+
+func (l *limiter) acquire(ctx context.Context, peer string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if wait, ok := l.take(peer); !ok {
+		l.rejected++
+		return nil, ErrorResponse{Code: ErrBusy, Message: fmt.Sprintf(
+			"too many queries, try again in %s", wait.Round(time.Millisecond))}
+	}
+
+	for !l.fits(peer) {
+		if l.queued >= l.limits.QueueSize {
+			l.rejected++
+			return nil, ErrorResponse{Code: ErrBusy, Message: "too many queries running, try again later"}
+		}
+
+		l.queued++
+		released := l.released
+		l.mu.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+		}
+		l.mu.Lock()
+		l.queued--
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	l.running++
+	l.perPeer[peer]++
+	var once sync.Once
+	return func() { once.Do(func() { l.release(peer) }) }, nil
+}
+
+func (l *limiter) release(peer string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	l.perPeer[peer]--
+	if l.perPeer[peer] <= 0 {
+		delete(l.perPeer, peer)
+	}
+	l.wake()
+}
+
+// fits returns whether another query of peer may run
+func (l *limiter) fits(peer string) bool {
+	if l.limits.MaxConcurrent > 0 && l.running >= l.limits.MaxConcurrent {
+		return false
+	}
+	if l.limits.MaxConcurrentPerPeer > 0 &&
+		l.perPeer[peer] >= l.limits.MaxConcurrentPerPeer {
+		return false
+	}
+	return true
+}
+
+// take uses a token of peer's bucket. If there is none, it returns
+// how long it takes until there is one.
+func (l *limiter) take(peer string) (time.Duration, bool) {
+	if l.limits.Rate <= 0 {
+		return 0, true
+	}
+	burst := math.Max(float64(l.limits.Burst), 1)
+	now := l.now()
+
+	b, ok := l.buckets[peer]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.dropFullBuckets(now, burst)
+		}
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[peer] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.limits.Rate)
+	b.last = now
+	if b.tokens < 1 {
+		missing := (1 - b.tokens) / l.limits.Rate
+		return time.Duration(missing * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// dropFullBuckets forgets the peers that didn't query recently,
+// they start with a full bucket anyway
+func (l *limiter) dropFullBuckets(now time.Time, burst float64) {
+	for peer, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.limits.Rate >= burst {
+			delete(l.buckets, peer)
+		}
+	}
+}
+
+func (l *limiter) wake() {
+	close(l.released)
+	l.released = make(chan struct{})
+}
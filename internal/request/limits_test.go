@@ -0,0 +1,204 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Concurrency(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		// peers acquire a slot each in order, none is released
+		peers []string
+		want  []bool
+	}{
+		{"unlimited", Limits{}, []string{"a", "a", "b"}, []bool{true, true, true}},
+		{"overall", Limits{MaxConcurrent: 2}, []string{"a", "b", "c"}, []bool{true, true, false}},
+		{"per_peer", Limits{MaxConcurrentPerPeer: 1}, []string{"a", "a", "b"}, []bool{true, false, true}},
+		{"both", Limits{MaxConcurrent: 2, MaxConcurrentPerPeer: 1},
+			[]string{"a", "a", "b", "c"}, []bool{true, false, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLimiter()
+			l.setLimits(tt.limits)
+			for i, peer := range tt.peers {
+				_, err := l.acquire(context.Background(), peer)
+				if got := err == nil; got != tt.want[i] {
+					t.Errorf("acquire %d (%s) ok = %v, want %v, err %v",
+						i, peer, got, tt.want[i], err)
+				}
+				if e, ok := err.(ErrorResponse); err != nil && (!ok || e.Code != ErrBusy) {
+					t.Errorf("acquire %d error = %v, want %s", i, err, ErrBusy)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiter_Rate(t *testing.T) {
+	l := newLimiter()
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+	l.setLimits(Limits{Rate: 2, Burst: 3})
+
+	acquire := func(peer string) bool {
+		release, err := l.acquire(context.Background(), peer)
+		if err != nil {
+			return false
+		}
+		release()
+		return true
+	}
+
+	for i := 0; i < 3; i++ {
+		if !acquire("a") {
+			t.Fatalf("query %d within the burst was rejected", i)
+		}
+	}
+	if acquire("a") {
+		t.Error("query beyond the burst was allowed")
+	}
+	if !acquire("b") {
+		t.Error("other peer was limited")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !acquire("a") {
+		t.Error("query after refill was rejected")
+	}
+	if acquire("a") {
+		t.Error("refill added more than one token")
+	}
+	if got := l.stats().Rejected; got != 2 {
+		t.Errorf("rejected %d queries, want 2", got)
+	}
+}
+
+func TestLimiter_Queue(t *testing.T) {
+	l := newLimiter()
+	l.setLimits(Limits{MaxConcurrent: 1, QueueSize: 1})
+
+	release, err := l.acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan error)
+	go func() {
+		release, err := l.acquire(context.Background(), "b")
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+
+	// wait until the query is queued
+	for l.stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := l.acquire(context.Background(), "c"); err == nil {
+		t.Error("query beyond the queue was allowed")
+	}
+
+	release()
+	if err := <-acquired; err != nil {
+		t.Errorf("queued query failed: %v", err)
+	}
+
+	stats := l.stats()
+	if stats.Running != 0 || stats.Queued != 0 || stats.Rejected != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestLimiter_QueueCancel(t *testing.T) {
+	l := newLimiter()
+	l.setLimits(Limits{MaxConcurrent: 1, QueueSize: 1})
+	if _, err := l.acquire(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	acquired := make(chan error)
+	go func() {
+		_, err := l.acquire(ctx, "b")
+		acquired <- err
+	}()
+	for l.stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-acquired; err != context.Canceled {
+		t.Errorf("acquire() error = %v, want %v", err, context.Canceled)
+	}
+	if queued := l.stats().Queued; queued != 0 {
+		t.Errorf("%d queries still queued", queued)
+	}
+}
+
+func TestLimiter_RaisedLimitsWakeQueue(t *testing.T) {
+	l := newLimiter()
+	l.setLimits(Limits{MaxConcurrent: 1, QueueSize: 1})
+	if _, err := l.acquire(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan error)
+	go func() {
+		_, err := l.acquire(context.Background(), "b")
+		acquired <- err
+	}()
+	for l.stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	l.setLimits(Limits{MaxConcurrent: 2})
+	if err := <-acquired; err != nil {
+		t.Errorf("queued query failed after raising the limit: %v", err)
+	}
+}
+
+func TestServe_Busy(t *testing.T) {
+	defer SetLimits(Limits{})
+	SetLimits(Limits{Rate: 1})
+	// net.Pipe has no peer credentials, so both requests come
+	// from the same unknown peer
+	queryLimiter.now = func() time.Time { return time.Unix(0, 0) }
+	defer func() { queryLimiter.now = time.Now }()
+
+	for i, want := range []string{"/foo\n", `!error {"code":"busy","message":"too many queries, try again in 1s"}` + "\n"} {
+		got := serveRequest(t, Request{Version: ProtocolVersion, Query: "foo"})
+		hello := Hello{ProtocolVersion, []string{}}.String() + "\n"
+		if got != hello+want {
+			t.Errorf("request %d got %q, want %q", i, got, hello+want)
+		}
+	}
+}
+
+// serveRequest sends req to serve and returns the response
+func serveRequest(t *testing.T, req Request) string {
+	client, server := net.Pipe()
+	requests := make(chan Request)
+	go serve(server, requests, nil)
+	go func() {
+		req := <-requests
+		req.ResponseChannel <- "/" + req.Query
+		close(req.ResponseChannel)
+	}()
+
+	if err := json.NewEncoder(client).Encode(req); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(got)
+}
@@ -0,0 +1,112 @@
+package request
+
+import (
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Policy holds the defaults and limits the server applies to the
+// queries of a peer, the zero value restricts nothing
+type Policy struct {
+	// DefaultMaxResults replaces a MaxResults of 0, which doesn't
+	// limit the results otherwise
+	DefaultMaxResults int `json:"default_max_results,omitempty"`
+	// MaxResults is the largest MaxResults a query may ask for, larger
+	// and unlimited ones are lowered to it. 0 means any.
+	MaxResults int `json:"max_results,omitempty"`
+	// DenyIncludeFiltered rejects the queries setting IncludeFiltered
+	DenyIncludeFiltered bool `json:"deny_include_filtered,omitempty"`
+}
+
+// Names of the parts of a Policy, sent as ErrorResponse.Policy
+// if a query violates them
+const (
+	PolicyIncludeFiltered = "include_filtered"
+)
+
+// apply clamps settings to the limits of p and fills in its
+// defaults. The queries violating p are rejected with an ErrorResponse
+// naming the part they violate.
+func (p Policy) apply(settings *Settings) *ErrorResponse {
+	if p.DenyIncludeFiltered && settings.IncludeFiltered != "" {
+		return &ErrorResponse{Code: ErrPolicy, Policy: PolicyIncludeFiltered,
+			Message: "the server policy doesn't allow including filtered directories"}
+	}
+	if settings.MaxResults == 0 {
+		settings.MaxResults = p.DefaultMaxResults
+	}
+	if p.MaxResults > 0 && (settings.MaxResults == 0 || settings.MaxResults > p.MaxResults) {
+		settings.MaxResults = p.MaxResults
+	}
+	return nil
+}
+
+// policies holds the Policy of the peers, users those overriding the
+// defaults by uid
+type policies struct {
+	sync.Mutex
+	defaults Policy
+	users    map[string]Policy
+}
+
+// queryPolicy applies to the queries of all listeners
+var queryPolicy policies
+
+// SetPolicy replaces the policy applied to the queries of the peers
+// besides root. users overrides it for the users, given by name or
+// uid. An error is returned, and the policy kept, if a user doesn't
+// exist.
+func SetPolicy(defaults Policy, users map[string]Policy) error {
+	byUID := make(map[string]Policy, len(users))
+	for name, p := range users {
+		uid := name
+		if _, err := strconv.ParseUint(name, 10, 32); err != nil {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return errors.Wrap(err, "invalid policy user")
+			}
+			uid = u.Uid
+		}
+		byUID[uid] = p
+	}
+
+	queryPolicy.Lock()
+	defer queryPolicy.Unlock()
+	queryPolicy.defaults, queryPolicy.users = defaults, byUID
+	return nil
+}
+
+// PeerPolicy returns the policy applied to the queries of peer, a key
+// like PeerKey returns. restricted is false for root, whose queries
+// no policy applies to.
+func PeerPolicy(peer string) (p Policy, restricted bool) {
+	uid, local := strings.CutPrefix(peer, "uid:")
+	if local && uid == "0" {
+		return Policy{}, false
+	}
+
+	queryPolicy.Lock()
+	defer queryPolicy.Unlock()
+	if p, ok := queryPolicy.users[uid]; ok && local {
+		return p, true
+	}
+	return queryPolicy.defaults, true
+}
+
+// applyPolicy applies the policy of the peer of req to its settings,
+// it returns the ErrorResponse rejecting req if it violates the policy
+func applyPolicy(req *Request) *ErrorResponse {
+	p, restricted := PeerPolicy(req.Peer)
+	if !restricted {
+		return nil
+	}
+	e := p.apply(&req.Settings)
+	if e != nil {
+		req.Logger().Info("rejected query violating the policy", "policy", e.Policy)
+	}
+	return e
+}
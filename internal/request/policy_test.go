@@ -0,0 +1,131 @@
+package request
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPolicy_Apply(t *testing.T) {
+	limited := Policy{DefaultMaxResults: 100, MaxResults: 1000}
+	tests := []struct {
+		name       string
+		policy     Policy
+		settings   Settings
+		wantMax    int
+		wantPolicy string
+	}{
+		{"unrestricted", Policy{}, Settings{}, 0, ""},
+		{"default", limited, Settings{}, 100, ""},
+		{"within_limit", limited, Settings{MaxResults: 500}, 500, ""},
+		{"clamped", limited, Settings{MaxResults: 5000}, 1000, ""},
+		{"unlimited_clamped", Policy{MaxResults: 1000}, Settings{}, 1000, ""},
+		{"include_filtered_allowed", limited, Settings{IncludeFiltered: "/tmp"}, 100, ""},
+		{"include_filtered_denied", Policy{DenyIncludeFiltered: true},
+			Settings{IncludeFiltered: "/tmp"}, 0, PolicyIncludeFiltered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := tt.settings
+			e := tt.policy.apply(&settings)
+			if tt.wantPolicy != "" {
+				if e == nil || e.Code != ErrPolicy || e.Policy != tt.wantPolicy {
+					t.Errorf("apply() = %+v, want a violation of %s", e, tt.wantPolicy)
+				}
+				return
+			}
+			if e != nil || settings.MaxResults != tt.wantMax {
+				t.Errorf("apply() = %+v, MaxResults %d, want nil, %d", e, settings.MaxResults, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestPeerPolicy(t *testing.T) {
+	defer SetPolicy(Policy{}, nil)
+	defaults := Policy{MaxResults: 10, DenyIncludeFiltered: true}
+	if err := SetPolicy(defaults, map[string]Policy{"1001": {}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		peer           string
+		want           Policy
+		wantRestricted bool
+	}{
+		{"root", "uid:0", Policy{}, false},
+		{"user", "uid:1000", defaults, true},
+		{"overridden_user", "uid:1001", Policy{}, true},
+		// remote peers only get the defaults
+		{"http", "http:1001", defaults, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, restricted := PeerPolicy(tt.peer)
+			if got != tt.want || restricted != tt.wantRestricted {
+				t.Errorf("PeerPolicy() = %+v, %v, want %+v, %v", got, restricted, tt.want, tt.wantRestricted)
+			}
+		})
+	}
+
+	if err := SetPolicy(Policy{}, map[string]Policy{"no-such-user-here": {}}); err == nil {
+		t.Error("SetPolicy() with an unknown user succeeded")
+	}
+	if got, _ := PeerPolicy("uid:1000"); got != defaults {
+		t.Errorf("policy after a failed SetPolicy() = %+v, want %+v", got, defaults)
+	}
+}
+
+func TestDispatch_Policy(t *testing.T) {
+	defer SetPolicy(Policy{}, nil)
+	if err := SetPolicy(Policy{MaxResults: 10, DenyIncludeFiltered: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		peer     string
+		settings Settings
+		wantMax  int
+		rejected bool
+	}{
+		{"clamped", "uid:1000", Settings{MaxResults: 50}, 10, false},
+		{"rejected", "uid:1000", Settings{IncludeFiltered: "/tmp"}, 0, true},
+		{"root", "uid:0", Settings{MaxResults: 50, IncludeFiltered: "/tmp"}, 50, false},
+		// only queries are limited
+		{"stats", "uid:1000", Settings{Action: Stats, MaxResults: 50}, 50, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(chan Request, 1)
+			if !tt.rejected {
+				go func() {
+					req := <-received
+					close(req.ResponseChannel)
+					received <- req
+				}()
+			}
+
+			var lines []string
+			err := Dispatch(context.Background(), received,
+				Request{Version: ProtocolVersion, Peer: tt.peer, Settings: tt.settings},
+				func(line string) error {
+					lines = append(lines, line)
+					return nil
+				})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.rejected {
+				e, ok := ParseError(lines[0])
+				if !ok || e.Code != ErrPolicy || e.Policy != PolicyIncludeFiltered {
+					t.Errorf("got %q, want a policy violation", lines)
+				}
+				return
+			}
+			if req := <-received; req.Settings.MaxResults != tt.wantMax {
+				t.Errorf("MaxResults = %d, want %d", req.Settings.MaxResults, tt.wantMax)
+			}
+		})
+	}
+}
@@ -0,0 +1,634 @@
+package request
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// ProtocolVersion is the version of the wire protocol spoken by this build.
+// Clients announce their version in the request, daemons that know about
+// versions answer with a Hello line before the response.
+// Clients without a version and daemons not sending a Hello speak
+// version 0, which only knows about the search actions.
+const ProtocolVersion = 1
+
+// Optional features, negotiated during the handshake
+const (
+	// FeatureStats is the Stats action
+	FeatureStats = "stats"
+	// FeatureFilters are the ListFilters, AddFilter
+	// and RemoveFilter actions
+	FeatureFilters = "filters"
+	// FeatureMetadata are the TypeFilter and SortBy settings
+	FeatureMetadata = "metadata"
+	// FeaturePause are the Pause and Resume actions
+	FeaturePause = "pause"
+	// FeatureDebug is the Debug action
+	FeatureDebug = "debug"
+	// FeatureHealth is the Health action
+	FeatureHealth = "health"
+	// FeatureTiming is the Timing setting
+	FeatureTiming = "timing"
+	// FeatureVersion is the Version action
+	FeatureVersion = "version"
+	// FeatureNullDelimited is the NullDelimited setting
+	FeatureNullDelimited = "null_delimited"
+	// FeatureSegments is the SegmentSearch action
+	FeatureSegments = "segments"
+	// FeatureDuplicates is the Duplicates action
+	FeatureDuplicates = "duplicates"
+	// FeatureChangedSince is the ChangedSince action
+	FeatureChangedSince = "changed_since"
+	// FeatureStatus is the Status line ending the results of searches
+	FeatureStatus = "status"
+	// FeatureBatch is the Batch action
+	FeatureBatch = "batch"
+	// FeatureWarnings are the Warning lines sent with the results
+	FeatureWarnings = "warnings"
+	// FeatureHistory is the History action
+	FeatureHistory = "history"
+	// FeatureFailures are the Failures and RetryFailures actions
+	FeatureFailures = "failures"
+	// FeatureAliases is Settings.Aliases
+	FeatureAliases = "aliases"
+	// FeatureDescribe is the Describe action
+	FeatureDescribe = "describe"
+	// FeatureJump are the Jump and Visit actions
+	FeatureJump = "jump"
+	// FeatureClasses are Settings.Class and Settings.Sniff
+	FeatureClasses = "classes"
+	// FeatureTags is Settings.Tag
+	FeatureTags = "tags"
+	// FeatureTrash is the Trash action
+	FeatureTrash = "trash"
+	// FeatureDeleted is the Deleted action
+	FeatureDeleted = "deleted"
+	// FeatureTree is the Tree action
+	FeatureTree = "tree"
+	// FeatureRecent is the Recent action
+	FeatureRecent = "recent"
+	// FeatureBackpressure is Settings.Backpressure
+	FeatureBackpressure = "backpressure"
+	// FeatureFraming makes the daemon send the response lines
+	// following the Hello as frames of the protocol package
+	FeatureFraming = "framing"
+	// FeatureCollate is the SortCollate sort key
+	FeatureCollate = "collate"
+	// FeatureVerifyExists is Settings.VerifyExists
+	FeatureVerifyExists = "verify_exists"
+	// FeatureIncludeFiltered is Settings.IncludeFiltered
+	FeatureIncludeFiltered = "include_filtered"
+	// FeatureLinks is the Links action
+	FeatureLinks = "links"
+	// FeatureCollapseHardlinks is Settings.CollapseHardlinks
+	FeatureCollapseHardlinks = "collapse_hardlinks"
+	// FeatureWaitIndex is Settings.WaitIndex
+	FeatureWaitIndex = "wait_index"
+	// FeatureParents is Settings.Parents
+	FeatureParents = "parents"
+	// FeatureWildcards is Settings.Wildcards
+	FeatureWildcards = "wildcards"
+	// FeatureGeneration is the Generation action and
+	// Settings.UnlessGeneration
+	FeatureGeneration = "generation"
+	// FeatureBreakdown is Settings.Breakdown
+	FeatureBreakdown = "breakdown"
+	// FeatureScores is Settings.MinScore and Settings.Scores
+	FeatureScores = "scores"
+)
+
+// SupportedFeatures are the features known to this build
+var SupportedFeatures = []string{
+	FeatureStats, FeatureFilters, FeatureMetadata, FeaturePause,
+	FeatureNullDelimited, FeatureDebug, FeatureHealth, FeatureTiming,
+	FeatureVersion, FeatureSegments, FeatureDuplicates, FeatureChangedSince,
+	FeatureStatus, FeatureBatch, FeatureWarnings, FeatureHistory,
+	FeatureFailures, FeatureAliases, FeatureDescribe, FeatureJump, FeatureClasses,
+	FeatureTags, FeatureTrash, FeatureDeleted, FeatureTree, FeatureBackpressure,
+	FeatureFraming, FeatureCollate, FeatureVerifyExists, FeatureIncludeFiltered,
+	FeatureRecent, FeatureLinks, FeatureCollapseHardlinks, FeatureWaitIndex,
+	FeatureParents, FeatureWildcards, FeatureGeneration, FeatureBreakdown,
+	FeatureScores,
+}
+
+// helloPrefix marks the Hello line, no result line starts with it
+const helloPrefix = "!hello "
+
+// Hello is the daemon's answer to a versioned request
+type Hello struct {
+	// Version is the protocol version both sides speak
+	Version int `json:"version"`
+	// Features are the requested features the daemon supports
+	Features []string `json:"features"`
+}
+
+// Has returns whether feature was agreed on
+func (h Hello) Has(feature string) bool {
+	for _, f := range h.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// NewHello returns the daemon's answer to req, the lower of both versions
+// and the requested features this build supports
+func NewHello(req Request) Hello {
+	hello := Hello{Version: ProtocolVersion, Features: []string{}}
+	if req.Version < hello.Version {
+		hello.Version = req.Version
+	}
+
+	for _, feature := range req.Features {
+		for _, supported := range SupportedFeatures {
+			if feature == supported {
+				hello.Features = append(hello.Features, feature)
+				break
+			}
+		}
+	}
+	return hello
+}
+
+// Wants returns whether the client of req asked for feature,
+// clients predating the handshake know none
+func (req Request) Wants(feature string) bool {
+	if req.Version == 0 {
+		return false
+	}
+	for _, f := range req.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// String encodes the Hello as a response line
+func (h Hello) String() string {
+	encoded, _ := json.Marshal(h)
+	return helloPrefix + string(encoded)
+}
+
+// ParseHello decodes a response line sent by Hello.String.
+// ok is false if the line isn't a Hello, which means the daemon
+// predates the handshake and speaks version 0.
+func ParseHello(line string) (hello Hello, ok bool) {
+	if !strings.HasPrefix(line, helloPrefix) {
+		return Hello{}, false
+	}
+	err := json.Unmarshal([]byte(strings.TrimPrefix(line, helloPrefix)), &hello)
+	return hello, err == nil
+}
+
+// errorPrefix marks the line of an ErrorResponse
+const errorPrefix = "!error "
+
+// Error codes of ErrorResponse
+const (
+	// ErrPermissionDenied is sent if the peer may not use the action
+	ErrPermissionDenied = "permission_denied"
+	// ErrInvalidRequest is sent for requests with invalid settings
+	ErrInvalidRequest = "invalid_request"
+	// ErrBusy is sent for queries exceeding the limits of the peer
+	ErrBusy = "busy"
+	// ErrQueryTooShort is sent for searches with an empty query
+	// without ListAll, or a query shorter than the server's minimum
+	// without NoSort and a result limit
+	ErrQueryTooShort = "query_too_short"
+	// ErrUnknownAction is sent for actions the daemon doesn't know
+	ErrUnknownAction = "unknown_action"
+	// ErrNotIndexed is sent if the root of a request isn't in the index
+	ErrNotIndexed = "not_indexed"
+	// ErrNotFound is sent if the path of a request doesn't exist
+	ErrNotFound = "not_found"
+	// ErrInternal is sent if the daemon failed to handle a request
+	ErrInternal = "internal"
+	// ErrPolicy is sent for queries the server policy doesn't allow,
+	// ErrorResponse.Policy names the part they violate
+	ErrPolicy = "policy"
+)
+
+// ErrorResponse is sent instead of the response to a failed request
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Policy names the part of the server policy a request
+	// rejected with ErrPolicy violates
+	Policy string `json:"policy,omitempty"`
+}
+
+func (e ErrorResponse) Error() string {
+	return e.Message
+}
+
+// Line encodes the error as a response line. Clients predating
+// the handshake get a plain text message.
+func (e ErrorResponse) Line(version int) string {
+	if version == 0 {
+		return "error: " + e.Message
+	}
+	encoded, _ := json.Marshal(e)
+	return errorPrefix + string(encoded)
+}
+
+// ParseError decodes a response line sent for an ErrorResponse
+func ParseError(line string) (e ErrorResponse, ok bool) {
+	if !strings.HasPrefix(line, errorPrefix) {
+		return ErrorResponse{}, false
+	}
+	err := json.Unmarshal([]byte(strings.TrimPrefix(line, errorPrefix)), &e)
+	return e, err == nil
+}
+
+// warningPrefix marks the line of a Warning, no result line starts with it
+const warningPrefix = "!warning "
+
+// Warning codes
+const (
+	// WarnUnreadable is sent if entries couldn't be stat'ed,
+	// they are missing from the results or sorted last
+	WarnUnreadable = "unreadable"
+	// WarnNotSniffed is sent if there were too many files without an
+	// extension to read them for Settings.Sniff, they are missing
+	WarnNotSniffed = "not_sniffed"
+	// WarnWalked is sent if the root of a request isn't indexed, so
+	// the results come from walking it for the request
+	WarnWalked = "walked"
+	// WarnWalkIncomplete is like WarnWalked, but the walk was stopped
+	// at its limits, entries below the root are missing
+	WarnWalkIncomplete = "walk_incomplete"
+	// WarnDropped is sent with BackpressureDrop if results were
+	// dropped because the client didn't receive them fast enough
+	WarnDropped = "dropped"
+	// WarnStaleMount is sent if results are on a mounted filesystem
+	// whose changes aren't watched or that wasn't read since it was
+	// mounted, once for each of them
+	WarnStaleMount = "stale_mount"
+	// WarnVanished is sent with Settings.VerifyExists if results
+	// vanished since they were indexed, they were dropped
+	WarnVanished = "vanished"
+	// WarnNotVerified is sent with Settings.VerifyExists if the server
+	// stopped stat'ing the results at its limit, the rest were sent
+	// without checking them
+	WarnNotVerified = "not_verified"
+	// WarnRecentIncomplete is sent with Recent if the entries created
+	// at the start of the duration aren't all kept anymore
+	WarnRecentIncomplete = "recent_incomplete"
+	// WarnLinksMissing is sent with Links if not all hard links to
+	// the file are indexed
+	WarnLinksMissing = "links_missing"
+	// WarnCold is sent if results are from the cold tier, which
+	// misses the changes since it was read
+	WarnCold = "cold"
+	// WarnPartialIndex is sent before the results of a search answered
+	// while the index is built, naming the directories not walked yet
+	WarnPartialIndex = "partial_index"
+)
+
+// Warning is sent with the results of a search to clients wanting
+// FeatureWarnings, if the results may be incomplete or outdated
+type Warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Line encodes the warning as a response line
+func (w Warning) Line() string {
+	encoded, _ := json.Marshal(w)
+	return warningPrefix + string(encoded)
+}
+
+// ParseWarning decodes a response line sent for a Warning
+func ParseWarning(line string) (w Warning, ok bool) {
+	if !strings.HasPrefix(line, warningPrefix) {
+		return Warning{}, false
+	}
+	err := json.Unmarshal([]byte(strings.TrimPrefix(line, warningPrefix)), &w)
+	return w, err == nil
+}
+
+// aliasSuffix marks the results sent at an alias of their directory
+const aliasSuffix = "\talias"
+
+// AliasLine encodes a result at an alias of its directory as a
+// response line
+func AliasLine(path string) string {
+	return path + aliasSuffix
+}
+
+// ParseAlias returns the path of a response line sent for a result
+// at an alias, ok is false for other lines
+func ParseAlias(line string) (path string, ok bool) {
+	if !strings.HasPrefix(line, "/") {
+		return "", false
+	}
+	return strings.CutSuffix(line, aliasSuffix)
+}
+
+// filteredSuffix marks the results found below
+// Settings.IncludeFiltered, they aren't indexed
+const filteredSuffix = "\tfiltered"
+
+// FilteredLine encodes a result found by walking a filtered directory
+// as a response line
+func FilteredLine(path string) string {
+	return path + filteredSuffix
+}
+
+// ParseFiltered returns the path of a response line sent for a result
+// in a filtered directory, ok is false for other lines
+func ParseFiltered(line string) (path string, ok bool) {
+	if !strings.HasPrefix(line, "/") {
+		return "", false
+	}
+	return strings.CutSuffix(line, filteredSuffix)
+}
+
+// linksSeparator precedes the number of hard links dropped
+// from the results with Settings.CollapseHardlinks
+const linksSeparator = "\tlinks="
+
+// LinksLine encodes a result whose other hard links were dropped,
+// suppressed of them, as a response line
+func LinksLine(path string, suppressed int) string {
+	return path + linksSeparator + strconv.Itoa(suppressed)
+}
+
+// ParseLinks returns the path of a response line sent for a result
+// whose other hard links were dropped and their number, ok is false
+// for other lines
+func ParseLinks(line string) (path string, suppressed int, ok bool) {
+	if !strings.HasPrefix(line, "/") {
+		return "", 0, false
+	}
+	i := strings.LastIndex(line, linksSeparator)
+	if i < 0 {
+		return "", 0, false
+	}
+	suppressed, err := strconv.Atoi(line[i+len(linksSeparator):])
+	if err != nil {
+		return "", 0, false
+	}
+	return line[:i], suppressed, true
+}
+
+// ScoreVersion is the version of the formula of FuzzyScore. It is
+// increased whenever the formula changes, so a minimum score keeps
+// its meaning as long as the version stays the same.
+const ScoreVersion = 1
+
+// FuzzyScore returns the score of a fuzzy match in a name of nameLength
+// bytes, where skipped bytes lie between the matched characters of the
+// query: 1 - skipped/nameLength. Names containing the query score 1,
+// the further the query is spread out in the name, the lower it gets,
+// but it stays above 0.
+func FuzzyScore(skipped, nameLength int) float64 {
+	if nameLength == 0 {
+		return 1
+	}
+	return 1 - float64(skipped)/float64(nameLength)
+}
+
+// scoreSeparator precedes the score of a result sent
+// with Settings.Scores
+const scoreSeparator = "\tscore="
+
+// ScoreLine encodes a result of a fuzzy search with its FuzzyScore
+// as a response line
+func ScoreLine(path string, score float64) string {
+	return path + scoreSeparator + strconv.FormatFloat(score, 'f', 3, 64)
+}
+
+// ParseScore returns the path and score of a response line sent for
+// a result with Settings.Scores, ok is false for other lines
+func ParseScore(line string) (path string, score float64, ok bool) {
+	if !strings.HasPrefix(line, "/") {
+		return "", 0, false
+	}
+	i := strings.LastIndex(line, scoreSeparator)
+	if i < 0 {
+		return "", 0, false
+	}
+	score, err := strconv.ParseFloat(line[i+len(scoreSeparator):], 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return line[:i], score, true
+}
+
+// RequiredFeatures returns the features the daemon has to support
+// to handle a request with the given settings
+func RequiredFeatures(settings Settings) []string {
+	var features []string
+	switch settings.Action {
+	case Stats:
+		features = append(features, FeatureStats)
+	case ListFilters, AddFilter, RemoveFilter:
+		features = append(features, FeatureFilters)
+	case Pause, Resume:
+		features = append(features, FeaturePause)
+	case Debug:
+		features = append(features, FeatureDebug)
+	case Health:
+		features = append(features, FeatureHealth)
+	case Version:
+		features = append(features, FeatureVersion)
+	case SegmentSearch:
+		features = append(features, FeatureSegments)
+	case Duplicates:
+		features = append(features, FeatureDuplicates)
+	case ChangedSince:
+		features = append(features, FeatureChangedSince)
+	case Batch:
+		features = append(features, FeatureBatch)
+	case History:
+		features = append(features, FeatureHistory)
+	case Failures, RetryFailures:
+		features = append(features, FeatureFailures)
+	case Describe:
+		features = append(features, FeatureDescribe)
+	case Jump, Visit:
+		features = append(features, FeatureJump)
+	case Trash:
+		features = append(features, FeatureTrash)
+	case Deleted:
+		features = append(features, FeatureDeleted)
+	case Tree:
+		features = append(features, FeatureTree)
+	case Recent:
+		features = append(features, FeatureRecent)
+	case Links:
+		features = append(features, FeatureLinks)
+	case Generation:
+		features = append(features, FeatureGeneration)
+	}
+	if settings.TypeFilter != "" || settings.SortBy != "" {
+		features = append(features, FeatureMetadata)
+	}
+	if settings.SortBy == SortCollate {
+		features = append(features, FeatureCollate)
+	}
+	if settings.NullDelimited {
+		features = append(features, FeatureNullDelimited)
+	}
+	if settings.Timing {
+		features = append(features, FeatureTiming)
+	}
+	if settings.Aliases {
+		features = append(features, FeatureAliases)
+	}
+	if settings.Class != "" {
+		features = append(features, FeatureClasses)
+	}
+	if settings.Tag != "" {
+		features = append(features, FeatureTags)
+	}
+	if settings.Backpressure != "" {
+		features = append(features, FeatureBackpressure)
+	}
+	if settings.VerifyExists {
+		features = append(features, FeatureVerifyExists)
+	}
+	if settings.IncludeFiltered != "" {
+		features = append(features, FeatureIncludeFiltered)
+	}
+	if settings.CollapseHardlinks {
+		features = append(features, FeatureCollapseHardlinks)
+	}
+	if settings.WaitIndex {
+		features = append(features, FeatureWaitIndex)
+	}
+	if settings.Parents {
+		features = append(features, FeatureParents)
+	}
+	if settings.Wildcards {
+		features = append(features, FeatureWildcards)
+	}
+	if settings.UnlessGeneration != 0 {
+		features = append(features, FeatureGeneration)
+	}
+	if settings.Breakdown != 0 {
+		features = append(features, FeatureBreakdown)
+	}
+	if settings.MinScore != 0 || settings.Scores {
+		features = append(features, FeatureScores)
+	}
+	return features
+}
+
+// timingPrefix marks the Timing line, no result line starts with it
+const timingPrefix = "!timing "
+
+// Timing is sent after the results of a search with Settings.Timing,
+// the durations of its phases are in seconds
+type Timing struct {
+	// Visit is the time spent walking the index
+	Visit float64 `json:"visit"`
+	// Sort is the time spent sorting the matches
+	Sort float64 `json:"sort"`
+	// Stream is the time spent sending the results
+	Stream float64 `json:"stream"`
+	// Matches is the number of paths found
+	Matches int `json:"matches"`
+	// Results is the number of paths sent
+	Results int `json:"results"`
+}
+
+// Line encodes the timing as a response line
+func (t Timing) Line() string {
+	encoded, _ := json.Marshal(t)
+	return timingPrefix + string(encoded)
+}
+
+// ParseTiming decodes a response line sent for a Timing
+func ParseTiming(line string) (t Timing, ok bool) {
+	if !strings.HasPrefix(line, timingPrefix) {
+		return Timing{}, false
+	}
+	err := json.Unmarshal([]byte(strings.TrimPrefix(line, timingPrefix)), &t)
+	return t, err == nil
+}
+
+// statusPrefix marks the Status line, no result line starts with it
+const statusPrefix = "!status "
+
+// Status is the last line sent for a search to clients wanting
+// FeatureStatus, it tells an empty result set apart from a lost
+// connection
+type Status struct {
+	// Matches is the number of paths found, or names for Duplicates
+	Matches int `json:"matches"`
+	// Results is the number sent
+	Results int `json:"results"`
+	// Truncated is set if not all matches were sent
+	// because of the result limit
+	Truncated bool `json:"truncated"`
+	// RequestID is the ID the request was logged with
+	RequestID string `json:"request_id,omitempty"`
+	// AsOf is the unix time up to which the index searched has every
+	// change, changes made while the search ran aren't seen by it
+	AsOf int64 `json:"as_of,omitempty"`
+	// Generation is that of the index searched, see GenerationResponse
+	Generation uint64 `json:"generation,omitempty"`
+	// Unchanged is set instead of sending results if the index is
+	// still of Settings.UnlessGeneration. Such a status is sent even
+	// to clients that don't want FeatureStatus.
+	Unchanged bool `json:"unchanged,omitempty"`
+	// ScoreVersion is that of the scores of a fuzzy search with
+	// Settings.MinScore or Settings.Scores
+	ScoreVersion int `json:"score_version,omitempty"`
+}
+
+// Line encodes the status as a response line
+func (s Status) Line() string {
+	encoded, _ := json.Marshal(s)
+	return statusPrefix + string(encoded)
+}
+
+// ParseStatus decodes a response line sent for a Status
+func ParseStatus(line string) (s Status, ok bool) {
+	if !strings.HasPrefix(line, statusPrefix) {
+		return Status{}, false
+	}
+	err := json.Unmarshal([]byte(strings.TrimPrefix(line, statusPrefix)), &s)
+	return s, err == nil
+}
+
+// batchPrefix marks the lines of a BatchResponse
+const batchPrefix = "!batch "
+
+// BatchResponse is a response line to a request of a batch
+type BatchResponse struct {
+	// ID is the ID of the request answered
+	ID int
+	// Line is the response line without its terminator, it is empty
+	// on the last line sent for the request
+	Line string
+}
+
+// String encodes the response as a line
+func (b BatchResponse) String() string {
+	if b.Line == "" {
+		return batchPrefix + strconv.Itoa(b.ID)
+	}
+	return batchPrefix + strconv.Itoa(b.ID) + " " + b.Line
+}
+
+// ParseBatchResponse decodes a line sent for a BatchResponse
+func ParseBatchResponse(line string) (b BatchResponse, ok bool) {
+	if !strings.HasPrefix(line, batchPrefix) {
+		return BatchResponse{}, false
+	}
+	id, rest := strings.TrimPrefix(line, batchPrefix), ""
+	if i := strings.IndexByte(id, ' '); i >= 0 {
+		id, rest = id[:i], id[i+1:]
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return BatchResponse{}, false
+	}
+	return BatchResponse{n, rest}, true
+}
@@ -0,0 +1,566 @@
+package request
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeRequest_Compatibility(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		version int
+		query   string
+	}{
+		{
+			"old_client",
+			`{"data":"foo","settings":{"action":2,"max_results":10}}`,
+			0,
+			"foo",
+		},
+		{
+			"new_client",
+			`{"version":1,"features":["stats"],"data":"foo","settings":{"action":2}}`,
+			1,
+			"foo",
+		},
+		{
+			"newer_client_unknown_fields",
+			`{"version":7,"features":["stats","metadata"],"data":"foo",` +
+				`"settings":{"action":2,"sort_by":"mtime"},"page":3}`,
+			7,
+			"foo",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req Request
+			if err := json.Unmarshal([]byte(tt.json), &req); err != nil {
+				t.Fatal(err)
+			}
+			if req.Version != tt.version || req.Query != tt.query ||
+				req.Settings.Action != FuzzySearch {
+				t.Errorf("decoded %+v", req)
+			}
+		})
+	}
+}
+
+func TestEncodeRequest_OldDaemon(t *testing.T) {
+	// old daemons decode into a struct without the handshake fields
+	type oldRequest struct {
+		Query    string `json:"data"`
+		Settings struct {
+			Action     int `json:"action"`
+			MaxResults int `json:"max_results"`
+		} `json:"settings"`
+	}
+
+	req := Request{
+		Version:  ProtocolVersion,
+		Features: SupportedFeatures,
+		Query:    "foo",
+		Settings: Settings{Action: PrefixSearch, MaxResults: 5},
+	}
+	encoded, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var old oldRequest
+	if err := json.Unmarshal(encoded, &old); err != nil {
+		t.Fatal(err)
+	}
+	if old.Query != "foo" || old.Settings.Action != PrefixSearch ||
+		old.Settings.MaxResults != 5 {
+		t.Errorf("old daemon decoded %+v", old)
+	}
+}
+
+func TestNewHello(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+		want Hello
+	}{
+		{
+			"same_version",
+			Request{Version: ProtocolVersion, Features: SupportedFeatures},
+			Hello{ProtocolVersion, SupportedFeatures},
+		},
+		{
+			"newer_client",
+			Request{Version: ProtocolVersion + 1,
+				Features: []string{"pagination", FeatureStats}},
+			Hello{ProtocolVersion, []string{FeatureStats}},
+		},
+		{
+			"no_features",
+			Request{Version: 1},
+			Hello{1, []string{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewHello(tt.req)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewHello() = %+v, want %+v", got, tt.want)
+			}
+
+			parsed, ok := ParseHello(got.String())
+			if !ok || !reflect.DeepEqual(parsed, tt.want) {
+				t.Errorf("ParseHello() = %+v, %v, want %+v", parsed, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHello_OldDaemon(t *testing.T) {
+	for _, line := range []string{"/home/user/file", "rules\t- *", `{"indexed_files":1}`} {
+		if hello, ok := ParseHello(line); ok || hello.Has(FeatureStats) {
+			t.Errorf("ParseHello(%q) = %+v, %v, want no hello", line, hello, ok)
+		}
+	}
+}
+
+func TestServe_Handshake(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+		want string
+	}{
+		{
+			"old_client",
+			Request{Query: "foo"},
+			"/foo\n",
+		},
+		{
+			"new_client",
+			Request{Version: ProtocolVersion, Features: []string{FeatureStats}, Query: "foo"},
+			Hello{ProtocolVersion, []string{FeatureStats}}.String() + "\n/foo\n",
+		},
+		{
+			"null_delimited",
+			Request{Version: ProtocolVersion, Query: "foo\nbar",
+				Settings: Settings{NullDelimited: true}},
+			Hello{ProtocolVersion, []string{}}.String() + "\n/foo\nbar\x00",
+		},
+		{
+			"framed",
+			Request{Version: ProtocolVersion, Features: []string{FeatureFraming}, Query: "foo\nbar"},
+			Hello{ProtocolVersion, []string{FeatureFraming}}.String() + "\n" +
+				"\x00\x00\x00\x08\x01/foo\nbar",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			requests := make(chan Request)
+			go serve(server, requests, nil)
+			go func() {
+				req := <-requests
+				req.ResponseChannel <- "/" + req.Query
+				close(req.ResponseChannel)
+			}()
+
+			if err := json.NewEncoder(client).Encode(tt.req); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ioutil.ReadAll(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServe_InvalidRequest(t *testing.T) {
+	client, server := net.Pipe()
+	go serve(server, make(chan Request), nil)
+	go client.Write([]byte(`{"data":}`))
+
+	got, err := ioutil.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := ParseError(strings.TrimSuffix(string(got), "\n"))
+	if !ok || e.Code != ErrInvalidRequest {
+		t.Errorf("got %q, want an %s error", got, ErrInvalidRequest)
+	}
+}
+
+func TestSettings_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		wantErr  bool
+	}{
+		{"defaults", Settings{}, false},
+		{"directories_by_mtime", Settings{TypeFilter: TypeDirectory, SortBy: SortMtime}, false},
+		{"files_fuzzy", Settings{Action: FuzzySearch, TypeFilter: TypeFile}, false},
+		{"invalid_type", Settings{TypeFilter: "x"}, true},
+		{"type_path_search", Settings{Action: PathSearch, TypeFilter: TypeFile}, true},
+		{"invalid_sort", Settings{SortBy: "size"}, true},
+		{"sort_nosort", Settings{SortBy: SortMtime, NoSort: true}, true},
+		{"negative_limit", Settings{MaxResults: -1}, true},
+		{"duplicates", Settings{Action: Duplicates, MinCount: 3, Root: "/home", TypeFilter: TypeFile}, false},
+		{"min_count_search", Settings{Action: FuzzySearch, MinCount: 3}, true},
+		{"root_search", Settings{Action: PrefixSearch, Root: "/home"}, true},
+		{"negative_min_count", Settings{Action: Duplicates, MinCount: -1}, true},
+		{"relative_root", Settings{Action: Duplicates, Root: "home"}, true},
+		{"sorted_duplicates", Settings{Action: Duplicates, SortBy: SortMtime}, true},
+		{"changed_since", Settings{Action: ChangedSince, Since: 1700000000, Root: "/home", TypeFilter: TypeFile}, false},
+		{"changed_since_without_time", Settings{Action: ChangedSince, Root: "/home"}, true},
+		{"since_search", Settings{Action: FuzzySearch, Since: 1700000000}, true},
+		{"sorted_changes", Settings{Action: ChangedSince, Since: 1700000000, SortBy: SortLength}, true},
+		{"jump", Settings{Action: Jump, TypeFilter: TypeDirectory, MaxResults: 1}, false},
+		{"jump_files", Settings{Action: Jump, TypeFilter: TypeFile}, true},
+		{"sorted_jump", Settings{Action: Jump, SortBy: SortLength}, true},
+		{"class", Settings{Action: FuzzySearch, Class: "image", Sniff: true}, false},
+		{"class_directories", Settings{Class: "image", TypeFilter: TypeDirectory}, true},
+		{"class_duplicates", Settings{Action: Duplicates, Class: "image"}, true},
+		{"sniff_without_class", Settings{Sniff: true}, true},
+		{"sniff_changes", Settings{Action: ChangedSince, Since: 1, Class: "image", Sniff: true}, true},
+		{"tag_changes", Settings{Action: ChangedSince, Since: 1, Tag: "work"}, false},
+		{"tag_path_search", Settings{Action: PathSearch, Tag: "work"}, true},
+		{"typed_trash", Settings{Action: Trash, TypeFilter: TypeFile}, true},
+		{"fuzzy_deleted", Settings{Action: Deleted, Match: FuzzySearch, TypeFilter: TypeFile}, false},
+		{"match_without_deleted", Settings{Action: FuzzySearch, Match: PrefixSearch}, true},
+		{"invalid_match", Settings{Action: Deleted, Match: PathSearch}, true},
+		{"typed_tree", Settings{Action: Tree, TypeFilter: TypeDirectory}, true},
+		{"prefix_recent", Settings{Action: Recent, Within: 600, Match: PrefixSearch, TypeFilter: TypeFile}, false},
+		{"recent_without_duration", Settings{Action: Recent}, true},
+		{"duration_without_recent", Settings{Within: 600}, true},
+		{"sorted_recent", Settings{Action: Recent, Within: 600, SortBy: SortLength}, true},
+		{"links", Settings{Action: Links, MaxResults: 10}, false},
+		{"typed_links", Settings{Action: Links, TypeFilter: TypeFile}, true},
+		{"collapse_hardlinks", Settings{Action: FuzzySearch, CollapseHardlinks: true}, false},
+		{"collapse_hardlinks_duplicates", Settings{Action: Duplicates, CollapseHardlinks: true}, true},
+		{"collapse_hardlinks_aliases", Settings{CollapseHardlinks: true, Aliases: true}, true},
+		{"wait_index", Settings{Action: Duplicates, WaitIndex: true}, false},
+		{"wait_index_stats", Settings{Action: Stats, WaitIndex: true}, true},
+		{"parents_root", Settings{Action: FuzzySearch, Parents: true, Root: "/srv"}, false},
+		{"parents_jump", Settings{Action: Jump, Parents: true}, true},
+		{"parents_collapse_hardlinks", Settings{Parents: true, CollapseHardlinks: true}, true},
+		{"wildcards_prefix", Settings{Action: PrefixSearch, Wildcards: true}, false},
+		{"wildcards_fuzzy", Settings{Action: FuzzySearch, Wildcards: true}, true},
+		{"unless_generation", Settings{Action: SegmentSearch, UnlessGeneration: 7}, false},
+		{"unless_generation_changed_since", Settings{Action: ChangedSince, Since: 1, UnlessGeneration: 7}, true},
+		{"breakdown", Settings{Action: Stats, Breakdown: 2}, false},
+		{"breakdown_levels", Settings{Action: Stats, Breakdown: 3}, true},
+		{"breakdown_search", Settings{Breakdown: 1}, true},
+		{"min_score", Settings{Action: FuzzySearch, MinScore: 0.5, Scores: true}, false},
+		{"min_score_range", Settings{Action: FuzzySearch, MinScore: 1.5}, true},
+		{"min_score_substring", Settings{MinScore: 0.5}, true},
+		{"scores_aliases", Settings{Action: FuzzySearch, Scores: true, Aliases: true}, true},
+		{"scores_mtime", Settings{Action: FuzzySearch, Scores: true, SortBy: SortMtime}, true},
+		{"drop", Settings{Backpressure: BackpressureDrop}, false},
+		{"invalid_backpressure", Settings{Backpressure: "spill"}, true},
+		{"collate", Settings{SortBy: SortCollate, Locale: "de_DE.UTF-8"}, false},
+		{"locale_without_collate", Settings{SortBy: SortMtime, Locale: "de"}, true},
+		{"include_filtered", Settings{Action: PrefixSearch, IncludeFiltered: "/src/node_modules"}, false},
+		{"relative_filtered", Settings{IncludeFiltered: "node_modules"}, true},
+		{"filtered_duplicates", Settings{Action: Duplicates, IncludeFiltered: "/src/node_modules"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.settings.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequiredFeatures(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		want     []string
+	}{
+		{"search", Settings{Action: SubStringSearch, MaxResults: 20}, nil},
+		{"stats", Settings{Action: Stats}, []string{FeatureStats}},
+		{"type", Settings{TypeFilter: TypeDirectory}, []string{FeatureMetadata}},
+		{"sort", Settings{SortBy: SortMtime}, []string{FeatureMetadata}},
+		{"collate", Settings{SortBy: SortCollate}, []string{FeatureMetadata, FeatureCollate}},
+		{"pause", Settings{Action: Pause}, []string{FeaturePause}},
+		{"resume", Settings{Action: Resume}, []string{FeaturePause}},
+		{"debug", Settings{Action: Debug}, []string{FeatureDebug}},
+		{"health", Settings{Action: Health}, []string{FeatureHealth}},
+		{"version", Settings{Action: Version}, []string{FeatureVersion}},
+		{"segments", Settings{Action: SegmentSearch}, []string{FeatureSegments}},
+		{"duplicates", Settings{Action: Duplicates, MinCount: 3}, []string{FeatureDuplicates}},
+		{"changed_since", Settings{Action: ChangedSince, Since: 1}, []string{FeatureChangedSince}},
+		{"visit", Settings{Action: Visit}, []string{FeatureJump}},
+		{"class", Settings{Class: "video"}, []string{FeatureClasses}},
+		{"tag", Settings{Tag: "work"}, []string{FeatureTags}},
+		{"trash", Settings{Action: Trash}, []string{FeatureTrash}},
+		{"deleted", Settings{Action: Deleted}, []string{FeatureDeleted}},
+		{"tree", Settings{Action: Tree}, []string{FeatureTree}},
+		{"recent", Settings{Action: Recent, Within: 600}, []string{FeatureRecent}},
+		{"links", Settings{Action: Links}, []string{FeatureLinks}},
+		{"collapse_hardlinks", Settings{CollapseHardlinks: true}, []string{FeatureCollapseHardlinks}},
+		{"wait_index", Settings{WaitIndex: true}, []string{FeatureWaitIndex}},
+		{"parents", Settings{Parents: true}, []string{FeatureParents}},
+		{"wildcards", Settings{Wildcards: true}, []string{FeatureWildcards}},
+		{"generation", Settings{Action: Generation}, []string{FeatureGeneration}},
+		{"unless_generation", Settings{UnlessGeneration: 7}, []string{FeatureGeneration}},
+		{"breakdown", Settings{Action: Stats, Breakdown: 1}, []string{FeatureStats, FeatureBreakdown}},
+		{"min_score", Settings{Action: FuzzySearch, MinScore: 0.5}, []string{FeatureScores}},
+		{"backpressure", Settings{Backpressure: BackpressureDrop}, []string{FeatureBackpressure}},
+		{"include_filtered", Settings{IncludeFiltered: "/src/node_modules"}, []string{FeatureIncludeFiltered}},
+		{"batch", Settings{Action: Batch, NullDelimited: true}, []string{FeatureBatch, FeatureNullDelimited}},
+		{"null_delimited", Settings{NullDelimited: true}, []string{FeatureNullDelimited}},
+		{"timing", Settings{Action: FuzzySearch, Timing: true}, []string{FeatureTiming}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RequiredFeatures(tt.settings); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RequiredFeatures() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		want     string
+	}{
+		{
+			"plain_search",
+			Settings{Action: SubStringSearch, MaxResults: 20},
+			`{"action":0,"max_results":20,"no_sort":false,"reverse_sort":false,` +
+				`"case_insensitive":false,"persist":false}`,
+		},
+		{
+			"type_and_sort",
+			Settings{Action: SubStringSearch, MaxResults: 20,
+				TypeFilter: TypeDirectory, SortBy: SortMtime},
+			`{"action":0,"max_results":20,"no_sort":false,"reverse_sort":false,` +
+				`"case_insensitive":false,"persist":false,"type_filter":"d","sort_by":"mtime"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := json.Marshal(tt.settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(encoded) != tt.want {
+				t.Errorf("encoded %s, want %s", encoded, tt.want)
+			}
+
+			var decoded Settings
+			if err := json.Unmarshal(encoded, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if decoded != tt.settings {
+				t.Errorf("decoded %+v, want %+v", decoded, tt.settings)
+			}
+		})
+	}
+}
+
+func TestParseTiming(t *testing.T) {
+	timing := Timing{Visit: 0.5, Sort: 0.25, Stream: 0.125, Matches: 1000, Results: 250}
+	tests := []struct {
+		name   string
+		line   string
+		want   Timing
+		wantOk bool
+	}{
+		{"timing", timing.Line(), timing, true},
+		{"result", "/home/user/timing", Timing{}, false},
+		{"invalid", timingPrefix + "{", Timing{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseTiming(tt.line)
+			if ok != tt.wantOk || (ok && got != tt.want) {
+				t.Errorf("ParseTiming() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	status := Status{Matches: 1000, Results: 250, Truncated: true}
+	tests := []struct {
+		name   string
+		line   string
+		want   Status
+		wantOk bool
+	}{
+		{"status", status.Line(), status, true},
+		{"empty", Status{}.Line(), Status{}, true},
+		{"timing", Timing{}.Line(), Status{}, false},
+		{"result", "/home/user/status", Status{}, false},
+		{"invalid", statusPrefix + "{", Status{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseStatus(tt.line)
+			if ok != tt.wantOk || (ok && got != tt.want) {
+				t.Errorf("ParseStatus() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestParseWarning(t *testing.T) {
+	warning := Warning{Code: WarnUnreadable, Message: "couldn't stat 3 entries"}
+	tests := []struct {
+		name   string
+		line   string
+		want   Warning
+		wantOk bool
+	}{
+		{"warning", warning.Line(), warning, true},
+		{"error", ErrorResponse{Code: ErrBusy, Message: "busy"}.Line(1), Warning{}, false},
+		{"result", "/home/user/warning", Warning{}, false},
+		{"invalid", warningPrefix + "{", Warning{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseWarning(tt.line)
+			if ok != tt.wantOk || (ok && got != tt.want) {
+				t.Errorf("ParseWarning() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestParseAlias(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		want   string
+		wantOk bool
+	}{
+		{"alias", AliasLine("/mnt/data/report.pdf"), "/mnt/data/report.pdf", true},
+		{"result", "/home/user/alias", "", false},
+		{"history", "2024-01-02T03:04:05Z\tcreate\t/home/user\talias", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseAlias(tt.line)
+			if ok != tt.wantOk || (ok && got != tt.want) {
+				t.Errorf("ParseAlias() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestParseFiltered(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		want   string
+		wantOk bool
+	}{
+		{"filtered", FilteredLine("/src/node_modules/left-pad"), "/src/node_modules/left-pad", true},
+		{"alias", AliasLine("/mnt/data/report.pdf"), "", false},
+		{"result", "/home/user/filtered", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseFiltered(tt.line)
+			if ok != tt.wantOk || (ok && got != tt.want) {
+				t.Errorf("ParseFiltered() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestParseLinks(t *testing.T) {
+	tests := []struct {
+		name           string
+		line           string
+		want           string
+		wantSuppressed int
+		wantOk         bool
+	}{
+		{"links", LinksLine("/srv/backup/daily/report.pdf", 3), "/srv/backup/daily/report.pdf", 3, true},
+		{"tab_in_name", LinksLine("/srv/a\tlinks=b", 1), "/srv/a\tlinks=b", 1, true},
+		{"filtered", FilteredLine("/src/node_modules/left-pad"), "", 0, false},
+		{"result", "/home/user/links=2", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, suppressed, ok := ParseLinks(tt.line)
+			if ok != tt.wantOk || (ok && (got != tt.want || suppressed != tt.wantSuppressed)) {
+				t.Errorf("ParseLinks() = %q, %d, %v, want %q, %d, %v", got, suppressed, ok,
+					tt.want, tt.wantSuppressed, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestParseScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		want      string
+		wantScore float64
+		wantOk    bool
+	}{
+		{"score", ScoreLine("/home/user/report.pdf", 0.75), "/home/user/report.pdf", 0.75, true},
+		{"rounded", ScoreLine("/a", 2.0/3), "/a", 0.667, true},
+		{"links", LinksLine("/srv/a", 1), "", 0, false},
+		{"result", "/home/user/score=1", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, score, ok := ParseScore(tt.line)
+			if ok != tt.wantOk || (ok && (got != tt.want || score != tt.wantScore)) {
+				t.Errorf("ParseScore() = %q, %g, %v, want %q, %g, %v", got, score, ok,
+					tt.want, tt.wantScore, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		skipped, nameLength int
+		want                float64
+	}{
+		{0, 10, 1},
+		{5, 10, 0.5},
+		{9, 12, 0.25},
+		{0, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := FuzzyScore(tt.skipped, tt.nameLength); got != tt.want {
+			t.Errorf("FuzzyScore(%d, %d) = %g, want %g", tt.skipped, tt.nameLength, got, tt.want)
+		}
+	}
+}
+
+func TestRequest_Wants(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+		want bool
+	}{
+		{"requested", Request{Version: 1, Features: []string{FeatureTiming, FeatureStatus}}, true},
+		{"not_requested", Request{Version: 1, Features: []string{FeatureTiming}}, false},
+		{"unversioned", Request{Features: []string{FeatureStatus}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.Wants(FeatureStatus); got != tt.want {
+				t.Errorf("Wants() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,13 +1,23 @@
 package request
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	stderrors "errors"
+	"io"
+	"io/ioutil"
+	"log/slog"
 	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/version"
+	"github.com/pkg/errors"
 )
 
-// SockAddr is the path at which the unix domain socket is created
+// SockAddr is the default path at which the unix domain socket is created
 const SockAddr = "/run/gosearch.sock"
 
 const (
@@ -20,11 +30,95 @@ const (
 	PathSearch
 	// IndexRefresh refreshes the whole database over the files
 	IndexRefresh
+	// Stats returns statistics about the index as a single JSON line
+	Stats
+	// ListFilters returns the effective filter list, one filter per line
+	ListFilters
+	// AddFilter adds the glob filter given as query
+	AddFilter
+	// RemoveFilter removes the glob filter given as query
+	RemoveFilter
+	// RefreshPath rescans the directory given as query
+	// and everything below it
+	RefreshPath
+	// Pause stops applying filesystem events to the index
+	Pause
+	// Resume applies the events received while paused
+	Resume
+	// Debug writes a heap profile and reports the memory use
+	Debug
+	// Health rates whether the index is complete and up to date
+	Health
+	// Version describes the build of the daemon
+	Version
+	// SegmentSearch does a fuzzy search on file/directory names,
+	// the parts of the query before a slash have to match the
+	// names of their parent directories
+	SegmentSearch
+	// Duplicates finds names shared by at least MinCount entries,
+	// the query is an optional glob pattern the names have to match.
+	// Each name is sent followed by its paths.
+	Duplicates
+	// ChangedSince finds the entries modified after Since
+	ChangedSince
+	// Batch reads more requests from the connection, each with an ID,
+	// until the client closes it for writing. Their responses are
+	// framed as BatchResponse lines.
+	Batch
+	// History sends the changes recorded in the journal for the paths
+	// matching the query, a glob pattern or a substring, oldest first
+	History
+	// Failures lists the directories that couldn't be read, so the
+	// entries below them are missing from the index
+	Failures
+	// RetryFailures reads the directories that couldn't be read again,
+	// including those permission was denied to repeatedly
+	RetryFailures
+	// Describe sends what the index covers as a Description
+	Describe
+	// Jump finds the directories whose name starts with the query,
+	// those the peer visited most often and most recently first
+	Jump
+	// Visit records that the peer changed into the directory given
+	// as query, which ranks it higher in Jump results
+	Visit
+	// Trash searches the trash directories, which aren't indexed,
+	// for the entries whose original path matches the query, a glob
+	// pattern or a substring, the most recently deleted last
+	Trash
+	// Deleted searches the entries recently deleted from the index
+	// for the names matching the query like Settings.Match finds them,
+	// the most recently deleted last
+	Deleted
+	// Tree sends the number of entries at and below each entry of the
+	// directory given as query, the largest first, followed by that of
+	// the directory, like du --inodes counts them on disk
+	Tree
+	// Recent sends the entries created within the last Within seconds
+	// whose names match the query like Settings.Match finds them,
+	// the most recently created first
+	Recent
+	// Links sends the other indexed paths of the file given as query,
+	// the hard links to the same inode
+	Links
+	// Generation sends the generation of the index new searches run
+	// on as a GenerationResponse, it grows with every change applied
+	Generation
 )
 
 // Request holds the details of a request
 // that was received over the unix domain socket
 type Request struct {
+	// Version is the protocol version of the client, 0 for clients
+	// predating the handshake
+	Version int `json:"version,omitempty"`
+	// Features are the optional features the client wants to use
+	Features []string `json:"features,omitempty"`
+	// ID tells the requests of a batch apart, it is ignored otherwise
+	ID int `json:"id,omitempty"`
+	// RequestID identifies the request in the log of the daemon and
+	// its statistics, it is generated if the client doesn't send one
+	RequestID string `json:"request_id,omitempty"`
 	// Query holds the string which is searched for
 	Query string `json:"data"`
 	// Settings holds some query settings
@@ -32,9 +126,12 @@ type Request struct {
 	// ResponseChannel is the channel
 	// on which the database will send back the results
 	ResponseChannel chan string `json:"-"`
-	// Done is used to signal to the database
+	// Done is closed to signal to the database
 	// that no more results are needed
 	Done chan struct{} `json:"-"`
+	// Peer tells the clients apart like the keys of AcquireQuery,
+	// Jump ranks the directories by the visits of the same peer
+	Peer string `json:"-"`
 }
 
 // TODO: remove double negations
@@ -48,87 +145,707 @@ type Settings struct {
 	// ReverseSort sets the sort-order to ascending in length
 	ReverseSort     bool `json:"reverse_sort"`
 	CaseInsensitive bool `json:"case_insensitive"`
+	// Persist writes filter changes back to the config file
+	Persist bool `json:"persist"`
+	// TypeFilter restricts the results to files (TypeFile)
+	// or directories (TypeDirectory), empty means both
+	TypeFilter string `json:"type_filter,omitempty"`
+	// SortBy is the sort key, SortLength if empty
+	SortBy string `json:"sort_by,omitempty"`
+	// NullDelimited terminates the responses following the hello
+	// with NUL instead of newline, so paths containing newlines
+	// can be told apart
+	NullDelimited bool `json:"null_delimited,omitempty"`
+	// Timing appends a Timing line to the results of searches
+	Timing bool `json:"timing,omitempty"`
+	// MinCount is the number of entries a name needs for Duplicates,
+	// 0 means DefaultMinCount
+	MinCount int `json:"min_count,omitempty"`
+	// Root restricts Duplicates, ChangedSince and searches for Parents
+	// to the entries below it. If it isn't indexed, the server may walk
+	// it for the request.
+	Root string `json:"root,omitempty"`
+	// Since is the unix time in seconds after which the entries found
+	// by ChangedSince were modified
+	Since int64 `json:"since,omitempty"`
+	// Within is the number of seconds before the request in which
+	// the entries found by Recent were created
+	Within int64 `json:"within,omitempty"`
+	// ListAll lets a search with an empty query match every entry,
+	// such searches are rejected otherwise
+	ListAll bool `json:"list_all,omitempty"`
+	// Aliases sends the results below directories reachable at more
+	// than one path, like bind mounts, at the other paths too, as
+	// AliasLine, they aren't indexed there
+	Aliases bool `json:"aliases,omitempty"`
+	// Class restricts the results to the files of a class like
+	// "image", which the daemon maps to their extensions
+	Class string `json:"class,omitempty"`
+	// Sniff also finds the files of Class without an extension by
+	// their content, if there are few enough of them to read
+	Sniff bool `json:"sniff,omitempty"`
+	// Match is the search action Deleted and Recent match the names with,
+	// SubStringSearch, PrefixSearch or FuzzySearch
+	Match int `json:"match,omitempty"`
+	// Tag restricts the results to the entries with the tag, read
+	// from the extended attribute set by tags_xattr. A search with
+	// a tag may have an empty query.
+	Tag string `json:"tag,omitempty"`
+	// Backpressure is what happens to the results the client doesn't
+	// receive as fast as they are found, BackpressureBlock if empty
+	Backpressure string `json:"backpressure,omitempty"`
+	// Locale is the locale SortCollate sorts in, a BCP 47 tag like
+	// "de-DE" or a POSIX locale like "de_DE.UTF-8" as found in
+	// LC_COLLATE. Empty means the root collation.
+	Locale string `json:"locale,omitempty"`
+	// VerifyExists stats the results before sending them and drops
+	// those that vanished since they were indexed, their directories
+	// are read again. The server bounds the number of stats.
+	VerifyExists bool `json:"verify_exists,omitempty"`
+	// IncludeFiltered is a filtered directory that is walked for a
+	// search by name, within the bounds of the lazy walks. The entries
+	// found below it are sent as FilteredLine with the results.
+	IncludeFiltered string `json:"include_filtered,omitempty"`
+	// CollapseHardlinks sends one result for the hard links to a
+	// file, the shortest path, as LinksLine if others were dropped
+	CollapseHardlinks bool `json:"collapse_hardlinks,omitempty"`
+	// WaitIndex holds a search made while the index is built until
+	// the entries it needs, those below Root or all of them, are
+	// indexed, instead of answering it with a WarnPartialIndex
+	WaitIndex bool `json:"wait_index,omitempty"`
+	// Parents sends the directories holding the results of a search
+	// instead, each once, ordered by the best result in it. MaxResults
+	// counts the directories.
+	Parents bool `json:"parents,omitempty"`
+	// Wildcards makes *, ? and [...] in the query of substring and
+	// prefix searches match like in filepath.Match, a \ escapes them.
+	// Without it they only match themselves.
+	Wildcards bool `json:"wildcards,omitempty"`
+	// UnlessGeneration answers a search by name with a Status with
+	// Unchanged set instead of its results if the index it runs on is
+	// still of this generation, 0 always answers it
+	UnlessGeneration uint64 `json:"unless_generation,omitempty"`
+	// Breakdown is the number of levels of directories below the root,
+	// up to 2, Stats breaks the index down by
+	Breakdown int `json:"breakdown,omitempty"`
+	// MinScore drops the matches of a fuzzy search whose FuzzyScore
+	// is below it, from 0 (none) to 1
+	MinScore float64 `json:"min_score,omitempty"`
+	// Scores sends the FuzzyScore of each match of a fuzzy search
+	// with it, see ScoreLine
+	Scores bool `json:"scores,omitempty"`
+}
+
+// DefaultMinCount is the MinCount used if none is set
+const DefaultMinCount = 2
+
+// Delimiter returns the byte terminating the responses
+func (s Settings) Delimiter() byte {
+	if s.NullDelimited {
+		return 0
+	}
+	return '\n'
+}
+
+// Values of Settings.TypeFilter
+const (
+	TypeFile      = "f"
+	TypeDirectory = "d"
+)
+
+// Values of Settings.SortBy
+const (
+	// SortLength sorts by path length, or by fuzzy score
+	// for fuzzy searches
+	SortLength = "length"
+	// SortMtime puts the most recently modified files last
+	SortMtime = "mtime"
+	// SortCollate puts the paths first in the collation order of
+	// Settings.Locale last
+	SortCollate = "collate"
+)
+
+// Values of Settings.Backpressure
+const (
+	// BackpressureBlock makes the search wait for the client once
+	// the response buffer is full, holding on to its copy of the index
+	BackpressureBlock = "block"
+	// BackpressureDrop drops the results that don't fit into the
+	// response buffer, the search never waits for the client
+	BackpressureDrop = "drop"
+)
+
+// Validate checks the combination of settings
+func (s Settings) Validate() error {
+	switch s.TypeFilter {
+	case "", TypeFile, TypeDirectory:
+	default:
+		return errors.Errorf("invalid type %q, expected %q or %q",
+			s.TypeFilter, TypeFile, TypeDirectory)
+	}
+	if s.TypeFilter != "" && s.Action == PathSearch {
+		return errors.New("the type filter can't be used with path searches")
+	}
+
+	switch s.SortBy {
+	case "", SortLength, SortMtime, SortCollate:
+	default:
+		return errors.Errorf("invalid sort key %q, expected %q, %q or %q",
+			s.SortBy, SortLength, SortMtime, SortCollate)
+	}
+	if s.Locale != "" && s.SortBy != SortCollate {
+		return errors.Errorf("a locale can only be given with the %q sort key", SortCollate)
+	}
+	if s.SortBy != "" && s.NoSort {
+		return errors.New("a sort key can't be combined with no_sort")
+	}
+
+	switch s.Backpressure {
+	case "", BackpressureBlock, BackpressureDrop:
+	default:
+		return errors.Errorf("invalid backpressure %q, expected %q or %q",
+			s.Backpressure, BackpressureBlock, BackpressureDrop)
+	}
+
+	if s.MaxResults < 0 {
+		return errors.New("the result limit can't be negative")
+	}
+
+	if s.Action != Duplicates && s.MinCount != 0 {
+		return errors.New("a minimum count can only be used to find duplicates")
+	}
+	if s.Action != Duplicates && s.Action != ChangedSince && !s.Parents && s.Root != "" {
+		return errors.New("a root can only be used to find duplicates, changed entries or parents")
+	}
+	if s.Action == Duplicates && s.SortBy != "" {
+		return errors.New("duplicates are sorted by their count, not by a sort key")
+	}
+	if s.Action == ChangedSince && s.SortBy != "" {
+		return errors.New("changed entries are sorted by their modification time, not by a sort key")
+	}
+	if s.Action == History && (s.SortBy != "" || s.TypeFilter != "") {
+		return errors.New("the history is sent in the order it was recorded, without a type")
+	}
+	if s.Action == Trash && (s.SortBy != "" || s.TypeFilter != "") {
+		return errors.New("the trash is sent in the order it was deleted, without a type")
+	}
+	if s.Action == Tree && (s.SortBy != "" || s.TypeFilter != "") {
+		return errors.New("tree entries are sorted by the number of entries below them, without a type")
+	}
+	if s.Action == Deleted && s.SortBy != "" {
+		return errors.New("deleted entries are sent in the order they were deleted, not by a sort key")
+	}
+	if s.Action == Recent && s.SortBy != "" {
+		return errors.New("recent entries are sent in the order they were created, not by a sort key")
+	}
+	if s.Action == Links && (s.SortBy != "" || s.TypeFilter != "") {
+		return errors.New("links are files sorted by their path, not by a sort key")
+	}
+	switch {
+	case s.Match != SubStringSearch && s.Action != Deleted && s.Action != Recent:
+		return errors.New("a match action can only be used to find deleted or recent entries")
+	case s.Match != SubStringSearch && s.Match != PrefixSearch && s.Match != FuzzySearch:
+		return errors.Errorf("invalid match action %d, expected a substring, prefix or fuzzy search", s.Match)
+	}
+	if s.Action == Jump && (s.SortBy != "" || s.TypeFilter == TypeFile) {
+		return errors.New("jump results are directories ranked by their visits, not by a sort key")
+	}
+	if s.Class != "" && (s.TypeFilter == TypeDirectory || s.Action == PathSearch ||
+		s.Action == Duplicates || s.Action == History || s.Action == Jump ||
+		s.Action == Trash || s.Action == Deleted || s.Action == Tree || s.Action == Recent ||
+		s.Action == Links) {
+		return errors.New("a class can only be used to search for files by name or changed files")
+	}
+	if s.Sniff && (s.Class == "" || s.Action == ChangedSince) {
+		return errors.New("sniffing needs a class and a search by name")
+	}
+	if s.Tag != "" && (s.Action == PathSearch || s.Action == Duplicates ||
+		s.Action == History || s.Action == Jump || s.Action == Trash || s.Action == Deleted ||
+		s.Action == Tree || s.Action == Recent || s.Action == Links) {
+		return errors.New("a tag can only be used to search by name or for changed entries")
+	}
+	if s.Aliases && (s.Action == Duplicates || s.Action == History || s.Action == Jump ||
+		s.Action == Trash || s.Action == Deleted || s.Action == Tree || s.Action == Recent ||
+		s.Action == Links) {
+		return errors.New("aliases are only sent with the results of searches")
+	}
+	if s.VerifyExists && (s.Action == Duplicates || s.Action == History ||
+		s.Action == Trash || s.Action == Deleted || s.Action == Tree || s.Action == Recent ||
+		s.Action == Links) {
+		return errors.New("only the results of searches can be verified")
+	}
+	if s.CollapseHardlinks && s.Action != SubStringSearch && s.Action != PrefixSearch &&
+		s.Action != FuzzySearch && s.Action != PathSearch && s.Action != SegmentSearch &&
+		s.Action != ChangedSince {
+		return errors.New("hard links can only be collapsed in searches by name or for changed entries")
+	}
+	if s.Parents && s.Action != SubStringSearch && s.Action != PrefixSearch &&
+		s.Action != FuzzySearch && s.Action != PathSearch && s.Action != SegmentSearch &&
+		s.Action != ChangedSince {
+		return errors.New("parents can only be found in searches by name or for changed entries")
+	}
+	if s.Parents && s.CollapseHardlinks {
+		return errors.New("hard links can't be collapsed for parents")
+	}
+	if s.Wildcards && s.Action != SubStringSearch && s.Action != PrefixSearch {
+		return errors.New("wildcards can only be used in substring and prefix searches")
+	}
+	if s.UnlessGeneration != 0 && s.Action != SubStringSearch && s.Action != PrefixSearch &&
+		s.Action != FuzzySearch && s.Action != PathSearch && s.Action != SegmentSearch {
+		return errors.New("only searches by name can depend on the generation of the index")
+	}
+	if s.Breakdown != 0 && s.Action != Stats {
+		return errors.New("only the statistics can break the index down")
+	}
+	if s.Breakdown < 0 || s.Breakdown > 2 {
+		return errors.Errorf("invalid breakdown %d, expected up to 2 levels", s.Breakdown)
+	}
+	if (s.MinScore != 0 || s.Scores) && s.Action != FuzzySearch {
+		return errors.New("only the matches of fuzzy searches have scores")
+	}
+	if s.MinScore < 0 || s.MinScore > 1 {
+		return errors.Errorf("invalid minimum score %g, expected 0 to 1", s.MinScore)
+	}
+	if s.Scores && (s.Parents || s.CollapseHardlinks || s.Aliases || s.IncludeFiltered != "") {
+		return errors.New("scores can't be sent with parents, collapsed hard links, aliases or filtered results")
+	}
+	if s.Scores && (s.SortBy == SortMtime || s.SortBy == SortCollate) {
+		return errors.Errorf("scores can only be sent with the %q sort key", SortLength)
+	}
+	if s.WaitIndex && !IsQuery(s.Action) {
+		return errors.New("only searches can wait for the index")
+	}
+	if s.CollapseHardlinks && (s.Aliases || s.IncludeFiltered != "") {
+		return errors.New("hard links can't be collapsed with aliases or filtered results")
+	}
+	if s.Action == ChangedSince && s.Since <= 0 {
+		return errors.New("finding changed entries needs a time")
+	}
+	if s.Action != ChangedSince && s.Since != 0 {
+		return errors.New("a time can only be used to find changed entries")
+	}
+	if s.Action == Recent && s.Within <= 0 {
+		return errors.New("finding recent entries needs a duration")
+	}
+	if s.Action != Recent && s.Within != 0 {
+		return errors.New("a duration can only be used to find recent entries")
+	}
+	if s.MinCount < 0 {
+		return errors.New("the minimum count can't be negative")
+	}
+	if s.Root != "" && !strings.HasPrefix(s.Root, "/") {
+		return errors.Errorf("the root %q isn't an absolute path", s.Root)
+	}
+	if s.IncludeFiltered != "" && s.Action != SubStringSearch && s.Action != PrefixSearch &&
+		s.Action != FuzzySearch && s.Action != PathSearch && s.Action != SegmentSearch {
+		return errors.New("filtered directories can only be included in searches by name")
+	}
+	if s.IncludeFiltered != "" && !strings.HasPrefix(s.IncludeFiltered, "/") {
+		return errors.Errorf("the filtered directory %q isn't an absolute path", s.IncludeFiltered)
+	}
+	return nil
+}
+
+// StatsResponse is sent back as the result of a Stats request
+type StatsResponse struct {
+	// IndexedFiles is the number of files found by the last full index
+	IndexedFiles uint64 `json:"indexed_files"`
+	// IndexedDirectories is the number of directories
+	// found by the last full index
+	IndexedDirectories uint64 `json:"indexed_directories"`
+	// IndexDuration is the duration of the last full index in seconds
+	IndexDuration float64 `json:"index_duration"`
+	// FilterRejections maps each filter class to the number of paths
+	// it rejected during the last full index
+	FilterRejections map[string]uint64 `json:"filter_rejections"`
+	// MemoryAlloc is the number of bytes of allocated heap objects
+	MemoryAlloc uint64 `json:"memory_alloc"`
+	// MemorySys is the number of bytes obtained from the OS
+	MemorySys uint64 `json:"memory_sys"`
+	// Uptime is the time since the server started in seconds
+	Uptime float64 `json:"uptime"`
+	// EventsProcessed is the number of filesystem events handled
+	EventsProcessed uint64 `json:"events_processed"`
+	// Backlog is the number of filesystem events waiting to be handled
+	Backlog int `json:"backlog"`
+	// LastReconciliation is the unix time at which a directory was last
+	// compared against the index, 0 if that didn't happen yet
+	LastReconciliation int64 `json:"last_reconciliation"`
+	// Watcher is the backend watching for changes: fanotify, inotify
+	// or polling, empty if changes aren't watched
+	Watcher string `json:"watcher"`
+	// WatchedMounts are the mount points watched for changes
+	WatchedMounts []string `json:"watched_mounts"`
+	// Paused is set while filesystem events aren't applied
+	Paused bool `json:"paused"`
+	// PausedEvents is the number of events received while paused
+	PausedEvents uint64 `json:"paused_events"`
+	// PendingDirectories is the number of directories
+	// that will be refreshed on resume
+	PendingDirectories int `json:"pending_directories"`
+	// FailedDirectories is the number of directories that couldn't
+	// be read, SuppressedFailures of those that aren't retried anymore
+	FailedDirectories  int `json:"failed_directories"`
+	SuppressedFailures int `json:"suppressed_failures"`
+	// Pid is the process ID of the server
+	Pid int `json:"pid"`
+	// QueryLimits are the limits of queries and their use
+	QueryLimits LimitStats `json:"query_limits"`
+	// RecentQueries are the last completed searches, the oldest first
+	RecentQueries []QueryRecord `json:"recent_queries"`
+	// Aliases map the directories whose entries are indexed at
+	// another path to that path
+	Aliases map[string]string `json:"aliases,omitempty"`
+	// DeletedEntries is the number of recently deleted entries kept,
+	// DeletedCapacity how many can be kept
+	DeletedEntries  int `json:"deleted_entries"`
+	DeletedCapacity int `json:"deleted_capacity"`
+	// RecentEntries is the number of recently created entries kept,
+	// RecentCapacity how many can be kept and RecentDropped how many
+	// weren't because a minute held that many
+	RecentEntries  int `json:"recent_entries"`
+	RecentCapacity int `json:"recent_capacity"`
+	RecentDropped  int `json:"recent_dropped"`
+	// ColdEntries is the number of entries in the cold tier, which
+	// aren't part of IndexedEntries. ColdMemory is the number of bytes
+	// its summaries take in memory, ColdFileSize that of its file on
+	// disk and ColdBuilt the unix time it was read at, 0 if it isn't.
+	ColdEntries  uint64 `json:"cold_entries"`
+	ColdMemory   uint64 `json:"cold_memory"`
+	ColdFileSize uint64 `json:"cold_file_size"`
+	ColdBuilt    int64  `json:"cold_built"`
+	// QueryCacheSize is the number of searches whose results can be
+	// cached, 0 if the cache is disabled. QueryCacheHits counts the
+	// searches answered from it, QueryCacheMisses those that weren't.
+	QueryCacheSize   int    `json:"query_cache_size"`
+	QueryCacheHits   uint64 `json:"query_cache_hits"`
+	QueryCacheMisses uint64 `json:"query_cache_misses"`
+	// IndexedEntries is the number of entries below the root in the
+	// index now, unlike IndexedFiles and IndexedDirectories it follows
+	// the changes since the last full index
+	IndexedEntries int `json:"indexed_entries"`
+	// Generation is that of the index new searches run on, see
+	// GenerationResponse
+	Generation uint64 `json:"generation"`
+	// StaleMounts are the filesystems mounted below the root whose
+	// indexed entries may be outdated, see MountDescription.Stale
+	StaleMounts []MountDescription `json:"stale_mounts,omitempty"`
+	// Breakdown is the part of the index below each entry of the root,
+	// the largest first, if Settings.Breakdown is set
+	Breakdown []IndexBreakdown `json:"breakdown,omitempty"`
+}
+
+// IndexBreakdown is the part of the index at and below an entry
+type IndexBreakdown struct {
+	Path        string `json:"path"`
+	Files       uint64 `json:"files"`
+	Directories uint64 `json:"directories"`
+	// NameBytes is the length of the entry names
+	NameBytes uint64 `json:"name_bytes"`
+	// Memory is the estimated heap memory the entries take, Share
+	// their part of the memory of the whole index
+	Memory uint64  `json:"memory"`
+	Share  float64 `json:"share"`
+	// Below breaks the entry down one level further, the largest
+	// first, if it's a directory and Settings.Breakdown is 2
+	Below []IndexBreakdown `json:"below,omitempty"`
+}
+
+// QueryRecord describes a completed search
+type QueryRecord struct {
+	RequestID string `json:"request_id"`
+	Query     string `json:"query"`
+	// Action is the kind of search, as named in the metrics
+	Action string `json:"action"`
+	// Duration is the time the search took in seconds
+	Duration float64 `json:"duration"`
+	// Results is the number of results sent
+	Results int `json:"results"`
+}
+
+// HealthResponse is sent back as the result of a Health request
+type HealthResponse struct {
+	// State is one of ok, indexing, degraded and stale
+	State string `json:"state"`
+	// Reasons explain why the state isn't ok
+	Reasons []string `json:"reasons"`
+}
+
+// GenerationResponse is sent back as the result of a Generation request
+type GenerationResponse struct {
+	// Generation grows with every change applied to the index, so
+	// results found in the same generation are still current. It
+	// starts at the time the daemon started in microseconds, a
+	// restarted daemon doesn't repeat earlier generations.
+	Generation uint64 `json:"generation"`
+}
+
+// Description is sent back as the result of a Describe request
+type Description struct {
+	// Roots are the indexed directories
+	Roots []RootDescription `json:"roots"`
+	// Watcher is the backend watching for changes: fanotify, inotify
+	// or polling, empty if changes aren't watched
+	Watcher string `json:"watcher"`
+	// Mounts are the filesystems mounted below the roots
+	Mounts []MountDescription `json:"mounts"`
+	// Filters are the effective filters in the order they are
+	// evaluated, including the default ones
+	Filters []FilterDescription `json:"filters"`
+	// Lazy are the directories whose entries were merged into the
+	// index by lazy walks, until they expire
+	Lazy []LazyDescription `json:"lazy,omitempty"`
+	// Coverage tells whether the entries below the path sent as the
+	// query of the Describe request are indexed, if there was one
+	Coverage *CoverageDescription `json:"coverage,omitempty"`
+	// Policy is the server policy applied to the queries of the
+	// peer, unless it is root
+	Policy *Policy `json:"policy,omitempty"`
+}
+
+// RootDescription describes an indexed directory
+type RootDescription struct {
+	Path string `json:"path"`
+	// Indexing is set during a full index
+	Indexing bool `json:"indexing"`
+	// Paused is set while filesystem events aren't applied
+	Paused bool `json:"paused"`
+	// LastIndex is when the last full index finished as Unix time,
+	// 0 if none did yet
+	LastIndex int64 `json:"last_index"`
+	// LastReconciliation is when every directory was last compared
+	// against the index, LastRefresh when a directory last was, as
+	// Unix time, 0 if that didn't happen yet
+	LastReconciliation int64 `json:"last_reconciliation"`
+	LastRefresh        int64 `json:"last_refresh"`
+	// IndexedFiles and IndexedDirectories are the numbers of entries
+	// found by the last full index
+	IndexedFiles       uint64 `json:"indexed_files"`
+	IndexedDirectories uint64 `json:"indexed_directories"`
+}
+
+// MountDescription describes a mounted filesystem
+type MountDescription struct {
+	MountPoint string `json:"mount_point"`
+	FSType     string `json:"fs_type"`
+	Source     string `json:"source"`
+	// Excluded is set if its type is filtered, it isn't indexed
+	Excluded bool `json:"excluded"`
+	// Watched is set if its changes are watched, which isn't the case
+	// for network and FUSE filesystems, they can be changed elsewhere
+	Watched bool `json:"watched"`
+	// LastReconciled is when its entries were last read completely as
+	// Unix time, 0 if they weren't since it was mounted
+	LastReconciled int64 `json:"last_reconciled"`
+	// Stale is set if it isn't watched or wasn't read since it was
+	// mounted, its entries in the index may be outdated
+	Stale bool `json:"stale"`
+}
+
+// LazyDescription describes a directory walked for a request
+// whose entries are kept in the index for a while
+type LazyDescription struct {
+	Path string `json:"path"`
+	// Expires is when its entries are removed as Unix time
+	Expires int64 `json:"expires"`
+}
+
+// CoverageDescription describes whether the entries below
+// a directory are indexed
+type CoverageDescription struct {
+	Path    string `json:"path"`
+	Indexed bool   `json:"indexed"`
+	// Reason is why they aren't indexed
+	Reason string `json:"reason,omitempty"`
+	// Expires is set if they were merged by a lazy walk,
+	// to when they are removed as Unix time
+	Expires int64 `json:"expires,omitempty"`
+}
+
+// FilterDescription describes a filter
+type FilterDescription struct {
+	// Class is the kind of filter, e.g. "prefix" or "glob"
+	Class   string `json:"class"`
+	Pattern string `json:"pattern"`
+	// Default is set for the compiled-in default filters
+	Default bool `json:"default,omitempty"`
+}
+
+// VersionResponse is sent back as the result of a Version request
+type VersionResponse struct {
+	version.Info
+	// Protocol is the newest protocol version the daemon speaks
+	Protocol int `json:"protocol"`
+	// Features are all optional features the daemon supports
+	Features []string `json:"features"`
 }
 
 // ListenAndServe starts listening for and accepting requests
 // on a unix domain socket.
 // requestReceiver is used for passing on the requests to the caller
-func ListenAndServe(requestReceiver chan<- Request) {
-	if err := os.RemoveAll(SockAddr); err != nil {
-		log.Fatal(err)
-	}
-
-	l, err := net.Listen("unix", SockAddr)
+func ListenAndServe(requestReceiver chan<- Request, options SocketOptions) {
+	l, err := Listen(options)
 	if err != nil {
-		log.Fatal("listen error:", err)
+		slog.Error("couldn't listen", "socket", options.path(), "err", err)
+		os.Exit(1)
 	}
+
+	Serve(l, requestReceiver, options)
+}
+
+// Serve accepts requests on l, which was created by Listen,
+// and passes them on to requestReceiver
+func Serve(l net.Listener, requestReceiver chan<- Request, options SocketOptions) {
 	defer l.Close()
 
-	setSocketPermissions()
+	policy, err := NewAccessPolicy(options)
 	if err != nil {
-		log.Fatal("couldn't set socket permissions properly", err)
+		slog.Error("invalid access policy", "err", err)
+		os.Exit(1)
 	}
 
+	serveListener(l, requestReceiver, policy)
+}
+
+func serveListener(l net.Listener, requestReceiver chan<- Request, policy *AccessPolicy) {
+	var delay time.Duration
 	for {
 		conn, err := l.Accept()
 
 		if err != nil {
-			log.Println("accept error:", err)
+			if stderrors.Is(err, net.ErrClosed) {
+				return
+			}
+			// like running out of file descriptors, accepting is
+			// retried with a growing delay instead of spinning
+			delay = min(max(2*delay, 5*time.Millisecond), time.Second)
+			slog.Warn("accept error", "err", err, "retry", delay)
+			time.Sleep(delay)
 			continue
 		}
+		delay = 0
 
-		serve(conn, requestReceiver)
+		go serve(conn, requestReceiver, policy)
 	}
 }
 
-func setSocketPermissions() error {
-	// group, err := user.LookupGroup("users")
-	// if err != nil {
-	// 	return err
-	// }
-	// gid, err := strconv.Atoi(group.Gid)
-	// if err != nil {
-	// 	return err
-	// }
-	// err = os.Chown(SockAddr, -1, gid)
-	// if err != nil {
-	// 	return err
-	// }
+// serve handles a single request, policy may be nil to allow everything
+func serve(c net.Conn, requestReceiver chan<- Request, policy *AccessPolicy) {
+	defer c.Close()
+	request := Request{}
+	decoder := json.NewDecoder(c)
+	err := decoder.Decode(&request)
 
-	err := os.Chmod(SockAddr, os.ModePerm)
 	if err != nil {
-		return err
+		slog.Warn("failed to decode request", "err", err)
+		// the version of the client is unknown, clients predating
+		// the handshake print the line like a result
+		e := ErrorResponse{Code: ErrInvalidRequest, Message: "invalid request: " + err.Error()}
+		c.Write([]byte(e.Line(ProtocolVersion) + "\n"))
+		return
 	}
 
-	return nil
-}
+	// unknown fields are ignored, so newer clients can still
+	// search on older daemons
+	framed := false
+	if request.Version > 0 {
+		hello := NewHello(request)
+		framed = hello.Has(FeatureFraming)
+		if _, err := c.Write([]byte(hello.String() + "\n")); err != nil {
+			slog.Warn("failed to write to unix domain socket", "err", err)
+			return
+		}
+	}
 
-func serve(c net.Conn, requestReceiver chan<- Request) {
-	defer c.Close()
-	request := Request{}
-	err := json.NewDecoder(c).Decode(&request)
+	// the lines following the hello are framed if the client wants
+	encode := lineEncoder(request, framed)
+	writeLine := func(line string) {
+		encoded, _ := encode(nil, line)
+		c.Write(encoded)
+	}
+	if err := request.AssignID(); err != nil {
+		writeLine(err.Line(request.Version))
+		return
+	}
+	request.Peer = peerKey(c)
+	log := request.Logger()
+	if policy != nil {
+		if err := authorize(c, policy, request); err != nil {
+			writeLine(err.Line(request.Version))
+			return
+		}
+	}
 
-	if err != nil {
-		// TODO: send error back
-		log.Println("failed to decode request:", err)
+	if request.Settings.Action == Batch {
+		serveBatch(c, decoder, requestReceiver, policy, request, framed)
 		return
 	}
 
-	request.ResponseChannel = make(chan string)
-	request.Done = make(chan struct{})
-	requestReceiver <- request
+	// clients send nothing after the request, so the connection only
+	// becomes readable once they hang up
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		io.Copy(ioutil.Discard, c)
+		cancel()
+		// unblocks a write to a client that hung up with a full buffer
+		c.SetWriteDeadline(time.Now())
+	}()
 
-	for response := range request.ResponseChannel {
-		responseBytes := []byte(response + "\n")
-		n, err := c.Write(responseBytes)
-		if n != len(responseBytes) {
-			log.Printf("wrote %d bytes, expected to write %d", n, len(responseBytes))
-		}
-		if err != nil {
-			log.Println("failed to write to unix domain socket:", err)
-			request.Done <- struct{}{}
-			break
+	if IsQuery(request.Settings.Action) {
+		release, err := AcquireQuery(ctx, request.Peer)
+		if e, ok := err.(ErrorResponse); ok {
+			writeLine(e.Line(request.Version))
+			return
+		} else if err != nil {
+			log.Debug("client hung up while waiting for a query slot")
+			return
 		}
+		defer release()
+	}
+
+	out := newBatchWriter(c)
+	err = Dispatch(ctx, requestReceiver, request, func(response string) error {
+		return out.Append(func(dst []byte) ([]byte, error) { return encode(dst, response) })
+	})
+	if err == nil {
+		err = out.Flush()
+	} else {
+		out.Discard()
+	}
+	if err == context.Canceled {
+		log.Debug("client hung up, cancelled request")
+	} else if err != nil {
+		log.Warn("failed to write to unix domain socket", "err", err)
+	}
+}
+
+// peerKey tells the peers of c apart for the query limits
+func peerKey(c net.Conn) string {
+	cred, err := PeerCredentials(c)
+	if err != nil {
+		return "unknown"
+	}
+	return PeerKey(cred)
+}
+
+// PeerKey returns the key of a local peer for AcquireQuery,
+// the same user is limited across all sockets
+func PeerKey(cred *Credentials) string {
+	return "uid:" + strconv.Itoa(int(cred.Uid))
+}
 
+// authorize checks whether the peer may send the request
+func authorize(c net.Conn, policy *AccessPolicy, request Request) *ErrorResponse {
+	cred, err := PeerCredentials(c)
+	if err != nil {
+		request.Logger().Warn("denied request, couldn't get peer credentials", "err", err)
+		return &ErrorResponse{Code: ErrPermissionDenied,
+			Message: "permission denied, couldn't identify the client"}
+	}
+
+	if !policy.Authorize(cred, request.Settings.Action) {
+		return &ErrorResponse{Code: ErrPermissionDenied, Message: "permission denied"}
 	}
+	return nil
 }
@@ -0,0 +1,49 @@
+package request
+
+import (
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// failingListener fails to accept with errs, then with net.ErrClosed
+type failingListener struct {
+	net.Listener
+	errs []error
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	if len(l.errs) == 0 {
+		return nil, &net.OpError{Op: "accept", Net: "unix", Err: net.ErrClosed}
+	}
+	err := l.errs[0]
+	l.errs = l.errs[1:]
+	return nil, &net.OpError{Op: "accept", Net: "unix", Err: err}
+}
+
+func TestServeListener_Errors(t *testing.T) {
+	// the failed accepts are logged
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(ioutil.Discard, nil)))
+
+	// running out of file descriptors isn't fatal, a closed
+	// listener ends serving
+	l := &failingListener{errs: []error{syscall.EMFILE, syscall.ECONNABORTED}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serveListener(l, nil, nil)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("serveListener didn't return after the listener was closed")
+	}
+	if len(l.errs) != 0 {
+		t.Errorf("serveListener returned before retrying %v", l.errs)
+	}
+}
@@ -0,0 +1,179 @@
+package request
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd
+// socket activation, see sd_listen_fds(3)
+const listenFdsStart = 3
+
+// SocketOptions configures the unix domain socket of the server
+type SocketOptions struct {
+	// Path of the socket, SockAddr is used if empty
+	Path string
+	// Mode is the file mode of the socket
+	Mode os.FileMode
+	// Group owns the socket if set
+	Group string
+	// AllowedUsers and AllowedGroups may send queries,
+	// everyone may if both are empty
+	AllowedUsers  []string
+	AllowedGroups []string
+	// AdminGroup may use the administrative actions besides root
+	AdminGroup string
+}
+
+func (options SocketOptions) path() string {
+	if options.Path == "" {
+		return SockAddr
+	}
+	return options.Path
+}
+
+// Listen returns the socket passed by systemd if the server was
+// socket activated, otherwise it creates the socket itself
+func Listen(options SocketOptions) (net.Listener, error) {
+	l, err := activationListener(listenFdsStart)
+	if err != nil {
+		return nil, err
+	} else if l != nil {
+		checkActivatedSocket(l, options)
+		return l, nil
+	}
+
+	return ListenUnix(options)
+}
+
+// checkActivatedSocket warns about the options the socket passed by
+// systemd doesn't match, its path and permissions are set by the unit
+func checkActivatedSocket(l net.Listener, options SocketOptions) {
+	path := l.Addr().String()
+	if path != options.path() {
+		slog.Warn("socket_path is ignored, the socket is set by ListenStream of gosearch.socket",
+			"configured", options.path(), "socket", path)
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	// connecting only needs the write permission, the execute
+	// bits mean nothing for sockets
+	if info.Mode().Perm()&^0111 != options.Mode.Perm()&^0111 {
+		slog.Warn("socket_mode is ignored, the mode is set by SocketMode of gosearch.socket",
+			"configured", options.Mode.Perm(), "socket", info.Mode().Perm())
+	}
+
+	if options.Group == "" {
+		return
+	}
+	group, err := user.LookupGroup(options.Group)
+	if err != nil {
+		return
+	}
+	if gid, ok := fileGid(info); ok && strconv.Itoa(gid) != group.Gid {
+		slog.Warn("socket_group is ignored, the group is set by SocketGroup of gosearch.socket",
+			"configured", options.Group, "socket", gid)
+	}
+}
+
+// ListenUnix creates the socket at the path of options
+// and sets its permissions
+func ListenUnix(options SocketOptions) (net.Listener, error) {
+	path := options.path()
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.Wrap(err, "listen error")
+	}
+
+	err = setSocketPermissions(path, options)
+	if err != nil {
+		l.Close()
+		return nil, errors.Wrap(err, "couldn't set socket permissions properly")
+	}
+
+	return l, nil
+}
+
+// removeStaleSocket removes the socket at path if no process
+// listens on it anymore, like after a crash of the server
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return errors.Errorf("%s exists and isn't a socket", path)
+	}
+
+	c, err := net.Dial("unix", path)
+	if err == nil {
+		c.Close()
+		return errors.Errorf("socket %s is in use by another process", path)
+	}
+
+	slog.Info("removing stale socket", "path", path)
+	return os.Remove(path)
+}
+
+// activationListener implements the receiving side of the
+// LISTEN_FDS protocol, the sockets are passed from fd on, which is
+// listenFdsStart outside of the tests. It returns nil if no socket
+// was passed.
+func activationListener(fd uintptr) (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(fd, "systemd-socket")
+	defer f.Close()
+
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid socket passed by systemd")
+	}
+	return l, nil
+}
+
+func setSocketPermissions(path string, options SocketOptions) error {
+	if options.Group != "" {
+		group, err := user.LookupGroup(options.Group)
+		if err != nil {
+			return err
+		}
+		gid, err := strconv.Atoi(group.Gid)
+		if err != nil {
+			return err
+		}
+		err = os.Chown(path, -1, gid)
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.Chmod(path, options.Mode)
+}
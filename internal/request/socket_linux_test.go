@@ -0,0 +1,124 @@
+package request
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestActivationListener(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		name         string
+		pid          string
+		fds          string
+		notSocket    bool
+		wantListener bool
+		wantErr      bool
+	}{
+		{"not_activated", "", "", false, false, false},
+		{"other_process", "1", "1", false, false, false},
+		{"no_fds", pid, "0", false, false, false},
+		{"invalid_fds", pid, "one", false, false, false},
+		{"socket", pid, "1", false, true, false},
+		{"not_a_socket", pid, "1", true, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LISTEN_PID", tt.pid)
+			t.Setenv("LISTEN_FDS", tt.fds)
+
+			var fd int
+			if tt.notSocket {
+				f, err := os.Open(os.DevNull)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fd, err = unix.Dup(int(f.Fd()))
+				f.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				pair, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer unix.Close(pair[1])
+				fd = pair[0]
+			}
+
+			l, err := activationListener(uintptr(fd))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("activationListener() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (l != nil) != tt.wantListener {
+				t.Fatalf("activationListener() = %v, want a listener: %v", l, tt.wantListener)
+			}
+			if l == nil && err == nil {
+				// the fd wasn't taken
+				unix.Close(fd)
+				return
+			}
+			if l != nil {
+				l.Close()
+			}
+
+			// the passed sockets aren't inherited by child processes
+			for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+				if _, ok := os.LookupEnv(name); ok {
+					t.Errorf("%s is still set", name)
+				}
+			}
+			if _, err := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0); err != unix.EBADF {
+				t.Errorf("passed fd %d is still open", fd)
+			}
+		})
+	}
+}
+
+func TestCheckActivatedSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := os.Chmod(path, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		options SocketOptions
+		want    string
+	}{
+		{"matching", SocketOptions{Path: path, Mode: 0666}, ""},
+		// the execute bits of the default mode 0777 don't matter
+		{"execute_bits", SocketOptions{Path: path, Mode: 0777}, ""},
+		{"path", SocketOptions{Path: path + ".other", Mode: 0666}, "socket_path is ignored"},
+		{"mode", SocketOptions{Path: path, Mode: 0660}, "socket_mode is ignored"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			defer slog.SetDefault(slog.Default())
+			slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+			checkActivatedSocket(l, tt.options)
+			if tt.want == "" && logs.Len() != 0 {
+				t.Errorf("unexpected warning: %s", logs.String())
+			}
+			if tt.want != "" && !strings.Contains(logs.String(), tt.want) {
+				t.Errorf("logged %q, want a warning %q", logs.String(), tt.want)
+			}
+		})
+	}
+}
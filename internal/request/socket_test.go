@@ -0,0 +1,104 @@
+package request
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	missing := filepath.Join(dir, "missing.sock")
+	if err := removeStaleSocket(missing); err != nil {
+		t.Errorf("missing socket: error = %v", err)
+	}
+
+	regular := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(regular, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(regular); err == nil {
+		t.Error("regular file: removed, want error")
+	}
+
+	live := filepath.Join(dir, "live.sock")
+	l, err := net.Listen("unix", live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := removeStaleSocket(live); err == nil {
+		t.Error("live socket: removed, want error")
+	}
+
+	// closing a unix listener removes its socket,
+	// a crashed server leaves it behind
+	stale := filepath.Join(dir, "stale.sock")
+	sl, err := net.ListenUnix("unix", &net.UnixAddr{Name: stale, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sl.SetUnlinkOnClose(false)
+	sl.Close()
+	if err := removeStaleSocket(stale); err != nil {
+		t.Errorf("stale socket: error = %v", err)
+	}
+	if _, err := os.Lstat(stale); !os.IsNotExist(err) {
+		t.Error("stale socket wasn't removed")
+	}
+}
+
+func TestSetSocketPermissions(t *testing.T) {
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := user.LookupGroupId(u.Gid)
+	if err != nil {
+		t.Skip("no name for the group of the user:", err)
+	}
+
+	tests := []struct {
+		name    string
+		options SocketOptions
+		wantErr bool
+	}{
+		{"mode", SocketOptions{Mode: 0600}, false},
+		{"group", SocketOptions{Mode: 0660, Group: group.Name}, false},
+		{"everyone", SocketOptions{Mode: 0777}, false},
+		{"unknown_group", SocketOptions{Mode: 0660, Group: "gosearch-no-such-group"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sock")
+			l, err := net.Listen("unix", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+
+			err = setSocketPermissions(path, tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setSocketPermissions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != tt.options.Mode {
+				t.Errorf("mode = %o, want %o", info.Mode().Perm(), tt.options.Mode)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package request
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// responses are written in batches of up to flushSize bytes, a batch
+// that doesn't fill up is written after flushInterval
+const (
+	flushSize     = 64 * 1024
+	flushInterval = 10 * time.Millisecond
+)
+
+var errDiscarded = errors.New("response discarded")
+
+// batchWriter collects response lines and writes them in batches,
+// saving a syscall per result on large result sets
+type batchWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+	// timer flushes a batch that didn't fill up
+	timer *time.Timer
+	// err is the first failed write, no more writes happen after it
+	err error
+}
+
+func newBatchWriter(w io.Writer) *batchWriter {
+	return &batchWriter{w: w}
+}
+
+// WriteLine adds a line to the current batch, it returns the error
+// of an earlier failed write
+func (b *batchWriter) WriteLine(line string) error {
+	return b.Append(func(dst []byte) ([]byte, error) {
+		return append(dst, line...), nil
+	})
+}
+
+// Append adds what encode appends to the current batch, it returns the
+// error of encode or of an earlier failed write
+func (b *batchWriter) Append(encode func(dst []byte) ([]byte, error)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+
+	buf, err := encode(b.buf)
+	if err != nil {
+		return err
+	}
+	b.buf = buf
+	if len(b.buf) >= flushSize {
+		return b.flush()
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(flushInterval, b.timedFlush)
+	}
+	return nil
+}
+
+// Flush writes the current batch
+func (b *batchWriter) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flush()
+}
+
+// Discard drops the current batch and stops writing,
+// the client isn't interested anymore
+func (b *batchWriter) Discard() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stopTimer()
+	b.buf = nil
+	if b.err == nil {
+		b.err = errDiscarded
+	}
+}
+
+func (b *batchWriter) timedFlush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flush()
+}
+
+func (b *batchWriter) flush() error {
+	b.stopTimer()
+	if b.err != nil || len(b.buf) == 0 {
+		return b.err
+	}
+	_, b.err = b.w.Write(b.buf)
+	b.buf = b.buf[:0]
+	return b.err
+}
+
+func (b *batchWriter) stopTimer() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+}
@@ -0,0 +1,158 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder records the writes it gets
+type recorder struct {
+	mu     sync.Mutex
+	writes []string
+	err    error
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return 0, r.err
+	}
+	r.writes = append(r.writes, string(p))
+	return len(p), nil
+}
+
+func (r *recorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.writes)
+}
+
+func TestBatchWriter_Batches(t *testing.T) {
+	r := &recorder{}
+	b := newBatchWriter(r)
+	for i := 0; i < 3; i++ {
+		if err := b.WriteLine("/a\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := r.count(); n != 0 {
+		t.Errorf("%d writes before the batch is flushed, want 0", n)
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.writes) != 1 || r.writes[0] != "/a\n/a\n/a\n" {
+		t.Errorf("writes %q, want a single batch", r.writes)
+	}
+
+	// a full batch is written right away
+	long := strings.Repeat("x", flushSize)
+	if err := b.WriteLine(long); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.count(); n != 2 {
+		t.Errorf("%d writes after a full batch, want 2", n)
+	}
+}
+
+func TestBatchWriter_FlushInterval(t *testing.T) {
+	r := &recorder{}
+	b := newBatchWriter(r)
+	if err := b.WriteLine("/a\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for r.count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the batch wasn't flushed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBatchWriter_Errors(t *testing.T) {
+	failed := errors.New("broken pipe")
+	r := &recorder{err: failed}
+	b := newBatchWriter(r)
+	if err := b.WriteLine(strings.Repeat("x", flushSize)); err != failed {
+		t.Errorf("WriteLine() error = %v, want %v", err, failed)
+	}
+	if err := b.WriteLine("/a\n"); err != failed {
+		t.Errorf("WriteLine() after a failed write error = %v, want %v", err, failed)
+	}
+
+	r = &recorder{}
+	b = newBatchWriter(r)
+	b.WriteLine("/a\n")
+	b.Discard()
+	if err := b.Flush(); err != errDiscarded {
+		t.Errorf("Flush() after Discard() error = %v, want %v", err, errDiscarded)
+	}
+	time.Sleep(2 * flushInterval)
+	if n := r.count(); n != 0 {
+		t.Errorf("%d writes after Discard(), want 0", n)
+	}
+}
+
+// streamingDatabase answers every request with n results
+func streamingDatabase(requests <-chan Request, n int) {
+	for req := range requests {
+	stream:
+		for i := 0; i < n; i++ {
+			select {
+			case req.ResponseChannel <- "/home/user/projects/gosearch/internal/result.go":
+			case <-req.Done:
+				break stream
+			}
+		}
+		close(req.ResponseChannel)
+	}
+}
+
+// BenchmarkServe_Streaming measures the throughput of large result
+// sets, like gosearch -nosort -n 0 a > /dev/null
+func BenchmarkServe_Streaming(b *testing.B) {
+	const results = 100000
+
+	dir, err := ioutil.TempDir("", "gosearch")
+	if err != nil {
+		b.Fatal(err)
+	}
+	l, err := net.Listen("unix", filepath.Join(dir, "sock"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+
+	requests := make(chan Request)
+	defer close(requests)
+	go streamingDatabase(requests, results)
+	go serveListener(l, requests, nil)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c, err := net.Dial("unix", l.Addr().String())
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := json.NewEncoder(c).Encode(Request{Query: "a"}); err != nil {
+			b.Fatal(err)
+		}
+		n, err := io.Copy(ioutil.Discard, c)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(n)
+		c.Close()
+	}
+}
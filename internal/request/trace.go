@@ -0,0 +1,49 @@
+package request
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+)
+
+// maxRequestIDLength is the length of the longest RequestID
+// accepted from clients
+const maxRequestIDLength = 64
+
+// NewRequestID returns a random ID for a request
+// the client didn't name
+func NewRequestID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// AssignID generates the RequestID of req unless the client sent one.
+// IDs sent by clients end up in the log, so they are restricted to
+// letters, digits, '.', '_' and '-'.
+func (req *Request) AssignID() *ErrorResponse {
+	if req.RequestID == "" {
+		req.RequestID = NewRequestID()
+		return nil
+	}
+
+	valid := len(req.RequestID) <= maxRequestIDLength
+	for _, c := range req.RequestID {
+		valid = valid && (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+			c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-')
+	}
+	if !valid {
+		return &ErrorResponse{Code: ErrInvalidRequest, Message: "invalid request ID, it may have up to " +
+			"64 letters, digits, '.', '_' and '-'"}
+	}
+	return nil
+}
+
+// Logger returns the default logger, with the ID of req added
+// to the lines if it has one
+func (req Request) Logger() *slog.Logger {
+	if req.RequestID == "" {
+		return slog.Default()
+	}
+	return slog.With("request_id", req.RequestID)
+}
@@ -0,0 +1,74 @@
+// Package version describes the build of the running binary
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// set at build time with
+// -ldflags "-X github.com/ozeidan/gosearch/internal/version.Version=..."
+var (
+	// Version is the semantic version of the release
+	Version = ""
+	// Commit is the git commit the binary was built from
+	Commit = ""
+	// Date is the time of the build
+	Date = ""
+)
+
+// Info describes a build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information of the running binary. Values
+// not set by the linker are taken from the module and VCS information
+// the go command embeds.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.Date == "":
+				info.Date = setting.Value
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "unknown"
+	}
+	return info
+}
+
+// String formats the information on a single line
+func (i Info) String() string {
+	s := i.Version
+	if i.Commit != "" {
+		commit := i.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		s += " (" + commit
+		if i.Date != "" {
+			s += ", " + i.Date
+		}
+		s += ")"
+	}
+	return s + " " + i.GoVersion
+}
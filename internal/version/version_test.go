@@ -0,0 +1,39 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestInfo_String(t *testing.T) {
+	tests := []struct {
+		name string
+		info Info
+		want string
+	}{
+		{
+			"release",
+			Info{"v1.2.0", "0123456789abcdef0123", "2020-04-01T10:00:00Z", "go1.21.0"},
+			"v1.2.0 (0123456789ab, 2020-04-01T10:00:00Z) go1.21.0",
+		},
+		{"no_commit", Info{Version: "unknown", GoVersion: "go1.21.0"}, "unknown go1.21.0"},
+		{"no_date", Info{"v1.2.0", "abc", "", "go1.21.0"}, "v1.2.0 (abc) go1.21.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGet_LinkerFlags(t *testing.T) {
+	defer func(v, c, d string) { Version, Commit, Date = v, c, d }(Version, Commit, Date)
+	Version, Commit, Date = "v1.2.0", "abc", "2020-04-01"
+
+	want := Info{"v1.2.0", "abc", "2020-04-01", runtime.Version()}
+	if got := Get(); got != want {
+		t.Errorf("Get() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,363 @@
+//go:build linux
+
+package watch
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/health"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	fanReportFid      = 0x00000200
+	fanMarkAdd        = 0x00000001
+	fanMarkFilesystem = 0x00000100
+	fanOndir          = 0x40000000 /* event occurred against dir */
+	fanMovedFrom      = 0x00000040 /* File was moved from X */
+	fanMovedTo        = 0x00000080 /* File was moved to Y */
+	fanCreate         = 0x00000100 /* Subfile was created */
+	fanDelete         = 0x00000200 /* Subfile was deleted */
+	fanDeleteSelf     = 0x00000400 /* Self was deleted */
+	fanMoveSelf       = 0x00000800 /* Self was moved */
+	fanEventOnChild   = 0x08000000 /* interested in child events */
+	atFDCWD           = -100
+
+	// fanEventInfoTypeFid is the type of the info records
+	// carrying the file handle of the directory
+	fanEventInfoTypeFid = 1
+)
+const markFlags = fanMarkAdd | fanMarkFilesystem
+const markMask = fanOndir | fanMovedFrom | fanMovedTo | fanCreate | fanDelete
+
+// Offsets into struct fanotify_event_metadata and the
+// struct fanotify_event_info_fid following it. The kernel aligns the
+// mask to 8 bytes on every architecture, so the layout is the same on
+// 32 and 64 bit. The fields are decoded one by one instead of casting
+// the buffer, which may not be aligned.
+const (
+	metaEventLenOffset    = 0
+	metaMetadataLenOffset = 6
+	metaMaskOffset        = 8
+	// fanMetadataLen is the size of the metadata starting each event
+	fanMetadataLen = 24
+
+	infoTypeOffset        = 0
+	infoLenOffset         = 2
+	infoFsidOffset        = 4
+	infoHandleBytesOffset = 12
+	infoHandleTypeOffset  = 16
+	// infoHandleOffset is where the bytes of the file handle start
+	infoHandleOffset = 20
+
+	// maxEventLen bounds the length of an event, the events the
+	// kernel sends with our flags are far smaller
+	maxEventLen = 4096
+)
+
+// fanotifyWatcher watches whole filesystems, it needs CAP_SYS_ADMIN
+// and a kernel reporting file handles (5.1)
+type fanotifyWatcher struct {
+	f *os.File
+	// mountFDs are descriptors of the roots by the ids of their
+	// filesystems, file handles are opened relative to them
+	mountFDs map[[2]int32]int
+}
+
+// newFanotify creates a fanotify group watching the filesystems
+// of roots
+func newFanotify(roots []string) (Watcher, error) {
+	fan, err := unix.FanotifyInit(fanReportFid, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not call fanotifyinit")
+	}
+
+	w := &fanotifyWatcher{
+		f:        os.NewFile(uintptr(fan), "fanotify"),
+		mountFDs: make(map[[2]int32]int),
+	}
+	for _, root := range roots {
+		err = unix.FanotifyMark(fan, markFlags, markMask, atFDCWD, root)
+		if err != nil {
+			w.close()
+			return nil, errors.Wrap(err, "could not call fanotifymark")
+		}
+		if err := w.addMountFD(root); err != nil {
+			w.close()
+			return nil, err
+		}
+	}
+
+	slog.Info("fanotify initialized")
+	return w, nil
+}
+
+// addMountFD opens root, so the handles of events on its filesystem
+// can be opened. The handles of the filesystem of the working
+// directory can be opened without it.
+func (w *fanotifyWatcher) addMountFD(root string) error {
+	fd, err := unix.Open(root, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return errors.Wrapf(err, "could not open %s", root)
+	}
+	var st unix.Statfs_t
+	if err := unix.Fstatfs(fd, &st); err != nil {
+		unix.Close(fd)
+		return errors.Wrapf(err, "could not stat the filesystem of %s", root)
+	}
+	if _, ok := w.mountFDs[st.Fsid.Val]; ok {
+		unix.Close(fd)
+		return nil
+	}
+	w.mountFDs[st.Fsid.Val] = fd
+	return nil
+}
+
+func (w *fanotifyWatcher) close() {
+	for _, fd := range w.mountFDs {
+		unix.Close(fd)
+	}
+	w.f.Close()
+}
+
+// mountFD returns the descriptor to open the handles of the
+// filesystem with fsid relative to
+func (w *fanotifyWatcher) mountFD(fsid [2]int32) int {
+	if fd, ok := w.mountFDs[fsid]; ok {
+		return fd
+	}
+	return atFDCWD
+}
+
+func (w *fanotifyWatcher) Name() string {
+	return Fanotify
+}
+
+// Watch starts listening for created/deleted/moved files
+func (w *fanotifyWatcher) Watch(changeReceiver chan<- FileChange) {
+	slog.Info("starting to listen on fanotify events")
+	r := bufio.NewReader(w.f)
+
+	for {
+		w.readEvent(r, changeReceiver)
+	}
+}
+
+// fanotifyEvent is an event read from a fanotify group
+type fanotifyEvent struct {
+	mask uint64
+	// fsid is the id of the filesystem of the handle
+	fsid [2]int32
+	// handle is the file handle of the directory the event happened
+	// in, nil if the event carries none
+	handle *unix.FileHandle
+}
+
+// errInvalidEvent is returned for events whose lengths don't add up
+var errInvalidEvent = errors.New("invalid fanotify event")
+
+// nextEvent reads the next event from r, the reads of a fanotify
+// group return whole events
+func nextEvent(r io.Reader) (fanotifyEvent, error) {
+	var metaBuff [fanMetadataLen]byte
+	if _, err := io.ReadFull(r, metaBuff[:]); err != nil {
+		return fanotifyEvent{}, err
+	}
+	eventLen := binary.NativeEndian.Uint32(metaBuff[metaEventLenOffset:])
+	metadataLen := uint32(binary.NativeEndian.Uint16(metaBuff[metaMetadataLenOffset:]))
+	if metadataLen < fanMetadataLen || eventLen < metadataLen || eventLen > maxEventLen {
+		return fanotifyEvent{}, errInvalidEvent
+	}
+
+	// the records after the metadata, newer kernels may
+	// send a longer metadata
+	infoBuff := make([]byte, eventLen-fanMetadataLen)
+	if _, err := io.ReadFull(r, infoBuff); err != nil {
+		return fanotifyEvent{}, err
+	}
+	infoBuff = infoBuff[metadataLen-fanMetadataLen:]
+
+	event := fanotifyEvent{mask: binary.NativeEndian.Uint64(metaBuff[metaMaskOffset:])}
+	if err := parseInfo(&event, infoBuff); err != nil {
+		return fanotifyEvent{}, err
+	}
+	return event, nil
+}
+
+// parseInfo sets the file handle of event from the first info record
+// in infoBuff, if it is one carrying a handle
+func parseInfo(event *fanotifyEvent, infoBuff []byte) error {
+	if len(infoBuff) < infoHandleOffset {
+		// overflow events carry no file handle
+		return nil
+	}
+	if infoBuff[infoTypeOffset] != fanEventInfoTypeFid {
+		return nil
+	}
+
+	// compared in uint64, so that no length wraps around on 32 bit
+	infoLen := uint64(binary.NativeEndian.Uint16(infoBuff[infoLenOffset:]))
+	handleEnd := uint64(infoHandleOffset) +
+		uint64(binary.NativeEndian.Uint32(infoBuff[infoHandleBytesOffset:]))
+	if handleEnd > uint64(len(infoBuff)) || handleEnd > infoLen {
+		return errInvalidEvent
+	}
+	handleType := int32(binary.NativeEndian.Uint32(infoBuff[infoHandleTypeOffset:]))
+	handle := unix.NewFileHandle(handleType, infoBuff[infoHandleOffset:handleEnd])
+	event.fsid = [2]int32{
+		int32(binary.NativeEndian.Uint32(infoBuff[infoFsidOffset:])),
+		int32(binary.NativeEndian.Uint32(infoBuff[infoFsidOffset+4:])),
+	}
+	event.handle = &handle
+	return nil
+}
+
+func (w *fanotifyWatcher) readEvent(r io.Reader, changeReceiver chan<- FileChange) {
+	event, err := nextEvent(r)
+	if err == errInvalidEvent {
+		slog.Warn("skipping an invalid fanotify event")
+		return
+	} else if err != nil {
+		return
+	}
+
+	if event.mask&unix.FAN_Q_OVERFLOW != 0 {
+		droppedEvents.Inc()
+		health.Overflowed()
+		slog.Warn("fanotify queue overflowed, events were lost")
+		return
+	}
+	if event.handle == nil {
+		return
+	}
+
+	fd, err := unix.OpenByHandleAt(w.mountFD(event.fsid), *event.handle, 0)
+	if err != nil {
+		droppedEvents.Inc()
+		slog.Warn("could not open file handle of event", "err", err)
+		return
+	}
+
+	defer func() {
+		err = syscall.Close(fd)
+		if err != nil {
+			slog.Warn("couldn't close file descriptor", "fd", fd, "err", err)
+		}
+	}()
+
+	path, err := readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+	if err != nil {
+		slog.Warn("could not resolve path of event", "fd", fd, "err", err)
+		return
+	}
+	slog.Debug("received event", "path", path,
+		"flags", maskToString(event.mask))
+	if config.IsPathFiltered(path) {
+		return
+	}
+
+	changeType, eventType := changeOf(event.mask)
+	eventsTotal.With(eventType).Inc()
+
+	change := FileChange{
+		path,
+		changeType,
+	}
+
+	changeReceiver <- change
+}
+
+// readlink returns the target of the symlink at path, the buffer
+// grows for targets of PATH_MAX bytes and more
+func readlink(path string) (string, error) {
+	for size := unix.PathMax; ; size *= 2 {
+		buf := make([]byte, size)
+		n, err := unix.Readlink(path, buf)
+		if err != nil {
+			return "", err
+		}
+		if n < size {
+			return string(buf[:n]), nil
+		}
+	}
+}
+
+// changeOf returns the change type of an event with mask and
+// its label in eventsTotal
+func changeOf(mask uint64) (int, string) {
+	changeType := 0
+	eventType := "other"
+	if mask&unix.IN_CREATE > 0 ||
+		mask&unix.IN_MOVED_TO > 0 {
+		changeType = Creation
+		eventType = "create"
+	}
+	if mask&unix.IN_DELETE > 0 ||
+		mask&unix.IN_MOVED_FROM > 0 {
+		changeType = Deletion
+		eventType = "delete"
+	}
+	return changeType, eventType
+}
+
+func maskToString(mask uint64) string {
+	var flags []string
+	if mask&unix.IN_ACCESS > 0 {
+		flags = append(flags, "FAN_ACCESS")
+	}
+	if mask&unix.IN_ATTRIB > 0 {
+		flags = append(flags, "FAN_ATTRIB")
+	}
+	if mask&unix.IN_CLOSE_NOWRITE > 0 {
+		flags = append(flags, "FAN_CLOSE_NOWRITE")
+	}
+	if mask&unix.IN_CLOSE_WRITE > 0 {
+		flags = append(flags, "FAN_CLOSE_WRITE")
+	}
+	if mask&unix.IN_CREATE > 0 {
+		flags = append(flags, "FAN_CREATE")
+	}
+	if mask&unix.IN_DELETE > 0 {
+		flags = append(flags, "FAN_DELETE")
+	}
+	if mask&unix.IN_DELETE_SELF > 0 {
+		flags = append(flags, "FAN_DELETE_SELF")
+	}
+	if mask&unix.IN_IGNORED > 0 {
+		flags = append(flags, "FAN_IGNORED")
+	}
+	if mask&unix.IN_ISDIR > 0 {
+		flags = append(flags, "FAN_ISDIR")
+	}
+	if mask&unix.IN_MODIFY > 0 {
+		flags = append(flags, "FAN_MODIFY")
+	}
+	if mask&unix.IN_MOVE_SELF > 0 {
+		flags = append(flags, "fanMoveSelf")
+	}
+	if mask&unix.IN_MOVED_FROM > 0 {
+		flags = append(flags, "fanMovedFrom")
+	}
+	if mask&unix.IN_MOVED_TO > 0 {
+		flags = append(flags, "fanMovedTo")
+	}
+	if mask&unix.IN_OPEN > 0 {
+		flags = append(flags, "FAN_OPEN")
+	}
+	if mask&unix.IN_Q_OVERFLOW > 0 {
+		flags = append(flags, "FAN_Q_OVERFLOW")
+	}
+	if mask&unix.IN_UNMOUNT > 0 {
+		flags = append(flags, "FAN_UNMOUNT")
+	}
+	return strings.Join(flags, ", ")
+}
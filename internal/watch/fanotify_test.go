@@ -0,0 +1,334 @@
+//go:build linux
+
+package watch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+	"testing/iotest"
+
+	"golang.org/x/sys/unix"
+)
+
+// rawEvent is an event as the kernel sends it
+type rawEvent struct {
+	mask uint64
+	// metadataLen is the length of the metadata, 24 if 0
+	metadataLen int
+	// infoType is the type of the info record, there is none if 0
+	infoType   uint8
+	handleType int32
+	handle     []byte
+	// handleLen overrides the length of the handle if set
+	handleLen uint32
+}
+
+// bytes encodes e like the kernel does
+func (e rawEvent) bytes() []byte {
+	metadataLen := e.metadataLen
+	if metadataLen == 0 {
+		metadataLen = fanMetadataLen
+	}
+	var info bytes.Buffer
+	if e.infoType != 0 {
+		handleLen := e.handleLen
+		if handleLen == 0 {
+			handleLen = uint32(len(e.handle))
+		}
+		binary.Write(&info, binary.NativeEndian, struct {
+			infoType, pad uint8
+			len           uint16
+			fsid          [2]int32
+			handleBytes   uint32
+			handleType    int32
+		}{e.infoType, 0, uint16(20 + len(e.handle)), [2]int32{1, 2}, handleLen, e.handleType})
+		info.Write(e.handle)
+	}
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.NativeEndian, unix.FanotifyEventMetadata{
+		Event_len:    uint32(metadataLen + info.Len()),
+		Vers:         unix.FANOTIFY_METADATA_VERSION,
+		Metadata_len: uint16(metadataLen),
+		Mask:         e.mask,
+		Fd:           -1,
+		Pid:          42,
+	})
+	b.Write(make([]byte, metadataLen-fanMetadataLen))
+	b.Write(info.Bytes())
+	return b.Bytes()
+}
+
+// withMetadataLen sets the metadata length of the encoded event raw
+func withMetadataLen(raw []byte, metadataLen uint16) []byte {
+	binary.NativeEndian.PutUint16(raw[6:], metadataLen)
+	return raw
+}
+
+// withEventLen sets the event length of the encoded event raw
+func withEventLen(raw []byte, eventLen uint32) []byte {
+	binary.NativeEndian.PutUint32(raw, eventLen)
+	return raw
+}
+
+func TestNextEvent(t *testing.T) {
+	handle := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	tests := []struct {
+		name       string
+		raw        []byte
+		wantMask   uint64
+		wantHandle []byte
+		wantErr    error
+	}{
+		{"create", rawEvent{mask: unix.IN_CREATE, infoType: fanEventInfoTypeFid,
+			handleType: 1, handle: handle}.bytes(), unix.IN_CREATE, handle, nil},
+		{"directory_deleted", rawEvent{mask: unix.IN_DELETE | unix.IN_ISDIR,
+			infoType: fanEventInfoTypeFid, handleType: 1, handle: handle}.bytes(),
+			unix.IN_DELETE | unix.IN_ISDIR, handle, nil},
+		{"overflow", rawEvent{mask: unix.FAN_Q_OVERFLOW}.bytes(),
+			unix.FAN_Q_OVERFLOW, nil, nil},
+		{"longer_metadata", rawEvent{mask: unix.IN_MOVED_TO, metadataLen: 32,
+			infoType: fanEventInfoTypeFid, handleType: 1, handle: handle}.bytes(),
+			unix.IN_MOVED_TO, handle, nil},
+		{"other_info_type", rawEvent{mask: unix.IN_CREATE, infoType: 2,
+			handleType: 1, handle: handle}.bytes(), unix.IN_CREATE, nil, nil},
+		{"handle_too_long", rawEvent{mask: unix.IN_CREATE, infoType: fanEventInfoTypeFid,
+			handleType: 1, handle: handle, handleLen: 200}.bytes(), 0, nil, errInvalidEvent},
+		{"short_metadata", withMetadataLen(rawEvent{mask: unix.IN_CREATE}.bytes(), 8),
+			0, nil, errInvalidEvent},
+		// wraps around when added to the offset of the handle in an int
+		// on 32 bit
+		{"handle_len_overflows", rawEvent{mask: unix.IN_CREATE, infoType: fanEventInfoTypeFid,
+			handleType: 1, handle: handle, handleLen: 0xfffffff0}.bytes(), 0, nil, errInvalidEvent},
+		{"event_too_long", withEventLen(rawEvent{mask: unix.IN_CREATE}.bytes(), 1<<30),
+			0, nil, errInvalidEvent},
+		{"truncated", rawEvent{mask: unix.IN_CREATE, infoType: fanEventInfoTypeFid,
+			handleType: 1, handle: handle}.bytes()[:30], 0, nil, io.ErrUnexpectedEOF},
+		{"empty", nil, 0, nil, io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := nextEvent(bytes.NewReader(tt.raw))
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if event.mask != tt.wantMask {
+				t.Errorf("got mask %#x, want %#x", event.mask, tt.wantMask)
+			}
+			if tt.wantHandle == nil {
+				if event.handle != nil {
+					t.Errorf("got handle %v, want none", event.handle.Bytes())
+				}
+				return
+			}
+			if event.handle == nil {
+				t.Fatal("got no handle")
+			}
+			if got := event.handle.Bytes(); !bytes.Equal(got, tt.wantHandle) ||
+				event.handle.Type() != 1 || event.fsid != [2]int32{1, 2} {
+				t.Errorf("got handle %v of type %d on %v, want %v of type 1 on [1 2]",
+					got, event.handle.Type(), event.fsid, tt.wantHandle)
+			}
+		})
+	}
+}
+
+// capturedEvents are events as read from fanotify groups, the layout
+// is the same on every architecture
+var capturedEvents = []struct {
+	name       string
+	raw        []byte
+	mask       uint64
+	fsid       [2]int32
+	handleType int32
+	handle     []byte
+}{
+	{
+		// a directory created on ext4
+		name: "amd64_create_dir",
+		raw: []byte{
+			0x34, 0x00, 0x00, 0x00, 0x03, 0x00, 0x18, 0x00, // event_len, vers, reserved, metadata_len
+			0x00, 0x01, 0x00, 0x40, 0x00, 0x00, 0x00, 0x00, // mask
+			0xff, 0xff, 0xff, 0xff, 0x3a, 0x1f, 0x00, 0x00, // fd, pid
+			0x01, 0x00, 0x1c, 0x00, // info_type, pad, len
+			0x10, 0x3c, 0x5b, 0x2a, 0x92, 0x7d, 0x1f, 0x6e, // fsid
+			0x08, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, // handle_bytes, handle_type
+			0x8b, 0x21, 0x0c, 0x00, 0x4e, 0x0a, 0xd9, 0x5c,
+		},
+		mask:       fanCreate | fanOndir,
+		fsid:       [2]int32{0x2a5b3c10, 0x6e1f7d92},
+		handleType: 1,
+		handle:     []byte{0x8b, 0x21, 0x0c, 0x00, 0x4e, 0x0a, 0xd9, 0x5c},
+	},
+	{
+		// a file moved away on btrfs
+		name: "arm64_moved_from",
+		raw: []byte{
+			0x38, 0x00, 0x00, 0x00, 0x03, 0x00, 0x18, 0x00,
+			0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			0xff, 0xff, 0xff, 0xff, 0x81, 0x04, 0x00, 0x00,
+			0x01, 0x00, 0x20, 0x00,
+			0xe7, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			0x0c, 0x00, 0x00, 0x00, 0x4d, 0x00, 0x00, 0x00,
+			0x03, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00,
+		},
+		mask:       fanMovedFrom,
+		fsid:       [2]int32{0x3e7, 0},
+		handleType: 0x4d,
+		handle:     []byte{0x03, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00},
+	},
+	{
+		name: "arm64_overflow",
+		raw: []byte{
+			0x18, 0x00, 0x00, 0x00, 0x03, 0x00, 0x18, 0x00,
+			0x00, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00,
+		},
+		mask: unix.FAN_Q_OVERFLOW,
+	},
+}
+
+func TestNextEvent_Captured(t *testing.T) {
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("the events were captured on little endian machines")
+	}
+	for _, tt := range capturedEvents {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := nextEvent(bytes.NewReader(tt.raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if event.mask != tt.mask {
+				t.Errorf("got mask %#x, want %#x", event.mask, tt.mask)
+			}
+			if tt.handle == nil {
+				if event.handle != nil {
+					t.Errorf("got handle %v, want none", event.handle.Bytes())
+				}
+				return
+			}
+			if event.handle == nil {
+				t.Fatal("got no handle")
+			}
+			if got := event.handle.Bytes(); !bytes.Equal(got, tt.handle) ||
+				event.handle.Type() != tt.handleType || event.fsid != tt.fsid {
+				t.Errorf("got handle %v of type %d on %v, want %v of type %d on %v",
+					got, event.handle.Type(), event.fsid, tt.handle, tt.handleType, tt.fsid)
+			}
+		})
+	}
+}
+
+// FuzzNextEvent reads events from arbitrary bytes, which must not
+// panic and must consume the bytes of every valid event
+func FuzzNextEvent(f *testing.F) {
+	for _, e := range capturedEvents {
+		f.Add(e.raw)
+	}
+	f.Add(rawEvent{mask: unix.IN_CREATE, infoType: fanEventInfoTypeFid,
+		handleType: 1, handle: []byte{1, 2}, handleLen: 0xffffffff}.bytes())
+	f.Add(rawEvent{mask: unix.IN_CREATE, metadataLen: 0xfff0}.bytes()[:24])
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		r := bytes.NewReader(raw)
+		for {
+			before := r.Len()
+			event, err := nextEvent(r)
+			if err != nil {
+				return
+			}
+			if event.handle != nil && len(event.handle.Bytes()) > before {
+				t.Fatalf("handle of %d bytes from %d bytes", len(event.handle.Bytes()), before)
+			}
+			if r.Len() >= before {
+				t.Fatal("read an event without consuming input")
+			}
+		}
+	})
+}
+
+func TestNextEvent_MultipleEvents(t *testing.T) {
+	events := []rawEvent{
+		{mask: unix.IN_CREATE, infoType: fanEventInfoTypeFid, handleType: 1, handle: []byte{1, 1, 1, 1}},
+		{mask: unix.FAN_Q_OVERFLOW},
+		{mask: unix.IN_MOVED_FROM, infoType: fanEventInfoTypeFid, handleType: 1, handle: []byte{2, 2, 2, 2, 2, 2, 2, 2}},
+		{mask: unix.IN_DELETE, infoType: fanEventInfoTypeFid, handleType: 1, handle: []byte{3, 3, 3, 3}},
+	}
+	var raw []byte
+	var want []uint64
+	for _, e := range events {
+		raw = append(raw, e.bytes()...)
+		want = append(want, e.mask)
+	}
+
+	readers := map[string]func() io.Reader{
+		"single_read":   func() io.Reader { return bytes.NewReader(raw) },
+		"one_byte_read": func() io.Reader { return iotest.OneByteReader(bytes.NewReader(raw)) },
+		// events span the buffer of the reader
+		"small_buffer": func() io.Reader { return bufio.NewReaderSize(bytes.NewReader(raw), 16) },
+	}
+	for name, reader := range readers {
+		t.Run(name, func(t *testing.T) {
+			r := reader()
+			var got []uint64
+			for {
+				event, err := nextEvent(r)
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, event.mask)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got masks %#x, want %#x", got, want)
+			}
+		})
+	}
+}
+
+func TestReadEvent_Overflow(t *testing.T) {
+	raw := append(rawEvent{mask: unix.FAN_Q_OVERFLOW}.bytes(),
+		rawEvent{mask: unix.IN_CREATE, infoType: 2}.bytes()...)
+	r := bytes.NewReader(raw)
+	changes := make(chan FileChange, 1)
+	var w fanotifyWatcher
+	w.readEvent(r, changes)
+	w.readEvent(r, changes)
+
+	if len(changes) != 0 {
+		t.Errorf("got %+v for events without a file handle", <-changes)
+	}
+	if r.Len() != 0 {
+		t.Errorf("%d bytes weren't read", r.Len())
+	}
+}
+
+func TestChangeOf(t *testing.T) {
+	tests := []struct {
+		mask       uint64
+		wantChange int
+		wantLabel  string
+	}{
+		{unix.IN_CREATE, Creation, "create"},
+		{unix.IN_CREATE | unix.IN_ISDIR, Creation, "create"},
+		{unix.IN_MOVED_TO, Creation, "create"},
+		{unix.IN_DELETE, Deletion, "delete"},
+		{unix.IN_MOVED_FROM | unix.IN_ISDIR, Deletion, "delete"},
+		{unix.IN_ATTRIB, Creation, "other"},
+	}
+	for _, tt := range tests {
+		change, label := changeOf(tt.mask)
+		if change != tt.wantChange || label != tt.wantLabel {
+			t.Errorf("changeOf(%s) = %d, %s, want %d, %s", maskToString(tt.mask),
+				change, label, tt.wantChange, tt.wantLabel)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+//go:build linux
+
+package watch
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"github.com/karrick/godirwalk"
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/health"
+	"github.com/ozeidan/gosearch/internal/mounts"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM |
+	unix.IN_MOVED_TO | unix.IN_ONLYDIR | unix.IN_DONT_FOLLOW | unix.IN_EXCL_UNLINK
+
+// inotifyWatcher watches every directory below the roots on its own,
+// which is limited by fs.inotify.max_user_watches
+type inotifyWatcher struct {
+	f     *os.File
+	roots []string
+	// paths maps the watch descriptors to their directories
+	paths map[int]string
+	wds   map[string]int
+	// exhausted is set once a watch couldn't be added
+	// for lack of watches
+	exhausted bool
+}
+
+func newInotify(roots []string) (Watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not call inotify_init1")
+	}
+
+	return &inotifyWatcher{
+		f:     os.NewFile(uintptr(fd), "inotify"),
+		roots: roots,
+		paths: make(map[int]string),
+		wds:   make(map[string]int),
+	}, nil
+}
+
+func (w *inotifyWatcher) Name() string {
+	return Inotify
+}
+
+// Watch adds watches for all directories below the roots
+// and listens for their events
+func (w *inotifyWatcher) Watch(changeReceiver chan<- FileChange) {
+	for _, root := range w.roots {
+		w.addRecursively(root)
+	}
+	slog.Info("starting to listen on inotify events", "watches", len(w.paths))
+
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			slog.Error("couldn't read inotify events", "err", err)
+			return
+		}
+		w.handleEvents(buf[:n], changeReceiver)
+	}
+}
+
+// handleEvents decodes the events in buf
+func (w *inotifyWatcher) handleEvents(buf []byte, changeReceiver chan<- FileChange) {
+	for offset := 0; offset+unix.SizeofInotifyEvent <= len(buf); {
+		event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		nameStart := offset + unix.SizeofInotifyEvent
+		offset = nameStart + int(event.Len)
+		if offset > len(buf) {
+			return
+		}
+		name := strings.TrimRight(string(buf[nameStart:offset]), "\x00")
+
+		if change, ok := w.handleEvent(event.Wd, event.Mask, name); ok {
+			changeReceiver <- change
+		}
+	}
+}
+
+// handleEvent keeps the watches in sync with the directories
+// and returns the change to report
+func (w *inotifyWatcher) handleEvent(wd int32, mask uint32, name string) (FileChange, bool) {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		droppedEvents.Inc()
+		health.Overflowed()
+		slog.Warn("inotify queue overflowed, events were lost")
+		return FileChange{}, false
+	}
+
+	dir, ok := w.paths[int(wd)]
+	if !ok {
+		return FileChange{}, false
+	}
+	if mask&unix.IN_IGNORED != 0 {
+		delete(w.paths, int(wd))
+		delete(w.wds, dir)
+		return FileChange{}, false
+	}
+
+	path := filepath.Join(dir, name)
+	slog.Debug("received event", "path", path, "flags", maskToString(uint64(mask)))
+	if config.IsPathFiltered(dir) {
+		return FileChange{}, false
+	}
+
+	if mask&unix.IN_ISDIR != 0 {
+		switch {
+		case mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+			w.addRecursively(path)
+		case mask&unix.IN_MOVED_FROM != 0:
+			w.removeRecursively(path)
+		}
+	}
+
+	change := FileChange{dir, Creation}
+	eventType := "create"
+	if mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0 {
+		change.ChangeType = Deletion
+		eventType = "delete"
+	}
+	eventsTotal.With(eventType).Inc()
+	return change, true
+}
+
+// addRecursively watches the directory at path and all directories
+// below it that aren't filtered or on a filesystem of an excluded type
+func (w *inotifyWatcher) addRecursively(path string) {
+	godirwalk.Walk(path, &godirwalk.Options{
+		Callback: func(osPathname string, de *godirwalk.Dirent) error {
+			if !de.IsDir() {
+				return nil
+			}
+			if config.FilterPath(osPathname) == config.Excluded {
+				return filepath.SkipDir
+			}
+			if mounts.IsMountPoint(osPathname) && config.IsOnFilteredFS(osPathname) {
+				return filepath.SkipDir
+			}
+			if remaining, limited := config.RemainingDepth(osPathname); limited && remaining < 0 {
+				return filepath.SkipDir
+			}
+			w.add(osPathname)
+			return nil
+		},
+		Unsorted: true,
+		ErrorCallback: func(osPathname string, err error) godirwalk.ErrorAction {
+			slog.Debug("couldn't watch directory", "path", osPathname, "err", err)
+			return godirwalk.SkipNode
+		},
+	})
+}
+
+func (w *inotifyWatcher) add(path string) {
+	wd, err := unix.InotifyAddWatch(int(w.f.Fd()), path, inotifyMask)
+	if err == unix.ENOSPC {
+		if !w.exhausted {
+			w.exhausted = true
+			slog.Warn("out of inotify watches, changes of some directories "+
+				"are missed, raise fs.inotify.max_user_watches", "watches", len(w.paths))
+		}
+		return
+	} else if err != nil {
+		slog.Debug("couldn't watch directory", "path", path, "err", err)
+		return
+	}
+
+	w.paths[wd] = path
+	w.wds[path] = wd
+}
+
+// removeRecursively drops the watches of the directory at path and
+// all directories below it, they were moved away
+func (w *inotifyWatcher) removeRecursively(path string) {
+	prefix := path + "/"
+	for dir, wd := range w.wds {
+		if dir != path && !strings.HasPrefix(dir, prefix) {
+			continue
+		}
+		unix.InotifyRmWatch(int(w.f.Fd()), uint32(wd))
+		delete(w.paths, wd)
+		delete(w.wds, dir)
+	}
+}
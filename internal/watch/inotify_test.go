@@ -0,0 +1,66 @@
+//go:build linux
+
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInotify(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := newInotify([]string{root})
+	if err != nil {
+		t.Skip("inotify isn't available:", err)
+	}
+	watcher := w.(*inotifyWatcher)
+	watcher.addRecursively(root)
+
+	changes := make(chan FileChange, 10)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := watcher.f.Read(buf)
+			if err != nil {
+				return
+			}
+			watcher.handleEvents(buf[:n], changes)
+		}
+	}()
+	defer watcher.f.Close()
+
+	expect := func(dir string, changeType int) {
+		t.Helper()
+		select {
+		case change := <-changes:
+			if change.FolderPath != dir || change.ChangeType != changeType {
+				t.Errorf("got %+v, want {%s %d}", change, dir, changeType)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no change reported for %s", dir)
+		}
+	}
+
+	ioutil.WriteFile(filepath.Join(root, "a/file"), nil, 0644)
+	expect(filepath.Join(root, "a"), Creation)
+
+	// new directories are watched as well
+	os.Mkdir(filepath.Join(root, "a/b"), 0755)
+	expect(filepath.Join(root, "a"), Creation)
+	ioutil.WriteFile(filepath.Join(root, "a/b/file"), nil, 0644)
+	expect(filepath.Join(root, "a/b"), Creation)
+
+	// watches follow renamed directories
+	os.Rename(filepath.Join(root, "a"), filepath.Join(root, "c"))
+	expect(root, Deletion)
+	expect(root, Creation)
+	os.Remove(filepath.Join(root, "c/b/file"))
+	expect(filepath.Join(root, "c/b"), Deletion)
+}
@@ -0,0 +1,194 @@
+//go:build linux
+
+package watch
+
+import (
+	"log/slog"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/karrick/godirwalk"
+	"github.com/ozeidan/gosearch/internal/config"
+	"github.com/ozeidan/gosearch/internal/mounts"
+)
+
+// settleTime is how long after a change the mtime of a directory
+// is distrusted, further changes within the timestamp granularity
+// of the filesystem wouldn't change it
+const settleTime = 2 * time.Second
+
+// poller walks the directories below its roots periodically. Creating,
+// deleting or renaming an entry changes the mtime of its directory, so
+// only directories with a new mtime are read, the others are just
+// stat'ed.
+type poller struct {
+	roots    []string
+	interval time.Duration
+	dirs     map[string]*polledDir
+	// started is when the watcher was created, directories changed
+	// since then are reported on the first pass
+	started time.Time
+	now     func() time.Time
+}
+
+// polledDir is the state of a directory at the last pass
+type polledDir struct {
+	mtime   time.Time
+	ino     uint64
+	entries int
+	subdirs []string
+	// unsettled directories are reported again on the next pass,
+	// changes within the settle time could be missed otherwise
+	unsettled bool
+}
+
+func newPoller(roots []string, interval time.Duration) Watcher {
+	return &poller{
+		roots:    roots,
+		interval: interval,
+		dirs:     make(map[string]*polledDir),
+		started:  time.Now(),
+		now:      time.Now,
+	}
+}
+
+func (p *poller) Name() string {
+	return Polling
+}
+
+// Watch polls the roots every interval
+func (p *poller) Watch(changeReceiver chan<- FileChange) {
+	slog.Info("starting to poll the filesystem", "interval", p.interval)
+	for {
+		start := time.Now()
+		changes := p.poll()
+		slog.Debug("polled the filesystem", "directories", len(p.dirs),
+			"changes", len(changes), "duration", time.Since(start))
+
+		for _, change := range changes {
+			changeReceiver <- change
+		}
+		time.Sleep(p.interval)
+	}
+}
+
+// poll walks the roots once and returns the changed directories
+func (p *poller) poll() []FileChange {
+	var changes []FileChange
+	for _, root := range p.roots {
+		p.visit(root, &changes)
+	}
+	return changes
+}
+
+// visit compares the directory at path with the last pass
+// and visits its subdirectories
+func (p *poller) visit(path string, changes *[]FileChange) {
+	var st syscall.Stat_t
+	if err := syscall.Lstat(path, &st); err != nil ||
+		st.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		// its parent changed as well and reports it
+		p.forget(path)
+		return
+	}
+	mtime := time.Unix(st.Mtim.Unix())
+
+	d, known := p.dirs[path]
+	if known && !d.unsettled && d.mtime.Equal(mtime) && d.ino == st.Ino {
+		for _, subdir := range d.subdirs {
+			p.visit(subdir, changes)
+		}
+		return
+	}
+
+	previous := d
+	d = p.read(path)
+	if d == nil {
+		p.forget(path)
+		return
+	}
+	d.mtime = mtime
+	d.ino = st.Ino
+	d.unsettled = p.now().Sub(mtime) < settleTime
+	p.dirs[path] = d
+
+	switch {
+	case previous != nil:
+		changeType := Creation
+		if d.entries < previous.entries {
+			changeType = Deletion
+		}
+		*changes = append(*changes, FileChange{path, changeType})
+		eventsTotal.With(eventType(changeType)).Inc()
+
+		// the subdirectories that are gone aren't visited anymore
+		current := make(map[string]bool, len(d.subdirs))
+		for _, subdir := range d.subdirs {
+			current[subdir] = true
+		}
+		for _, subdir := range previous.subdirs {
+			if !current[subdir] {
+				p.forget(subdir)
+			}
+		}
+	case !mtime.Before(p.started.Add(-settleTime)):
+		// changed while the initial index might have been running
+		*changes = append(*changes, FileChange{path, Creation})
+		eventsTotal.With("create").Inc()
+	}
+
+	for _, subdir := range d.subdirs {
+		p.visit(subdir, changes)
+	}
+}
+
+// read lists the subdirectories of the directory at path that aren't
+// filtered or on a filesystem of an excluded type, it returns nil if
+// the directory can't be read
+func (p *poller) read(path string) *polledDir {
+	dirents, err := godirwalk.ReadDirents(path, nil)
+	if err != nil {
+		slog.Debug("couldn't poll directory", "path", path, "err", err)
+		return nil
+	}
+
+	d := &polledDir{entries: len(dirents)}
+	for _, dirent := range dirents {
+		if !dirent.IsDir() {
+			continue
+		}
+		subdir := filepath.Join(path, dirent.Name())
+		if config.FilterPath(subdir) == config.Excluded {
+			continue
+		}
+		// filesystems can only change at mount points
+		if mounts.IsMountPoint(subdir) && config.IsOnFilteredFS(subdir) {
+			continue
+		}
+		if remaining, limited := config.RemainingDepth(subdir); limited && remaining < 0 {
+			continue
+		}
+		d.subdirs = append(d.subdirs, subdir)
+	}
+	return d
+}
+
+// forget drops the directory at path and the directories below it
+func (p *poller) forget(path string) {
+	d, ok := p.dirs[path]
+	if !ok {
+		return
+	}
+	delete(p.dirs, path)
+	for _, subdir := range d.subdirs {
+		p.forget(subdir)
+	}
+}
+
+func eventType(changeType int) string {
+	if changeType == Deletion {
+		return "delete"
+	}
+	return "create"
+}
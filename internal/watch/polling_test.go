@@ -0,0 +1,122 @@
+//go:build linux
+
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func changedDirs(changes []FileChange) []string {
+	dirs := []string{}
+	for _, change := range changes {
+		dirs = append(dirs, change.FolderPath)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+func TestPoller(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/b", "c"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the directories were changed long before the watcher started
+	past := time.Now().Add(-time.Hour)
+	touch := func(dir string, mtime time.Time) {
+		t.Helper()
+		if err := os.Chtimes(filepath.Join(root, dir), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dir := range []string{"a/b", "a", "c", "."} {
+		touch(dir, past)
+	}
+
+	p := newPoller([]string{root}, time.Minute).(*poller)
+	if changes := p.poll(); len(changes) != 0 {
+		t.Fatalf("first pass reported %v", changedDirs(changes))
+	}
+
+	tests := []struct {
+		name   string
+		change func()
+		want   []string
+	}{
+		{"nothing", func() {}, []string{}},
+		{
+			"create_file",
+			func() {
+				ioutil.WriteFile(filepath.Join(root, "a/b/file"), nil, 0644)
+				touch("a/b", past.Add(time.Minute))
+			},
+			[]string{filepath.Join(root, "a/b")},
+		},
+		{
+			"create_directory",
+			func() {
+				os.Mkdir(filepath.Join(root, "c/d"), 0755)
+				touch("c/d", past)
+				touch("c", past.Add(time.Minute))
+			},
+			[]string{filepath.Join(root, "c")},
+		},
+		{
+			"new_directory_is_polled",
+			func() {
+				ioutil.WriteFile(filepath.Join(root, "c/d/file"), nil, 0644)
+				touch("c/d", past.Add(time.Minute))
+			},
+			[]string{filepath.Join(root, "c/d")},
+		},
+		{
+			"delete_directory",
+			func() {
+				os.RemoveAll(filepath.Join(root, "a/b"))
+				touch("a", past.Add(2*time.Minute))
+			},
+			[]string{filepath.Join(root, "a")},
+		},
+		{
+			"unsettled",
+			func() { touch("c", time.Now()) },
+			[]string{filepath.Join(root, "c")},
+		},
+		{
+			"unsettled_reported_again",
+			func() {},
+			[]string{filepath.Join(root, "c")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.change()
+			p.now = func() time.Time { return time.Now() }
+			if got := changedDirs(p.poll()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("poll() changed %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, ok := p.dirs[filepath.Join(root, "a/b")]; ok {
+		t.Error("deleted directory is still polled")
+	}
+}
+
+func TestPoller_ChangedDuringIndex(t *testing.T) {
+	root := t.TempDir()
+	p := newPoller([]string{root}, time.Minute).(*poller)
+
+	// the root was created just now, the initial index might
+	// have missed its changes
+	if got := changedDirs(p.poll()); !reflect.DeepEqual(got, []string{root}) {
+		t.Errorf("first pass changed %v, want [%s]", got, root)
+	}
+}
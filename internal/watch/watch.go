@@ -0,0 +1,179 @@
+// Package watch reports changes of the filesystem as the directories
+// they happened in, using fanotify, inotify or polling
+package watch
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/metrics"
+	"github.com/pkg/errors"
+)
+
+// FileChange describes the event of changes in a directory
+// FolderPath is the path of the directory
+// Changetype is either Creation or Deletion
+type FileChange struct {
+	FolderPath string
+	ChangeType int
+}
+
+const (
+	// Creation of a file/directory
+	Creation = iota
+	// Deletion of a file/directory
+	Deletion
+)
+
+// Names of the backends
+const (
+	Auto     = "auto"
+	Fanotify = "fanotify"
+	Inotify  = "inotify"
+	Polling  = "polling"
+)
+
+// Watcher sends the changes of the filesystem to the indexer
+type Watcher interface {
+	// Name is the name of the backend
+	Name() string
+	// Watch sends the changes to changeReceiver, it doesn't return
+	Watch(changeReceiver chan<- FileChange)
+}
+
+// Options configures the watcher
+type Options struct {
+	// Backend is one of the backend names, Auto picks the first
+	// one that can be set up
+	Backend string
+	// Roots are the directories whose changes are reported
+	Roots []string
+	// PollInterval is the time between two passes of the polling backend
+	PollInterval time.Duration
+}
+
+var (
+	eventsTotal = metrics.NewCounterVec("fanotify_events_total",
+		"Filesystem events received", "type", "create", "delete", "other")
+	droppedEvents = metrics.NewCounter("dropped_events_total",
+		"Filesystem events lost to queue overflows or vanished directories")
+)
+
+// EventCounts returns the number of events received by type
+// and the number of events lost since the start
+func EventCounts() (received map[string]uint64, dropped uint64) {
+	received = make(map[string]uint64)
+	for _, eventType := range []string{"create", "delete", "other"} {
+		received[eventType] = eventsTotal.With(eventType).Value()
+	}
+	return received, droppedEvents.Value()
+}
+
+var watched struct {
+	sync.Mutex
+	backend string
+	roots   []string
+	// devs are the device numbers of the filesystems of the roots
+	devs []uint64
+}
+
+// Watched returns the roots whose changes are watched
+func Watched() []string {
+	watched.Lock()
+	defer watched.Unlock()
+	return append([]string(nil), watched.roots...)
+}
+
+// Covers returns whether the changes of the filesystem with the
+// device number dev mounted at mountPoint are watched. fanotify
+// watches the filesystems of the roots, the other backends all
+// directories below them.
+func Covers(dev uint64, mountPoint string) bool {
+	watched.Lock()
+	defer watched.Unlock()
+	for i, root := range watched.roots {
+		if watched.backend == Fanotify {
+			if watched.devs[i] == dev {
+				return true
+			}
+			continue
+		}
+		if root == "/" || mountPoint == root || strings.HasPrefix(mountPoint, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteFSTypes are the types of network filesystems, which can be
+// changed on other machines without any backend noticing
+var remoteFSTypes = map[string]bool{
+	"nfs": true, "nfs4": true, "cifs": true, "smb3": true, "smbfs": true,
+	"9p": true, "ceph": true, "glusterfs": true, "afs": true,
+}
+
+// Reliable returns whether the changes seen on a filesystem of type
+// fsType are all of its changes. Network and FUSE filesystems can be
+// changed elsewhere, like on the server of an nfs export.
+func Reliable(fsType string) bool {
+	return !remoteFSTypes[fsType] && fsType != "fuse" && !strings.HasPrefix(fsType, "fuse.")
+}
+
+// Backend returns the name of the backend in use,
+// empty if nothing is watched
+func Backend() string {
+	watched.Lock()
+	defer watched.Unlock()
+	return watched.backend
+}
+
+type opener func(Options) (Watcher, error)
+
+// backend is a named opener, the backends of the platform are tried
+// in their order by Auto
+type backend struct {
+	name string
+	open opener
+}
+
+// Open sets up the backend of options. It has to be called before
+// dropping privileges, fanotify needs CAP_SYS_ADMIN.
+func Open(options Options) (Watcher, error) {
+	var w Watcher
+	var err error
+	for _, backend := range backends {
+		if options.Backend != Auto && options.Backend != backend.name {
+			continue
+		}
+
+		w, err = backend.open(options)
+		if err == nil {
+			break
+		}
+		if options.Backend == Auto {
+			slog.Warn("couldn't set up watcher backend, trying the next one",
+				"backend", backend.name, "err", err)
+		}
+	}
+	if w == nil && err == nil {
+		err = errors.Errorf("unknown watcher backend %q", options.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	devs := make([]uint64, len(options.Roots))
+	for i, root := range options.Roots {
+		devs[i] = deviceOf(root)
+	}
+
+	watched.Lock()
+	defer watched.Unlock()
+	watched.backend = w.Name()
+	watched.roots = append([]string(nil), options.Roots...)
+	watched.devs = devs
+	slog.Info("watching the filesystem", "backend", w.Name(), "roots", options.Roots)
+	return w, nil
+}
@@ -0,0 +1,20 @@
+package watch
+
+import "golang.org/x/sys/unix"
+
+// backends are tried in this order by Auto
+var backends = []backend{
+	{Fanotify, func(o Options) (Watcher, error) { return newFanotify(o.Roots) }},
+	{Inotify, func(o Options) (Watcher, error) { return newInotify(o.Roots) }},
+	{Polling, func(o Options) (Watcher, error) { return newPoller(o.Roots, o.PollInterval), nil }},
+}
+
+// deviceOf returns the device number of the filesystem of path,
+// 0 if it can't be stat'ed
+func deviceOf(path string) uint64 {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0
+	}
+	return uint64(st.Dev)
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+
+package watch
+
+import (
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupported is returned by Open on platforms without fanotify,
+// inotify and the device numbers the polling backend relies on
+var ErrUnsupported = errors.Errorf("watching the filesystem isn't supported on %s", runtime.GOOS)
+
+// backends all fail, so Open reports ErrUnsupported for any of them
+var backends = []backend{
+	{Fanotify, unsupported},
+	{Inotify, unsupported},
+	{Polling, unsupported},
+}
+
+func unsupported(Options) (Watcher, error) {
+	return nil, ErrUnsupported
+}
+
+// deviceOf returns 0, device numbers aren't known
+func deviceOf(string) uint64 {
+	return 0
+}
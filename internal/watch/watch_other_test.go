@@ -0,0 +1,23 @@
+//go:build !linux
+
+package watch
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestOpen_Unsupported(t *testing.T) {
+	for _, backend := range []string{Auto, Fanotify, Inotify, Polling} {
+		t.Run(backend, func(t *testing.T) {
+			w, err := Open(Options{Backend: backend, Roots: []string{t.TempDir()}})
+			if w != nil || errors.Cause(err) != ErrUnsupported {
+				t.Errorf("Open() = %v, %v, want ErrUnsupported", w, err)
+			}
+			if Backend() != "" {
+				t.Errorf("Backend() = %q after failing to open", Backend())
+			}
+		})
+	}
+}
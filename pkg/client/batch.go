@@ -0,0 +1,161 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// BatchResult holds the responses to one query of a batch
+type BatchResult struct {
+	// Query is the query answered
+	Query string
+	// Lines are the response lines, they keep their terminator
+	Lines []string
+	// Err is the request.ErrorResponse of a rejected query
+	Err error
+}
+
+// SearchBatch sends all queries over a single connection, each with
+// the given options. The result of each query is sent once it is
+// complete, in the order of queries. The channel is closed after the
+// last result, or early if ctx is done or the connection fails.
+func SearchBatch(ctx context.Context, queries []string,
+	options ...Option) (<-chan BatchResult, error) {
+	template := new(request.Request)
+	for _, option := range options {
+		option(template)
+	}
+	if err := template.Settings.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
+	if !request.IsQuery(template.Settings.Action) {
+		return nil, fmt.Errorf("%w: only searches can be batched", ErrInvalidSettings)
+	}
+
+	batch := request.Request{
+		Version:  request.ProtocolVersion,
+		Features: request.SupportedFeatures,
+		Settings: request.Settings{
+			Action:        request.Batch,
+			NullDelimited: template.Settings.NullDelimited,
+		},
+	}
+
+	var dialer net.Dialer
+	c, err := dialer.DialContext(ctx, "unix", SocketPath)
+	if err != nil {
+		return nil, ErrConnectionFailed
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-stop:
+		}
+	}()
+	hangUp := func() {
+		close(stop)
+		c.Close()
+	}
+
+	if err := json.NewEncoder(c).Encode(&batch); err != nil {
+		hangUp()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(c)
+	first, _ := reader.ReadString('\n')
+	if ctx.Err() != nil {
+		hangUp()
+		return nil, ctx.Err()
+	}
+	hello, _ := request.ParseHello(strings.TrimSuffix(first, "\n"))
+	required := append(request.RequiredFeatures(batch.Settings),
+		request.RequiredFeatures(template.Settings)...)
+	for _, feature := range required {
+		if !hello.Has(feature) {
+			hangUp()
+			return nil, ErrUnsupported
+		}
+	}
+
+	// the requests are written while the responses are read, the
+	// server stops reading if its responses aren't
+	go func() {
+		encoder := json.NewEncoder(c)
+		for i, query := range queries {
+			req := *template
+			req.ID = i + 1
+			if template.RequestID != "" {
+				req.RequestID = template.RequestID + "-" + strconv.Itoa(req.ID)
+			}
+			req.Query = query
+			if err := encoder.Encode(&req); err != nil {
+				return
+			}
+		}
+		if uc, ok := c.(*net.UnixConn); ok {
+			uc.CloseWrite()
+		}
+	}()
+
+	delimiter := request.Settings{NullDelimited: batch.Settings.NullDelimited}.Delimiter()
+	readLine := newLineReader(reader, hello.Has(request.FeatureFraming), delimiter)
+	line, err := readLine()
+	if e, ok := request.ParseError(strings.TrimSuffix(line, string(delimiter))); ok {
+		// the batch itself was rejected
+		hangUp()
+		return nil, e
+	}
+
+	results := make(chan BatchResult)
+	go func() {
+		defer close(results)
+		defer hangUp()
+
+		pending := make(map[int]*BatchResult)
+		complete := make(map[int]bool)
+		next := 1
+		for ; err == nil; line, err = readLine() {
+			response, ok := request.ParseBatchResponse(strings.TrimSuffix(line, string(delimiter)))
+			if !ok || response.ID < 1 || response.ID > len(queries) {
+				continue
+			}
+			result := pending[response.ID]
+			if result == nil {
+				result = &BatchResult{Query: queries[response.ID-1]}
+				pending[response.ID] = result
+			}
+			if response.Line != "" {
+				if e, ok := request.ParseError(response.Line); ok {
+					result.Err = e
+				} else {
+					result.Lines = append(result.Lines, response.Line+string(delimiter))
+				}
+				continue
+			}
+
+			complete[response.ID] = true
+			for ; complete[next]; next++ {
+				select {
+				case results <- *pending[next]:
+				case <-ctx.Done():
+					return
+				}
+				delete(pending, next)
+				delete(complete, next)
+			}
+		}
+	}()
+
+	return results, nil
+}
@@ -2,9 +2,14 @@ package client
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/ozeidan/gosearch/internal/request"
 )
@@ -13,6 +18,17 @@ type Option func(req *request.Request)
 
 var ErrConnectionFailed = errors.New("could not connect to the server")
 
+// SocketPath is the path of the server's socket. It defaults to
+// $GOSEARCH_SOCKET, or request.SockAddr if that isn't set.
+var SocketPath = defaultSocketPath()
+
+func defaultSocketPath() string {
+	if path := os.Getenv("GOSEARCH_SOCKET"); path != "" {
+		return path
+	}
+	return request.SockAddr
+}
+
 func Fuzzy(req *request.Request) {
 	req.Settings.Action = request.FuzzySearch
 }
@@ -25,6 +41,283 @@ func PathSearch(req *request.Request) {
 	req.Settings.Action = request.PathSearch
 }
 
+// SegmentSearch fuzzy searches names, the parts of the query before
+// a slash match the names of parent directories
+func SegmentSearch(req *request.Request) {
+	req.Settings.Action = request.SegmentSearch
+}
+
+// Duplicates finds the names shared by at least minCount entries,
+// the query is an optional glob pattern for the names
+func Duplicates(minCount int) Option {
+	return func(req *request.Request) {
+		req.Settings.Action = request.Duplicates
+		req.Settings.MinCount = minCount
+	}
+}
+
+// ChangedSince finds the entries modified after since
+func ChangedSince(since time.Time) Option {
+	return func(req *request.Request) {
+		req.Settings.Action = request.ChangedSince
+		req.Settings.Since = since.Unix()
+	}
+}
+
+// History lists the changes the server recorded in its journal for
+// the paths matching the query, a glob pattern or a substring
+func History(req *request.Request) {
+	req.Settings.Action = request.History
+}
+
+// Jump finds the directories whose name starts with the query, the
+// best last. Those named like the query rank first, then those the
+// client reported the most recent visits of with Visit.
+func Jump(req *request.Request) {
+	req.Settings.Action = request.Jump
+}
+
+// Visit tells the server that the client changed into the directory
+// given as query, which ranks it higher in the results of Jump
+func Visit(req *request.Request) {
+	req.Settings.Action = request.Visit
+}
+
+// Trash lists the entries in the trash directories whose original
+// path matches the query, a glob pattern or a substring, the most
+// recently deleted last. Lines hold the deletion time, the original
+// path and the path in the trash, separated by tabs.
+func Trash(req *request.Request) {
+	req.Settings.Action = request.Trash
+}
+
+// Deleted searches the entries recently deleted from the index instead,
+// by the names matching the query, the most recently deleted last.
+// Lines hold the deletion time and the path, separated by a tab. The
+// names are matched like Fuzzy or PrefixSearch find them if one of
+// those is set before Deleted, by substring otherwise.
+func Deleted(req *request.Request) {
+	switch req.Settings.Action {
+	case request.FuzzySearch, request.PrefixSearch:
+		req.Settings.Match = req.Settings.Action
+	}
+	req.Settings.Action = request.Deleted
+}
+
+// Recent lists the entries created within the last duration instead,
+// whose names match the query, the most recently created first. Lines
+// hold the creation time and the path, separated by a tab. An empty
+// query lists all of them. The names are matched like Fuzzy or
+// PrefixSearch find them if one of those is set before Recent, by
+// substring otherwise.
+func Recent(within time.Duration) Option {
+	return func(req *request.Request) {
+		switch req.Settings.Action {
+		case request.FuzzySearch, request.PrefixSearch:
+			req.Settings.Match = req.Settings.Action
+		}
+		req.Settings.Action = request.Recent
+		// rounded up, so durations below a second list something
+		req.Settings.Within = int64((within + time.Second - 1) / time.Second)
+	}
+}
+
+// Tree makes the server send the number of entries at and below each
+// entry of the directory given as query, the largest first, followed by
+// that of the directory. Lines hold the number and the path, separated
+// by a tab.
+func Tree(req *request.Request) {
+	req.Settings.Action = request.Tree
+}
+
+// Links lists the other indexed paths of the file given as query,
+// the hard links to it, sorted by path
+func Links(req *request.Request) {
+	req.Settings.Action = request.Links
+}
+
+// RefreshPath makes the server read the entry given as query and
+// everything below it again, with their tags
+func RefreshPath(req *request.Request) {
+	req.Settings.Action = request.RefreshPath
+}
+
+// Aliases sends the results below directories reachable at more than
+// one path, like bind mounts, at the other paths too. They are marked,
+// request.ParseAlias returns their paths.
+func Aliases(req *request.Request) {
+	req.Settings.Aliases = true
+}
+
+// IncludeFiltered makes the server walk the filtered directory dir
+// for a search by name and send the entries found below it with the
+// results. They are marked, request.ParseFiltered returns their paths.
+func IncludeFiltered(dir string) Option {
+	return func(req *request.Request) {
+		req.Settings.IncludeFiltered = dir
+	}
+}
+
+// CollapseHardlinks makes the server send one result for the hard
+// links to a file, the shortest path. It is marked if others were
+// dropped, request.ParseLinks returns it and their number.
+func CollapseHardlinks(req *request.Request) {
+	req.Settings.CollapseHardlinks = true
+}
+
+// WaitIndex makes a search sent while the server builds its index wait
+// until the entries it needs are indexed, instead of getting the
+// results found so far with a request.WarnPartialIndex warning
+func WaitIndex(req *request.Request) {
+	req.Settings.WaitIndex = true
+}
+
+// Parents makes the server send the directories holding the results
+// of a search instead, each once, ordered by the best result in them
+func Parents(req *request.Request) {
+	req.Settings.Parents = true
+}
+
+// Wildcards makes *, ? and [...] in the query of a substring or prefix
+// search match like in a glob pattern, instead of only themselves
+func Wildcards(req *request.Request) {
+	req.Settings.Wildcards = true
+}
+
+// UnlessGeneration makes the server answer a search by name with a
+// request.Status with Unchanged set instead of its results if its
+// index is still of the generation
+func UnlessGeneration(generation uint64) Option {
+	return func(req *request.Request) {
+		req.Settings.UnlessGeneration = generation
+	}
+}
+
+// Generation makes the server send the generation of its index
+// as a request.GenerationResponse
+func Generation(req *request.Request) {
+	req.Settings.Action = request.Generation
+}
+
+// Root restricts the search for duplicates, changed entries or
+// Parents to the entries below root
+func Root(root string) Option {
+	return func(req *request.Request) {
+		req.Settings.Root = root
+	}
+}
+
+func Stats(req *request.Request) {
+	req.Settings.Action = request.Stats
+}
+
+// Breakdown makes the statistics break the index down by the
+// directories up to levels below the root, 1 or 2
+func Breakdown(levels int) Option {
+	return func(req *request.Request) {
+		req.Settings.Breakdown = levels
+	}
+}
+
+// MinScore makes a fuzzy search drop the matches whose
+// request.FuzzyScore is below score, from 0 to 1
+func MinScore(score float64) Option {
+	return func(req *request.Request) {
+		req.Settings.MinScore = score
+	}
+}
+
+// Scores makes the server send the request.FuzzyScore of each match
+// of a fuzzy search with it, request.ParseScore returns it
+func Scores(req *request.Request) {
+	req.Settings.Scores = true
+}
+
+func ListFilters(req *request.Request) {
+	req.Settings.Action = request.ListFilters
+}
+
+func AddFilter(req *request.Request) {
+	req.Settings.Action = request.AddFilter
+}
+
+func RemoveFilter(req *request.Request) {
+	req.Settings.Action = request.RemoveFilter
+}
+
+// NullDelimited makes the server terminate results with NUL
+// instead of newline, the responses keep their terminator
+func NullDelimited(req *request.Request) {
+	req.Settings.NullDelimited = true
+}
+
+// Pause makes the server stop applying file changes to its index
+func Pause(req *request.Request) {
+	req.Settings.Action = request.Pause
+}
+
+// Debug makes the server write a heap profile and report its memory use
+func Debug(req *request.Request) {
+	req.Settings.Action = request.Debug
+}
+
+// Health makes the server report whether its index is complete
+// and up to date
+func Health(req *request.Request) {
+	req.Settings.Action = request.Health
+}
+
+// Resume makes the server apply the file changes received while paused
+func Resume(req *request.Request) {
+	req.Settings.Action = request.Resume
+}
+
+// Describe makes the server send what its index covers
+// as a request.Description
+func Describe(req *request.Request) {
+	req.Settings.Action = request.Describe
+}
+
+// Failures lists the directories the server couldn't read,
+// with their last error
+func Failures(req *request.Request) {
+	req.Settings.Action = request.Failures
+}
+
+// RetryFailures makes the server read the directories it
+// couldn't read again
+func RetryFailures(req *request.Request) {
+	req.Settings.Action = request.RetryFailures
+}
+
+// Version makes the server describe its build
+func Version(req *request.Request) {
+	req.Settings.Action = request.Version
+}
+
+// DropBehind makes the server drop the results the client doesn't
+// receive as fast as they are found, instead of waiting for it
+func DropBehind(req *request.Request) {
+	req.Settings.Backpressure = request.BackpressureDrop
+}
+
+// VerifyExists makes the server stat the results before sending them
+// and drop those that were deleted since they were indexed
+func VerifyExists(req *request.Request) {
+	req.Settings.VerifyExists = true
+}
+
+// Timing makes the server send a request.Timing line
+// after the results of a search
+func Timing(req *request.Request) {
+	req.Settings.Timing = true
+}
+
+// Persist makes the server write filter changes to its config file
+func Persist(req *request.Request) {
+	req.Settings.Persist = true
+}
+
 func NoSort(req *request.Request) {
 	req.Settings.NoSort = true
 }
@@ -37,44 +330,177 @@ func CaseInsensitive(req *request.Request) {
 	req.Settings.CaseInsensitive = true
 }
 
+// ListAll makes a search with an empty query list every entry,
+// the server rejects such searches otherwise
+func ListAll(req *request.Request) {
+	req.Settings.ListAll = true
+}
+
 func MaxResults(max int) Option {
 	return func(req *request.Request) {
 		req.Settings.MaxResults = max
 	}
 }
 
+// RequestID names the request in the log and the statistics of
+// the server, which generates an ID otherwise
+func RequestID(id string) Option {
+	return func(req *request.Request) {
+		req.RequestID = id
+	}
+}
+
+// ErrInvalidSettings is wrapped by the errors returned for options
+// that can't be combined
+var ErrInvalidSettings = errors.New("invalid options")
+
+// ErrUnsupported is returned if the daemon doesn't support
+// the requested action
+var ErrUnsupported = errors.New("the server doesn't support this request, is it outdated?")
+
+// Type restricts the results to files (request.TypeFile)
+// or directories (request.TypeDirectory)
+func Type(fileType string) Option {
+	return func(req *request.Request) {
+		req.Settings.TypeFilter = fileType
+	}
+}
+
+// Class restricts the results to the files of a class like "image",
+// with sniff the files without an extension are read to find those
+// of the class
+func Class(class string, sniff bool) Option {
+	return func(req *request.Request) {
+		req.Settings.Class = class
+		req.Settings.Sniff = sniff
+	}
+}
+
+// Tag restricts the results to the entries with the tag, the query
+// may be empty then
+func Tag(tag string) Option {
+	return func(req *request.Request) {
+		req.Settings.Tag = tag
+	}
+}
+
+// SortBy sets the sort key, request.SortLength or request.SortMtime
+func SortBy(key string) Option {
+	return func(req *request.Request) {
+		req.Settings.SortBy = key
+	}
+}
+
+// Collate sorts the results in the collation order of locale, like
+// the value of LC_COLLATE. An empty locale uses the root collation.
+func Collate(locale string) Option {
+	return func(req *request.Request) {
+		req.Settings.SortBy = request.SortCollate
+		req.Settings.Locale = locale
+	}
+}
+
 func SearchRequest(searchQuery string, options ...Option) (<-chan string, error) {
+	return SearchRequestContext(context.Background(), searchQuery, options...)
+}
+
+// SearchRequestContext is like SearchRequest, but hangs up once ctx
+// is done, which makes the server cancel the request. The response
+// channel is closed then.
+func SearchRequestContext(ctx context.Context, searchQuery string,
+	options ...Option) (<-chan string, error) {
 	responseChan := make(chan string, 0)
 
 	req := new(request.Request)
+	req.Version = request.ProtocolVersion
+	req.Features = request.SupportedFeatures
 	req.Query = searchQuery
 
 	for _, option := range options {
 		option(req)
 	}
+	if err := req.Settings.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
 
-	c, err := net.Dial("unix", request.SockAddr)
+	var dialer net.Dialer
+	c, err := dialer.DialContext(ctx, "unix", SocketPath)
 
 	if err != nil {
 		return nil, ErrConnectionFailed
 	}
 
+	// closing the connection unblocks the reads below
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-stop:
+		}
+	}()
+	hangUp := func() {
+		close(stop)
+		c.Close()
+	}
+
 	err = json.NewEncoder(c).Encode(&req)
 	if err != nil {
+		hangUp()
 		return nil, err
 	}
 
+	reader := bufio.NewReader(c)
+	first, err := reader.ReadString('\n')
+	if ctx.Err() != nil {
+		hangUp()
+		return nil, ctx.Err()
+	}
+	hello, versioned := request.ParseHello(strings.TrimSuffix(first, "\n"))
+	if e, ok := request.ParseError(strings.TrimSuffix(first, "\n")); ok {
+		// the daemon couldn't decode the request
+		hangUp()
+		return nil, e
+	}
+	for _, feature := range request.RequiredFeatures(req.Settings) {
+		if !hello.Has(feature) {
+			hangUp()
+			return nil, ErrUnsupported
+		}
+	}
+	delimiter := req.Settings.Delimiter()
+	readLine := newLineReader(reader, hello.Has(request.FeatureFraming), delimiter)
+	if versioned {
+		// errors are sent right after the hello
+		first, err = readLine()
+		if e, ok := request.ParseError(strings.TrimSuffix(first, string(delimiter))); ok {
+			hangUp()
+			return nil, e
+		}
+	}
+	if err != nil {
+		first = ""
+	}
+
 	go func() {
 		defer close(responseChan)
-		defer c.Close()
-		reader := bufio.NewReader(c)
+		defer hangUp()
+		line := first
 		for {
-			line, err := reader.ReadString('\n')
+			if line != "" {
+				select {
+				case responseChan <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			var err error
+			line, err = readLine()
 			if err != nil {
 				// TODO: handle this error
 				return
 			}
-			responseChan <- line
 		}
 	}()
 
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"bufio"
+
+	"github.com/ozeidan/gosearch/internal/protocol"
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// lineReader returns the next response line with its terminator, as
+// bufio.Reader.ReadString would
+type lineReader func() (string, error)
+
+// newLineReader returns a lineReader for the lines following the
+// hello, which are framed if the daemon agreed on
+// request.FeatureFraming. Framed lines are given the delimiter, so
+// both can be handled alike. Batched frames are returned as the lines
+// of request.BatchResponse.
+func newLineReader(reader *bufio.Reader, framed bool, delimiter byte) lineReader {
+	if !framed {
+		return func() (string, error) { return reader.ReadString(delimiter) }
+	}
+	frames := protocol.NewReader(reader)
+	return func() (string, error) {
+		for {
+			f, err := frames.Next()
+			if err != nil {
+				return "", err
+			}
+			switch f.Type {
+			case protocol.TypeLine, protocol.TypeMeta:
+				return string(f.Payload) + string(delimiter), nil
+			case protocol.TypeBatch:
+				if id, line, ok := protocol.ParseBatch(f.Payload); ok {
+					response := request.BatchResponse{ID: int(id), Line: string(line)}
+					return response.String() + string(delimiter), nil
+				}
+			}
+		}
+	}
+}
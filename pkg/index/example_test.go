@@ -0,0 +1,81 @@
+package index_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/ozeidan/gosearch/pkg/index"
+)
+
+func Example() {
+	root, err := ioutil.TempDir("", "example")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{"notes.txt", "todo.txt", "photo.jpg"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), nil, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ix, err := index.New(index.Options{Root: root})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ix.Close()
+
+	results, err := ix.Query(context.Background(), index.Query{
+		Text: "txt",
+		Type: index.Files,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for path := range results {
+		fmt.Println(filepath.Base(path))
+	}
+	// Unordered output:
+	// notes.txt
+	// todo.txt
+}
+
+func ExampleIndex_AddPath() {
+	root, err := ioutil.TempDir("", "example")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	ix, err := index.New(index.Options{Root: root})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ix.Close()
+
+	// the index doesn't watch the filesystem, it is told about changes
+	path := filepath.Join(root, "created.txt")
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		log.Fatal(err)
+	}
+	if err := ix.AddPath(path); err != nil {
+		log.Fatal(err)
+	}
+
+	results, err := ix.Query(context.Background(), index.Query{
+		Text: "crtd",
+		Mode: index.Fuzzy,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for path := range results {
+		fmt.Println(filepath.Base(path))
+	}
+	// Output:
+	// created.txt
+}
@@ -0,0 +1,278 @@
+// Package index embeds the index of the gosearch server in other
+// programs. The entries below a directory are kept in a trie of their
+// names, so they can be searched by substring, prefix or fuzzily
+// without touching the disk.
+//
+// An Index doesn't watch the filesystem itself, changes are applied
+// with AddPath, RemovePath and Refresh.
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ozeidan/gosearch/internal/database"
+	"github.com/ozeidan/gosearch/internal/request"
+	"github.com/ozeidan/gosearch/internal/watch"
+)
+
+// ErrClosed is returned by the methods of a closed Index
+var ErrClosed = errors.New("the index is closed")
+
+// ErrInvalidMode is returned for a Query with an unknown Mode
+var ErrInvalidMode = errors.New("invalid query mode")
+
+// ErrEmptyQuery is returned for a Query without Text that doesn't
+// set ListAll
+var ErrEmptyQuery = errors.New("empty query")
+
+// Options configure an Index
+type Options struct {
+	// Root is the absolute path of the directory indexed with
+	// everything below it. Symlinks leading to it are resolved, the
+	// results are at its real path.
+	Root string
+	// SnapshotQueries runs queries concurrently with changes on a
+	// copy of the index, which takes twice the memory. Otherwise
+	// queries and changes are handled one after another.
+	SnapshotQueries bool
+}
+
+// Index is an index of the entries below a directory,
+// its methods can be called concurrently
+type Index struct {
+	changes  chan watch.FileChange
+	requests chan request.Request
+	// mu is held while handing over changes and requests,
+	// so Close doesn't close the channel of requests early
+	mu sync.RWMutex
+	// stop is closed by Close, which cancels the running requests
+	stop     chan struct{}
+	stopOnce sync.Once
+	// done is closed once the index stopped
+	done chan struct{}
+}
+
+// Stats describe an Index
+type Stats struct {
+	// Files and Directories are the numbers of entries
+	// found by the last full index
+	Files       uint64
+	Directories uint64
+	// IndexDuration is the time the last full index took
+	IndexDuration time.Duration
+	// Changes is the number of changes applied since
+	Changes uint64
+}
+
+// New indexes the entries below the root of options, it returns
+// once they are searchable. The Index has to be closed to free it.
+func New(options Options) (*Index, error) {
+	if !filepath.IsAbs(options.Root) {
+		return nil, fmt.Errorf("the root %q isn't an absolute path", options.Root)
+	}
+	// the walk doesn't follow symlinks, and the entries reachable
+	// through one are only indexed at their real paths
+	root, err := filepath.EvalSymlinks(options.Root)
+	if err != nil {
+		return nil, fmt.Errorf("the root %q can't be resolved: %v", options.Root, err)
+	}
+	ix := &Index{
+		changes:  make(chan watch.FileChange),
+		requests: make(chan request.Request),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	db := database.New(database.Options{
+		Root:            root,
+		SnapshotQueries: options.SnapshotQueries,
+	})
+	go func() {
+		defer close(ix.done)
+		db.Run(ix.changes, ix.requests)
+	}()
+
+	// requests are only answered once the initial index is done
+	if _, err := ix.Stats(); err != nil {
+		ix.Close()
+		return nil, err
+	}
+	return ix, nil
+}
+
+// Close stops the index and frees it, queries still running
+// are cancelled
+func (ix *Index) Close() error {
+	closing := false
+	ix.stopOnce.Do(func() {
+		closing = true
+		close(ix.stop)
+	})
+	if !closing {
+		return ErrClosed
+	}
+
+	// the handovers give up once stop is closed
+	ix.mu.Lock()
+	close(ix.requests)
+	ix.mu.Unlock()
+
+	<-ix.done
+	return nil
+}
+
+// AddPath makes the entry created at path searchable, with everything
+// below it if it is a directory. Like RemovePath it reads the parent
+// directory of path, so both apply whatever changed in it.
+func (ix *Index) AddPath(path string) error {
+	return ix.changed(path, watch.Creation)
+}
+
+// RemovePath removes the entry that was deleted at path from the
+// index, with everything below it
+func (ix *Index) RemovePath(path string) error {
+	return ix.changed(path, watch.Deletion)
+}
+
+// changed hands a change of the entry at path to the index, it is
+// applied before the requests sent after it returns
+func (ix *Index) changed(path string, changeType int) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("%q isn't an absolute path", path)
+	}
+
+	change := watch.FileChange{
+		FolderPath: filepath.Dir(filepath.Clean(path)),
+		ChangeType: changeType,
+	}
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	select {
+	case <-ix.stop:
+		return ErrClosed
+	default:
+	}
+	select {
+	case ix.changes <- change:
+		return nil
+	case <-ix.stop:
+		return ErrClosed
+	}
+}
+
+// Refresh reads the directory at path and everything below it again
+// and applies what changed. It fails if path doesn't exist, which
+// removes it from the index nonetheless.
+func (ix *Index) Refresh(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("%q isn't an absolute path", path)
+	}
+	lines, err := ix.request(context.Background(), request.Request{
+		Version:  request.ProtocolVersion,
+		Query:    path,
+		Settings: request.Settings{Action: request.RefreshPath},
+	})
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if e, ok := request.ParseError(line); ok {
+			return errors.New(e.Message)
+		}
+	}
+	return nil
+}
+
+// Stats returns the statistics of the index
+func (ix *Index) Stats() (Stats, error) {
+	lines, err := ix.request(context.Background(), request.Request{
+		Settings: request.Settings{Action: request.Stats},
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+	if len(lines) == 0 {
+		return Stats{}, errors.New("no statistics")
+	}
+
+	var stats request.StatsResponse
+	if err := json.Unmarshal([]byte(lines[0]), &stats); err != nil {
+		return Stats{}, err
+	}
+	return Stats{
+		Files:         stats.IndexedFiles,
+		Directories:   stats.IndexedDirectories,
+		IndexDuration: time.Duration(stats.IndexDuration * float64(time.Second)),
+		Changes:       stats.EventsProcessed,
+	}, nil
+}
+
+// request sends req and returns all its response lines
+func (ix *Index) request(ctx context.Context, req request.Request) ([]string, error) {
+	responses, err := ix.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for line := range responses {
+		lines = append(lines, line)
+	}
+	return lines, ctx.Err()
+}
+
+// send hands req to the index and returns its responses. They are
+// sent until the index is done or ctx is, the channel is closed then.
+func (ix *Index) send(ctx context.Context, req request.Request) (<-chan string, error) {
+	req.RequestID = request.NewRequestID()
+	req.ResponseChannel = make(chan string)
+	req.Done = make(chan struct{})
+
+	if err := ix.handOver(ctx, req); err != nil {
+		return nil, err
+	}
+
+	responses := make(chan string)
+	go func() {
+		defer close(responses)
+		defer func() {
+			close(req.Done)
+			// the index closes the channel once it noticed
+			for range req.ResponseChannel {
+			}
+		}()
+		for line := range req.ResponseChannel {
+			select {
+			case responses <- line:
+			case <-ctx.Done():
+				return
+			case <-ix.stop:
+				return
+			}
+		}
+	}()
+	return responses, nil
+}
+
+// handOver sends req to the goroutine of the index
+func (ix *Index) handOver(ctx context.Context, req request.Request) error {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	select {
+	case <-ix.stop:
+		return ErrClosed
+	default:
+	}
+	select {
+	case ix.requests <- req:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-ix.stop:
+		return ErrClosed
+	}
+}
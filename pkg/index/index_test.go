@@ -0,0 +1,281 @@
+package index
+
+import (
+	"context"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// indexing logs every directory it can't read
+	slog.SetDefault(slog.New(slog.NewTextHandler(ioutil.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// fixture creates the files and directories, whose names end with a
+// slash, below a new directory and returns its real path
+func fixture(tb testing.TB, paths ...string) string {
+	root, err := filepath.EvalSymlinks(tb.TempDir())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, entry := range paths {
+		path := filepath.Join(root, entry)
+		var err error
+		if strings.HasSuffix(entry, "/") {
+			err = os.MkdirAll(path, 0755)
+		} else if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			err = ioutil.WriteFile(path, nil, 0644)
+		}
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return root
+}
+
+// search returns the results of q, relative to root and sorted
+func search(tb testing.TB, ix *Index, root string, q Query) []string {
+	results, err := ix.Query(context.Background(), q)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var paths []string
+	for path := range results {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestIndex_Query(t *testing.T) {
+	root := fixture(t,
+		"src/main.go",
+		"src/main_test.go",
+		"src/cmd/tool/main.go",
+		"docs/Manual.md",
+		"docs/images/",
+	)
+	ix, err := New(Options{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"substring", Query{Text: "ain"},
+			[]string{"src/cmd/tool/main.go", "src/main.go", "src/main_test.go"}},
+		{"prefix", Query{Text: "main.", Mode: Prefix},
+			[]string{"src/cmd/tool/main.go", "src/main.go"}},
+		{"fuzzy", Query{Text: "mngo", Mode: Fuzzy},
+			[]string{"src/cmd/tool/main.go", "src/main.go", "src/main_test.go"}},
+		{"path", Query{Text: "toolmain", Mode: Path},
+			[]string{"src/cmd/tool/main.go"}},
+		{"segments", Query{Text: "cmd/main", Mode: Segments},
+			[]string{"src/cmd/tool/main.go"}},
+		{"case_insensitive", Query{Text: "manual", CaseInsensitive: true},
+			[]string{"docs/Manual.md"}},
+		{"directories", Query{Text: "s", Type: Directories},
+			[]string{"docs", "docs/images", "src"}},
+		{"files", Query{Text: "images", Type: Files}, nil},
+		{"limited", Query{Text: "main", MaxResults: 1}, []string{"src/main.go"}},
+		{"list_all", Query{ListAll: true, Type: Files}, []string{"docs/Manual.md",
+			"src/cmd/tool/main.go", "src/main.go", "src/main_test.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := search(t, ix, root, tt.query)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ix.Query(context.Background(), Query{Mode: Mode(42)}); err != ErrInvalidMode {
+		t.Errorf("got %v for an invalid mode, want ErrInvalidMode", err)
+	}
+	if _, err := ix.Query(context.Background(), Query{}); err != ErrEmptyQuery {
+		t.Errorf("got %v for an empty query, want ErrEmptyQuery", err)
+	}
+	if _, err := ix.Query(context.Background(), Query{Text: "s", Mode: Path, Type: Files}); err == nil {
+		t.Error("a path search with a type filter was accepted")
+	}
+}
+
+func TestIndex_BestFirst(t *testing.T) {
+	root := fixture(t, "a/b/c/report.txt", "report.txt", "a/report.txt")
+	ix, err := New(Options{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+
+	results, err := ix.Query(context.Background(), Query{Text: "report"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for path := range results {
+		got = append(got, path)
+	}
+	want := []string{
+		filepath.Join(root, "report.txt"),
+		filepath.Join(root, "a/report.txt"),
+		filepath.Join(root, "a/b/c/report.txt"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want the shortest path first %q", got, want)
+	}
+}
+
+func TestIndex_Changes(t *testing.T) {
+	for _, snapshots := range []bool{false, true} {
+		name := "without_snapshots"
+		if snapshots {
+			name = "with_snapshots"
+		}
+		t.Run(name, func(t *testing.T) {
+			root := fixture(t, "old.txt", "dir/nested.txt")
+			ix, err := New(Options{Root: root, SnapshotQueries: snapshots})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ix.Close()
+			txt := Query{Text: ".txt"}
+
+			if err := ioutil.WriteFile(filepath.Join(root, "new.txt"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := ix.AddPath(filepath.Join(root, "new.txt")); err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"dir/nested.txt", "new.txt", "old.txt"}
+			if got := search(t, ix, root, txt); !reflect.DeepEqual(got, want) {
+				t.Errorf("after adding got %q, want %q", got, want)
+			}
+
+			if err := os.RemoveAll(filepath.Join(root, "dir")); err != nil {
+				t.Fatal(err)
+			}
+			if err := ix.RemovePath(filepath.Join(root, "dir")); err != nil {
+				t.Fatal(err)
+			}
+			want = []string{"new.txt", "old.txt"}
+			if got := search(t, ix, root, txt); !reflect.DeepEqual(got, want) {
+				t.Errorf("after removing got %q, want %q", got, want)
+			}
+
+			deep := filepath.Join(root, "deep/er/still.txt")
+			if err := os.MkdirAll(filepath.Dir(deep), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(deep, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := ix.Refresh(root); err != nil {
+				t.Fatal(err)
+			}
+			want = []string{"deep/er/still.txt", "new.txt", "old.txt"}
+			if got := search(t, ix, root, txt); !reflect.DeepEqual(got, want) {
+				t.Errorf("after refreshing got %q, want %q", got, want)
+			}
+
+			stats, err := ix.Stats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Files != 2 || stats.Directories != 2 || stats.Changes != 2 {
+				t.Errorf("got %+v, want the 2 files and 2 directories indexed "+
+					"first and 2 changes", stats)
+			}
+		})
+	}
+}
+
+func TestIndex_Close(t *testing.T) {
+	root := fixture(t, "a.txt", "b.txt", "c.txt")
+	if _, err := New(Options{Root: "relative"}); err == nil {
+		t.Error("a relative root was accepted")
+	}
+
+	ix, err := New(Options{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// closing another index of the same directory leaves ix open
+	other, err := New(Options{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// an abandoned query doesn't keep the index from closing
+	results, err := ix.Query(context.Background(), Query{Text: "txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-results
+	if err := ix.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for range results {
+	}
+
+	if err := ix.Close(); err != ErrClosed {
+		t.Errorf("got %v closing twice, want ErrClosed", err)
+	}
+	if _, err := ix.Query(context.Background(), Query{Text: "txt"}); err != ErrClosed {
+		t.Errorf("got %v querying a closed index, want ErrClosed", err)
+	}
+	if err := ix.AddPath(filepath.Join(root, "a.txt")); err != ErrClosed {
+		t.Errorf("got %v changing a closed index, want ErrClosed", err)
+	}
+}
+
+func TestIndex_SymlinkedRoot(t *testing.T) {
+	dir := fixture(t, "data/a.txt", "data/sub/b.txt")
+	if err := os.Symlink(filepath.Join(dir, "data"), filepath.Join(dir, "link")); err != nil {
+		t.Skip("can't create symlinks:", err)
+	}
+	tests := []struct {
+		name string
+		root string
+		want []string
+	}{
+		// the entries are at the real path of the root
+		{"symlinked", filepath.Join(dir, "link"), []string{"data/a.txt", "data/sub/b.txt"}},
+		// and not found again through the symlink below it
+		{"containing_symlink", dir, []string{"data/a.txt", "data/sub/b.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ix, err := New(Options{Root: tt.root})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ix.Close()
+			if got := search(t, ix, dir, Query{Text: "txt"}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := New(Options{Root: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("a missing root was accepted")
+	}
+}
@@ -0,0 +1,99 @@
+package index
+
+import (
+	"context"
+
+	"github.com/ozeidan/gosearch/internal/request"
+)
+
+// Mode is the way a Query matches entries
+type Mode int
+
+const (
+	// Substring matches the names containing the text
+	Substring Mode = iota
+	// Prefix matches the names starting with the text
+	Prefix
+	// Fuzzy matches the names containing the characters
+	// of the text in order
+	Fuzzy
+	// Path matches the paths containing the characters
+	// of the text in order
+	Path
+	// Segments matches names fuzzily, the parts of the text before
+	// a slash match the names of parent directories
+	Segments
+)
+
+// actions maps the modes to the actions of requests
+var actions = map[Mode]int{
+	Substring: request.SubStringSearch,
+	Prefix:    request.PrefixSearch,
+	Fuzzy:     request.FuzzySearch,
+	Path:      request.PathSearch,
+	Segments:  request.SegmentSearch,
+}
+
+// Type restricts the results of a Query to files or directories
+type Type string
+
+const (
+	// AnyType matches files and directories
+	AnyType Type = ""
+	// Files only matches files
+	Files Type = request.TypeFile
+	// Directories only matches directories
+	Directories Type = request.TypeDirectory
+)
+
+// Query is a search of an Index
+type Query struct {
+	// Text is searched for as set by Mode
+	Text string
+	Mode Mode
+	Type Type
+	// MaxResults is the number of paths sent, 0 means all
+	MaxResults int
+	// CaseInsensitive ignores the case of the text and the names
+	CaseInsensitive bool
+	// NoSort sends the paths in the order they were found,
+	// which is faster for large result sets
+	NoSort bool
+	// ListAll makes an empty Text match every entry, Query
+	// fails for an empty Text otherwise
+	ListAll bool
+}
+
+// settings returns the settings of the request for q
+func (q Query) settings() (request.Settings, error) {
+	action, ok := actions[q.Mode]
+	if !ok {
+		return request.Settings{}, ErrInvalidMode
+	}
+	if q.Text == "" && !q.ListAll {
+		return request.Settings{}, ErrEmptyQuery
+	}
+	settings := request.Settings{
+		Action:          action,
+		MaxResults:      q.MaxResults,
+		NoSort:          q.NoSort,
+		ReverseSort:     true,
+		CaseInsensitive: q.CaseInsensitive,
+		TypeFilter:      string(q.Type),
+		ListAll:         q.ListAll,
+	}
+	return settings, settings.Validate()
+}
+
+// Query searches the index and sends the matching paths on the
+// returned channel, the best match first unless the query sets
+// NoSort. The channel is closed after the last path. It has to be
+// read until then or ctx cancelled, the index doesn't handle changes
+// while it waits for the paths to be read.
+func (ix *Index) Query(ctx context.Context, q Query) (<-chan string, error) {
+	settings, err := q.settings()
+	if err != nil {
+		return nil, err
+	}
+	return ix.send(ctx, request.Request{Query: q.Text, Settings: settings})
+}
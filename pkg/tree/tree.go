@@ -1,7 +1,9 @@
 package tree
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 
 	"gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
@@ -13,6 +15,9 @@ type Node struct {
 	name     string
 	parent   *Node
 	mask     uint64
+	// descendants is the number of nodes below the node, kept up to
+	// date by the operations changing the tree
+	descendants int
 }
 
 // ErrInvalidPath is returned when the path given to one of
@@ -25,6 +30,16 @@ func (err ErrInvalidPath) Error() string {
 	return fmt.Sprintf("accesing invalid path: %s", err.path)
 }
 
+// ErrPathExists is returned when a subtree is moved to a path
+// that already exists
+type ErrPathExists struct {
+	path string
+}
+
+func (err ErrPathExists) Error() string {
+	return fmt.Sprintf("path already exists: %s", err.path)
+}
+
 func (t Node) findFile(name string) (*Node, bool) {
 	for _, c := range t.children {
 		if c.name == name {
@@ -34,15 +49,23 @@ func (t Node) findFile(name string) (*Node, bool) {
 	return nil, false
 }
 
-func (t *Node) deleteFile(name string) bool {
-	for i := range t.children {
-		if t.children[i].name == name {
+func (t *Node) deleteFile(name string) (*Node, bool) {
+	for i, c := range t.children {
+		if c.name == name {
 			t.children[i] = t.children[len(t.children)-1]
 			t.children = t.children[:len(t.children)-1]
-			return true
+			t.addDescendants(-1 - c.descendants)
+			return c, true
 		}
 	}
-	return false
+	return nil, false
+}
+
+// addDescendants adds n to the descendants of t and its ancestors
+func (t *Node) addDescendants(n int) {
+	for current := t; current != nil; current = current.parent {
+		current.descendants += n
+	}
 }
 
 // GetChildren returns the directoryies/files of a directory
@@ -92,10 +115,10 @@ func (t *Node) Add(path string) *Node {
 		if child, ok := current.findFile(part); ok {
 			current = child
 		} else {
-			newPart := make([]byte, len(part))
-			copy(newPart, []byte(part))
-			child = &Node{make([]*Node, 0), string(newPart), current, 0}
+			// part is a slice of path, which shouldn't be kept alive
+			child = &Node{make([]*Node, 0), strings.Clone(part), current, 0, 0}
 			current.children = append(current.children, child)
+			current.addDescendants(1)
 			current = child
 		}
 	}
@@ -103,49 +126,257 @@ func (t *Node) Add(path string) *Node {
 	return current
 }
 
+// AddChild adds name below t and returns the new node. Unlike Add it
+// doesn't look for an existing child with the same name, the caller
+// has to make sure there is none. name isn't copied, so it shouldn't
+// be a slice of a longer string.
+func (t *Node) AddChild(name string) *Node {
+	child := &Node{make([]*Node, 0), name, t, 0, 0}
+	t.children = append(t.children, child)
+	t.addDescendants(1)
+
+	// the masks of the ancestors contain the ones below them,
+	// so the first one already containing the name ends the loop
+	mask := makePrefixMask(name)
+	for current := t; current != nil && current.mask|mask != current.mask; current = current.parent {
+		current.mask |= mask
+	}
+	return child
+}
+
+// Grow makes room for n more children, so adding them
+// doesn't reallocate
+func (t *Node) Grow(n int) {
+	if cap(t.children)-len(t.children) >= n {
+		return
+	}
+	children := make([]*Node, len(t.children), len(t.children)+n)
+	copy(children, t.children)
+	t.children = children
+}
+
+// Clone returns a copy of the tree below t, cloned is called with
+// every node and its copy
+func (t *Node) Clone(cloned func(node, clone *Node)) *Node {
+	return t.clone(nil, cloned)
+}
+
+func (t *Node) clone(parent *Node, cloned func(node, clone *Node)) *Node {
+	clone := &Node{make([]*Node, len(t.children)), t.name, parent, t.mask, t.descendants}
+	for i, child := range t.children {
+		clone.children[i] = child.clone(clone, cloned)
+	}
+	cloned(t, clone)
+	return clone
+}
+
 // DeleteAt deletes a directory and its subdirectories/files from the tree
 func (t *Node) DeleteAt(path string) error {
 	parts := pathToParts(path)
-	current := *t
+	if len(parts) == 0 {
+		// the root can't be deleted
+		return ErrInvalidPath{path}
+	}
+	current := t
 	for _, part := range parts[:len(parts)-1] {
 		if child, ok := current.findFile(part); ok {
-			current = *child
+			current = child
 		} else {
 			return ErrInvalidPath{path}
 		}
 	}
 
-	ok := current.deleteFile(parts[len(parts)-1])
+	_, ok := current.deleteFile(parts[len(parts)-1])
+	current.resetMask()
 
-	var mask uint64
-	for _, c := range current.children {
-		mask |= c.mask
+	if !ok {
+		return ErrInvalidPath{path}
 	}
-	current.mask = mask
+	return nil
+}
 
+// Move moves the subtree at oldPath to newPath, the directories
+// leading to newPath are added if they don't exist. The nodes of the
+// subtree are kept, so their paths change with it. Nothing is changed
+// if oldPath doesn't exist, newPath does or is below oldPath.
+func (t *Node) Move(oldPath, newPath string) error {
+	oldParts, newParts := pathToParts(oldPath), pathToParts(newPath)
+	if len(oldParts) == 0 {
+		// the root can't be moved
+		return ErrInvalidPath{oldPath}
+	}
+	if len(newParts) == 0 {
+		return ErrPathExists{newPath}
+	}
+	node, ok := t.find(oldParts)
 	if !ok {
-		return ErrInvalidPath{path}
+		return ErrInvalidPath{oldPath}
+	}
+	if _, ok := t.find(newParts); ok {
+		return ErrPathExists{newPath}
+	}
+	if len(newParts) > len(oldParts) && strings.HasPrefix(newPath, oldPath+"/") {
+		// the subtree can't be moved into itself
+		return ErrInvalidPath{newPath}
+	}
+
+	parent := node.parent
+	parent.deleteFile(node.name)
+	parent.resetMask()
+
+	parent = t
+	if len(newParts) > 1 {
+		parent = t.Add(newPath[:strings.LastIndex(newPath, "/")])
+	}
+	node.name = strings.Clone(newParts[len(newParts)-1])
+	node.parent = parent
+	parent.children = append(parent.children, node)
+	parent.addDescendants(1 + node.descendants)
+
+	mask := node.mask | makePrefixMask(node.name)
+	for current := parent; current != nil && current.mask|mask != current.mask; current = current.parent {
+		current.mask |= mask
 	}
 	return nil
 }
 
-func (t *Node) GetPath() string {
-	parts := make([]string, 0, 10) // faster?
+// resetMask recomputes the mask of t from its children, the masks
+// of its ancestors may still contain names that are gone
+func (t *Node) resetMask() {
+	var mask uint64
+	for _, c := range t.children {
+		mask |= c.mask | makePrefixMask(c.name)
+	}
+	t.mask = mask
+}
+
+// find returns the node at the path split into parts
+func (t *Node) find(parts []string) (*Node, bool) {
 	current := t
+	for _, part := range parts {
+		child, ok := current.findFile(part)
+		if !ok {
+			return nil, false
+		}
+		current = child
+	}
+	return current, true
+}
 
-	for ; current.parent != nil; current = current.parent {
-		parts = append(parts, current.name)
+// WalkFunc is called by Walk with the path of every node and whether
+// the node has no children. Returning an error stops the walk.
+type WalkFunc func(path string, isLeaf bool) error
+
+// Walk calls fn for the node at root and every node below it, at most
+// maxDepth levels below root unless maxDepth is 0. Parents are visited
+// before their children and siblings in the order of their names.
+// It returns the error returned by fn.
+func (t *Node) Walk(root string, maxDepth int, fn WalkFunc) error {
+	trimmed := strings.TrimSuffix(root, "/")
+	node, ok := t.find(pathToParts(trimmed))
+	if !ok {
+		return ErrInvalidPath{root}
 	}
+	path := make([]byte, 0, 256)
+	path = append(path, trimmed...)
+	return node.walkSorted(path, 0, maxDepth, fn)
+}
 
-	var builder strings.Builder
-	for i := len(parts) - 1; i >= 0; i-- {
-		builder.WriteString("/")
-		builder.WriteString(parts[i])
+func (t *Node) walkSorted(path []byte, depth, maxDepth int, fn WalkFunc) error {
+	var err error
+	if len(path) == 0 {
+		err = fn("/", len(t.children) == 0)
+	} else {
+		err = fn(string(path), len(t.children) == 0)
+	}
+	if err != nil {
+		return err
+	}
+	if len(t.children) == 0 || (maxDepth > 0 && depth >= maxDepth) {
+		return nil
+	}
+
+	children := t.children
+	if len(children) > 1 {
+		children = make([]*Node, len(t.children))
+		copy(children, t.children)
+		sort.Sort(byName(children))
 	}
+	for _, c := range children {
+		childPath := append(append(path, '/'), c.name...)
+		if err := c.walkSorted(childPath, depth+1, maxDepth, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type byName []*Node
 
+func (n byName) Len() int           { return len(n) }
+func (n byName) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n byName) Less(i, j int) bool { return n[i].name < n[j].name }
+
+// Name returns the last element of the path of t
+func (t *Node) Name() string {
+	return t.name
+}
+
+// GetPath returns the path of t, the root's path is empty
+func (t *Node) GetPath() string {
+	var builder strings.Builder
+	builder.Grow(t.PathLen())
+	t.buildPath(&builder)
 	return builder.String()
 }
 
+// AppendPath appends the path of t to dst and returns the
+// extended slice
+func (t *Node) AppendPath(dst []byte) []byte {
+	n := t.PathLen()
+	if cap(dst)-len(dst) < n {
+		grown := make([]byte, len(dst), len(dst)+n)
+		copy(grown, dst)
+		dst = grown
+	}
+	dst = dst[:len(dst)+n]
+
+	// the names are filled in from the end, walking up to the root
+	end := len(dst)
+	for current := t; current.parent != nil; current = current.parent {
+		end -= len(current.name)
+		copy(dst[end:], current.name)
+		end--
+		dst[end] = '/'
+	}
+	return dst
+}
+
+// WritePath writes the path of t to buf without allocating
+// anything but the room buf needs
+func (t *Node) WritePath(buf *bytes.Buffer) {
+	buf.Grow(t.PathLen())
+	buf.Write(t.AppendPath(buf.AvailableBuffer()))
+}
+
+// PathLen returns the length of the path of t
+func (t *Node) PathLen() int {
+	var n int
+	for current := t; current.parent != nil; current = current.parent {
+		n += 1 + len(current.name)
+	}
+	return n
+}
+
+func (t *Node) buildPath(builder *strings.Builder) {
+	if t.parent == nil {
+		return
+	}
+	t.parent.buildPath(builder)
+	builder.WriteByte('/')
+	builder.WriteString(t.name)
+}
+
 func (t Node) walk(path string, visitor func(part string) error) error {
 	err := visitor(path)
 	if err != nil {
@@ -153,13 +384,21 @@ func (t Node) walk(path string, visitor func(part string) error) error {
 	}
 
 	for _, c := range t.children {
-		newPath := path + "/" + c.name
-		c.walk(newPath, visitor)
+		c.walk(joinPath(path, c.name), visitor)
 	}
 
 	return nil
 }
 
+// joinPath returns the path of name in the directory at dir,
+// which is empty or "/" for the root
+func joinPath(dir, name string) string {
+	if strings.HasSuffix(dir, "/") {
+		return dir + name
+	}
+	return dir + "/" + name
+}
+
 const upperBits = 0xFFFFFFC00
 const lowerBits = 0x3FFFFFF000000000
 
@@ -214,6 +453,11 @@ func (t Node) VisitFuzzy(bquery patricia.Prefix,
 	)
 
 	query := string(bquery)
+	// the query is lowercased once, so its indices stay valid when
+	// lowercasing changes its length
+	if caseInsensitive {
+		query = strings.ToLower(query)
+	}
 
 	potential := []potentialSubtree{potentialSubtree{node: &t, part: "", idx: 0}}
 	for l := len(potential); l > 0; l = len(potential) {
@@ -230,7 +474,7 @@ func (t Node) VisitFuzzy(bquery patricia.Prefix,
 		}
 
 		if p.idx == len(query) {
-			fullName := p.part + "/" + p.node.name
+			fullName := joinPath(p.part, p.node.name)
 
 			err := p.node.walk(fullName, func(path string) error {
 				err := visitor(patricia.Prefix(path), struct{}{}, p.skipped)
@@ -260,15 +504,9 @@ func (t Node) VisitFuzzy(bquery patricia.Prefix,
 		}
 
 		for _, c := range p.node.children {
-			var newPart string
-			if p.part == "/" {
-				newPart = "/" + p.node.name
-			} else {
-				newPart = p.part + "/" + p.node.name
-			}
 			potential = append(potential, potentialSubtree{
 				node:    c,
-				part:    newPart,
+				part:    joinPath(p.part, p.node.name),
 				idx:     p.idx,
 				skipped: p.skipped,
 			})
@@ -278,10 +516,41 @@ func (t Node) VisitFuzzy(bquery patricia.Prefix,
 	return nil
 }
 
+// MatchAncestors fuzzy matches segments against the names of the
+// directories above t. The last segment has to match an ancestor
+// closer to t than the one matched by the segment before it, other
+// ancestors may be passed over. It returns the number of characters
+// skipped within the matched names plus the number of ancestors
+// passed over, ok is false if not all segments match.
+func (t *Node) MatchAncestors(segments []string, caseInsensitive bool) (skipped int, ok bool) {
+	current := t.parent
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment := segments[i]
+		if caseInsensitive {
+			segment = strings.ToLower(segment)
+		}
+		for ; current != nil && current.parent != nil; current = current.parent {
+			count, skippedChars := fuzzyMatchCount(current.name, segment, 0, caseInsensitive)
+			if count == len(segment) {
+				skipped += skippedChars
+				break
+			}
+			skipped++
+		}
+		if current == nil || current.parent == nil {
+			return 0, false
+		}
+		current = current.parent
+	}
+	return skipped, true
+}
+
+// fuzzyMatchCount returns how many bytes of partialQuery match
+// part in order. partialQuery has to be lowercase if caseInsensitive
+// is set.
 func fuzzyMatchCount(part, partialQuery string, idx int, caseInsensitive bool) (count, skipped int) {
 	if caseInsensitive {
 		part = strings.ToLower(part)
-		partialQuery = strings.ToLower(partialQuery)
 	}
 	for i := 0; i < len(part); i++ {
 		if part[i] != partialQuery[count] {
@@ -299,11 +568,46 @@ func fuzzyMatchCount(part, partialQuery string, idx int, caseInsensitive bool) (
 	return
 }
 
+// Count returns the number of nodes below t
+func (t *Node) Count() int {
+	return t.descendants
+}
+
+// Parent returns the node t is directly below, nil for the root
+func (t *Node) Parent() *Node {
+	return t.parent
+}
+
+// NumChildren returns the number of nodes directly below t
+func (t *Node) NumChildren() int {
+	return len(t.children)
+}
+
+// Lookup returns the node at path
+func (t *Node) Lookup(path string) (*Node, error) {
+	node, ok := t.find(pathToParts(strings.TrimSuffix(path, "/")))
+	if !ok {
+		return nil, ErrInvalidPath{path}
+	}
+	return node, nil
+}
+
+// VisitChildren calls fn with each node directly below t, in no
+// particular order. The tree mustn't be changed by fn.
+func (t *Node) VisitChildren(fn func(child *Node)) {
+	for _, c := range t.children {
+		fn(c)
+	}
+}
+
 // New returns a new Node
 func New() *Node {
-	return &Node{make([]*Node, 0), "", nil, 0}
+	return &Node{make([]*Node, 0), "", nil, 0, 0}
 }
 
 func pathToParts(path string) []string {
+	if path == "/" {
+		return nil
+	}
 	return strings.Split(path, "/")[1:]
 }
@@ -1,8 +1,16 @@
 package tree
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
+
+	patricia "gopkg.in/ozeidan/fuzzy-patricia.v3/patricia"
 )
 
 var files = []string{
@@ -51,6 +59,12 @@ func TestNode_GetChildren(t *testing.T) {
 			[]string{"file3", "file4"},
 			false,
 		},
+		{
+			"root_test",
+			args{"/"},
+			[]string{"home"},
+			false,
+		},
 		{
 			"invalid_path",
 			args{"/home/user/doesntexist"},
@@ -108,6 +122,141 @@ func TestNode_AddGetPath(t *testing.T) {
 	}
 }
 
+func TestNode_WritePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		written string
+	}{
+		{"root", "/", ""},
+		{"short", "/usr", "/usr"},
+		{"deep", "/home/user/Documents/projects/gosearch/internal/database",
+			"/home/user/Documents/projects/gosearch/internal/database"},
+		{"empty_name", "/home//file", "/home//file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := buildTree()
+			node := tree
+			if tt.path != "/" {
+				node = tree.Add(tt.path)
+			}
+
+			if got := node.GetPath(); got != tt.written {
+				t.Errorf("Node.GetPath() = %q, want %q", got, tt.written)
+			}
+			if got := string(node.AppendPath([]byte("prefix"))); got != "prefix"+tt.written {
+				t.Errorf("Node.AppendPath() = %q, want %q", got, "prefix"+tt.written)
+			}
+			var buf bytes.Buffer
+			buf.WriteString("line\n")
+			node.WritePath(&buf)
+			if got := buf.String(); got != "line\n"+tt.written {
+				t.Errorf("Node.WritePath() wrote %q, want %q", got, "line\n"+tt.written)
+			}
+		})
+	}
+}
+
+// deepNode returns the deepest node of a tree depth directories deep
+func deepNode(depth int) *Node {
+	node := New()
+	for i := 0; i < depth; i++ {
+		node = node.AddChild(fmt.Sprintf("directory%d", i))
+	}
+	return node
+}
+
+func BenchmarkNode_GetPath(b *testing.B) {
+	for _, depth := range []int{5, 25} {
+		node := deepNode(depth)
+		b.Run(fmt.Sprintf("depth%d", depth), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = node.GetPath()
+			}
+		})
+	}
+}
+
+func BenchmarkNode_WritePath(b *testing.B) {
+	for _, depth := range []int{5, 25} {
+		node := deepNode(depth)
+		b.Run(fmt.Sprintf("depth%d", depth), func(b *testing.B) {
+			var buf bytes.Buffer
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				node.WritePath(&buf)
+			}
+		})
+	}
+}
+
+func TestNode_AddChild(t *testing.T) {
+	tests := []struct {
+		name   string
+		parent string
+		child  string
+	}{
+		{"new_file", "/home/user/Downloads", "newfile"},
+		{"new_chars", "/home/user/empty", "XYZ-9"},
+		{"root", "/", "usr"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.parent + "/" + tt.child
+			if tt.parent == "/" {
+				path = tt.parent + tt.child
+			}
+			want := buildTree()
+			want.Add(path)
+
+			got := buildTree()
+			parent := got
+			if tt.parent != "/" {
+				parent = got.Add(tt.parent)
+			}
+			child := parent.AddChild(tt.child)
+
+			if gotPath := child.GetPath(); gotPath != path {
+				t.Errorf("Node.GetPath() = %s, want %s", gotPath, path)
+			}
+			// the masks decide which subtrees fuzzy searches descend into
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("AddChild() built a different tree than Add()")
+			}
+		})
+	}
+}
+
+func TestNode_Clone(t *testing.T) {
+	original := buildTree()
+	clones := make(map[*Node]*Node)
+	clone := original.Clone(func(node, clone *Node) { clones[node] = clone })
+
+	if !reflect.DeepEqual(clone, original) {
+		t.Fatal("Clone() differs from the original")
+	}
+	if got, want := len(clones), original.Count()+1; got != want {
+		t.Errorf("cloned is called for %d nodes, want %d", got, want)
+	}
+	for node, c := range clones {
+		if node == c || c.GetPath() != node.GetPath() {
+			t.Errorf("clone of %s is %p with path %s", node.GetPath(), c, c.GetPath())
+		}
+	}
+
+	// changing the clone leaves the original alone
+	clone.Add("/home/user/Desktop/file5")
+	if err := clone.DeleteAt("/home/user/Documents"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(original, buildTree()) {
+		t.Error("changing the clone changed the original")
+	}
+}
+
 func TestNode_DeleteAt(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -129,6 +278,11 @@ func TestNode_DeleteAt(t *testing.T) {
 			"/home/user/invalid/path/err",
 			true,
 		},
+		{
+			"root",
+			"/",
+			true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -144,6 +298,360 @@ func TestNode_DeleteAt(t *testing.T) {
 	}
 }
 
+func TestNode_DeleteAtChildren(t *testing.T) {
+	tree := buildTree()
+	if err := tree.DeleteAt("/home/user/Documents"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := tree.GetChildren("/home/user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	want := []string{"Desktop", "Downloads", "empty"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Node.GetChildren() = %v, want %v", got, want)
+	}
+}
+
+// treePaths returns the sorted paths of the nodes below t
+func treePaths(t *Node) []string {
+	var paths []string
+	var visit func(node *Node)
+	visit = func(node *Node) {
+		for _, c := range node.children {
+			paths = append(paths, c.GetPath())
+			visit(c)
+		}
+	}
+	visit(t)
+	sort.Strings(paths)
+	return paths
+}
+
+// checkTree checks the parent pointers of the tree and that the masks
+// contain at least the names below the nodes, as the exact masks of
+// want do
+func checkTree(t *testing.T, got, want *Node) {
+	t.Helper()
+	var visit func(node *Node)
+	visit = func(node *Node) {
+		if exact, ok := want.find(pathToParts(node.GetPath())); node.parent != nil && !ok {
+			t.Errorf("unexpected node %s", node.GetPath())
+		} else if ok && node.mask|exact.mask != node.mask {
+			t.Errorf("mask of %s lacks the names below it", node.GetPath())
+		}
+		descendants := len(node.children)
+		for _, c := range node.children {
+			if c.parent != node {
+				t.Errorf("parent of %s is wrong", c.GetPath())
+			}
+			visit(c)
+			descendants += c.descendants
+		}
+		if node.descendants != descendants {
+			t.Errorf("%s counts %d descendants, want %d", node.GetPath(), node.descendants, descendants)
+		}
+	}
+	visit(got)
+	if gotPaths, wantPaths := treePaths(got), treePaths(want); !reflect.DeepEqual(gotPaths, wantPaths) {
+		t.Errorf("paths = %v, want %v", gotPaths, wantPaths)
+	}
+}
+
+// movedPaths returns paths with the ones below oldPath moved to newPath
+func movedPaths(paths []string, oldPath, newPath string) []string {
+	moved := make([]string, len(paths))
+	for i, path := range paths {
+		if path == oldPath || strings.HasPrefix(path, oldPath+"/") {
+			path = newPath + path[len(oldPath):]
+		}
+		moved[i] = path
+	}
+	return moved
+}
+
+func TestNode_Move(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldPath string
+		newPath string
+		wantErr error
+	}{
+		{"rename", "/home/user/Desktop", "/home/user/desk", nil},
+		{"rename_file", "/home/user/Desktop/file3", "/home/user/Desktop/file5", nil},
+		{"new_parents", "/home/user/Documents", "/mnt/backup/docs", nil},
+		{"to_top", "/home/user/Downloads/file2", "/file2", nil},
+		{"up", "/home/user", "/home/other", nil},
+		{"missing", "/home/user/doesntexist", "/home/user/new", ErrInvalidPath{"/home/user/doesntexist"}},
+		{"exists", "/home/user/Desktop", "/home/user/empty", ErrPathExists{"/home/user/empty"}},
+		{"same", "/home/user/Desktop", "/home/user/Desktop", ErrPathExists{"/home/user/Desktop"}},
+		{"into_itself", "/home/user", "/home/user/empty/user", ErrInvalidPath{"/home/user/empty/user"}},
+		{"root", "/", "/new", ErrInvalidPath{"/"}},
+		{"to_root", "/home", "/", ErrPathExists{"/"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := buildTree()
+			before := treePaths(tree)
+			node, _ := tree.find(pathToParts(tt.oldPath))
+
+			err := tree.Move(tt.oldPath, tt.newPath)
+			if err != tt.wantErr {
+				t.Fatalf("Node.Move() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				checkTree(t, tree, buildTree())
+				return
+			}
+
+			want := New()
+			for _, path := range movedPaths(before, tt.oldPath, tt.newPath) {
+				want.Add(path)
+			}
+			checkTree(t, tree, want)
+			if got := node.GetPath(); got != tt.newPath {
+				t.Errorf("moved node has path %s, want %s", got, tt.newPath)
+			}
+		})
+	}
+}
+
+// TestNode_MoveRandom moves subtrees of random trees and compares the
+// result with trees built from the moved paths
+func TestNode_MoveRandom(t *testing.T) {
+	names := []string{"a", "b", "c", "ab", "B.txt", "x-1"}
+	randomPath := func(rng *rand.Rand) string {
+		var path string
+		for depth := 1 + rng.Intn(4); depth > 0; depth-- {
+			path += "/" + names[rng.Intn(len(names))]
+		}
+		return path
+	}
+
+	for seed := int64(0); seed < 500; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		tree := New()
+		for i := 0; i < 30; i++ {
+			tree.Add(randomPath(rng))
+		}
+		before := treePaths(tree)
+		oldPath := before[rng.Intn(len(before))]
+		newPath := randomPath(rng)
+		node, _ := tree.find(pathToParts(oldPath))
+
+		err := tree.Move(oldPath, newPath)
+		_, exists := buildFrom(before).find(pathToParts(newPath))
+		switch {
+		case exists:
+			if _, ok := err.(ErrPathExists); !ok {
+				t.Fatalf("seed %d: moving %s to existing %s: error = %v", seed, oldPath, newPath, err)
+			}
+			checkTree(t, tree, buildFrom(before))
+		case strings.HasPrefix(newPath, oldPath+"/"):
+			if _, ok := err.(ErrInvalidPath); !ok {
+				t.Fatalf("seed %d: moving %s into itself at %s: error = %v", seed, oldPath, newPath, err)
+			}
+			checkTree(t, tree, buildFrom(before))
+		default:
+			if err != nil {
+				t.Fatalf("seed %d: moving %s to %s: %v", seed, oldPath, newPath, err)
+			}
+			checkTree(t, tree, buildFrom(movedPaths(before, oldPath, newPath)))
+			if node.GetPath() != newPath {
+				t.Fatalf("seed %d: moved node has path %s, want %s", seed, node.GetPath(), newPath)
+			}
+		}
+	}
+}
+
+func buildFrom(paths []string) *Node {
+	tree := New()
+	for _, path := range paths {
+		tree.Add(path)
+	}
+	return tree
+}
+
+func TestNode_Walk(t *testing.T) {
+	errStop := errors.New("stop")
+	tests := []struct {
+		name     string
+		root     string
+		maxDepth int
+		stopAt   string
+		want     []string
+		wantErr  error
+	}{
+		{"whole_tree", "/", 0, "", []string{"/", "/home", "/home/user",
+			"/home/user/Desktop", "/home/user/Desktop/file3 leaf", "/home/user/Desktop/file4 leaf",
+			"/home/user/Documents", "/home/user/Documents/file1 leaf",
+			"/home/user/Downloads", "/home/user/Downloads/file2 leaf",
+			"/home/user/empty leaf"}, nil},
+		{"subtree", "/home/user/Desktop", 0, "", []string{"/home/user/Desktop",
+			"/home/user/Desktop/file3 leaf", "/home/user/Desktop/file4 leaf"}, nil},
+		{"trailing_slash", "/home/user/Downloads/", 0, "", []string{"/home/user/Downloads",
+			"/home/user/Downloads/file2 leaf"}, nil},
+		{"max_depth", "/home", 2, "", []string{"/home", "/home/user",
+			"/home/user/Desktop", "/home/user/Documents", "/home/user/Downloads",
+			"/home/user/empty leaf"}, nil},
+		{"leaf", "/home/user/empty", 0, "", []string{"/home/user/empty leaf"}, nil},
+		{"stopped", "/", 0, "/home/user/Documents", []string{"/", "/home", "/home/user",
+			"/home/user/Desktop", "/home/user/Desktop/file3 leaf", "/home/user/Desktop/file4 leaf",
+			"/home/user/Documents"}, errStop},
+		{"invalid_root", "/home/nobody", 0, "", nil, ErrInvalidPath{"/home/nobody"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := buildTree().Walk(tt.root, tt.maxDepth, func(path string, isLeaf bool) error {
+				if isLeaf {
+					got = append(got, path+" leaf")
+				} else {
+					got = append(got, path)
+				}
+				if path == tt.stopAt {
+					return errStop
+				}
+				return nil
+			})
+			if err != tt.wantErr {
+				t.Errorf("Node.Walk() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Node.Walk() visited %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNode_MatchAncestors(t *testing.T) {
+	tree := New()
+	main := tree.Add("/home/user/src/myproject/cmd/main.go")
+
+	tests := []struct {
+		name            string
+		segments        []string
+		caseInsensitive bool
+		wantSkipped     int
+		wantOk          bool
+	}{
+		{"none", nil, false, 0, true},
+		{"parent", []string{"cmd"}, false, 0, true},
+		{"passed_over", []string{"proj"}, false, 1, true},
+		{"skipped_chars", []string{"mprj"}, false, 1 + 2, true},
+		{"in_order", []string{"src", "proj"}, false, 1, true},
+		{"wrong_order", []string{"proj", "src"}, false, 0, false},
+		{"same_ancestor_twice", []string{"cmd", "cmd"}, false, 0, false},
+		{"case", []string{"SRC"}, false, 0, false},
+		{"case_insensitive", []string{"SRC"}, true, 2, true},
+		{"no_match", []string{"lib"}, false, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			skipped, ok := main.MatchAncestors(tt.segments, tt.caseInsensitive)
+			if ok != tt.wantOk || (ok && skipped != tt.wantSkipped) {
+				t.Errorf("MatchAncestors() = %d, %v, want %d, %v",
+					skipped, ok, tt.wantSkipped, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestNode_VisitFuzzy(t *testing.T) {
+	tree := buildFrom([]string{"/home/user/notes.txt", "/srv/ȺB", "/srv/\xff"})
+
+	tests := []struct {
+		name            string
+		query           string
+		caseInsensitive bool
+		want            []string
+	}{
+		{"empty", "", false, []string{"/", "/home", "/home/user",
+			"/home/user/notes.txt", "/srv", "/srv/ȺB", "/srv/\xff"}},
+		{"top_level", "srv", false, []string{"/srv", "/srv/ȺB", "/srv/\xff"}},
+		{"nested", "usrnotes", false, []string{"/home/user/notes.txt"}},
+		{"case", "SRV", false, nil},
+		// lowercasing these queries changes their length
+		{"longer_lowercase", "Ⱥb", true, []string{"/srv/ȺB"}},
+		{"invalid_utf8", "\xff", true, []string{"/srv/\xff"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			tree.VisitFuzzy(patricia.Prefix(tt.query), tt.caseInsensitive,
+				func(prefix patricia.Prefix, item patricia.Item, skipped int) error {
+					got = append(got, string(prefix))
+					return nil
+				})
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("VisitFuzzy() found %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNode_Count(t *testing.T) {
+	tests := []struct {
+		name string
+		tree *Node
+		want int
+	}{
+		{"empty", New(), 0},
+		{"files", buildTree(), 10},
+		{"deleted", func() *Node {
+			tree := buildTree()
+			tree.DeleteAt("/home/user/Documents")
+			return tree
+		}(), 8},
+		{"moved", func() *Node {
+			tree := buildTree()
+			tree.Move("/home/user/Desktop", "/tmp/x/Desktop")
+			return tree
+		}(), 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.tree.Count(); got != tt.want {
+				t.Errorf("Node.Count() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNode_Lookup(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		wantChildren int
+		wantCount    int
+		wantErr      bool
+	}{
+		{"root", "/", 1, 10, false},
+		{"directory", "/home/user/Desktop", 2, 2, false},
+		{"trailing_slash", "/home/user/", 4, 8, false},
+		{"leaf", "/home/user/empty", 0, 0, false},
+		{"missing", "/home/other", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := buildTree().Lookup(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Lookup(%s) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if node.NumChildren() != tt.wantChildren || node.Count() != tt.wantCount {
+				t.Errorf("Lookup(%s) has %d children, %d nodes below it, want %d, %d", tt.path,
+					node.NumChildren(), node.Count(), tt.wantChildren, tt.wantCount)
+			}
+		})
+	}
+}
+
 func TestNew(t *testing.T) {
 	tests := []struct {
 		name string
@@ -151,7 +659,7 @@ func TestNew(t *testing.T) {
 	}{
 		{
 			"default_test",
-			&Node{[]*Node{}, "", nil, 0},
+			&Node{[]*Node{}, "", nil, 0, 0},
 		},
 	}
 	for _, tt := range tests {